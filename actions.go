@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+)
+
+// memberActions returns the member actions to offer on item: permitted for the user's role, visible to them and,
+// on read-only resources, safe.
+func (reg *Registry) memberActions(res *resource.Resource, user *models.AdminUser, item map[string]interface{}) []resource.Action {
+	return visibleActions(reg.permittedActions(res, res.MemberActions, user), user, item)
+}
+
+func (reg *Registry) collectionActions(res *resource.Resource, user *models.AdminUser) []resource.Action {
+	return visibleActions(reg.permittedActions(res, res.CollectionActions, user), user, nil)
+}
+
+// permittedActions filters actions to those user's role may run on res, leaving out writes on read-only resources.
+func (reg *Registry) permittedActions(res *resource.Resource, actions []resource.Action, user *models.AdminUser) []resource.Action {
+	var list []resource.Action
+	for _, a := range actions {
+		if (a.Safe || !res.ReadOnly) && reg.customActionAllowed(user.Role, res.Slug, a.Permission()) { list = append(list, a) }
+	}
+	return list
+}
+
+func visibleActions(actions []resource.Action, user *models.AdminUser, item map[string]interface{}) []resource.Action {
+	var list []resource.Action
+	for _, a := range actions { if a.IsVisible(user, item) { list = append(list, a) } }
+	return list
+}
+
+func (reg *Registry) batchActions(res *resource.Resource, user *models.AdminUser) []resource.BatchAction {
+	var actions []resource.BatchAction
+	for _, a := range res.BatchActions {
+		if (a.Safe || !res.ReadOnly) && a.IsVisible(user) && reg.customActionAllowed(user.Role, res.Slug, a.Permission()) { actions = append(actions, a) }
+	}
+	return actions
+}
+
+// actionResponse is the body of a JSON action's response.
+type actionResponse struct {
+	OK      bool        `json:"ok"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+func writeActionResponse(w http.ResponseWriter, status int, resp actionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleJSONAction runs a JSON action on POST, with the same visibility check against the current record as a page
+// action, and answers {ok, message, data}: 200 on success, 422 when the params or the handler fail.
+func (reg *Registry) handleJSONAction(res *resource.Resource, a resource.Action, w http.ResponseWriter, r *http.Request, user *models.AdminUser, isCollection bool) {
+	if r.Method != "POST" { writeActionResponse(w, http.StatusMethodNotAllowed, actionResponse{Message: reg.T(r.Context(), "Method not allowed")}); return }
+	ctx := &resource.ActionContext{Resource: res, User: user, Request: r}
+	var item map[string]interface{}
+	if !isCollection {
+		ctx.ID = r.URL.Query().Get("id")
+		record, err := reg.getContext(r.Context(), res.Slug, ctx.ID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, gorm.ErrRecordNotFound) { status = http.StatusNotFound } else { reg.log(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "status", status, "error", err) }
+			writeActionResponse(w, status, actionResponse{Message: reg.T(r.Context(), http.StatusText(status))})
+			return
+		}
+		item, ctx.IDs = rawValues(res, reflect.ValueOf(record)), []string{ctx.ID}
+	}
+	if !a.IsVisible(user, item) { writeActionResponse(w, http.StatusForbidden, actionResponse{Message: reg.T(r.Context(), "Forbidden")}); return }
+	if len(a.Params) > 0 {
+		values, errs := parseParams(a.Params, r)
+		if errs != nil { writeActionResponse(w, http.StatusUnprocessableEntity, actionResponse{Message: reg.T(r.Context(), "Please correct the highlighted fields."), Data: errs}); return }
+		ctx.Params = values
+		ctx.Request = resource.WithParamValues(r, values)
+	}
+	result, err := a.JSONHandler(ctx)
+	if err != nil {
+		reg.log(r.Context()).Warn("action failed", "resource", res.Slug, "action", a.Name, "id", ctx.ID, "user", user.Email, "error", err)
+		writeActionResponse(w, http.StatusUnprocessableEntity, actionResponse{Message: err.Error()})
+		return
+	}
+	resp := actionResponse{OK: true, Message: reg.T(r.Context(), "%s done", a.Label), Data: result}
+	switch v := result.(type) {
+	case resource.ActionResult:
+		resp.Data = v.Data
+		if v.Message != "" { resp.Message = v.Message }
+	case *resource.ActionResult:
+		resp.Data = v.Data
+		if v.Message != "" { resp.Message = v.Message }
+	}
+	writeActionResponse(w, http.StatusOK, resp)
+}
@@ -1,17 +1,201 @@
 package admin
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// updateGolden rewrites the golden files under testdata from the current output: go test -run TestCore/X -update.
+var updateGolden = flag.Bool("update", false, "rewrite the golden files under testdata")
+
 type TestModel struct {
 	ID   uint `gorm:"primaryKey"`
 	Name string
 }
 
+type Customer struct {
+	ID      uint `gorm:"primaryKey"`
+	Name    string
+	Country string
+}
+
+type Memo struct {
+	ID                   uint `gorm:"primaryKey"`
+	Title                string
+	CreatedByID          uint
+	UpdatedByID          *uint
+	CreatedAt, UpdatedAt time.Time
+}
+
+type Order struct {
+	ID         uint `gorm:"primaryKey"`
+	Name       string
+	CustomerID uint
+	Total      int64
+}
+
+type Task struct {
+	ID       uint `gorm:"primaryKey"`
+	Name     string
+	Done     bool
+	Position int
+}
+
+type Product struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"uniqueIndex"`
+	Stock int
+	Image string
+}
+
+type Sku struct {
+	Code string `gorm:"primaryKey"`
+	Name string
+}
+
+type Device struct {
+	ID      uuid.UUID `gorm:"type:char(36);primaryKey"`
+	Name    string
+	SkuCode string
+}
+
+type Reviewed struct {
+	ReviewedBy string
+	Approved   bool
+}
+
+type Invoice struct {
+	gorm.Model
+	*Reviewed
+	Number string
+	Total  float64
+}
+
+type Article struct {
+	ID     uint `gorm:"primaryKey"`
+	Title  string
+	Tags   []string `gorm:"serializer:json"`
+	Labels string
+}
+
+type Note struct {
+	ID    uint `gorm:"primaryKey"`
+	OrgID uint
+	Title string
+}
+
+type Ticket struct {
+	ID       uint `gorm:"primaryKey"`
+	Name     string
+	Status   string
+	Priority string
+}
+
+type Event struct {
+	ID       uint `gorm:"primaryKey"`
+	Name     string
+	StartsAt time.Time
+	EndsAt   *time.Time
+}
+
+type Category struct {
+	ID       uint `gorm:"primaryKey"`
+	Name     string
+	ParentID *uint
+}
+
+// Audited and Wide are a model of typical width with promoted fields, for the list rendering benchmark.
+type Audited struct {
+	CreatedBy, UpdatedBy string
+	Version              int
+}
+
+type Wide struct {
+	ID                          uint
+	Audited
+	Name, Email, Phone, City    string
+	Country, Status, Note       string
+	Score, Visits               int
+	Balance                     int64
+	Active                      bool
+}
+
+type Incident struct {
+	ID           uint `gorm:"primaryKey"`
+	Name         string
+	Open         bool
+	AssignedToID *uint
+}
+
+type Plan struct {
+	ID    uint `gorm:"primaryKey"`
+	Color string
+	Trial time.Duration
+	Grace int64
+	Price int64
+}
+
+type Address struct {
+	ID      uint `gorm:"primaryKey"`
+	Country string
+	State   string
+}
+
+type sentMail struct{ To, Subject, HTML, Text string }
+
+type fakeMailer struct{ sent chan sentMail }
+
+func (m *fakeMailer) Send(to, subject, html, text string) error { m.sent <- sentMail{to, subject, html, text}; return nil }
+
+type attachMailer struct {
+	fakeMailer
+	attached chan Attachment
+}
+
+func (m *attachMailer) SendAttachment(to, subject, html, text string, att Attachment) error {
+	m.attached <- att
+	return m.Send(to, subject, html, text)
+}
+
 func TestCore(t *testing.T) {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	db.AutoMigrate(&TestModel{}, &Permission{})
@@ -59,4 +243,4337 @@ func TestCore(t *testing.T) {
 		conf, _ := LoadConfig("test.yml")
 		if conf.SiteTitle != "Custom" || conf.DefaultPerPage != 50 { t.Error("Config load failed") }
 	})
+
+	t.Run("AssociationFilter", func(t *testing.T) {
+		db.AutoMigrate(&Customer{}, &Order{})
+		reg.Register(Customer{}).HasMany("Orders", "Orders", "Order", "CustomerID")
+		reg.Register(Order{}).BelongsTo("CustomerID", "Customer", "Customer", "ID").AddAssociationFilter("CustomerID", "Country")
+		in, fr := &Customer{Name: "A", Country: "IN"}, &Customer{Name: "B", Country: "FR"}
+		db.Create(in); db.Create(fr)
+		db.Create(&Order{Name: "o1", CustomerID: in.ID}); db.Create(&Order{Name: "o2", CustomerID: in.ID}); db.Create(&Order{Name: "o3", CustomerID: fr.ID})
+
+		res, _ := reg.GetResource("Order")
+		lq, err := reg.buildListQuery(context.Background(), res, url.Values{"af_CustomerID.Country": {"IN"}, "q_Name": {"o"}})
+		if err != nil { t.Fatal(err) }
+		var orders []Order
+		lq.Find(&orders)
+		if lq.Count() != 2 || len(orders) != 2 { t.Errorf("Expected 2 orders, got count %d, rows %d", lq.Count(), len(orders)) }
+
+		cres, _ := reg.GetResource("Customer")
+		cres.AddAssociationFilter("Orders", "Name")
+		lq, err = reg.buildListQuery(context.Background(), cres, url.Values{"af_Orders.Name": {"o1"}})
+		if err != nil { t.Fatal(err) }
+		if lq.Count() != 1 { t.Errorf("Expected 1 customer, got %d", lq.Count()) }
+
+		if _, err := reg.buildListQuery(context.Background(), res, url.Values{"q_Name; DROP TABLE orders": {"x"}}); err != nil { t.Error(err) }
+	})
+
+	t.Run("SavedFilterDefaults", func(t *testing.T) {
+		db.AutoMigrate(&SavedFilter{})
+		res, _ := reg.GetResource("Order")
+		alice, bob := &AdminUser{ID: 1, Role: "support"}, &AdminUser{ID: 2, Role: "support"}
+		db.Create(&SavedFilter{UserID: alice.ID, ResourceName: "Order", Name: "Shared", Query: "scope=open", Role: "support", IsDefault: true})
+		db.Create(&SavedFilter{UserID: bob.ID, ResourceName: "Order", Name: "Private", Query: "q_Name=o1"})
+		if n := len(reg.presetsFor(context.Background(), res, bob)); n != 2 { t.Errorf("Expected 2 presets for bob, got %d", n) }
+		if p := reg.defaultPreset(context.Background(), res, bob); p == nil || p.Name != "Shared" { t.Error("Expected shared default for bob") }
+		db.Create(&SavedFilter{UserID: bob.ID, ResourceName: "Order", Name: "Mine", Query: "sort=Name", IsDefault: true})
+		if p := reg.defaultPreset(context.Background(), res, bob); p == nil || p.Name != "Mine" { t.Error("Own default should win over shared one") }
+	})
+
+	t.Run("ColumnPreferences", func(t *testing.T) {
+		db.AutoMigrate(&UserPreference{})
+		res := reg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Country", "Country", false)
+		user := &AdminUser{ID: 7}
+		if len(reg.indexFields(context.Background(), res, user)) != 3 { t.Error("Expected resource defaults without a preference") }
+		db.Create(&UserPreference{UserID: user.ID, ResourceName: "Customer", Columns: "Country,Missing,Name"})
+		fields := reg.indexFields(context.Background(), res, user)
+		if len(fields) != 2 || fields[0].Name != "Country" || fields[1].Name != "Name" { t.Errorf("Unexpected columns %v", fields) }
+	})
+
+	t.Run("CursorPagination", func(t *testing.T) {
+		res, _ := reg.GetResource("Order")
+		lq, _ := reg.buildListQuery(context.Background(), res, url.Values{})
+		rows, hasPrev, hasNext := lq.Keyset(res.Model, "", "", 2)
+		if rows.Len() != 2 || hasPrev || !hasNext { t.Fatalf("Unexpected first page: %d rows, prev %v, next %v", rows.Len(), hasPrev, hasNext) }
+		last := lq.cursor(rows.Index(1))
+		rows, hasPrev, hasNext = lq.Keyset(res.Model, last, "", 2)
+		if rows.Len() != 1 || !hasPrev || hasNext { t.Errorf("Unexpected last page: %d rows, prev %v, next %v", rows.Len(), hasPrev, hasNext) }
+		rows, _, _ = lq.Keyset(res.Model, "", lq.cursor(rows.Index(0)), 2)
+		if rows.Len() != 2 || lq.cursor(rows.Index(1)) != last { t.Error("Expected before cursor to return the previous page in display order") }
+	})
+
+	t.Run("CountStrategies", func(t *testing.T) {
+		res, _ := reg.GetResource("Customer")
+		exact := reg.CountFor(context.Background(), res, nil)
+		res.SetCountStrategy(CountCached)
+		if reg.CountFor(context.Background(), res, nil) != exact { t.Fatal("Cached count should match exact count on first load") }
+		db.Create(&Customer{Name: "C", Country: "DE"})
+		if reg.CountFor(context.Background(), res, nil) != exact { t.Error("Expected cached count within TTL") }
+		res.SetCountStrategy(CountEstimated)
+		if reg.CountFor(context.Background(), res, nil) != exact+1 { t.Error("SQLite estimates should fall back to an exact count") }
+
+		cache := newCountCache()
+		func() {
+			defer func() { recover() }()
+			cache.get("k", time.Minute, func() (int64, bool) { panic("boom") })
+		}()
+		done := make(chan int64)
+		go func() { done <- cache.get("k", time.Minute, func() (int64, bool) { return 7, true }) }()
+		select {
+		case n := <-done:
+			if n != 7 { t.Errorf("Expected a fresh load after a panic, got %d", n) }
+		case <-time.After(2 * time.Second):
+			t.Error("A panicking load left the key in flight")
+		}
+	})
+
+	t.Run("TemplateOverrides", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(dir+"/style.css", []byte("body { color: red; }"), 0644)
+		reg.Config.TemplateOverrideDir = dir
+		defer func() { reg.Config.TemplateOverrideDir = "" }()
+		if css := reg.styleCSS(); css != "body { color: red; }" { t.Errorf("Expected overridden CSS, got %q", css) }
+		if _, err := reg.parseTemplates("layout.html", "index.html"); err != nil { t.Errorf("Embedded fallback failed: %v", err) }
+		os.WriteFile(dir+"/show.html", []byte("{{.Broken"), 0644)
+		if _, err := reg.parseTemplates("layout.html", "show.html"); err == nil || !strings.Contains(err.Error(), dir) { t.Errorf("Expected parse error naming the override path, got %v", err) }
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		mreg := NewRegistry(db)
+		var order []string
+		tag := func(name string) Middleware {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { order = append(order, name); next.ServeHTTP(w, r) })
+			}
+		}
+		deny := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "denied", http.StatusForbidden) })
+		}
+		mreg.Use(tag("first"), tag("second"), deny)
+		rec := httptest.NewRecorder()
+		mreg.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/", nil))
+		if rec.Code != http.StatusForbidden { t.Errorf("Expected middleware to run before the auth redirect, got %d", rec.Code) }
+		if strings.Join(order, ",") != "first,second" { t.Errorf("Unexpected middleware order %v", order) }
+	})
+
+	t.Run("ErrorPages", func(t *testing.T) {
+		db.AutoMigrate(&AdminUser{}, &Session{})
+		admin := &AdminUser{Email: "root@example.com", Role: "admin"}
+		db.Create(admin)
+		db.Create(&Session{ID: hashToken("error-pages"), UserID: admin.ID, Role: admin.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		get := func(path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			reg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := get("/admin/Customer/show?id=999"); rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "record not found") {
+			t.Errorf("Expected 404 page without details, got %d", rec.Code)
+		}
+		reg.Config.DebugErrors = true
+		defer func() { reg.Config.DebugErrors = false }()
+		if rec := get("/admin/Customer/edit?id=999"); !strings.Contains(rec.Body.String(), "record not found") { t.Error("Expected error details with DebugErrors") }
+	})
+
+	t.Run("QueryContext", func(t *testing.T) {
+		res, _ := reg.GetResource("Order")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		lq, _ := reg.buildListQuery(ctx, res, url.Values{})
+		var orders []Order
+		if err := lq.Find(&orders); err == nil { t.Error("Expected a cancelled context to abort the list query") }
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		scrape := func(token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/admin/metrics", nil)
+			if token != "" { req.Header.Set("Authorization", "Bearer "+token) }
+			rec := httptest.NewRecorder()
+			reg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := scrape(""); rec.Code != http.StatusNotFound { t.Errorf("Expected metrics to be off by default, got %d", rec.Code) }
+		reg.Config.EnableMetrics, reg.Config.MetricsToken = true, "scrape-me"
+		defer func() { reg.Config.EnableMetrics, reg.Config.MetricsToken = false, "" }()
+		req := httptest.NewRequest("GET", "/admin/Customer", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+		reg.ServeHTTP(httptest.NewRecorder(), req)
+		if rec := scrape("wrong"); rec.Code != http.StatusUnauthorized { t.Errorf("Expected a bad token to be rejected, got %d", rec.Code) }
+		body := scrape("scrape-me").Body.String()
+		for _, want := range []string{`goadmin_requests_total{resource="Customer",action="list",status="200"} 1`, `goadmin_query_duration_seconds_count{query="count"} 1`, "goadmin_active_sessions 1"} {
+			if !strings.Contains(body, want) { t.Errorf("Expected metrics to contain %q", want) }
+		}
+	})
+
+	t.Run("ConcurrentRegistration", func(t *testing.T) {
+		creg := NewRegistry(db)
+		first := creg.Register(Customer{})
+		if again := creg.Register(Customer{}); again != first { t.Error("Expected re-registering a model to return the existing resource") }
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					req := httptest.NewRequest("GET", "/admin/", nil)
+					req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+					creg.ServeHTTP(httptest.NewRecorder(), req)
+				}
+			}()
+		}
+		for j := 0; j < 20; j++ {
+			creg.Register(Order{})
+			creg.AddPage(fmt.Sprintf("page-%d", j), "", func(w http.ResponseWriter, r *http.Request) {})
+			creg.AddChart("Orders", "bar", func(db *gorm.DB) ([]string, []float64) { return nil, nil })
+			creg.ResourceNames()
+		}
+		wg.Wait()
+	})
+
+	t.Run("DeterministicOrdering", func(t *testing.T) {
+		oreg := NewRegistry(db)
+		oreg.Config.GroupOrder = []string{"Sales"}
+		oreg.Register(TestModel{}).SetGroup("Zeta")
+		oreg.Register(Order{}).SetGroup("Sales")
+		oreg.Register(Customer{}).SetGroup("Sales").SetPriority(-1)
+		oreg.AddPage("Reports", "Alpha", func(w http.ResponseWriter, r *http.Request) {})
+		if got := strings.Join(oreg.navGroups(nil), ","); got != "Sales,Alpha,System,Zeta" { t.Errorf("Unexpected group order %s", got) }
+		if sales := oreg.getGroupedResources(nil)["Sales"]; sales[0].Name != "Customer" { t.Errorf("Expected priority to sort Customer first, got %s", sales[0].Name) }
+		render := func() string {
+			req := httptest.NewRequest("GET", "/admin/", nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			oreg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		first := render()
+		for i := 0; i < 5; i++ { if render() != first { t.Fatal("Expected the dashboard to render identically across requests") } }
+	})
+
+	t.Run("CustomSlug", func(t *testing.T) {
+		sreg := NewRegistry(db)
+		db.AutoMigrate(&AuditLog{})
+		sreg.Register(Customer{}).SetName("Customer Accounts").SetSlug("customer-accounts").SetIcon("users").RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		if res, ok := sreg.GetResource("Customer"); !ok || res.Slug != "customer-accounts" { t.Error("Expected lookup by struct name to fall back to the renamed resource") }
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			var body *strings.Reader
+			if form != nil { body = strings.NewReader(form.Encode()) } else { body = strings.NewReader("") }
+			req := httptest.NewRequest(method, path, body)
+			if form != nil { req.Header.Set("Content-Type", "application/x-www-form-urlencoded") }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			sreg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := do("GET", "/admin/customer-accounts", nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/admin/customer-accounts/new") || !strings.Contains(rec.Body.String(), "Customer Accounts") {
+			t.Errorf("Expected the list to be served under the slug with the display name, got %d", rec.Code)
+		}
+		rec = do("POST", "/admin/customer-accounts/save", url.Values{"Name": {"Acme"}})
+		if rec.Header().Get("Location") != "/admin/customer-accounts" { t.Errorf("Expected redirect to the slug, got %q", rec.Header().Get("Location")) }
+		var entry AuditLog
+		db.Order("id desc").First(&entry)
+		if entry.ResourceName != "customer-accounts" { t.Errorf("Expected audit entries keyed by slug, got %q", entry.ResourceName) }
+	})
+
+	t.Run("HiddenAndReadOnly", func(t *testing.T) {
+		hreg := NewRegistry(db)
+		hreg.Register(TestModel{}).Hide()
+		ran := ""
+		hreg.Register(Customer{}).SetReadOnly(true).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			AddBatchAction("archive", "Archive", func(res *Resource, ids []string, w http.ResponseWriter, r *http.Request) { ran += "archive" }).
+			AddBatchAction("tag", "Tag", func(res *Resource, ids []string, w http.ResponseWriter, r *http.Request) { ran += "tag" }).
+			MarkActionSafe("tag")
+		if len(hreg.getGroupedResources(nil)["Default"]) != 1 { t.Error("Expected hidden resources to be left out of the navigation") }
+		do := func(method, path string, form url.Values) int {
+			body := strings.NewReader(form.Encode())
+			req := httptest.NewRequest(method, path, body)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			hreg.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		if code := do("GET", "/admin/TestModel", nil); code != http.StatusOK { t.Errorf("Expected hidden resources to stay routable, got %d", code) }
+		if code := do("GET", "/admin/Customer", nil); code != http.StatusOK { t.Errorf("Expected read-only list to work, got %d", code) }
+		for _, path := range []string{"/admin/Customer/new", "/admin/Customer/delete?id=1"} {
+			if code := do("GET", path, nil); code != http.StatusForbidden { t.Errorf("Expected %s to be refused, got %d", path, code) }
+		}
+		if code := do("POST", "/admin/Customer/save", url.Values{"Name": {"x"}}); code != http.StatusForbidden { t.Errorf("Expected save to be refused, got %d", code) }
+		do("POST", "/admin/Customer/batch_action", url.Values{"action_name": {"archive"}, "ids": {"1"}})
+		do("POST", "/admin/Customer/batch_action", url.Values{"action_name": {"tag"}, "ids": {"1"}})
+		if ran != "tag" { t.Errorf("Expected only the safe batch action to run, got %q", ran) }
+	})
+
+	t.Run("FieldSections", func(t *testing.T) {
+		res := NewResource(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Country", "Country", false)
+		if groups := res.GroupFields(res.Fields); len(groups) != 1 || len(groups[0].Fields) != 3 || groups[0].Title != "" {
+			t.Error("Expected a single untitled group without declared sections")
+		}
+		res.FieldTab("Location", "Country").FieldSection("Basics", "Name")
+		groups := res.GroupFields(res.Fields)
+		var order []string
+		for _, g := range groups { order = append(order, g.Title+"/"+g.Tab) }
+		if strings.Join(order, ",") != "/,Basics/,/Location" { t.Errorf("Unexpected section order %v", order) }
+		if len(groups[2].Tabs) != 1 || groups[2].Tabs[0] != "Location" { t.Error("Expected the first tabbed group to carry the tab bar") }
+
+		freg := NewRegistry(db)
+		freg.Resources[res.Slug] = res
+		req := httptest.NewRequest("GET", "/admin/Customer/new", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+		rec := httptest.NewRecorder()
+		freg.ServeHTTP(rec, req)
+		if body := rec.Body.String(); !strings.Contains(body, "<legend>Basics</legend>") || !strings.Contains(body, `data-tab="Location"`) {
+			t.Errorf("Expected the form to render sections and tabs, got %d", rec.Code)
+		}
+	})
+
+	t.Run("FormPrefill", func(t *testing.T) {
+		db.AutoMigrate(&Customer{}, &Order{})
+		acme := &Customer{Name: "Acme Corp"}
+		db.Create(acme)
+		preg := NewRegistry(db)
+		preg.Config.SearchThreshold = 0
+		preg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		preg.Register(Order{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("CustomerID", "Customer", false).
+			BelongsTo("CustomerID", "Customer", "Customer", "ID").
+			SetDefault("Name", DefaultFunc(func(u *AdminUser) interface{} { return "Order by " + u.Email }))
+		req := httptest.NewRequest("GET", fmt.Sprintf("/admin/Order/new?CustomerID=%d&ID=7", acme.ID), nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+		rec := httptest.NewRecorder()
+		preg.ServeHTTP(rec, req)
+		body := rec.Body.String()
+		if !strings.Contains(body, `value="Order by root@example.com"`) { t.Errorf("Expected the default to be applied, got %d", rec.Code) }
+		if !strings.Contains(body, `value="Acme Corp"`) || !strings.Contains(body, fmt.Sprintf(`value="%d"`, acme.ID)) { t.Error("Expected the prefilled foreign key with its label") }
+		if strings.Contains(body, `name="ID"`) { t.Error("Expected read-only fields not to be prefilled") }
+	})
+
+	t.Run("VirtualFields", func(t *testing.T) {
+		vreg := NewRegistry(db)
+		res := vreg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			AddVirtualField("Shout", "Shout", func(db *gorm.DB, item map[string]interface{}) interface{} { return strings.ToUpper(item["Name"].(string)) + "!" })
+		for _, f := range res.GetFieldsFor("edit") { if f.Virtual { t.Error("Expected virtual fields to be left out of forms") } }
+		get := func(path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			vreg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		if !strings.Contains(get("/admin/Customer"), "ACME CORP!") { t.Error("Expected the list to show the computed column") }
+		if !strings.Contains(get("/admin/Customer/export"), "ACME CORP!") { t.Error("Expected exports to include the computed column") }
+	})
+
+	t.Run("CellRenderers", func(t *testing.T) {
+		rreg := NewRegistry(db)
+		rreg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			SetRenderer("Name", func(v interface{}, item map[string]interface{}) template.HTML { return Badge(v.(string), "#16a34a") })
+		db.Create(&Customer{Name: "<script>"})
+		get := func(path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			rreg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		list := get("/admin/Customer")
+		if !strings.Contains(list, `<span class="badge" style="background: #16a34a;">Acme Corp</span>`) { t.Error("Expected the renderer's HTML in the list") }
+		if strings.Contains(list, "<script></span>") { t.Error("Expected Badge to escape its text") }
+		if search := get("/admin/Customer/search?q=Acme"); strings.Contains(search, "badge") { t.Error("Expected the search API to return raw values") }
+	})
+
+	t.Run("BatchEdit", func(t *testing.T) {
+		db.AutoMigrate(&AuditLog{})
+		breg := NewRegistry(db)
+		breg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Country", "Country", false)
+		a, b := &Customer{Name: "A"}, &Customer{Name: "B"}
+		db.Create(a); db.Create(b)
+		post := func(form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/admin/Customer/batch_action", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			breg.ServeHTTP(rec, req)
+			return rec
+		}
+		ids := []string{fmt.Sprint(a.ID), fmt.Sprint(b.ID), "99999"}
+		rec := post(url.Values{"action_name": {"edit_field"}, "ids": ids})
+		if body := rec.Body.String(); !strings.Contains(body, `<option value="Country">`) || strings.Contains(body, `<option value="ID">`) {
+			t.Error("Expected the picker to list only editable fields")
+		}
+		rec = post(url.Values{"action_name": {"edit_field"}, "ids": ids, "field": {"Country"}, "value": {"NL"}})
+		var n int64
+		db.Model(&Customer{}).Where("country = ?", "NL").Count(&n)
+		if n != 2 { t.Errorf("Expected both existing records to be updated, got %d", n) }
+		var logs int64
+		db.Model(&AuditLog{}).Where("resource_name = ? AND changes LIKE ?", "Customer", "%batch edit%").Count(&logs)
+		if logs != 2 { t.Errorf("Expected one audit entry per record, got %d", logs) }
+
+		breg.Config.BatchEditStopOnError = true
+		post(url.Values{"action_name": {"edit_field"}, "ids": ids, "field": {"Country"}, "value": {"SE"}})
+		db.Model(&Customer{}).Where("country = ?", "SE").Count(&n)
+		if n != 0 { t.Errorf("Expected a failure to roll back the whole batch, got %d updated", n) }
+	})
+
+	t.Run("BatchDelete", func(t *testing.T) {
+		dreg := NewRegistry(db)
+		dreg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		a, b := &Customer{Name: "Doomed A"}, &Customer{Name: "Doomed B"}
+		db.Create(a); db.Create(b)
+		post := func(form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/admin/Customer/batch_action", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			dreg.ServeHTTP(rec, req)
+			return rec
+		}
+		form := url.Values{"action_name": {"delete_selected"}, "ids": {fmt.Sprint(a.ID), "99999", fmt.Sprint(b.ID)}}
+		if rec := post(form); !strings.Contains(rec.Body.String(), `name="confirm"`) { t.Error("Expected a confirmation page first") }
+		var n int64
+		db.Model(&Customer{}).Where("name LIKE ?", "Doomed%").Count(&n)
+		if n != 2 { t.Error("Expected nothing to be deleted before confirming") }
+		form.Set("confirm", "1")
+		rec := post(form)
+		db.Model(&Customer{}).Where("name LIKE ?", "Doomed%").Count(&n)
+		if n != 0 { t.Errorf("Expected the existing records to be deleted, %d left", n) }
+		var flash string
+		for _, c := range rec.Result().Cookies() { if c.Name == "admin_flash" { flash = c.Value } }
+		if !strings.Contains(flash, "Deleted 2 records, 1 failed") || !strings.Contains(flash, "#99999") { t.Errorf("Unexpected summary %q", flash) }
+	})
+
+	t.Run("ActionParams", func(t *testing.T) {
+		areg := NewRegistry(db)
+		var got map[string]interface{}
+		areg.Register(Order{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			AddMemberAction("refund", "Refund order", func(res *Resource, w http.ResponseWriter, r *http.Request) { got = ParamValues(r); w.WriteHeader(http.StatusNoContent) }).
+			SetActionParams("refund", Param("Amount", "Amount", "number", true), Param("Reason", "Reason", "select", false, "damaged", "late"))
+		do := func(method string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/admin/Order/action?name=refund&id=1", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := do("GET", nil); got != nil || !strings.Contains(rec.Body.String(), `name="Amount"`) { t.Error("Expected the param form before running the action") }
+		rec := do("POST", url.Values{"_params": {"1"}, "Amount": {"lots"}, "Reason": {"bored"}})
+		if got != nil || rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "Amount must be a number") || !strings.Contains(rec.Body.String(), "Reason is not a valid choice") {
+			t.Errorf("Expected validation errors to re-render the form, got %d", rec.Code)
+		}
+		do("POST", url.Values{"_params": {"1"}, "Amount": {"12.5"}, "Reason": {"late"}})
+		if got["Amount"] != 12.5 || got["Reason"] != "late" { t.Errorf("Expected parsed params, got %v", got) }
+	})
+
+	t.Run("ActionVisibility", func(t *testing.T) {
+		vreg := NewRegistry(db)
+		ran := 0
+		published := &Customer{Name: "Published"}
+		draft := &Customer{Name: "Draft"}
+		db.Create(published); db.Create(draft)
+		vreg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			AddMemberAction("publish", "Publish", func(res *Resource, w http.ResponseWriter, r *http.Request) { ran++ }).
+			AddCollectionAction("report", "Manager report", func(res *Resource, w http.ResponseWriter, r *http.Request) { ran++ }).
+			SetActionVisible("publish", func(u *AdminUser, item map[string]interface{}) bool { return item["Name"] != "Published" }).
+			SetActionVisibleTo("report", func(u *AdminUser) bool { return u.Role == "manager" })
+		get := func(path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			vreg.ServeHTTP(rec, req)
+			return rec
+		}
+		if strings.Contains(get(fmt.Sprintf("/admin/Customer/show?id=%d", published.ID)).Body.String(), "name=publish") { t.Error("Expected Publish to be hidden on published records") }
+		if !strings.Contains(get(fmt.Sprintf("/admin/Customer/show?id=%d", draft.ID)).Body.String(), "name=publish") { t.Error("Expected Publish on drafts") }
+		if strings.Contains(get("/admin/Customer").Body.String(), "Manager report") { t.Error("Expected the collection action to be hidden from non-managers") }
+		if rec := get(fmt.Sprintf("/admin/Customer/action?name=publish&id=%d", published.ID)); rec.Code != http.StatusForbidden || ran != 0 { t.Error("Expected hidden member actions to be refused") }
+		if rec := get("/admin/Customer/collection_action?name=report"); rec.Code != http.StatusForbidden || ran != 0 { t.Error("Expected hidden collection actions to be refused") }
+		get(fmt.Sprintf("/admin/Customer/action?name=publish&id=%d", draft.ID))
+		if ran != 1 { t.Error("Expected the visible action to run") }
+	})
+
+	t.Run("Reordering", func(t *testing.T) {
+		db.AutoMigrate(&Task{})
+		rreg := NewRegistry(db)
+		rreg.Register(Task{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Position", "Position", false).
+			EnableReordering("Position").AddScope("open", "Open", func(db *gorm.DB) *gorm.DB { return db.Where("done = ?", false) })
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			rreg.ServeHTTP(rec, req)
+			return rec
+		}
+		for _, name := range []string{"A", "B", "C", "D"} { do("POST", "/admin/Task/save", url.Values{"Name": {name}}) }
+		names := func() string {
+			var tasks []Task
+			db.Order("position asc").Find(&tasks)
+			var out []string
+			for _, task := range tasks { out = append(out, fmt.Sprintf("%s%d", task.Name, task.Position)) }
+			return strings.Join(out, " ")
+		}
+		if got := names(); got != "A1 B2 C3 D4" { t.Fatalf("Expected new records appended in order, got %q", got) }
+		if body := do("GET", "/admin/Task", nil).Body.String(); !strings.Contains(body, "move=up") || strings.Index(body, ">A<") > strings.Index(body, ">D<") { t.Error("Expected the list sorted by position with reorder controls") }
+		var b Task
+		db.Where("name = ?", "B").First(&b)
+		do("POST", fmt.Sprintf("/admin/Task/reorder?id=%d&move=up", b.ID), nil)
+		if got := names(); got != "B1 A2 C3 D4" { t.Errorf("Expected B moved up, got %q", got) }
+		// Reordering within a scope only rearranges that scope's slots.
+		db.Model(&Task{}).Where("name = ?", "A").Update("done", true)
+		var ids []string
+		for _, name := range []string{"D", "B", "C"} { var task Task; db.Where("name = ?", name).First(&task); ids = append(ids, fmt.Sprint(task.ID)) }
+		do("POST", "/admin/Task/reorder", url.Values{"scope": {"open"}, "ids": ids})
+		if got := names(); got != "D1 A2 B3 C4" { t.Errorf("Expected the open tasks reordered around the done one, got %q", got) }
+		var logs int64
+		db.Model(&AuditLog{}).Where("resource_name = ? AND action = ?", "Task", "Reorder").Count(&logs)
+		if logs != 2 { t.Errorf("Expected one audit entry per reorder, got %d", logs) }
+	})
+
+	t.Run("DashboardWidgets", func(t *testing.T) {
+		wreg := NewRegistry(db)
+		wreg.Register(Customer{}); wreg.Register(Order{})
+		db.Create(&Permission{Role: "sales", ResourceName: "Customer", Action: "list"})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		wreg.RecordAction(root, "Customer", "41", "Update", "Renamed")
+		wreg.RecordAction(root, "Order", "7", "Create", "Saved from form")
+		wreg.AddDashboardWidget("Quick links", func(u *AdminUser) template.HTML { return "<p>links for " + template.HTML(u.Role) + "</p>" }).Priority = -1
+		widgets := wreg.renderWidgets(&AdminUser{Role: "sales"})
+		if len(widgets) != 2 || widgets[0].Label != "Quick links" || widgets[1].Label != "Recent activity" { t.Fatalf("Expected widgets ordered by priority, got %+v", widgets) }
+		feed := string(widgets[1].HTML)
+		if !strings.Contains(feed, `/admin/Customer/show?id=41`) || !strings.Contains(feed, "just now") { t.Errorf("Expected a linked, relative activity entry, got %s", feed) }
+		if strings.Contains(feed, "Order") { t.Error("Expected activity on resources the role cannot list to be hidden") }
+		wreg.Config.ActivityFeedSize = 0
+		if len(wreg.renderWidgets(root)) != 1 { t.Error("Expected a feed size of 0 to hide the activity panel") }
+		if timeAgo(3*time.Hour) != "3 hours ago" || timeAgo(25*time.Hour) != "1 day ago" { t.Error("Unexpected relative time formatting") }
+	})
+
+	t.Run("DashboardStats", func(t *testing.T) {
+		sreg := NewRegistry(db)
+		sreg.Register(Customer{}); sreg.Register(Order{}).HideFromDashboard(); sreg.Register(TestModel{})
+		sreg.AddStat("Revenue", func(db *gorm.DB) (int64, error) { return 112, nil }).Previous = func(db *gorm.DB) (int64, error) { return 100, nil }
+		sreg.AddStat("Broken", func(db *gorm.DB) (int64, error) { return 0, fmt.Errorf("boom") })
+		sreg.AddStat("Open orders", func(db *gorm.DB) (int64, error) { return 3, nil }).Resource = "Order"
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		labels := func(stats []Stat) (out []string) { for _, s := range stats { out = append(out, s.Label) }; return }
+		stats := sreg.dashboardStats(req, &AdminUser{Role: "sales"})
+		if got := strings.Join(labels(stats), ","); got != "Customer,Revenue,Broken" { t.Errorf("Expected permitted, non-hidden stats only, got %s", got) }
+		for _, s := range stats {
+			if s.Label == "Revenue" && (s.Trend != "+12%" || !s.TrendUp) { t.Errorf("Expected a +12%% trend, got %+v", s) }
+			if s.Label == "Broken" && s.Error == "" { t.Error("Expected a failing provider to mark its card") }
+		}
+		sreg.Config.AutoResourceStats = false
+		if got := strings.Join(labels(sreg.dashboardStats(req, &AdminUser{Role: "admin"})), ","); got != "Revenue,Broken,Open orders" { t.Errorf("Expected only custom stats, got %s", got) }
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+		rec := httptest.NewRecorder()
+		sreg.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Unavailable") { t.Errorf("Expected the dashboard to render despite a failing stat, got %d", rec.Code) }
+
+		// Conditions the provider adds to a scoped handle don't carry over to the previous value.
+		odb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		odb.AutoMigrate(&Order{})
+		odb.Create(&[]Order{{Name: "a", Total: 50}, {Name: "b", Total: 150}, {Name: "c", Total: 250}, {Name: "d", Total: 350}})
+		oreg := NewRegistry(odb)
+		oreg.Config.AutoResourceStats = false
+		oreg.Register(Order{})
+		oreg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB { return q.Where("total > ?", 0) })
+		stat := oreg.AddStat("Large orders", func(db *gorm.DB) (n int64, err error) { return n, db.Model(&Order{}).Where("total > ?", 200).Count(&n).Error })
+		stat.Resource = "Order"
+		stat.Previous = func(db *gorm.DB) (n int64, err error) { return n, db.Model(&Order{}).Where("total < ?", 200).Count(&n).Error }
+		sreq := httptest.NewRequest("GET", "/admin/", nil)
+		sreq = sreq.WithContext(withUser(sreq.Context(), &AdminUser{Role: "admin"}))
+		if st := oreg.dashboardStats(sreq, &AdminUser{Role: "admin"}); len(st) != 1 || st[0].Value != 2 || st[0].Trend != "+0%" { t.Errorf("Expected the provider and previous value queried separately, got %+v", st) }
+	})
+
+	t.Run("ChartRanges", func(t *testing.T) {
+		creg := NewRegistry(db)
+		creg.AddChart("Legacy", "bar", func(db *gorm.DB) ([]string, []float64) { return []string{"a"}, []float64{1} })
+		creg.AddRangedChart("Activity", "line", func(db *gorm.DB, req ChartRequest) ([]string, []float64, error) {
+			return TimeSeries(db, AuditLog{}, "created_at", "COUNT(*)", req)
+		})
+		get := func(path string, auth bool) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			if auth { req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"}) }
+			rec := httptest.NewRecorder()
+			creg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := get("/admin/charts/1/data?range=7d", true)
+		var data ChartResult
+		json.NewDecoder(rec.Body).Decode(&data)
+		if rec.Code != 200 || len(data.Labels) != 8 || data.Labels[7] != time.Now().Format("2006-01-02") || len(data.Series) != 1 || data.Series[0].Values[7] == 0 {
+			t.Errorf("Expected 8 daily buckets ending today with today's audit entries, got %d %+v", rec.Code, data)
+		}
+		if rec := get("/admin/charts/0/data?range=90d", true); !strings.Contains(rec.Body.String(), `{"labels":["a"],"series":[{"label":"Legacy","values":[1]}]}`) { t.Errorf("Expected legacy charts to be wrapped, got %s", rec.Body.String()) }
+		if rec := get("/admin/charts/5/data", true); rec.Code != 404 { t.Errorf("Expected unknown charts to 404, got %d", rec.Code) }
+		if rec := get("/admin/charts/1/data?range=forever", true); rec.Code != 400 { t.Errorf("Expected invalid ranges to be rejected, got %d", rec.Code) }
+		if rec := get("/admin/charts/1/data?range=3660d&granularity=day", true); rec.Code != 400 { t.Errorf("Expected a range with too many buckets to be rejected, got %d", rec.Code) }
+		if rec := get("/admin/charts/1/data?range=3660d", true); rec.Code != 200 { t.Errorf("Expected a long range by month to be drawn, got %d", rec.Code) }
+		if rec := get("/admin/charts/1/data", false); rec.Code != 303 { t.Errorf("Expected chart data to require login, got %d", rec.Code) }
+		req, _ := chartRequest("365d", "", nil)
+		labels, _, _ := TimeSeries(db, AuditLog{}, "created_at", "COUNT(*)", req)
+		if req.Granularity != "month" || len(labels) != 13 { t.Errorf("Expected 13 monthly buckets for a year, got %s %d", req.Granularity, len(labels)) }
+		if body := get("/admin/", true).Body.String(); !strings.Contains(body, `data-url="/admin/charts/1/data"`) || strings.Contains(body, `data-url="/admin/charts/0/data"`) { t.Error("Expected range buttons on ranged charts only") }
+	})
+
+	t.Run("MultiSeriesCharts", func(t *testing.T) {
+		mreg := NewRegistry(db)
+		mreg.AddSeriesChart("Actions by type", "bar", true, func(db *gorm.DB, req ChartRequest) (ChartResult, error) {
+			return TimeSeriesBy(db, AuditLog{}, "created_at", "COUNT(*)", "action", req)
+		})
+		req := httptest.NewRequest("GET", "/admin/charts/0/data?range=7d", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+		rec := httptest.NewRecorder()
+		mreg.ServeHTTP(rec, req)
+		var data ChartResult
+		json.NewDecoder(rec.Body).Decode(&data)
+		if len(data.Series) < 2 || data.Series[0].Label != "Create" || len(data.Series[0].Values) != len(data.Labels) { t.Fatalf("Expected one series per action, got %+v", data) }
+		req = httptest.NewRequest("GET", "/admin/", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+		rec = httptest.NewRecorder()
+		mreg.ServeHTTP(rec, req)
+		if body := rec.Body.String(); !strings.Contains(body, "stacked: true") || !strings.Contains(body, `"label":"Create"`) { t.Error("Expected a stacked chart with its series on the dashboard") }
+
+		// Each group and bucket is counted on its own, whatever the caller's handle already holds.
+		tdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		tdb.AutoMigrate(&AuditLog{})
+		day := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+		for _, e := range []struct{ action string; days int }{{"Create", 0}, {"Create", 1}, {"Create", 1}, {"Delete", 1}, {"Delete", 2}, {"Update", 2}} {
+			tdb.Create(&AuditLog{Action: e.action, ResourceName: "Order", CreatedAt: day.AddDate(0, 0, e.days)})
+		}
+		tdb.Create(&AuditLog{Action: "Create", ResourceName: "Customer", CreatedAt: day})
+		res, err := TimeSeriesBy(tdb.Where("resource_name = ?", "Order"), AuditLog{}, "created_at", "COUNT(*)", "action", ChartRequest{From: day, To: time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), Granularity: "day"})
+		if err != nil { t.Fatal(err) }
+		got := make(map[string]string)
+		for _, s := range res.Series { got[s.Label] = fmt.Sprint(s.Values) }
+		if strings.Join(res.Labels, ",") != "2026-03-02,2026-03-03,2026-03-04" || got["Create"] != "[1 2 0]" || got["Delete"] != "[0 1 1]" || got["Update"] != "[0 0 1]" || len(got) != 3 {
+			t.Errorf("Expected per-group daily counts, got %v %v", res.Labels, got)
+		}
+	})
+
+	t.Run("ChartCache", func(t *testing.T) {
+		creg := NewRegistry(db)
+		var mu sync.Mutex
+		loads := 0
+		creg.AddRangedChart("Revenue", "bar", func(db *gorm.DB, req ChartRequest) ([]string, []float64, error) {
+			mu.Lock(); loads++; mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			return []string{"a"}, []float64{1}, nil
+		}).CacheTTL = time.Minute
+		get := func(path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			creg.ServeHTTP(rec, req)
+			return rec
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ { wg.Add(1); go func() { defer wg.Done(); get("/admin/") }() }
+		wg.Wait()
+		if loads != 1 { t.Errorf("Expected concurrent dashboard loads to share one query, got %d", loads) }
+		body := get("/admin/").Body.String()
+		if loads != 1 || !strings.Contains(body, "as of "+time.Now().Format("15:")) || !strings.Contains(body, "chart-refresh") { t.Errorf("Expected cached data with its timestamp and a refresh control, got %d loads", loads) }
+		if rec := get("/admin/charts/0/data?refresh=1"); loads != 2 || !strings.Contains(rec.Body.String(), `"as_of"`) { t.Errorf("Expected refresh to bypass the cache, got %d loads", loads) }
+		get("/admin/charts/0/data?range=7d")
+		if loads != 3 { t.Errorf("Expected each range to be cached separately, got %d loads", loads) }
+		creg.InvalidateChartCache("Revenue")
+		get("/admin/charts/0/data")
+		if loads != 4 { t.Errorf("Expected invalidation to drop cached data, got %d loads", loads) }
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		db.AutoMigrate(&WebhookDelivery{})
+		var mu sync.Mutex
+		var bodies []string
+		var signatures []string
+		fail := 1
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock(); defer mu.Unlock()
+			if fail > 0 { fail--; w.WriteHeader(500); return }
+			b, _ := io.ReadAll(r.Body)
+			bodies, signatures = append(bodies, string(b)), append(signatures, r.Header.Get("X-GoAdmin-Signature"))
+		}))
+		defer srv.Close()
+		wreg := NewRegistry(db)
+		wreg.webhooks.backoff = 5 * time.Millisecond
+		wreg.Config.WebhookMaxAttempts = 2
+		wreg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Country", "Country", false)
+		wreg.AddWebhook(WebhookConfig{URL: srv.URL, Secret: "s3cret", Resources: []string{"Customer"}, Events: []string{"update"}})
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "error-pages"})
+			rec := httptest.NewRecorder()
+			wreg.ServeHTTP(rec, req)
+			return rec
+		}
+		waitFor := func(cond func() bool) bool {
+			for i := 0; i < 200; i++ { if cond() { return true }; time.Sleep(5 * time.Millisecond) }
+			return false
+		}
+		c := &Customer{Name: "Hooked", Country: "NO"}
+		db.Create(c)
+		do("POST", "/admin/Customer/save", url.Values{"Name": {"New customer"}})
+		do("POST", "/admin/Customer/save", url.Values{"ID": {fmt.Sprint(c.ID)}, "Name": {"Hooked"}, "Country": {"DK"}})
+		if !waitFor(func() bool { mu.Lock(); defer mu.Unlock(); return len(bodies) == 1 }) { t.Fatal("Expected the update to be delivered after one retry") }
+		var ev WebhookEvent
+		json.Unmarshal([]byte(bodies[0]), &ev)
+		if ev.Action != "update" || ev.RecordID != fmt.Sprint(c.ID) || ev.User != "root@example.com" || len(ev.Changes) != 1 || ev.Changes["Country"].To != "DK" {
+			t.Errorf("Unexpected payload %s", bodies[0])
+		}
+		mac := hmac.New(sha256.New, []byte("s3cret")); mac.Write([]byte(bodies[0]))
+		if signatures[0] != "sha256="+hex.EncodeToString(mac.Sum(nil)) { t.Error("Expected an HMAC signature of the body") }
+		var d WebhookDelivery
+		waitFor(func() bool { d = WebhookDelivery{}; db.Last(&d); return d.Status == "delivered" })
+		if d.Status != "delivered" || d.Attempts != 2 { t.Errorf("Expected the delivery logged as delivered on the second attempt, got %+v", d) }
+
+		// Exhausted deliveries are marked failed and can be retried from the delivery log.
+		mu.Lock(); fail = 2; mu.Unlock()
+		do("POST", "/admin/Customer/save", url.Values{"ID": {fmt.Sprint(c.ID)}, "Name": {"Hooked"}, "Country": {"SE"}})
+		waitFor(func() bool { d = WebhookDelivery{}; db.Last(&d); return d.Status == "failed" })
+		if d.Status != "failed" || d.LastError == "" { t.Fatalf("Expected the delivery to fail after the max attempts, got %+v", d) }
+		if !strings.Contains(do("GET", fmt.Sprintf("/admin/WebhookDelivery/show?id=%d", d.ID), nil).Body.String(), "name=retry") { t.Error("Expected a retry action on failed deliveries") }
+		do("GET", fmt.Sprintf("/admin/WebhookDelivery/action?name=retry&id=%d", d.ID), nil)
+		if !waitFor(func() bool { mu.Lock(); defer mu.Unlock(); return len(bodies) == 2 }) { t.Error("Expected the retried delivery to go through") }
+
+		// A delivery the full queue cannot take is marked failed, so it can be retried later.
+		qreg := NewRegistry(db)
+		qreg.webhooks.queue = make(chan uint)
+		qreg.Webhooks = []WebhookConfig{{URL: srv.URL}}
+		qreg.notifyChange(nil, "Customer", "update", "1", nil)
+		d = WebhookDelivery{}
+		db.Last(&d)
+		if d.Status != "failed" || d.LastError != "delivery queue full" { t.Errorf("Expected a delivery refused by the queue to be failed, got %+v", d) }
+	})
+
+	t.Run("ActionEmails", func(t *testing.T) {
+		ereg := NewRegistry(db)
+		ereg.Config.PublicURL = "https://admin.example.com/"
+		mailer := &fakeMailer{sent: make(chan sentMail, 10)}
+		ereg.SetMailer(mailer)
+		ereg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		ereg.NotifyOnAction("Customer", "create", "support-lead")
+		db.Create(&AdminUser{Email: "lead@example.com", Role: "support-lead"})
+		ereg.RecordAction(&AdminUser{ID: 99, Email: "root@example.com"}, "Customer", "5", "Update", "Name changed")
+		ereg.RecordAction(&AdminUser{ID: 99, Email: "root@example.com"}, "Customer", "5", "Create", "Saved from form & more")
+		select {
+		case m := <-mailer.sent:
+			if m.To != "lead@example.com" || m.Subject != "[Go Admin] root@example.com Create Customer #5" { t.Errorf("Unexpected email %+v", m) }
+			if !strings.Contains(m.Text, "Saved from form & more") || !strings.Contains(m.HTML, "Saved from form &amp; more") { t.Error("Expected plain text and escaped HTML bodies") }
+			if !strings.Contains(m.Text, "https://admin.example.com/admin/Customer/show?id=5") { t.Errorf("Expected an absolute record link, got %s", m.Text) }
+		case <-time.After(time.Second):
+			t.Fatal("Expected a notification email")
+		}
+		select {
+		case m := <-mailer.sent: t.Errorf("Expected only matching actions to notify, got %+v", m)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if encodeHeader("Réglé\r\nBcc: x") != "=?utf-8?q?R=C3=A9gl=C3=A9_Bcc:_x?=" { t.Errorf("Unexpected header encoding %q", encodeHeader("Réglé\r\nBcc: x")) }
+	})
+
+	t.Run("PasswordReset", func(t *testing.T) {
+		db.AutoMigrate(&PasswordResetToken{})
+		preg := NewRegistry(db)
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			preg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := do("GET", "/admin/forgot", nil); rec.Code != 404 { t.Errorf("Expected password reset to be off without a mailer, got %d", rec.Code) }
+		mailer := &fakeMailer{sent: make(chan sentMail, 10)}
+		preg.SetMailer(mailer)
+		if !strings.Contains(do("GET", "/admin/login", nil).Body.String(), "/admin/forgot") { t.Error("Expected a forgot password link on the login page") }
+		user := &AdminUser{Email: "forgetful@example.com", Role: "admin"}
+		user.SetPassword("old-password")
+		db.Create(user)
+		db.Create(&Session{ID: hashToken("forgetful"), UserID: user.ID, Role: user.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		unknown := do("POST", "/admin/forgot", url.Values{"email": {"nobody@example.com"}}).Body.String()
+		known := do("POST", "/admin/forgot", url.Values{"email": {user.Email}}).Body.String()
+		if unknown != known || !strings.Contains(known, "If that account exists") { t.Error("Expected the same response for unknown and known accounts") }
+		var m sentMail
+		select {
+		case m = <-mailer.sent:
+		case <-time.After(time.Second): t.Fatal("Expected a reset email")
+		}
+		token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(m.Text)
+		if m.To != user.Email || token == nil { t.Fatalf("Expected a reset link to the user, got %+v", m) }
+		var stored PasswordResetToken
+		db.Where("user_id = ?", user.ID).First(&stored)
+		if stored.TokenHash == token[1] || stored.TokenHash != hashToken(token[1]) { t.Error("Expected only the token hash to be stored") }
+		if !strings.Contains(do("GET", "/admin/reset?token="+token[1], nil).Body.String(), `name="password_confirm"`) { t.Error("Expected the new password form") }
+		if body := do("POST", "/admin/reset", url.Values{"token": {token[1]}, "password": {"new-password"}, "password_confirm": {"typo"}}).Body.String(); !strings.Contains(body, "do not match") { t.Error("Expected mismatched passwords to be rejected") }
+		if rec := do("POST", "/admin/reset", url.Values{"token": {token[1]}, "password": {"new-password"}, "password_confirm": {"new-password"}}); rec.Code != 303 { t.Fatalf("Expected a redirect to login, got %d", rec.Code) }
+		var updated AdminUser
+		db.First(&updated, user.ID)
+		var sessions, audits int64
+		db.Model(&Session{}).Where("user_id = ?", user.ID).Count(&sessions)
+		db.Model(&AuditLog{}).Where("resource_name = ? AND action = ? AND record_id = ?", usersSlug, "Password reset", fmt.Sprint(user.ID)).Count(&audits)
+		if !updated.CheckPassword("new-password") || sessions != 0 || audits != 1 { t.Errorf("Expected the password changed, sessions revoked and the reset audited (%d sessions, %d audits)", sessions, audits) }
+		if !strings.Contains(do("GET", "/admin/reset?token="+token[1], nil).Body.String(), "invalid or has expired") { t.Error("Expected reset tokens to be single-use") }
+		db.Create(&PasswordResetToken{UserID: user.ID, TokenHash: hashToken("stale"), ExpiresAt: time.Now().Add(-time.Minute)})
+		if !strings.Contains(do("GET", "/admin/reset?token=stale", nil).Body.String(), "invalid or has expired") { t.Error("Expected expired tokens to be rejected") }
+	})
+
+	t.Run("UserManagement", func(t *testing.T) {
+		udb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		udb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{}, &PasswordResetToken{})
+		boss := &AdminUser{Email: "boss@example.com", Role: "admin"}
+		boss.SetPassword("correct-horse")
+		udb.Create(boss)
+		udb.Create(&Session{ID: hashToken("boss"), UserID: boss.ID, Role: boss.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		ureg := NewRegistry(udb)
+		do := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			ureg.ServeHTTP(rec, req)
+			return rec
+		}
+		invite := url.Values{"Email": {"newbie@example.com"}, "Role": {"editor"}, "Active": {"true"}}
+		if rec := do("boss", "POST", "/admin/users/save", invite); rec.Code != 422 || !strings.Contains(rec.Body.String(), "configure a mailer") { t.Errorf("Expected invitations to need a mailer, got %d", rec.Code) }
+		mailer := &fakeMailer{sent: make(chan sentMail, 10)}
+		ureg.SetMailer(mailer)
+		if rec := do("boss", "POST", "/admin/users/save", invite); rec.Code != 303 { t.Fatalf("Expected the invitation to save, got %d", rec.Code) }
+		var m sentMail
+		select {
+		case m = <-mailer.sent:
+		case <-time.After(time.Second): t.Fatal("Expected an invitation email")
+		}
+		token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(m.Text)
+		var newbie AdminUser
+		udb.Where("email = ?", "newbie@example.com").First(&newbie)
+		if m.To != newbie.Email || token == nil || !newbie.Active || newbie.PasswordHash != "" { t.Fatalf("Expected an active user without a password and a set-password link, got %+v", newbie) }
+		if !strings.Contains(do("", "GET", "/admin/reset?token="+token[1], nil).Body.String(), `name="password_confirm"`) { t.Error("Expected the invitation link to open the set-password form") }
+
+		udb.Create(&Permission{Role: "editor", ResourceName: usersSlug, Action: "list"})
+		udb.Create(&Session{ID: hashToken("newbie"), UserID: newbie.ID, Role: newbie.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		if rec := do("newbie", "GET", "/admin/users", nil); rec.Code != 403 { t.Errorf("Expected users to be admin-only, got %d", rec.Code) }
+		if body := do("boss", "GET", "/admin/users", nil).Body.String(); !strings.Contains(body, "newbie@example.com") || !strings.Contains(body, "Never") { t.Error("Expected users listed with their last login") }
+
+		demote := url.Values{"ID": {fmt.Sprint(boss.ID)}, "Email": {boss.Email}, "Role": {"editor"}, "Active": {"true"}}
+		if rec := do("boss", "POST", "/admin/users/save", demote); rec.Code != 422 || !strings.Contains(rec.Body.String(), "at least one active admin") { t.Errorf("Expected the last admin not to be demoted, got %d", rec.Code) }
+		do("boss", "POST", "/admin/users/delete?id="+fmt.Sprint(boss.ID), nil)
+		var remaining int64
+		udb.Model(&AdminUser{}).Where("id = ?", boss.ID).Count(&remaining)
+		if remaining != 1 { t.Error("Expected the last admin not to be deleted") }
+
+		deactivate := url.Values{"ID": {fmt.Sprint(newbie.ID)}, "Email": {newbie.Email}, "Role": {"editor"}, "Active": {"false"}}
+		if rec := do("boss", "POST", "/admin/users/save", deactivate); rec.Code != 303 { t.Fatalf("Expected deactivation to save, got %d", rec.Code) }
+		var sessions, audits int64
+		udb.Model(&Session{}).Where("user_id = ?", newbie.ID).Count(&sessions)
+		udb.Model(&AuditLog{}).Where("resource_name = ? AND action IN ?", usersSlug, []string{"Invite", "Deactivate"}).Count(&audits)
+		if sessions != 0 || audits != 2 { t.Errorf("Expected deactivation to end sessions and both changes audited (%d sessions, %d audits)", sessions, audits) }
+		udb.Create(&Session{ID: hashToken("stale"), UserID: newbie.ID, Role: newbie.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		if rec := do("stale", "GET", "/admin/", nil); rec.Code != 303 { t.Errorf("Expected deactivated users to be signed out, got %d", rec.Code) }
+
+		if rec := do("", "POST", "/admin/login", url.Values{"email": {boss.Email}, "password": {"correct-horse"}}); rec.Code != 303 { t.Fatalf("Expected login, got %d", rec.Code) }
+		udb.First(boss, boss.ID)
+		if boss.LastLoginAt == nil { t.Error("Expected login to record the last login time") }
+
+		// An app registering AdminUser itself replaces the built-in fields but keeps the user management.
+		areg := NewRegistry(udb)
+		res := areg.Register(AdminUser{}).SetGroup("Administration").RegisterField("ID", "ID", true).RegisterField("Email", "Email", false).RegisterField("Role", "Role", false)
+		var names []string
+		for _, f := range res.Fields { names = append(names, f.Name) }
+		if strings.Join(names, ",") != "ID,Email,Role" || res.Slug != usersSlug || len(res.BeforeSave) == 0 || len(res.MemberActions) == 0 { t.Errorf("Expected the app's fields on the built-in users resource, got %v", names) }
+		if errs := areg.Validate(); len(errs) != 0 { t.Errorf("Expected no registration problems, got %v", errs) }
+		if again := areg.Register(AdminUser{}); len(again.Fields) != 3 { t.Error("Expected a second registration to keep the app's fields") }
+	})
+
+	t.Run("PasswordPolicy", func(t *testing.T) {
+		policy := PasswordPolicy{MinLength: 10, RequireUpper: true, RequireDigit: true, RequireSymbol: true, DisallowCommon: true}
+		for pw, want := range map[string]string{
+			"Sh0rt!": "at least 10 characters", "lowercase1!x": "uppercase letter", "NoDigitsHere!": "digit",
+			"NoSymbols123": "symbol", "Password123!": "", "P@ssw0rd": "at least 10",
+		} {
+			err := models.ValidatePassword(pw, policy)
+			if (want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), want)) { t.Errorf("%q: expected %q, got %v", pw, want, err) }
+		}
+		if err := models.ValidatePassword("PASSWORD123", PasswordPolicy{DisallowCommon: true}); err == nil || !strings.Contains(err.Error(), "too common") { t.Errorf("Expected common passwords rejected, got %v", err) }
+		if err := (&AdminUser{}).SetPasswordWith("weak", policy, 0); err == nil { t.Error("Expected SetPasswordWith to enforce the policy") }
+
+		preg := NewRegistry(db)
+		preg.SetMailer(&fakeMailer{sent: make(chan sentMail, 10)})
+		user := &AdminUser{Email: "rehash@example.com", Role: "admin"}
+		user.SetPasswordWith("old-but-fine", PasswordPolicy{}, bcrypt.MinCost)
+		db.Create(user)
+		cfg := DefaultConfig()
+		cfg.BcryptCost = bcrypt.MinCost + 1
+		cfg.PasswordPolicy = policy
+		preg.SetConfig(cfg)
+		form := url.Values{"email": {user.Email}, "password": {"old-but-fine"}}
+		req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		preg.ServeHTTP(rec, req)
+		var stored AdminUser
+		db.First(&stored, user.ID)
+		if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); rec.Code != 303 || cost != bcrypt.MinCost+1 || !stored.CheckPassword("old-but-fine") { t.Errorf("Expected the hash upgraded at login, got code %d cost %d", rec.Code, cost) }
+
+		token, _ := issueResetToken(db, user.ID, time.Hour)
+		form = url.Values{"token": {token}, "password": {"longenough1!"}, "password_confirm": {"longenough1!"}}
+		req = httptest.NewRequest("POST", "/admin/reset", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec = httptest.NewRecorder()
+		preg.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), "uppercase letter") { t.Error("Expected the reset form to explain the policy failure") }
+
+		// Each registry reads its own policy when it is used, including changes made after SetConfig.
+		lax, strict := NewRegistry(db), NewRegistry(db)
+		strict.Config.PasswordPolicy = policy
+		if err := lax.setPassword(&AdminUser{}, "longenough"); err != nil { t.Errorf("Expected the default policy on the other registry, got %v", err) }
+		if err := strict.setPassword(&AdminUser{}, "longenough"); err == nil { t.Error("Expected the policy set on the config to apply") }
+	})
+
+	t.Run("AccountSecurity", func(t *testing.T) {
+		sdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{}, &LoginEvent{})
+		alice := &AdminUser{Email: "alice@example.com", Role: "editor"}
+		alice.SetPassword("correct-horse")
+		sdb.Create(alice)
+		sreg := NewRegistry(sdb)
+		sreg.Config.TrustedProxies = []string{"10.0.0.0/8"}
+		do := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.9, 10.1.1.1")
+			req.Header.Set("User-Agent", "TestBrowser/1.0")
+			req.RemoteAddr = "10.0.0.1:4321"
+			if session != "" { req.AddCookie(&http.Cookie{Name: "admin_session", Value: session}) }
+			rec := httptest.NewRecorder()
+			sreg.ServeHTTP(rec, req)
+			return rec
+		}
+		do("", "POST", "/admin/login", url.Values{"email": {alice.Email}, "password": {"wrong"}})
+		var current string
+		for _, c := range do("", "POST", "/admin/login", url.Values{"email": {alice.Email}, "password": {"correct-horse"}}).Result().Cookies() {
+			if c.Name == "admin_session" { current = c.Value }
+		}
+		var events []LoginEvent
+		sdb.Order("id").Find(&events)
+		if len(events) != 2 || events[0].Success || !events[1].Success || events[1].IP != "203.0.113.9" || events[1].UserAgent != "TestBrowser/1.0" { t.Fatalf("Expected both attempts recorded with the forwarded client IP, got %+v", events) }
+		if ip := sreg.clientIP(&http.Request{RemoteAddr: "198.51.100.7:80", Header: http.Header{"X-Forwarded-For": {"1.2.3.4"}}}); ip != "198.51.100.7" { t.Errorf("Expected X-Forwarded-For from untrusted peers ignored, got %s", ip) }
+
+		old := time.Now().Add(-time.Hour)
+		sdb.Create(&Session{ID: hashToken("laptop"), UserID: alice.ID, Role: alice.Role, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: old, LastSeenAt: old, IP: "198.51.100.1"})
+		sdb.Create(&Session{ID: hashToken("phone"), UserID: alice.ID, Role: alice.Role, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: old, LastSeenAt: old, IP: "198.51.100.2"})
+		body := do(current, "GET", "/admin/account", nil).Body.String()
+		if !strings.Contains(body, "198.51.100.1") || !strings.Contains(body, "This session") || strings.Contains(body, "laptop") || !strings.Contains(body, "Failed") { t.Error("Expected sessions and login history without exposing session ids") }
+		var laptop Session
+		do("laptop", "GET", "/admin/", nil)
+		sdb.First(&laptop, "id = ?", hashToken("laptop"))
+		if time.Since(laptop.LastSeenAt) > time.Minute { t.Error("Expected a stale session's last seen time updated") }
+
+		do(current, "POST", "/admin/account/revoke", url.Values{"ref": {sessionRef("phone")}})
+		var left int64
+		sdb.Model(&Session{}).Where("id = ?", "phone").Count(&left)
+		if left != 0 { t.Error("Expected the phone session revoked") }
+		if rec := do(current, "GET", "/admin/account?user_id=999", nil); rec.Code != 403 { t.Errorf("Expected non-admins limited to their own account, got %d", rec.Code) }
+		do(current, "POST", "/admin/account/logout_others", nil)
+		var remaining []Session
+		sdb.Where("user_id = ?", alice.ID).Find(&remaining)
+		if len(remaining) != 1 || remaining[0].ID != hashToken(current) { t.Errorf("Expected only the current session kept, got %d", len(remaining)) }
+	})
+
+	t.Run("Impersonation", func(t *testing.T) {
+		idb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		idb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{}, &TestModel{})
+		alice, jane, bob := &AdminUser{Email: "alice@example.com", Role: "admin"}, &AdminUser{Email: "jane@example.com", Role: "editor"}, &AdminUser{Email: "bob@example.com", Role: "admin"}
+		idb.Create(alice); idb.Create(jane); idb.Create(bob)
+		idb.Create(&Session{ID: hashToken("alice"), UserID: alice.ID, Role: alice.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		idb.Create(&Permission{Role: "editor", ResourceName: "TestModel", Action: "list"})
+		idb.Create(&Permission{Role: "editor", ResourceName: "TestModel", Action: "save"})
+		ireg := NewRegistry(idb)
+		ireg.Register(TestModel{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		token := "alice"
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: token})
+			rec := httptest.NewRecorder()
+			ireg.ServeHTTP(rec, req)
+			for _, c := range rec.Result().Cookies() { if c.Name == "admin_session" { token = c.Value } }
+			return rec
+		}
+		users := do("GET", "/admin/users", nil).Body.String()
+		if !strings.Contains(users, fmt.Sprintf("name=impersonate&id=%d", jane.ID)) || strings.Contains(users, fmt.Sprintf("name=impersonate&id=%d", bob.ID)) { t.Error("Expected impersonation offered for editors but not other admins") }
+		if rec := do("GET", fmt.Sprintf("/admin/users/action?name=impersonate&id=%d", bob.ID), nil); rec.Code != 403 { t.Errorf("Expected impersonating admins to be off by default, got %d", rec.Code) }
+		impersonate := func(id uint) *httptest.ResponseRecorder {
+			path := fmt.Sprintf("/admin/users/action?name=impersonate&id=%d", id)
+			confirm := do("GET", path, nil).Body.String()
+			m := regexp.MustCompile(`name="_session_token" value="([0-9a-f]+)"`).FindStringSubmatch(confirm)
+			if m == nil { t.Fatalf("Expected a confirmation form with the session token, got %s", confirm) }
+			return do("POST", path, url.Values{"_session_token": {m[1]}})
+		}
+		janePath := fmt.Sprintf("/admin/users/action?name=impersonate&id=%d", jane.ID)
+		if rec := do("POST", janePath, nil); rec.Code != 403 || token != "alice" { t.Errorf("Expected a POST without the session token refused, got %d", rec.Code) }
+		if rec := do("POST", janePath, url.Values{"_session_token": {ireg.sign("session", hashToken("someone-else"))}}); rec.Code != 403 || token != "alice" { t.Errorf("Expected another session's token refused, got %d", rec.Code) }
+		if rec := do("GET", janePath, nil); rec.Code != 200 || token != "alice" { t.Fatalf("Expected a GET to ask for confirmation and leave the session alone, got %d", rec.Code) }
+		impersonate(jane.ID)
+		var stale int64
+		idb.Model(&Session{}).Where("id = ?", hashToken("alice")).Count(&stale)
+		if stale != 0 || token == "alice" { t.Error("Expected impersonation to replace the session") }
+		if rec := do("GET", "/admin/users", nil); rec.Code != 403 { t.Errorf("Expected to see jane's permissions while impersonating, got %d", rec.Code) }
+		if body := do("GET", "/admin/TestModel", nil).Body.String(); !strings.Contains(body, "Viewing as <strong>jane@example.com</strong>") { t.Error("Expected the impersonation banner") }
+		do("POST", "/admin/TestModel/save", url.Values{"Name": {"made by jane"}})
+		var entry AuditLog
+		idb.Where("resource_name = ?", "TestModel").First(&entry)
+		if entry.UserID != jane.ID || entry.ImpersonatorID != alice.ID || entry.UserEmail != "alice@example.com as jane@example.com" { t.Errorf("Expected the change attributed to both users, got %+v", entry) }
+		if rec := do("POST", "/admin/impersonate/stop", nil); rec.Code != 303 { t.Fatalf("Expected a redirect, got %d", rec.Code) }
+		if rec := do("GET", "/admin/users", nil); rec.Code != 200 { t.Errorf("Expected alice's own identity restored, got %d", rec.Code) }
+		var trail int64
+		idb.Model(&AuditLog{}).Where("resource_name = ? AND action IN ?", usersSlug, []string{"Impersonate", "Stop impersonating"}).Count(&trail)
+		if trail != 2 { t.Errorf("Expected start and stop audited, got %d", trail) }
+		ireg.Config.AllowAdminImpersonation = true
+		impersonate(bob.ID)
+		var sess Session
+		idb.First(&sess, "id = ?", hashToken(token))
+		if sess.UserID != bob.ID || sess.ImpersonatorID != alice.ID { t.Error("Expected admin impersonation when allowed") }
+	})
+
+	t.Run("SessionCookies", func(t *testing.T) {
+		cdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		cdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{})
+		carol := &AdminUser{Email: "carol@example.com", Role: "admin"}
+		carol.SetPassword("correct-horse")
+		cdb.Create(carol)
+		creg := NewRegistry(cdb)
+		login := func(https, proxied bool, cookie string) *http.Cookie {
+			form := url.Values{"email": {carol.Email}, "password": {"correct-horse"}}
+			req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if https { req.TLS = &tls.ConnectionState{} }
+			if proxied { req.Header.Set("X-Forwarded-Proto", "https") }
+			if cookie != "" { req.AddCookie(&http.Cookie{Name: creg.cookieName(), Value: cookie}) }
+			rec := httptest.NewRecorder()
+			creg.ServeHTTP(rec, req)
+			for _, c := range rec.Result().Cookies() { if c.Name == creg.cookieName() { return c } }
+			t.Fatalf("Expected a session cookie, got %v", rec.Header()["Set-Cookie"])
+			return nil
+		}
+		plain := login(false, false, "")
+		if plain.Secure || !plain.HttpOnly || plain.SameSite != http.SameSiteLaxMode || plain.Path != "/admin" { t.Errorf("Unexpected attributes over HTTP: %+v", plain) }
+		if c := login(true, false, ""); !c.Secure { t.Error("Expected Secure over TLS") }
+		if c := login(false, true, ""); !c.Secure { t.Error("Expected Secure behind an HTTPS proxy") }
+		var stored, raw int64
+		cdb.Model(&Session{}).Where("id = ?", hashToken(plain.Value)).Count(&stored)
+		cdb.Model(&Session{}).Where("id = ?", plain.Value).Count(&raw)
+		if stored != 1 || raw != 0 { t.Error("Expected only the token hash stored") }
+
+		relogin := login(false, false, plain.Value)
+		cdb.Model(&Session{}).Where("id = ?", hashToken(plain.Value)).Count(&stored)
+		if stored != 0 || relogin.Value == plain.Value { t.Error("Expected login to replace the presented session") }
+
+		creg.Config.CookieName, creg.Config.CookieSecure, creg.Config.CookieSameSite = "sid", "true", "strict"
+		custom := login(false, false, "")
+		if custom.Name != "sid" || !custom.Secure || custom.SameSite != http.SameSiteStrictMode { t.Errorf("Expected the configured cookie, got %+v", custom) }
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		req.AddCookie(&http.Cookie{Name: "sid", Value: custom.Value})
+		if user, _ := creg.GetUserFromRequest(req); user == nil { t.Fatal("Expected the session to authenticate") }
+		cdb.Model(carol).Update("role", "editor")
+		if user, _ := creg.GetUserFromRequest(req); user != nil { t.Error("Expected a role change to end existing sessions") }
+	})
+
+	t.Run("SessionStores", func(t *testing.T) {
+		ctx := context.Background()
+		conformance := func(name string, store SessionStore) {
+			now := time.Now()
+			for i, id := range []string{"a", "b", "c"} {
+				if err := store.Create(ctx, &Session{ID: id, UserID: 7, Role: "admin", CreatedAt: now, LastSeenAt: now.Add(time.Duration(i) * time.Second), ExpiresAt: now.Add(time.Hour)}); err != nil { t.Fatalf("%s: create: %v", name, err) }
+			}
+			store.Create(ctx, &Session{ID: "other", UserID: 8, ExpiresAt: now.Add(time.Hour)})
+			if _, err := store.Get(ctx, "missing"); err != ErrSessionNotFound { t.Errorf("%s: expected ErrSessionNotFound, got %v", name, err) }
+			store.Touch(ctx, "a", now.Add(time.Minute))
+			list, err := store.ListForUser(ctx, 7)
+			if err != nil || len(list) != 3 || list[0].ID != "a" || list[0].Role != "admin" { t.Errorf("%s: expected three sessions, most recent first, got %+v (%v)", name, list, err) }
+			store.Delete(ctx, "b")
+			if n, _ := store.CountActive(ctx); n != 3 { t.Errorf("%s: expected 3 active sessions, got %d", name, n) }
+			store.DeleteAllForUser(ctx, 7)
+			if list, _ := store.ListForUser(ctx, 7); len(list) != 0 { t.Errorf("%s: expected the user's sessions deleted, got %d", name, len(list)) }
+			if sess, err := store.Get(ctx, "other"); err != nil || sess.UserID != 8 { t.Errorf("%s: expected other users' sessions kept, got %v", name, err) }
+			if err := store.DeleteExpired(ctx); err != nil { t.Errorf("%s: delete expired: %v", name, err) }
+
+			tokens := store.(FormTokenStore)
+			tokens.IssueFormToken(ctx, &FormToken{ID: "t1", SessionID: "a", ExpiresAt: now.Add(time.Hour)})
+			if _, err := tokens.ConsumeFormToken(ctx, "b", "t1"); err != ErrFormTokenNotFound { t.Errorf("%s: expected another session's token refused, got %v", name, err) }
+			if _, err := tokens.ConsumeFormToken(ctx, "a", "t1"); err != nil { t.Errorf("%s: consume: %v", name, err) }
+			if id, err := tokens.ConsumeFormToken(ctx, "a", "t1"); err != ErrFormTokenUsed || id != "" { t.Errorf("%s: expected a second use refused, got %q %v", name, id, err) }
+			tokens.CompleteFormToken(ctx, "t1", "42")
+			if id, err := tokens.ConsumeFormToken(ctx, "a", "t1"); err != ErrFormTokenUsed || id != "42" { t.Errorf("%s: expected the saved record of a used token, got %q %v", name, id, err) }
+			if _, err := tokens.ConsumeFormToken(ctx, "a", "missing"); err != ErrFormTokenNotFound { t.Errorf("%s: expected an unknown token refused, got %v", name, err) }
+			if err := tokens.DeleteExpiredFormTokens(ctx); err != nil { t.Errorf("%s: delete expired form tokens: %v", name, err) }
+		}
+		gdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		gdb.AutoMigrate(&Session{}, &FormToken{})
+		conformance("gorm", &GormSessionStore{DB: gdb})
+		conformance("memory", NewMemorySessionStore())
+		conformance("redis", NewRedisSessionStore(fakeRedis(t), "", 0))
+
+		mdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		mdb.AutoMigrate(&AdminUser{}, &AuditLog{}, &Permission{})
+		dave := &AdminUser{Email: "dave@example.com", Role: "admin"}
+		dave.SetPassword("correct-horse")
+		mdb.Create(dave)
+		mreg := NewRegistry(mdb)
+		store := NewMemorySessionStore()
+		mreg.SetSessionStore(store)
+		store.Create(ctx, &Session{ID: "expired", UserID: dave.ID, ExpiresAt: time.Now().Add(-time.Minute)})
+		form := url.Values{"email": {dave.Email}, "password": {"correct-horse"}}
+		req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mreg.ServeHTTP(rec, req)
+		cookies := rec.Result().Cookies()
+		if rec.Code != 303 || len(cookies) == 0 { t.Fatalf("Expected login without a sessions table, got %d", rec.Code) }
+		req = httptest.NewRequest("GET", "/admin/", nil)
+		req.AddCookie(cookies[0])
+		if user, _ := mreg.GetUserFromRequest(req); user == nil || user.ID != dave.ID { t.Fatal("Expected the memory store to authenticate") }
+		logout := httptest.NewRequest("GET", "/admin/logout", nil)
+		logout.AddCookie(cookies[0])
+		mreg.ServeHTTP(httptest.NewRecorder(), logout)
+		if user, _ := mreg.GetUserFromRequest(req); user != nil { t.Error("Expected logout to delete the session from the store") }
+		store.DeleteExpired(ctx)
+		if _, ok := store.sessions["expired"]; ok { t.Error("Expected expired sessions removed") }
+	})
+	t.Run("ActionPermissions", func(t *testing.T) {
+		pdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		pdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{}, &TestModel{})
+		viewer := &AdminUser{Email: "viewer@example.com", Role: "viewer"}
+		pdb.Create(viewer)
+		pdb.Create(&Session{ID: hashToken("viewer"), UserID: viewer.ID, Role: viewer.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		pdb.Create(&TestModel{Name: "secret"})
+		pdb.Create(&Permission{Role: "viewer", ResourceName: "TestModel", Action: "list"})
+		preg := NewRegistry(pdb)
+		ran := 0
+		handler := func(res *Resource, w http.ResponseWriter, r *http.Request) { ran++; w.WriteHeader(204) }
+		preg.Register(TestModel{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			AddMemberAction("ping", "Ping", handler).AddCollectionAction("report", "Report", handler).SetActionPermission("report", "reports").
+			AddBatchAction("archive", "Archive", func(res *Resource, ids []string, w http.ResponseWriter, r *http.Request) { ran++; w.WriteHeader(204) })
+		do := func(method, path string, form url.Values) int {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "viewer"})
+			rec := httptest.NewRecorder()
+			preg.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		grant := func(action string) { pdb.Create(&Permission{Role: "viewer", ResourceName: "TestModel", Action: action}) }
+		if code := do("GET", "/admin/TestModel/export", nil); code != 403 { t.Errorf("Expected a list-only role to be denied export, got %d", code) }
+		preg.Config.ExportFallbackToList = true
+		if code := do("GET", "/admin/TestModel/export", nil); code != 200 { t.Errorf("Expected export with the list fallback, got %d", code) }
+		preg.Config.ExportFallbackToList = false
+		for _, c := range []struct{ method, path string; form url.Values }{
+			{"GET", "/admin/TestModel/action?name=ping&id=1", nil},
+			{"GET", "/admin/TestModel/collection_action?name=report", nil},
+			{"POST", "/admin/TestModel/batch_action", url.Values{"action_name": {"archive"}, "ids": {"1"}}},
+			{"POST", "/admin/TestModel/batch_action", url.Values{"action_name": {"edit_field"}, "ids": {"1"}, "field": {"Name"}, "value": {"x"}}},
+			{"POST", "/admin/TestModel/batch_action", url.Values{"action_name": {"delete_selected"}, "ids": {"1"}}},
+		} {
+			if code := do(c.method, c.path, c.form); code != 403 { t.Errorf("Expected %s %v to be denied, got %d", c.path, c.form, code) }
+		}
+		if ran != 0 { t.Fatal("Expected no action handler to run") }
+		grant("ping"); grant("reports")
+		if do("GET", "/admin/TestModel/action?name=ping&id=1", nil) != 204 || do("GET", "/admin/TestModel/collection_action?name=report", nil) != 204 { t.Error("Expected actions to run with their own permissions") }
+		grant("action")
+		if code := do("POST", "/admin/TestModel/batch_action", url.Values{"action_name": {"archive"}, "ids": {"1"}}); code != 204 { t.Errorf("Expected the generic action permission to grant batch actions, got %d", code) }
+		if code := do("POST", "/admin/TestModel/batch_action", url.Values{"action_name": {"delete_selected"}, "ids": {"1"}}); code != 403 { t.Errorf("Expected the generic action permission not to grant deletes, got %d", code) }
+		grant("export")
+		if code := do("GET", "/admin/TestModel/export", nil); code != 200 { t.Errorf("Expected export with the export permission, got %d", code) }
+		if got := strings.Join(preg.PermissionActions(), ","); !strings.Contains(got, "export") || !strings.Contains(got, "ping") || !strings.Contains(got, "reports") || !strings.Contains(got, "archive") { t.Errorf("Expected custom action permissions to be grantable, got %s", got) }
+	})
+	t.Run("TransactionalSave", func(t *testing.T) {
+		tdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		tdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Product{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		tdb.Create(root)
+		tdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		treg := NewRegistry(tdb)
+		treg.Config.UploadDir = t.TempDir()
+		treg.Register(Product{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Stock", "Stock", false).RegisterField("Image", "Image", false).SetFieldType("Image", "image")
+		save := func(fields map[string]string, upload bool) *httptest.ResponseRecorder {
+			var body strings.Builder
+			mw := multipart.NewWriter(&body)
+			for k, v := range fields { mw.WriteField(k, v) }
+			if upload { fw, _ := mw.CreateFormFile("Image", "photo.png"); fw.Write([]byte("png")) }
+			mw.Close()
+			req := httptest.NewRequest("POST", "/admin/Product/save", strings.NewReader(body.String()))
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			treg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := save(map[string]string{"Name": "Lamp", "Stock": "3"}, true); rec.Code != 303 { t.Fatalf("Expected the first save to succeed, got %d", rec.Code) }
+		var p Product
+		tdb.First(&p, "name = ?", "Lamp")
+		files, _ := os.ReadDir(treg.Config.UploadDir)
+		if len(files) != 1 || "/admin/uploads/"+files[0].Name() != p.Image { t.Fatalf("Expected the upload promoted to %s, got %v", p.Image, files) }
+		var logs []AuditLog
+		tdb.Find(&logs)
+		if len(logs) != 1 || !strings.Contains(logs[0].Changes, `Name: "Lamp"`) || !strings.Contains(logs[0].Changes, `Stock: "3"`) { t.Errorf("Expected one audit entry with the diff, got %+v", logs) }
+
+		rec := save(map[string]string{"Name": "Lamp", "Stock": "1"}, true)
+		if rec.Code != 422 || !strings.Contains(rec.Body.String(), "Could not save") || !strings.Contains(rec.Body.String(), "UNIQUE") { t.Errorf("Expected the constraint violation on the form, got %d", rec.Code) }
+		if files, _ := os.ReadDir(treg.Config.UploadDir); len(files) != 1 { t.Errorf("Expected the failed save's upload removed, got %d files", len(files)) }
+		var n int64
+		tdb.Model(&AuditLog{}).Count(&n)
+		if n != 1 { t.Errorf("Expected no audit entry for the failed save, got %d", n) }
+
+		rec = save(map[string]string{"ID": fmt.Sprint(p.ID), "Name": "Lamp", "Stock": "lots"}, false)
+		if rec.Code != 422 || !strings.Contains(rec.Body.String(), "is not a valid Stock") { t.Errorf("Expected the parse error next to the field, got %d", rec.Code) }
+		if rec := save(map[string]string{"ID": fmt.Sprint(p.ID), "Name": "Lamp", "Stock": "5", "Image": p.Image}, false); rec.Code != 303 { t.Fatalf("Expected the update to save, got %d", rec.Code) }
+		var last AuditLog
+		tdb.Order("id desc").First(&last)
+		if last.Action != "Update" || last.Changes != `Stock: "3" → "5"` { t.Errorf("Expected the update's diff, got %q", last.Changes) }
+	})
+	t.Run("PrimaryKeys", func(t *testing.T) {
+		kdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		kdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &TestModel{}, &Sku{}, &Device{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		kdb.Create(root)
+		kdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		kreg := NewRegistry(kdb)
+		kreg.Register(TestModel{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		skus := kreg.Register(Sku{}).RegisterField("Code", "Code", false).RegisterField("Name", "Name", false).HasMany("Devices", "Devices", "Device", "SkuCode")
+		devices := kreg.Register(Device{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false)
+		if skus.PrimaryKey != "Code" || devices.PrimaryKey != "ID" { t.Fatalf("Expected keys detected from the schema, got %s and %s", skus.PrimaryKey, devices.PrimaryKey) }
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			kreg.ServeHTTP(rec, req)
+			return rec
+		}
+		num := &TestModel{Name: "numbered"}
+		kdb.Create(num)
+		dev := &Device{ID: uuid.New(), Name: "sensor", SkuCode: "A-1"}
+		kdb.Create(dev)
+		for _, c := range []struct{ slug, key, name string }{{"TestModel", fmt.Sprint(num.ID), "numbered"}, {"Sku", "A-1", "Widget"}, {"Device", dev.ID.String(), "sensor"}} {
+			if c.slug == "Sku" {
+				if rec := do("POST", "/admin/Sku/save", url.Values{"Code": {"A-1"}, "Name": {"Widget"}}); rec.Code != 303 { t.Fatalf("Expected a string-keyed record created from the form, got %d", rec.Code) }
+				if rec := do("POST", "/admin/Sku/save", url.Values{"Code": {"A-1"}, "Name": {"Clash"}}); rec.Code != 422 { t.Errorf("Expected a duplicate key to be refused rather than overwrite, got %d", rec.Code) }
+			}
+			if item, err := kreg.Get(c.slug, c.key); err != nil || !strings.Contains(fmt.Sprintf("%+v", item), c.name) { t.Errorf("%s: expected Get by %q, got %+v (%v)", c.slug, c.key, item, err) }
+			if body := do("GET", "/admin/"+c.slug, nil).Body.String(); !strings.Contains(body, "show?id="+url.QueryEscape(c.key)) { t.Errorf("%s: expected list links to use the key %q", c.slug, c.key) }
+			edit := do("GET", "/admin/"+c.slug+"/edit?id="+url.QueryEscape(c.key), nil)
+			if edit.Code != 200 || !strings.Contains(edit.Body.String(), "save?id="+url.QueryEscape(c.key)) { t.Errorf("%s: expected the edit form to post its key, got %d", c.slug, edit.Code) }
+			if rec := do("POST", "/admin/"+c.slug+"/save?id="+url.QueryEscape(c.key), url.Values{"Name": {c.name + " v2"}}); rec.Code != 303 { t.Errorf("%s: expected the update to save, got %d", c.slug, rec.Code) }
+			if rec := do("GET", "/admin/"+c.slug+"/show?id="+url.QueryEscape(c.key), nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), c.name+" v2") { t.Errorf("%s: expected the updated record shown, got %d", c.slug, rec.Code) }
+			if rec := do("GET", "/admin/"+c.slug+"/show?id="+url.QueryEscape("0 OR 1=1"), nil); rec.Code != 404 { t.Errorf("%s: expected an unknown key to be not found, got %d", c.slug, rec.Code) }
+		}
+		if body := do("GET", "/admin/Sku/show?id=A-1", nil).Body.String(); !strings.Contains(body, "sensor v2") { t.Error("Expected HasMany records joined on the string key") }
+		var n int64
+		if kdb.Model(&Sku{}).Count(&n); n != 1 { t.Errorf("Expected one Sku, got %d", n) }
+		if err := kreg.Delete("Device", dev.ID.String()); err != nil { t.Fatal(err) }
+		if kdb.Model(&Device{}).Count(&n); n != 0 { t.Errorf("Expected the device deleted by its uuid, got %d left", n) }
+		do("POST", "/admin/Sku/batch_action", url.Values{"action_name": {"delete_selected"}, "ids": {"A-1"}, "confirm": {"1"}})
+		if kdb.Model(&Sku{}).Count(&n); n != 0 { t.Errorf("Expected the batch delete to find the Sku by its code, got %d left", n) }
+	})
+	t.Run("EmbeddedFields", func(t *testing.T) {
+		edb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		edb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Invoice{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		edb.Create(root)
+		edb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		ereg := NewRegistry(edb)
+		res := ereg.Register(Invoice{}).RegisterField("Number", "Invoice No.", false).RegisterModelFields()
+		var names []string
+		for _, f := range res.Fields { names = append(names, f.Name) }
+		if got := strings.Join(names, ","); got != "Number,ID,CreatedAt,UpdatedAt,ReviewedBy,Approved,Total" { t.Fatalf("Expected embedded fields discovered in order, got %s", got) }
+		var edit []string
+		for _, f := range res.GetFieldsFor("edit") { edit = append(edit, f.Name) }
+		if got := strings.Join(edit, ","); got != "Number,ID,ReviewedBy,Approved,Total" { t.Errorf("Expected timestamps left off the form, got %s", got) }
+		if f := res.Fields[2]; !f.Readonly || f.Label != "Created At" { t.Errorf("Expected CreatedAt readonly as \"Created At\", got %+v", f) }
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			ereg.ServeHTTP(rec, req)
+			return rec
+		}
+		bare := &Invoice{Number: "INV-1"}
+		edb.Create(bare)
+		for _, path := range []string{"/admin/Invoice", "/admin/Invoice/show?id=" + fmt.Sprint(bare.ID), "/admin/Invoice/edit?id=" + fmt.Sprint(bare.ID), "/admin/Invoice/export"} {
+			if rec := do("GET", path, nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), "INV-1") { t.Errorf("Expected %s to render a record with a nil embedded pointer, got %d", path, rec.Code) }
+		}
+		if rec := do("POST", "/admin/Invoice/save", url.Values{"Number": {"INV-2"}, "ReviewedBy": {"alice"}, "Approved": {"true"}, "Total": {"9.5"}}); rec.Code != 303 { t.Fatalf("Expected the save to succeed, got %d", rec.Code) }
+		var saved Invoice
+		edb.Where("number = ?", "INV-2").First(&saved)
+		if saved.Reviewed == nil || saved.ReviewedBy != "alice" || !saved.Approved || saved.Total != 9.5 || saved.CreatedAt.IsZero() { t.Errorf("Expected promoted fields saved, got %+v", saved) }
+		if rec := do("GET", "/admin/Invoice/show?id="+fmt.Sprint(saved.ID), nil); !strings.Contains(rec.Body.String(), "alice") || !strings.Contains(rec.Body.String(), "Created At") { t.Error("Expected promoted fields and timestamps on the show page") }
+	})
+	t.Run("TagFields", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Article{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		res := areg.Register(Article{}).RegisterModelFields().SetFieldType("Labels", "tags")
+		if f := res.Fields[2]; f.Name != "Tags" || f.Type != "tags" { t.Fatalf("Expected a serialized []string discovered as tags, got %+v", f) }
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := do("POST", "/admin/Article/save", url.Values{"Title": {"First"}, "Tags": {"go", "web", "db, go"}, "Labels": {"x"}}); rec.Code != 303 { t.Fatalf("Expected the save to succeed, got %d", rec.Code) }
+		adb.Create(&Article{Title: "Second", Tags: []string{"golang"}})
+		var a Article
+		adb.First(&a, "title = ?", "First")
+		if strings.Join(a.Tags, ",") != "go,web,db" || a.Labels != `["x"]` { t.Fatalf("Expected tags stored deduplicated, got %v and %q", a.Tags, a.Labels) }
+		if body := do("GET", "/admin/Article?tag_Tags=go", nil).Body.String(); !strings.Contains(body, `<span class="tag-chip">web</span>`) || strings.Contains(body, "Second") { t.Error("Expected the has-tag filter to match whole tags only") }
+		if rec := do("GET", "/admin/Article/show?id="+fmt.Sprint(a.ID), nil); !strings.Contains(rec.Body.String(), `<span class="tag-chip">db</span>`) { t.Error("Expected chips on the show page") }
+		if rec := do("GET", "/admin/Article/edit?id="+fmt.Sprint(a.ID), nil); !strings.Contains(rec.Body.String(), `name="Tags" value="web"`) { t.Error("Expected the form to carry existing tags") }
+		var suggested []string
+		json.Unmarshal(do("GET", "/admin/Article/tags?field=Tags&q=G", nil).Body.Bytes(), &suggested)
+		if strings.Join(suggested, ",") != "go,golang" { t.Errorf("Expected matching existing tags suggested, got %v", suggested) }
+		if rec := do("GET", "/admin/Article/tags?field=Title", nil); rec.Code != 404 { t.Errorf("Expected suggestions only for tags fields, got %d", rec.Code) }
+		if body := do("GET", "/admin/Article/export", nil).Body.String(); !strings.Contains(body, "go, web, db") { t.Errorf("Expected tags comma-separated in exports, got %s", body) }
+		do("POST", "/admin/Article/save?id="+fmt.Sprint(a.ID), url.Values{"Title": {"First"}})
+		a = Article{}
+		adb.First(&a, "title = ?", "First")
+		if len(a.Tags) != 0 || a.Labels != "[]" { t.Errorf("Expected an empty submission to clear the tags, got %v and %q", a.Tags, a.Labels) }
+	})
+	t.Run("TypedFields", func(t *testing.T) {
+		euro := CurrencyOptions{Symbol: "€", Decimals: 2}
+		for in, want := range map[string]int64{"1,234.56": 123456, "1.234,56": 123456, "€ 12": 1200, "-0.5": -50, "1,234": 123400, "12.345": 1234500, "": 0} {
+			if got, err := parseAmount(in, euro); err != nil || got != want { t.Errorf("parseAmount(%q) = %d, %v; want %d", in, got, err, want) }
+		}
+		for _, in := range []string{"12.345.6x", "abc", "1.2345"} {
+			if _, err := parseAmount(in, euro); err == nil { t.Errorf("Expected parseAmount(%q) to fail", in) }
+		}
+		if got := formatAmount(-123456789, euro, true); got != "-€1,234,567.89" { t.Errorf("Expected grouped amounts, got %s", got) }
+		if got := formatDuration(90 * time.Minute); got != "1h30m" { t.Errorf("Expected trailing zero units trimmed, got %s", got) }
+
+		pdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		pdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Plan{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		pdb.Create(root)
+		pdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		preg := NewRegistry(pdb)
+		preg.Register(Plan{}).RegisterModelFields().SetFieldType("Color", "color").SetFieldType("Trial", "duration").SetFieldType("Grace", "duration").SetCurrency("Price", "€", 2)
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			preg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := do("POST", "/admin/Plan/save", url.Values{"Color": {"red"}, "Trial": {"soon"}, "Grace": {"45s"}, "Price": {"12,34,5x"}})
+		body := rec.Body.String()
+		if rec.Code != 422 || !strings.Contains(body, "Enter a color as #RRGGBB.") || !strings.Contains(body, "Enter a duration like 1h30m.") || !strings.Contains(body, "Enter an amount like 1,234.56.") { t.Errorf("Expected each invalid value reported, got %d", rec.Code) }
+		if rec := do("POST", "/admin/Plan/save", url.Values{"Color": {"#A1B2C3"}, "Trial": {"1h30m"}, "Grace": {"45s"}, "Price": {"1.234,56"}}); rec.Code != 303 { t.Fatalf("Expected the save to succeed, got %d", rec.Code) }
+		var p Plan
+		pdb.First(&p)
+		if p.Color != "#a1b2c3" || p.Trial != 90*time.Minute || p.Grace != int64(45*time.Second) || p.Price != 123456 { t.Fatalf("Expected values coerced, got %+v", p) }
+		body = do("GET", "/admin/Plan", nil).Body.String()
+		for _, want := range []string{"€1,234.56", "1h30m", `<span class="color-swatch" style="background: #a1b2c3;"></span>#a1b2c3`} {
+			if !strings.Contains(body, want) { t.Errorf("Expected %q in the list", want) }
+		}
+		body = do("GET", "/admin/Plan/edit?id="+fmt.Sprint(p.ID), nil).Body.String()
+		for _, want := range []string{`type="color" name="Color" value="#a1b2c3"`, `name="Trial" value="1h30m"`, `name="Grace" value="45s"`, `name="Price" value="1234.56"`} {
+			if !strings.Contains(body, want) { t.Errorf("Expected %q on the form", want) }
+		}
+		if body := do("GET", "/admin/Plan/export", nil).Body.String(); !strings.Contains(body, "1234.56") || !strings.Contains(body, "1h30m") { t.Errorf("Expected exports to use the input formats, got %s", body) }
+	})
+	t.Run("CountsAndFooter", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Customer{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Country", "Country", false).
+			HasMany("Orders", "Orders", "Order", "CustomerID").AddCountField("Orders", "Orders").AddFooterAggregate("Orders", "sum")
+		areg.Register(Order{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("CustomerID", "Customer", false).RegisterField("Total", "Total", false).
+			SetFieldType("Total", "currency").AddFooterAggregate("Total", "sum").AddFooterAggregate("ID", "avg")
+		a, b, c := &Customer{Name: "A", Country: "IN"}, &Customer{Name: "B", Country: "FR"}, &Customer{Name: "C", Country: "IN"}
+		adb.Create(a); adb.Create(b); adb.Create(c)
+		adb.Create(&Order{Name: "o1", CustomerID: a.ID, Total: 1050}); adb.Create(&Order{Name: "o2", CustomerID: a.ID, Total: 200}); adb.Create(&Order{Name: "o3", CustomerID: b.ID, Total: 99900})
+		do := func(path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		body := do("/admin/Customer?sort=Orders&order=desc").Body.String()
+		link := fmt.Sprintf(`<a href="/admin/Order?eq_CustomerID=%d" class="count-link">2</a>`, a.ID)
+		if !strings.Contains(body, link) || !strings.Contains(body, `class="count-link">0</a>`) { t.Fatalf("Expected linked order counts, got %s", body) }
+		pos := func(id uint) int { return strings.Index(body, fmt.Sprintf("eq_CustomerID=%d", id)) }
+		if !(pos(a.ID) < pos(b.ID) && pos(b.ID) < pos(c.ID)) { t.Error("Expected sorting by the count") }
+		if !strings.Contains(body, `<span class="footer-label">Total</span> 3`) { t.Error("Expected the count total in the footer") }
+		body = do(fmt.Sprintf("/admin/Order?eq_CustomerID=%d&per_page=1", a.ID)).Body.String()
+		if strings.Contains(body, "o3") || !strings.Contains(body, `<span class="footer-label">Total</span> $12.50`) || !strings.Contains(body, `<span class="footer-label">Average</span> 1.5`) {
+			t.Errorf("Expected footer totals over the filtered query rather than the page, got %s", body)
+		}
+		csv := do("/admin/Customer/export").Body.String()
+		if !strings.Contains(csv, "ID,Name,Country,Orders") || !strings.Contains(csv, fmt.Sprintf("%d,A,IN,2", a.ID)) || strings.Contains(csv, "Total") { t.Errorf("Expected the count column but no footer in exports, got %q", csv) }
+		if body := do(fmt.Sprintf("/admin/Customer/show?id=%d", b.ID)).Body.String(); !strings.Contains(body, `class="count-link">1</a>`) { t.Error("Expected the count on the show page") }
+	})
+	t.Run("ScopeAll", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Note{})
+		alice, bob := &AdminUser{Email: "alice@example.com", Role: "admin"}, &AdminUser{Email: "bob@example.com", Role: "admin"}
+		adb.Create(alice); adb.Create(bob)
+		adb.Create(&Session{ID: hashToken("alice"), UserID: alice.ID, Role: alice.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		orgs := map[uint]uint{alice.ID: 1, bob.ID: 2}
+		areg := NewRegistry(adb)
+		res := areg.Register(Note{}).RegisterModelFields()
+		areg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB {
+			if res.Name != "Note" { return q }
+			return q.Where("org_id = ?", orgs[user.ID])
+		})
+		mine, theirs := &Note{OrgID: 1, Title: "mine"}, &Note{OrgID: 2, Title: "theirs"}
+		adb.Create(mine); adb.Create(theirs)
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "alice"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		if body := do("GET", "/admin/Note", nil).Body.String(); !strings.Contains(body, "mine") || strings.Contains(body, "theirs") || !strings.Contains(body, "1 records") { t.Error("Expected the list and its count to hold only the user's rows") }
+		if rec := do("GET", fmt.Sprintf("/admin/Note/show?id=%d", theirs.ID), nil); rec.Code != http.StatusNotFound { t.Errorf("Expected other tenants' records to be invisible, got %d", rec.Code) }
+		if body := do("GET", "/admin/Note/search?q=e", nil).Body.String(); strings.Contains(body, "theirs") { t.Error("Expected search to be scoped") }
+		if body := do("GET", "/admin/Note/export", nil).Body.String(); strings.Contains(body, "theirs") { t.Error("Expected exports to be scoped") }
+		if rec := do("POST", "/admin/Note/delete?id="+fmt.Sprint(theirs.ID), nil); rec.Code != http.StatusNotFound { t.Errorf("Expected deleting another tenant's record to 404, got %d", rec.Code) }
+		if rec := do("POST", fmt.Sprintf("/admin/Note/save?id=%d", theirs.ID), url.Values{"Title": {"hijacked"}}); rec.Code != http.StatusNotFound { t.Errorf("Expected saving another tenant's record to 404, got %d", rec.Code) }
+		do("POST", "/admin/Note/save", url.Values{"Title": {"crafted"}, "OrgID": {"2"}})
+		do("POST", fmt.Sprintf("/admin/Note/save?id=%d", mine.ID), url.Values{"Title": {"moved"}, "OrgID": {"2"}})
+		var notes []Note
+		adb.Order("id").Find(&notes)
+		if len(notes) != 3 || notes[0].OrgID != 1 || notes[0].Title != "moved" || notes[1].Title != "theirs" || notes[2].Title != "crafted" || notes[2].OrgID != 1 {
+			t.Errorf("Expected saves to keep records in the user's org, got %+v", notes)
+		}
+		areg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB { return q.Where("org_id IN ?", []uint{orgs[user.ID]}) })
+		if rec := do("POST", fmt.Sprintf("/admin/Note/save?id=%d", mine.ID), url.Values{"Title": {"escaped"}, "OrgID": {"2"}}); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "outside your scope") {
+			t.Errorf("Expected a save leaving the scope to be rejected, got %d", rec.Code)
+		}
+		ctx := withUser(context.Background(), alice)
+		if n := areg.CountFor(ctx, res, nil); n != 2 { t.Errorf("Expected scoped counts, got %d", n) }
+		if n := areg.CountFor(context.Background(), res, nil); n != 3 { t.Errorf("Expected unscoped counts without a user, got %d", n) }
+		areg.AddStat("Notes", func(db *gorm.DB) (n int64, err error) { err = db.Model(&Note{}).Count(&n).Error; return }).Resource = "Note"
+		areg.Config.AutoResourceStats = false
+		for _, st := range areg.dashboardStats(httptest.NewRequest("GET", "/admin/", nil).WithContext(ctx), alice) {
+			if st.Value != 2 { t.Errorf("Expected a resource stat to get a scoped handle, got %+v", st) }
+		}
+	})
+	t.Run("Comments", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{}, &UserPreference{}, &SavedFilter{}, &Comment{}, &Customer{}, &Order{})
+		root, agent := &AdminUser{Email: "root@example.com", Role: "admin"}, &AdminUser{Email: "agent@example.com", Role: "support"}
+		adb.Create(root); adb.Create(agent)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		adb.Create(&Session{ID: hashToken("agent"), UserID: agent.ID, Role: agent.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		adb.Create(&Permission{Role: "support", ResourceName: "Customer", Action: "show"})
+		areg := NewRegistry(adb)
+		areg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).EnableComments()
+		areg.Register(Order{})
+		c := &Customer{Name: "Acme"}
+		adb.Create(c); adb.Create(&Order{Name: "o1"})
+		do := func(token, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: token})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		show := fmt.Sprintf("/admin/Customer/show?id=%d", c.ID)
+		if rec := do("agent", "POST", fmt.Sprintf("/admin/Customer/comment?id=%d", c.ID), url.Values{"body": {"Called, see https://tickets.test/1?a=1&b=2.\n<b>VIP</b>"}}); rec.Code != 303 { t.Fatalf("Expected the comment to be added, got %d", rec.Code) }
+		do("root", "POST", fmt.Sprintf("/admin/Customer/comment?id=%d", c.ID), url.Values{"body": {"Refund approved"}})
+		body := do("agent", "GET", show, nil).Body.String()
+		if !strings.Contains(body, `<a href="https://tickets.test/1?a=1&amp;b=2" target="_blank" rel="noopener noreferrer">https://tickets.test/1?a=1&amp;b=2</a>.<br>&lt;b&gt;VIP&lt;/b&gt;`) { t.Errorf("Expected an escaped comment with links and line breaks, got %s", body) }
+		if strings.Index(body, "Refund approved") > strings.Index(body, "Called") { t.Error("Expected the newest comment first") }
+		var comments []Comment
+		adb.Order("id").Find(&comments)
+		if len(comments) != 2 || comments[0].UserID != agent.ID || comments[0].RecordID != fmt.Sprint(c.ID) { t.Fatalf("Unexpected comments %+v", comments) }
+		if strings.Count(body, `name="comment_id"`) != 1 { t.Error("Expected agents to see a delete button on their own comments only") }
+		del := func(token string, cm Comment) int {
+			return do(token, "POST", fmt.Sprintf("/admin/Customer/delete_comment?id=%d", c.ID), url.Values{"comment_id": {fmt.Sprint(cm.ID)}}).Code
+		}
+		if code := del("agent", comments[1]); code != http.StatusForbidden { t.Errorf("Expected agents not to delete others' comments, got %d", code) }
+		if code := del("root", comments[0]); code != 303 { t.Errorf("Expected admins to delete any comment, got %d", code) }
+		var logs []AuditLog
+		adb.Where("resource_name = ? AND record_id = ?", "Customer", fmt.Sprint(c.ID)).Order("id").Find(&logs)
+		if len(logs) != 3 || logs[0].Action != "Comment" || logs[2].Action != "Delete Comment" || !strings.Contains(logs[2].Changes, "tickets.test") { t.Errorf("Expected comments in the record history, got %+v", logs) }
+		if csv := do("root", "GET", "/admin/Customer/export", nil).Body.String(); strings.Contains(csv, "Refund") { t.Error("Expected comments to stay out of exports") }
+		if rec := do("root", "POST", "/admin/Order/comment?id=1", url.Values{"body": {"x"}}); rec.Code != http.StatusNotFound { t.Errorf("Expected comments to be opt-in, got %d", rec.Code) }
+	})
+	t.Run("BoardView", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Ticket{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Register(Ticket{}).RegisterModelFields().SetFieldType("Status", "select", "open", "doing", "done").EnableBoardView("Status", "Priority").
+			AddScope("urgent", "Urgent", func(db *gorm.DB) *gorm.DB { return db.Where("priority = ?", "high") }).
+			OnBeforeSave(func(db *gorm.DB, user *AdminUser, item interface{}, isNew bool) error {
+				if t := item.(*Ticket); t.Status == "done" && t.Priority == "high" { return fmt.Errorf("urgent tickets need a review") }
+				return nil
+			})
+		urgent, minor := &Ticket{Name: "Outage", Status: "open", Priority: "high"}, &Ticket{Name: "Typo", Status: "open", Priority: "low"}
+		adb.Create(urgent); adb.Create(minor)
+		for i := 0; i <= boardColumnLimit; i++ { adb.Create(&Ticket{Name: fmt.Sprintf("Task %d", i), Status: "doing", Priority: "low"}) }
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		body := do("GET", "/admin/Ticket?view=board", nil).Body.String()
+		for _, want := range []string{`data-value="open"`, `open <span class="board-count">2</span>`, `done <span class="board-count">0</span>`, fmt.Sprintf("Showing %d of %d", boardColumnLimit, boardColumnLimit+1), `<span>Priority</span> high`, `<a href="?">Table</a><a href="?view=board" class="active">Board</a>`} {
+			if !strings.Contains(body, want) { t.Errorf("Expected the board to contain %q", want) }
+		}
+		if strings.Contains(body, "select-all") { t.Error("Expected the board to replace the table") }
+		body = do("GET", "/admin/Ticket?view=board&scope=urgent", nil).Body.String()
+		if !strings.Contains(body, `open <span class="board-count">1</span>`) || !strings.Contains(body, `doing <span class="board-count">0</span>`) { t.Error("Expected scopes to apply to the board") }
+		if rec := do("POST", fmt.Sprintf("/admin/Ticket/move?id=%d", minor.ID), url.Values{"value": {"done"}, "query": {"view=board"}}); rec.Code != 303 || rec.Header().Get("Location") != "/admin/Ticket?view=board" { t.Fatalf("Expected the move to redirect back to the board, got %d", rec.Code) }
+		adb.First(minor, minor.ID)
+		var log AuditLog
+		adb.Where("record_id = ?", fmt.Sprint(minor.ID)).First(&log)
+		if minor.Status != "done" || log.Action != "Update" || !strings.Contains(log.Changes, `"open" → "done"`) { t.Errorf("Expected an audited move, got %+v / %+v", minor, log) }
+		var moves int64
+		adb.Model(&AuditLog{}).Where("resource_name = ? AND record_id = ?", "Ticket", fmt.Sprint(minor.ID)).Count(&moves)
+		if moves != 1 { t.Errorf("Expected one audit entry per move, got %d", moves) }
+		if rec := do("POST", fmt.Sprintf("/admin/Ticket/move?id=%d", urgent.ID), url.Values{"value": {"lost"}}); rec.Code != http.StatusUnprocessableEntity { t.Errorf("Expected unknown columns to be rejected, got %d", rec.Code) }
+		do("POST", fmt.Sprintf("/admin/Ticket/move?id=%d", urgent.ID), url.Values{"value": {"done"}})
+		if adb.First(urgent, urgent.ID); urgent.Status != "open" { t.Error("Expected save hooks to veto moves") }
+	})
+	t.Run("CalendarView", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Event{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Register(Event{}).RegisterModelFields().EnableCalendarView("StartsAt", "EndsAt")
+		day := func(d, h int) time.Time { return time.Date(2026, 10, d, h, 0, 0, 0, time.Local) }
+		end := day(2, 0).AddDate(0, 0, 1)
+		adb.Create(&Event{Name: "Conference", StartsAt: day(1, 0).AddDate(0, 0, -3), EndsAt: &end})
+		adb.Create(&Event{Name: "Holiday", StartsAt: day(16, 0)})
+		adb.Create(&Event{Name: "Standup", StartsAt: day(16, 9)})
+		adb.Create(&Event{Name: "Retro", StartsAt: day(1, 0).AddDate(0, 1, 2)})
+		do := func(path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := do("/admin/Event/calendar?from=2026-10-01&to=2026-11-01")
+		var entries []calendarEntry
+		if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil { t.Fatalf("calendar: %d %s", rec.Code, rec.Body.String()) }
+		var names []string
+		for _, e := range entries { names = append(names, e.Title) }
+		if strings.Join(names, ",") != "Conference,Holiday,Standup" { t.Fatalf("expected the overlapping events in start order, got %v", names) }
+		if entries[0].End == nil || entries[0].AllDay || !entries[1].AllDay || entries[2].AllDay || entries[1].URL != "/admin/Event/show?id=2" {
+			t.Errorf("unexpected entries: %+v", entries)
+		}
+		if rec := do("/admin/Event/calendar?from=2026-10-01&to=2026-11-01&q_Name=Stand"); !strings.Contains(rec.Body.String(), "Standup") || strings.Contains(rec.Body.String(), "Conference") {
+			t.Errorf("expected the list filters to apply, got %s", rec.Body.String())
+		}
+		if rec := do("/admin/Event/calendar?from=2026-11-01&to=2026-10-01"); rec.Code != 400 { t.Errorf("expected 400 for an empty range, got %d", rec.Code) }
+		if rec := do("/admin/Event/new?StartsAt=2026-10-16"); !strings.Contains(rec.Body.String(), `type="datetime-local" name="StartsAt" value="2026-10-16T00:00"`) {
+			t.Errorf("expected the clicked day to prefill the start, got %s", rec.Body.String())
+		}
+		body := do("/admin/Event?view=calendar").Body.String()
+		if !strings.Contains(body, `id="calendar"`) || !strings.Contains(body, `<a href="?view=calendar" class="active">Calendar</a>`) {
+			t.Errorf("expected the calendar view, got %s", body)
+		}
+	})
+	t.Run("TreeView", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Category{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		res := areg.Register(Category{}).RegisterModelFields().EnableTree("ParentID")
+		books := &Category{Name: "Books"}
+		adb.Create(books)
+		fiction := &Category{Name: "Fiction", ParentID: &books.ID}
+		adb.Create(fiction)
+		adb.Create(&Category{Name: "Crime", ParentID: &fiction.ID})
+		adb.Create(&Category{Name: "Music"})
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		children := func(query string) string {
+			var nodes []TreeNode
+			rec := do("GET", "/admin/Category/children?"+query, nil)
+			if err := json.Unmarshal(rec.Body.Bytes(), &nodes); err != nil { t.Fatalf("children: %d %s", rec.Code, rec.Body.String()) }
+			var out []string
+			for _, n := range nodes { out = append(out, fmt.Sprintf("%s:%d", n.Label, n.Children)) }
+			return strings.Join(out, ",")
+		}
+		if got := children("parent="); got != "Books:1,Music:0" { t.Errorf("expected the roots with child counts, got %s", got) }
+		if got := children("parent=2"); got != "Crime:0" { t.Errorf("expected the children of Fiction, got %s", got) }
+		if got := children("parent=&q_Name=Mus"); got != "Music:0" { t.Errorf("expected filters to apply, got %s", got) }
+		if body := do("GET", "/admin/Category", nil).Body.String(); !strings.Contains(body, `id="tree"`) || !strings.Contains(body, `<a href="?view=table">Table</a>`) {
+			t.Errorf("expected the index to open on the tree, got %s", body)
+		}
+		if body := do("GET", "/admin/Category/show?id=3", nil).Body.String(); !strings.Contains(body, `<a href="/admin/Category/show?id=1">Books</a><span>›</span><a href="/admin/Category/show?id=2">Fiction</a>`) {
+			t.Errorf("expected a breadcrumb of the ancestors, got %s", body)
+		}
+		body := do("GET", "/admin/Category/edit?id=1", nil).Body.String()
+		if strings.Contains(body, `<option value="2"`) || strings.Contains(body, `<option value="3"`) || !strings.Contains(body, `<option value="4"`) {
+			t.Errorf("expected the parent picker to leave out the record and its descendants, got %s", body)
+		}
+		if rec := do("POST", "/admin/Category/save?id=1", url.Values{"Name": {"Books"}, "ParentID": {"3"}}); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "cannot be placed under itself") {
+			t.Errorf("expected a cycle to be refused, got %d", rec.Code)
+		}
+		if rec := do("POST", "/admin/Category/move_under?id=3", url.Values{"ParentID": {"4"}}); rec.Code != http.StatusSeeOther { t.Fatalf("move: %d %s", rec.Code, rec.Body.String()) }
+		var crime Category
+		adb.First(&crime, 3)
+		if crime.ParentID == nil || *crime.ParentID != 4 { t.Errorf("expected Crime under Music, got %v", crime.ParentID) }
+		var log AuditLog
+		if adb.Where("record_id = ? AND action = ?", "3", "Update").First(&log).Error != nil || !strings.Contains(log.Changes, "(moved)") { t.Errorf("expected the move to be audited, got %+v", log) }
+		do("GET", "/admin/Category/delete?id=1", nil)
+		if adb.Find(&Category{}, 1).RowsAffected == 0 { t.Errorf("expected a record with children to be kept") }
+		res.ReparentOnDelete()
+		do("GET", "/admin/Category/delete?id=1", nil)
+		var fic Category
+		adb.First(&fic, 2)
+		if adb.Find(&Category{}, 1).RowsAffected > 0 || fic.ParentID != nil { t.Errorf("expected the children to move up, got %v", fic.ParentID) }
+	})
+	t.Run("Bootstrap", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		areg := NewRegistry(adb)
+		if err := areg.Migrate(); err != nil { t.Fatal(err) }
+		for _, m := range []interface{}{&AdminUser{}, &Session{}, &Permission{}, &AuditLog{}, &SavedFilter{}, &Comment{}} {
+			if !adb.Migrator().HasTable(m) { t.Errorf("expected Migrate to create the table of %T", m) }
+		}
+		if err := areg.EnsureAdminUser("root@example.com", "short", ""); err == nil || !strings.Contains(err.Error(), "at least 8 characters") {
+			t.Errorf("expected a weak password to be rejected, got %v", err)
+		}
+		if err := areg.EnsureAdminUser("root@example.com", "correct horse", ""); err != nil { t.Fatal(err) }
+		if err := areg.EnsureAdminUser("other@example.com", "battery staple", "editor"); err != nil { t.Fatal(err) }
+		var users []AdminUser
+		adb.Find(&users)
+		if len(users) != 1 || users[0].Email != "root@example.com" || users[0].Role != "admin" || !users[0].Active || !users[0].CheckPassword("correct horse") {
+			t.Errorf("expected only the first admin, got %+v", users)
+		}
+		edb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		ereg := NewRegistry(edb)
+		ereg.Config.BootstrapAdminFromEnv = true
+		t.Setenv("ADMIN_EMAIL", "ops@example.com"); t.Setenv("ADMIN_PASSWORD", "from the env")
+		if err := ereg.Migrate(); err != nil { t.Fatal(err) }
+		var u AdminUser
+		if edb.Where("email = ?", "ops@example.com").First(&u).Error != nil || u.Role != "admin" { t.Errorf("expected the env admin, got %+v", u) }
+	})
+	t.Run("PrivateUploads", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Note{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Config.UploadDir, areg.Config.PrivateUploads, areg.Config.SecretKey = t.TempDir(), true, "s3cret"
+		os.WriteFile(filepath.Join(areg.Config.UploadDir, "1.txt"), []byte("contract"), 0644)
+		areg.Register(Note{}).RegisterModelFields().SetFieldType("Title", "file")
+		adb.Create(&Note{Title: "/admin/uploads/1.txt"})
+		get := func(path string, signedIn bool) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			if signedIn { req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"}) }
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		link := regexp.MustCompile(`/admin/uploads/1\.txt\?expires=\d+&amp;sig=[0-9a-f]+`).FindString(get("/admin/Note/show?id=1", true).Body.String())
+		if link == "" { t.Fatal("expected the show page to link to a signed upload URL") }
+		link = strings.ReplaceAll(link, "&amp;", "&")
+		if rec := get(link, true); rec.Code != http.StatusOK || rec.Body.String() != "contract" { t.Errorf("expected the signed link to serve the file, got %d", rec.Code) }
+		if rec := get(link, false); rec.Code != http.StatusForbidden { t.Errorf("expected a session to be required, got %d", rec.Code) }
+		for _, bad := range []string{"/admin/uploads/1.txt", strings.Replace(link, "sig=", "sig=0", 1), areg.SignedUploadURL("/admin/uploads/1.txt", -time.Minute)} {
+			if rec := get(bad, true); rec.Code != http.StatusForbidden { t.Errorf("expected %s to be refused, got %d", bad, rec.Code) }
+		}
+		if got := areg.SignedUploadURL("https://cdn.example.com/a.png", time.Hour); got != "https://cdn.example.com/a.png" { t.Errorf("expected external links unchanged, got %s", got) }
+		areg.Config.PrivateUploads = false
+		if rec := get("/admin/uploads/1.txt", false); rec.Code != http.StatusOK { t.Errorf("expected public uploads without PrivateUploads, got %d", rec.Code) }
+	})
+	t.Run("ExportEscaping", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Register(Order{}).RegisterModelFields()
+		formula := `=HYPERLINK("http://evil.example","Click")`
+		adb.Create(&Order{Name: formula, Total: -5}); adb.Create(&Order{Name: "@SUM(A1)", Total: 7})
+		export := func(query string, comma rune) (string, [][]string) {
+			req := httptest.NewRequest("GET", "/admin/Order/export?"+query, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			body := rec.Body.String()
+			r := csv.NewReader(strings.NewReader(strings.TrimPrefix(body, "\uFEFF")))
+			r.Comma = comma
+			rows, err := r.ReadAll()
+			if err != nil { t.Fatalf("export %s: %v in %q", query, err, body) }
+			return body, rows
+		}
+		body, rows := export("sort=ID", ',')
+		if strings.HasPrefix(body, "\uFEFF") || len(rows) != 3 || rows[1][1] != "'"+formula || rows[2][1] != "'@SUM(A1)" || rows[1][3] != "-5" {
+			t.Errorf("expected formulas quoted and numbers kept, got %q", rows)
+		}
+		areg.Config.CSVFormulaEscaping, areg.Config.CSVBOM, areg.Config.CSVDelimiter = "tab", true, ";"
+		body, rows = export("sort=ID", ';')
+		if !strings.HasPrefix(body, "\uFEFF") || !strings.Contains(body, ";") || rows[1][1] != "\t"+formula {
+			t.Errorf("expected the config's BOM, delimiter and tab escaping, got %q", body)
+		}
+		if body, _ := export("sort=ID&bom=0&delimiter=semicolon", ';'); strings.HasPrefix(body, "\uFEFF") { t.Errorf("expected ?bom=0 to drop the BOM") }
+		areg.Config.CSVFormulaEscaping = "off"
+		if _, rows = export("delimiter=comma&sort=ID", ','); rows[1][1] != formula { t.Errorf("expected escaping off to keep the cell, got %q", rows[1][1]) }
+	})
+
+	t.Run("AsyncExport", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := adb.DB(); sqlDB.SetMaxOpenConns(1)
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &ExportJob{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Config.ExportDir = t.TempDir()
+		res := areg.Register(Order{}).RegisterModelFields().AsyncExport(true)
+		adb.Create(&Order{Name: "First", Total: 1}); adb.Create(&Order{Name: "Second", Total: 2})
+		do := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, body)
+			if body != nil { req.Header.Set("Content-Type", "application/x-www-form-urlencoded") }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := do("GET", "/admin/Order/export?sort=ID", nil)
+		if rec.Code != 303 || rec.Header().Get("Location") != "/admin/exports" { t.Fatalf("expected a redirect to the exports page, got %d %s", rec.Code, rec.Header().Get("Location")) }
+		var job ExportJob
+		for i := 0; i < 200 && job.Status != "done"; i++ { time.Sleep(5 * time.Millisecond); job = ExportJob{}; adb.Last(&job) }
+		if job.Status != "done" || job.UserID != root.ID || job.Rows != 2 || job.Total != 2 || job.Progress() != 100 { t.Fatalf("expected a finished job, got %+v", job) }
+		if page := do("GET", "/admin/exports", nil).Body.String(); !strings.Contains(page, fmt.Sprintf("/exports/download?id=%d", job.ID)) { t.Error("expected a download link on the exports page") }
+		rec = do("GET", fmt.Sprintf("/admin/exports/download?id=%d", job.ID), nil)
+		if rec.Code != 200 || !strings.Contains(rec.Body.String(), "First") || !strings.Contains(rec.Body.String(), "Second") { t.Errorf("expected the export file, got %d %q", rec.Code, rec.Body.String()) }
+
+		// Another user's job is invisible, and a queued job can be cancelled before a worker claims it.
+		other := &AdminUser{Email: "other@example.com", Role: "admin"}
+		adb.Create(other)
+		theirs := ExportJob{UserID: other.ID, ResourceName: "Order", Status: "queued", CreatedAt: time.Now()}
+		adb.Create(&theirs)
+		if rec := do("GET", fmt.Sprintf("/admin/exports/download?id=%d", theirs.ID), nil); rec.Code != 404 { t.Errorf("expected 404 for another user's job, got %d", rec.Code) }
+		mine := ExportJob{UserID: root.ID, ResourceName: "Order", Status: "queued", CreatedAt: time.Now()}
+		adb.Create(&mine)
+		do("POST", "/admin/exports/cancel", strings.NewReader(fmt.Sprintf("id=%d", mine.ID)))
+		areg.runExportJob(mine.ID)
+		adb.First(&mine, mine.ID)
+		if mine.Status != "cancelled" || mine.File != "" { t.Errorf("expected the job cancelled and never run, got %+v", mine) }
+
+		// The threshold sends large exports of other resources to the queue; small ones still download directly.
+		res.AsyncExport(false)
+		if rec := do("GET", "/admin/Order/export", nil); rec.Code != 200 { t.Errorf("expected a direct download under the threshold, got %d", rec.Code) }
+		areg.Config.AsyncExportThreshold = 1
+		if rec := do("GET", "/admin/Order/export", nil); rec.Code != 303 { t.Errorf("expected a queued export over the threshold, got %d", rec.Code) }
+
+		// A job the full queue cannot take is marked failed instead of staying queued.
+		qreg := NewRegistry(adb)
+		qreg.exports.queue = make(chan uint)
+		refused := ExportJob{UserID: root.ID, ResourceName: "Order", Status: "queued", CreatedAt: time.Now()}
+		adb.Create(&refused)
+		qreg.exports.enqueue(qreg, refused.ID)
+		adb.First(&refused, refused.ID)
+		if refused.Status != "failed" || refused.Error != "queue full" || refused.FinishedAt == nil { t.Errorf("expected a job refused by the queue to be failed, got %+v", refused) }
+
+		adb.Model(&job).Update("created_at", time.Now().Add(-48*time.Hour))
+		areg.cleanupExports()
+		if _, err := os.Stat(filepath.Join(areg.Config.ExportDir, job.File)); !os.IsNotExist(err) || adb.Find(&ExportJob{}, job.ID).RowsAffected != 0 { t.Error("expected old jobs and their files cleaned up") }
+	})
+
+	t.Run("CompressionAndCaching", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Config.UploadDir = t.TempDir()
+		areg.Register(Order{}).RegisterModelFields()
+		adb.Create(&Order{Name: "Gzipped", Total: 3})
+		do := func(path string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			for i := 0; i+1 < len(header); i += 2 { req.Header.Set(header[i], header[i+1]) }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := do("/admin/Order", "Accept-Encoding", "gzip, deflate")
+		if rec.Header().Get("Content-Encoding") != "gzip" { t.Fatalf("expected a gzipped list page, got %q", rec.Header()) }
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil { t.Fatal(err) }
+		page, _ := io.ReadAll(zr)
+		if !strings.Contains(string(page), "Gzipped") || !strings.Contains(string(page), "/admin/assets/"+styleAsset) || strings.Contains(string(page), "<style>") { t.Error("expected the list page to link the cached stylesheet instead of inlining it") }
+		if rec := do("/admin/Order"); rec.Header().Get("Content-Encoding") != "" { t.Error("expected no compression without Accept-Encoding") }
+		if rec := do("/admin/Order/export", "Accept-Encoding", "gzip"); rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), "Gzipped") { t.Error("expected exports sent uncompressed") }
+
+		rec = do("/admin/assets/" + styleAsset)
+		if rec.Code != 200 || !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") || rec.Body.Len() != len(embeddedStyle) { t.Errorf("expected the cacheable stylesheet, got %d %q", rec.Code, rec.Header()) }
+		if rec := do("/admin/assets/style.0.css"); rec.Code != 404 { t.Errorf("expected 404 for an unknown asset, got %d", rec.Code) }
+
+		os.WriteFile(filepath.Join(areg.Config.UploadDir, "a.png"), []byte("\x89PNG\r\n\x1a\n"), 0644)
+		rec = do("/admin/uploads/a.png", "Accept-Encoding", "gzip")
+		etag := rec.Header().Get("ETag")
+		if etag == "" || rec.Header().Get("Last-Modified") == "" || rec.Header().Get("Content-Encoding") != "" { t.Errorf("expected an uncompressed upload with validators, got %q", rec.Header()) }
+		if rec := do("/admin/uploads/a.png", "If-None-Match", etag); rec.Code != 304 { t.Errorf("expected 304 for an unchanged upload, got %d", rec.Code) }
+	})
+
+	t.Run("ReadReplica", func(t *testing.T) {
+		dir := t.TempDir()
+		primary, _ := gorm.Open(sqlite.Open(filepath.Join(dir, "primary.db")), &gorm.Config{})
+		replica, _ := gorm.Open(sqlite.Open(filepath.Join(dir, "replica.db")), &gorm.Config{})
+		tables := map[*gorm.DB][]string{}
+		var mu sync.Mutex
+		for _, db := range []*gorm.DB{primary, replica} {
+			db := db
+			db.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Order{})
+			track := func(tx *gorm.DB) { mu.Lock(); tables[db] = append(tables[db], tx.Statement.Table); mu.Unlock() }
+			db.Callback().Query().After("gorm:query").Register("test:track", track)
+			db.Callback().Create().After("gorm:create").Register("test:track", track)
+		}
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		primary.Create(root)
+		primary.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		primary.Create(&Order{Name: "On primary"})
+		replica.Create(&Order{Name: "On replica"}); replica.Create(&Order{Name: "Out of scope"})
+		areg := NewRegistry(primary).SetReadDB(replica)
+		areg.Register(Order{}).RegisterModelFields()
+		areg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB { return q.Where("name <> ?", "Out of scope") })
+		do := func(method, path string, form url.Values) string {
+			var body io.Reader
+			if form != nil { body = strings.NewReader(form.Encode()) }
+			req := httptest.NewRequest(method, path, body)
+			if form != nil { req.Header.Set("Content-Type", "application/x-www-form-urlencoded") }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		mu.Lock(); tables = map[*gorm.DB][]string{}; mu.Unlock()
+		for _, path := range []string{"/admin/Order", "/admin/Order/show?id=1", "/admin/Order/export"} {
+			if body := do("GET", path, nil); !strings.Contains(body, "On replica") || strings.Contains(body, "On primary") || strings.Contains(body, "Out of scope") { t.Errorf("%s: expected the scoped replica's rows, got %q", path, body) }
+		}
+		if body := do("GET", "/admin/Order/edit?id=1", nil); !strings.Contains(body, "On primary") { t.Error("expected the edit form to read from the primary") }
+		do("POST", "/admin/Order/save", url.Values{"Name": {"Saved"}})
+		if primary.Where("name = ?", "Saved").Find(&[]Order{}).RowsAffected != 1 || replica.Where("name = ?", "Saved").Find(&[]Order{}).RowsAffected != 0 { t.Error("expected the save to go to the primary only") }
+		mu.Lock(); defer mu.Unlock()
+		for _, table := range tables[replica] {
+			if table == "sessions" || table == "admin_users" || table == "audit_logs" { t.Errorf("expected %s to stay on the primary", table) }
+		}
+		if !slices.Contains(tables[primary], "audit_logs") { t.Errorf("expected the audit entry written on the primary, got %v", tables[primary]) }
+	})
+
+	t.Run("ReflectionMeta", func(t *testing.T) {
+		mreg := NewRegistry(db)
+		res := mreg.Register(Wide{}).RegisterModelFields()
+		row := reflect.ValueOf(Wide{ID: 7, Audited: Audited{CreatedBy: "ann"}, Name: "Wide"})
+		if m := mreg.itemToMap(res, res.Fields, row, nil); m["CreatedBy"] != "ann" || m["Name"] != "Wide" || m[keyEntry] != uint(7) { t.Errorf("expected promoted and plain fields, got %v", m) }
+		if v := res.Meta().Value(row, "Missing"); v.IsValid() { t.Error("expected no value for an unknown field") }
+		type withPtr struct {
+			ID uint
+			*Audited
+		}
+		pres := NewResource(withPtr{})
+		if v := pres.Meta().Value(reflect.ValueOf(withPtr{ID: 1}), "CreatedBy"); v.IsValid() { t.Error("expected a field behind a nil embedded pointer to be missing") }
+		if v := pres.Meta().Value(reflect.ValueOf(&withPtr{Audited: &Audited{CreatedBy: "bo"}}), "CreatedBy"); !v.IsValid() || v.String() != "bo" { t.Error("expected the promoted field through a pointer") }
+		// Metadata is built on first use, which may race with registration and other requests.
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := mreg.Register(Wide{})
+				mreg.sliceToMap(r, r.Fields, reflect.ValueOf([]Wide{{ID: 1}, {ID: 2}}), nil)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("StructuredLogging", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &LoginEvent{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		viewer := &AdminUser{Email: "viewer@example.com", Role: "viewer"}
+		adb.Create(root); adb.Create(viewer)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		adb.Create(&Session{ID: hashToken("viewer"), UserID: viewer.ID, Role: viewer.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		adb.Create(&Permission{Role: "viewer", ResourceName: "Order", Action: "list"})
+		adb.Create(&Order{Name: "One"}); adb.Create(&Order{Name: "Two"})
+		var buf bytes.Buffer
+		areg := NewRegistry(adb).SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		areg.Use(areg.RequestLogger(nil))
+		areg.Register(Order{}).RegisterModelFields()
+		do := func(method, path, session string, form url.Values) *httptest.ResponseRecorder {
+			var body io.Reader
+			if form != nil { body = strings.NewReader(form.Encode()) }
+			req := httptest.NewRequest(method, path, body)
+			if form != nil { req.Header.Set("Content-Type", "application/x-www-form-urlencoded") }
+			if session != "" { req.AddCookie(&http.Cookie{Name: "admin_session", Value: session}) }
+			req.Header.Set("X-Request-ID", "req-"+session)
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		do("POST", "/admin/login", "", url.Values{"email": {"root@example.com"}, "password": {"wrong"}})
+		if rec := do("GET", "/admin/Order/delete?id=1", "viewer", nil); rec.Code != 403 || rec.Header().Get("X-Request-ID") != "req-viewer" { t.Errorf("expected a denied delete echoing the request id, got %d", rec.Code) }
+		do("GET", "/admin/Order/export", "root", nil)
+		events := map[string]map[string]interface{}{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var ev map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &ev); err != nil { t.Fatalf("expected JSON log lines, got %q", line) }
+			events[ev["msg"].(string)] = ev
+		}
+		if ev := events["resource registered"]; ev == nil || ev["resource"] != "Order" || ev["level"] != "DEBUG" { t.Errorf("expected registration at debug level, got %v", ev) }
+		if ev := events["login failed"]; ev == nil || ev["email"] != "root@example.com" || ev["level"] != "WARN" { t.Errorf("expected a failed login warning, got %v", ev) }
+		if ev := events["permission denied"]; ev == nil || ev["action"] != "delete" || ev["user"] != "viewer@example.com" || ev["request_id"] != "req-viewer" { t.Errorf("expected a permission denial with the request id, got %v", ev) }
+		if ev := events["export finished"]; ev == nil || ev["rows"] != float64(2) || ev["request_id"] != "req-root" { t.Errorf("expected the export's row count, got %v", ev) }
+		if ev := events["request"]; ev == nil || ev["path"] != "/admin/Order/export" || ev["status"] != float64(200) { t.Errorf("expected a request line, got %v", ev) }
+
+		buf.Reset()
+		areg.SetLogger(PrintfLogger(log.New(&buf, "", 0)))
+		do("POST", "/admin/login", "", url.Values{"email": {"nobody@example.com"}, "password": {"x"}})
+		if !strings.Contains(buf.String(), "admin: WARN login failed email=nobody@example.com") { t.Errorf("expected a Printf-style line, got %q", buf.String()) }
+	})
+	t.Run("Assignment", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Incident{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		alice, bob := &AdminUser{Email: "alice@example.com", Name: "Alice Adams", Role: "admin"}, &AdminUser{Email: "bob@example.com", Role: "viewer"}
+		adb.Create(root); adb.Create(alice); adb.Create(bob)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		adb.Create(&[]Incident{{Name: "Outage", Open: true}, {Name: "Slow page", Open: true}, {Name: "Typo", Open: false}})
+		areg := NewRegistry(adb)
+		areg.Config.AutoResourceStats = false
+		mailer := &fakeMailer{sent: make(chan sentMail, 10)}
+		areg.SetMailer(mailer)
+		areg.Register(Incident{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).EnableAssignment("AssignedToID", "admin", "support").NotifyAssignee()
+		areg.AddMyItemsStat("My open items", "Incident", func(db *gorm.DB) *gorm.DB { return db.Where("open = ?", true) })
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec
+		}
+		if body := do("GET", "/admin/Incident/show?id=1", nil).Body.String(); !strings.Contains(body, "/admin/Incident/assign?id=1") || !strings.Contains(body, "Alice Adams") || !strings.Contains(body, "root@example.com") || strings.Contains(body, "bob@example.com") {
+			t.Error("Expected an assign control listing only assignable users")
+		}
+		if rec := do("POST", "/admin/Incident/assign?id=1", url.Values{"assignee": {fmt.Sprint(bob.ID)}}); rec.Code != http.StatusUnprocessableEntity { t.Errorf("Expected a user outside the roles to be rejected, got %d", rec.Code) }
+		if rec := do("POST", "/admin/Incident/assign?id=1", url.Values{"assignee": {fmt.Sprint(alice.ID)}}); rec.Code != 303 { t.Fatalf("Expected a redirect after assigning, got %d", rec.Code) }
+		var got Incident
+		adb.First(&got, 1)
+		if got.AssignedToID == nil || *got.AssignedToID != alice.ID { t.Fatalf("Expected the incident assigned to alice, got %v", got.AssignedToID) }
+		if adb.Where("action = ? AND record_id = ? AND changes LIKE ?", "Assign", "1", "%alice@example.com%").Find(&[]AuditLog{}).RowsAffected != 1 { t.Error("Expected the assignment in the audit log") }
+		select {
+		case m := <-mailer.sent:
+			if m.To != alice.Email || !strings.Contains(m.Subject, "assigned Incident #1") { t.Errorf("Expected an assignment email to alice, got %+v", m) }
+		case <-time.After(time.Second): t.Error("Expected an assignment email")
+		}
+		do("POST", "/admin/Incident/assign?id=2", url.Values{"assignee": {fmt.Sprint(root.ID)}})
+		do("POST", "/admin/Incident/assign?id=3", url.Values{"assignee": {fmt.Sprint(root.ID)}})
+		select {
+		case m := <-mailer.sent: t.Errorf("Expected no email for self-assignment, got %+v", m)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if body := do("GET", "/admin/Incident", nil).Body.String(); !strings.Contains(body, "Alice Adams") || strings.Contains(body, "alice@example.com") || !strings.Contains(body, "Assigned to me") { t.Error("Expected assignees by name and an Assigned to me scope") }
+		if body := do("GET", "/admin/Incident?scope=assigned_to_me", nil).Body.String(); strings.Contains(body, "Outage") || !strings.Contains(body, "Slow page") { t.Error("Expected the scope to show only the user's items") }
+		if body := do("GET", "/admin/Incident?eq_AssignedToID="+fmt.Sprint(alice.ID), nil).Body.String(); !strings.Contains(body, "Outage") || strings.Contains(body, "Slow page") { t.Error("Expected filtering by assignee") }
+		// Users who can't see the field get no assignee filter, so the assignable users aren't loaded for them.
+		lookups := 0
+		adb.Callback().Query().After("gorm:query").Register("count_assignable", func(db *gorm.DB) { if strings.Contains(db.Statement.SQL.String(), "role IN") { lookups++ } })
+		adb.Create(&Session{ID: hashToken("bob"), UserID: bob.ID, Role: bob.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		adb.Create(&Permission{Role: "viewer", ResourceName: "Incident", Action: "list"})
+		res, _ := areg.GetResource("Incident")
+		for i := range res.Fields { if res.Fields[i].Name == "AssignedToID" { res.Fields[i].VisibleTo = []string{"admin"} } }
+		req := httptest.NewRequest("GET", "/admin/Incident", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "bob"})
+		rec := httptest.NewRecorder()
+		areg.ServeHTTP(rec, req)
+		if rec.Code != 200 || lookups != 0 { t.Errorf("Expected no assignee lookup for a user without the field, got %d with %d lookups", rec.Code, lookups) }
+		if do("GET", "/admin/Incident", nil); lookups != 1 { t.Errorf("Expected the assignee filter to load the users once, got %d lookups", lookups) }
+		for i := range res.Fields { if res.Fields[i].Name == "AssignedToID" { res.Fields[i].VisibleTo = nil } }
+		adb.Callback().Query().Remove("count_assignable")
+
+		do("POST", "/admin/Incident/assign?id=2", url.Values{"assignee": {""}})
+		var unassigned Incident
+		adb.First(&unassigned, 2)
+		if unassigned.AssignedToID != nil { t.Error("Expected an empty assignee to unassign") }
+		req = httptest.NewRequest("GET", "/admin", nil)
+		req = req.WithContext(withUser(req.Context(), root))
+		stats := areg.dashboardStats(req, root)
+		if len(stats) != 1 || stats[0].Value != 0 || !strings.Contains(stats[0].Link, "scope=assigned_to_me") { t.Errorf("Expected no open items for root, got %+v", stats) }
+		stats = areg.dashboardStats(req.WithContext(withUser(req.Context(), alice)), alice)
+		if len(stats) != 1 || stats[0].Value != 1 { t.Errorf("Expected one open item for alice, got %+v", stats) }
+	})
+	t.Run("ScopeCounts", func(t *testing.T) {
+		sdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Ticket{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		sdb.Create(root)
+		sdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		sdb.Create(&[]Ticket{{Name: "Login broken", Status: "open", Priority: "high"}, {Name: "Logo blurry", Status: "open", Priority: "low"}, {Name: "Old bug", Status: "closed", Priority: "high"}})
+		sreg := NewRegistry(sdb)
+		res := sreg.Register(Ticket{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Status", "Status", false).
+			AddScope("open", "Open", func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", "open") }).
+			AddScope("urgent", "Urgent", func(db *gorm.DB) *gorm.DB { return db.Where("priority = ?", "high") })
+		get := func(path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			sreg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		if body := get("/admin/Ticket"); strings.Contains(body, "scope-count") { t.Error("Expected no scope counts unless enabled") }
+		res.EnableScopeCounts()
+		body := get("/admin/Ticket")
+		for _, want := range []string{`All <span class="scope-count">(3)</span>`, `Open <span class="scope-count">(2)</span>`, `Urgent <span class="scope-count">(2)</span>`} {
+			if !strings.Contains(body, want) { t.Errorf("Expected %s in the scope bar", want) }
+		}
+		body = get("/admin/Ticket?q_Name=Log&scope=urgent")
+		for _, want := range []string{`All <span class="scope-count">(2)</span>`, `Open <span class="scope-count">(2)</span>`, `Urgent <span class="scope-count">(1)</span>`, `href="?q_Name=Log&amp;scope=open"`} {
+			if !strings.Contains(body, want) { t.Errorf("Expected %s with the name filter applied", want) }
+		}
+		res.SetCountStrategy(CountCached)
+		get("/admin/Ticket")
+		sdb.Create(&Ticket{Name: "New bug", Status: "open"})
+		if body := get("/admin/Ticket"); !strings.Contains(body, `Open <span class="scope-count">(2)</span>`) { t.Error("Expected cached scope counts") }
+	})
+	t.Run("DefaultScope", func(t *testing.T) {
+		ddb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		ddb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Ticket{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		ddb.Create(root)
+		ddb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		ddb.Create(&[]Ticket{{Name: "Login broken", Status: "open", Priority: "high"}, {Name: "Logo blurry", Status: "open", Priority: "low"}, {Name: "Old bug", Status: "closed", Priority: "high"}})
+		dreg := NewRegistry(ddb)
+		dreg.Register(Ticket{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("Status", "Status", false).
+			AddScope("open", "Open", func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", "open") }).
+			AddScope("urgent", "Urgent", func(db *gorm.DB) *gorm.DB { return db.Where("priority = ?", "high") }).
+			SetDefaultScope("open")
+		get := func(path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			dreg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		body := get("/admin/Ticket")
+		if strings.Contains(body, "Old bug") || !strings.Contains(body, "Login broken") { t.Error("Expected the default scope without a scope param") }
+		if !strings.Contains(body, `href="?scope=open" class="scope-link active"`) || !strings.Contains(body, `href="?scope=all" class="scope-link "`) { t.Error("Expected the default tab active and an All tab bypassing it") }
+		if body := get("/admin/Ticket?scope=all"); !strings.Contains(body, "Old bug") || !strings.Contains(body, `href="?scope=all" class="scope-link active"`) { t.Error("Expected scope=all to list everything") }
+		if body := get("/admin/Ticket?scope=urgent"); !strings.Contains(body, "Old bug") || strings.Contains(body, "Logo blurry") { t.Error("Expected an explicit scope to replace the default") }
+		if csv := get("/admin/Ticket/export"); strings.Contains(csv, "Old bug") || !strings.Contains(csv, "Logo blurry") { t.Error("Expected exports to follow the default scope") }
+		if csv := get("/admin/Ticket/export?scope=all"); !strings.Contains(csv, "Old bug") { t.Error("Expected exports with scope=all to include everything") }
+		if js := get("/admin/Ticket/search?q=o"); strings.Contains(js, "Old bug") || !strings.Contains(js, "Login broken") { t.Errorf("Expected search to follow the default scope, got %s", js) }
+		if js := get("/admin/Ticket/search?q=o&scope=all"); !strings.Contains(js, "Old bug") { t.Error("Expected search with scope=all to include everything") }
+		req := httptest.NewRequest("GET", "/admin", nil)
+		if stats := dreg.dashboardStats(req.WithContext(withUser(req.Context(), root)), root); len(stats) != 1 || stats[0].Value != 2 { t.Errorf("Expected the dashboard count to follow the default scope, got %+v", stats) }
+	})
+	t.Run("NotFoundAndEmptyState", func(t *testing.T) {
+		edb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		edb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Ticket{}, &Note{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		edb.Create(root)
+		edb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		ereg := NewRegistry(edb)
+		tickets := ereg.Register(Ticket{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).
+			AddScope("open", "Open", func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", "open") })
+		ereg.Register(Note{}).SetEmptyStateHTML(template.HTML(`<p class="custom-empty">Notes appear here once <a href="/docs">synced</a>.</p>`))
+		get := func(path string, signedIn bool) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			if signedIn { req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"}) }
+			rec := httptest.NewRecorder()
+			ereg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := get("/admin/Nonexistent", true)
+		if rec.Code != 404 || !strings.Contains(rec.Body.String(), "Page not found") || !strings.Contains(rec.Body.String(), "/admin/Ticket") { t.Errorf("Expected the 404 page within the layout, got %d", rec.Code) }
+		if rec := get("/admin/Ticket/show?id=99", true); rec.Code != 404 || !strings.Contains(rec.Body.String(), "Page not found") { t.Errorf("Expected a missing record to show the 404 page, got %d", rec.Code) }
+		if rec := get("/admin/Nonexistent", false); rec.Code != 303 || !strings.HasSuffix(rec.Header().Get("Location"), "/login") { t.Errorf("Expected signed-out users to be sent to login, got %d", rec.Code) }
+		body := get("/admin/Ticket", true).Body.String()
+		if !strings.Contains(body, "No Ticket records yet.") || !strings.Contains(body, `/admin/Ticket/new" class="btn btn-primary">Create first Ticket`) { t.Error("Expected the default empty state with a create button") }
+		tickets.SetEmptyState("No tickets yet, enjoy the quiet.")
+		if body := get("/admin/Ticket", true).Body.String(); !strings.Contains(body, "enjoy the quiet") { t.Error("Expected the custom empty state message") }
+		if body := get("/admin/Note", true).Body.String(); !strings.Contains(body, `<p class="custom-empty">`) { t.Error("Expected the custom empty state markup") }
+		edb.Create(&Ticket{Name: "Old bug", Status: "closed"})
+		if body := get("/admin/Ticket?scope=open", true).Body.String(); !strings.Contains(body, "No results match your filters") || strings.Contains(body, "Create first") { t.Error("Expected the filtered empty state for a scope") }
+		if body := get("/admin/Ticket?q_Name=zzz", true).Body.String(); !strings.Contains(body, `<a href="?">clear filters</a>`) { t.Error("Expected a clear filters link for a filter") }
+		if body := get("/admin/Ticket", true).Body.String(); strings.Contains(body, "empty-state") { t.Error("Expected no empty state with records") }
+		tickets.ReadOnly = true
+		edb.Delete(&Ticket{}, "1 = 1")
+		if body := get("/admin/Ticket", true).Body.String(); strings.Contains(body, "Create first") { t.Error("Expected no create button on a read-only resource") }
+	})
+	t.Run("Breadcrumbs", func(t *testing.T) {
+		bdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		bdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Customer{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		bdb.Create(root)
+		bdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		bdb.Create(&Customer{Name: "Acme"})
+		bdb.Create(&Order{Name: "First order", CustomerID: 1, Total: 10})
+		breg := NewRegistry(bdb)
+		breg.Register(Customer{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).HasMany("Orders", "Orders", "Order", "CustomerID")
+		breg.Register(Order{}).RegisterField("ID", "ID", true).RegisterField("Name", "Name", false).RegisterField("CustomerID", "Customer", false)
+		breg.AddPage("Reports", "Default", func(w http.ResponseWriter, r *http.Request) {
+			breg.RenderCustomPage(w, r, "Q3 report", "<p>Numbers</p>", Crumb{Label: "Reports", URL: breg.URL("/Reports")}, Crumb{Label: "Q3"})
+		})
+		get := func(path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			breg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		crumbs := func(body string) string {
+			nav := regexp.MustCompile(`(?s)<nav class="breadcrumbs".*?</nav>`).FindString(body)
+			return strings.Join(strings.Fields(regexp.MustCompile(`<[^>]+>`).ReplaceAllString(nav, " ")), " ")
+		}
+		body := get("/admin/Order/edit?id=1")
+		if !strings.Contains(body, "<title>Edit Order #1 — Go Admin</title>") { t.Error("Expected the edit page title") }
+		if got := crumbs(body); got != "Dashboard / Customer / Customer #1 / Order / Order #1 / Edit" { t.Errorf("Expected the parent chain in the trail, got %q", got) }
+		if !strings.Contains(body, `href="/admin/Order?eq_CustomerID=1"`) || !strings.Contains(body, `href="/admin/Customer/show?id=1"`) || !strings.Contains(body, `<span aria-current="page">Edit</span>`) { t.Error("Expected linked crumbs up to the current page") }
+		if body := get("/admin/Order/show?id=1"); !strings.Contains(body, "<title>Order #1 — Go Admin</title>") || crumbs(body) != "Dashboard / Customer / Customer #1 / Order / Order #1" { t.Errorf("Expected the show page trail, got %q", crumbs(body)) }
+		if got := crumbs(get("/admin/Order?eq_CustomerID=1")); got != "Dashboard / Customer / Customer #1 / Order" { t.Errorf("Expected a filtered list under its parent, got %q", got) }
+		if body := get("/admin/Order"); !strings.Contains(body, "<title>Order — Go Admin</title>") || crumbs(body) != "Dashboard / Order" { t.Errorf("Expected the list trail, got %q", crumbs(body)) }
+		if body := get("/admin/Order/new"); !strings.Contains(body, "<title>New Order — Go Admin</title>") || crumbs(body) != "Dashboard / Order / New" { t.Errorf("Expected the new page trail, got %q", crumbs(body)) }
+		if body := get("/admin/"); !strings.Contains(body, "<title>Dashboard — Go Admin</title>") { t.Error("Expected the dashboard title") }
+		if body := get("/admin/Reports"); !strings.Contains(body, "<title>Q3 report — Go Admin</title>") || crumbs(body) != "Dashboard / Reports / Q3" { t.Errorf("Expected custom page crumbs, got %q", crumbs(body)) }
+	})
+	t.Run("Branding", func(t *testing.T) {
+		bdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		bdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		bdb.Create(root)
+		bdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		breg := NewRegistry(bdb)
+		get := func(path string, signedIn bool) string {
+			req := httptest.NewRequest("GET", path, nil)
+			if signedIn { req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"}) }
+			rec := httptest.NewRecorder()
+			breg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		for _, body := range []string{get("/admin/login", false), get("/admin/", true)} {
+			if strings.Contains(body, `rel="icon"`) || strings.Contains(body, ":root {") || strings.Contains(body, "brand-logo") || strings.Contains(body, "login-message") || strings.Contains(body, "site-footer") {
+				t.Error("Expected no branding markup by default")
+			}
+		}
+		breg.Config.Branding = Branding{
+			LogoURL: "/static/logo.png", FaviconURL: "/static/favicon.ico", PrimaryColor: "#0f766e", AccentColor: "red; } body { display: none",
+			LoginMessage: "Use your <b>corporate</b> credentials", FooterHTML: "&copy; Acme Corp",
+		}
+		login := get("/admin/login", false)
+		for _, want := range []string{`<img src="/static/logo.png" alt="Go Admin" class="login-logo">`, `<div class="login-message">Use your <b>corporate</b> credentials</div>`, `<link rel="icon" href="/static/favicon.ico">`, "--primary: #0f766e;"} {
+			if !strings.Contains(login, want) { t.Errorf("Expected %s on the login page", want) }
+		}
+		if strings.Contains(login, "display: none") || strings.Contains(login, "--accent") { t.Error("Expected an invalid colour to be ignored") }
+		dash := get("/admin/", true)
+		if !strings.Contains(dash, `class="brand-logo"`) || !strings.Contains(dash, `<footer class="site-footer">&copy; Acme Corp</footer>`) || !strings.Contains(dash, "--primary-dark: color-mix(in srgb, #0f766e 85%, black);") { t.Error("Expected the logo, footer and colours in the layout") }
+		breg.Config.Branding = Branding{LogoURL: "javascript:alert(1)", AccentColor: "rgb(14, 165, 233)"}
+		dash = get("/admin/", true)
+		if strings.Contains(dash, "javascript:") || !strings.Contains(dash, "--accent: rgb(14, 165, 233);") { t.Error("Expected unsafe logo URLs to be filtered and rgb() colours accepted") }
+	})
+	t.Run("I18n", func(t *testing.T) {
+		idb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		idb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Customer{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin", Locale: "de"}
+		idb.Create(root)
+		idb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		ireg := NewRegistry(idb)
+		ireg.Register(Customer{}).RegisterModelFields().SetLabel("de", "", "Kunde").SetLabel("de", "Country", "Land")
+		ireg.SetTranslator(NewMapTranslator().Add("de", map[string]string{"Dashboard": "Übersicht", "New %s": "%s anlegen", "%s saved successfully": "%s gespeichert – schön", "Filters": "Filter"}))
+		do := func(method, path string, form url.Values, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for i := 0; i+1 < len(header); i += 2 { req.Header.Set(header[i], header[i+1]) }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			ireg.ServeHTTP(rec, req)
+			return rec
+		}
+		list := do("GET", "/admin/Customer", nil).Body.String()
+		for _, want := range []string{`<html lang="de">`, "Übersicht", "Kunde anlegen", ">Land</label>", "Filter</h4>", "Apply Filters", `<option value="de" selected>Deutsch</option>`} {
+			if !strings.Contains(list, want) { t.Errorf("Expected %q on the German list page", want) }
+		}
+		rec := do("POST", "/admin/Customer/save", url.Values{"Name": {"Acme"}})
+		var flash string
+		for _, c := range rec.Result().Cookies() { if c.Name == "admin_flash" { flash = c.Value } }
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+		req.AddCookie(&http.Cookie{Name: "admin_flash", Value: flash})
+		rec = httptest.NewRecorder()
+		ireg.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), "Kunde gespeichert – schön") { t.Errorf("Expected a translated flash to survive the cookie, got cookie %q", flash) }
+
+		// Other users follow their browser, and anything without a translation stays in English.
+		login := httptest.NewRecorder()
+		lreq := httptest.NewRequest("GET", "/admin/login", nil)
+		lreq.Header.Set("Accept-Language", "fr-CH, de;q=0.8")
+		ireg.ServeHTTP(login, lreq)
+		if body := login.Body.String(); !strings.Contains(body, `<html lang="de">`) || !strings.Contains(body, "Sign In") { t.Error("Expected the login page in German with English fallbacks") }
+		if got := ireg.T(withLocale(context.Background(), "de-AT"), "Dashboard"); got != "Übersicht" { t.Errorf("Expected de-AT to fall back to de, got %q", got) }
+
+		// Users switch language from the sidebar; unknown locales and offsite redirects are refused.
+		if code := do("POST", "/admin/account/locale", url.Values{"locale": {"xx"}}).Code; code != http.StatusBadRequest { t.Errorf("Expected an unknown locale to be refused, got %d", code) }
+		rec = do("POST", "/admin/account/locale", url.Values{"locale": {"en"}, "back": {"//evil.example"}})
+		if loc := rec.Header().Get("Location"); loc != "/admin/account" { t.Errorf("Expected the redirect to stay in the admin, got %q", loc) }
+		idb.First(root, root.ID)
+		if root.Locale != "en" { t.Errorf("Expected the locale saved, got %q", root.Locale) }
+		if body := do("GET", "/admin/Customer", nil).Body.String(); !strings.Contains(body, "+ New Customer") || !strings.Contains(body, ">Country</label>") { t.Error("Expected the English UI after switching back") }
+
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "es.json"), []byte(`{"Dashboard": "Panel"}`), 0o644)
+		tr, err := LoadTranslations(dir)
+		if err != nil || tr.T("es", "Dashboard") != "Panel" || !slices.Equal(tr.Locales(), []string{"es"}) { t.Errorf("Expected es.json to load, got %v", err) }
+	})
+
+	t.Run("AssociationPanels", func(t *testing.T) {
+		adb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		adb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Customer{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		adb.Create(root)
+		adb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		areg := NewRegistry(adb)
+		areg.Config.AssociationPerPage = 3
+		areg.Register(Customer{}).RegisterModelFields().HasMany("Orders", "Orders", "Order", "CustomerID")
+		areg.Register(Order{}).RegisterModelFields()
+		c := &Customer{Name: "Acme"}
+		adb.Create(c)
+		for i := 1; i <= 8; i++ { adb.Create(&Order{Name: fmt.Sprintf("order-%d", i), CustomerID: c.ID, Total: int64(i * 100)}) }
+		adb.Create(&Order{Name: "someone-elses", CustomerID: c.ID + 1})
+		show := func(query string) string {
+			req := httptest.NewRequest("GET", fmt.Sprintf("/admin/Customer/show?id=%d%s", c.ID, query), nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			areg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		body := show("")
+		if !strings.Contains(body, "Order (8)") || strings.Count(body, "/admin/Order/show?id=") != 3 { t.Error("Expected the total in the header and one page of orders") }
+		if !strings.Contains(body, "order-8") || strings.Contains(body, "order-5") { t.Error("Expected the newest orders first, as the Order list sorts") }
+		if !strings.Contains(body, fmt.Sprintf(`href="/admin/Order?eq_CustomerID=%d"`, c.ID)) { t.Error("Expected a view all link to the filtered list") }
+		if !strings.Contains(body, fmt.Sprintf(`href="/admin/Order/new?CustomerID=%d"`, c.ID)) { t.Error("Expected an add button prefilling the foreign key") }
+		if !strings.Contains(body, "Page 1 of 3") || !strings.Contains(body, "orders_page=2#assoc-Orders") { t.Error("Expected a next link paging the panel") }
+		body = show("&orders_page=3")
+		if !strings.Contains(body, "order-2") || !strings.Contains(body, "order-1") || strings.Contains(body, "order-3<") || !strings.Contains(body, "Page 3 of 3") { t.Error("Expected the last page of orders") }
+
+		// Children outside the user's row-level scope are neither listed nor counted.
+		areg.ScopeAll(func(user *AdminUser, res *Resource, db *gorm.DB) *gorm.DB {
+			if res.Name == "Order" { return db.Where("total >= ?", 500) }
+			return db
+		})
+		if body := show(""); !strings.Contains(body, "Order (4)") || strings.Contains(body, "order-4") { t.Error("Expected the panel to respect ScopeAll") }
+	})
+
+	t.Run("PageToolkit", func(t *testing.T) {
+		pdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		pdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		clerk := &AdminUser{Email: "clerk@example.com", Role: "clerk"}
+		pdb.Create(root); pdb.Create(clerk)
+		pdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		pdb.Create(&Session{ID: hashToken("clerk"), UserID: clerk.ID, Role: clerk.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		preg := NewRegistry(pdb)
+		preg.Register(Order{}).RegisterModelFields().SetIndexFields("Name", "Total")
+		for i := 1; i <= 5; i++ { pdb.Create(&Order{Name: fmt.Sprintf("big-%d", i), Total: 1000}) }
+		pdb.Create(&Order{Name: "small", Total: 5})
+		var seen *AdminUser
+		preg.AddUserPage("big-orders", "Reports", func(w http.ResponseWriter, r *http.Request, user *AdminUser) {
+			seen = user
+			opts := QueryOptionsFrom(r)
+			opts.Filters.Set("min_Total", "100")
+			opts.PerPage = 2
+			rows, total, err := preg.QueryResource(r, "Order", opts)
+			if errors.Is(err, ErrForbidden) { http.Error(w, "Forbidden", 403); return }
+			if err != nil { http.Error(w, err.Error(), 500); return }
+			res, _ := preg.GetResource("Order")
+			preg.RenderCustomPage(w, r, "Big orders", preg.RenderTable(res.GetFieldsFor("index"), rows)+preg.RenderPagination(preg.Pagination(r, opts, total)))
+		})
+		get := func(path, session string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			preg.ServeHTTP(rec, req)
+			return rec
+		}
+		body := get("/admin/big-orders?sort=Name&order=asc", "root").Body.String()
+		if seen == nil || seen.ID != root.ID { t.Error("Expected the page handler to receive the signed-in user") }
+		if !strings.Contains(body, `<a href="/admin/Order/show?id=1"`) || !strings.Contains(body, "big-2") || strings.Contains(body, "big-3") || strings.Contains(body, "small") {
+			t.Error("Expected the first page of filtered, sorted orders linking to their records")
+		}
+		if !strings.Contains(body, "Showing 1 of 3 (5 records)") || !strings.Contains(body, `href="?order=asc&amp;page=2&amp;sort=Name"`) { t.Error("Expected pagination keeping the page's query") }
+		if body := get("/admin/big-orders?page=3", "root").Body.String(); !strings.Contains(body, "big-1") || strings.Contains(body, "big-2") { t.Error("Expected the last page, newest first") }
+		if code := get("/admin/big-orders", "clerk").Code; code != http.StatusForbidden { t.Errorf("Expected QueryResource to refuse a role without list permission, got %d", code) }
+	})
+
+	t.Run("FieldVisibility", func(t *testing.T) {
+		vdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		vdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{})
+		for _, role := range []string{"clerk", "finance"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			vdb.Create(u)
+			vdb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+			for _, action := range []string{"list", "show", "edit", "save", "export"} { vdb.Create(&Permission{Role: role, ResourceName: "Order", Action: action}) }
+		}
+		vreg := NewRegistry(vdb)
+		vreg.Register(Order{}).RegisterModelFields().SetFieldType("Total", "number").SetFieldVisibleTo("Total", "finance")
+		o := &Order{Name: "Widgets", Total: 777}
+		vdb.Create(o)
+		vdb.Create(&Order{Name: "Gadgets", Total: 5})
+		do := func(method, path, session string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			vreg.ServeHTTP(rec, req)
+			return rec
+		}
+		show := fmt.Sprintf("/admin/Order/show?id=%d", o.ID)
+		if body := do("GET", show, "finance", nil).Body.String(); !strings.Contains(body, "777") { t.Error("Expected the finance role to see the total") }
+		for _, path := range []string{show, "/admin/Order", fmt.Sprintf("/admin/Order/edit?id=%d", o.ID)} {
+			if body := do("GET", path, "clerk", nil).Body.String(); strings.Contains(body, "777") || strings.Contains(body, `name="Total"`) || strings.Contains(body, "min_Total") { t.Errorf("Expected %s to leave out the total for clerks", path) }
+		}
+		if body := do("GET", "/admin/Order?min_Total=100", "clerk", nil).Body.String(); !strings.Contains(body, "Gadgets") { t.Error("Expected a filter on a hidden field to be ignored rather than leak it") }
+		for _, q := range []string{"min_total=100", "eq_total=5", "max_total=5"} {
+			if body := do("GET", "/admin/Order?"+q, "clerk", nil).Body.String(); !strings.Contains(body, "Gadgets") || !strings.Contains(body, "Widgets") { t.Errorf("Expected %s on the hidden field's column to be ignored", q) }
+		}
+		if body := do("GET", "/admin/Order?sort=total&order=desc", "clerk", nil).Body.String(); strings.Index(body, "Widgets") < strings.Index(body, "Gadgets") { t.Error("Expected sorting on the hidden field's column to be ignored") }
+		csv := do("GET", "/admin/Order/export", "clerk", nil).Body.String()
+		if !strings.Contains(csv, "Widgets") || strings.Contains(csv, "Total") || strings.Contains(csv, "777") { t.Errorf("Expected the export without the total, got %q", csv) }
+		if csv := do("GET", "/admin/Order/export", "finance", nil).Body.String(); !strings.Contains(csv, "777") { t.Error("Expected the finance export to include the total") }
+
+		// A crafted POST can't set, or blank, a field the user can't see.
+		do("POST", show[:len("/admin/Order/")]+fmt.Sprintf("save?id=%d", o.ID), "clerk", url.Values{"Name": {"Renamed"}, "Total": {"1"}})
+		var got Order
+		vdb.First(&got, o.ID)
+		if got.Name != "Renamed" || got.Total != 777 { t.Errorf("Expected the total to survive a clerk's save, got %+v", got) }
+		do("POST", fmt.Sprintf("/admin/Order/save?id=%d", o.ID), "finance", url.Values{"Name": {"Renamed"}, "Total": {"800"}})
+		got = Order{}
+		vdb.First(&got, o.ID)
+		if got.Total != 800 { t.Errorf("Expected finance to change the total, got %d", got.Total) }
+
+		// The picker search leaves a hidden Name out of both the match and the label, and needs the list permission.
+		res, _ := vreg.GetResource("Order")
+		res.SetFieldVisibleTo("Name", "finance")
+		if body := do("GET", "/admin/Order/search?q=Gad", "finance", nil).Body.String(); !strings.Contains(body, `"text":"Gadgets"`) || strings.Contains(body, "Renamed") { t.Errorf("Expected finance to search by name, got %s", body) }
+		if body := do("GET", "/admin/Order/search?q=", "clerk", nil).Body.String(); strings.Contains(body, "Gadgets") || strings.Contains(body, "Renamed") || !strings.Contains(body, `"text":"ID: `) { t.Errorf("Expected clerks to get records labelled by key, got %s", body) }
+		guest := &AdminUser{Email: "guest@example.com", Role: "guest", Active: true}
+		vdb.Create(guest)
+		vdb.Create(&Session{ID: hashToken("guest"), UserID: guest.ID, Role: guest.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		if rec := do("GET", "/admin/Order/search?q=", "guest", nil); rec.Code != 403 { t.Errorf("Expected a role without the list permission refused, got %d", rec.Code) }
+		for i := range res.Fields { if res.Fields[i].Name == "Name" { res.Fields[i].VisibleTo = nil } }
+
+		res.SetFieldVisible("Name", func(u *AdminUser) bool { return strings.HasSuffix(u.Email, "@example.com") })
+		for _, f := range res.Fields {
+			if f.Name == "Name" && (!f.VisibleFor(&AdminUser{Email: "x@example.com"}) || f.VisibleFor(&AdminUser{Email: "x@other.org"}) || !f.VisibleFor(&AdminUser{Email: "x@other.org", Role: "admin"}) || f.VisibleFor(nil)) {
+				t.Error("Expected SetFieldVisible to decide per user, with admins seeing everything")
+			}
+		}
+	})
+
+	t.Run("RecordMetadata", func(t *testing.T) {
+		mdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		mdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Memo{})
+		users := map[string]*AdminUser{}
+		for _, role := range []string{"admin", "clerk"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			mdb.Create(u)
+			users[role] = u
+			mdb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, action := range []string{"list", "show", "new", "edit", "save"} { mdb.Create(&Permission{Role: "clerk", ResourceName: "Memo", Action: action}) }
+		mreg := NewRegistry(mdb)
+		res := mreg.Register(Memo{}).TrackUserStamps("CreatedByID", "UpdatedByID").RegisterModelFields()
+		do := func(method, path, session string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			mreg.ServeHTTP(rec, req)
+			return rec
+		}
+		if body := do("GET", "/admin/Memo/new", "clerk", nil).Body.String(); strings.Contains(body, `name="CreatedByID"`) || strings.Contains(body, `name="UpdatedByID"`) { t.Error("Expected the stamp columns to stay off the form") }
+		do("POST", "/admin/Memo/save", "clerk", url.Values{"Title": {"Plan"}, "CreatedByID": {"999"}, "UpdatedByID": {"999"}})
+		var m Memo
+		mdb.First(&m)
+		if m.CreatedByID != users["clerk"].ID || m.UpdatedByID == nil || *m.UpdatedByID != users["clerk"].ID { t.Fatalf("Expected the creator stamped from the session, got %+v", m) }
+		do("POST", fmt.Sprintf("/admin/Memo/save?id=%d", m.ID), "admin", url.Values{"Title": {"Plan B"}, "CreatedByID": {"999"}})
+		m = Memo{}
+		mdb.First(&m)
+		if m.Title != "Plan B" || m.CreatedByID != users["clerk"].ID || *m.UpdatedByID != users["admin"].ID { t.Errorf("Expected the creator kept and the updater stamped, got %+v", m) }
+
+		show := fmt.Sprintf("/admin/Memo/show?id=%d", m.ID)
+		body := do("GET", show, "admin", nil).Body.String()
+		for _, want := range []string{`class="record-meta"`, "just now", `<time datetime="`, fmt.Sprintf(`href="/admin/users/show?id=%d">clerk@example.com</a>`, users["clerk"].ID), "admin@example.com"} {
+			if !strings.Contains(body, want) { t.Errorf("Expected the metadata panel to contain %q", want) }
+		}
+		if body := do("GET", show, "clerk", nil).Body.String(); !strings.Contains(body, "clerk@example.com") || strings.Contains(body, "/admin/users/show") { t.Error("Expected names without Users page links for non-admins") }
+		mdb.Delete(users["admin"])
+		if body := do("GET", show, "clerk", nil).Body.String(); !strings.Contains(body, fmt.Sprintf("User #%d", users["admin"].ID)) { t.Error("Expected a deleted user shown by id") }
+		res.HideMetadata()
+		if body := do("GET", show, "clerk", nil).Body.String(); strings.Contains(body, `class="record-meta"`) { t.Error("Expected HideMetadata to drop the panel") }
+	})
+
+	t.Run("ExportSelected", func(t *testing.T) {
+		edb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		edb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{})
+		for _, role := range []string{"clerk", "viewer"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			edb.Create(u)
+			edb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+			edb.Create(&Permission{Role: role, ResourceName: "Order", Action: "list"})
+		}
+		edb.Create(&Permission{Role: "clerk", ResourceName: "Order", Action: "export"})
+		ereg := NewRegistry(edb)
+		ereg.Register(Order{}).RegisterModelFields()
+		ereg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB { return q.Where("name <> ?", "Secret") })
+		var ids []string
+		for _, name := range []string{"Alpha", "Beta", "Gamma", "Secret"} {
+			o := &Order{Name: name}
+			edb.Create(o)
+			ids = append(ids, fmt.Sprint(o.ID))
+		}
+		post := func(session, query string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/admin/Order/export"+query, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			ereg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := post("clerk", "?visible_only=1&delimiter=semicolon", url.Values{"ids[]": {ids[0], ids[2], ids[3], "bogus"}})
+		body := rec.Body.String()
+		if !strings.Contains(body, "Alpha") || !strings.Contains(body, "Gamma") || strings.Contains(body, "Beta") || strings.Contains(body, "Secret") { t.Errorf("Expected only the selected rows in scope, got %q", body) }
+		if !strings.Contains(body, ";") { t.Error("Expected the chosen delimiter to apply") }
+		if want := "_selected_" + time.Now().Format("2006-01-02") + ".csv"; !strings.HasSuffix(rec.Header().Get("Content-Disposition"), "Order"+want) { t.Errorf("Expected a selected filename, got %q", rec.Header().Get("Content-Disposition")) }
+		if body := post("clerk", "?eq_Name=Alpha", url.Values{"ids[]": {ids[0], ids[1]}}).Body.String(); strings.Contains(body, "Beta") { t.Error("Expected the list's filters to still apply") }
+
+		rec = post("clerk", "?q_Name=a", nil)
+		if rec.Code != 303 || rec.Header().Get("Location") != "/admin/Order?q_Name=a" { t.Errorf("Expected an empty selection to go back to the list, got %d %q", rec.Code, rec.Header().Get("Location")) }
+		if strings.Contains(rec.Body.String(), "Alpha") { t.Error("Expected an empty selection not to export everything") }
+		if rec := post("viewer", "", url.Values{"ids[]": {ids[0]}}); rec.Code != 403 { t.Errorf("Expected export permission to be required, got %d", rec.Code) }
+	})
+
+	t.Run("JSONActions", func(t *testing.T) {
+		jdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		jdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{})
+		for _, role := range []string{"admin", "clerk"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			jdb.Create(u)
+			jdb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		jdb.Create(&Permission{Role: "clerk", ResourceName: "Order", Action: "show"})
+		jreg := NewRegistry(jdb)
+		var got *ActionContext
+		jreg.Register(Order{}).RegisterModelFields().
+			AddMemberJSONAction("resync", "Re-sync", func(ctx *ActionContext) (interface{}, error) {
+				got = ctx
+				if ctx.Params["Mode"] == "fail" { return nil, errors.New("ERP is unreachable") }
+				return ActionResult{Message: "Synced", Data: map[string]int{"lines": 3}}, nil
+			}).
+			SetActionParams("resync", Param("Mode", "Mode", "select", true, "full", "fail")).
+			SetActionVisible("resync", func(user *AdminUser, item map[string]interface{}) bool { return item["Name"] != "Locked" }).
+			AddCollectionJSONAction("recount", "Recount", func(ctx *ActionContext) (interface{}, error) { return 42, nil })
+		o, locked := &Order{Name: "Open"}, &Order{Name: "Locked"}
+		jdb.Create(o); jdb.Create(locked)
+		do := func(method, path, session string, form url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			jreg.ServeHTTP(rec, req)
+			var body map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			return rec, body
+		}
+		resync := fmt.Sprintf("/admin/Order/action?name=resync&id=%d", o.ID)
+		rec, body := do("POST", resync, "admin", url.Values{"Mode": {"full"}})
+		if rec.Code != 200 || body["ok"] != true || body["message"] != "Synced" || fmt.Sprint(body["data"]) != "map[lines:3]" { t.Fatalf("Expected the action's result, got %d %v", rec.Code, body) }
+		if got.ID != fmt.Sprint(o.ID) || len(got.IDs) != 1 || got.User.Email != "admin@example.com" || got.Params["Mode"] != "full" { t.Errorf("Expected the record, user and params in the context, got %+v", got) }
+		if rec, body := do("POST", resync, "admin", url.Values{"Mode": {"fail"}}); rec.Code != 422 || body["ok"] != false || body["message"] != "ERP is unreachable" { t.Errorf("Expected a failed action as a 422, got %d %v", rec.Code, body) }
+		if rec, body := do("POST", resync, "admin", nil); rec.Code != 422 || body["data"].(map[string]interface{})["Mode"] == nil { t.Errorf("Expected param errors by field, got %d %v", rec.Code, body) }
+		if rec, _ := do("GET", resync, "admin", nil); rec.Code != 405 { t.Errorf("Expected JSON actions to need POST, got %d", rec.Code) }
+		if rec, _ := do("POST", fmt.Sprintf("/admin/Order/action?name=resync&id=%d", locked.ID), "admin", url.Values{"Mode": {"full"}}); rec.Code != 403 { t.Errorf("Expected the Visible predicate to apply, got %d", rec.Code) }
+		if rec, _ := do("POST", "/admin/Order/action?name=resync&id=999", "admin", url.Values{"Mode": {"full"}}); rec.Code != 404 { t.Errorf("Expected a missing record to be a 404, got %d", rec.Code) }
+		if rec, _ := do("POST", resync, "clerk", url.Values{"Mode": {"full"}}); rec.Code != 403 { t.Errorf("Expected the action permission to be required, got %d", rec.Code) }
+		if rec, body := do("POST", "/admin/Order/collection_action?name=recount", "admin", nil); rec.Code != 200 || body["message"] != "Recount done" || body["data"] != float64(42) { t.Errorf("Expected a default message, got %v", body) }
+
+		rec, _ = do("GET", fmt.Sprintf("/admin/Order/show?id=%d", o.ID), "admin", nil)
+		if !strings.Contains(rec.Body.String(), fmt.Sprintf(`data-json-action="/admin/Order/action?name=resync&id=%d"`, o.ID)) { t.Error("Expected the show page to wire a button to the action") }
+		if rec, _ := do("GET", "/admin/Order", "admin", nil); !strings.Contains(rec.Body.String(), `data-json-action="/admin/Order/collection_action?name=recount"`) { t.Error("Expected the list page to wire a button to the collection action") }
+	})
+
+	t.Run("FormTokens", func(t *testing.T) {
+		fdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		freg := NewRegistry(fdb)
+		freg.Config.FormTokens = true
+		if err := freg.Migrate(); err != nil { t.Fatal(err) }
+		fdb.AutoMigrate(&Order{})
+		admin := &AdminUser{Email: "admin@example.com", Role: "admin", Active: true}
+		fdb.Create(admin)
+		fdb.Create(&Session{ID: hashToken("root"), UserID: admin.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		freg.Register(Order{}).RegisterModelFields()
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			freg.ServeHTTP(rec, req)
+			return rec
+		}
+		tokenRe := regexp.MustCompile(`name="_form_token" value="([0-9a-f]+)"`)
+		token := func(path string) string {
+			m := tokenRe.FindStringSubmatch(do("GET", path, nil).Body.String())
+			if m == nil { t.Fatalf("Expected a form token on %s", path) }
+			return m[1]
+		}
+
+		// The same POST twice, as a double click sends it: one record, and the replay lands on it.
+		form := url.Values{"Name": {"Once"}, "_form_token": {token("/admin/Order/new")}}
+		if rec := do("POST", "/admin/Order/save", form); rec.Code != 303 || rec.Header().Get("Location") != "/admin/Order" { t.Fatalf("Expected the first submit to save, got %d %q", rec.Code, rec.Header().Get("Location")) }
+		rec := do("POST", "/admin/Order/save", form)
+		var orders []Order
+		fdb.Find(&orders)
+		if len(orders) != 1 { t.Fatalf("Expected one record after a replay, got %d", len(orders)) }
+		if want := fmt.Sprintf("/admin/Order/show?id=%d", orders[0].ID); rec.Code != 303 || rec.Header().Get("Location") != want { t.Errorf("Expected the replay sent to %s, got %d %q", want, rec.Code, rec.Header().Get("Location")) }
+		var flash string
+		for _, c := range rec.Result().Cookies() { if c.Name == "admin_flash" { flash = c.Value } }
+		if !strings.Contains(flash, "already submitted") { t.Errorf("Expected the replay to be explained, got %q", flash) }
+
+		rec = do("POST", "/admin/Order/save", url.Values{"Name": {"Tokenless"}})
+		if body := rec.Body.String(); rec.Code != 422 || !strings.Contains(body, "This form has expired") || !strings.Contains(body, `value="Tokenless"`) || !tokenRe.MatchString(body) { t.Errorf("Expected a tokenless submit sent back to the form with a new token, got %d", rec.Code) }
+		fdb.Model(&FormToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+		if rec := do("POST", "/admin/Order/save", url.Values{"Name": {"Late"}, "_form_token": {form.Get("_form_token")}}); rec.Code != 422 { t.Errorf("Expected an expired token refused, got %d", rec.Code) }
+
+		edit := fmt.Sprintf("/admin/Order/edit?id=%d", orders[0].ID)
+		update := url.Values{"Name": {"Twice"}, "_form_token": {token(edit)}}
+		do("POST", fmt.Sprintf("/admin/Order/save?id=%d", orders[0].ID), update)
+		if rec := do("POST", fmt.Sprintf("/admin/Order/save?id=%d", orders[0].ID), update); rec.Code != 303 { t.Errorf("Expected a replayed update redirected, got %d", rec.Code) }
+		var logs int64
+		fdb.Model(&AuditLog{}).Where("action = ?", "Update").Count(&logs)
+		if logs != 1 { t.Errorf("Expected the update applied once, got %d audit entries", logs) }
+	})
+
+	t.Run("HealthAndDraining", func(t *testing.T) {
+		hdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		hdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &ExportJob{}, &WebhookDelivery{})
+		hreg := NewRegistry(hdb)
+		probe := func(path string) (int, map[string]string) {
+			rec := httptest.NewRecorder()
+			hreg.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			var body map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			return rec.Code, body
+		}
+		if code, body := probe("/admin/healthz"); code != 200 || body["status"] != "ok" || body["database"] != "ok" || body["templates"] != "ok" { t.Errorf("Expected a healthy report without signing in, got %d %v", code, body) }
+
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{define "content"}}{{if}}{{end}}`), 0o644)
+		hreg.Config.TemplateOverrideDir, hreg.Config.DevMode = dir, true
+		if code, body := probe("/admin/healthz"); code != 503 || body["templates"] != "invalid" || body["database"] != "ok" { t.Errorf("Expected a broken template reported, got %d %v", code, body) }
+		hreg.Config.TemplateOverrideDir = ""
+
+		// Background workers stop on BeginShutdown, and Close waits for them.
+		hreg.startExports()
+		hreg.AddWebhook(WebhookConfig{URL: "http://127.0.0.1:1/hook"})
+		if code, body := probe("/admin/readyz"); code != 200 || body["status"] != "ok" { t.Errorf("Expected ready, got %d %v", code, body) }
+		hreg.BeginShutdown()
+		if code, body := probe("/admin/readyz"); code != 503 || body["status"] != "draining" { t.Errorf("Expected draining after BeginShutdown, got %d %v", code, body) }
+		if code, _ := probe("/admin/healthz"); code != 200 { t.Errorf("Expected a draining instance still healthy, got %d", code) }
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := hreg.Close(ctx); err != nil { t.Errorf("Expected the workers to stop, got %v", err) }
+		started := false
+		hreg.goBackground(func(context.Context) { started = true })
+		if started { t.Error("Expected nothing to start after shutdown") }
+
+		sqlDB, _ := hdb.DB()
+		sqlDB.Close()
+		if code, body := probe("/admin/healthz"); code != 503 || body["database"] != "unavailable" || body["status"] != "error" { t.Errorf("Expected the database outage reported, got %d %v", code, body) }
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		type NoKey struct{ Name string }
+		type Secretive struct {
+			ID     uint
+			Name   string
+			secret string
+		}
+		vdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		vdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{})
+		fresh := func() *Registry { vreg := NewRegistry(vdb); vreg.Register(Customer{}).RegisterModelFields(); return vreg }
+		expect := func(t *testing.T, vreg *Registry, want string) {
+			t.Helper()
+			errs := vreg.Validate()
+			for _, err := range errs { if err.Error() == want { return } }
+			t.Errorf("Expected %q, got %v", want, errs)
+		}
+		if errs := fresh().Validate(); errs != nil { t.Fatalf("Expected a sound registry to validate, got %v", errs) }
+
+		t.Run("PrimaryKey", func(t *testing.T) {
+			vreg := fresh(); vreg.Register(NoKey{}).RegisterField("Name", "Name", false)
+			expect(t, vreg, "resource NoKey: model NoKey has no primary key; add an ID field or tag one `gorm:\"primaryKey\"`")
+		})
+		t.Run("UnknownAndUnexportedFields", func(t *testing.T) {
+			vreg := fresh(); vreg.Register(Secretive{}).RegisterField("ID", "ID", true).RegisterField("secret", "Secret", false).RegisterField("Nmae", "Name", false)
+			expect(t, vreg, `resource Secretive: field "secret" is unexported in Secretive and cannot be read or saved`)
+			expect(t, vreg, `resource Secretive: field "Nmae" is not a field of Secretive; did you mean 'Name'?`)
+		})
+		t.Run("DuplicateFields", func(t *testing.T) {
+			vreg := fresh(); vreg.Register(Order{}).RegisterField("Name", "Name", false).RegisterField("Name", "Title", false)
+			expect(t, vreg, `resource Order: field "Name" is registered more than once`)
+		})
+		t.Run("Associations", func(t *testing.T) {
+			vreg := fresh(); vreg.Register(Order{}).RegisterModelFields().BelongsTo("CustomerID", "Customer", "Customers", "ID").HasMany("Lines", "Lines", "Customer", "OrderID").BelongsTo("Buyer", "Buyer", "Customer", "")
+			expect(t, vreg, "resource Order: association CustomerID references unregistered resource 'Customers'; did you mean 'Customer'?")
+			expect(t, vreg, `resource Order: association Lines uses foreign key "OrderID", which is not a field of Customer`)
+			expect(t, vreg, "resource Order: association Buyer has no local key: Order has neither Buyer nor BuyerID")
+		})
+		t.Run("SearchableFields", func(t *testing.T) {
+			vreg := fresh()
+			vreg.Register(Order{}).RegisterModelFields().SetSearchable("CustomerID", "Custmer").AddVirtualField("Summary", "Summary", func(*gorm.DB, map[string]interface{}) interface{} { return "" }).SetSearchable("Summary", "Customer")
+			expect(t, vreg, "resource Order: searchable field \"CustomerID\" references unregistered resource 'Custmer'; did you mean 'Customer'?")
+			expect(t, vreg, `resource Order: searchable field "Summary" is virtual and has no column to search`)
+		})
+		t.Run("FieldLists", func(t *testing.T) {
+			vreg := fresh(); vreg.Register(Order{}).RegisterModelFields().SetIndexFields("ID", "Totl")
+			expect(t, vreg, `resource Order: index fields name unknown field "Totl"; did you mean 'Total'?`)
+		})
+		t.Run("StrictMode", func(t *testing.T) {
+			vreg := fresh(); vreg.Register(NoKey{}).RegisterField("Name", "Name", false)
+			rec := httptest.NewRecorder()
+			vreg.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/login", nil))
+			if rec.Code != 200 { t.Errorf("Expected problems only logged outside strict mode, got %d", rec.Code) }
+			vreg.Config.StrictValidation = true
+			rec = httptest.NewRecorder()
+			vreg.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/login", nil))
+			if rec.Code != 500 || !strings.Contains(rec.Body.String(), "The admin configuration is invalid") || !strings.Contains(rec.Body.String(), "model NoKey has no primary key") { t.Errorf("Expected strict mode to refuse with the problems listed, got %d %s", rec.Code, rec.Body.String()) }
+		})
+	})
+	t.Run("SaveAndContinue", func(t *testing.T) {
+		sdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sreg := NewRegistry(sdb)
+		if err := sreg.Migrate(); err != nil { t.Fatal(err) }
+		sdb.AutoMigrate(&Order{})
+		admin := &AdminUser{Email: "admin@example.com", Role: "admin", Active: true}
+		sdb.Create(admin)
+		sdb.Create(&Session{ID: hashToken("root"), UserID: admin.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		sreg.Register(Order{}).RegisterModelFields().SetStickyFields("CustomerID")
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			sreg.ServeHTTP(rec, req)
+			return rec
+		}
+		body := do("GET", "/admin/Order/new", nil).Body.String()
+		if !strings.Contains(body, `name="_then" value="continue"`) || !strings.Contains(body, `name="_then" value="another"`) { t.Error("Expected the form to offer continue-editing and add-another buttons") }
+
+		if rec := do("POST", "/admin/Order/save", url.Values{"Name": {"Plain"}}); rec.Header().Get("Location") != "/admin/Order" { t.Errorf("Expected a plain save back on the list, got %q", rec.Header().Get("Location")) }
+
+		// Continuing after a create goes to the new record's edit form, with the saved flash.
+		rec := do("POST", "/admin/Order/save", url.Values{"Name": {"Draft"}, "_then": {"continue"}})
+		var draft Order
+		sdb.Where("name = ?", "Draft").First(&draft)
+		if loc := rec.Header().Get("Location"); draft.ID == 0 || loc != fmt.Sprintf("/admin/Order/edit?id=%d", draft.ID) { t.Errorf("Expected the new record's edit form, got %q", loc) }
+		if c := rec.Result().Cookies(); len(c) == 0 || c[0].Name != "admin_flash" { t.Error("Expected a saved flash when continuing") }
+		if loc := do("POST", fmt.Sprintf("/admin/Order/save?id=%d", draft.ID), url.Values{"Name": {"Draft 2"}, "_then": {"continue"}}).Header().Get("Location"); loc != fmt.Sprintf("/admin/Order/edit?id=%d", draft.ID) { t.Errorf("Expected an update to continue on the same record, got %q", loc) }
+
+		// Adding another carries the sticky fields only, and the new form starts from them.
+		rec = do("POST", "/admin/Order/save", url.Values{"Name": {"First"}, "CustomerID": {"7"}, "Total": {"100"}, "_then": {"another"}})
+		if loc := rec.Header().Get("Location"); loc != "/admin/Order/new?CustomerID=7" { t.Fatalf("Expected a new form keeping CustomerID, got %q", loc) }
+		if body := do("GET", "/admin/Order/new?CustomerID=7", nil).Body.String(); !strings.Contains(body, `name="CustomerID" value="7"`) { t.Error("Expected the sticky value prefilled on the new form") }
+	})
+	t.Run("FieldHints", func(t *testing.T) {
+		hdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		hreg := NewRegistry(hdb)
+		if err := hreg.Migrate(); err != nil { t.Fatal(err) }
+		hdb.AutoMigrate(&Order{})
+		admin := &AdminUser{Email: "admin@example.com", Role: "admin", Active: true}
+		hdb.Create(admin)
+		hdb.Create(&Session{ID: hashToken("root"), UserID: admin.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		hreg.Register(Order{}).RegisterModelFields().
+			SetHelpText("Name", "Shown on <b>invoices</b>").SetPlaceholder("Name", "e.g. Spring restock").
+			SetHelpText("Total", template.HTML(`In cents, see <a href="/pricing">pricing</a>`)).SetPrefix("Total", "$").SetSuffix("Total", "¢")
+		hdb.Create(&Order{Name: "Hinted", Total: 5})
+		get := func(path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			hreg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		form := get("/admin/Order/new")
+		for _, want := range []string{
+			`<div class="field-help">Shown on &lt;b&gt;invoices&lt;/b&gt;</div>`,
+			`<div class="field-help">In cents, see <a href="/pricing">pricing</a></div>`,
+			`placeholder="e.g. Spring restock"`,
+			`<div class="input-adorned"><span>$</span><input type="text" name="Total" value="0"><span>¢</span></div>`,
+		} {
+			if !strings.Contains(form, want) { t.Errorf("Expected the form to contain %s", want) }
+		}
+		show := get("/admin/Order/show?id=1")
+		if !strings.Contains(show, `<span class="has-help" title="In cents, see pricing">Total</span>`) { t.Error("Expected help text as a plain tooltip on the show page label") }
+		if !strings.Contains(show, `title="Shown on &lt;b&gt;invoices&lt;/b&gt;"`) { t.Error("Expected escaped help text in the tooltip") }
+	})
+	t.Run("ConditionalFields", func(t *testing.T) {
+		type Shipment struct {
+			ID                               uint
+			Carrier, TrackingNumber, Courier string
+			Weight                           int
+		}
+		cdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		creg := NewRegistry(cdb)
+		if err := creg.Migrate(); err != nil { t.Fatal(err) }
+		cdb.AutoMigrate(&Shipment{})
+		admin := &AdminUser{Email: "admin@example.com", Role: "admin", Active: true}
+		cdb.Create(admin)
+		cdb.Create(&Session{ID: hashToken("root"), UserID: admin.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		res := creg.Register(Shipment{}).RegisterModelFields().
+			SetVisibleWhen("TrackingNumber", "Carrier", "ne", "pickup").
+			SetVisibleWhen("Courier", "TrackingNumber", "ne", "").
+			SetVisibleWhen("Weight", "Carrier", "in", "freight", "pallet")
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			creg.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// Pickup hides TrackingNumber, which hides Courier in turn; hidden input is neither saved nor checked.
+		if rec := do("POST", "/admin/Shipment/save", url.Values{"Carrier": {"pickup"}, "TrackingNumber": {"T1"}, "Courier": {"DHL"}, "Weight": {"heavy"}}); rec.Code != 303 { t.Fatalf("Expected hidden invalid input ignored, got %d %s", rec.Code, rec.Body.String()) }
+		if rec := do("POST", "/admin/Shipment/save", url.Values{"Carrier": {"post"}, "TrackingNumber": {"T2"}, "Courier": {"DHL"}, "Weight": {"heavy"}}); rec.Code != 303 { t.Fatalf("Expected the Weight validator skipped, got %d", rec.Code) }
+		var pickup, post Shipment
+		cdb.First(&pickup, 1); cdb.First(&post, 2)
+		if pickup.TrackingNumber != "" || pickup.Courier != "" || pickup.Weight != 0 { t.Errorf("Expected stale input on hidden fields dropped, got %+v", pickup) }
+		if post.TrackingNumber != "T2" || post.Courier != "DHL" { t.Errorf("Expected shown fields saved, got %+v", post) }
+		if rec := do("POST", "/admin/Shipment/save", url.Values{"Carrier": {"freight"}, "Weight": {"heavy"}}); rec.Code != 422 || !strings.Contains(rec.Body.String(), "is not a valid Weight") { t.Errorf("Expected a shown field still validated, got %d", rec.Code) }
+
+		// The show page leaves out fields whose condition fails for the record.
+		if body := do("GET", "/admin/Shipment/show?id=1", nil).Body.String(); strings.Contains(body, "Tracking Number") || strings.Contains(body, "Courier") { t.Error("Expected the pickup's tracking fields hidden on the show page") }
+		if body := do("GET", "/admin/Shipment/show?id=2", nil).Body.String(); !strings.Contains(body, "Courier") || strings.Contains(body, "Weight") { t.Error("Expected only the post shipment's shown fields on its show page") }
+
+		// The form carries the conditions for its script, and starts with failing fields hidden.
+		form := do("GET", "/admin/Shipment/edit?id=1", nil).Body.String()
+		if !strings.Contains(form, `data-field="TrackingNumber" data-show-when="{&#34;field&#34;:&#34;Carrier&#34;,&#34;negate&#34;:true,&#34;values&#34;:[&#34;pickup&#34;]}" hidden>`) { t.Error("Expected TrackingNumber rendered hidden with its condition") }
+
+		// A cycle resolves rather than recursing forever.
+		res.SetVisibleWhen("Carrier", "Courier", "eq", "DHL")
+		if hidden := res.HiddenByCondition(func(string) string { return "" }); !hidden["Carrier"] || !hidden["Weight"] { t.Errorf("Expected the cycle resolved, got %v", hidden) }
+	})
+	t.Run("EditLocks", func(t *testing.T) {
+		ldb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		lreg := NewRegistry(ldb)
+		lreg.Config.EditLocks = true
+		if err := lreg.Migrate(); err != nil { t.Fatal(err) }
+		ldb.AutoMigrate(&Order{})
+		for _, email := range []string{"alice@example.com", "bob@example.com"} {
+			u := &AdminUser{Email: email, Role: "admin", Active: true}
+			if email == "alice@example.com" { u.Name = "Alice Adams" }
+			ldb.Create(u)
+			ldb.Create(&Session{ID: hashToken(email), UserID: u.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		editor := &AdminUser{Email: "ed@example.com", Role: "editor", Active: true}
+		ldb.Create(editor)
+		ldb.Create(&Session{ID: hashToken("ed"), UserID: editor.ID, Role: "editor", ExpiresAt: time.Now().Add(time.Hour)})
+		lreg.Register(Order{}).RegisterModelFields()
+		ldb.Create(&Order{Name: "Shared"})
+		do := func(who, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: who})
+			rec := httptest.NewRecorder()
+			lreg.ServeHTTP(rec, req)
+			return rec
+		}
+		locks := func() (held []EditLock) { ldb.Order("user_email").Find(&held); return }
+
+		alice := do("alice@example.com", "GET", "/admin/Order/edit?id=1", nil).Body.String()
+		if strings.Contains(alice, "edit-lock-banner") || !strings.Contains(alice, `data-lock-url="/admin/Order/lock?id=1"`) { t.Error("Expected the first editor to get a heartbeat and no warning") }
+		bob := do("bob@example.com", "GET", "/admin/Order/edit?id=1", nil).Body.String()
+		since := locks()[0].CreatedAt.Format("15:04")
+		if !strings.Contains(bob, `<div class="edit-lock-banner">Alice Adams has been editing this record since `+since+`</div>`) { t.Error("Expected the second editor warned about the first by name") }
+
+		// The heartbeat extends the lock; a lapsed lock warns nobody.
+		ldb.Model(&EditLock{}).Where("user_email = ?", "alice@example.com").Update("expires_at", time.Now().Add(time.Second))
+		if rec := do("alice@example.com", "POST", "/admin/Order/lock?id=1", nil); rec.Code != 204 { t.Errorf("Expected the heartbeat accepted, got %d", rec.Code) }
+		if l := locks()[0]; time.Until(l.ExpiresAt) < 4*time.Minute { t.Errorf("Expected the heartbeat to extend the lock, expires %v", l.ExpiresAt) }
+		if rec := do("alice@example.com", "POST", "/admin/Order/lock?id=99", nil); rec.Code != 404 { t.Errorf("Expected no lock on a missing record, got %d", rec.Code) }
+		ldb.Model(&EditLock{}).Where("user_email = ?", "alice@example.com").Update("expires_at", time.Now().Add(-time.Minute))
+		if body := do("bob@example.com", "GET", "/admin/Order/edit?id=1", nil).Body.String(); strings.Contains(body, "edit-lock-banner") { t.Error("Expected an expired lock to warn nobody") }
+
+		// Locks are advisory: Bob saves anyway, which releases his lock only.
+		if rec := do("bob@example.com", "POST", "/admin/Order/save?id=1", url.Values{"Name": {"Bob's"}}); rec.Code != 303 { t.Fatalf("Expected the save allowed despite a lock, got %d", rec.Code) }
+		if held := locks(); len(held) != 1 || held[0].UserEmail != "alice@example.com" { t.Errorf("Expected the save to release the saver's lock, got %+v", held) }
+
+		// Admins list and clear locks; others may not.
+		if rec := do("ed", "GET", "/admin/locks", nil); rec.Code != 403 { t.Errorf("Expected the locks page for admins only, got %d", rec.Code) }
+		if body := do("bob@example.com", "GET", "/admin/locks", nil).Body.String(); !strings.Contains(body, "alice@example.com") || !strings.Contains(body, `class="lock-expired"`) { t.Error("Expected the stale lock listed as expired") }
+		do("alice@example.com", "GET", "/admin/Order/edit?id=1", nil)
+		do("bob@example.com", "GET", "/admin/Order/edit?id=1", nil)
+		if body := do("alice@example.com", "GET", "/admin/Order/edit?id=1", nil).Body.String(); !strings.Contains(body, "bob@example.com has been editing") { t.Error("Expected a holder without a name shown by email") }
+		ldb.Model(&EditLock{}).Where("user_email = ?", "bob@example.com").Update("expires_at", time.Now().Add(-time.Minute))
+		if rec := do("bob@example.com", "POST", "/admin/locks/clear", url.Values{"expired": {"1"}}); rec.Code != 303 { t.Errorf("Expected clearing to redirect, got %d", rec.Code) }
+		if held := locks(); len(held) != 1 || held[0].UserEmail != "alice@example.com" { t.Errorf("Expected only the expired lock cleared, got %+v", held) }
+		do("bob@example.com", "POST", "/admin/locks/clear", url.Values{"id": {fmt.Sprint(locks()[0].ID)}})
+		if held := locks(); len(held) != 0 { t.Errorf("Expected the lock cleared by id, got %+v", held) }
+
+		// Leaving the page releases the lock.
+		do("alice@example.com", "GET", "/admin/Order/edit?id=1", nil)
+		if rec := do("alice@example.com", "POST", "/admin/Order/unlock?id=1", nil); rec.Code != 204 || len(locks()) != 0 { t.Errorf("Expected the release to drop the lock, got %d", rec.Code) }
+	})
+	t.Run("JSONFieldSelection", func(t *testing.T) {
+		jdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		jdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{}, &Customer{})
+		for _, role := range []string{"admin", "clerk"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			jdb.Create(u)
+			jdb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, action := range []string{"list", "show"} { jdb.Create(&Permission{Role: "clerk", ResourceName: "Order", Action: action}) }
+		jreg := NewRegistry(jdb)
+		jreg.Register(Customer{}).RegisterModelFields()
+		orders := jreg.Register(Order{}).RegisterModelFields().BelongsTo("CustomerID", "Customer", "Customer", "").SetFieldVisibleTo("Total", "admin")
+		acme, globex := &Customer{Name: "Acme", Country: "DE"}, &Customer{Name: "Globex", Country: "US"}
+		jdb.Create(acme); jdb.Create(globex)
+		jdb.Create(&Order{Name: "A1", CustomerID: acme.ID, Total: 4242})
+		jdb.Create(&Order{Name: "A2", CustomerID: acme.ID, Total: 4242})
+		jdb.Create(&Order{Name: "G1", CustomerID: globex.ID, Total: 4242})
+		jdb.Create(&Order{Name: "None", Total: 4242})
+		get := func(session, path string) (int, map[string]interface{}, string) {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			jreg.ServeHTTP(rec, req)
+			var body map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			return rec.Code, body, rec.Body.String()
+		}
+		meta := func(body map[string]interface{}, key string) interface{} { return body["meta"].(map[string]interface{})[key] }
+
+		code, body, raw := get("admin", "/admin/Order?format=json&fields=Name,Total&sort=Name")
+		rows, _ := body["data"].([]interface{})
+		if code != 200 || len(rows) != 4 || meta(body, "total").(float64) != 4 { t.Fatalf("Expected every order listed, got %d %s", code, raw) }
+		if first := rows[0].(map[string]interface{}); len(first) != 3 || first["Name"] != "A1" || first["Total"].(float64) != 4242 || first["id"] == nil { t.Errorf("Expected only id and the selected fields, got %v", first) }
+		if fmt.Sprint(meta(body, "fields")) != "[Name Total]" || fmt.Sprint(meta(body, "warnings")) != "[]" { t.Errorf("Expected the selection in meta, got %v", body["meta"]) }
+
+		// Selecting a field the role may not see behaves exactly like an unknown one.
+		for _, path := range []string{"/admin/Order?format=json&fields=Name,Total,Bogus", "/admin/Order/show?id=1&format=json&fields=Name,Total,Bogus", "/admin/Order?format=json", "/admin/Order/show?id=1&format=json"} {
+			code, body, raw := get("clerk", path)
+			if code != 200 || strings.Contains(raw, "4242") || strings.Contains(fmt.Sprint(meta(body, "fields")), "Total") { t.Errorf("Expected %s to keep the total from clerks, got %d %s", path, code, raw) }
+			if strings.Contains(path, "fields=") && fmt.Sprint(meta(body, "warnings")) != `[unknown field "Total" unknown field "Bogus"]` { t.Errorf("Expected the same warning for hidden and unknown fields, got %v", meta(body, "warnings")) }
+		}
+
+		// Includes load each association's records in one query, not one per row.
+		queries := 0
+		jdb.Callback().Query().After("gorm:query").Register("count_customers", func(db *gorm.DB) { if db.Statement.Table == "customers" { queries++ } })
+		_, body, raw = get("admin", "/admin/Order?format=json&fields=Name&include=Customer&sort=Name")
+		rows = body["data"].([]interface{})
+		if queries != 1 { t.Errorf("Expected one batched query for the customers, got %d", queries) }
+		if c, _ := rows[0].(map[string]interface{})["Customer"].(map[string]interface{}); c == nil || c["Name"] != "Acme" || c["Country"] != "DE" { t.Errorf("Expected the customer embedded, got %s", raw) }
+		if c := rows[1].(map[string]interface{})["Customer"]; c.(map[string]interface{})["Name"] != "Acme" { t.Errorf("Expected the second Acme order to share the customer, got %v", c) }
+		if c, ok := rows[3].(map[string]interface{})["Customer"]; !ok || c != nil { t.Errorf("Expected null for an order without a customer, got %v", c) }
+		if fmt.Sprint(meta(body, "include")) != "[Customer]" { t.Errorf("Expected the include in meta, got %v", body["meta"]) }
+		_, body, _ = get("admin", "/admin/Order/show?id=3&format=json&include=CustomerID")
+		if c := body["data"].(map[string]interface{})["CustomerID"].(map[string]interface{}); c["Name"] != "Globex" { t.Errorf("Expected include on the show endpoint, got %v", c) }
+
+		// Includes need the key field and the target: a clerk without Customer access gets a warning, not data.
+		_, body, raw = get("clerk", "/admin/Order?format=json&include=Customer,Nope")
+		if strings.Contains(raw, "Acme") || fmt.Sprint(meta(body, "warnings")) != `[unknown association "Customer" unknown association "Nope"]` { t.Errorf("Expected the include refused, got %s", raw) }
+		jdb.Create(&Permission{Role: "clerk", ResourceName: "Customer", Action: "show"})
+		orders.SetFieldVisibleTo("CustomerID", "admin")
+		if _, _, raw = get("clerk", "/admin/Order?format=json&include=Customer"); strings.Contains(raw, "Acme") { t.Error("Expected a hidden key field to block the include") }
+		orders.SetFieldVisibleTo("CustomerID")
+		if _, _, raw = get("clerk", "/admin/Order?format=json&include=Customer"); !strings.Contains(raw, "Acme") { t.Errorf("Expected the include once both are visible, got %s", raw) }
+	})
+	t.Run("BulkCreate", func(t *testing.T) {
+		bdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		bdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{})
+		for _, role := range []string{"admin", "viewer"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			bdb.Create(u)
+			bdb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		breg := NewRegistry(bdb)
+		breg.Config.BulkMaxRecords, breg.Config.BulkBatchSize = 5, 2
+		hooked := 0
+		breg.Register(Order{}).RegisterModelFields().OnBeforeSave(func(db *gorm.DB, user *AdminUser, item interface{}, isNew bool) error {
+			hooked++
+			if item.(*Order).Name == "reject" { return errors.New("rejected by hook") }
+			return nil
+		})
+		post := func(session, path, body string) (int, map[string]interface{}, string) {
+			req := httptest.NewRequest("POST", path, strings.NewReader(body))
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			breg.ServeHTTP(rec, req)
+			var out map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &out)
+			return rec.Code, out, rec.Body.String()
+		}
+		count := func() (n int64) { bdb.Model(&Order{}).Count(&n); return }
+		batch := `[{"Name":"a","Total":1},{"Name":"b","Total":"2"},{"Name":"c","Total":"lots"},{"Name":"reject"},{"Name":"e","Total":5}]`
+
+		// Without continue_on_error the first bad record rolls back every insert, earlier batches included.
+		code, out, raw := post("admin", "/admin/api/Order/bulk", batch)
+		if code != 422 || count() != 0 || !strings.Contains(raw, `"index":2`) || !strings.Contains(raw, `is not a valid Total`) { t.Fatalf("Expected a rollback reporting record 2, got %d %s (%d saved)", code, raw, count()) }
+
+		code, out, raw = post("admin", "/admin/api/Order/bulk?continue_on_error=true", batch)
+		if code != 200 || out["created"].(float64) != 3 || out["failed"].(float64) != 2 || count() != 3 { t.Fatalf("Expected three created and two skipped, got %d %s", code, raw) }
+		results := out["results"].([]interface{})
+		for i, want := range []string{"id", "id", "errors", "errors", "id"} {
+			if r := results[i].(map[string]interface{}); r[want] == nil || r["index"].(float64) != float64(i) { t.Errorf("Expected result %d to carry %s, got %v", i, want, r) }
+		}
+		if errs := results[3].(map[string]interface{})["errors"].(map[string]interface{}); errs["record"] != "rejected by hook" { t.Errorf("Expected the hook's error, got %v", errs) }
+		var b Order
+		bdb.Where("name = ?", "b").First(&b)
+		if b.Total != 2 || hooked == 0 { t.Errorf("Expected string values coerced and hooks run, got %+v", b) }
+		var audits []AuditLog
+		bdb.Where("resource_name = ?", "Order").Find(&audits)
+		if len(audits) != 1 || audits[0].Action != "Bulk create" || audits[0].Changes != "Created 3 of 5 records; 2 failed" { t.Errorf("Expected one summary audit entry, got %+v", audits) }
+
+		if code, _, raw = post("admin", "/admin/api/Order/bulk", `[{"Nmae":"x"}]`); code != 422 || !strings.Contains(raw, "unknown field") { t.Errorf("Expected unknown keys rejected, got %d %s", code, raw) }
+		if code, _, _ = post("admin", "/admin/api/Order/bulk", `[{},{},{},{},{},{}]`); code != 413 { t.Errorf("Expected the record cap enforced, got %d", code) }
+		if code, _, _ = post("viewer", "/admin/api/Order/bulk", `[{"Name":"x"}]`); code != 403 { t.Errorf("Expected roles without new permission refused, got %d", code) }
+		if code, _, _ = post("", "/admin/api/Order/bulk", `[]`); code != 401 { t.Errorf("Expected a JSON 401 when signed out, got %d", code) }
+		if count() != 3 { t.Errorf("Expected the refused requests to save nothing, got %d orders", count()) }
+	})
+	t.Run("NavigationVisibility", func(t *testing.T) {
+		ndb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		ndb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Order{}, &Customer{})
+		for _, role := range []string{"admin", "viewer"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			ndb.Create(u)
+			ndb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		ndb.Create(&Permission{Role: "viewer", ResourceName: "Customer", Action: "list"})
+		nreg := NewRegistry(ndb)
+		nreg.Config.AutoResourceStats = true
+		nreg.Register(Customer{}).RegisterModelFields()
+		nreg.Register(Order{}).RegisterModelFields().SetGroup("Sales")
+		page := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("page body")) }
+		nreg.AddPage("Help", "", page)
+		nreg.AddPage("Payroll", "Finance", page).VisibleTo = []string{"accountant"}
+		nreg.AddChart("Revenue chart", "bar", func(db *gorm.DB) ([]string, []float64) { return []string{"Q1"}, []float64{1} }).VisibleTo = []string{"accountant"}
+		nreg.AddStat("Margin stat", func(db *gorm.DB) (int64, error) { return 7, nil }).VisibleTo = []string{"accountant"}
+		nreg.AddDashboardWidget("Cash panel", func(*AdminUser) template.HTML { return "cash" }).VisibleTo = []string{"accountant"}
+		get := func(session, path string) (int, string) {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			nreg.ServeHTTP(rec, req)
+			return rec.Code, rec.Body.String()
+		}
+		forbidden := []string{"Order", "Sales", "Payroll", "Finance", "Revenue chart", "Margin stat", "Cash panel"}
+
+		code, body := get("admin", "/admin/")
+		for _, name := range forbidden { if !strings.Contains(body, name) { t.Errorf("Expected admins to see %s on the dashboard", name) } }
+		code, body = get("viewer", "/admin/")
+		if code != 200 || !strings.Contains(body, "Customer") || !strings.Contains(body, "Help") { t.Fatalf("Expected the viewer's dashboard with Customer and Help, got %d", code) }
+		for _, name := range forbidden { if strings.Contains(body, name) { t.Errorf("Expected %s left off the viewer's dashboard", name) } }
+		if _, body = get("viewer", "/admin/Customer"); strings.Contains(body, "Order") || strings.Contains(body, "Payroll") { t.Error("Expected the navigation filtered on every page") }
+
+		// Hidden entries stay closed when addressed directly.
+		if code, _ = get("viewer", "/admin/Payroll"); code != 403 { t.Errorf("Expected a restricted page refused, got %d", code) }
+		if code, _ = get("viewer", "/admin/Help"); code != 200 { t.Errorf("Expected an open page served, got %d", code) }
+		if code, _ = get("viewer", "/admin/charts/0/data"); code != 404 { t.Errorf("Expected a restricted chart's data refused, got %d", code) }
+		if code, _ = get("viewer", "/admin/Order"); code != 403 { t.Errorf("Expected the permission check to still apply, got %d", code) }
+	})
+	t.Run("BatchJobActions", func(t *testing.T) {
+		bdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := bdb.DB(); sqlDB.SetMaxOpenConns(1)
+		bdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &BatchJob{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin"}
+		bdb.Create(root)
+		bdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		breg := NewRegistry(bdb)
+		breg.Config.BatchJobSize, breg.Config.BatchJobThreshold = 2, 3
+		var calls [][]string
+		breg.Register(Order{}).RegisterModelFields().AddBatchJobAction("remind", "Send reminder", func(ctx *BatchContext) error {
+			calls = append(calls, ctx.IDs)
+			for _, id := range ctx.IDs {
+				if id == "3" { ctx.Fail(id, errors.New("no email")); continue }
+				bdb.Model(&Order{}).Where("id = ?", id).Update("total", 1)
+			}
+			return ctx.Context.Err()
+		}).AddBatchAction("legacy", "Legacy", func(res *Resource, ids []string, w http.ResponseWriter, r *http.Request) {})
+		for i := 1; i <= 7; i++ {
+			name := "fresh"
+			if i <= 5 { name = "stale" }
+			bdb.Create(&Order{Name: name})
+		}
+		post := func(path, form string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", path, strings.NewReader(form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			breg.ServeHTTP(rec, req)
+			return rec
+		}
+		reminded := func() (n int64) { bdb.Model(&Order{}).Where("total = 1").Count(&n); return }
+		req := httptest.NewRequest("GET", "/admin/Order?per_page=2", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+		list := httptest.NewRecorder(); breg.ServeHTTP(list, req)
+		if !strings.Contains(list.Body.String(), "Select all 7 matching records") { t.Errorf("Expected the list to offer selecting all matching records, got %d", list.Code) }
+
+		// A small selection runs in the request, in batches.
+		rec := post("/admin/Order/batch_action", "action_name=remind&ids=1&ids=2&ids=3")
+		if rec.Code != 303 || len(calls) != 2 || reminded() != 2 { t.Fatalf("Expected two batches run in the request, got %d %v", rec.Code, calls) }
+		if flash := rec.Header().Get("Set-Cookie"); !strings.Contains(flash, "2 of 3 records done") || !strings.Contains(flash, "no email") { t.Errorf("Expected the outcome flashed, got %s", flash) }
+
+		// "All matching" queues a job over the filter's records, keyset by primary key.
+		bdb.Model(&Order{}).Where("1 = 1").Update("total", 0)
+		calls = nil
+		rec = post("/admin/Order/batch_action", "action_name=remind&all_matching=1&query="+url.QueryEscape("q_Name=stale&page=2"))
+		if rec.Code != 303 || rec.Header().Get("Location") != "/admin/jobs" { t.Fatalf("Expected a redirect to the jobs page, got %d %s", rec.Code, rec.Header().Get("Location")) }
+		var job BatchJob
+		for i := 0; i < 200 && job.Status != "done"; i++ { time.Sleep(5 * time.Millisecond); job = BatchJob{}; bdb.Last(&job) }
+		if job.Status != "done" || job.Total != 5 || job.Processed != 5 || job.Failed != 1 || job.Failures != "#3: no email" || job.Progress() != 100 { t.Fatalf("Expected a finished job, got %+v", job) }
+		if len(calls) != 3 || reminded() != 4 { t.Errorf("Expected three batches over the four stale orders that could be reminded, got %v and %d", calls, reminded()) }
+		req = httptest.NewRequest("GET", "/admin/jobs", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+		page := httptest.NewRecorder(); breg.ServeHTTP(page, req)
+		if body := page.Body.String(); !strings.Contains(body, "Send reminder") || !strings.Contains(body, "5 / 5") { t.Errorf("Expected the job's progress listed") }
+
+		// Large explicit selections go to the queue too; a queued job can be cancelled before a worker claims it.
+		queued := BatchJob{UserID: root.ID, ResourceName: "Order", ActionName: "remind", ActionLabel: "Send reminder", IDs: "6\n7", Status: "queued", CreatedAt: time.Now()}
+		bdb.Create(&queued)
+		post("/admin/jobs/cancel", fmt.Sprintf("id=%d", queued.ID))
+		breg.runBatchJob(queued.ID)
+		bdb.First(&queued, queued.ID)
+		if queued.Status != "cancelled" || queued.Processed != 0 { t.Errorf("Expected the job cancelled and never run, got %+v", queued) }
+		if rec := post("/admin/Order/batch_action", "action_name=remind&ids=4&ids=5&ids=6&ids=7"); rec.Header().Get("Location") != "/admin/jobs" { t.Errorf("Expected a selection over the threshold queued, got %s", rec.Header().Get("Location")) }
+		job = BatchJob{}
+		for i := 0; i < 200 && job.Status != "done"; i++ { time.Sleep(5 * time.Millisecond); job = BatchJob{}; bdb.Last(&job) }
+		if job.Status != "done" || job.Processed != 4 || reminded() != 6 { t.Errorf("Expected the queued selection run, got %+v", job) }
+		qreg := NewRegistry(bdb)
+		qreg.batchJobs.queue = make(chan uint)
+		refused := BatchJob{UserID: root.ID, ResourceName: "Order", ActionName: "remind", IDs: "6", Status: "queued", CreatedAt: time.Now()}
+		bdb.Create(&refused)
+		qreg.batchJobs.enqueue(qreg, refused.ID)
+		bdb.First(&refused, refused.ID)
+		if refused.Status != "failed" || refused.Error != "queue full" { t.Errorf("Expected a job refused by the queue to be failed, got %+v", refused) }
+
+		// Actions that take a response writer can't run on records that aren't on the page.
+		if rec := post("/admin/Order/batch_action", "action_name=legacy&all_matching=1&query="); !strings.Contains(rec.Header().Get("Set-Cookie"), "only runs on the selected records") { t.Error("Expected all matching refused for a plain batch action") }
+	})
+	t.Run("TrashPurge", func(t *testing.T) {
+		type Note struct {
+			ID        uint
+			Title     string
+			Photo     string
+			DeletedAt gorm.DeletedAt
+		}
+		pdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := pdb.DB(); sqlDB.SetMaxOpenConns(1)
+		pdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Note{})
+		for _, role := range []string{"admin", "editor"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			pdb.Create(u)
+			pdb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		pdb.Create(&Permission{Role: "editor", ResourceName: "Note", Action: "list"})
+		preg := NewRegistry(pdb)
+		preg.Config.UploadDir = t.TempDir()
+		preg.Register(Note{}).RegisterModelFields().SetFieldType("Photo", "image").TrashRetention(30)
+		os.WriteFile(filepath.Join(preg.Config.UploadDir, "old.png"), []byte("png"), 0o644)
+		os.WriteFile(filepath.Join(preg.Config.UploadDir, "kept.png"), []byte("png"), 0o644)
+		trash := func(title, photo string, age time.Duration) {
+			n := &Note{Title: title, Photo: photo}
+			pdb.Create(n)
+			if age > 0 { pdb.Model(n).Update("deleted_at", time.Now().Add(-age)) }
+		}
+		trash("expired", "/admin/uploads/old.png", 40*24*time.Hour)
+		trash("recent", "/admin/uploads/kept.png", 2*24*time.Hour)
+		trash("live", "", 0)
+		do := func(session, method, path, form string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form))
+			if form != "" { req.Header.Set("Content-Type", "application/x-www-form-urlencoded") }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			preg.ServeHTTP(rec, req)
+			return rec
+		}
+		remaining := func() (n int64) { pdb.Unscoped().Model(&Note{}).Count(&n); return }
+
+		if body := do("admin", "GET", "/admin/Note", "").Body.String(); !strings.Contains(body, "Purge trash now") { t.Error("Expected admins offered the purge on the list") }
+		if body := do("editor", "GET", "/admin/Note", "").Body.String(); strings.Contains(body, "Purge trash now") { t.Error("Expected the purge hidden from other roles") }
+		if rec := do("editor", "POST", "/admin/Note/purge_trash", "confirm=1"); rec.Code != 403 || remaining() != 3 { t.Errorf("Expected other roles refused, got %d", rec.Code) }
+		if rec := do("admin", "GET", "/admin/Note/purge_trash", ""); rec.Code != 200 || !strings.Contains(rec.Body.String(), "1 records have been in the trash for more than 30 days") || remaining() != 3 { t.Errorf("Expected a confirmation first, got %d", rec.Code) }
+
+		rec := do("admin", "POST", "/admin/Note/purge_trash", "confirm=1")
+		if rec.Code != 303 || remaining() != 2 { t.Fatalf("Expected only the expired note purged, got %d with %d left", rec.Code, remaining()) }
+		if _, err := os.Stat(filepath.Join(preg.Config.UploadDir, "old.png")); !os.IsNotExist(err) { t.Error("Expected the purged note's upload removed") }
+		if _, err := os.Stat(filepath.Join(preg.Config.UploadDir, "kept.png")); err != nil { t.Error("Expected uploads of notes still in the trash kept") }
+		var entry AuditLog
+		pdb.Where("action = ?", "Purge trash").First(&entry)
+		if entry.UserEmail != "admin@example.com" || entry.Changes != "Permanently deleted 1 records trashed more than 30 days ago" { t.Errorf("Expected the purge audited, got %+v", entry) }
+
+		// The scheduled purger runs at once, audits as the system, and stops with Close.
+		pdb.Unscoped().Model(&Note{}).Where("title = ?", "recent").Update("deleted_at", time.Now().Add(-31*24*time.Hour))
+		preg.StartTrashPurger(time.Hour)
+		for i := 0; i < 200 && remaining() != 1; i++ { time.Sleep(5 * time.Millisecond) }
+		if remaining() != 1 { t.Fatalf("Expected the purger to remove the newly expired note, %d left", remaining()) }
+		var count int64
+		for i := 0; i < 200 && count == 0; i++ { time.Sleep(5 * time.Millisecond); pdb.Model(&AuditLog{}).Where("action = ? AND user_email = ?", "Purge trash", "system").Count(&count) }
+		if count != 1 { t.Errorf("Expected one system audit entry for the run, got %d", count) }
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := preg.Close(ctx); err != nil { t.Errorf("Expected the purger to stop on Close, got %v", err) }
+	})
+	t.Run("PermissionsAsCode", func(t *testing.T) {
+		pdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		preg := NewRegistry(pdb)
+		var logs bytes.Buffer
+		preg.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+		pdb.AutoMigrate(&Permission{})
+		pdb.Create(&Permission{Role: "editor", ResourceName: "Order", Action: "delete"})
+		pdb.Create(&Permission{Role: "support", ResourceName: "Order", Action: "list"})
+		preg.DefineRole("editor", Grant{"Product": {"list", "show", "edit"}, "Order": {"list", "show", "list"}})
+		grants := func(role string) (out []string) {
+			var perms []Permission
+			pdb.Where("role = ?", role).Order("resource_name, action").Find(&perms)
+			for _, p := range perms { out = append(out, p.ResourceName+":"+p.Action) }
+			return
+		}
+		if err := preg.Migrate(); err != nil { t.Fatal(err) }
+		if got := strings.Join(grants("editor"), ","); got != "Order:delete,Order:list,Order:show,Product:edit,Product:list,Product:show" { t.Errorf("Expected missing grants created and extras kept, got %s", got) }
+		if n := strings.Count(logs.String(), "permission granted"); n != 5 { t.Errorf("Expected each grant logged, got %d:\n%s", n, logs.String()) }
+
+		logs.Reset()
+		preg.Config.PrunePermissions = true
+		if err := preg.ReconcilePermissions(); err != nil { t.Fatal(err) }
+		if got := strings.Join(grants("editor"), ","); got != "Order:list,Order:show,Product:edit,Product:list,Product:show" { t.Errorf("Expected the extra grant pruned, got %s", got) }
+		if len(grants("support")) != 1 { t.Error("Expected undefined roles left alone") }
+		if !strings.Contains(logs.String(), "permission revoked") || !strings.Contains(logs.String(), "action=delete") { t.Errorf("Expected the revocation logged, got %s", logs.String()) }
+		logs.Reset()
+		if err := preg.ReconcilePermissions(); err != nil || logs.Len() != 0 { t.Errorf("Expected reconciling again to change nothing, got %v %s", err, logs.String()) }
+
+		var dump bytes.Buffer
+		if err := preg.ExportPermissions(&dump); err != nil { t.Fatal(err) }
+		want := `{
+  "version": 1,
+  "roles": {
+    "editor": {
+      "Order": [
+        "list",
+        "show"
+      ],
+      "Product": [
+        "edit",
+        "list",
+        "show"
+      ]
+    },
+    "support": {
+      "Order": [
+        "list"
+      ]
+    }
+  }
+}
+`
+		if dump.String() != want { t.Errorf("Expected a stable dump, got\n%s", dump.String()) }
+
+		// Applying the dump to another environment reproduces it, without touching roles it doesn't list.
+		prod, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		prod.AutoMigrate(&Permission{})
+		prod.Create(&Permission{Role: "support", ResourceName: "Order", Action: "delete"})
+		prod.Create(&Permission{Role: "auditor", ResourceName: "Order", Action: "list"})
+		rreg := NewRegistry(prod)
+		rreg.Config.PrunePermissions = true
+		rreg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		if err := rreg.ImportPermissions(strings.NewReader(dump.String())); err != nil { t.Fatal(err) }
+		var again bytes.Buffer
+		rreg.ExportPermissions(&again)
+		if !strings.Contains(again.String(), `"auditor"`) || strings.Replace(again.String(), "    \"auditor\": {\n      \"Order\": [\n        \"list\"\n      ]\n    },\n", "", 1) != want { t.Errorf("Expected the import to reproduce the dump, got\n%s", again.String()) }
+		for _, bad := range []string{`{"version": 2, "roles": {}}`, `{"version": 1, "roles": {"x": {"Order": [""]}}}`, `{"version": 1, "rules": {}}`, `[`} {
+			if err := rreg.ImportPermissions(strings.NewReader(bad)); err == nil { t.Errorf("Expected %s rejected", bad) }
+		}
+	})
+	t.Run("InlineEdit", func(t *testing.T) {
+		type Ticket struct {
+			ID        uint
+			Title     string
+			Status    string
+			Priority  int
+			Notes     string
+			Owner     string
+			UpdatedAt time.Time
+		}
+		idb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := idb.DB(); sqlDB.SetMaxOpenConns(1)
+		idb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Ticket{})
+		for _, role := range []string{"admin", "editor", "viewer"} {
+			u := &AdminUser{Email: role + "@example.com", Role: role, Active: true}
+			idb.Create(u)
+			idb.Create(&Session{ID: hashToken(role), UserID: u.ID, Role: role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, a := range []string{"list", "edit"} { idb.Create(&Permission{Role: "editor", ResourceName: "Ticket", Action: a}) }
+		idb.Create(&Permission{Role: "viewer", ResourceName: "Ticket", Action: "list"})
+		ireg := NewRegistry(idb)
+		ireg.Register(Ticket{}).RegisterModelFields().SetFieldType("Status", "select", "open", "closed").SetInlineEditable("Title", "Status", "Priority")
+		ireg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB {
+			if user.Role == "editor" { return q.Where("owner = ?", user.Email) }
+			return q
+		})
+		mine := &Ticket{Title: "Printer jam", Status: "open", Priority: 2, Notes: "Floor 3", Owner: "editor@example.com"}
+		theirs := &Ticket{Title: "VPN down", Status: "open", Owner: "someone@example.com"}
+		idb.Create(mine); idb.Create(theirs)
+		version := func(id uint) string { var tk Ticket; idb.First(&tk, id); return tk.UpdatedAt.Format(time.RFC3339Nano) }
+		patch := func(session string, body interface{}) (*httptest.ResponseRecorder, map[string]string) {
+			b, _ := json.Marshal(body)
+			req := httptest.NewRequest("PATCH", "/admin/Ticket/inline_update", bytes.NewReader(b))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			ireg.ServeHTTP(rec, req)
+			var out map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &out)
+			return rec, out
+		}
+
+		req := httptest.NewRequest("GET", "/admin/Ticket", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "admin"})
+		rec := httptest.NewRecorder()
+		ireg.ServeHTTP(rec, req)
+		if body := rec.Body.String(); !strings.Contains(body, `class="inline-cell" data-field="Status" data-value="open"`) || !strings.Contains(body, `data-version="`+version(mine.ID)+`"`) || strings.Contains(body, `data-field="Notes"`) {
+			t.Error("Expected only inline editable cells marked, with the row's version")
+		}
+		req = httptest.NewRequest("GET", "/admin/Ticket", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "viewer"})
+		rec = httptest.NewRecorder()
+		ireg.ServeHTTP(rec, req)
+		if strings.Contains(rec.Body.String(), "inline-cell") { t.Error("Expected no inline editing without the edit permission") }
+
+		// Only the edited column is written: a change saved meanwhile to another column survives.
+		time.Sleep(2 * time.Millisecond)
+		idb.Model(&Ticket{}).Where("id = ?", mine.ID).UpdateColumn("notes", "Floor 4")
+		rec, out := patch("editor", map[string]interface{}{"id": mine.ID, "field": "Status", "value": "closed", "version": version(mine.ID)})
+		if rec.Code != 200 || out["html"] != "closed" || out["value"] != "closed" || out["version"] == "" || out["version"] != version(mine.ID) { t.Fatalf("Expected the cell saved and re-rendered, got %d %v", rec.Code, out) }
+		var saved Ticket
+		idb.First(&saved, mine.ID)
+		if saved.Status != "closed" || saved.Notes != "Floor 4" || saved.Title != "Printer jam" { t.Errorf("Expected only Status written, got %+v", saved) }
+		var entry AuditLog
+		idb.Where("action = ? AND record_id = ?", "Update", fmt.Sprint(mine.ID)).First(&entry)
+		if entry.Changes != `Status: "open" → "closed" (inline)` || entry.UserEmail != "editor@example.com" { t.Errorf("Expected the change audited, got %+v", entry) }
+
+		if rec, out := patch("editor", map[string]interface{}{"id": mine.ID, "field": "Status", "value": "open", "version": out["version"]}); rec.Code != 200 || out["value"] != "open" { t.Errorf("Expected the returned version to allow the next edit, got %d %v", rec.Code, out) }
+		rec, out = patch("admin", map[string]interface{}{"id": mine.ID, "field": "Title", "value": "Paper jam", "version": version(theirs.ID)})
+		if rec.Code != 409 || out["value"] != "Printer jam" || out["version"] != version(mine.ID) || out["error"] == "" { t.Errorf("Expected a stale version refused with the current value, got %d %v", rec.Code, out) }
+		for name, body := range map[string]map[string]interface{}{
+			"unknown option":  {"id": mine.ID, "field": "Status", "value": "pending"},
+			"bad number":      {"id": mine.ID, "field": "Priority", "value": "high"},
+			"not inline":      {"id": mine.ID, "field": "Notes", "value": "x"},
+			"readonly key":    {"id": mine.ID, "field": "ID", "value": "9"},
+		} {
+			if rec, out := patch("admin", body); rec.Code != 422 || out["error"] == "" { t.Errorf("Expected %s refused, got %d %v", name, rec.Code, out) }
+		}
+		if rec, out := patch("admin", map[string]interface{}{"id": mine.ID, "field": "Priority", "value": 5}); rec.Code != 200 || out["html"] != "5" { t.Errorf("Expected a JSON number accepted, got %d %v", rec.Code, out) }
+		if rec, _ := patch("editor", map[string]interface{}{"id": theirs.ID, "field": "Status", "value": "closed"}); rec.Code != 404 { t.Errorf("Expected records outside the scope not found, got %d", rec.Code) }
+		if rec, _ := patch("viewer", map[string]interface{}{"id": mine.ID, "field": "Status", "value": "closed"}); rec.Code != 403 { t.Errorf("Expected the edit permission required, got %d", rec.Code) }
+		var other Ticket
+		idb.First(&other, theirs.ID)
+		if other.Status != "open" { t.Error("Expected refused edits to change nothing") }
+	})
+	t.Run("RecordWatches", func(t *testing.T) {
+		wdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := wdb.DB(); sqlDB.SetMaxOpenConns(1)
+		wdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Watch{}, &WebhookDelivery{}, &Order{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"lead", "support"}, {"intern", "intern"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			wdb.Create(au)
+			wdb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, a := range []string{"list", "show", "edit", "save"} { wdb.Create(&Permission{Role: "support", ResourceName: "Order", Action: a}) }
+		wreg := NewRegistry(wdb)
+		wreg.Config.PublicURL = "https://admin.example.com"
+		mailer := &fakeMailer{sent: make(chan sentMail, 10)}
+		wreg.SetMailer(mailer)
+		wreg.Webhooks = []WebhookConfig{{URL: "http://127.0.0.1:1/watched", Events: []string{"watched"}}}
+		wreg.Register(Order{}).RegisterModelFields()
+		wreg.NotifyOnAction("Order", "", "support")
+		order := &Order{Name: "Big", Total: 5000}
+		wdb.Create(order)
+		do := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			wreg.ServeHTTP(rec, req)
+			return rec
+		}
+		next := func() (sentMail, bool) {
+			select {
+			case m := <-mailer.sent: return m, true
+			case <-time.After(time.Second): return sentMail{}, false
+			}
+		}
+		none := func(why string) {
+			select {
+			case m := <-mailer.sent: t.Errorf("Expected no email %s, got %+v", why, m)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		if !strings.Contains(do("lead", "GET", "/admin/Order/show?id=1", nil).Body.String(), ">Watch</button>") { t.Error("Expected a Watch button on the show page") }
+		if rec := do("lead", "POST", "/admin/Order/watch?id=1", nil); rec.Code != 303 { t.Fatalf("Expected watching to redirect, got %d", rec.Code) }
+		if !strings.Contains(do("lead", "GET", "/admin/Order/show?id=1", nil).Body.String(), ">Unwatch</button>") { t.Error("Expected the button to offer unwatching") }
+		if rec := do("intern", "POST", "/admin/Order/watch?id=1", nil); rec.Code != 403 { t.Errorf("Expected watching to need the show permission, got %d", rec.Code) }
+		wdb.Create(&Watch{UserID: 3, ResourceName: "Order", RecordID: "1"}) // the intern may not see orders
+
+		do("admin", "POST", "/admin/Order/save?id=1", url.Values{"Name": {"Bigger"}, "CustomerID": {"0"}, "Total": {"5000"}})
+		m, ok := next()
+		if !ok { t.Fatal("Expected the watcher emailed") }
+		if m.To != "lead@example.com" || m.Subject != "[Go Admin] admin@example.com Update Bigger" || !strings.Contains(m.Text, `Name: "Big" → "Bigger"`) || !strings.Contains(m.Text, "https://admin.example.com/admin/Order/show?id=1") || !strings.Contains(m.Text, "https://admin.example.com/admin/watches") {
+			t.Errorf("Unexpected watch email %+v", m)
+		}
+		none("beyond one per watcher and save")
+		var d WebhookDelivery
+		for i := 0; i < 100 && d.ID == 0; i++ { wdb.Where("event = ?", "watched").First(&d); time.Sleep(5 * time.Millisecond) }
+		if !strings.Contains(d.Payload, `"watchers":["lead@example.com"]`) || !strings.Contains(d.Payload, `"summary":"Update: Name: \"Big\" → \"Bigger\""`) { t.Errorf("Expected a watched webhook event, got %+v", d) }
+
+		do("lead", "POST", "/admin/Order/save?id=1", url.Values{"Name": {"Biggest"}, "CustomerID": {"0"}, "Total": {"5000"}})
+		none("to the watcher about their own change")
+
+		body := do("lead", "GET", "/admin/watches", nil).Body.String()
+		if !strings.Contains(body, "Biggest") || !strings.Contains(body, "<strong>Update</strong> by lead@example.com") { t.Errorf("Expected the watched record with its recent activity, got %s", body) }
+		var watch Watch
+		wdb.Where("user_id = ?", 2).First(&watch)
+		if rec := do("intern", "POST", "/admin/watches/unwatch", url.Values{"id": {fmt.Sprint(watch.ID)}}); rec.Code != 303 || wdb.First(&Watch{}, watch.ID).Error != nil { t.Error("Expected users unable to remove others' watches") }
+		do("lead", "POST", "/admin/watches/unwatch", url.Values{"id": {fmt.Sprint(watch.ID)}})
+		do("admin", "POST", "/admin/Order/save?id=1", url.Values{"Name": {"Small"}, "CustomerID": {"0"}, "Total": {"5000"}})
+		if m, ok := next(); !ok || m.Subject != "[Go Admin] admin@example.com Update Order #1" { t.Errorf("Expected the role notification once unwatched, got %+v", m) }
+		none("to unwatched or unauthorized users")
+
+		// A field hidden from a watcher is left out of their email and of the event sent for them.
+		res, _ := wreg.GetResource("Order")
+		res.SetFieldVisibleTo("Total", "finance")
+		cfo := &AdminUser{Email: "cfo@example.com", Role: "finance", Active: true}
+		wdb.Create(cfo)
+		wdb.Create(&Permission{Role: "finance", ResourceName: "Order", Action: "show"})
+		wdb.Create(&Watch{UserID: 2, ResourceName: "Order", RecordID: "1"})
+		wdb.Create(&Watch{UserID: cfo.ID, ResourceName: "Order", RecordID: "1"})
+		wdb.Where("event = ?", "watched").Delete(&WebhookDelivery{})
+		do("admin", "POST", "/admin/Order/save?id=1", url.Values{"Name": {"Priced"}, "CustomerID": {"0"}, "Total": {"6000"}})
+		mails := map[string]sentMail{}
+		for i := 0; i < 2; i++ { if m, ok := next(); ok { mails[m.To] = m } }
+		if m := mails["lead@example.com"]; !strings.Contains(m.Text, `Name: "Small" → "Priced"`) || strings.Contains(m.Text, "6000") { t.Errorf("Expected the lead's email without the hidden total, got %+v", m) }
+		if m := mails["cfo@example.com"]; !strings.Contains(m.Text, `Total: "5000" → "6000"`) { t.Errorf("Expected the finance watcher to see the total, got %+v", m) }
+		var events []WebhookDelivery
+		for i := 0; i < 100 && len(events) < 2; i++ { wdb.Where("event = ?", "watched").Find(&events); time.Sleep(5 * time.Millisecond) }
+		for _, ev := range events {
+			if strings.Contains(ev.Payload, "lead@example.com") && (strings.Contains(ev.Payload, "6000") || strings.Contains(ev.Payload, "cfo@example.com")) { t.Errorf("Expected the lead's event without the hidden total, got %s", ev.Payload) }
+		}
+		if len(events) != 2 { t.Errorf("Expected one watched event per visible set, got %d", len(events)) }
+	})
+	t.Run("MultiDatabase", func(t *testing.T) {
+		mdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := mdb.DB(); sqlDB.SetMaxOpenConns(1)
+		mdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Customer{})
+		odb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ = odb.DB(); sqlDB.SetMaxOpenConns(1)
+		odb.AutoMigrate(&Order{})
+		au := &AdminUser{Email: "admin@example.com", Role: "admin", Active: true}
+		mdb.Create(au)
+		mdb.Create(&Session{ID: hashToken("admin"), UserID: au.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		mreg := NewRegistry(mdb)
+		mreg.Register(Customer{}).RegisterModelFields()
+		orders := mreg.RegisterWithDB(Order{}, odb).RegisterModelFields().BelongsTo("CustomerID", "Customer", "Customer", "ID")
+		if orders.DB != odb { t.Fatal("Expected RegisterWithDB to keep the handle on the resource") }
+		errs := mreg.Validate()
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "association CustomerID links to resource 'Customer', which is on a different database") {
+			t.Fatalf("Expected the cross-database association to fail validation, got %v", errs)
+		}
+		orders.Associations = nil
+		if errs := mreg.Validate(); len(errs) != 0 { t.Fatalf("Expected no problems without the association, got %v", errs) }
+
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "admin"})
+			rec := httptest.NewRecorder()
+			mreg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := do("POST", "/admin/Order/save", url.Values{"Name": {"Remote"}, "CustomerID": {"0"}, "Total": {"42"}}); rec.Code != 303 { t.Fatalf("Expected the save to redirect, got %d: %s", rec.Code, rec.Body.String()) }
+		var saved Order
+		if err := odb.First(&saved).Error; err != nil || saved.Name != "Remote" { t.Fatalf("Expected the order on its own database, got %+v (%v)", saved, err) }
+		if mdb.Migrator().HasTable(&Order{}) { t.Fatal("Expected nothing to create orders on the registry's database") }
+		if body := do("GET", "/admin/Order", nil).Body.String(); !strings.Contains(body, "Remote") { t.Error("Expected the list to read the order's database") }
+		if rec := do("GET", "/admin/Order/show?id=1", nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), "Remote") { t.Errorf("Expected the show page to find the order, got %d", rec.Code) }
+		if body := do("GET", "/admin/Order/export", nil).Body.String(); !strings.Contains(body, "Remote") { t.Errorf("Expected the export to include the order, got %q", body) }
+		if n := mreg.CountFor(context.Background(), orders, nil); n != 1 { t.Errorf("Expected a count of 1, got %d", n) }
+		if item, err := mreg.Get("Order", 1); err != nil || item.(*Order).Name != "Remote" { t.Errorf("Expected Get to read the order's database, got %v (%v)", item, err) }
+		if rec := do("POST", "/admin/Order/delete?id=1", nil); rec.Code != 303 { t.Fatalf("Expected the delete to redirect, got %d", rec.Code) }
+		var left int64
+		odb.Model(&Order{}).Count(&left)
+		if left != 0 { t.Errorf("Expected the order deleted from its database, %d left", left) }
+		var actions []string
+		mdb.Model(&AuditLog{}).Where("resource_name = ?", "Order").Order("id").Pluck("action", &actions)
+		if strings.Join(actions, ",") != "Create,Delete" { t.Errorf("Expected the audit entries on the registry's database, got %v", actions) }
+	})
+	t.Run("DependentOptions", func(t *testing.T) {
+		ddb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := ddb.DB(); sqlDB.SetMaxOpenConns(1)
+		ddb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Address{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"viewer", "viewer"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			ddb.Create(au)
+			ddb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		ddb.Create(&Permission{Role: "viewer", ResourceName: "Address", Action: "list"})
+		dreg := NewRegistry(ddb)
+		states := map[string][]Option{"DE": {{Value: "BE", Label: "Berlin"}, {Value: "BY", Label: "Bavaria"}}, "US": {{Value: "CA", Label: "California"}, {Value: "NY", Label: "New York"}}}
+		dreg.Register(Address{}).RegisterModelFields().SetDependentOptions("State", "Country", func(db *gorm.DB, parent string) []Option { return states[parent] })
+		do := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			dreg.ServeHTTP(rec, req)
+			return rec
+		}
+		rec := do("admin", "GET", "/admin/Address/field_options?field=State&parent=DE", nil)
+		var opts []Option
+		if err := json.Unmarshal(rec.Body.Bytes(), &opts); err != nil || len(opts) != 2 || opts[1].Value != "BY" || opts[1].Label != "Bavaria" { t.Fatalf("Expected the German states, got %d %s", rec.Code, rec.Body.String()) }
+		if body := strings.TrimSpace(do("admin", "GET", "/admin/Address/field_options?field=State&parent=FR", nil).Body.String()); body != "[]" { t.Errorf("Expected an empty list for an unknown parent, got %s", body) }
+		if rec := do("admin", "GET", "/admin/Address/field_options?field=Country", nil); rec.Code != 404 { t.Errorf("Expected 404 for a field without dependent options, got %d", rec.Code) }
+		if rec := do("viewer", "GET", "/admin/Address/field_options?field=State&parent=DE", nil); rec.Code != 403 { t.Errorf("Expected the options to need new or edit, got %d", rec.Code) }
+
+		rec = do("admin", "POST", "/admin/Address/save", url.Values{"Country": {"DE"}, "State": {"CA"}})
+		if rec.Code != 422 || !strings.Contains(rec.Body.String(), "is not a valid State for this Country") { t.Fatalf("Expected a state of another country refused, got %d", rec.Code) }
+		if rec := do("admin", "POST", "/admin/Address/save", url.Values{"Country": {"DE"}, "State": {"BY"}}); rec.Code != 303 { t.Fatalf("Expected a matching state saved, got %d: %s", rec.Code, rec.Body.String()) }
+		if rec := do("admin", "POST", "/admin/Address/save", url.Values{"Country": {"US"}, "State": {""}}); rec.Code != 303 { t.Errorf("Expected an empty state allowed, got %d", rec.Code) }
+		body := do("admin", "GET", "/admin/Address/edit?id=1", nil).Body.String()
+		if !strings.Contains(body, `<option value="BY" selected>Bavaria</option>`) || strings.Contains(body, "California") { t.Error("Expected the edit form to offer the record's country's states with its state chosen") }
+		if !strings.Contains(body, `data-depends-on="Country"`) { t.Error("Expected the select wired to its parent") }
+		if rec := do("admin", "POST", "/admin/Address/save?id=1", url.Values{"Country": {"US"}, "State": {"BY"}}); rec.Code != 422 { t.Errorf("Expected changing the country alone to refuse the old state, got %d", rec.Code) }
+		var saved Address
+		ddb.First(&saved, 1)
+		if saved.Country != "DE" || saved.State != "BY" { t.Errorf("Expected the refused edit not saved, got %+v", saved) }
+
+		// Inline and batch edits of the parent are checked the same way.
+		res, _ := dreg.GetResource("Address")
+		res.SetInlineEditable("Country")
+		req := httptest.NewRequest("PATCH", "/admin/Address/inline_update", strings.NewReader(`{"id": "1", "field": "Country", "value": "US"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: "admin"})
+		rec = httptest.NewRecorder()
+		dreg.ServeHTTP(rec, req)
+		if rec.Code != 422 || !strings.Contains(rec.Body.String(), "is not a valid State for this Country") { t.Errorf("Expected an inline country change refused for the old state, got %d %s", rec.Code, rec.Body.String()) }
+		rec = do("admin", "POST", "/admin/Address/batch_action", url.Values{"action_name": {"edit_field"}, "ids": {"1", "2"}, "field": {"Country"}, "value": {"US"}})
+		if flash := rec.Header().Get("Set-Cookie"); !strings.Contains(flash, "1 of 2 records") || !strings.Contains(flash, "#1: ") { t.Errorf("Expected the batch edit to fail the record whose state doesn't fit, got %s", flash) }
+		var rows []Address
+		ddb.Order("id").Find(&rows)
+		if len(rows) != 2 || rows[0].Country != "DE" || rows[0].State != "BY" || rows[1].Country != "US" { t.Errorf("Expected only the record without a state changed, got %+v", rows) }
+	})
+	t.Run("ExportFields", func(t *testing.T) {
+		edb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := edb.DB(); sqlDB.SetMaxOpenConns(1)
+		edb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Customer{}, &Order{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"clerk", "clerk"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			edb.Create(au)
+			edb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, a := range []string{"list", "export"} { edb.Create(&Permission{Role: "clerk", ResourceName: "Order", Action: a}) }
+		ereg := NewRegistry(edb)
+		ereg.Register(Customer{}).RegisterModelFields().SetIndexFields("ID", "Name")
+		orders := ereg.Register(Order{}).RegisterModelFields().BelongsTo("CustomerID", "Customer", "Customer", "ID").
+			SetDecorator("Total", func(v interface{}) template.HTML { return Badge(fmt.Sprintf("%d & up", v), "green") }).
+			ExportFields("Name", "Customer.Name", "Customer.Country", "Total")
+		acme, globex := &Customer{Name: "Acme", Country: "IN"}, &Customer{Name: "Globex", Country: "US"}
+		edb.Create(acme); edb.Create(globex)
+		edb.Create(&Order{Name: "o1", CustomerID: acme.ID, Total: 10})
+		edb.Create(&Order{Name: "o2", CustomerID: globex.ID, Total: 20})
+		edb.Create(&Order{Name: "o3", Total: 30})
+		get := func(session, path string) string {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			ereg.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		want := "Name,Customer Name,Customer Country,Total\no1,Acme,IN,10 & up\no2,Globex,US,20 & up\no3,,,30 & up\n"
+		if csv := get("admin", "/admin/Order/export?sort=ID"); csv != want { t.Errorf("Expected the configured columns with association values and decorated text, got %q", csv) }
+		orders.SetExportRaw("Total")
+		if csv := get("admin", "/admin/Order/export?sort=ID"); !strings.Contains(csv, "o1,Acme,IN,10\n") { t.Errorf("Expected ExportRaw to skip the decorator, got %q", csv) }
+		if csv := get("clerk", "/admin/Order/export?sort=ID"); !strings.HasPrefix(csv, "Name,Total\no1,10\n") { t.Errorf("Expected paths into resources the user may not show left out, got %q", csv) }
+		if csv := get("admin", "/admin/Customer/export?sort=ID"); !strings.HasPrefix(csv, "ID,Name\n") { t.Errorf("Expected exports without ExportFields to use the index fields, got %q", csv) }
+		orders.ExportFields("Name", "Customer.Nmae", "Buyer.Name")
+		errs := fmt.Sprint(ereg.Validate())
+		if !strings.Contains(errs, `export field "Customer.Nmae" names no field of Customer`) || !strings.Contains(errs, `export field "Buyer.Name" does not start with a BelongsTo association`) { t.Errorf("Expected bad export paths reported, got %s", errs) }
+	})
+	t.Run("OIDCLogin", func(t *testing.T) {
+		odb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := odb.DB(); sqlDB.SetMaxOpenConns(1)
+		odb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &Permission{}, &LoginEvent{})
+		key, _ := rsa.GenerateKey(rand.Reader, 2048)
+		seg := func(v interface{}) string { b, _ := json.Marshal(v); return base64.RawURLEncoding.EncodeToString(b) }
+		var idToken string
+		mux := http.NewServeMux()
+		idp := httptest.NewServer(mux)
+		defer idp.Close()
+		mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{"issuer": idp.URL, "authorization_endpoint": idp.URL + "/authorize", "token_endpoint": idp.URL + "/token", "jwks_uri": idp.URL + "/jwks"})
+		})
+		mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+			e := big.NewInt(int64(key.E)).Bytes()
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{"kid": "k1", "kty": "RSA", "use": "sig", "n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()), "e": base64.RawURLEncoding.EncodeToString(e)}}})
+		})
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			if id, secret, _ := r.BasicAuth(); id != "admin-client" || secret != "s3cret" || r.FormValue("code") != "the-code" { w.WriteHeader(400); json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"}); return }
+			json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+		})
+		oreg := NewRegistry(odb)
+		oreg.Config.OIDC = OIDCConfig{IssuerURL: idp.URL, ClientID: "admin-client", ClientSecret: "s3cret", RoleMapping: map[string]string{"ops": "support", "admins": "admin"}}
+		signIn := func(claims map[string]interface{}, tamper func(state string) string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			oreg.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/login/sso", nil))
+			loc, _ := url.Parse(rec.Header().Get("Location"))
+			if rec.Code != 303 || loc.Path != "/authorize" || loc.Query().Get("client_id") != "admin-client" || loc.Query().Get("redirect_uri") != "http://example.com/admin/login/sso/callback" { t.Fatalf("Expected a redirect to the provider, got %d %s", rec.Code, loc) }
+			state := loc.Query().Get("state")
+			full := map[string]interface{}{"iss": idp.URL, "aud": "admin-client", "exp": time.Now().Add(time.Hour).Unix(), "nonce": loc.Query().Get("nonce"), "email": "sso@example.com", "email_verified": true, "name": "Sam Sso", "groups": []string{"staff", "admins"}}
+			for k, v := range claims { if v == nil { delete(full, k) } else { full[k] = v } }
+			signed := seg(map[string]string{"alg": "RS256", "kid": "k1"}) + "." + seg(full)
+			digest := sha256.Sum256([]byte(signed))
+			sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			idToken = signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+			if tamper != nil { state = tamper(state) }
+			req := httptest.NewRequest("GET", "/admin/login/sso/callback?code=the-code&state="+url.QueryEscape(state), nil)
+			for _, c := range rec.Result().Cookies() { req.AddCookie(c) }
+			out := httptest.NewRecorder()
+			oreg.ServeHTTP(out, req)
+			return out
+		}
+		page := httptest.NewRecorder()
+		oreg.ServeHTTP(page, httptest.NewRequest("GET", "/admin/login", nil))
+		if !strings.Contains(page.Body.String(), "/admin/login/sso") || !strings.Contains(page.Body.String(), `name="password"`) { t.Error("Expected the login page to offer SSO beside the password form") }
+
+		rec := signIn(nil, nil)
+		var user AdminUser
+		odb.Where("email = ?", "sso@example.com").First(&user)
+		if rec.Code != 303 || user.Role != "admin" || user.Name != "Sam Sso" || !user.Active || user.LastLoginAt == nil { t.Fatalf("Expected the user provisioned as admin and signed in, got %d %+v: %s", rec.Code, user, rec.Body.String()) }
+		var session string
+		for _, c := range rec.Result().Cookies() { if c.Name == "admin_session" && c.MaxAge >= 0 { session = c.Value } }
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+		home := httptest.NewRecorder()
+		oreg.ServeHTTP(home, req)
+		if session == "" || home.Code != 200 { t.Errorf("Expected the SSO session to be signed in, got %d", home.Code) }
+		if rec := signIn(map[string]interface{}{"groups": "ops", "name": nil}, nil); rec.Code != 303 { t.Errorf("Expected a returning user to sign in, got %d", rec.Code) }
+		odb.First(&user, user.ID)
+		var users int64
+		odb.Model(&AdminUser{}).Count(&users)
+		if users != 1 || user.Role != "support" || user.Name != "Sam Sso" { t.Errorf("Expected the returning user's role updated in place, got %d users, %+v", users, user) }
+		for _, c := range []struct {
+			groups []interface{}
+			role   string
+		}{{[]interface{}{"ops", "admins"}, "support"}, {[]interface{}{"staff", "admins", "ops"}, "admin"}} {
+			if role := oreg.oidcRole(&oidcClaims{raw: map[string]interface{}{"groups": c.groups}}); role != c.role { t.Errorf("Expected %v to map to %q, the first mapped value, got %q", c.groups, c.role, role) }
+		}
+
+		for name, c := range map[string]struct {
+			claims map[string]interface{}
+			tamper func(string) string
+		}{
+			"bad state":      {nil, func(string) string { return "forged" }},
+			"wrong audience": {map[string]interface{}{"aud": []string{"someone-else"}}, nil},
+			"expired":        {map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, nil},
+			"wrong issuer":   {map[string]interface{}{"iss": "https://evil.example.com"}, nil},
+			"wrong nonce":    {map[string]interface{}{"nonce": "replayed"}, nil},
+			"unverified":     {map[string]interface{}{"email_verified": false}, nil},
+			"unmapped role":  {map[string]interface{}{"email": "stranger@example.com", "groups": []string{"staff"}}, nil},
+		} {
+			rec := signIn(c.claims, c.tamper)
+			if rec.Code != 200 || !strings.Contains(rec.Body.String(), "Single sign-on failed") { t.Errorf("%s: expected the sign-in refused, got %d", name, rec.Code) }
+			for _, ck := range rec.Result().Cookies() { if ck.Name == "admin_session" && ck.Value != "" { t.Errorf("%s: expected no session", name) } }
+		}
+		var strangers, failures int64
+		odb.Model(&AdminUser{}).Where("email = ?", "stranger@example.com").Count(&strangers)
+		odb.Model(&LoginEvent{}).Where("success = ?", false).Count(&failures)
+		if strangers != 0 || failures != 7 { t.Errorf("Expected refused sign-ins recorded and no user created, got %d users, %d failures", strangers, failures) }
+		odb.Model(&user).Update("active", false)
+		if rec := signIn(nil, nil); !strings.Contains(rec.Body.String(), "deactivated") { t.Error("Expected a deactivated user refused") }
+
+		oreg.Config.DisablePasswordLogin = true
+		user.SetPassword("pw")
+		odb.Model(&user).Updates(map[string]interface{}{"active": true, "password_hash": user.PasswordHash})
+		page = httptest.NewRecorder()
+		oreg.ServeHTTP(page, httptest.NewRequest("GET", "/admin/login", nil))
+		if strings.Contains(page.Body.String(), `name="password"`) { t.Error("Expected no password form with password login disabled") }
+		post := httptest.NewRequest("POST", "/admin/login", strings.NewReader(url.Values{"email": {user.Email}, "password": {"pw"}}.Encode()))
+		post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		refused := httptest.NewRecorder()
+		oreg.ServeHTTP(refused, post)
+		if refused.Code == 303 || !strings.Contains(refused.Body.String(), "Password sign-in is disabled") { t.Errorf("Expected password sign-in refused, got %d", refused.Code) }
+	})
+	t.Run("MergeRecords", func(t *testing.T) {
+		type Client struct {
+			ID        uint `gorm:"primaryKey"`
+			Name      string
+			Phone     string
+			DeletedAt gorm.DeletedAt
+		}
+		type Invoice struct {
+			ID       uint `gorm:"primaryKey"`
+			ClientID uint
+			Total    int64
+		}
+		type Vendor struct {
+			ID   uint `gorm:"primaryKey"`
+			Name string
+		}
+		mdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := mdb.DB(); sqlDB.SetMaxOpenConns(1)
+		mdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Client{}, &Invoice{}, &Vendor{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"editor", "editor"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			mdb.Create(au)
+			mdb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, a := range []string{"show", "edit"} { mdb.Create(&Permission{Role: "editor", ResourceName: "Client", Action: a}) }
+		mreg := NewRegistry(mdb)
+		mreg.Register(Client{}).RegisterModelFields().EnableMerge().HasMany("Invoices", "Invoices", "Invoice", "ClientID")
+		mreg.Register(Invoice{}).RegisterModelFields()
+		mreg.Register(Vendor{}).RegisterModelFields().EnableMerge().HasMany("Bills", "Bills", "Invoice", "")
+		keep, dup := &Client{Name: "Acme", Phone: "555-0100"}, &Client{Name: "ACME Inc", Phone: "555-0199"}
+		mdb.Create(keep); mdb.Create(dup)
+		mdb.Create(&Invoice{ClientID: keep.ID, Total: 10})
+		mdb.Create(&Invoice{ClientID: dup.ID, Total: 20}); mdb.Create(&Invoice{ClientID: dup.ID, Total: 30})
+		do := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			mreg.ServeHTTP(rec, req)
+			return rec
+		}
+		base := fmt.Sprintf("/admin/Client/merge?id=%d", keep.ID)
+		if !strings.Contains(do("admin", "GET", fmt.Sprintf("/admin/Client/show?id=%d", keep.ID), nil).Body.String(), "/Client/merge?id=") { t.Error("Expected a Merge with… button on the show page") }
+		if !strings.Contains(do("admin", "GET", base, nil).Body.String(), `id="merge-search"`) { t.Error("Expected the duplicate picker") }
+		if body := do("admin", "GET", base+fmt.Sprintf("&with=%d", keep.ID), nil).Body.String(); !strings.Contains(body, "merged with itself") { t.Error("Expected a record refused as its own duplicate") }
+		compare := do("admin", "GET", base+fmt.Sprintf("&with=%d", dup.ID), nil).Body.String()
+		if !strings.Contains(compare, `name="keep_Phone"`) || !strings.Contains(compare, "555-0199") || !strings.Contains(compare, "2 Invoices will move") { t.Errorf("Expected the comparison form, got %s", compare) }
+		if rec := do("editor", "POST", base+fmt.Sprintf("&with=%d", dup.ID), nil); rec.Code != 403 { t.Errorf("Expected merging to need the delete permission, got %d", rec.Code) }
+		if rec := do("admin", "GET", "/admin/Invoice/merge?id=1", nil); rec.Code != 404 { t.Errorf("Expected merging off unless enabled, got %d", rec.Code) }
+
+		if rec := do("admin", "POST", base+fmt.Sprintf("&with=%d", dup.ID), url.Values{"keep_Phone": {"duplicate"}, "keep_Name": {"record"}}); rec.Code != 303 { t.Fatalf("Expected the merge to redirect, got %d: %s", rec.Code, rec.Body.String()) }
+		var merged Client
+		mdb.First(&merged, keep.ID)
+		var moved, trashed, gone int64
+		mdb.Model(&Invoice{}).Where("client_id = ?", keep.ID).Count(&moved)
+		mdb.Unscoped().Model(&Client{}).Where("id = ? AND deleted_at IS NOT NULL", dup.ID).Count(&trashed)
+		mdb.Model(&Client{}).Where("id = ?", dup.ID).Count(&gone)
+		if merged.Name != "Acme" || merged.Phone != "555-0199" || moved != 3 || trashed != 1 || gone != 0 { t.Errorf("Expected the chosen values kept, children moved and the duplicate trashed, got %+v, %d moved, %d trashed", merged, moved, trashed) }
+		var audit AuditLog
+		mdb.Where("action = ? AND record_id = ?", "Merge", fmt.Sprint(keep.ID)).First(&audit)
+		if !strings.Contains(audit.Changes, "Invoices #2, #3") || !strings.Contains(audit.Changes, "kept its Phone") { t.Errorf("Expected the merge audited with the fields and children, got %q", audit.Changes) }
+		var deleted int64
+		mdb.Model(&AuditLog{}).Where("action = ? AND record_id = ? AND changes = ?", "Delete", fmt.Sprint(dup.ID), fmt.Sprintf("Merged into #%d", keep.ID)).Count(&deleted)
+		if deleted != 1 { t.Error("Expected the duplicate's deletion audited") }
+
+		a, b := &Vendor{Name: "Globex"}, &Vendor{Name: "Globex Corp"}
+		mdb.Create(a); mdb.Create(b)
+		vbase := fmt.Sprintf("/admin/Vendor/merge?id=%d&with=%d", a.ID, b.ID)
+		if body := do("admin", "GET", vbase, nil).Body.String(); !strings.Contains(body, "Bills have no known foreign key") || strings.Contains(body, "Merge and delete") { t.Error("Expected an association without a foreign key to block merging") }
+		do("admin", "POST", vbase, nil)
+		var vendors int64
+		mdb.Model(&Vendor{}).Count(&vendors)
+		if vendors != 2 { t.Error("Expected a blocked merge to change nothing") }
+	})
+	t.Run("ScheduledReports", func(t *testing.T) {
+		kolkata, err := time.LoadLocation("Asia/Kolkata")
+		if err != nil { t.Skip("no time zone data") }
+		sched, _ := parseCron("30 8 * * 1-5")
+		if next := sched.Next(time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC), kolkata); !next.Equal(time.Date(2026, 10, 19, 8, 30, 0, 0, kolkata)) { t.Errorf("Expected Monday 8:30 in Kolkata after Friday 8:30, got %v", next) }
+		if sched, _ := parseCron("0 0 1 * 1"); !sched.Next(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), time.UTC).Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) { t.Error("Expected day of month or day of week to match") }
+		for _, bad := range []string{"* * *", "60 * * * *", "*/0 * * * *", "0 0 30 2 *x"} { if _, err := parseCron(bad); err == nil { t.Errorf("Expected %q to be rejected", bad) } }
+		if sched, _ := parseCron("0 0 30 2 *"); !sched.Next(time.Now(), time.UTC).IsZero() { t.Error("Expected February 30th never to match") }
+
+		rdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := rdb.DB(); sqlDB.SetMaxOpenConns(1)
+		rdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &ExportJob{}, &ScheduledReport{}, &Order{})
+		root := &AdminUser{Email: "root@example.com", Role: "admin", Active: true, Timezone: "Asia/Kolkata"}
+		rdb.Create(root)
+		rdb.Create(&Session{ID: hashToken("root"), UserID: root.ID, Role: root.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		rreg := NewRegistry(rdb)
+		rreg.Config.ExportDir, rreg.Config.PublicURL = t.TempDir(), "https://admin.example.com"
+		mailer := &attachMailer{fakeMailer{make(chan sentMail, 10)}, make(chan Attachment, 10)}
+		rreg.SetMailer(mailer)
+		rreg.Register(Order{}).RegisterModelFields()
+		rdb.Create(&Order{Name: "Open one", Total: 1}); rdb.Create(&Order{Name: "Big one", Total: 500})
+		filter := SavedFilter{UserID: root.ID, ResourceName: "Order", Name: "Big orders", Query: "q_Name=Big"}
+		rdb.Create(&filter)
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "root"})
+			rec := httptest.NewRecorder()
+			rreg.ServeHTTP(rec, req)
+			return rec
+		}
+		if body := do("GET", "/admin/reports", nil).Body.String(); !strings.Contains(body, "Big orders") { t.Error("Expected saved filters offered on the reports page") }
+		if body := do("POST", "/admin/reports/save", url.Values{"name": {"Bad"}, "resource": {"Order"}, "recipients": {"not an address"}, "schedule": {"@daily"}}).Body.String(); !strings.Contains(body, "is not an email address") { t.Error("Expected invalid recipients to be refused") }
+		if rec := do("POST", "/admin/reports/save", url.Values{"filter_id": {fmt.Sprint(filter.ID)}, "recipients": {"ops@example.com, cfo@example.com"}, "schedule": {"0 8 * * *"}, "enabled": {"1"}}); rec.Code != 303 { t.Fatalf("Expected the report saved, got %d %s", rec.Code, rec.Body.String()) }
+		var rep ScheduledReport
+		rdb.First(&rep)
+		if rep.Name != "Big orders" || rep.ResourceName != "Order" || rep.Query != "q_Name=Big" || rep.Timezone != "Asia/Kolkata" || rep.NextRunAt == nil || rep.NextRunAt.In(kolkata).Hour() != 8 { t.Fatalf("Expected the report built from the filter in the creator's time zone, got %+v", rep) }
+
+		// A due report is claimed once, exported and attached, and moves on to its next run.
+		now := rep.NextRunAt.Add(time.Minute)
+		rreg.runDueReports(context.Background(), now)
+		rreg.runDueReports(context.Background(), now)
+		for _, to := range []string{"ops@example.com", "cfo@example.com"} {
+			select {
+			case m := <-mailer.sent: if m.To != to || m.Subject != "[Go Admin] Big orders" || !strings.Contains(m.Text, "The export is attached") { t.Errorf("Unexpected email %+v", m) }
+			case <-time.After(time.Second): t.Fatal("Expected a report email to " + to)
+			}
+			if att := <-mailer.attached; !strings.Contains(string(att.Data), "Big one") || strings.Contains(string(att.Data), "Open one") || !strings.HasSuffix(att.Name, ".csv") { t.Errorf("Expected the filtered export attached, got %q", att.Data) }
+		}
+		if len(mailer.sent) != 0 { t.Error("Expected the report sent once") }
+		rdb.First(&rep, rep.ID)
+		if rep.LastJobID == 0 || rep.LastError != "" || rep.LastRunAt == nil || !rep.NextRunAt.After(now) { t.Errorf("Expected the run recorded, got %+v", rep) }
+
+		// Over the attachment limit the email links to a signed download instead.
+		rreg.Config.ReportAttachmentLimit = 1
+		rreg.runDueReports(context.Background(), rep.NextRunAt.Add(time.Minute))
+		<-mailer.sent
+		m := <-mailer.sent
+		link := m.Text[strings.Index(m.Text, "https://"):]
+		link = strings.TrimPrefix(link[:strings.Index(link, "\n")], "https://admin.example.com")
+		if len(mailer.attached) != 0 || !strings.HasPrefix(link, "/admin/reports/download?") { t.Fatalf("Expected a download link, got %q", m.Text) }
+		req := httptest.NewRequest("GET", link, nil)
+		rec := httptest.NewRecorder()
+		rreg.ServeHTTP(rec, req)
+		if rec.Code != 200 || !strings.Contains(rec.Body.String(), "Big one") { t.Errorf("Expected the signed link to download without a session, got %d", rec.Code) }
+		rec = httptest.NewRecorder()
+		rreg.ServeHTTP(rec, httptest.NewRequest("GET", strings.Replace(link, "job=", "job=9", 1), nil))
+		if rec.Code != 403 { t.Errorf("Expected a tampered link refused, got %d", rec.Code) }
+
+		// A failing run records its error and retries with backoff.
+		rdb.First(&rep, rep.ID)
+		rdb.Model(&rep).Update("resource_name", "Missing")
+		failAt := rep.NextRunAt.Add(time.Minute)
+		rreg.runDueReports(context.Background(), failAt)
+		rdb.First(&rep, rep.ID)
+		if rep.Failures != 1 || !strings.Contains(rep.LastError, "Missing") || !rep.NextRunAt.Equal(failAt.Add(reportBackoff)) { t.Errorf("Expected a retry after the backoff, got %+v", rep) }
+		rreg.runDueReports(context.Background(), rep.NextRunAt.Add(time.Second))
+		rdb.First(&rep, rep.ID)
+		if rep.Failures != 2 || rep.NextRunAt.Sub(*rep.LastRunAt) != 2*reportBackoff { t.Errorf("Expected the backoff to double, got %+v", rep) }
+
+		if rec := do("POST", "/admin/reports/delete", url.Values{"id": {fmt.Sprint(rep.ID)}}); rec.Code != 303 || rdb.Find(&ScheduledReport{}).RowsAffected != 0 { t.Error("Expected the report deleted") }
+	})
+
+	t.Run("EncryptedFields", func(t *testing.T) {
+		type Merchant struct {
+			ID     uint `gorm:"primaryKey"`
+			Name   string
+			APIKey string
+		}
+		edb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := edb.DB(); sqlDB.SetMaxOpenConns(1)
+		edb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Merchant{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"finance", "finance"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			edb.Create(au)
+			edb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		for _, a := range []string{"list", "show", "new", "edit", "save", "export"} { edb.Create(&Permission{Role: "finance", ResourceName: "Merchant", Action: a}) }
+		key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+		ereg := NewRegistry(edb)
+		ereg.Config.EncryptionKey = key
+		res := ereg.Register(Merchant{}).RegisterModelFields().SetEncrypted("APIKey", "finance")
+		do := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			ereg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := do("finance", "POST", "/admin/Merchant/save", url.Values{"Name": {"Acme"}, "APIKey": {"sk_live_123"}}); rec.Code != 303 { t.Fatalf("Expected the merchant saved, got %d %s", rec.Code, rec.Body.String()) }
+		var m Merchant
+		edb.First(&m)
+		if !strings.HasPrefix(m.APIKey, "enc:") || strings.Contains(m.APIKey, "sk_live") { t.Fatalf("Expected the key stored encrypted, got %q", m.APIKey) }
+		show := fmt.Sprintf("/admin/Merchant/show?id=%d", m.ID)
+		if body := do("finance", "GET", show, nil).Body.String(); !strings.Contains(body, "sk_live_123") { t.Error("Expected a DecryptFor role to see the key") }
+		if body := do("admin", "GET", show, nil).Body.String(); strings.Contains(body, "sk_live_123") || !strings.Contains(body, encryptedMask) { t.Error("Expected other roles, admins included, to see a mask") }
+		if body := do("admin", "GET", fmt.Sprintf("/admin/Merchant/edit?id=%d", m.ID), nil).Body.String(); strings.Contains(body, "sk_live_123") || strings.Contains(body, m.APIKey) { t.Error("Expected the edit form to leave the key blank") }
+
+		// A blank input keeps the stored value, and the audit log never holds the key.
+		do("admin", "POST", fmt.Sprintf("/admin/Merchant/save?id=%d", m.ID), url.Values{"Name": {"Acme Ltd"}, "APIKey": {""}})
+		var kept Merchant
+		edb.First(&kept, m.ID)
+		if kept.Name != "Acme Ltd" || kept.APIKey != m.APIKey { t.Errorf("Expected a blank key to keep the stored one, got %+v", kept) }
+		do("finance", "POST", fmt.Sprintf("/admin/Merchant/save?id=%d", m.ID), url.Values{"Name": {"Acme Ltd"}, "APIKey": {"sk_live_456"}})
+		var logs []AuditLog
+		edb.Where("resource_name = ?", "Merchant").Find(&logs)
+		for _, l := range logs { if strings.Contains(l.Changes, "sk_live") || strings.Contains(l.Changes, "enc:") { t.Errorf("Expected no key in the audit log, got %q", l.Changes) } }
+		if len(logs) != 3 || !strings.Contains(logs[2].Changes, "APIKey: changed") { t.Errorf("Expected the key change noted, got %+v", logs) }
+
+		// Exports mask the key unless the field allows it and the role may decrypt it.
+		if body := do("finance", "GET", "/admin/Merchant/export", nil).Body.String(); strings.Contains(body, "sk_live") || !strings.Contains(body, encryptedMask) { t.Errorf("Expected a masked export, got %q", body) }
+		res.SetExportDecrypted("APIKey")
+		if body := do("finance", "GET", "/admin/Merchant/export", nil).Body.String(); !strings.Contains(body, "sk_live_456") { t.Errorf("Expected a decrypted export, got %q", body) }
+		if body := do("admin", "GET", "/admin/Merchant/export", nil).Body.String(); strings.Contains(body, "sk_live") { t.Error("Expected roles that may not decrypt to get a masked export") }
+		if body := do("admin", "GET", "/admin/Merchant?format=json", nil).Body.String(); strings.Contains(body, "sk_live") || strings.Contains(body, "enc:") { t.Errorf("Expected the API to mask the key, got %s", body) }
+
+		// Rotation re-encrypts every value, including ones stored before the field was encrypted, and is resumable.
+		edb.Create(&Merchant{Name: "Legacy", APIKey: "sk_plain"})
+		newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+		// Requests keep encrypting while the key changes under them (run with -race).
+		stop, started, stopped := make(chan struct{}), make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			close(started)
+			for {
+				select {
+				case <-stop: return
+				default: ereg.encryptValue("sk_busy")
+				}
+			}
+		}()
+		<-started
+		n, err := ereg.RotateEncryptionKey(key, newKey)
+		close(stop); <-stopped
+		if err != nil || n != 2 { t.Fatalf("Expected two values rotated, got %d %v", n, err) }
+		if n, _ := ereg.RotateEncryptionKey(key, newKey); n != 0 { t.Errorf("Expected a second rotation to find nothing to do, got %d", n) }
+		ereg.Config.OldEncryptionKeys = nil
+		var rows []Merchant
+		edb.Order("id").Find(&rows)
+		for _, r := range rows {
+			plain, err := ereg.decryptValue(r.APIKey)
+			if !strings.HasPrefix(r.APIKey, "enc:") || err != nil || !strings.HasPrefix(plain, "sk_") { t.Errorf("Expected %q readable under the new key alone, got %q %v", r.APIKey, plain, err) }
+		}
+
+		// A value that won't decrypt shows an error marker rather than failing the page.
+		edb.Model(&Merchant{}).Where("id = ?", m.ID).Update("api_key", "enc:deadbeef:AAAA")
+		if rec := do("finance", "GET", show, nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), "encrypted-error") { t.Errorf("Expected an error marker, got %d", rec.Code) }
+	})
+
+	t.Run("MaintenanceMode", func(t *testing.T) {
+		type Note struct {
+			ID    uint `gorm:"primaryKey"`
+			Title string
+		}
+		mdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := mdb.DB(); sqlDB.SetMaxOpenConns(1)
+		mdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Setting{}, &Note{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"editor", "editor"}, {"ops", "ops"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			mdb.Create(au)
+			mdb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+			for _, a := range []string{"list", "show", "new", "edit", "save"} { mdb.Create(&Permission{Role: u.role, ResourceName: "Note", Action: a}) }
+		}
+		mreg := NewRegistry(mdb)
+		mreg.Config.MaintenanceOverrideRole = "ops"
+		mreg.Register(Note{}).RegisterModelFields().SetInlineEditable("Title")
+		mdb.Create(&Note{Title: "First"})
+		do := func(session, method, path string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, body)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for i := 0; i+1 < len(header); i += 2 { req.Header.Set(header[i], header[i+1]) }
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			mreg.ServeHTTP(rec, req)
+			return rec
+		}
+		form := func(v url.Values) io.Reader { return strings.NewReader(v.Encode()) }
+		if err := mreg.SetMaintenance("Migrating notes until 14:00"); err != nil { t.Fatal(err) }
+		if rec := do("editor", "GET", "/admin/Note", nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), "Migrating notes until 14:00") { t.Errorf("Expected reads allowed with a banner, got %d", rec.Code) }
+		if rec := do("editor", "POST", "/admin/Note/save", form(url.Values{"Title": {"Second"}})); rec.Code != 503 || !strings.Contains(rec.Body.String(), "Changes are paused") { t.Errorf("Expected the save refused with the maintenance page, got %d", rec.Code) }
+		if rec := do("editor", "PATCH", "/admin/Note/inline_update", strings.NewReader(`{"id": "1", "field": "Title", "value": "Renamed"}`), "Content-Type", "application/json", "Accept", "application/json"); rec.Code != 503 || !strings.Contains(rec.Body.String(), `"error"`) { t.Errorf("Expected a JSON 503 for inline edits, got %d %s", rec.Code, rec.Body.String()) }
+		if rec := do("editor", "POST", "/admin/api/Note/bulk", strings.NewReader(`[{"Title": "Bulk"}]`), "Content-Type", "application/json"); rec.Code != 503 { t.Errorf("Expected bulk imports refused, got %d", rec.Code) }
+		if rec := do("ops", "POST", "/admin/Note/save", form(url.Values{"Title": {"Hotfix"}})); rec.Code != 303 { t.Errorf("Expected the override role to write, got %d", rec.Code) }
+		var count int64
+		mdb.Model(&Note{}).Count(&count)
+		if count != 2 { t.Errorf("Expected only the override role's note saved, got %d notes", count) }
+
+		// The state is stored, so a restarted process stays frozen; admins end it from the maintenance page.
+		if !NewRegistry(mdb).maintenanceBlocks(&AdminUser{Role: "editor"}) { t.Error("Expected maintenance mode to survive a restart") }
+		if rec := do("editor", "GET", "/admin/maintenance", nil); rec.Code != 403 { t.Errorf("Expected the switch to be admin-only, got %d", rec.Code) }
+		if rec := do("admin", "POST", "/admin/maintenance/off", nil); rec.Code != 303 { t.Fatalf("Expected maintenance ended, got %d", rec.Code) }
+		if rec := do("editor", "POST", "/admin/Note/save", form(url.Values{"Title": {"After"}})); rec.Code != 303 { t.Errorf("Expected writes allowed again, got %d", rec.Code) }
+		var audits []AuditLog
+		mdb.Where("resource_name = ?", "maintenance").Order("id").Find(&audits)
+		if len(audits) != 2 || audits[0].Action != "Maintenance on" || audits[0].UserEmail != "system" || audits[1].Action != "Maintenance off" || audits[1].UserEmail != "admin@example.com" { t.Errorf("Expected both changes audited, got %+v", audits) }
+	})
+
+	t.Run("AppSettings", func(t *testing.T) {
+		sdb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := sdb.DB(); sqlDB.SetMaxOpenConns(1)
+		sdb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &Permission{}, &Setting{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"support", "support"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			sdb.Create(au)
+			sdb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		sdb.Create(&Permission{Role: "support", ResourceName: "settings.general", Action: "show"})
+		sdb.Create(&Permission{Role: "support", ResourceName: "settings.general", Action: "save"})
+		sreg := NewRegistry(sdb)
+		sreg.RegisterSettings("General", []Field{
+			{Name: "support_email", Label: "Support email", Default: "help@example.com"},
+			{Name: "signups_open", Type: "bool", Default: true},
+			{Name: "page_size", Type: "int", Default: 25},
+			{Name: "theme", Type: "select", Options: []string{"light", "dark"}, Default: "light"},
+			{Name: "limits", Type: "json", Default: map[string]int{"uploads": 10}},
+		})
+		sreg.RegisterSettings("Billing", []Field{{Name: "tax_rate", Type: "int"}})
+		do := func(session, method, path string, body url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			rec := httptest.NewRecorder()
+			sreg.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// Unsaved settings read as their defaults, typed by the field.
+		var limits map[string]int
+		if err := sreg.SettingJSON("limits", &limits); err != nil || limits["uploads"] != 10 { t.Errorf("Expected the JSON default, got %v %v", limits, err) }
+		if sreg.SettingString("support_email") != "help@example.com" || !sreg.SettingBool("signups_open") || sreg.SettingInt("page_size") != 25 { t.Error("Expected typed defaults") }
+		if _, ok := sreg.Setting("tax_rate"); ok { t.Error("Expected a setting without a default to be unset") }
+
+		rec := do("support", "POST", "/admin/settings/general", url.Values{"support_email": {"care@example.com"}, "page_size": {"50"}, "theme": {"dark"}, "limits": {`{"uploads": 20}`}})
+		if rec.Code != 303 { t.Fatalf("Expected the group saved, got %d: %s", rec.Code, rec.Body.String()) }
+		if sreg.SettingString("support_email") != "care@example.com" || sreg.SettingBool("signups_open") || sreg.SettingInt("page_size") != 50 || sreg.SettingString("theme") != "dark" { t.Error("Expected the saved values to be read back at once") }
+		if err := sreg.SettingJSON("limits", &limits); err != nil || limits["uploads"] != 20 { t.Errorf("Expected the saved JSON, got %v %v", limits, err) }
+		var audit AuditLog
+		sdb.Where("resource_name = ? AND record_id = ?", "settings", "general").First(&audit)
+		if !strings.Contains(audit.Changes, `page_size: "50"`) || !strings.Contains(audit.Changes, `signups_open: "false"`) || audit.UserEmail != "support@example.com" { t.Errorf("Expected the change audited with a diff, got %+v", audit) }
+
+		// Invalid values are refused field by field and nothing is saved.
+		rec = do("support", "POST", "/admin/settings/general", url.Values{"support_email": {"x@example.com"}, "page_size": {"many"}, "theme": {"neon"}, "limits": {"{"}})
+		if rec.Code != 422 || !strings.Contains(rec.Body.String(), "must be a whole number") || !strings.Contains(rec.Body.String(), "must be valid JSON") { t.Errorf("Expected the form with errors, got %d", rec.Code) }
+		if sreg.SettingString("support_email") != "care@example.com" { t.Error("Expected nothing saved from an invalid form") }
+
+		// Each group has its own permissions.
+		if rec := do("support", "GET", "/admin/settings", nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), "care@example.com") || strings.Contains(rec.Body.String(), "/settings/billing") { t.Errorf("Expected only the general settings shown, got %d", rec.Code) }
+		if rec := do("support", "POST", "/admin/settings/billing", url.Values{"tax_rate": {"20"}}); rec.Code != 403 { t.Errorf("Expected billing settings forbidden, got %d", rec.Code) }
+		if rec := do("admin", "POST", "/admin/settings/billing", url.Values{"tax_rate": {"20"}}); rec.Code != 303 || sreg.SettingInt("tax_rate") != 20 { t.Errorf("Expected admins to edit every group, got %d", rec.Code) }
+
+		// The maintenance flag's name is reported by Validate and never saved as a setting.
+		if errs := sreg.Validate(); len(errs) != 0 { t.Errorf("Expected sound settings, got %v", errs) }
+		sreg.RegisterSettings("Ops", []Field{{Name: "maintenance", Type: "bool"}})
+		if errs := sreg.Validate(); len(errs) != 1 || errs[0].Error() != `settings Ops: field "maintenance" is reserved for maintenance mode` { t.Errorf("Expected the reserved name reported, got %v", errs) }
+		do("admin", "POST", "/admin/settings/ops", url.Values{"maintenance": {"true"}})
+		var flags int64
+		sdb.Model(&Setting{}).Where("name = ?", "maintenance").Count(&flags)
+		if flags != 0 { t.Error("Expected the reserved field not to switch maintenance mode on") }
+	})
+	t.Run("OpenAPISpec", func(t *testing.T) {
+		type Invoice struct {
+			ID        uint `gorm:"primaryKey"`
+			Number    string
+			Status    string
+			Total     float64
+			Paid      bool
+			DueAt     *time.Time
+			Labels    string
+			CreatedAt time.Time
+		}
+		type LedgerEntry struct {
+			ID     int64 `gorm:"primaryKey"`
+			Amount int
+		}
+		type Secret struct {
+			ID    uint `gorm:"primaryKey"`
+			Value string
+		}
+		odb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := odb.DB(); sqlDB.SetMaxOpenConns(1)
+		odb.AutoMigrate(&AdminUser{}, &Session{}, &Permission{}, &Invoice{}, &LedgerEntry{}, &Secret{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"editor", "editor"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			odb.Create(au)
+			odb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		odb.Create(&Permission{Role: "editor", ResourceName: "Invoice", Action: "list"})
+		oreg := NewRegistry(odb)
+		oreg.Config.SiteTitle, oreg.Config.OpenAPIToken = "Billing", "spec-token"
+		invoices := oreg.Register(Invoice{}).RegisterModelFields().SetFieldType("Status", "select", "draft", "sent", "paid").
+			SetFieldType("Labels", "tags").AddVirtualField("Summary", "Summary", func(db *gorm.DB, m map[string]interface{}) interface{} { return m["Number"] }).
+			AddScope("Unpaid", "Unpaid", func(db *gorm.DB) *gorm.DB { return db.Where("paid = ?", false) })
+		for i := range invoices.Fields { invoices.Fields[i].Required = invoices.Fields[i].Name == "Number" }
+		oreg.Register(LedgerEntry{}).RegisterModelFields().SetReadOnly(true).UseCursorPagination()
+		oreg.Register(Secret{}).RegisterModelFields().DisableAPI()
+
+		got, err := json.MarshalIndent(oreg.OpenAPISpec(), "", "  ")
+		if err != nil { t.Fatal(err) }
+		golden := filepath.Join("testdata", "openapi.golden.json")
+		if *updateGolden {
+			os.MkdirAll("testdata", 0o755)
+			if err := os.WriteFile(golden, append(got, '\n'), 0o644); err != nil { t.Fatal(err) }
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil { t.Fatalf("Expected the golden spec (run with -update to create it): %v", err) }
+		if string(got)+"\n" != string(want) { t.Errorf("The OpenAPI spec changed; review the diff and run with -update if it's intended.\ngot:\n%s", got) }
+
+		do := func(header, value string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/admin/api/openapi.json", nil)
+			if header != "" { req.Header.Set(header, value) }
+			rec := httptest.NewRecorder()
+			oreg.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := do("Cookie", "admin_session=admin"); rec.Code != 200 || !strings.Contains(rec.Body.String(), `"/Invoice/show"`) { t.Errorf("Expected admins to get the spec, got %d", rec.Code) }
+		if rec := do("Authorization", "Bearer admin"); rec.Code != 401 { t.Errorf("Expected a session token sent as a bearer token ignored, got %d", rec.Code) }
+		if rec := do("Authorization", "Bearer spec-token"); rec.Code != 200 { t.Errorf("Expected the spec token to work without a session, got %d", rec.Code) }
+		if rec := do("Cookie", "admin_session=editor"); rec.Code != 403 { t.Errorf("Expected other roles refused, got %d", rec.Code) }
+		if rec := do("", ""); rec.Code != 401 { t.Errorf("Expected anonymous clients refused, got %d", rec.Code) }
+
+		// A resource left out of the spec is refused by the API too, while its pages still work.
+		for _, path := range []string{"/admin/Secret?format=json", "/admin/Secret/search?q=a"} {
+			req := httptest.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "admin"})
+			rec := httptest.NewRecorder()
+			oreg.ServeHTTP(rec, req)
+			if rec.Code != 404 { t.Errorf("Expected %s refused for an API-disabled resource, got %d", path, rec.Code) }
+		}
+	})
+	t.Run("DuplicateCheck", func(t *testing.T) {
+		type Client struct {
+			ID    uint `gorm:"primaryKey"`
+			Name  string
+			Email string
+			OrgID uint
+		}
+		ddb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := ddb.DB(); sqlDB.SetMaxOpenConns(1)
+		ddb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &Permission{}, &Client{})
+		staff := &AdminUser{Email: "staff@example.com", Role: "staff", Active: true}
+		ddb.Create(staff)
+		ddb.Create(&Session{ID: hashToken("staff"), UserID: staff.ID, Role: staff.Role, ExpiresAt: time.Now().Add(time.Hour)})
+		for _, a := range []string{"list", "show", "new", "save"} { ddb.Create(&Permission{Role: "staff", ResourceName: "Client", Action: a}) }
+		ddb.Create(&Client{Name: "Acme Ltd", Email: "hello@acme.test", OrgID: 1})
+		ddb.Create(&Client{Name: "Globex", Email: "info@globex.test", OrgID: 2})
+		dreg := NewRegistry(ddb)
+		res := dreg.Register(Client{}).RegisterModelFields().DuplicateCheck([]string{"Email", "Name"}, nil)
+		dreg.ScopeAll(func(user *AdminUser, res *Resource, q *gorm.DB) *gorm.DB { return q.Where("org_id = ?", 1) })
+		do := func(method, path string, body url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "staff"})
+			rec := httptest.NewRecorder()
+			dreg.ServeHTTP(rec, req)
+			return rec
+		}
+		count := func() (n int64) { ddb.Model(&Client{}).Count(&n); return }
+
+		rec := do("POST", "/admin/Client/save", url.Values{"Name": {"Acme Limited"}, "Email": {"HELLO@acme.test"}})
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "Acme Ltd") || !strings.Contains(rec.Body.String(), "/admin/Client/show?id=1") || !strings.Contains(rec.Body.String(), "Create anyway") { t.Errorf("Expected the save held with the likely duplicate listed, got %d", rec.Code) }
+		if count() != 2 { t.Error("Expected nothing saved while a duplicate is pending") }
+		if rec := do("POST", "/admin/Client/save", url.Values{"Name": {"Acme Limited"}, "Email": {"HELLO@acme.test"}, "_create_anyway": {"1"}}); rec.Code != 303 || count() != 3 { t.Errorf("Expected create anyway to save, got %d", rec.Code) }
+		// Another tenant's record is no duplicate as far as this user can tell.
+		if rec := do("POST", "/admin/Client/save", url.Values{"Name": {"Globex"}, "Email": {"info@globex.test"}}); rec.Code != 303 { t.Errorf("Expected records outside the scope ignored, got %d", rec.Code) }
+
+		rec = do("GET", "/admin/Client/duplicates?Email=hello@acme.test", nil)
+		var body struct{ Matches []DuplicateMatch }
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != 200 || len(body.Matches) != 2 || body.Matches[0].Label != "Acme Ltd" { t.Errorf("Expected the JSON check to list both Acme records, got %d %s", rec.Code, rec.Body.String()) }
+
+		// A matcher that escapes the scope still only reports records the user may see.
+		res.DuplicateMatcher = func(db *gorm.DB, values map[string]string) []map[string]interface{} {
+			var all []Client
+			ddb.Find(&all)
+			found := make([]map[string]interface{}, len(all))
+			for i, c := range all { found[i] = map[string]interface{}{"id": c.ID, "label": c.Name} }
+			return found
+		}
+		body.Matches = nil
+		json.Unmarshal(do("GET", "/admin/Client/duplicates?Name=x", nil).Body.Bytes(), &body)
+		for _, m := range body.Matches { if m.Label == "Globex" && m.ID == "2" { t.Error("Expected out-of-scope matches dropped") } }
+		if len(body.Matches) != 3 { t.Errorf("Expected the in-scope matches kept, got %+v", body.Matches) }
+	})
+	t.Run("DeleteDependents", func(t *testing.T) {
+		type Account struct {
+			ID   uint `gorm:"primaryKey"`
+			Name string
+		}
+		type Purchase struct {
+			ID        uint `gorm:"primaryKey"`
+			AccountID uint
+			DeletedAt gorm.DeletedAt
+		}
+		type Address struct {
+			ID        uint `gorm:"primaryKey"`
+			AccountID *uint
+		}
+		type Profile struct {
+			ID        uint `gorm:"primaryKey"`
+			AccountID uint
+		}
+		ddb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := ddb.DB(); sqlDB.SetMaxOpenConns(1)
+		ddb.AutoMigrate(&AdminUser{}, &Session{}, &AuditLog{}, &UserPreference{}, &SavedFilter{}, &Permission{}, &Account{}, &Purchase{}, &Address{}, &Profile{})
+		au := &AdminUser{Email: "admin@example.com", Role: "admin", Active: true}
+		ddb.Create(au)
+		ddb.Create(&Session{ID: hashToken("admin"), UserID: au.ID, Role: "admin", ExpiresAt: time.Now().Add(time.Hour)})
+		dreg := NewRegistry(ddb)
+		dreg.Register(Account{}).RegisterModelFields().
+			HasMany("Purchases", "Purchases", "Purchase", "AccountID").
+			HasMany("Addresses", "Addresses", "Address", "AccountID").SetOnDelete("Addresses", DependentNullify).
+			HasOne("Profile", "Profile", "Profile", "AccountID").SetOnDelete("Profile", DependentCascade)
+		dreg.Register(Purchase{}).RegisterModelFields()
+		dreg.Register(Address{}).RegisterModelFields()
+		dreg.Register(Profile{}).RegisterModelFields()
+		if errs := dreg.Validate(); len(errs) != 0 { t.Errorf("Expected the strategies to validate, got %v", errs) }
+		do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: "admin"})
+			rec := httptest.NewRecorder()
+			dreg.ServeHTTP(rec, req)
+			return rec
+		}
+		count := func(model interface{}, where string, args ...interface{}) (n int64) { ddb.Model(model).Where(where, args...).Count(&n); return }
+		acct := &Account{Name: "Acme"}
+		ddb.Create(acct)
+		live, old := &Purchase{AccountID: acct.ID}, &Purchase{AccountID: acct.ID}
+		ddb.Create(live); ddb.Create(old); ddb.Delete(old)
+		ddb.Create(&Address{AccountID: &acct.ID}); ddb.Create(&Address{AccountID: &acct.ID})
+		ddb.Create(&Profile{AccountID: acct.ID})
+		path := fmt.Sprintf("/admin/Account/delete?id=%d", acct.ID)
+
+		rec := do("POST", path, url.Values{"confirm": {"1"}})
+		if body := rec.Body.String(); rec.Code != 409 || !strings.Contains(body, "This account has 1 purchases, 2 addresses and 1 profile.") || strings.Contains(body, `name="confirm"`) && strings.Contains(body, ">Delete</button>") {
+			t.Errorf("Expected a live purchase to block the delete, trashed ones not counted, got %d: %s", rec.Code, body)
+		}
+		if count(&Account{}, "id = ?", acct.ID) != 1 { t.Fatal("Expected the blocked account kept") }
+
+		ddb.Delete(live)
+		rec = do("GET", path, nil)
+		if body := rec.Body.String(); rec.Code != 200 || !strings.Contains(body, "This account has 2 addresses and 1 profile.") || !strings.Contains(body, "will be unlinked and kept") || !strings.Contains(body, "will be deleted too") {
+			t.Errorf("Expected a confirmation listing the dependents' strategies, got %d: %s", rec.Code, body)
+		}
+		if count(&Account{}, "id = ?", acct.ID) != 1 { t.Fatal("Expected nothing deleted before confirming") }
+		if rec = do("POST", path, url.Values{"confirm": {"1"}}); rec.Code != 303 { t.Fatalf("Expected the confirmed delete to redirect, got %d: %s", rec.Code, rec.Body.String()) }
+		if count(&Account{}, "id = ?", acct.ID) != 0 || count(&Profile{}, "account_id = ?", acct.ID) != 0 || count(&Address{}, "account_id IS NULL") != 2 || count(&Address{}, "1 = 1") != 2 {
+			t.Error("Expected the account deleted, its profile cascaded and its addresses unlinked")
+		}
+		var audit AuditLog
+		ddb.Where("resource_name = ? AND action = ?", "Account", "Delete").First(&audit)
+		if !strings.Contains(audit.Changes, "deleted 1 profile") || !strings.Contains(audit.Changes, "unlinked 2 addresses") { t.Errorf("Expected the delete audited with its dependents, got %q", audit.Changes) }
+		if count(&AuditLog{}, "resource_name = ? AND action = ? AND changes = ?", "Profile", "Delete", fmt.Sprintf("Deleted with Account #%d", acct.ID)) != 1 || count(&AuditLog{}, "resource_name = ? AND action = ?", "Address", "Update") != 2 {
+			t.Error("Expected the cascaded and unlinked records audited")
+		}
+
+		plain := &Account{Name: "Plain"}
+		ddb.Create(plain)
+		if rec = do("GET", fmt.Sprintf("/admin/Account/delete?id=%d", plain.ID), nil); rec.Code != 303 || count(&Account{}, "id = ?", plain.ID) != 0 { t.Errorf("Expected a record without dependents deleted straight away, got %d", rec.Code) }
+
+		blocked, cascaded := &Account{Name: "Blocked"}, &Account{Name: "Cascaded"}
+		ddb.Create(blocked); ddb.Create(cascaded)
+		ddb.Create(&Purchase{AccountID: blocked.ID}); ddb.Create(&Profile{AccountID: cascaded.ID})
+		ids := []string{fmt.Sprint(blocked.ID), fmt.Sprint(cascaded.ID)}
+		confirm := do("POST", "/admin/Account/batch_action", url.Values{"action_name": {"delete_selected"}, "ids": ids}).Body.String()
+		if !strings.Contains(confirm, "These records have 1 purchases and 1 profile.") || !strings.Contains(confirm, "will be skipped") { t.Errorf("Expected the batch confirmation to aggregate dependents, got %s", confirm) }
+		rec = do("POST", "/admin/Account/batch_action", url.Values{"action_name": {"delete_selected"}, "ids": ids, "confirm": {"1"}})
+		if count(&Account{}, "id = ?", blocked.ID) != 1 || count(&Account{}, "id = ?", cascaded.ID) != 0 || count(&Profile{}, "account_id = ?", cascaded.ID) != 0 || count(&Purchase{}, "account_id = ?", blocked.ID) != 1 {
+			t.Error("Expected the blocked record skipped and the other deleted with its profile")
+		}
+		if flash := rec.Header().Get("Set-Cookie"); !strings.Contains(flash, "Deleted 1 records") || !strings.Contains(flash, "still has 1 purchases") { t.Errorf("Expected the failure listed, got %q", flash) }
+
+		dreg.Register(Purchase{}).HasMany("Addresses", "Addresses", "Profile", "AccountID").SetOnDelete("Addresses", DependentNullify).HasOne("Other", "Other", "Profile", "AccountID").SetOnDelete("Other", "destroy")
+		problems := fmt.Sprint(dreg.Validate())
+		if !strings.Contains(problems, "can't hold NULL") || !strings.Contains(problems, `unknown on-delete strategy "destroy"`) { t.Errorf("Expected bad strategies reported, got %s", problems) }
+	})
+	t.Run("Drafts", func(t *testing.T) {
+		type Ticket struct {
+			ID        uint `gorm:"primaryKey"`
+			Title     string
+			Priority  int
+			Secret    string
+			UpdatedAt time.Time
+		}
+		ddb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		sqlDB, _ := ddb.DB(); sqlDB.SetMaxOpenConns(1)
+		dreg := NewRegistry(ddb)
+		dreg.Config.Drafts = true
+		if err := dreg.Migrate(); err != nil { t.Fatal(err) }
+		ddb.AutoMigrate(&Ticket{})
+		for _, u := range []struct{ key, role string }{{"admin", "admin"}, {"viewer", "viewer"}} {
+			au := &AdminUser{Email: u.key + "@example.com", Role: u.role, Active: true}
+			ddb.Create(au)
+			ddb.Create(&Session{ID: hashToken(u.key), UserID: au.ID, Role: u.role, ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		ddb.Create(&Permission{Role: "viewer", ResourceName: "Ticket", Action: "show"})
+		dreg.Register(Ticket{}).RegisterModelFields().SetFieldType("Secret", "password")
+		ticket := &Ticket{Title: "Printer jam", Priority: 1, UpdatedAt: time.Now().Add(-time.Hour)}
+		ddb.Create(ticket)
+		ddb.Model(ticket).UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+		do := func(who, method, path string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: who})
+			rec := httptest.NewRecorder()
+			dreg.ServeHTTP(rec, req)
+			return rec
+		}
+		draftPath := fmt.Sprintf("/admin/Ticket/draft?id=%d", ticket.ID)
+		editPath := fmt.Sprintf("/admin/Ticket/edit?id=%d", ticket.ID)
+
+		if body := do("admin", "GET", editPath, nil).Body.String(); !strings.Contains(body, `data-draft-url="/admin/Ticket/draft?id=1"`) || strings.Contains(body, "Restore unsaved draft") { t.Error("Expected the form to autosave, with no draft to offer yet") }
+		if rec := do("viewer", "POST", draftPath, url.Values{"Title": {"x"}}); rec.Code != 403 { t.Errorf("Expected drafts to need the edit permission, got %d", rec.Code) }
+		if rec := do("admin", "POST", draftPath, url.Values{"Title": {"Printer on fire"}, "Priority": {"3"}, "Secret": {"hunter2"}}); rec.Code != 204 { t.Fatalf("Expected the autosave accepted, got %d: %s", rec.Code, rec.Body.String()) }
+		var stored Draft
+		ddb.First(&stored)
+		if stored.RecordID != fmt.Sprint(ticket.ID) || !strings.Contains(stored.Values, "Printer on fire") || strings.Contains(stored.Values, "hunter2") || strings.Contains(stored.Values, "Secret") { t.Errorf("Expected the draft stored without the password, got %+v", stored) }
+		var unchanged Ticket
+		ddb.First(&unchanged, ticket.ID)
+		if unchanged.Title != "Printer jam" { t.Error("Expected a draft to leave the record alone") }
+
+		offer := do("admin", "GET", editPath, nil).Body.String()
+		if !strings.Contains(offer, "Restore unsaved draft from "+stored.UpdatedAt.Format("15:04")+"?") || !strings.Contains(offer, `value="Printer jam"`) { t.Errorf("Expected the draft offered over the record's values, got %s", offer) }
+		restored := do("admin", "GET", editPath+"&draft=1", nil).Body.String()
+		if !strings.Contains(restored, `value="Printer on fire"`) || !strings.Contains(restored, `value="3"`) || !strings.Contains(restored, "Restored your unsaved draft") { t.Errorf("Expected the draft's values in the form, got %s", restored) }
+
+		ddb.Model(&Ticket{}).Where("id = ?", ticket.ID).UpdateColumn("updated_at", time.Now().Add(time.Minute))
+		if strings.Contains(do("admin", "GET", editPath, nil).Body.String(), "Restore unsaved draft") { t.Error("Expected a draft older than the record not offered") }
+		ddb.Model(&Ticket{}).Where("id = ?", ticket.ID).UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+		ddb.Model(&Draft{}).Where("id = ?", stored.ID).Update("expires_at", time.Now().Add(-time.Minute))
+		if strings.Contains(do("admin", "GET", editPath, nil).Body.String(), "Restore unsaved draft") { t.Error("Expected an expired draft not offered") }
+
+		do("admin", "POST", draftPath, url.Values{"Title": {"Again"}})
+		if rec := do("admin", "POST", draftPath+"&discard=1", nil); rec.Code != 204 { t.Errorf("Expected discarding accepted, got %d", rec.Code) }
+		var drafts int64
+		if ddb.Model(&Draft{}).Count(&drafts); drafts != 0 { t.Errorf("Expected the draft discarded, %d left", drafts) }
+
+		do("admin", "POST", draftPath, url.Values{"Title": {"Saved title"}})
+		do("admin", "POST", "/admin/Ticket/draft", url.Values{"Title": {"Brand new"}})
+		if body := do("admin", "GET", "/admin/Ticket/new?draft=1", nil).Body.String(); !strings.Contains(body, `value="Brand new"`) { t.Error("Expected a new record's draft restored on the new form") }
+		if rec := do("admin", "POST", fmt.Sprintf("/admin/Ticket/save?id=%d", ticket.ID), url.Values{"Title": {"Saved title"}, "Priority": {"2"}}); rec.Code != 303 { t.Fatalf("Expected the save to redirect, got %d", rec.Code) }
+		if ddb.Model(&Draft{}).Where("record_id = ?", fmt.Sprint(ticket.ID)).Count(&drafts); drafts != 0 { t.Error("Expected saving to clear the record's draft") }
+		do("admin", "POST", "/admin/Ticket/save", url.Values{"Title": {"Brand new"}, "Priority": {"1"}})
+		if ddb.Model(&Draft{}).Count(&drafts); drafts != 0 { t.Error("Expected creating to clear the new record's draft") }
+
+		dreg.Config.Drafts = false
+		if rec := do("admin", "POST", draftPath, url.Values{"Title": {"x"}}); rec.Code != 404 { t.Errorf("Expected drafts off by default, got %d", rec.Code) }
+		if strings.Contains(do("admin", "GET", editPath, nil).Body.String(), `data-draft-url="`) { t.Error("Expected no autosave with drafts off") }
+	})
+}
+
+// BenchmarkListRendering converts a page of 1000 rows of 15 fields to the maps list templates render.
+func BenchmarkListRendering(b *testing.B) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	reg := NewRegistry(db)
+	res := reg.Register(Wide{}).RegisterModelFields()
+	rows := make([]Wide, 1000)
+	for i := range rows { rows[i] = Wide{ID: uint(i + 1), Name: fmt.Sprint("Row ", i), Score: i, Active: i%2 == 0} }
+	slice := reflect.ValueOf(rows)
+	fields := res.GetFieldsFor("index")
+	if len(fields) != 15 { b.Fatalf("expected 15 fields, got %d", len(fields)) }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < slice.Len(); j++ { rawValues(res, slice.Index(j)); recordKey(res, slice.Index(j)) }
+		reg.sliceToMap(res, fields, slice, nil)
+	}
+}
+
+// fakeRedis serves the handful of Redis commands RedisSessionStore uses, ignoring expiry, and returns its address.
+func fakeRedis(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	strs, sets := map[string]string{}, map[string]map[string]bool{}
+	handle := func(args []string) string {
+		mu.Lock(); defer mu.Unlock()
+		bulk := func(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+		array := func(items []string) string {
+			out := fmt.Sprintf("*%d\r\n", len(items))
+			for _, it := range items { out += bulk(it) }
+			return out
+		}
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			_, exists := strs[args[1]]
+			if (slices.Contains(args, "NX") && exists) || (slices.Contains(args, "XX") && !exists) { return "$-1\r\n" }
+			strs[args[1]] = args[2]; return "+OK\r\n"
+		case "GET":
+			if v, ok := strs[args[1]]; ok { return bulk(v) }
+			return "$-1\r\n"
+		case "DEL":
+			for _, k := range args[1:] { delete(strs, k); delete(sets, k) }
+			return ":1\r\n"
+		case "SADD":
+			if sets[args[1]] == nil { sets[args[1]] = map[string]bool{} }
+			sets[args[1]][args[2]] = true; return ":1\r\n"
+		case "SREM":
+			delete(sets[args[1]], args[2]); return ":1\r\n"
+		case "SMEMBERS":
+			var items []string
+			for m := range sets[args[1]] { items = append(items, m) }
+			return array(items)
+		case "PEXPIRE":
+			return ":1\r\n"
+		case "PTTL":
+			return ":60000\r\n"
+		case "SCAN":
+			var keys []string
+			prefix := strings.TrimSuffix(args[3], "*")
+			for k := range strs { if strings.HasPrefix(k, prefix) { keys = append(keys, k) } }
+			return "*2\r\n" + bulk("0") + array(keys)
+		}
+		return "-ERR unknown command\r\n"
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil { return }
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var n int
+					if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil { return }
+					args := make([]string, n)
+					for i := range args {
+						var size int
+						if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil { return }
+						buf := make([]byte, size+2)
+						if _, err := io.ReadFull(r, buf); err != nil { return }
+						args[i] = string(buf[:size])
+					}
+					io.WriteString(conn, handle(args))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
 }
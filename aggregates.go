@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"html/template"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// countTarget resolves the associated resource and foreign key column a "count" field counts.
+func (reg *Registry) countTarget(res *resource.Resource, f resource.Field) (*resource.Resource, *schema.Schema, string, error) {
+	assoc, ok := res.GetAssociation(f.CountOf)
+	if !ok || assoc.Type != "HasMany" { return nil, nil, "", fmt.Errorf("count field %q: %s has no HasMany association %q", f.Name, res.Name, f.CountOf) }
+	target, ok := reg.GetResource(assoc.ResourceName)
+	if !ok { return nil, nil, "", fmt.Errorf("association %q: unknown resource %q", assoc.Name, assoc.ResourceName) }
+	sch, err := reg.parseSchema(target.Model)
+	if err != nil { return nil, nil, "", err }
+	fk, ok := column(sch, assoc.ForeignKey)
+	if !ok { return nil, nil, "", fmt.Errorf("association %q: cannot resolve foreign key %q", assoc.Name, assoc.ForeignKey) }
+	return target, sch, fk, nil
+}
+
+// countSubquery is the correlated COUNT behind a "count" field, used to sort and total by it.
+func (reg *Registry) countSubquery(res *resource.Resource, sch *schema.Schema, f resource.Field) (string, error) {
+	_, targetSch, fk, err := reg.countTarget(res, f)
+	if err != nil { return "", err }
+	pk, ok := column(sch, res.PrimaryKey)
+	if !ok { return "", fmt.Errorf("admin: %s has no key field %q", res.Name, res.PrimaryKey) }
+	cond := fk + " = " + pk
+	if del := targetSch.LookUpField("DeletedAt"); del != nil && del.DBName != "" { cond += " AND " + targetSch.Table + "." + del.DBName + " IS NULL" }
+	return fmt.Sprintf("(SELECT COUNT(*) FROM %s WHERE %s)", targetSch.Table, cond), nil
+}
+
+// relatedCounts counts the associated records of every row for each "count" field among fields, with one grouped
+// query per field rather than one per row. Counts are keyed by field name, then by the row's key formatted with %v.
+func (reg *Registry) relatedCounts(db *gorm.DB, res *resource.Resource, fields []resource.Field, rows reflect.Value) (map[string]map[string]int64, error) {
+	counts := make(map[string]map[string]int64)
+	var keys []interface{}
+	for i := 0; i < rows.Len(); i++ { keys = append(keys, recordKey(res, reflect.Indirect(rows.Index(i)))) }
+	for _, f := range fields {
+		if f.CountOf == "" { continue }
+		counts[f.Name] = make(map[string]int64)
+		if len(keys) == 0 { continue }
+		target, _, fk, err := reg.countTarget(res, f)
+		if err != nil { return nil, err }
+		sqlRows, err := reg.scope(db.Statement.Context, target, db.Model(target.Model)).Select(fk+", COUNT(*)").Where(fk+" IN ?", keys).Group(fk).Rows()
+		if err != nil { return nil, err }
+		for sqlRows.Next() {
+			var key interface{}; var n int64
+			if err := sqlRows.Scan(&key, &n); err != nil { sqlRows.Close(); return nil, err }
+			if b, ok := key.([]byte); ok { key = string(b) }
+			counts[f.Name][fmt.Sprintf("%v", key)] = n
+		}
+		sqlRows.Close()
+		if err := sqlRows.Err(); err != nil { return nil, err }
+	}
+	return counts, nil
+}
+
+// setCounts fills the "count" fields of list or show data, each linking to the associated list filtered to the row.
+func (reg *Registry) setCounts(res *resource.Resource, fields []resource.Field, data []map[string]interface{}, counts map[string]map[string]int64) {
+	for _, f := range fields {
+		if f.CountOf == "" { continue }
+		target, _, _, err := reg.countTarget(res, f)
+		if err != nil { continue }
+		assoc, _ := res.GetAssociation(f.CountOf)
+		for _, m := range data {
+			key := fmt.Sprintf("%v", m[keyEntry])
+			n := counts[f.Name][key]
+			m[f.Name] = n
+			m[f.Name+"__html"] = template.HTML(fmt.Sprintf(`<a href="%s" class="count-link">%d</a>`, template.HTMLEscapeString(reg.URL("/"+target.Slug+"?eq_"+assoc.ForeignKey+"="+url.QueryEscape(key))), n))
+		}
+	}
+}
+
+// footerTotals computes res's footer aggregates over every record the list query matches, in a single query. Only
+// aggregates of the shown fields are computed; the result maps field name to the formatted total.
+func (reg *Registry) footerTotals(res *resource.Resource, fields []resource.Field, lq *listQuery) (map[string]template.HTML, error) {
+	shown := make(map[string]resource.Field)
+	for _, f := range fields { shown[f.Name] = f }
+	var aggs []resource.FooterAggregate
+	var exprs []string
+	for _, a := range res.FooterAggregates {
+		fn := strings.ToUpper(a.Func)
+		if fn != "SUM" && fn != "AVG" { return nil, fmt.Errorf("footer aggregate %q: unknown function %q", a.Field, a.Func) }
+		if _, ok := shown[a.Field]; !ok { continue }
+		col, ok := lq.Counts[a.Field]
+		if !ok { if col, ok = column(lq.Schema, a.Field); !ok { return nil, fmt.Errorf("footer aggregate: %s has no field %q", res.Name, a.Field) } }
+		aggs, exprs = append(aggs, a), append(exprs, fmt.Sprintf("%s(%s)", fn, col))
+	}
+	if len(aggs) == 0 { return nil, nil }
+	q := lq.DB.Session(&gorm.Session{})
+	// Joins may repeat a record, so the totals then run over the distinct matching keys.
+	if lq.Joined { q = reg.scope(q.Statement.Context, res, reg.resourceReader(q.Statement.Context, res).Model(res.Model)).Where(lq.PK+" IN (?)", q.Distinct(lq.PK)) }
+	vals := make([]sql.NullFloat64, len(aggs))
+	dest := make([]interface{}, len(aggs))
+	for i := range vals { dest[i] = &vals[i] }
+	if err := q.Select(strings.Join(exprs, ", ")).Row().Scan(dest...); err != nil { return nil, err }
+	totals := make(map[string]template.HTML)
+	for i, a := range aggs {
+		label := "Total"; if strings.EqualFold(a.Func, "avg") { label = "Average" }
+		totals[a.Field] = template.HTML(fmt.Sprintf(`<span class="footer-label">%s</span> %s`, label, formatTotal(shown[a.Field], vals[i].Float64)))
+	}
+	return totals, nil
+}
+
+// formatTotal formats an aggregate like the field's cells where the field has a type format, rounding averages of
+// integer amounts to whole minor units.
+func formatTotal(f resource.Field, v float64) template.HTML {
+	if _, display, ok := formatTypedField(f, int64(math.Round(v))); ok { return display }
+	return template.HTML(strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64))
+}
@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+// assignmentEmail is the data for templates/emails/assignment.html.
+type assignmentEmail struct {
+	SiteTitle, Actor, Resource, RecordID, Label, Link string
+}
+
+// assignField returns the field a resource's records are assigned through.
+func assignField(res *resource.Resource) (resource.Field, bool) {
+	for _, f := range res.Fields { if f.Name == res.AssignField && res.AssignField != "" { return f, true } }
+	return resource.Field{}, false
+}
+
+// assignableUsers lists the active users records of res can be assigned to, by email.
+func (reg *Registry) assignableUsers(db *gorm.DB, res *resource.Resource) ([]models.AdminUser, error) {
+	q := db.Where("active = ?", true)
+	if len(res.AssignRoles) > 0 { q = q.Where("role IN ?", res.AssignRoles) }
+	var users []models.AdminUser
+	return users, q.Order("email").Find(&users).Error
+}
+
+// offersAssignees reports whether a list page lets user pick an assignee, so it needs assignableUsers: in the
+// assignee filter, shown while the field is visible to them, or in the field's inline editor.
+func offersAssignees(res *resource.Resource, user *models.AdminUser, inline map[string]resource.Field) bool {
+	if _, ok := inline[res.AssignField]; ok { return true }
+	for _, f := range res.VisibleFields(user) { if f.Name == res.AssignField && f.Type == "assignee" && !f.Virtual { return true } }
+	return false
+}
+
+// setAssignees shows each row's assignee by name rather than by id, with one query for the page.
+func (reg *Registry) setAssignees(db *gorm.DB, res *resource.Resource, fields []resource.Field, data []map[string]interface{}) error {
+	shown := false
+	for _, f := range fields { if f.Name == res.AssignField && f.Type == "assignee" { shown = true } }
+	if !shown || len(data) == 0 { return nil }
+	var ids []interface{}
+	for _, m := range data { if id := m[res.AssignField]; id != nil && !reflect.ValueOf(id).IsZero() { ids = append(ids, id) } }
+	names := make(map[string]string)
+	if len(ids) > 0 {
+		var users []models.AdminUser
+		if err := db.Where("id IN ?", ids).Find(&users).Error; err != nil { return err }
+		for _, u := range users { names[fmt.Sprint(u.ID)] = u.DisplayName() }
+	}
+	for _, m := range data {
+		id := m[res.AssignField]
+		if id == nil || reflect.ValueOf(id).IsZero() { m[res.AssignField+"__html"] = template.HTML(`<span class="unassigned">Unassigned</span>`); continue }
+		name, ok := names[fmt.Sprint(id)]
+		if !ok { name = fmt.Sprintf("User #%v", id) }
+		m[res.AssignField+"__html"] = template.HTML(template.HTMLEscapeString(name))
+	}
+	return nil
+}
+
+// handleAssign serves POST /<resource>/assign?id=N with assignee=<user id>, or an empty assignee to unassign. The
+// change is saved through the resource's save hooks and audited as "Assign"; with NotifyAssignee the new assignee
+// is emailed unless they made the change themselves.
+func (reg *Registry) handleAssign(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	f, ok := assignField(res)
+	if !ok { http.Error(w, "Not found", 404); return }
+	id, value := r.URL.Query().Get("id"), r.FormValue("assignee")
+	back := reg.URL("/" + res.Slug + "/show?id=" + url.QueryEscape(id))
+	var assignee *models.AdminUser
+	if value != "" {
+		users, err := reg.assignableUsers(reg.dbFor(r), res)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		for i := range users { if fmt.Sprint(users[i].ID) == value { assignee = &users[i] } }
+		if assignee == nil { http.Error(w, "This user cannot be assigned", http.StatusUnprocessableEntity); return }
+	}
+	note := "Unassigned"
+	if assignee != nil { note = "Assigned to " + assignee.Email }
+	var change FieldChange
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if change, err = reg.editRecordField(tx, res, f, id, value, user); err != nil { return err }
+		return reg.recordAction(tx, user, res.Slug, id, "Assign", note)
+	})
+	if err != nil { reg.renderRecordError(w, r, err); return }
+	reg.afterAuditChanges(user, res.Slug, id, "Assign", note, map[string]FieldChange{f.Name: change})
+	reg.notifyChange(user, res.Slug, "update", id, map[string]FieldChange{f.Name: change})
+	if res.AssignNotify && assignee != nil && assignee.ID != user.ID && fmt.Sprint(change.From) != fmt.Sprint(change.To) {
+		data := assignmentEmail{SiteTitle: reg.Config.SiteTitle, Actor: user.Email, Resource: res.Name, RecordID: id, Link: reg.absoluteURL("/" + res.Slug + "/show?id=" + url.QueryEscape(id))}
+		if item, err := reg.getContext(r.Context(), res.Slug, id); err == nil { data.Label = recordLabel(res, reflect.ValueOf(item)) }
+		reg.sendEmail([]string{assignee.Email}, "assignment", data)
+	}
+	reg.setFlash(w, note)
+	http.Redirect(w, r, back, 303)
+}
+
+// AddMyItemsStat adds a dashboard stat counting the records of resourceName assigned to the viewing user, narrowed
+// by open (e.g. to unresolved tickets) when set, and linking to their "Assigned to me" list.
+func (reg *Registry) AddMyItemsStat(label, resourceName string, open resource.ScopeFunc) *DashboardStat {
+	s := reg.AddStat(label, func(db *gorm.DB) (int64, error) {
+		res, ok := reg.GetResource(resourceName)
+		if !ok || res.AssignField == "" { return 0, fmt.Errorf("%s has no assignment field", resourceName) }
+		q := db.Model(res.Model)
+		for _, sc := range res.Scopes { if sc.Name == resource.AssignedToMe { q = sc.Handler(q) } }
+		if open != nil { q = open(q) }
+		var n int64
+		return n, q.Count(&n).Error
+	})
+	if res, ok := reg.GetResource(resourceName); ok {
+		s.Resource, s.Link = res.Slug, reg.URL("/"+res.Slug+"?scope="+resource.AssignedToMe)
+	}
+	return s
+}
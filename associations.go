@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// assocPageParam is the show page query param paging an association panel, e.g. orders_page=2.
+func assocPageParam(assoc resource.Association) string { return strings.ToLower(assoc.Name) + "_page" }
+
+// hasManyPanel loads one page of a record's HasMany children, in the child list's default order and through its
+// row-level scope, with links to the full filtered list and to a new child with the foreign key filled in.
+func (reg *Registry) hasManyPanel(r *http.Request, res *resource.Resource, item reflect.Value, assoc resource.Association, user *models.AdminUser) (*AssociationData, error) {
+	target, ok := reg.GetResource(assoc.ResourceName)
+	if !ok { return nil, fmt.Errorf("association %q: unknown resource %q", assoc.Name, assoc.ResourceName) }
+	fields := target.GetFieldsForUser("index", user)
+	key := fmt.Sprint(recordKey(res, item))
+	params := url.Values{"eq_" + assoc.ForeignKey: {key}}
+	if target.DefaultScope != "" { params.Set("scope", resource.AllScope) }
+	lq, err := reg.buildListQuery(r.Context(), target, params)
+	if err != nil { return nil, err }
+	perPage := reg.Config.AssociationPerPage
+	if perPage <= 0 { perPage = 10 }
+	a := &AssociationData{Resource: target, Fields: fields, Total: lq.Count(), Page: 1}
+	a.TotalPages = int(math.Ceil(float64(a.Total) / float64(perPage)))
+	if p, err := strconv.Atoi(r.URL.Query().Get(assocPageParam(assoc))); err == nil && p > 1 { a.Page = p }
+	if a.TotalPages > 0 && a.Page > a.TotalPages { a.Page = a.TotalPages }
+	if target.PositionField != "" { lq.Sort(target.PositionField, "asc") } else { lq.Sort("", "") }
+	dest := reflect.New(target.Meta().SliceType)
+	lq.DB = lq.DB.Offset((a.Page - 1) * perPage).Limit(perPage)
+	if err := lq.Find(dest.Interface()); err != nil { return nil, err }
+	a.Items = reg.sliceToMap(target, fields, dest.Elem(), user)
+	page := func(n int) template.URL {
+		q := r.URL.Query()
+		if n > 1 { q.Set(assocPageParam(assoc), strconv.Itoa(n)) } else { q.Del(assocPageParam(assoc)) }
+		return template.URL("?" + q.Encode() + "#assoc-" + assoc.Name)
+	}
+	if a.Page > 1 { a.PrevURL = page(a.Page - 1) }
+	if a.Page < a.TotalPages { a.NextURL = page(a.Page + 1) }
+	a.ListURL = template.URL(reg.URL("/" + target.Slug + "?" + params.Encode()))
+	if !target.ReadOnly && reg.IsAllowed(user.Role, target.Slug, "new") {
+		a.NewURL = template.URL(reg.URL("/" + target.Slug + "/new?" + url.Values{assoc.ForeignKey: {key}}.Encode()))
+	}
+	return a, nil
+}
@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Built-in batch actions: set one field on every selected record, and delete the selected records.
+const (
+	batchEditAction   = "edit_field"
+	batchDeleteAction = "delete_selected"
+)
+
+var errBatchStopped = errors.New("batch edit stopped")
+
+// batchEditFields are the fields offered by the "Edit field" batch action: editable, and settable from a plain value.
+func batchEditFields(res *resource.Resource, user *models.AdminUser) []resource.Field {
+	var fields []resource.Field
+	for _, f := range res.GetFieldsForUser("edit", user) {
+		switch {
+		case f.Readonly, f.Virtual, f.Encrypted, f.Type == "password", f.Type == "file", f.Type == "image", f.OptionsFiltered != nil:
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// handleBatchEdit first shows a form to pick a field and value for the selected ids, then applies it in a transaction.
+// Each record is saved under its own savepoint, so failures are reported and skipped unless Config.BatchEditStopOnError.
+func (reg *Registry) handleBatchEdit(res *resource.Resource, ids []string, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if !reg.IsAllowed(user.Role, res.Slug, "edit") { http.Error(w, "Forbidden", 403); return }
+	fields := batchEditFields(res, user)
+	var target *resource.Field
+	for i := range fields { if fields[i].Name == r.FormValue("field") { target = &fields[i] } }
+	if target == nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		tmpl, err := reg.loadTemplates("templates/batch_edit.html")
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		reg.execute(w, r, tmpl, "batch_edit.html", PageData{
+			SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+			CurrentResource: res, Fields: fields, IDs: ids, User: user, CSS: reg.styleCSS(),
+			Title: reg.T(r.Context(), "Edit %d %s records", len(ids), reg.resName(r.Context(), res)), Breadcrumbs: reg.breadcrumbs(r.Context(), reg.resourceCrumb(r.Context(), res), Crumb{Label: reg.T(r.Context(), "Edit field")}),
+		})
+		return
+	}
+
+	value := r.FormValue("value")
+	var updated int
+	var failures []string
+	changes := make(map[string]FieldChange)
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			change, err := reg.batchEditRecord(tx, res, *target, id, value, user)
+			if err == nil { updated++; changes[id] = change; continue }
+			failures = append(failures, fmt.Sprintf("#%s: %v", id, err))
+			if reg.Config.BatchEditStopOnError { return errBatchStopped }
+		}
+		return nil
+	})
+	if err != nil { updated = 0 } else {
+		for _, id := range ids {
+			change, ok := changes[id]
+			if !ok { continue }
+			reg.afterAuditChanges(user, res.Slug, id, "Update", batchEditNote(target.Name, change), map[string]FieldChange{target.Name: change})
+			reg.notifyChange(user, res.Slug, "update", id, map[string]FieldChange{target.Name: change})
+		}
+	}
+	msg := reg.T(r.Context(), "Updated %s on %d of %d records", target.Label, updated, len(ids))
+	if len(failures) > 0 { msg += " (" + reg.T(r.Context(), "failed %s", strings.Join(failures, ", ")) + ")" }
+	if errors.Is(err, errBatchStopped) { msg += ", " + reg.T(r.Context(), "no changes were saved") }
+	reg.setFlash(w, msg)
+	http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+}
+
+func (reg *Registry) batchEditRecord(tx *gorm.DB, res *resource.Resource, f resource.Field, id, value string, user *models.AdminUser) (FieldChange, error) {
+	change, err := reg.editRecordField(tx, res, f, id, value, user)
+	if err != nil { return FieldChange{}, err }
+	return change, reg.recordAction(tx, user, res.Slug, id, "Update", batchEditNote(f.Name, change))
+}
+
+// editRecordField sets one field of the record keyed id and saves it through the resource's save hooks, rolling the
+// record back to a savepoint on failure; the caller records the audit entry. As on the form, the new value must leave
+// the record's dependent fields valid.
+func (reg *Registry) editRecordField(tx *gorm.DB, res *resource.Resource, f resource.Field, id, value string, user *models.AdminUser) (FieldChange, error) {
+	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
+	q, err := reg.whereKey(reg.scope(tx.Statement.Context, res, tx), res, id)
+	if err != nil { return FieldChange{}, err }
+	if err := q.First(model).Error; err != nil { return FieldChange{}, err }
+	field := settableField(reflect.ValueOf(model), f.Name)
+	change := FieldChange{From: field.Interface()}
+	if err := setFormValue(f, field, value); err != nil { return FieldChange{}, err }
+	change.To = field.Interface()
+	if err := dependentError(tx, res, user, reflect.ValueOf(model)); err != nil { return FieldChange{}, err }
+	stampUser(res, reflect.ValueOf(model), user, false)
+	if err := runSaveHooks(res.BeforeSave, tx, user, model, false); err != nil { return FieldChange{}, err }
+	if err := reg.checkTreeParent(tx, res, reflect.ValueOf(model)); err != nil { return FieldChange{}, err }
+	if err := tx.SavePoint("batch_edit").Error; err != nil { return FieldChange{}, err }
+	if err := tx.Save(model).Error; err != nil { tx.RollbackTo("batch_edit"); return FieldChange{}, err }
+	if err := runSaveHooks(res.AfterSave, tx, user, model, false); err != nil { tx.RollbackTo("batch_edit"); return FieldChange{}, err }
+	if err := reg.checkScope(tx, res, id); err != nil { tx.RollbackTo("batch_edit"); return FieldChange{}, err }
+	return change, nil
+}
+
+func batchEditNote(fieldName string, change FieldChange) string {
+	return fmt.Sprintf("%s: %q → %q (batch edit)", fieldName, fmt.Sprint(change.From), fmt.Sprint(change.To))
+}
+
+// handleBatchDelete asks for confirmation, listing the selected records' dependents, then deletes them (soft deleting
+// models with gorm.DeletedAt) in one transaction, each under its own savepoint so a record whose dependents block
+// its delete, or a constraint failure, does not stop the others; failures are listed by id.
+func (reg *Registry) handleBatchDelete(res *resource.Resource, ids []string, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if !reg.IsAllowed(user.Role, res.Slug, "delete") { http.Error(w, "Forbidden", 403); return }
+	if r.FormValue("confirm") == "" {
+		counts, blocked, err := reg.countDependents(r.Context(), res, ids)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		var data *DeleteData
+		if len(counts) > 0 {
+			data = &DeleteData{IDs: ids, Dependents: counts, Blocked: blocked, Summary: reg.T(r.Context(), "These records have %s.", reg.dependentSummary(r.Context(), counts))}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		tmpl, err := reg.loadTemplates("templates/batch_delete.html")
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		reg.execute(w, r, tmpl, "batch_delete.html", PageData{
+			SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+			CurrentResource: res, IDs: ids, Delete: data, User: user, CSS: reg.styleCSS(),
+			Title: reg.T(r.Context(), "Delete %d %s records", len(ids), reg.resName(r.Context(), res)), Breadcrumbs: reg.breadcrumbs(r.Context(), reg.resourceCrumb(r.Context(), res), Crumb{Label: reg.T(r.Context(), "Delete selected")}),
+		})
+		return
+	}
+	var deleted int
+	var failures []string
+	d := &deletion{user: user, seen: map[string]bool{}}
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		d.tx = tx
+		for _, id := range ids {
+			if err := tx.SavePoint("batch_delete").Error; err != nil { return err }
+			reached, events := d.mark()
+			err := reg.deleteRecord(d, res, id, "Record deleted (batch)", true)
+			switch {
+			case err == nil:
+				deleted++; continue
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				failures = append(failures, fmt.Sprintf("#%s (not found)", id))
+			default:
+				failures = append(failures, fmt.Sprintf("#%s (%v)", id, err))
+			}
+			d.undo(reached, events)
+			if err := tx.RollbackTo("batch_delete").Error; err != nil { return err }
+		}
+		return nil
+	})
+	if err != nil {
+		reg.log(r.Context()).Error("batch delete failed", "resource", res.Slug, "user", user.Email, "error", err)
+		reg.setFlash(w, reg.T(r.Context(), "Could not delete: %s", err.Error())); http.Redirect(w, r, reg.URL("/"+res.Slug), 303); return
+	}
+	reg.announce(user, d.events)
+	msg := reg.T(r.Context(), "Deleted %d records", deleted)
+	if len(failures) > 0 { msg += ", " + reg.T(r.Context(), "%d failed: %s", len(failures), strings.Join(failures, ", ")) }
+	reg.setFlash(w, msg)
+	http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+}
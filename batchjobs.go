@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBatchFailures is how many failed records a batch job lists; the rest are only counted.
+const maxBatchFailures = 20
+
+// handleBatchJobAction runs a batch job action (see AddBatchJobAction). Selections up to Config.BatchJobThreshold
+// run in the request, one handler call per Config.BatchJobSize ids; "all matching" selections, which carry the
+// list's query instead of ids, and larger ones are queued as a background job.
+func (reg *Registry) handleBatchJobAction(res *resource.Resource, a resource.BatchAction, ids []string, allMatching bool, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r = reg.withParams(res, a.Label, a.Params, ids, w, r, user); r == nil { return }
+	params := resource.ParamValues(r)
+	if !allMatching && len(ids) <= reg.Config.BatchJobThreshold {
+		var failures []string
+		failed := 0
+		for _, batch := range chunkIDs(ids, reg.batchJobSize()) {
+			bc := &resource.BatchContext{Context: r.Context(), Resource: res, IDs: batch, Params: params, User: user}
+			lines := batchFailures(bc, a.JobHandler(bc))
+			failed += len(lines)
+			failures = append(failures, lines...)
+		}
+		msg := reg.T(r.Context(), "%s: %d of %d records done", a.Label, len(ids)-failed, len(ids))
+		if len(failures) > 0 { msg += " (" + reg.T(r.Context(), "failed %s", strings.Join(failures, ", ")) + ")" }
+		reg.setFlash(w, msg)
+		http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+		return
+	}
+
+	job := models.BatchJob{UserID: user.ID, ResourceName: res.Slug, ActionName: a.Name, ActionLabel: a.Label, Status: exportQueued, Total: int64(len(ids))}
+	if allMatching {
+		query, err := url.ParseQuery(r.FormValue("query"))
+		if err != nil { reg.renderError(w, r, http.StatusBadRequest, err); return }
+		lq, err := reg.buildListQuery(r.Context(), res, query)
+		if err != nil { reg.renderError(w, r, http.StatusBadRequest, err); return }
+		job.Query, job.Total = query.Encode(), reg.CountFor(r.Context(), res, lq.CountQuery())
+	} else {
+		job.IDs = strings.Join(ids, "\n")
+	}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		job.Params = string(encoded)
+	}
+	if err := reg.dbFor(r).Create(&job).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	reg.startBatchJobs()
+	reg.batchJobs.enqueue(reg, job.ID)
+	reg.setFlash(w, reg.T(r.Context(), "%s is running on %d records in the background", a.Label, job.Total))
+	http.Redirect(w, r, reg.URL("/jobs"), 303)
+}
+
+func (reg *Registry) batchJobSize() int {
+	if reg.Config.BatchJobSize <= 0 { return 500 }
+	return reg.Config.BatchJobSize
+}
+
+func chunkIDs(ids []string, size int) [][]string {
+	var chunks [][]string
+	for len(ids) > size { chunks, ids = append(chunks, ids[:size]), ids[size:] }
+	if len(ids) > 0 { chunks = append(chunks, ids) }
+	return chunks
+}
+
+// batchFailures lists the records of a handled batch that failed as "#id: error": those marked with Fail, and the
+// rest too when the handler returned err.
+func batchFailures(bc *resource.BatchContext, err error) []string {
+	var lines []string
+	for _, id := range bc.IDs {
+		msg, ok := bc.Failed[id]
+		if !ok && err != nil { msg, ok = err.Error(), true }
+		if ok { lines = append(lines, fmt.Sprintf("#%s: %s", id, msg)) }
+	}
+	return lines
+}
+
+// startBatchJobs starts the batch job workers, like startExports: jobs a previous process left running are marked
+// failed, queued ones are picked up again, and finished ones past Config.ExportRetention are cleaned up hourly.
+func (reg *Registry) startBatchJobs() {
+	reg.batchJobs.start.Do(func() {
+		reg.DB.Model(&models.BatchJob{}).Where("status = ?", exportRunning).Updates(map[string]interface{}{"status": exportFailed, "error": "interrupted", "finished_at": time.Now()})
+		workers := reg.Config.ExportWorkers; if workers < 1 { workers = 1 }
+		for i := 0; i < workers; i++ { reg.goBackground(reg.batchJobs.work(reg.runBatchJob)) }
+		var queued []uint
+		reg.DB.Model(&models.BatchJob{}).Where("status = ?", exportQueued).Order("id").Pluck("id", &queued)
+		for _, id := range queued { reg.batchJobs.enqueue(reg, id) }
+		reg.goBackground(func(ctx context.Context) {
+			for {
+				reg.cleanupBatchJobs()
+				select {
+				case <-ctx.Done(): return
+				case <-time.After(time.Hour):
+				}
+			}
+		})
+	})
+}
+
+// runBatchJob runs a queued job's action as the user who started it, so their scope applies, one batch at a time.
+// Progress is saved after every batch; a job cancelled meanwhile stops there, keeping what was already done.
+func (reg *Registry) runBatchJob(id uint) {
+	claim := reg.DB.Model(&models.BatchJob{}).Where("id = ? AND status = ?", id, exportQueued).Update("status", exportRunning)
+	if claim.Error != nil || claim.RowsAffected == 0 { return }
+	var job models.BatchJob
+	if err := reg.DB.First(&job, id).Error; err != nil { return }
+	ctx, cancel := context.WithCancel(context.Background())
+	reg.batchJobs.mu.Lock(); reg.batchJobs.running[id] = cancel; reg.batchJobs.mu.Unlock()
+	defer func() { reg.batchJobs.mu.Lock(); delete(reg.batchJobs.running, id); reg.batchJobs.mu.Unlock(); cancel() }()
+
+	var failures []string
+	err := func() error {
+		var user models.AdminUser
+		if err := reg.DB.First(&user, job.UserID).Error; err != nil { return err }
+		ctx = withUser(ctx, &user)
+		res, ok := reg.GetResource(job.ResourceName)
+		if !ok { return fmt.Errorf("unknown resource %q", job.ResourceName) }
+		var action *resource.BatchAction
+		for i, a := range res.BatchActions { if a.Name == job.ActionName && a.JobHandler != nil { action = &res.BatchActions[i] } }
+		if action == nil { return fmt.Errorf("unknown batch action %q", job.ActionName) }
+		var params map[string]interface{}
+		if job.Params != "" { if err := json.Unmarshal([]byte(job.Params), &params); err != nil { return err } }
+		return reg.eachBatchJobBatch(ctx, res, job, func(ids []string) error {
+			bc := &resource.BatchContext{Context: ctx, Resource: res, IDs: ids, Params: params, User: &user}
+			lines := batchFailures(bc, action.JobHandler(bc))
+			job.Processed += int64(len(ids))
+			job.Failed += int64(len(lines))
+			if room := maxBatchFailures - len(failures); room > 0 { failures = append(failures, lines[:min(room, len(lines))]...) }
+			updates := map[string]interface{}{"processed": job.Processed, "failed": job.Failed, "failures": strings.Join(failures, "\n")}
+			if reg.DB.Model(&models.BatchJob{}).Where("id = ? AND status = ?", id, exportRunning).Updates(updates).RowsAffected == 0 { cancel() }
+			return ctx.Err()
+		})
+	}()
+	updates := map[string]interface{}{"status": exportDone, "finished_at": time.Now()}
+	if err != nil {
+		if ctx.Err() == nil {
+			reg.Logger.Error("batch job failed", "job", id, "resource", job.ResourceName, "action", job.ActionName, "error", err)
+			updates["status"], updates["error"] = exportFailed, err.Error()
+		} else {
+			updates["status"] = exportCancelled
+		}
+	}
+	reg.DB.Model(&models.BatchJob{}).Where("id = ? AND status = ?", id, exportRunning).Updates(updates)
+}
+
+// eachBatchJobBatch calls fn with successive batches of a job's ids: its stored selection, or the keys of the records
+// its query matches, read in primary key order after the last key handled so records the action changes or removes
+// don't shift the batches.
+func (reg *Registry) eachBatchJobBatch(ctx context.Context, res *resource.Resource, job models.BatchJob, fn func(ids []string) error) error {
+	size := reg.batchJobSize()
+	if job.Query == "" {
+		for _, ids := range chunkIDs(strings.Split(job.IDs, "\n"), size) {
+			if err := fn(ids); err != nil { return err }
+		}
+		return nil
+	}
+	query, err := url.ParseQuery(job.Query)
+	if err != nil { return err }
+	lq, err := reg.buildListQueryOn(reg.resourceDB(ctx, res), res, query)
+	if err != nil { return err }
+	var last interface{}
+	for {
+		q := lq.DB.Session(&gorm.Session{})
+		if lq.Joined { q = q.Distinct(lq.PK) }
+		if last != nil { q = q.Where(lq.PK+" > ?", last) }
+		var keys []interface{}
+		if err := q.Order(lq.PK).Limit(size).Pluck(lq.PK, &keys).Error; err != nil { return err }
+		if len(keys) == 0 { return nil }
+		ids := make([]string, len(keys))
+		for i, k := range keys {
+			if b, ok := k.([]byte); ok { k = string(b) }
+			ids[i] = fmt.Sprint(k)
+		}
+		if err := fn(ids); err != nil { return err }
+		if len(keys) < size { return nil }
+		last = keys[len(keys)-1]
+	}
+}
+
+// cleanupBatchJobs deletes finished jobs older than Config.ExportRetention.
+func (reg *Registry) cleanupBatchJobs() {
+	if reg.Config.ExportRetention <= 0 { return }
+	cutoff := time.Now().Add(-time.Duration(reg.Config.ExportRetention) * time.Hour)
+	reg.DB.Where("created_at < ? AND status NOT IN ?", cutoff, []string{exportQueued, exportRunning}).Delete(&models.BatchJob{})
+}
+
+// handleBatchJobs serves the signed-in user's Batch jobs page, /jobs, with each job's progress, and /jobs/cancel
+// (POST with a job id). The page reloads itself while any job is active.
+func (reg *Registry) handleBatchJobs(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser) {
+	reg.startBatchJobs()
+	switch upath {
+	case "/jobs":
+	case "/jobs/cancel":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		id, _ := strconv.ParseUint(r.FormValue("id"), 10, 64)
+		var job models.BatchJob
+		if err := reg.dbFor(r).Where("id = ? AND user_id = ?", id, user.ID).First(&job).Error; err != nil { reg.renderRecordError(w, r, err); return }
+		if reg.dbFor(r).Model(&job).Where("status IN ?", []string{exportQueued, exportRunning}).Updates(map[string]interface{}{"status": exportCancelled, "finished_at": time.Now()}).RowsAffected > 0 {
+			reg.batchJobs.mu.Lock()
+			if cancel, ok := reg.batchJobs.running[job.ID]; ok { cancel() }
+			reg.batchJobs.mu.Unlock()
+			reg.setFlash(w, reg.T(r.Context(), "%s cancelled", job.ActionLabel))
+		}
+		http.Redirect(w, r, reg.URL("/jobs"), 303)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var jobs []models.BatchJob
+	if err := reg.dbFor(r).Where("user_id = ?", user.ID).Order("created_at desc, id desc").Find(&jobs).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/jobs.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), BatchJobs: jobs,
+		Title: reg.T(r.Context(), "Batch jobs"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Batch jobs")}),
+	}
+	reg.execute(w, r, tmpl, "jobs.html", pd)
+}
@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// boardColumnLimit caps the cards loaded into each board column; the header still shows the full count.
+const boardColumnLimit = 50
+
+// BoardColumn is one value of a board view's field, with the first cards matching it.
+type BoardColumn struct {
+	Value, Label string
+	Count        int64
+	Cards        []BoardCard
+}
+
+// BoardCard is a record on the board: its key, display label and the resource's card fields.
+type BoardCard struct {
+	ID     interface{}
+	Label  string
+	Fields map[string]interface{}
+}
+
+// More reports whether the column holds records beyond the loaded cards.
+func (c BoardColumn) More() bool { return c.Count > int64(len(c.Cards)) }
+
+// boardField returns the field a resource's board view groups by.
+func boardField(res *resource.Resource) (resource.Field, bool) {
+	for _, f := range res.Fields { if f.Name == res.BoardField { return f, true } }
+	return resource.Field{}, false
+}
+
+// boardColumns groups the records the list query matches by the board field: one grouped COUNT for the headers,
+// then up to boardColumnLimit cards per column in the list's sort order.
+func (reg *Registry) boardColumns(res *resource.Resource, lq *listQuery, sortField, sortOrder string, user *models.AdminUser) ([]BoardColumn, []resource.Field, error) {
+	f, ok := boardField(res)
+	col, cok := column(lq.Schema, res.BoardField)
+	if !ok || !cok { return nil, nil, fmt.Errorf("board view: %s has no field %q", res.Name, res.BoardField) }
+	count := "COUNT(*)"; if lq.Joined { count = "COUNT(DISTINCT " + lq.PK + ")" }
+	rows, err := lq.DB.Session(&gorm.Session{}).Select(col + ", " + count).Group(col).Rows()
+	if err != nil { return nil, nil, err }
+	counts := make(map[string]int64)
+	var present []string
+	for rows.Next() {
+		var v interface{}; var n int64
+		if err := rows.Scan(&v, &n); err != nil { rows.Close(); return nil, nil, err }
+		if b, ok := v.([]byte); ok { v = string(b) }
+		value := ""; if v != nil { value = fmt.Sprint(v) }
+		counts[value] += n; present = append(present, value)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return nil, nil, err }
+	values := append([]string(nil), f.Options...)
+	if len(values) == 0 { sort.Strings(present); values = present }
+	var cardFields []resource.Field
+	for _, name := range res.BoardCardFields {
+		for _, cf := range res.VisibleFields(CurrentUser(lq.DB.Statement.Context)) { if cf.Name == name { cardFields = append(cardFields, cf) } }
+	}
+	var columns []BoardColumn
+	for _, value := range values {
+		c := BoardColumn{Value: value, Label: value, Count: counts[value]}
+		if c.Label == "" { c.Label = "(none)" }
+		if c.Count > 0 {
+			cq := *lq
+			cq.DB = lq.DB.Session(&gorm.Session{}).Where(col+" = ?", value)
+			cq.Sort(sortField, sortOrder)
+			cq.DB = cq.DB.Limit(boardColumnLimit)
+			dest := reflect.New(res.Meta().SliceType)
+			if err := cq.Find(dest.Interface()); err != nil { return nil, nil, err }
+			items := dest.Elem()
+			for i := 0; i < items.Len(); i++ {
+				item := items.Index(i)
+				c.Cards = append(c.Cards, BoardCard{ID: recordKey(res, item), Label: recordLabel(res, item), Fields: reg.itemToMap(res, cardFields, item, user)})
+			}
+		}
+		columns = append(columns, c)
+	}
+	return columns, cardFields, nil
+}
+
+// handleBoardMove serves POST /<resource>/move?id=N with value=<column>, a card dropped on another column. The new
+// value is saved like a batch edit, through the resource's save hooks, and audited as an update.
+func (reg *Registry) handleBoardMove(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	f, ok := boardField(res)
+	if !ok { http.Error(w, "Not found", 404); return }
+	id, value := r.URL.Query().Get("id"), r.FormValue("value")
+	back := reg.URL("/" + res.Slug + "?" + r.FormValue("query"))
+	if len(f.Options) > 0 {
+		valid := false
+		for _, o := range f.Options { if o == value { valid = true } }
+		if !valid { http.Error(w, fmt.Sprintf("%q is not a valid %s", value, f.Label), http.StatusUnprocessableEntity); return }
+	}
+	var change FieldChange
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if change, err = reg.editRecordField(tx, res, f, id, value, user); err != nil { return err }
+		return reg.recordAction(tx, user, res.Slug, id, "Update", boardMoveNote(f.Name, change))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) { reg.renderRecordError(w, r, err); return }
+		reg.setFlash(w, reg.T(r.Context(), "Could not move: %s", err.Error())); http.Redirect(w, r, back, 303); return
+	}
+	reg.afterAuditChanges(user, res.Slug, id, "Update", boardMoveNote(f.Name, change), map[string]FieldChange{f.Name: change})
+	reg.notifyChange(user, res.Slug, "update", id, map[string]FieldChange{f.Name: change})
+	http.Redirect(w, r, back, 303)
+}
+
+func boardMoveNote(fieldName string, change FieldChange) string {
+	return fmt.Sprintf("%s: %q → %q (board)", fieldName, fmt.Sprint(change.From), fmt.Sprint(change.To))
+}
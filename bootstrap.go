@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"os"
+)
+
+// internalModels are the tables the admin stores its own data in.
+var internalModels = []interface{}{
+	&models.AdminUser{}, &models.Session{}, &models.Permission{}, &models.AuditLog{}, &models.SavedFilter{}, &models.UserPreference{},
+	&models.WebhookDelivery{}, &models.PasswordResetToken{}, &models.LoginEvent{}, &models.Comment{}, &models.ExportJob{},
+	&models.FormToken{}, &models.EditLock{}, &models.Draft{}, &models.BatchJob{}, &models.Watch{}, &models.ScheduledReport{}, &models.Setting{},
+}
+
+// Migrate creates or updates the admin's own tables (see internalModels). Resource tables are left to the
+// application. Roles defined with DefineRole are then reconciled; see ReconcilePermissions. With
+// Config.BootstrapAdminFromEnv, it then creates the first admin from the ADMIN_EMAIL and ADMIN_PASSWORD environment
+// variables; see EnsureAdminUser.
+func (reg *Registry) Migrate() error {
+	if err := reg.DB.AutoMigrate(internalModels...); err != nil { return err }
+	if err := reg.ReconcilePermissions(); err != nil { return err }
+	if reg.Config.BootstrapAdminFromEnv { return reg.EnsureAdminUser(os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD"), "admin") }
+	return nil
+}
+
+// EnsureAdminUser creates a user with the given email, password and role (default "admin") if there are no users
+// yet, and does nothing otherwise, so it is safe to call on every start. The password must meet
+// Config.PasswordPolicy.
+func (reg *Registry) EnsureAdminUser(email, password, role string) error {
+	if role == "" { role = "admin" }
+	return reg.DB.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&models.AdminUser{}).Count(&n).Error; err != nil { return err }
+		if n > 0 { return nil }
+		if email == "" || password == "" { return errors.New("admin: the first user needs an email and a password") }
+		u := &models.AdminUser{Email: email, Role: role, Active: true}
+		if err := reg.setPassword(u, password); err != nil { return fmt.Errorf("admin: first user %s: %w", email, err) }
+		return tx.Create(u).Error
+	})
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// Brand is Config.Branding as the templates use it.
+type Brand struct {
+	LogoURL, FaviconURL string
+	// Style overrides style.css's colour custom properties; empty when no valid colour is configured.
+	Style        template.CSS
+	LoginMessage template.HTML
+	Footer       template.HTML
+}
+
+// cssColor matches hex colours, named colours and rgb()/hsl() functions, and nothing that could end the declaration.
+var cssColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+|(rgb|rgba|hsl|hsla)\([0-9a-z.,%\s/]+\))$`)
+
+func (reg *Registry) brand() *Brand {
+	b := reg.Config.Branding
+	brand := &Brand{LogoURL: b.LogoURL, FaviconURL: b.FaviconURL, LoginMessage: b.LoginMessage, Footer: b.FooterHTML}
+	var css strings.Builder
+	if c := strings.TrimSpace(b.PrimaryColor); cssColor.MatchString(c) {
+		fmt.Fprintf(&css, " --primary: %s; --primary-dark: color-mix(in srgb, %s 85%%, black);", c, c)
+	}
+	if c := strings.TrimSpace(b.AccentColor); cssColor.MatchString(c) { fmt.Fprintf(&css, " --accent: %s;", c) }
+	if css.Len() > 0 { brand.Style = template.CSS(":root {" + css.String() + " }") }
+	return brand
+}
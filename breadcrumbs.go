@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/url"
+	"reflect"
+)
+
+// Crumb is one step of a page's breadcrumb trail; the current page's crumb has no URL.
+type Crumb struct {
+	Label string
+	URL   string
+}
+
+// maxParentDepth bounds how many parent records a trail loads, and stops association cycles.
+const maxParentDepth = 4
+
+// breadcrumbs starts a trail at the dashboard.
+func (reg *Registry) breadcrumbs(ctx context.Context, trail ...Crumb) []Crumb {
+	return append([]Crumb{{Label: reg.T(ctx, "Dashboard"), URL: reg.URL("/")}}, trail...)
+}
+
+// recordTitle names a record as "Order #1042", in the locale of ctx.
+func (reg *Registry) recordTitle(ctx context.Context, res *resource.Resource, key interface{}) string {
+	return fmt.Sprintf("%s #%v", reg.resName(ctx, res), key)
+}
+
+func (reg *Registry) recordURL(res *resource.Resource, key interface{}) string {
+	return reg.URL("/" + res.Slug + "/show?id=" + url.QueryEscape(fmt.Sprint(key)))
+}
+
+// parentLink is a resource whose HasMany association lists res by the foreign key FK.
+type parentLink struct {
+	Parent *resource.Resource
+	FK     string
+}
+
+func (reg *Registry) parentLinks(res *resource.Resource) []parentLink {
+	var links []parentLink
+	for _, p := range reg.sortedResources() {
+		for _, a := range p.Associations {
+			if a.Type != "HasMany" { continue }
+			if target, ok := reg.GetResource(a.ResourceName); ok && target == res { links = append(links, parentLink{p, a.ForeignKey}) }
+		}
+	}
+	return links
+}
+
+// listCrumbs is the trail of a list page. A list filtered to one parent's records, as the count links and show
+// page associations lead to, sits under that parent record and its own parents.
+func (reg *Registry) listCrumbs(ctx context.Context, res *resource.Resource, params url.Values) []Crumb {
+	for _, l := range reg.parentLinks(res) {
+		if key := params.Get("eq_" + l.FK); key != "" { return reg.breadcrumbs(ctx, append(reg.keyTrail(ctx, l.Parent, key, 1), Crumb{Label: reg.resName(ctx, res)})...) }
+	}
+	return reg.breadcrumbs(ctx, Crumb{Label: reg.resName(ctx, res)})
+}
+
+// recordCrumbs is the trail of a record page: its parents, its list, its tree ancestors and the record itself,
+// followed by page when the page is one of the record's (e.g. "Edit").
+func (reg *Registry) recordCrumbs(ctx context.Context, res *resource.Resource, item interface{}, ancestors []TreeNode, page string) []Crumb {
+	elem := reflect.Indirect(reflect.ValueOf(item))
+	key := recordKey(res, elem)
+	trail := reg.listTrail(ctx, res, elem, 1)
+	for _, n := range ancestors { trail = append(trail, Crumb{Label: n.Label, URL: n.URL}) }
+	if page == "" { return reg.breadcrumbs(ctx, append(trail, Crumb{Label: reg.recordTitle(ctx, res, key)})...) }
+	return reg.breadcrumbs(ctx, append(trail, Crumb{Label: reg.recordTitle(ctx, res, key), URL: reg.recordURL(res, key)}, Crumb{Label: page})...)
+}
+
+// listTrail leads to the list item belongs in: under its parent record when one of res's parents holds it.
+func (reg *Registry) listTrail(ctx context.Context, res *resource.Resource, item reflect.Value, depth int) []Crumb {
+	for _, l := range reg.parentLinks(res) {
+		v := reflect.Indirect(res.Meta().Value(item, l.FK))
+		if !v.IsValid() || v.IsZero() { continue }
+		key := fmt.Sprint(v.Interface())
+		return append(reg.keyTrail(ctx, l.Parent, key, depth), Crumb{Label: reg.resName(ctx, res), URL: reg.URL("/" + res.Slug + "?eq_" + url.QueryEscape(l.FK) + "=" + url.QueryEscape(key))})
+	}
+	return []Crumb{reg.resourceCrumb(ctx, res)}
+}
+
+// resourceCrumb links to res's list.
+func (reg *Registry) resourceCrumb(ctx context.Context, res *resource.Resource) Crumb {
+	return Crumb{Label: reg.resName(ctx, res), URL: reg.URL("/" + res.Slug)}
+}
+
+// keyTrail leads to the record of res with key, loading it to find its own parent.
+func (reg *Registry) keyTrail(ctx context.Context, res *resource.Resource, key string, depth int) []Crumb {
+	trail := []Crumb{reg.resourceCrumb(ctx, res)}
+	if depth < maxParentDepth {
+		if item, err := reg.getOn(reg.resourceReader(ctx, res), res.Slug, key); err == nil && item != nil { trail = reg.listTrail(ctx, res, reflect.ValueOf(item), depth+1) }
+	}
+	return append(trail, Crumb{Label: reg.recordTitle(ctx, res, key), URL: reg.recordURL(res, key)})
+}
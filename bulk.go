@@ -0,0 +1,251 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// bulkResult reports one record of a bulk create by its index in the request: its new key, or why it failed.
+type bulkResult struct {
+	Index  int               `json:"index"`
+	ID     interface{}       `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// bulkRecord is a record a bulk create has inserted, with its index in the request.
+type bulkRecord struct {
+	index int
+	model interface{}
+}
+
+// bulkError rejects the record at index, with messages by field name; problems with the record as a whole, such
+// as a failed hook or insert, are under "record".
+type bulkError struct {
+	index int
+	errs  map[string]string
+}
+
+func (e *bulkError) Error() string { return fmt.Sprintf("record %d is invalid", e.index) }
+
+// routeAPI serves the JSON API under /api/: POST /api/<resource>/bulk creates records in bulk.
+func (reg *Registry) routeAPI(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser, role string) {
+	parts := strings.Split(strings.TrimPrefix(upath, "/api/"), "/")
+	res, ok := reg.GetResource(parts[0])
+	if !ok || res.APIDisabled || len(parts) != 2 || parts[1] != "bulk" { writeJSONError(w, http.StatusNotFound, "not found"); return }
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok { info.Resource, info.Action = res.Slug, "bulk" }
+	if r.Method != "POST" { writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed"); return }
+	if !reg.IsAllowed(role, res.Slug, "new") {
+		reg.log(r.Context()).Warn("permission denied", "user", user.Email, "role", role, "resource", res.Slug, "action", "bulk")
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if res.ReadOnly { writeJSONError(w, http.StatusForbidden, res.Name+" is read-only"); return }
+	if reg.maintenanceBlocks(user) { reg.refuseMaintenance(w, r, user); return }
+	reg.handleBulkCreate(res, w, r, user)
+}
+
+// handleBulkCreate creates the records of a JSON array in one transaction, inserting up to Config.BulkBatchSize at a
+// time. Values are parsed as the form parses them, and each record's save hooks, tree and scope checks run as for a
+// single save. A batch that fails is retried record by record to find the bad ones; with ?continue_on_error=true they
+// are skipped and reported, otherwise the first one rolls back every record. One audit entry records the counts.
+func (reg *Registry) handleBulkCreate(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	limit, batchSize := reg.Config.BulkMaxRecords, reg.Config.BulkBatchSize
+	if limit <= 0 { limit = 1000 }
+	if batchSize <= 0 { batchSize = 100 }
+	var records []map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 32<<20)).Decode(&records); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the body must be a JSON array of objects: "+err.Error())
+		return
+	}
+	if len(records) > limit { writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d records can be created at once", limit)); return }
+	keepGoing, _ := strconv.ParseBool(r.URL.Query().Get("continue_on_error"))
+
+	results := make([]bulkResult, len(records))
+	var created []bulkRecord
+	var note string
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		var pos int64
+		if res.PositionField != "" {
+			next, err := reg.nextPosition(tx, res)
+			if err != nil { return err }
+			pos = next
+		}
+		for start := 0; start < len(records); start += batchSize {
+			idxs := make([]int, 0, batchSize)
+			for i := start; i < len(records) && i < start+batchSize; i++ { idxs = append(idxs, i) }
+			saved, next, err := reg.bulkBatch(tx, res, user, records, idxs, pos)
+			var be *bulkError
+			if errors.As(err, &be) && !keepGoing { return be }
+			if err != nil {
+				// Save the batch one record at a time to tell the bad records from the good.
+				saved, next = nil, pos
+				for _, i := range idxs {
+					one, n, err := reg.bulkBatch(tx, res, user, records, []int{i}, next)
+					if errors.As(err, &be) {
+						if !keepGoing { return be }
+						results[i] = bulkResult{Index: i, Errors: be.errs}
+						continue
+					}
+					if err != nil { return err }
+					saved, next = append(saved, one...), n
+				}
+			}
+			created, pos = append(created, saved...), next
+		}
+		note = fmt.Sprintf("Created %d of %d records; %d failed", len(created), len(records), len(records)-len(created))
+		return reg.recordAction(tx, user, res.Slug, "", "Bulk create", note)
+	})
+	var be *bulkError
+	if errors.As(err, &be) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"created": 0, "failed": 1, "results": []bulkResult{{Index: be.index, Errors: be.errs}}})
+		return
+	}
+	if err != nil {
+		reg.log(r.Context()).Error("bulk create failed", "resource", res.Slug, "user", user.Email, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not create the records")
+		return
+	}
+	reg.afterAudit(user, res.Slug, "", "Bulk create", note)
+	for _, rec := range created {
+		elem := reflect.ValueOf(rec.model).Elem()
+		id := recordKey(res, elem)
+		results[rec.index] = bulkResult{Index: rec.index, ID: id}
+		reg.notifyChange(user, res.Slug, "create", fmt.Sprint(id), changedFields(res, nil, rawValues(res, elem)))
+	}
+	writeJSON(w, map[string]interface{}{"created": len(created), "failed": len(records) - len(created), "results": results})
+}
+
+// bulkBatch inserts the records at idxs with a single INSERT behind a savepoint, rolling back to it when any of them
+// fails. pos is the position the first record of a reorderable resource takes; the next free one is returned.
+func (reg *Registry) bulkBatch(tx *gorm.DB, res *resource.Resource, user *models.AdminUser, records []map[string]json.RawMessage, idxs []int, pos int64) ([]bulkRecord, int64, error) {
+	savepoint := fmt.Sprintf("bulk_%d", idxs[0])
+	if err := tx.SavePoint(savepoint).Error; err != nil { return nil, pos, err }
+	saved, next, err := reg.insertBulk(tx, res, user, records, idxs, pos)
+	if err != nil {
+		if rbErr := tx.RollbackTo(savepoint).Error; rbErr != nil { return nil, pos, rbErr }
+		return nil, pos, err
+	}
+	return saved, next, nil
+}
+
+func (reg *Registry) insertBulk(tx *gorm.DB, res *resource.Resource, user *models.AdminUser, records []map[string]json.RawMessage, idxs []int, pos int64) ([]bulkRecord, int64, error) {
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(reflect.TypeOf(res.Model))), 0, len(idxs))
+	saved := make([]bulkRecord, 0, len(idxs))
+	recordErr := func(i int, err error) error { return &bulkError{index: i, errs: map[string]string{"record": err.Error()}} }
+	for _, i := range idxs {
+		model, errs := reg.bulkModel(res, user, records[i])
+		if len(errs) > 0 { return nil, pos, &bulkError{index: i, errs: errs} }
+		elem := reflect.ValueOf(model).Elem()
+		if errs := dependentErrors(tx, res, user, elem, nil); len(errs) > 0 { return nil, pos, &bulkError{index: i, errs: errs} }
+		if p := fieldValue(elem, res.PositionField); p.IsValid() && p.CanInt() && p.Int() == 0 { p.SetInt(pos); pos++ }
+		stampUser(res, elem, user, true)
+		if err := runSaveHooks(res.BeforeSave, tx, user, model, true); err != nil { return nil, pos, recordErr(i, err) }
+		if err := reg.checkTreeParent(tx, res, elem); err != nil { return nil, pos, recordErr(i, err) }
+		if err := reg.applyScope(tx, res, elem); err != nil { return nil, pos, err }
+		rows = reflect.Append(rows, reflect.ValueOf(model))
+		saved = append(saved, bulkRecord{index: i, model: model})
+	}
+	if err := tx.Create(rows.Interface()).Error; err != nil {
+		// A failed multi-row insert doesn't say which row was at fault; the caller retries them one by one.
+		if len(idxs) == 1 { return nil, pos, recordErr(idxs[0], err) }
+		return nil, pos, err
+	}
+	for _, rec := range saved {
+		if err := runSaveHooks(res.AfterSave, tx, user, rec.model, true); err != nil { return nil, pos, recordErr(rec.index, err) }
+		if err := reg.checkScope(tx, res, recordKey(res, reflect.ValueOf(rec.model).Elem())); err != nil { return nil, pos, recordErr(rec.index, err) }
+	}
+	return saved, pos, nil
+}
+
+// bulkModel builds a new record from one object of a bulk create. Keys name fields the user may edit on the new
+// form; fields left out take their defaults, and VisibleWhen conditions are checked against the object's values.
+func (reg *Registry) bulkModel(res *resource.Resource, user *models.AdminUser, raw map[string]json.RawMessage) (interface{}, map[string]string) {
+	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
+	elem := reflect.ValueOf(model).Elem()
+	errs := make(map[string]string)
+	fields := res.VisibleFields(user)
+	editable := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.Readonly || res.IsUserStamp(f.Name) { continue }
+		editable[f.Name] = true
+		if def := fieldDefault(f, user); def != nil { if field := settableField(elem, f.Name); field.CanSet() { setFieldValue(field, def) } }
+	}
+	for key := range raw {
+		if editable[key] { continue }
+		errs[key] = "unknown field"
+		for _, f := range fields { if f.Name == key { errs[key] = f.Label + " is read-only" } }
+	}
+
+	values := make(map[string]interface{}, len(raw))
+	for key, msg := range raw {
+		if !editable[key] { continue }
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil { errs[key] = err.Error(); continue }
+		values[key] = v
+	}
+	current := recordText(elem)
+	hidden := res.HiddenByCondition(func(name string) string {
+		if s, ok := jsonText(values[name]); ok && values[name] != nil { return s }
+		return current(name)
+	})
+	for _, f := range fields {
+		if !editable[f.Name] || hidden[f.Name] { continue }
+		field := settableField(elem, f.Name); if !field.CanSet() { continue }
+		v, given := values[f.Name]
+		if !given {
+			if f.Required && fieldDefault(f, user) == nil { errs[f.Name] = f.Label + " is required" }
+			continue
+		}
+		if f.Type == "image" || f.Type == "file" { errs[f.Name] = "uploads are not supported in bulk creates"; continue }
+		if f.Type == "tags" {
+			var tags []string
+			list, isList := v.([]interface{})
+			if !isList { list = []interface{}{v} }
+			for _, t := range list { if s, ok := jsonText(t); ok { tags = append(tags, s) } }
+			if err := setTags(field, formTags(tags)); err != nil { errs[f.Name] = err.Error() }
+			continue
+		}
+		s, ok := jsonText(v)
+		if !ok { errs[f.Name] = f.Label + " must be a string, number or boolean"; continue }
+		if f.Required && strings.TrimSpace(s) == "" { errs[f.Name] = f.Label + " is required"; continue }
+		if f.Encrypted {
+			sealed, err := reg.encryptValue(s)
+			if err != nil { errs[f.Name] = "could not encrypt: " + err.Error() } else { setFieldString(field, sealed) }
+			continue
+		}
+		if ok, err := parseTypedField(f, field, s); ok {
+			if err != nil { errs[f.Name] = err.Error() }
+			continue
+		}
+		if err := setFieldString(field, s); err != nil { errs[f.Name] = fmt.Sprintf("%q is not a valid %s.", s, f.Label) }
+	}
+	return model, errs
+}
+
+// jsonText is a decoded JSON scalar in the text form a form field would submit; null is empty.
+func jsonText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// calendarLimit caps the records returned for one calendar range.
+const calendarLimit = 500
+
+// calendarEntry is a record placed on the calendar. End is nil for point-in-time records; AllDay marks those
+// starting at midnight, which show as a day's label rather than at a time.
+type calendarEntry struct {
+	ID     interface{} `json:"id"`
+	Title  string      `json:"title"`
+	Start  time.Time   `json:"start"`
+	End    *time.Time  `json:"end,omitempty"`
+	AllDay bool        `json:"allDay"`
+	URL    string      `json:"url"`
+}
+
+// handleCalendar serves /<resource>/calendar?from=2026-10-01&to=2026-11-01 (to exclusive), the records of the
+// list query (scope, filters and row scope) overlapping the range, as JSON for the calendar view.
+func (reg *Registry) handleCalendar(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+	if res.CalendarStart == "" { http.Error(w, "Not found", 404); return }
+	params := r.URL.Query()
+	from, err := parseTime(params.Get("from"))
+	if err != nil { http.Error(w, "from: "+err.Error(), 400); return }
+	to, err := parseTime(params.Get("to"))
+	if err != nil || !to.After(from) { http.Error(w, "to must be a time after from", 400); return }
+	filters := url.Values{}
+	for k, v := range params { if k != "from" && k != "to" { filters[k] = v } }
+	lq, err := reg.buildListQuery(r.Context(), res, filters)
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	start, ok := column(lq.Schema, res.CalendarStart)
+	if !ok { http.Error(w, fmt.Sprintf("%s has no field %q", res.Name, res.CalendarStart), 400); return }
+	// Records starting in the range, or starting before it and ending in or after it: each branch is a range on
+	// one column, so indexes on the start and end columns serve it.
+	if end, ok := column(lq.Schema, res.CalendarEnd); ok {
+		lq.DB = lq.DB.Where(fmt.Sprintf("(%s >= ? AND %s < ?) OR (%s < ? AND %s >= ?)", start, start, start, end), from, to, from, from)
+	} else {
+		lq.DB = lq.DB.Where(fmt.Sprintf("%s >= ? AND %s < ?", start, start), from, to)
+	}
+	lq.DB = lq.DB.Order(start + " asc").Limit(calendarLimit)
+	dest := reflect.New(res.Meta().SliceType)
+	if err := lq.Find(dest.Interface()); err != nil { reg.renderError(w, r, 500, err); return }
+	items := dest.Elem()
+	entries := []calendarEntry{}
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i)
+		s, _ := timeValue(fieldValue(item, res.CalendarStart).Interface())
+		e := calendarEntry{ID: recordKey(res, item), Title: recordLabel(res, item), Start: s}
+		e.URL = reg.URL(fmt.Sprintf("/%s/show?id=%s", res.Slug, url.QueryEscape(fmt.Sprint(e.ID))))
+		if fv := fieldValue(item, res.CalendarEnd); fv.IsValid() {
+			if end, ok := timeValue(fv.Interface()); ok && !end.IsZero() { e.End = &end }
+		}
+		e.AllDay = e.End == nil && s.Equal(time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, s.Location()))
+		entries = append(entries, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// chartCache memoises chart data per chart and range, collapsing concurrent loads of the same key into one query
+// like countCache does for counts.
+type chartCache struct {
+	mu       sync.Mutex
+	entries  map[string]chartEntry
+	inflight map[string]*chartCall
+}
+
+type chartEntry struct {
+	result  ChartResult
+	at      time.Time
+	expires time.Time
+}
+
+type chartCall struct {
+	wg     sync.WaitGroup
+	result ChartResult
+	at     time.Time
+	err    error
+}
+
+func newChartCache() *chartCache {
+	return &chartCache{entries: make(map[string]chartEntry), inflight: make(map[string]*chartCall)}
+}
+
+// get returns the cached result for key and when it was computed, or loads it. Failed loads are shared with
+// waiters but not cached.
+func (c *chartCache) get(key string, ttl time.Duration, refresh bool, load func() (ChartResult, error)) (ChartResult, time.Time, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && !refresh && time.Now().Before(e.expires) { c.mu.Unlock(); return e.result, e.at, nil }
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.result, call.at, call.err
+	}
+	call := &chartCall{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.result, call.err = load()
+	call.at = time.Now()
+	c.mu.Lock()
+	if call.err == nil { c.entries[key] = chartEntry{result: call.result, at: call.at, expires: call.at.Add(ttl)} }
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	call.wg.Done()
+	return call.result, call.at, call.err
+}
+
+// invalidate drops every entry whose key starts with prefix.
+func (c *chartCache) invalidate(prefix string) {
+	c.mu.Lock(); defer c.mu.Unlock()
+	for key := range c.entries { if strings.HasPrefix(key, prefix) { delete(c.entries, key) } }
+}
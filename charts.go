@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChartRequest is the period a ranged chart is drawn for, chosen with the dashboard's range buttons.
+// Granularity is "day", "week" or "month".
+type ChartRequest struct {
+	From, To    time.Time
+	Granularity string
+	User        *models.AdminUser
+}
+
+// ChartProvider produces a ranged chart's data for the requested period.
+type ChartProvider func(db *gorm.DB, req ChartRequest) (labels []string, values []float64, err error)
+
+// ChartSeries is one named line or bar set; Color is any CSS color and defaults to the dashboard palette.
+type ChartSeries struct {
+	Label  string    `json:"label"`
+	Values []float64 `json:"values"`
+	Color  string    `json:"color,omitempty"`
+}
+
+// ChartResult is a chart's data: one value per label in every series. It is also the JSON shape of
+// /charts/{id}/data, so custom pages can draw the same data.
+type ChartResult struct {
+	Labels []string      `json:"labels"`
+	Series []ChartSeries `json:"series"`
+}
+
+// SeriesProvider produces a multi-series chart's data for the requested period.
+type SeriesProvider func(db *gorm.DB, req ChartRequest) (ChartResult, error)
+
+// ChartRanges are the range buttons shown above ranged charts; the first is the default.
+var ChartRanges = []string{"30d", "7d", "90d", "365d"}
+
+// AddRangedChart adds a chart whose provider receives the selected time range, e.g.
+//
+//	reg.AddRangedChart("Signups", "line", func(db *gorm.DB, req admin.ChartRequest) ([]string, []float64, error) {
+//		return admin.TimeSeries(db, User{}, "created_at", "COUNT(*)", req)
+//	})
+func (reg *Registry) AddRangedChart(l, t string, p ChartProvider) *Chart {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	c := &Chart{Label: l, Type: t, Provider: p}
+	reg.Charts = append(reg.Charts, c)
+	return c
+}
+
+// AddSeriesChart adds a ranged chart with several series, e.g. orders per status over time (see TimeSeriesBy).
+// Stacked stacks bar series on top of each other instead of side by side.
+func (reg *Registry) AddSeriesChart(l, t string, stacked bool, p SeriesProvider) *Chart {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	c := &Chart{Label: l, Type: t, Stacked: stacked, Series: p}
+	reg.Charts = append(reg.Charts, c)
+	return c
+}
+
+// ranged reports whether the chart's provider takes the selected range.
+func (c *Chart) ranged() bool { return c.Provider != nil || c.Series != nil }
+
+// result runs the chart's provider, wrapping single-series providers into one series named after the chart.
+// A plain Data func simply ignores the range.
+func (c *Chart) result(db *gorm.DB, req ChartRequest) (ChartResult, error) {
+	if c.Series != nil { return c.Series(db, req) }
+	var labels []string
+	var values []float64
+	var err error
+	if c.Provider != nil { labels, values, err = c.Provider(db, req) } else { labels, values = c.Data(db) }
+	return ChartResult{Labels: labels, Series: []ChartSeries{{Label: c.Label, Values: values}}}, err
+}
+
+// chartData returns a chart's data for the given range, from the cache when the chart has a CacheTTL. asOf is when
+// cached data was computed and zero for uncached charts; refresh reloads it regardless.
+func (reg *Registry) chartData(r *http.Request, c *Chart, rng, granularity string, user *models.AdminUser, refresh bool) (result ChartResult, asOf time.Time, err error) {
+	if rng == "" { rng = ChartRanges[0] }
+	req, err := chartRequest(rng, granularity, user)
+	if err != nil { return ChartResult{}, time.Time{}, err }
+	if c.CacheTTL <= 0 { result, err = c.result(reg.readFor(r), req); return result, time.Time{}, err }
+	key := c.Label + "|" + rng + "|" + req.Granularity
+	if reg.scoped(r.Context()) { key += fmt.Sprintf("|%d", user.ID) }
+	return reg.chartCache.get(key, c.CacheTTL, refresh, func() (ChartResult, error) { return c.result(reg.readFor(r), req) })
+}
+
+// InvalidateChartCache drops the cached data of the chart with the given label, e.g. after a bulk data load.
+func (reg *Registry) InvalidateChartCache(label string) { reg.chartCache.invalidate(label + "|") }
+
+// chartRequest parses a range like "30d" (ending now) and an optional granularity, defaulting the granularity
+// to days up to a month, weeks up to four months and months beyond.
+func chartRequest(rng, granularity string, user *models.AdminUser) (ChartRequest, error) {
+	if rng == "" { rng = ChartRanges[0] }
+	days, err := strconv.Atoi(strings.TrimSuffix(rng, "d"))
+	if err != nil || !strings.HasSuffix(rng, "d") || days < 1 || days > 3660 { return ChartRequest{}, fmt.Errorf("invalid range %q", rng) }
+	switch granularity {
+	case "":
+		granularity = "month"
+		if days <= 31 { granularity = "day" } else if days <= 120 { granularity = "week" }
+	case "day", "week", "month":
+	default:
+		return ChartRequest{}, fmt.Errorf("invalid granularity %q", granularity)
+	}
+	to := time.Now()
+	req := ChartRequest{From: to.AddDate(0, 0, -days), To: to, Granularity: granularity, User: user}
+	if bounds, _ := req.buckets(); len(bounds) > maxChartBuckets+1 { return ChartRequest{}, fmt.Errorf("range %q has too many %s buckets", rng, granularity) }
+	return req, nil
+}
+
+func formatAsOf(t time.Time) string {
+	if t.IsZero() { return "" }
+	return t.Format("15:04")
+}
+
+// handleChartData serves /charts/{id}/data?range=30d as JSON, where id is the chart's position on the dashboard.
+func (reg *Registry) handleChartData(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser) {
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.TrimPrefix(upath, "/charts/"), "/")
+	charts := reg.charts()
+	id, err := strconv.Atoi(parts[0])
+	if len(parts) != 2 || parts[1] != "data" || err != nil || id < 0 || id >= len(charts) || !visibleToRoles(charts[id].VisibleTo, user) {
+		w.WriteHeader(404); json.NewEncoder(w).Encode(map[string]string{"error": "unknown chart"}); return
+	}
+	q := r.URL.Query()
+	if _, err := chartRequest(q.Get("range"), q.Get("granularity"), user); err != nil {
+		w.WriteHeader(400); json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); return
+	}
+	refresh := q.Get("refresh") == "1" && user.Role == "admin"
+	result, asOf, err := reg.chartData(r, charts[id], q.Get("range"), q.Get("granularity"), user, refresh)
+	if err != nil {
+		reg.log(r.Context()).Error("chart failed", "chart", charts[id].Label, "error", err)
+		w.WriteHeader(500); json.NewEncoder(w).Encode(map[string]string{"error": "chart data unavailable"}); return
+	}
+	json.NewEncoder(w).Encode(struct {
+		ChartResult
+		AsOf string `json:"as_of,omitempty"`
+	}{result, formatAsOf(asOf)})
+}
+
+// maxChartBuckets caps the buckets of a time series, each of which is one query, e.g. a ten-year range by day.
+const maxChartBuckets = 400
+
+// buckets returns the start of each day, week or month in req's range followed by the end of the last one, and
+// the layout bucket labels are formatted with. Weeks start on Monday.
+func (req ChartRequest) buckets() ([]time.Time, string) {
+	loc := req.From.Location()
+	start := time.Date(req.From.Year(), req.From.Month(), req.From.Day(), 0, 0, 0, 0, loc)
+	next, layout := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }, "2006-01-02"
+	switch req.Granularity {
+	case "week":
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc)
+		next, layout = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, "2006-01"
+	}
+	var bounds []time.Time
+	for t := start; t.Before(req.To); t = next(t) { bounds = append(bounds, t) }
+	if len(bounds) == 0 { return nil, layout }
+	return append(bounds, next(bounds[len(bounds)-1])), layout
+}
+
+// TimeSeries aggregates valueExpr (e.g. "COUNT(*)" or "SUM(total)") over model's rows per day, week or month of
+// dateColumn within req's range. Each bucket is its own query, so any aggregate works on any database; empty
+// buckets are zero. Weeks start on Monday and are labelled by their first day. Ranges of more than
+// maxChartBuckets buckets are refused.
+func TimeSeries(db *gorm.DB, model interface{}, dateColumn, valueExpr string, req ChartRequest) ([]string, []float64, error) {
+	bounds, layout := req.buckets()
+	if len(bounds) > maxChartBuckets+1 { return nil, nil, fmt.Errorf("too many %s buckets: %d", req.Granularity, len(bounds)-1) }
+	var labels []string
+	var values []float64
+	for i := 0; i+1 < len(bounds); i++ {
+		var v float64
+		err := db.Session(&gorm.Session{}).Model(model).Select(fmt.Sprintf("COALESCE(%s, 0)", valueExpr)).
+			Where(fmt.Sprintf("%s >= ? AND %s < ?", dateColumn, dateColumn), bounds[i], bounds[i+1]).Scan(&v).Error
+		if err != nil { return nil, nil, err }
+		labels, values = append(labels, bounds[i].Format(layout)), append(values, v)
+	}
+	return labels, values, nil
+}
+
+// TimeSeriesBy is TimeSeries with one series per distinct value of groupColumn, e.g. orders per status.
+func TimeSeriesBy(db *gorm.DB, model interface{}, dateColumn, valueExpr, groupColumn string, req ChartRequest) (ChartResult, error) {
+	var groups []string
+	err := db.Session(&gorm.Session{}).Model(model).Where(fmt.Sprintf("%s >= ? AND %s < ?", dateColumn, dateColumn), req.From, req.To).
+		Distinct(groupColumn).Order(groupColumn).Pluck(groupColumn, &groups).Error
+	if err != nil { return ChartResult{}, err }
+	var result ChartResult
+	for _, g := range groups {
+		labels, values, err := TimeSeries(db.Session(&gorm.Session{}).Where(fmt.Sprintf("%s = ?", groupColumn), g), model, dateColumn, valueExpr, req)
+		if err != nil { return ChartResult{}, err }
+		result.Labels = labels
+		result.Series = append(result.Series, ChartSeries{Label: g, Values: values})
+	}
+	return result, nil
+}
@@ -32,8 +32,11 @@ func main() {
 	conf, _ := admin.LoadConfig("admin.yml")
 	adm.SetConfig(conf)
 
-	log.Println("🚀 Admin panel starting on http://localhost:8080/admin")
-	http.Handle("/admin/", adm)
+	// Create the admin's tables, and the first admin user from ADMIN_EMAIL and ADMIN_PASSWORD
+	if err := adm.Migrate(); err != nil { log.Fatal(err) }
+
+	log.Println("🚀 Admin panel starting on http://localhost:8080" + adm.URL("/"))
+	http.Handle(adm.Config.BasePath+"/", adm.Handler())
 	http.ListenAndServe(":8080", nil)
 }
 `
@@ -65,9 +68,10 @@ func handleInit() {
 	os.WriteFile("main.go", []byte(mainTemplate), 0644)
 	
 	fmt.Println("Creating admin.yml...")
-	os.WriteFile("admin.yml", []byte("site_title: \"My Admin\"\ndefault_per_page: 10\n"), 0644)
+	os.WriteFile("admin.yml", []byte("site_title: \"My Admin\"\ndefault_per_page: 10\nbootstrap_admin_from_env: false\n"), 0644)
 	
 	fmt.Println("✅ Done! Run 'go mod init' and 'go mod tidy' to start.")
+	fmt.Println("To create the first admin on start, set bootstrap_admin_from_env: true in admin.yml and export ADMIN_EMAIL and ADMIN_PASSWORD.")
 }
 
 func handleGenerate(name string) {
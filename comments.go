@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CommentEntry is a comment as shown on a record's page.
+type CommentEntry struct {
+	models.Comment
+	HTML      template.HTML
+	CanDelete bool
+}
+
+var commentLink = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// formatComment escapes a comment body, turning line breaks into <br> and http(s) URLs into links.
+func formatComment(body string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, m := range commentLink.FindAllStringIndex(body, -1) {
+		link := strings.TrimRight(body[m[0]:m[1]], ".,;:!?)")
+		b.WriteString(template.HTMLEscapeString(body[last:m[0]]))
+		fmt.Fprintf(&b, `<a href="%s" target="_blank" rel="noopener noreferrer">%s</a>`, template.HTMLEscapeString(link), template.HTMLEscapeString(link))
+		last = m[0] + len(link)
+	}
+	b.WriteString(template.HTMLEscapeString(body[last:]))
+	return template.HTML(strings.ReplaceAll(strings.ReplaceAll(b.String(), "\r\n", "\n"), "\n", "<br>"))
+}
+
+// canDeleteComment reports whether user may delete c: its author or an admin.
+func canDeleteComment(c models.Comment, user *models.AdminUser) bool { return c.UserID == user.ID || user.Role == "admin" }
+
+// recordComments lists the comments on a record, newest first.
+func (reg *Registry) recordComments(r *http.Request, res *resource.Resource, id string, user *models.AdminUser) ([]CommentEntry, error) {
+	var comments []models.Comment
+	if err := reg.dbFor(r).Where("resource_name = ? AND record_id = ?", res.Slug, id).Order("created_at desc, id desc").Find(&comments).Error; err != nil { return nil, err }
+	entries := make([]CommentEntry, len(comments))
+	for i, c := range comments { entries[i] = CommentEntry{Comment: c, HTML: formatComment(c.Body), CanDelete: canDeleteComment(c, user)} }
+	return entries, nil
+}
+
+// handleComment adds a comment (POST /<resource>/comment?id=N) or, with action "delete_comment" and a comment_id,
+// removes one. Both are recorded in the record's audit history.
+func (reg *Registry) handleComment(res *resource.Resource, action string, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if !res.Comments { http.Error(w, "Not found", 404); return }
+	if r.Method != "POST" { http.Error(w, "Method not allowed", http.StatusMethodNotAllowed); return }
+	item, err := reg.getContext(r.Context(), res.Slug, r.URL.Query().Get("id"))
+	if err != nil { reg.renderRecordError(w, r, err); return }
+	id := fmt.Sprint(recordKey(res, reflect.ValueOf(item)))
+	var write func(tx *gorm.DB) error
+	act, note := "Comment", strings.TrimSpace(r.FormValue("body"))
+	if action == "delete_comment" {
+		var c models.Comment
+		if err := reg.dbFor(r).Where("id = ? AND resource_name = ? AND record_id = ?", r.FormValue("comment_id"), res.Slug, id).First(&c).Error; err != nil { reg.renderRecordError(w, r, err); return }
+		if !canDeleteComment(c, user) { http.Error(w, "Forbidden", 403); return }
+		act, note = "Delete Comment", c.Body
+		write = func(tx *gorm.DB) error { return tx.Delete(&c).Error }
+	} else {
+		if note == "" { reg.setFlash(w, reg.T(r.Context(), "A comment cannot be empty")); http.Redirect(w, r, reg.URL("/"+res.Slug+"/show?id="+url.QueryEscape(id)), 303); return }
+		write = func(tx *gorm.DB) error {
+			return tx.Create(&models.Comment{ResourceName: res.Slug, RecordID: id, UserID: user.ID, UserEmail: user.Email, Body: note, CreatedAt: time.Now()}).Error
+		}
+	}
+	err = reg.dbFor(r).Transaction(func(tx *gorm.DB) error {
+		if err := write(tx); err != nil { return err }
+		return reg.recordAction(tx, user, res.Slug, id, act, note)
+	})
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.afterAudit(user, res.Slug, id, act, note)
+	http.Redirect(w, r, reg.URL("/"+res.Slug+"/show?id="+url.QueryEscape(id)), 303)
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// compress gzips responses when Config.Gzip is on and the client accepts it. CSV downloads are streamed as they are
+// written and skipped, as are responses whose type is compressed already.
+func (reg *Registry) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reg.Config.Gzip || strings.HasSuffix(r.URL.Path, "/export") || strings.HasSuffix(r.URL.Path, "/exports/download") { next.ServeHTTP(w, r); return }
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) { next.ServeHTTP(w, r); return }
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") { return strings.ReplaceAll(params, " ", "") != "q=0" }
+	}
+	return false
+}
+
+// compressible reports whether a response of the given Content-Type is worth compressing.
+func compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch {
+	case ct == "image/svg+xml":
+		return true
+	case strings.HasPrefix(ct, "image/"), strings.HasPrefix(ct, "video/"), strings.HasPrefix(ct, "audio/"), strings.HasPrefix(ct, "font/woff"):
+		return false
+	case ct == "application/zip", ct == "application/gzip", ct == "application/x-gzip", ct == "application/pdf",
+		ct == "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ct == "text/csv":
+		return false
+	}
+	return true
+}
+
+// gzipResponseWriter decides on the first write whether to compress: not for empty-bodied or partial responses,
+// responses that set their own encoding, or types compressible rejects.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (g *gzipResponseWriter) decide(status int) {
+	if g.decided { return }
+	g.decided = true
+	h := g.Header()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent || h.Get("Content-Encoding") != "" { return }
+	if h.Get("Content-Type") == "" { return }
+	if !compressible(h.Get("Content-Type")) { return }
+	h.Del("Content-Length"); h.Del("Accept-Ranges")
+	h.Set("Content-Encoding", "gzip")
+	g.gz = gzipWriters.Get().(*gzip.Writer)
+	g.gz.Reset(g.ResponseWriter)
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) { g.decide(status); g.ResponseWriter.WriteHeader(status) }
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.decided {
+		if g.Header().Get("Content-Type") == "" { g.Header().Set("Content-Type", http.DetectContentType(b)) }
+		g.decide(http.StatusOK)
+	}
+	if g.gz == nil { return g.ResponseWriter.Write(b) }
+	return g.gz.Write(b)
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil { g.gz.Flush() }
+	if f, ok := g.ResponseWriter.(http.Flusher); ok { f.Flush() }
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter { return g.ResponseWriter }
+
+func (g *gzipResponseWriter) close() {
+	if g.gz == nil { return }
+	g.gz.Close()
+	g.gz.Reset(nil)
+	gzipWriters.Put(g.gz)
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"reflect"
+)
+
+// recordText returns a record's field values as text, the form VisibleWhen conditions compare.
+func recordText(item reflect.Value) func(string) string {
+	return func(name string) string {
+		v := reflect.Indirect(fieldValue(item, name))
+		if !v.IsValid() { return "" }
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// savedHidden names the fields a save must skip because their VisibleWhen condition fails. Conditions see the
+// submitted value of each field the user may edit and the record's value of any other, so a field the form doesn't
+// offer can't be used to reveal another.
+func savedHidden(res *resource.Resource, r *http.Request, item reflect.Value, user *models.AdminUser, isUpdate bool) map[string]bool {
+	editable := make(map[string]bool)
+	for _, f := range res.VisibleFields(user) {
+		if !f.Readonly && !res.IsUserStamp(f.Name) && !(isUpdate && f.Name == res.PrimaryKey) { editable[f.Name] = true }
+	}
+	current := recordText(item)
+	return res.HiddenByCondition(func(name string) string {
+		if vals, ok := r.Form[name]; ok && editable[name] && len(vals) > 0 { return vals[0] }
+		return current(name)
+	})
+}
+
+// withoutHidden drops the fields in hidden.
+func withoutHidden(fields []resource.Field, hidden map[string]bool) []resource.Field {
+	if len(hidden) == 0 { return fields }
+	kept := make([]resource.Field, 0, len(fields))
+	for _, f := range fields { if !hidden[f.Name] { kept = append(kept, f) } }
+	return kept
+}
@@ -2,28 +2,241 @@ package config
 
 import (
 	"gopkg.in/yaml.v3"
+	"html/template"
 	"os"
 )
 
 // Config holds the configuration for the admin panel.
 type Config struct {
 	SiteTitle       string `yaml:"site_title"`
+	BasePath        string `yaml:"base_path"`
 	DefaultPerPage  int    `yaml:"default_per_page"`
+	MaxPerPage      int    `yaml:"max_per_page"`
+	// AssociationPerPage is how many child records a show page association panel lists per page.
+	AssociationPerPage int `yaml:"association_per_page"`
+	// Deprecated: ThemeColor was never applied; set Branding.PrimaryColor instead.
 	ThemeColor      string `yaml:"theme_color"`
 	SessionTTL      int    `yaml:"session_ttl_hours"`
 	SearchThreshold int64  `yaml:"search_threshold"`
 	UploadDir       string `yaml:"upload_dir"`
+	CountCacheTTL   int    `yaml:"count_cache_ttl_seconds"`
+	QueryTimeout    int    `yaml:"query_timeout_seconds"`
+	ExportTimeout   int    `yaml:"export_timeout_seconds"`
+	// TemplateOverrideDir holds replacements for any of the embedded templates or style.css.
+	TemplateOverrideDir string `yaml:"template_override_dir"`
+	// DevMode re-reads template overrides on every request instead of caching them.
+	DevMode bool `yaml:"dev_mode"`
+	// Gzip compresses responses for clients that accept it, except downloads and already-compressed files.
+	Gzip bool `yaml:"gzip"`
+	// DebugErrors shows raw error text on error pages; leave off in production.
+	DebugErrors bool `yaml:"debug_errors"`
+	// StrictValidation refuses to serve, with a 500 listing the problems, when Registry.Validate finds any.
+	StrictValidation bool `yaml:"strict_validation"`
+	// GroupOrder lists navigation groups in display order; unlisted groups follow alphabetically.
+	GroupOrder []string `yaml:"group_order"`
+	// BatchEditStopOnError rolls back a whole batch field edit when any record fails instead of skipping it.
+	BatchEditStopOnError bool `yaml:"batch_edit_stop_on_error"`
+	// EnableMetrics serves request, query, login and export metrics at <base path>/metrics.
+	EnableMetrics bool `yaml:"enable_metrics"`
+	// MetricsToken, when set, is the bearer token scrapers must send instead of logging in.
+	MetricsToken string `yaml:"metrics_token"`
+	// OpenAPIToken, when set, is a bearer token that fetches the OpenAPI spec at <base path>/api/openapi.json without
+	// logging in; otherwise only admins may.
+	OpenAPIToken string `yaml:"openapi_token"`
+	// ActivityFeedSize is how many recent audit entries the dashboard shows; 0 hides the panel.
+	ActivityFeedSize int `yaml:"activity_feed_size"`
+	// AutoResourceStats shows a record count card per resource on the dashboard.
+	AutoResourceStats bool `yaml:"auto_resource_stats"`
+	// WebhookWorkers is how many webhook deliveries run at once.
+	WebhookWorkers int `yaml:"webhook_workers"`
+	// WebhookMaxAttempts is how often a delivery is tried, with doubling backoff, before it is marked failed.
+	WebhookMaxAttempts int `yaml:"webhook_max_attempts"`
+	// PublicURL is the scheme and host the admin is reached at (e.g. "https://example.com"), for links in email.
+	PublicURL string `yaml:"public_url"`
+	// PasswordResetTTL is how long an emailed password reset link stays valid, in minutes.
+	PasswordResetTTL int `yaml:"password_reset_ttl_minutes"`
+	// InvitationTTL is how long the set-password link in a new user's invitation stays valid, in hours.
+	InvitationTTL int `yaml:"invitation_ttl_hours"`
+	// PasswordPolicy is enforced whenever a password is set.
+	PasswordPolicy PasswordPolicy `yaml:"password_policy"`
+	// BcryptCost is the cost new password hashes use; older, cheaper hashes are upgraded at the next login.
+	BcryptCost int `yaml:"bcrypt_cost"`
+	// FormTokens puts a one-time token on every new and edit form, so a double-clicked or retried Save is only
+	// applied once; submissions without a valid token are sent back to the form. FormTokenTTL is its lifetime in minutes.
+	FormTokens   bool `yaml:"form_tokens"`
+	FormTokenTTL int  `yaml:"form_token_ttl_minutes"`
+	// EditLocks warns users opening a record's edit form that someone else has it open. The advisory lock lasts
+	// EditLockTTL minutes and is refreshed while the form stays open.
+	EditLocks   bool `yaml:"edit_locks"`
+	EditLockTTL int  `yaml:"edit_lock_ttl_minutes"`
+	// Drafts autosaves edit forms while they are open and offers to restore the unsaved values when the form is
+	// opened again. A draft is kept for DraftTTL hours after its last autosave.
+	Drafts   bool `yaml:"drafts"`
+	DraftTTL int  `yaml:"draft_ttl_hours"`
+	// MaintenanceOverrideRole may still make changes while maintenance mode freezes writes for everyone else.
+	MaintenanceOverrideRole string `yaml:"maintenance_override_role"`
+	// BulkMaxRecords caps the records one POST /api/<resource>/bulk may create; they are inserted BulkBatchSize at a time.
+	BulkMaxRecords int `yaml:"bulk_max_records"`
+	BulkBatchSize  int `yaml:"bulk_batch_size"`
+	// SessionCleanup is how often expired sessions are deleted, in minutes; 0 disables the cleanup.
+	SessionCleanup int `yaml:"session_cleanup_minutes"`
+	// CookieName names the session cookie.
+	CookieName string `yaml:"cookie_name"`
+	// CookieSecure is "auto" (Secure when the request is HTTPS, directly or per X-Forwarded-Proto), "true" or "false".
+	CookieSecure string `yaml:"cookie_secure"`
+	// CookieSameSite is "lax", "strict" or "none" (which browsers only accept on Secure cookies).
+	CookieSameSite string `yaml:"cookie_same_site"`
+	// ExportFallbackToList lets roles with the "list" permission export without an "export" grant, as before exports were checked.
+	ExportFallbackToList bool `yaml:"export_fallback_to_list"`
+	// PrunePermissions makes reconciling roles defined with DefineRole, or imported, also delete the grants those
+	// roles hold beyond their definition; roles left undefined are never touched.
+	PrunePermissions bool `yaml:"prune_permissions"`
+	// AsyncExportThreshold runs exports of more rows than this as background jobs, listed on the Exports page;
+	// 0 runs them all in the request unless the resource is marked AsyncExport.
+	AsyncExportThreshold int64 `yaml:"async_export_threshold"`
+	// ExportWorkers is how many background exports run at once.
+	ExportWorkers int `yaml:"export_workers"`
+	// ExportDir holds the files of background exports.
+	ExportDir string `yaml:"export_dir"`
+	// ExportRetention is how long background export jobs and their files are kept, in hours; 0 keeps them.
+	// Finished batch jobs are kept as long.
+	ExportRetention int `yaml:"export_retention_hours"`
+	// ReportAttachmentLimit is the largest export, in bytes, a scheduled report attaches to its email; larger ones
+	// are sent as a signed download link, valid as long as ExportRetention keeps the file.
+	ReportAttachmentLimit int64 `yaml:"report_attachment_limit"`
+	// BatchJobSize is how many records a batch job action handles per call. Selections of more than
+	// BatchJobThreshold records, and "all matching" ones, run in the background on ExportWorkers workers.
+	BatchJobSize      int `yaml:"batch_job_size"`
+	BatchJobThreshold int `yaml:"batch_job_threshold"`
+	// CSVFormulaEscaping neutralises export cells spreadsheets would run as formulas (starting with =, +, -, @, tab or
+	// carriage return, other than numbers): "quote" prefixes them with a single quote, "tab" with a tab, "off" leaves
+	// them as they are.
+	CSVFormulaEscaping string `yaml:"csv_formula_escaping"`
+	// CSVBOM starts exports with a UTF-8 byte order mark, so Excel detects the encoding; ?bom=0 or 1 overrides it.
+	CSVBOM bool `yaml:"csv_bom"`
+	// CSVDelimiter separates export columns, e.g. ";" for locales whose spreadsheets expect it; ?delimiter=
+	// (comma, semicolon, tab or the character itself) overrides it.
+	CSVDelimiter string `yaml:"csv_delimiter"`
+	// AllowAdminImpersonation lets admins impersonate other admin-role users, not just lower-privileged ones.
+	AllowAdminImpersonation bool `yaml:"allow_admin_impersonation"`
+	// TrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-For header is believed when recording client IPs.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// PrivateUploads serves uploads only through signed links that expire, to signed-in users.
+	PrivateUploads bool `yaml:"private_uploads"`
+	// UploadURLTTL is how long a signed upload link stays valid, in minutes.
+	UploadURLTTL int `yaml:"upload_url_ttl_minutes"`
+	// SecretKey signs upload links. Leave it unset only on a single server: a random key is then used, and links
+	// stop working at restart.
+	SecretKey string `yaml:"secret_key"`
+	// EncryptionKey encrypts the fields marked with SetEncrypted: 32 random bytes, base64-encoded. Each value records
+	// the id of the key it was encrypted with, so values written under OldEncryptionKeys still decrypt while
+	// Registry.RotateEncryptionKey moves them to the new key.
+	EncryptionKey     string   `yaml:"encryption_key"`
+	OldEncryptionKeys []string `yaml:"old_encryption_keys"`
+	// BootstrapAdminFromEnv makes Migrate create the first admin user from the ADMIN_EMAIL and ADMIN_PASSWORD
+	// environment variables when there are no users yet.
+	BootstrapAdminFromEnv bool `yaml:"bootstrap_admin_from_env"`
+	// SMTP configures the built-in mailer used when no Mailer is set.
+	SMTP SMTPConfig `yaml:"smtp"`
+	// DefaultLocale is the UI language for users who have not picked one and whose browser asks for none available.
+	DefaultLocale string `yaml:"default_locale"`
+	// Locales lists the UI languages users can pick from; empty offers the default and those the translator has.
+	Locales []string `yaml:"locales"`
+	// Branding customises the logo, favicon, colours and login page; unset values keep the defaults.
+	Branding Branding `yaml:"branding"`
+	// OIDC adds "Sign in with SSO" to the login page, through an OpenID Connect provider such as Okta.
+	OIDC OIDCConfig `yaml:"oidc"`
+	// DisablePasswordLogin turns off signing in with an email and password, and password resets, leaving SSO.
+	DisablePasswordLogin bool `yaml:"disable_password_login"`
+}
+
+// OIDCConfig is the OpenID Connect provider users sign in through. IssuerURL and ClientID enable it. The provider
+// must send users back to RedirectPath under the admin's base path, "/login/sso/callback" by default. Users are
+// matched by the ID token's email, and created on their first sign-in; RoleMapping maps the values of the token's
+// RoleClaim ("groups" by default) to admin roles, and users none of whose values are mapped cannot sign in.
+type OIDCConfig struct {
+	IssuerURL    string            `yaml:"issuer_url"`
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	RedirectPath string            `yaml:"redirect_path"`
+	RoleClaim    string            `yaml:"role_claim"`
+	RoleMapping  map[string]string `yaml:"role_mapping"`
+}
+
+// Branding is the admin's look. The colours take any CSS colour (e.g. "#0f766e", "rgb(15, 118, 110)" or
+// "teal"); anything else is ignored. LoginMessage and FooterHTML are trusted markup, rendered as they are.
+type Branding struct {
+	LogoURL      string        `yaml:"logo_url"`
+	FaviconURL   string        `yaml:"favicon_url"`
+	PrimaryColor string        `yaml:"primary_color"`
+	AccentColor  string        `yaml:"accent_color"`
+	LoginMessage template.HTML `yaml:"login_message"`
+	FooterHTML   template.HTML `yaml:"footer_html"`
+}
+
+// SMTPConfig is the SMTP server used for admin email.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// PasswordPolicy lists the rules new passwords must meet.
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	// DisallowCommon rejects passwords from a built-in list of the most common ones.
+	DisallowCommon bool `yaml:"disallow_common"`
 }
 
 // DefaultConfig returns a sane default configuration.
 func DefaultConfig() *Config {
 	return &Config{
-		SiteTitle:       "Go Admin",
-		DefaultPerPage:  10,
-		ThemeColor:      "#2563eb",
-		SessionTTL:      24,
-		SearchThreshold: 50,
-		UploadDir:       "uploads",
+		SiteTitle:          "Go Admin",
+		DefaultLocale:      "en",
+		BasePath:           "/admin",
+		DefaultPerPage:     10,
+		MaxPerPage:         500,
+		AssociationPerPage: 10,
+		ThemeColor:         "#2563eb",
+		SessionTTL:         24,
+		SearchThreshold:    50,
+		UploadDir:          "uploads",
+		Gzip:               true,
+		CountCacheTTL:      60,
+		QueryTimeout:       30,
+		ExportTimeout:      300,
+		ActivityFeedSize:   10,
+		AutoResourceStats:  true,
+		WebhookWorkers:     4,
+		WebhookMaxAttempts: 5,
+		PasswordResetTTL:   60,
+		InvitationTTL:      72,
+		UploadURLTTL:       60,
+		PasswordPolicy:     PasswordPolicy{MinLength: 8},
+		BcryptCost:         10,
+		CookieName:         "admin_session",
+		SessionCleanup:     60,
+		FormTokenTTL:       120,
+		EditLockTTL:        5,
+		DraftTTL:           24,
+		BulkMaxRecords:     1000,
+		BulkBatchSize:      100,
+		CookieSecure:       "auto",
+		CookieSameSite:     "lax",
+		SMTP:               SMTPConfig{Port: 587},
+		CSVFormulaEscaping: "quote",
+		ExportWorkers:      2,
+		ExportDir:          "exports",
+		ExportRetention:    24,
+		ReportAttachmentLimit: 5 << 20,
+		BatchJobSize:       500,
+		BatchJobThreshold:  500,
+		CSVDelimiter:       ",",
 	}
 }
 
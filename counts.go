@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"context"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// countCache memoises row counts for a TTL and collapses concurrent lookups of the same key into one query.
+type countCache struct {
+	mu       sync.Mutex
+	entries  map[string]countEntry
+	inflight map[string]*countCall
+}
+
+type countEntry struct {
+	value   int64
+	expires time.Time
+}
+
+type countCall struct {
+	wg    sync.WaitGroup
+	value int64
+}
+
+func newCountCache() *countCache {
+	return &countCache{entries: make(map[string]countEntry), inflight: make(map[string]*countCall)}
+}
+
+// get returns the cached value for key or loads it; failed loads (ok == false) are shared with waiters but not cached,
+// and a load that panics leaves nothing cached or in flight.
+func (c *countCache) get(key string, ttl time.Duration, load func() (int64, bool)) int64 {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expires) { c.mu.Unlock(); return e.value }
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.value
+	}
+	call := &countCall{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	// Waiters are released even if load panics; they then see 0, as for a failed load.
+	ok := false
+	defer func() {
+		c.mu.Lock()
+		if ok { c.entries[key] = countEntry{value: call.value, expires: time.Now().Add(ttl)} }
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.value, ok = load()
+	return call.value
+}
+
+// CountFor counts rows of a resource using its count strategy. A nil query counts the whole table;
+// estimated counts only ever apply to that unfiltered case.
+func (reg *Registry) CountFor(ctx context.Context, res *resource.Resource, query *gorm.DB) int64 {
+	// A scoped user's total is theirs alone, so it is never the shared table-wide count.
+	if query == nil && reg.scoped(ctx) { query = reg.scope(ctx, res, reg.resourceReader(ctx, res).Model(res.Model)) }
+	exact := func() (int64, bool) {
+		var n int64
+		q := query
+		if q == nil { q = reg.resourceReader(ctx, res).Model(res.Model) }
+		return n, q.Count(&n).Error == nil
+	}
+	switch res.CountStrategy {
+	case resource.CountCached:
+		key := res.Slug
+		if query != nil {
+			var n int64
+			key += "|" + query.ToSQL(func(tx *gorm.DB) *gorm.DB { return tx.Count(&n) })
+		}
+		return reg.counts.get(key, time.Duration(reg.Config.CountCacheTTL)*time.Second, exact)
+	case resource.CountEstimated:
+		if query == nil {
+			if n, ok := reg.estimateCount(ctx, res); ok { return n }
+		}
+	}
+	n, _ := exact()
+	return n
+}
+
+// estimateCount reads the planner's row estimate where the database keeps one. SQLite has none, so callers fall back to COUNT.
+func (reg *Registry) estimateCount(ctx context.Context, res *resource.Resource) (int64, bool) {
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return 0, false }
+	var n int64
+	db := reg.resourceReader(ctx, res)
+	switch db.Dialector.Name() {
+	case "postgres":
+		err = db.Raw("SELECT reltuples::bigint FROM pg_class WHERE relname = ?", sch.Table).Scan(&n).Error
+	case "mysql":
+		err = db.Raw("SELECT table_rows FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", sch.Table).Scan(&n).Error
+	default:
+		return 0, false
+	}
+	// Postgres reports -1 for tables that have never been analysed.
+	if err != nil || n < 0 { return 0, false }
+	return n, true
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of month, month and day of week (0 or 7
+// is Sunday). Fields take *, values, ranges (1-5), lists (1,15) and steps (*/15, 9-17/2); "@daily", "@weekly",
+// "@monthly" and "@hourly" are shorthands.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of the values each field allows
+	domAny, dowAny                bool
+}
+
+var cronShorthands = map[string]string{"@hourly": "0 * * * *", "@daily": "0 0 * * *", "@weekly": "0 0 * * 0", "@monthly": "0 0 1 * *"}
+
+// parseCron parses a cron expression such as "0 8 * * 1", every Monday at 8:00.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if s, ok := cronShorthands[strings.ToLower(expr)]; ok { expr = s }
+	fields := strings.Fields(expr)
+	if len(fields) != 5 { return nil, fmt.Errorf("schedule %q: want 5 fields (minute hour day month weekday), got %d", expr, len(fields)) }
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := [5]string{"minute", "hour", "day of month", "month", "day of week"}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := cronField(f, bounds[i][0], bounds[i][1])
+		if err != nil { return nil, fmt.Errorf("schedule %q: %s: %w", expr, names[i], err) }
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 { sets[4] |= 1 }
+	return &cronSchedule{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4], domAny: fields[2] == "*", dowAny: fields[4] == "*"}, nil
+}
+
+// cronField parses one comma-separated field into the set of values it allows between lo and hi.
+func cronField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 { return 0, fmt.Errorf("bad step %q", stepText) }
+			step = n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil { return 0, fmt.Errorf("bad value %q", a) }
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil { return 0, fmt.Errorf("bad value %q", b) }
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to { return 0, fmt.Errorf("%q is outside %d-%d", part, lo, hi) }
+		for v := from; v <= to; v += step { set |= 1 << uint(v) }
+	}
+	return set, nil
+}
+
+// dayMatches applies cron's rule for days: when both the day of month and the day of week are restricted, either
+// one matching is enough.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := c.dom&(1<<uint(t.Day())) != 0, c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny { return dom && dow }
+	return dom || dow
+}
+
+// Next is the first time after after, to the minute, that the schedule matches, read on the wall clock of loc.
+// Wall-clock times a daylight saving change skips are passed over. It returns the zero time when nothing matches
+// within five years, e.g. for February 30th.
+func (c *cronSchedule) Next(after time.Time, loc *time.Location) time.Time {
+	t := after.In(loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -1,37 +1,56 @@
 package admin
 
 import (
+	"context"
+	"gorm.io/gorm"
 	"reflect"
 )
 
 func (reg *Registry) List(resourceName string) (interface{}, error) {
 	res, ok := reg.GetResource(resourceName)
 	if !ok { return nil, nil }
-	modelType := reflect.TypeOf(res.Model)
-	destSlice := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0); dest := reflect.New(destSlice.Type())
-	err := reg.DB.Find(dest.Interface()).Error
+	dest := reflect.New(res.Meta().SliceType)
+	err := reg.resourceHandle(res).Find(dest.Interface()).Error
 	return dest.Elem().Interface(), err
 }
 
 func (reg *Registry) Create(resourceName string, data interface{}) error {
-	return reg.DB.Create(data).Error
+	res, _ := reg.GetResource(resourceName)
+	return reg.resourceHandle(res).Create(data).Error
 }
 
 func (reg *Registry) Get(resourceName string, id interface{}) (interface{}, error) {
+	return reg.getContext(context.Background(), resourceName, id)
+}
+
+func (reg *Registry) getContext(ctx context.Context, resourceName string, id interface{}) (interface{}, error) {
+	res, _ := reg.GetResource(resourceName)
+	return reg.getOn(reg.resourceDB(ctx, res), resourceName, id)
+}
+
+// getOn looks a record up by key on db, within the scope of the user in db's context.
+func (reg *Registry) getOn(db *gorm.DB, resourceName string, id interface{}) (interface{}, error) {
 	res, ok := reg.GetResource(resourceName)
 	if !ok { return nil, nil }
 	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
-	err := reg.DB.First(model, id).Error
-	return model, err
+	q, err := reg.whereKey(reg.scope(db.Statement.Context, res, db), res, id)
+	if err != nil { return nil, err }
+	return model, q.First(model).Error
 }
 
 func (reg *Registry) Update(resourceName string, data interface{}) error {
-	return reg.DB.Save(data).Error
+	res, _ := reg.GetResource(resourceName)
+	return reg.resourceHandle(res).Save(data).Error
 }
 
 func (reg *Registry) Delete(resourceName string, id interface{}) error {
+	return reg.deleteContext(context.Background(), resourceName, id)
+}
+
+func (reg *Registry) deleteContext(ctx context.Context, resourceName string, id interface{}) error {
 	res, ok := reg.GetResource(resourceName)
 	if !ok { return nil }
-	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
-	return reg.DB.Delete(model, id).Error
+	q, err := reg.whereKey(reg.scope(ctx, res, reg.resourceDB(ctx, res)), res, id)
+	if err != nil { return err }
+	return q.Delete(reflect.New(reflect.TypeOf(res.Model)).Interface()).Error
 }
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+)
+
+// RegisterWithDB adds a model as a resource whose records live on db rather than the registry's DB. Its lists,
+// pages, saves, deletes, exports, counts and searches all run there; users, sessions, permissions and the audit log
+// stay on the registry's DB. Associations can't join across databases, so Validate reports any between resources
+// on different handles. Migrate leaves db's tables to the caller.
+func (reg *Registry) RegisterWithDB(m interface{}, db *gorm.DB) *resource.Resource {
+	res := reg.Register(m)
+	res.DB = db
+	return res
+}
+
+// resourceHandle is the DB res's records live on: its own when it has one, else the registry's. A nil res, an
+// unregistered model, gets the registry's.
+func (reg *Registry) resourceHandle(res *resource.Resource) *gorm.DB {
+	if res != nil && res.DB != nil { return res.DB }
+	return reg.DB
+}
+
+// resourceDB is resourceHandle under ctx, for writes and for reads that must see them.
+func (reg *Registry) resourceDB(ctx context.Context, res *resource.Resource) *gorm.DB { return reg.resourceHandle(res).WithContext(ctx) }
+
+// resourceReader is reader for res's records. The read DB replicates the registry's, so a resource on its own DB
+// reads from that instead.
+func (reg *Registry) resourceReader(ctx context.Context, res *resource.Resource) *gorm.DB {
+	if res.DB != nil { return res.DB.WithContext(ctx) }
+	return reg.reader(ctx)
+}
+
+// sameDatabase reports whether the records of a and b live on the same DB, so queries can join them.
+func (reg *Registry) sameDatabase(a, b *resource.Resource) bool { return onDB(reg.resourceHandle(a), reg.resourceHandle(b)) }
+
+// onDB reports whether db and other share a connection pool. Sessions and transactions keep the pool of the handle
+// they come from, so a transaction is on the DB it was begun on.
+func onDB(db, other *gorm.DB) bool {
+	if db == nil || other == nil { return db == other }
+	return db.Config.ConnPool == other.Config.ConnPool
+}
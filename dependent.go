@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+)
+
+// DependentSelect is a dependent field's select on the form: the options its parent's value allows and the value
+// chosen.
+type DependentSelect struct {
+	Options []resource.Option
+	Value   string
+}
+
+// dependentOptions are the options f offers while its parent holds parent, never nil so they encode as a JSON list.
+func dependentOptions(db *gorm.DB, f resource.Field, parent string) []resource.Option {
+	opts := f.OptionsFiltered(db, parent)
+	if opts == nil { opts = []resource.Option{} }
+	return opts
+}
+
+// dependentSelects fills the form's dependent selects with the options of their parents' values in value, so an
+// edit form opens with the record's choices already narrowed.
+func dependentSelects(db *gorm.DB, fields []resource.Field, value func(name string) string) map[string]DependentSelect {
+	selects := make(map[string]DependentSelect)
+	for _, f := range fields {
+		if f.OptionsFiltered == nil { continue }
+		selects[f.Name] = DependentSelect{Options: dependentOptions(db, f, value(f.DependsOn)), Value: value(f.Name)}
+	}
+	return selects
+}
+
+// dependentErrors checks the dependent fields of item that user may edit, except those in skip, against the options
+// their parent's value in item allows. Unset fields are not checked.
+func dependentErrors(db *gorm.DB, res *resource.Resource, user *models.AdminUser, item reflect.Value, skip map[string]bool) map[string]string {
+	errs := make(map[string]string)
+	text := recordText(item)
+	for _, f := range res.VisibleFields(user) {
+		if f.OptionsFiltered == nil || f.Readonly || skip[f.Name] { continue }
+		if v := reflect.Indirect(fieldValue(item, f.Name)); !v.IsValid() || v.IsZero() { continue }
+		value, allowed := text(f.Name), false
+		for _, o := range dependentOptions(db, f, text(f.DependsOn)) { if o.Value == value { allowed = true; break } }
+		if allowed { continue }
+		parent := f.DependsOn
+		for _, p := range res.Fields { if p.Name == f.DependsOn { parent = p.Label; break } }
+		errs[f.Name] = fmt.Sprintf("%q is not a valid %s for this %s.", value, f.Label, parent)
+	}
+	return errs
+}
+
+// dependentError is the first of dependentErrors' problems in field order, for edits that report one error, or nil.
+func dependentError(db *gorm.DB, res *resource.Resource, user *models.AdminUser, item reflect.Value) error {
+	errs := dependentErrors(db, res, user, item, nil)
+	if len(errs) == 0 { return nil }
+	for _, f := range res.Fields { if msg, ok := errs[f.Name]; ok { return errors.New(msg) } }
+	return nil
+}
+
+// handleFieldOptions serves /<resource>/field_options?field=State&parent=DE, the options a dependent field offers
+// for its parent's value, for the form to reload them when the parent changes.
+func (reg *Registry) handleFieldOptions(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+	var field *resource.Field
+	for i := range res.Fields { if res.Fields[i].Name == r.URL.Query().Get("field") && res.Fields[i].OptionsFiltered != nil { field = &res.Fields[i] } }
+	if field == nil || !field.VisibleFor(CurrentUser(r.Context())) { writeJSONError(w, http.StatusNotFound, "not found"); return }
+	writeJSON(w, dependentOptions(reg.resourceDB(r.Context(), res), *field, r.URL.Query().Get("parent")))
+}
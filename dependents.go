@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// DeleteData is the delete confirmation of records that still have dependents: how many live records each HasMany
+// and HasOne association has across IDs and what the delete does to them. Blocked is set when an association
+// refuses the delete; Summary reads "This customer has 14 orders and 2 addresses".
+type DeleteData struct {
+	IDs        []string
+	Dependents []DependentCount
+	Summary    string
+	Blocked    bool
+	Action     string // where the confirmation posts
+}
+
+// DependentCount is how many live records of an association refer to the records being deleted, and its strategy.
+type DependentCount struct {
+	Label, OnDelete string
+	Count           int64
+}
+
+// dependent is a HasMany or HasOne association a delete checks: its resource, columns and strategy.
+type dependent struct {
+	assoc    resource.Association
+	target   *resource.Resource
+	pk, fk   string // qualified key and foreign key columns
+	set      string // the foreign key column, unqualified for an UPDATE's SET
+	onDelete string
+}
+
+// deleteEvent is an audit entry and change notification a delete made, announced once its transaction commits.
+type deleteEvent struct {
+	slug, id, action, note, event string
+	changes map[string]FieldChange
+}
+
+// deletion is one delete's transaction: the records it has reached, in order, so cascades through cycles stop, and
+// its events.
+type deletion struct {
+	tx      *gorm.DB
+	user    *models.AdminUser
+	seen    map[string]bool
+	reached []string
+	events  []deleteEvent
+}
+
+// mark is how far d has got, for undo.
+func (d *deletion) mark() (int, int) { return len(d.reached), len(d.events) }
+
+// undo forgets what d did after mark, once a savepoint rolled it back.
+func (d *deletion) undo(reached, events int) {
+	for _, k := range d.reached[reached:] { delete(d.seen, k) }
+	d.reached, d.events = d.reached[:reached], d.events[:events]
+}
+
+// dependents resolves res's HasMany and HasOne associations to the columns a delete checks. Those Validate reports,
+// with no foreign key or to an unknown resource or one on a different database, are left out: their records can't
+// be counted or changed in the delete's transaction.
+func (reg *Registry) dependents(res *resource.Resource) []dependent {
+	var deps []dependent
+	for _, a := range res.Associations {
+		if a.Type != "HasMany" && a.Type != "HasOne" { continue }
+		target, ok := reg.GetResource(a.ResourceName)
+		if !ok || !reg.sameDatabase(res, target) { continue }
+		sch, err := reg.parseSchema(target.Model)
+		if err != nil { continue }
+		fk := sch.LookUpField(a.ForeignKey)
+		pk, pkOK := column(sch, target.PrimaryKey)
+		if a.ForeignKey == "" || fk == nil || fk.DBName == "" || !pkOK { continue }
+		onDelete := a.OnDelete
+		if onDelete == "" { onDelete = resource.DependentBlock }
+		deps = append(deps, dependent{assoc: a, target: target, pk: pk, fk: sch.Table + "." + fk.DBName, set: fk.DBName, onDelete: onDelete})
+	}
+	return deps
+}
+
+// model is a new zero record of d's resource, for queries on its table.
+func (d dependent) model() interface{} { return reflect.New(reflect.TypeOf(d.target.Model)).Interface() }
+
+// countDependents counts the live records of each of res's dependent associations referring to any of the records
+// keyed ids the request's user may see. Trashed records are not counted: they don't stop a delete.
+func (reg *Registry) countDependents(ctx context.Context, res *resource.Resource, ids []string) ([]DependentCount, bool, error) {
+	deps := reg.dependents(res)
+	if len(deps) == 0 || len(ids) == 0 { return nil, false, nil }
+	db := reg.resourceDB(ctx, res)
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return nil, false, err }
+	col, ok := column(sch, res.PrimaryKey)
+	if !ok { return nil, false, fmt.Errorf("cannot resolve key %q of %s", res.PrimaryKey, res.Name) }
+	var keys []interface{}
+	if err := reg.scope(ctx, res, db.Model(res.Model)).Where(col+" IN ?", keyValues(res, ids)).Pluck(col, &keys).Error; err != nil { return nil, false, err }
+	if len(keys) == 0 { return nil, false, nil }
+	var counts []DependentCount
+	blocked := false
+	for _, d := range deps {
+		var n int64
+		if err := db.Model(d.model()).Where(d.fk+" IN ?", keys).Count(&n).Error; err != nil { return nil, false, err }
+		if n == 0 { continue }
+		counts = append(counts, DependentCount{Label: d.assoc.Label, OnDelete: d.onDelete, Count: n})
+		blocked = blocked || d.onDelete == resource.DependentBlock
+	}
+	return counts, blocked, nil
+}
+
+// dependentSummary lists counts as "14 orders and 2 addresses".
+func (reg *Registry) dependentSummary(ctx context.Context, counts []DependentCount) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts { parts[i] = fmt.Sprintf("%d %s", c.Count, strings.ToLower(c.Label)) }
+	if len(parts) < 2 { return strings.Join(parts, "") }
+	return strings.Join(parts[:len(parts)-1], ", ") + " " + reg.T(ctx, "and") + " " + parts[len(parts)-1]
+}
+
+// deleteRecord deletes the record of res keyed id in d's transaction: its delete hooks and tree release, then its
+// live dependents by their associations' strategies, then the record itself with an audit entry noting what happened
+// to them. Cascaded children go through the same path, auditing each; scoped limits the record to those the
+// request's user may see, which a cascade's children, reached through their parent, are not. A blocking association
+// with dependents fails the delete, as do the hooks, with a formError.
+func (reg *Registry) deleteRecord(d *deletion, res *resource.Resource, id, note string, scoped bool) error {
+	if d.seen[res.Slug+"#"+id] { return nil }
+	d.seen[res.Slug+"#"+id], d.reached = true, append(d.reached, res.Slug+"#"+id)
+	ctx := d.tx.Statement.Context
+	db := func() *gorm.DB {
+		if scoped { return reg.scope(ctx, res, d.tx) }
+		return d.tx
+	}
+	q, err := reg.whereKey(db(), res, id)
+	if err != nil { return err }
+	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
+	if err := q.First(model).Error; err != nil { return err }
+	if err := runDeleteHooks(res, d.tx, d.user, id); err != nil { return formError{err} }
+	if err := reg.releaseTreeChildren(d.tx, res, id); err != nil { return formError{err} }
+	key := recordKey(res, reflect.ValueOf(model).Elem())
+	var done []string
+	for _, dep := range reg.dependents(res) {
+		var keys []interface{}
+		if err := d.tx.Model(dep.model()).Where(dep.fk+" = ?", key).Order(dep.pk).Pluck(dep.pk, &keys).Error; err != nil { return err }
+		if len(keys) == 0 { continue }
+		label := strings.ToLower(dep.assoc.Label)
+		switch dep.onDelete {
+		case resource.DependentCascade:
+			for _, k := range keys {
+				if err := reg.deleteRecord(d, dep.target, fmt.Sprint(k), fmt.Sprintf("Deleted with %s #%s", res.Name, id), false); err != nil { return err }
+			}
+			done = append(done, fmt.Sprintf("deleted %d %s", len(keys), label))
+		case resource.DependentNullify:
+			// Trashed records are unlinked too, so restoring one doesn't bring back a link to a deleted record.
+			if err := d.tx.Unscoped().Model(dep.model()).Where(dep.fk+" = ?", key).Update(dep.set, nil).Error; err != nil { return err }
+			for _, k := range keys {
+				childID, change := fmt.Sprint(k), FieldChange{From: key}
+				childNote := fmt.Sprintf("%s: %q → %q (%s #%s deleted)", dep.assoc.ForeignKey, fmt.Sprint(key), "", res.Name, id)
+				if err := reg.recordAction(d.tx, d.user, dep.target.Slug, childID, "Update", childNote); err != nil { return err }
+				d.events = append(d.events, deleteEvent{slug: dep.target.Slug, id: childID, action: "Update", note: childNote, event: "update", changes: map[string]FieldChange{dep.assoc.ForeignKey: change}})
+			}
+			done = append(done, fmt.Sprintf("unlinked %d %s", len(keys), label))
+		default:
+			return formError{fmt.Errorf("%s #%s still has %d %s", res.Name, id, len(keys), label)}
+		}
+	}
+	if q, err = reg.whereKey(db(), res, id); err != nil { return err }
+	result := q.Delete(reflect.New(reflect.TypeOf(res.Model)).Interface())
+	if result.Error != nil { return result.Error }
+	if result.RowsAffected == 0 { return gorm.ErrRecordNotFound }
+	if len(done) > 0 { note += " (" + strings.Join(done, ", ") + ")" }
+	if err := reg.recordAction(d.tx, d.user, res.Slug, id, "Delete", note); err != nil { return err }
+	d.events = append(d.events, deleteEvent{slug: res.Slug, id: id, action: "Delete", note: note, event: "delete"})
+	return nil
+}
+
+// announce sends events' audit notifications and change notifications, once their transaction has committed.
+func (reg *Registry) announce(user *models.AdminUser, events []deleteEvent) {
+	for _, e := range events {
+		reg.afterAudit(user, e.slug, e.id, e.action, e.note)
+		reg.notifyChange(user, e.slug, e.event, e.id, e.changes)
+	}
+}
+
+// renderDeleteConfirm shows what deleting ids does to their dependents, asking to confirm unless blocked (409).
+func (reg *Registry) renderDeleteConfirm(res *resource.Resource, data *DeleteData, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/delete.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	if data.Blocked { w.WriteHeader(http.StatusConflict) }
+	reg.execute(w, r, tmpl, "delete.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		CurrentResource: res, IDs: data.IDs, Delete: data, User: user, CSS: reg.styleCSS(),
+		Title: reg.T(r.Context(), "Delete %s", reg.resName(r.Context(), res)), Breadcrumbs: reg.breadcrumbs(r.Context(), reg.resourceCrumb(r.Context(), res), Crumb{Label: reg.T(r.Context(), "Delete")}),
+	})
+}
+
+// handleDelete serves <resource>/delete?id=X. A record with live dependents first gets a confirmation page listing
+// them, posted back with confirm; the delete and whatever its associations' strategies do to the dependents run in
+// one transaction.
+func (reg *Registry) handleDelete(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	id := r.URL.Query().Get("id")
+	if _, err := reg.getContext(r.Context(), res.Slug, id); err != nil { reg.renderRecordError(w, r, err); return }
+	counts, blocked, err := reg.countDependents(r.Context(), res, []string{id})
+	if err != nil {
+		reg.log(r.Context()).Error("dependent check failed", "resource", res.Slug, "id", id, "error", err)
+		reg.setFlash(w, reg.T(r.Context(), "Could not delete: %s", err.Error())); http.Redirect(w, r, reg.URL("/"+res.Slug), 303); return
+	}
+	if len(counts) > 0 && (blocked || r.Method != http.MethodPost || r.FormValue("confirm") == "") {
+		reg.renderDeleteConfirm(res, &DeleteData{
+			IDs: []string{id}, Dependents: counts, Blocked: blocked, Action: reg.URL("/" + res.Slug + "/delete?id=" + url.QueryEscape(id)),
+			Summary: reg.T(r.Context(), "This %s has %s.", strings.ToLower(res.Name), reg.dependentSummary(r.Context(), counts)),
+		}, w, r, user)
+		return
+	}
+	d := &deletion{user: user, seen: map[string]bool{}}
+	err = reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		d.tx = tx
+		return reg.deleteRecord(d, res, id, "Record deleted", true)
+	})
+	var fe formError
+	switch {
+	case errors.As(err, &fe):
+		reg.setFlash(w, fe.Error()); http.Redirect(w, r, reg.URL("/"+res.Slug), 303); return
+	case err != nil:
+		reg.log(r.Context()).Error("delete failed", "resource", res.Slug, "id", id, "user", user.Email, "error", err)
+		reg.setFlash(w, reg.T(r.Context(), "Could not delete: %s", err.Error())); http.Redirect(w, r, reg.URL("/"+res.Slug), 303); return
+	}
+	reg.announce(user, d.events)
+	reg.setFlash(w, reg.T(r.Context(), "%s deleted successfully", reg.resName(r.Context(), res)))
+	http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+}
@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// draftNew is the RecordID of a draft of a record not yet created.
+const draftNew = "new"
+
+// draftInterval is how often an open form autosaves its draft, when its values have changed.
+const draftInterval = 30 * time.Second
+
+// DraftData backs the form's autosave and its restore banner: where the form autosaves, and when the user has an
+// unsaved draft newer than the record, when it was saved and where to restore or discard it. Restored is set once
+// the draft's values fill the form.
+type DraftData struct {
+	SaveURL, FormURL, RestoreURL, DiscardURL string
+	IntervalMilliseconds int64
+	SavedAt  time.Time // zero when there is no draft to offer
+	Restored bool
+}
+
+func (reg *Registry) draftTTL() time.Duration {
+	if reg.Config.DraftTTL <= 0 { return 24 * time.Hour }
+	return time.Duration(reg.Config.DraftTTL) * time.Hour
+}
+
+// draftRecordID is the RecordID of drafts of the record keyed id, or of a new one when id is blank.
+func draftRecordID(id string) string {
+	if id == "" || id == "0" { return draftNew }
+	return id
+}
+
+// draftFields are the form fields a draft keeps: those user may edit, less the key and what a save fills in itself,
+// and less uploads, passwords and encrypted fields, which a draft would store in the clear.
+func draftFields(res *resource.Resource, user *models.AdminUser) []resource.Field {
+	var fields []resource.Field
+	for _, f := range res.GetFieldsForUser("edit", user) {
+		switch {
+		case f.Readonly, f.Virtual, f.Encrypted, f.Type == "password", f.Type == "file", f.Type == "image", f.Name == res.PrimaryKey, res.IsUserStamp(f.Name):
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// loadDraft is user's unexpired draft of a record of res, or nil.
+func (reg *Registry) loadDraft(ctx context.Context, res *resource.Resource, recordID string, user *models.AdminUser) (*models.Draft, error) {
+	var d models.Draft
+	err := reg.DB.WithContext(ctx).Where("resource_name = ? AND record_id = ? AND user_id = ? AND expires_at > ?", res.Slug, recordID, user.ID, time.Now()).First(&d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) { return nil, nil }
+	if err != nil { return nil, err }
+	return &d, nil
+}
+
+// saveDraft stores, or replaces, user's draft of a record of res, keeping it another DraftTTL.
+func (reg *Registry) saveDraft(ctx context.Context, res *resource.Resource, recordID string, user *models.AdminUser, values url.Values) error {
+	data, err := json.Marshal(values)
+	if err != nil { return err }
+	db, now := reg.DB.WithContext(ctx), time.Now()
+	var d models.Draft
+	err = db.Where("resource_name = ? AND record_id = ? AND user_id = ?", res.Slug, recordID, user.ID).First(&d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(&models.Draft{UserID: user.ID, ResourceName: res.Slug, RecordID: recordID, Values: string(data), UpdatedAt: now, ExpiresAt: now.Add(reg.draftTTL())}).Error
+	}
+	if err != nil { return err }
+	return db.Model(&d).Updates(map[string]interface{}{"values": string(data), "updated_at": now, "expires_at": now.Add(reg.draftTTL())}).Error
+}
+
+func (reg *Registry) deleteDraft(ctx context.Context, res *resource.Resource, recordID string, user *models.AdminUser) error {
+	return reg.DB.WithContext(ctx).Where("resource_name = ? AND record_id = ? AND user_id = ?", res.Slug, recordID, user.ID).Delete(&models.Draft{}).Error
+}
+
+// draftData sets up the autosave of the form of res's record keyed id (blank for a new one), or returns nil when
+// Config.Drafts is off. Opening the form (offer) also looks for the user's draft, which is left out when the record
+// was saved since; with ?draft=1 its values are returned to fill the form in place of item's. They are only shown:
+// saving them goes through the same checks as any save.
+func (reg *Registry) draftData(r *http.Request, res *resource.Resource, item interface{}, id string, fields []resource.Field, user *models.AdminUser, offer bool) (*DraftData, map[string]interface{}) {
+	if !reg.Config.Drafts { return nil, nil }
+	q, form := "", reg.URL("/"+res.Slug+"/new")
+	if id != "" { q, form = "?id="+url.QueryEscape(id), reg.URL("/"+res.Slug+"/edit?id="+url.QueryEscape(id)) }
+	sep := "?"
+	if q != "" { sep = "&" }
+	data := &DraftData{SaveURL: reg.URL("/" + res.Slug + "/draft" + q), DiscardURL: reg.URL("/" + res.Slug + "/draft" + q + sep + "discard=1"), FormURL: form, RestoreURL: form + sep + "draft=1", IntervalMilliseconds: draftInterval.Milliseconds()}
+	if !offer { return data, nil }
+	d, err := reg.loadDraft(r.Context(), res, draftRecordID(id), user)
+	if err != nil { reg.log(r.Context()).Error("loading draft failed", "resource", res.Slug, "id", id, "error", err) }
+	if d == nil { return data, nil }
+	if item != nil {
+		if v := fieldValue(reflect.ValueOf(item), "UpdatedAt"); v.IsValid() && v.Type() == reflect.TypeOf(time.Time{}) && !v.Interface().(time.Time).Before(d.UpdatedAt) { return data, nil }
+	}
+	data.SavedAt = d.UpdatedAt
+	if r.URL.Query().Get("draft") == "" { return data, nil }
+	var values url.Values
+	if err := json.Unmarshal([]byte(d.Values), &values); err != nil {
+		reg.log(r.Context()).Error("reading draft failed", "resource", res.Slug, "id", id, "error", err)
+		return data, nil
+	}
+	data.Restored = true
+	return data, reg.draftItem(res, fields, item, values, user)
+}
+
+// draftItem is the form's item with a draft's values in place of item's (or of a new record's), for display. Values
+// that no longer parse keep the record's.
+func (reg *Registry) draftItem(res *resource.Resource, fields []resource.Field, item interface{}, values url.Values, user *models.AdminUser) map[string]interface{} {
+	elem := reflect.New(reflect.TypeOf(res.Model)).Elem()
+	if item != nil { elem.Set(reflect.Indirect(reflect.ValueOf(item))) }
+	for _, f := range draftFields(res, user) {
+		vals, ok := values[f.Name]
+		field := settableField(elem, f.Name)
+		if !ok || !field.CanSet() { continue }
+		if f.Type == "tags" { setTags(field, formTags(vals)); continue }
+		setFormValue(f, field, values.Get(f.Name))
+	}
+	m := reg.itemToMap(res, fields, elem, user)
+	if item == nil { delete(m, "ID"); delete(m, keyEntry) }
+	return m
+}
+
+// handleDraft serves the form's autosave, POST <resource>/draft?id= with the form's values (no id for a new
+// record), and discarding the draft, POST <resource>/draft?id=&discard=1.
+func (reg *Registry) handleDraft(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	if !reg.Config.Drafts || res.ReadOnly { http.NotFound(w, r); return }
+	id := r.URL.Query().Get("id")
+	if draftRecordID(id) != draftNew {
+		if _, err := reg.getContext(r.Context(), res.Slug, id); err != nil { reg.renderRecordError(w, r, err); return }
+	}
+	var err error
+	if r.URL.Query().Get("discard") != "" {
+		err = reg.deleteDraft(r.Context(), res, draftRecordID(id), user)
+	} else {
+		r.ParseMultipartForm(32 << 20)
+		values := url.Values{}
+		for _, f := range draftFields(res, user) {
+			if f.Type == "tags" { values[f.Name] = r.Form[f.Name]; continue }
+			values.Set(f.Name, r.FormValue(f.Name))
+		}
+		err = reg.saveDraft(r.Context(), res, draftRecordID(id), user, values)
+	}
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	w.WriteHeader(http.StatusNoContent)
+}
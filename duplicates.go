@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// createAnywayField is the form field that saves a new record despite its likely duplicates, for that one save.
+const createAnywayField = "_create_anyway"
+
+// maxDuplicates caps how many likely duplicates are listed.
+const maxDuplicates = 10
+
+// DuplicateMatch is an existing record a new one may duplicate.
+type DuplicateMatch struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// duplicateValues are the submitted values of res's duplicate fields, or nil when all of them are blank.
+func duplicateValues(res *resource.Resource, get func(string) string) map[string]string {
+	values, given := make(map[string]string, len(res.DuplicateFields)), false
+	for _, name := range res.DuplicateFields {
+		v := strings.TrimSpace(get(name))
+		values[name], given = v, given || v != ""
+	}
+	if !given { return nil }
+	return values
+}
+
+// findDuplicates runs res's duplicate check on values within the records the request's user may see. Matches a
+// custom matcher returns from outside that scope are dropped.
+func (reg *Registry) findDuplicates(ctx context.Context, res *resource.Resource, values map[string]string) ([]DuplicateMatch, error) {
+	if len(res.DuplicateFields) == 0 || values == nil { return nil, nil }
+	scoped := func() *gorm.DB { return reg.scope(ctx, res, reg.resourceDB(ctx, res).Model(res.Model)) }
+	var found []map[string]interface{}
+	if res.DuplicateMatcher != nil {
+		found = res.DuplicateMatcher(scoped(), values)
+	} else {
+		var err error
+		if found, err = reg.matchDuplicates(scoped(), res, values); err != nil { return nil, err }
+	}
+	if len(found) == 0 { return nil, nil }
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return nil, err }
+	col, ok := column(sch, res.PrimaryKey)
+	if !ok { return nil, fmt.Errorf("duplicate check: cannot resolve key %q", res.PrimaryKey) }
+	ids := make([]string, len(found))
+	for i, m := range found {
+		id := m["id"]
+		if id == nil { id = m[res.PrimaryKey] }
+		if id != nil { ids[i] = fmt.Sprint(id) }
+	}
+	var visible []string
+	if err := scoped().Where(col+" IN ?", ids).Pluck(col, &visible).Error; err != nil { return nil, err }
+	inScope := make(map[string]bool, len(visible))
+	for _, id := range visible { inScope[id] = true }
+	var matches []DuplicateMatch
+	for i, m := range found {
+		if !inScope[ids[i]] || len(matches) == maxDuplicates { continue }
+		label := ""
+		for _, key := range []string{"label", "Name", "Email"} {
+			if v, ok := m[key]; ok && v != nil && fmt.Sprint(v) != "" { label = fmt.Sprint(v); break }
+		}
+		if label == "" { label = "#" + ids[i] }
+		matches = append(matches, DuplicateMatch{ID: ids[i], Label: label, URL: reg.URL("/" + res.Slug + "/show?id=" + url.QueryEscape(ids[i]))})
+	}
+	return matches, nil
+}
+
+// matchDuplicates is the default duplicate check: records with the same value, ignoring case, in any non-blank
+// duplicate field.
+func (reg *Registry) matchDuplicates(db *gorm.DB, res *resource.Resource, values map[string]string) ([]map[string]interface{}, error) {
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return nil, err }
+	var conds []string
+	var args []interface{}
+	for _, name := range res.DuplicateFields {
+		col, ok := column(sch, name)
+		if !ok || values[name] == "" { continue }
+		conds, args = append(conds, fmt.Sprintf("LOWER(%s) = LOWER(?)", col)), append(args, values[name])
+	}
+	if len(conds) == 0 { return nil, nil }
+	dest := reflect.New(res.Meta().SliceType)
+	if err := db.Where(strings.Join(conds, " OR "), args...).Limit(maxDuplicates).Find(dest.Interface()).Error; err != nil { return nil, err }
+	rows := dest.Elem()
+	found := make([]map[string]interface{}, rows.Len())
+	for i := range found {
+		item := rows.Index(i)
+		found[i] = map[string]interface{}{"id": recordKey(res, item), "label": recordLabel(res, item)}
+	}
+	return found, nil
+}
+
+// handleDuplicates serves GET <resource>/duplicates with the duplicate fields' values as query parameters, the
+// matches the new record form warns about as its fields are filled in.
+func (reg *Registry) handleDuplicates(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+	matches, err := reg.findDuplicates(r.Context(), res, duplicateValues(res, r.URL.Query().Get))
+	if err != nil {
+		reg.log(r.Context()).Error("duplicate check failed", "resource", res.Slug, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not check for duplicates")
+		return
+	}
+	if matches == nil { matches = []DuplicateMatch{} }
+	writeJSON(w, map[string]interface{}{"matches": matches})
+}
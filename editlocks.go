@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// EditLockData backs the edit form's lock banner and heartbeat: the other users editing the record, and the URLs
+// that refresh and release the viewer's own lock.
+type EditLockData struct {
+	Others                []models.EditLock
+	LockURL, UnlockURL    string
+	HeartbeatMilliseconds int64
+}
+
+func (reg *Registry) editLockTTL() time.Duration {
+	if reg.Config.EditLockTTL <= 0 { return 5 * time.Minute }
+	return time.Duration(reg.Config.EditLockTTL) * time.Minute
+}
+
+// acquireEditLock takes, or refreshes, user's lock on a record. A lock that had lapsed starts over, so the banner
+// others see doesn't date from an earlier visit.
+func (reg *Registry) acquireEditLock(ctx context.Context, res *resource.Resource, id string, user *models.AdminUser) error {
+	db, now := reg.DB.WithContext(ctx), time.Now()
+	var lock models.EditLock
+	err := db.Where("resource_name = ? AND record_id = ? AND user_id = ?", res.Slug, id, user.ID).First(&lock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(&models.EditLock{ResourceName: res.Slug, RecordID: id, UserID: user.ID, UserEmail: user.Email, UserName: user.Name, CreatedAt: now, ExpiresAt: now.Add(reg.editLockTTL())}).Error
+	}
+	if err != nil { return err }
+	updates := map[string]interface{}{"expires_at": now.Add(reg.editLockTTL())}
+	if !lock.ExpiresAt.After(now) { updates["created_at"] = now }
+	return db.Model(&lock).Updates(updates).Error
+}
+
+func (reg *Registry) releaseEditLock(ctx context.Context, res *resource.Resource, id string, user *models.AdminUser) error {
+	return reg.DB.WithContext(ctx).Where("resource_name = ? AND record_id = ? AND user_id = ?", res.Slug, id, user.ID).Delete(&models.EditLock{}).Error
+}
+
+// editLockData locks a record whose edit form user is opening and lists who else has it open, or returns nil when
+// Config.EditLocks is off. Locks are advisory, so failing to take one is logged rather than keeping the form closed.
+func (reg *Registry) editLockData(r *http.Request, res *resource.Resource, id string, user *models.AdminUser) *EditLockData {
+	if !reg.Config.EditLocks || id == "" { return nil }
+	if err := reg.acquireEditLock(r.Context(), res, id, user); err != nil {
+		reg.log(r.Context()).Error("taking edit lock failed", "resource", res.Slug, "id", id, "error", err)
+		return nil
+	}
+	q := "?id=" + url.QueryEscape(id)
+	data := &EditLockData{LockURL: reg.URL("/" + res.Slug + "/lock" + q), UnlockURL: reg.URL("/" + res.Slug + "/unlock" + q), HeartbeatMilliseconds: reg.editLockTTL().Milliseconds() / 2}
+	err := reg.DB.WithContext(r.Context()).Where("resource_name = ? AND record_id = ? AND user_id <> ? AND expires_at > ?", res.Slug, id, user.ID, time.Now()).Order("created_at").Find(&data.Others).Error
+	if err != nil { reg.log(r.Context()).Error("loading edit locks failed", "resource", res.Slug, "id", id, "error", err) }
+	return data
+}
+
+// handleEditLock serves the edit form's heartbeat, POST <resource>/lock?id=, and the release it sends when the user
+// leaves the page, POST <resource>/unlock?id=.
+func (reg *Registry) handleEditLock(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser, release bool) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	if !reg.Config.EditLocks { http.NotFound(w, r); return }
+	id := r.URL.Query().Get("id")
+	var err error
+	if release {
+		err = reg.releaseEditLock(r.Context(), res, id, user)
+	} else {
+		if _, err := reg.getContext(r.Context(), res.Slug, id); err != nil { reg.renderRecordError(w, r, err); return }
+		err = reg.acquireEditLock(r.Context(), res, id, user)
+	}
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEditLocks serves the admins' list of edit locks, /locks, and clearing one (POST /locks/clear with id) or
+// every expired one (POST /locks/clear with expired=1).
+func (reg *Registry) handleEditLocks(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser, role string) {
+	if role != "admin" { http.Error(w, "Forbidden", 403); return }
+	if !reg.Config.EditLocks { reg.renderError(w, r, http.StatusNotFound, nil); return }
+	db := reg.dbFor(r)
+	switch upath {
+	case "/locks":
+	case "/locks/clear":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		q := db.Where("expires_at <= ?", time.Now())
+		if r.FormValue("expired") == "" {
+			id, _ := strconv.ParseUint(r.FormValue("id"), 10, 64)
+			q = db.Where("id = ?", id)
+		}
+		result := q.Delete(&models.EditLock{})
+		if result.Error != nil { reg.renderError(w, r, 500, result.Error); return }
+		reg.setFlash(w, reg.T(r.Context(), "Cleared %d edit locks", result.RowsAffected))
+		http.Redirect(w, r, reg.URL("/locks"), 303)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var locks []models.EditLock
+	if err := db.Order("resource_name, record_id, created_at").Find(&locks).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/locks.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), EditLocks: locks,
+		Title: reg.T(r.Context(), "Edit locks"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Edit locks")}),
+	}
+	reg.execute(w, r, tmpl, "locks.html", pd)
+}
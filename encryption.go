@@ -0,0 +1,241 @@
+package admin
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html/template"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// encryptedPrefix starts every value SetEncrypted fields store: "enc:<key id>:<base64 of nonce and sealed value>".
+// Values without it were stored before the field was encrypted and are read as they are.
+const encryptedPrefix = "enc:"
+
+// encryptedMask stands in for an encrypted value the user may not read.
+const encryptedMask = "••••••••"
+
+// rotateBatch is how many records RotateEncryptionKey re-encrypts per query.
+const rotateBatch = 100
+
+// encryptionKey is a parsed Config.EncryptionKey: its cipher and the id stored with the values it encrypts, the
+// first 8 hex digits of the key's SHA-256.
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func parseEncryptionKey(s string) (*encryptionKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil { return nil, fmt.Errorf("encryption key: not base64: %w", err) }
+	if len(raw) != 32 { return nil, fmt.Errorf("encryption key: want 32 bytes, got %d", len(raw)) }
+	block, err := aes.NewCipher(raw)
+	if err != nil { return nil, err }
+	aead, err := cipher.NewGCM(block)
+	if err != nil { return nil, err }
+	sum := sha256.Sum256(raw)
+	return &encryptionKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func (k *encryptionKey) seal(plain string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil { return "", err }
+	sealed := k.aead.Seal(nonce, nonce, []byte(plain), []byte(k.id))
+	return encryptedPrefix + k.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *encryptionKey) open(data []byte) (string, error) {
+	n := k.aead.NonceSize()
+	if len(data) < n { return "", errors.New("encrypted value is truncated") }
+	plain, err := k.aead.Open(nil, data[:n], data[n:], []byte(k.id))
+	if err != nil { return "", errors.New("encrypted value does not match its key") }
+	return string(plain), nil
+}
+
+// keyRing is Config.EncryptionKey and OldEncryptionKeys parsed, kept with the values it was parsed from so a change
+// to them is picked up.
+type keyRing struct {
+	key     string
+	old     []string
+	current *encryptionKey
+	ring    []*encryptionKey
+	err     error
+}
+
+func parseKeyRing(key string, old []string) *keyRing {
+	kr := &keyRing{key: key, old: old}
+	if key == "" { kr.err = errors.New("no encryption key is configured"); return kr }
+	if kr.current, kr.err = parseEncryptionKey(key); kr.err != nil { return kr }
+	kr.ring = []*encryptionKey{kr.current}
+	for _, s := range old {
+		k, err := parseEncryptionKey(s)
+		if err != nil { kr.current, kr.ring, kr.err = nil, nil, fmt.Errorf("old %w", err); return kr }
+		kr.ring = append(kr.ring, k)
+	}
+	return kr
+}
+
+// encryptionKeys returns Config.EncryptionKey, which encrypts, and the ring of it and OldEncryptionKeys, which only
+// decrypt. They are parsed once and again only after the configured keys change, e.g. by RotateEncryptionKey.
+func (reg *Registry) encryptionKeys() (*encryptionKey, []*encryptionKey, error) {
+	reg.mu.RLock()
+	kr, key := reg.keys, reg.Config.EncryptionKey
+	fresh := kr != nil && kr.key == key && slices.Equal(kr.old, reg.Config.OldEncryptionKeys)
+	old := slices.Clone(reg.Config.OldEncryptionKeys)
+	reg.mu.RUnlock()
+	if !fresh {
+		kr = parseKeyRing(key, old)
+		reg.mu.Lock(); reg.keys = kr; reg.mu.Unlock()
+	}
+	return kr.current, kr.ring, kr.err
+}
+
+// encryptValue encrypts plain with Config.EncryptionKey for storing in an encrypted field.
+func (reg *Registry) encryptValue(plain string) (string, error) {
+	key, _, err := reg.encryptionKeys()
+	if err != nil { return "", err }
+	return key.seal(plain)
+}
+
+// decryptValue reads an encrypted field's stored value with whichever configured key it names.
+func (reg *Registry) decryptValue(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) { return stored, nil }
+	_, ring, err := reg.encryptionKeys()
+	if err != nil { return "", err }
+	return openWith(ring, stored)
+}
+
+func openWith(ring []*encryptionKey, stored string) (string, error) {
+	id, body, ok := strings.Cut(strings.TrimPrefix(stored, encryptedPrefix), ":")
+	if !ok { return "", errors.New("encrypted value is malformed") }
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil { return "", errors.New("encrypted value is malformed") }
+	for _, k := range ring { if k.id == id { return k.open(data) } }
+	return "", fmt.Errorf("encrypted with unknown key %s", id)
+}
+
+// storedText is an encrypted field's stored value: a string, or a nullable one.
+func storedText(val interface{}) string {
+	switch v := val.(type) {
+	case string: return v
+	case *string: if v != nil { return *v }
+	}
+	return ""
+}
+
+// revealField is an encrypted field's form value and display HTML for user: its clear text when their role may
+// decrypt it, else nothing to edit and a mask. A value that won't decrypt shows an error marker instead.
+func (reg *Registry) revealField(f resource.Field, user *models.AdminUser, val interface{}) (string, template.HTML) {
+	stored := storedText(val)
+	if stored == "" { return "", "" }
+	if !f.CanDecrypt(user) { return "", template.HTML(`<span class="encrypted-mask">` + encryptedMask + `</span>`) }
+	plain, err := reg.decryptValue(stored)
+	if err != nil {
+		reg.Logger.Error("decrypting field failed", "field", f.Name, "error", err)
+		return "", template.HTML(`<span class="encrypted-error" title="` + template.HTMLEscapeString(err.Error()) + `">⚠ Can't decrypt</span>`)
+	}
+	return plain, template.HTML(template.HTMLEscapeString(plain))
+}
+
+// exportEncrypted is an encrypted field's export cell: masked unless the field is ExportDecrypted and user's role
+// may decrypt it.
+func (reg *Registry) exportEncrypted(f resource.Field, user *models.AdminUser, val interface{}) string {
+	stored := storedText(val)
+	if stored == "" { return "" }
+	if !f.ExportDecrypted || !f.CanDecrypt(user) { return encryptedMask }
+	plain, err := reg.decryptValue(stored)
+	if err != nil { return "#DECRYPT-ERROR" }
+	return plain
+}
+
+// jsonEncrypted is an encrypted field's API value: clear text for roles that may decrypt it, else the mask; null
+// when it won't decrypt.
+func (reg *Registry) jsonEncrypted(f resource.Field, user *models.AdminUser, val interface{}) interface{} {
+	stored := storedText(val)
+	if stored == "" { return "" }
+	if !f.CanDecrypt(user) { return encryptedMask }
+	plain, err := reg.decryptValue(stored)
+	if err != nil { return nil }
+	return plain
+}
+
+// RotateEncryptionKey re-encrypts every encrypted field of every resource, trashed records included, from oldKey
+// to newKey, rotateBatch records at a time, and makes newKey the Config.EncryptionKey for new values. Values already
+// under newKey are skipped, so a rotation that fails part way can be run again; values stored before their field
+// was encrypted are encrypted. Deploy the new key with the old one in OldEncryptionKeys until this returns. It
+// returns how many values it re-encrypted.
+func (reg *Registry) RotateEncryptionKey(oldKey, newKey string) (int64, error) {
+	from, err := parseEncryptionKey(oldKey)
+	if err != nil { return 0, fmt.Errorf("old %w", err) }
+	to, err := parseEncryptionKey(newKey)
+	if err != nil { return 0, fmt.Errorf("new %w", err) }
+	reg.mu.Lock()
+	if reg.Config.EncryptionKey != newKey {
+		old := slices.Clone(reg.Config.OldEncryptionKeys)
+		if reg.Config.EncryptionKey != "" && !slices.Contains(old, reg.Config.EncryptionKey) { old = append(old, reg.Config.EncryptionKey) }
+		reg.Config.EncryptionKey, reg.Config.OldEncryptionKeys, reg.keys = newKey, old, nil
+	}
+	reg.mu.Unlock()
+	ring := []*encryptionKey{from, to}
+	var rotated int64
+	for _, res := range reg.sortedResources() {
+		n, err := reg.rotateResource(context.Background(), res, ring, to)
+		rotated += n
+		if err != nil { return rotated, fmt.Errorf("%s: %w", res.Name, err) }
+	}
+	return rotated, nil
+}
+
+// rotateResource re-encrypts res's encrypted fields under to, walking its records in primary key order.
+func (reg *Registry) rotateResource(ctx context.Context, res *resource.Resource, ring []*encryptionKey, to *encryptionKey) (int64, error) {
+	var fields []resource.Field
+	for _, f := range res.Fields { if f.Encrypted && !f.Virtual { fields = append(fields, f) } }
+	if len(fields) == 0 { return 0, nil }
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return 0, err }
+	pk, ok := column(sch, res.PrimaryKey)
+	if !ok { return 0, fmt.Errorf("no primary key column") }
+	var rotated int64
+	var last interface{}
+	for {
+		q := reg.resourceDB(ctx, res).Unscoped().Model(res.Model).Order(pk).Limit(rotateBatch)
+		if last != nil { q = q.Where(pk+" > ?", last) }
+		rows := reflect.New(res.Meta().SliceType)
+		if err := q.Find(rows.Interface()).Error; err != nil { return rotated, err }
+		items := rows.Elem()
+		if items.Len() == 0 { return rotated, nil }
+		for i := 0; i < items.Len(); i++ {
+			item := reflect.Indirect(items.Index(i))
+			last = recordKey(res, item)
+			updates := map[string]interface{}{}
+			for _, f := range fields {
+				fv := fieldValue(item, f.Name)
+				stored := ""
+				if fv.IsValid() { stored = storedText(fv.Interface()) }
+				if stored == "" || strings.HasPrefix(stored, encryptedPrefix+to.id+":") { continue }
+				plain := stored
+				if strings.HasPrefix(stored, encryptedPrefix) {
+					if plain, err = openWith(ring, stored); err != nil { return rotated, fmt.Errorf("%s of #%v: %w", f.Name, last, err) }
+				}
+				sealed, err := to.seal(plain)
+				if err != nil { return rotated, err }
+				col := sch.LookUpField(f.Name)
+				if col == nil || col.DBName == "" { return rotated, fmt.Errorf("no column for %s", f.Name) }
+				updates[col.DBName] = sealed
+			}
+			if len(updates) == 0 { continue }
+			if err := reg.resourceDB(ctx, res).Unscoped().Model(res.Model).Where(pk+" = ?", last).UpdateColumns(updates).Error; err != nil { return rotated, err }
+			rotated += int64(len(updates))
+		}
+	}
+}
@@ -39,18 +39,19 @@ func main() {
 	db, err := gorm.Open(sqlite.Open("admin.db"), &gorm.Config{})
 	if err != nil { log.Fatal("failed to connect database") }
 
-	db.AutoMigrate(&User{}, &Product{}, &ProductInfo{}, &admin.Permission{}, &Role{}, &admin.AdminUser{}, &admin.Session{}, &admin.AuditLog{})
+	db.AutoMigrate(&User{}, &Product{}, &ProductInfo{}, &Role{})
 
 	adm := admin.NewRegistry(db)
 	conf, _ := admin.LoadConfig("admin.yml")
 	if conf != nil { adm.SetConfig(conf) }
+	if err := adm.Migrate(); err != nil { log.Fatal(err) }
 
 	roles := []string{"admin", "editor", "viewer"}
 
 	addActivityAction := func(r *admin.Resource) {
 		r.AddMemberAction("activity", "View History", func(res *admin.Resource, w http.ResponseWriter, r *http.Request) {
 			id := r.URL.Query().Get("id")
-			http.Redirect(w, r, fmt.Sprintf("/admin/AuditLog?q_ResourceName=%s&q_RecordID=%s", res.Name, id), 303)
+			http.Redirect(w, r, adm.URL(fmt.Sprintf("/AuditLog?q_ResourceName=%s&q_RecordID=%s", res.Slug, id)), 303)
 		})
 	}
 
@@ -58,7 +59,7 @@ func main() {
 	adm.Register(admin.AdminUser{}).SetGroup("Administration").RegisterField("ID", "ID", true).RegisterField("Email", "Email", false).RegisterField("Role", "Role", false).SetFieldType("Role", "select", roles...)
 	adm.Register(admin.AuditLog{}).SetGroup("Administration").RegisterField("ID", "ID", true).RegisterField("CreatedAt", "Time", true).RegisterField("UserEmail", "User", true).RegisterField("ResourceName", "Resource", true).RegisterField("RecordID", "Record ID", true).RegisterField("Action", "Action", true).RegisterField("Changes", "Changes", true)
 	adm.Register(Role{}).SetGroup("Administration").RegisterField("ID", "ID", true).RegisterField("Name", "Role Name", false)
-	adm.Register(admin.Permission{}).SetGroup("Administration").RegisterField("ID", "ID", true).RegisterField("Role", "Role Name", false).RegisterField("ResourceName", "Resource", false).RegisterField("Action", "Action", false).SetFieldType("Role", "select", roles...).SetFieldType("ResourceName", "select", adm.ResourceNames()...).SetFieldType("Action", "select", "list", "show", "new", "edit", "save", "delete")
+	permRes := adm.Register(admin.Permission{}).SetGroup("Administration").RegisterField("ID", "ID", true).RegisterField("Role", "Role Name", false).RegisterField("ResourceName", "Resource", false).RegisterField("Action", "Action", false).SetFieldType("Role", "select", roles...)
 
 	// Users
 	uRes := adm.Register(User{}).
@@ -96,11 +97,11 @@ func main() {
 		HasMany("ProductInfo", "Technical Specifications", "ProductInfo", "ProductID").
 		AddCollectionAction("discount", "Apply 10% Bulk Discount", func(res *admin.Resource, w http.ResponseWriter, r *http.Request) {
 			db.Model(&Product{}).Where("price > ?", 0).Update("price", gorm.Expr("price * 0.9"))
-			http.Redirect(w, r, "/admin/Product", 303)
+			http.Redirect(w, r, adm.URL("/Product"), 303)
 		}).
 		AddBatchAction("batch_delete", "Delete Selected", func(res *admin.Resource, ids []string, w http.ResponseWriter, r *http.Request) {
 			db.Where("id IN ?", ids).Delete(&Product{})
-			http.Redirect(w, r, "/admin/Product", 303)
+			http.Redirect(w, r, adm.URL("/Product"), 303)
 		})
 	addActivityAction(pRes)
 
@@ -118,11 +119,13 @@ func main() {
 		adm.RenderCustomPage(w, r, "System Status", content)
 	})
 
+	// Permission choices cover every resource and custom action, so they are set once everything is registered.
+	permRes.SetFieldType("ResourceName", "select", adm.ResourceNames()...).SetFieldType("Action", "select", adm.PermissionActions()...)
+
 	// Seed Data
 	var adminCount int64; db.Model(&admin.AdminUser{}).Count(&adminCount)
 	if adminCount == 0 {
-		adminUser := &admin.AdminUser{Email: "admin@example.com", Role: "admin"}
-		adminUser.SetPassword("password123"); db.Create(adminUser)
+		if err := adm.EnsureAdminUser("admin@example.com", "password123", "admin"); err != nil { log.Fatal(err) }
 		db.Create(&Role{Name: "admin"}); db.Create(&Role{Name: "editor"}); db.Create(&Role{Name: "viewer"})
 		db.Create(&admin.Permission{Role: "editor", ResourceName: "Product", Action: "list"})
 		p1 := &Product{Name: "Mechanical Keyboard", Price: 150.00}; db.Create(p1)
@@ -130,7 +133,7 @@ func main() {
 		db.Create(&User{Email: "user@example.com", Role: "editor"})
 	}
 
-	fmt.Printf("\n🚀 Admin running at http://localhost:8080/admin\n")
-	http.Handle("/admin/", adm)
+	fmt.Printf("\n🚀 Admin running at http://localhost:8080%s\n", adm.URL("/"))
+	http.Handle(adm.Config.BasePath+"/", adm.Handler())
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
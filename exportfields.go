@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html"
+	"html/template"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// exportPath is an export column read through a BelongsTo association: the include loading the associated records
+// and the name of the target's field.
+type exportPath struct {
+	inc   *jsonInclude
+	field string
+}
+
+// exportFields resolves res's export columns for user: its ExportFields, or its index fields, less those user may
+// not see. A dot-path must name a BelongsTo association user may follow and a field of its target user may see;
+// its column is labelled by both, e.g. "Customer Email". Paths that don't resolve are left out.
+func (reg *Registry) exportFields(res *resource.Resource, user *models.AdminUser) ([]resource.Field, []*jsonInclude, map[string]exportPath) {
+	visible := make(map[string]bool)
+	for _, f := range res.VisibleFields(user) { visible[f.Name] = true }
+	var fields []resource.Field
+	var includes []*jsonInclude
+	paths := make(map[string]exportPath)
+	for _, f := range res.GetFieldsForUser("export", user) {
+		assoc, name, isPath := strings.Cut(f.Name, ".")
+		if !isPath { fields = append(fields, f); continue }
+		var inc *jsonInclude
+		for _, i := range includes { if i.name == assoc { inc = i } }
+		if inc == nil {
+			if inc = reg.belongsToInclude(res, assoc, user, visible); inc == nil { continue }
+			includes = append(includes, inc)
+		}
+		var target *resource.Field
+		for _, tf := range inc.target.VisibleFields(user) { if tf.Name == name { target = &tf; break } }
+		if target == nil { continue }
+		if !fieldListed(inc.fields, name) { inc.fields = append(inc.fields, *target) }
+		f.Label = inc.label + " " + target.Label
+		paths[f.Name] = exportPath{inc: inc, field: name}
+		fields = append(fields, f)
+	}
+	return fields, includes, paths
+}
+
+// fieldListed reports whether fields holds one named name.
+func fieldListed(fields []resource.Field, name string) bool {
+	for _, f := range fields { if f.Name == name { return true } }
+	return false
+}
+
+// pathCell is an export cell read through a BelongsTo association, empty when the record has none or it is out of
+// the user's scope.
+func pathCell(p exportPath, item reflect.Value) string {
+	v := reflect.Indirect(fieldValue(item, p.inc.local))
+	if !v.IsValid() || v.IsZero() { return "" }
+	obj := p.inc.objects[fmt.Sprint(v.Interface())]
+	if obj == nil || obj[p.field] == nil { return "" }
+	return fmt.Sprint(obj[p.field])
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// htmlText is a decorator's HTML as the plain text an export writes.
+func htmlText(h template.HTML) string { return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(string(h), ""))) }
@@ -0,0 +1,202 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	exportQueued    = "queued"
+	exportRunning   = "running"
+	exportDone      = "done"
+	exportFailed    = "failed"
+	exportCancelled = "cancelled"
+)
+
+// exportDispatcher runs background exports with a fixed pool of workers, started by the first queued export or
+// visit to the Exports page. Batch jobs use one too. model is the job table's model, and running holds the cancel
+// functions of the jobs this process is running.
+type exportDispatcher struct {
+	start   sync.Once
+	model   interface{}
+	queue   chan uint
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+}
+
+func newExportDispatcher(model interface{}) *exportDispatcher {
+	return &exportDispatcher{model: model, queue: make(chan uint, 1000), running: make(map[uint]context.CancelFunc)}
+}
+
+// startExports starts the export workers. Jobs left running by a previous process are marked failed and queued
+// ones are picked up again; jobs past Config.ExportRetention are cleaned up now and every hour.
+func (reg *Registry) startExports() {
+	reg.exports.start.Do(func() {
+		reg.DB.Model(&models.ExportJob{}).Where("status = ?", exportRunning).Updates(map[string]interface{}{"status": exportFailed, "error": "interrupted", "finished_at": time.Now()})
+		workers := reg.Config.ExportWorkers; if workers < 1 { workers = 1 }
+		for i := 0; i < workers; i++ { reg.goBackground(reg.exports.work(reg.runExportJob)) }
+		var queued []uint
+		reg.DB.Model(&models.ExportJob{}).Where("status = ?", exportQueued).Order("id").Pluck("id", &queued)
+		for _, id := range queued { reg.exports.enqueue(reg, id) }
+		reg.goBackground(func(ctx context.Context) {
+			for {
+				reg.cleanupExports()
+				select {
+				case <-ctx.Done(): return
+				case <-time.After(time.Hour):
+				}
+			}
+		})
+	})
+}
+
+// work returns a worker running queued jobs with run until shutdown; a job it has started is finished first.
+func (ed *exportDispatcher) work(run func(id uint)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done(): return
+			case id := <-ed.queue: run(id)
+			}
+		}
+	}
+}
+
+// enqueue hands a queued job to the workers. When the queue is full the job is marked failed, so the user sees it
+// refused instead of waiting on a job nothing will run.
+func (ed *exportDispatcher) enqueue(reg *Registry, id uint) {
+	select {
+	case ed.queue <- id:
+	default:
+		reg.Logger.Warn("job queue full, job marked failed", "job", id)
+		err := reg.DB.Model(ed.model).Where("id = ? AND status = ?", id, exportQueued).
+			Updates(map[string]interface{}{"status": exportFailed, "error": "queue full", "finished_at": time.Now()}).Error
+		if err != nil { reg.Logger.Error("job update failed", "job", id, "error", err) }
+	}
+}
+
+// queueExport records an export of total rows as a job for the worker pool and sends the user to the Exports page.
+func (reg *Registry) queueExport(w http.ResponseWriter, r *http.Request, res *resource.Resource, spec *exportSpec, user *models.AdminUser, total int64) {
+	job := models.ExportJob{UserID: user.ID, ResourceName: res.Slug, Query: spec.query, Status: exportQueued, Total: total}
+	if err := reg.dbFor(r).Create(&job).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	reg.startExports()
+	reg.exports.enqueue(reg, job.ID)
+	reg.setFlash(w, reg.T(r.Context(), "Your %s export is being prepared", reg.resName(r.Context(), res)))
+	http.Redirect(w, r, reg.URL("/exports"), 303)
+}
+
+// runExportJob writes a queued job's file as the user who asked for it, so their scope applies. Progress is saved
+// as it goes; a job cancelled meanwhile stops at the next progress update and its partial file is removed.
+func (reg *Registry) runExportJob(id uint) {
+	claim := reg.DB.Model(&models.ExportJob{}).Where("id = ? AND status = ?", id, exportQueued).Update("status", exportRunning)
+	if claim.Error != nil || claim.RowsAffected == 0 { return }
+	var job models.ExportJob
+	if err := reg.DB.First(&job, id).Error; err != nil { return }
+	ctx, cancel := context.WithCancel(context.Background())
+	reg.exports.mu.Lock(); reg.exports.running[id] = cancel; reg.exports.mu.Unlock()
+	defer func() { reg.exports.mu.Lock(); delete(reg.exports.running, id); reg.exports.mu.Unlock(); cancel() }()
+
+	file := fmt.Sprintf("%s-%d.csv", job.ResourceName, job.ID)
+	path := filepath.Join(reg.Config.ExportDir, file)
+	err := func() error {
+		var user models.AdminUser
+		if err := reg.DB.First(&user, job.UserID).Error; err != nil { return err }
+		ctx = withUser(ctx, &user)
+		res, ok := reg.GetResource(job.ResourceName)
+		if !ok { return fmt.Errorf("unknown resource %q", job.ResourceName) }
+		params, err := url.ParseQuery(job.Query)
+		if err != nil { return err }
+		spec, err := reg.prepareExport(ctx, res, params, &user)
+		if err != nil { return err }
+		if err := os.MkdirAll(reg.Config.ExportDir, 0o755); err != nil { return err }
+		f, err := os.Create(path)
+		if err != nil { return err }
+		defer f.Close()
+		if err := reg.writeExport(ctx, f, res, spec, func(n int64) {
+			if reg.DB.Model(&models.ExportJob{}).Where("id = ? AND status = ?", id, exportRunning).Update("rows", n).RowsAffected == 0 { cancel() }
+		}); err != nil { return err }
+		return f.Close()
+	}()
+	updates := map[string]interface{}{"status": exportDone, "file": file, "finished_at": time.Now()}
+	if err != nil {
+		if ctx.Err() == nil { reg.Logger.Error("export job failed", "job", id, "resource", job.ResourceName, "error", err) }
+		os.Remove(path)
+		updates = map[string]interface{}{"status": exportFailed, "error": err.Error(), "finished_at": time.Now()}
+		if ctx.Err() != nil { updates["status"], updates["error"] = exportCancelled, "" }
+	}
+	if reg.DB.Model(&models.ExportJob{}).Where("id = ? AND status = ?", id, exportRunning).Updates(updates).RowsAffected == 0 { os.Remove(path) }
+}
+
+// serveExportFile sends a finished job's file as a download.
+func serveExportFile(w http.ResponseWriter, r *http.Request, dir string, job models.ExportJob) {
+	if job.Status != exportDone { http.Error(w, "Not found", 404); return }
+	f, err := os.Open(filepath.Join(dir, job.File))
+	if err != nil { http.Error(w, "Not found", 404); return }
+	defer f.Close()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s_export.csv", job.ResourceName))
+	http.ServeContent(w, r, job.File, job.CreatedAt, f)
+}
+
+// cleanupExports deletes jobs older than Config.ExportRetention along with their files.
+func (reg *Registry) cleanupExports() {
+	if reg.Config.ExportRetention <= 0 { return }
+	var old []models.ExportJob
+	cutoff := time.Now().Add(-time.Duration(reg.Config.ExportRetention) * time.Hour)
+	reg.DB.Where("created_at < ? AND status NOT IN ?", cutoff, []string{exportQueued, exportRunning}).Find(&old)
+	for _, job := range old {
+		if job.File != "" { os.Remove(filepath.Join(reg.Config.ExportDir, job.File)) }
+		reg.DB.Delete(&job)
+	}
+}
+
+// handleExports serves the signed-in user's Exports page, /exports, along with /exports/cancel (POST) and
+// /exports/download, which both take a job id.
+func (reg *Registry) handleExports(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser) {
+	reg.startExports()
+	var job models.ExportJob
+	if upath != "/exports" {
+		id, _ := strconv.ParseUint(r.FormValue("id"), 10, 64)
+		if err := reg.dbFor(r).Where("id = ? AND user_id = ?", id, user.ID).First(&job).Error; err != nil { reg.renderRecordError(w, r, err); return }
+	}
+	switch upath {
+	case "/exports":
+	case "/exports/cancel":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		if reg.dbFor(r).Model(&job).Where("status IN ?", []string{exportQueued, exportRunning}).Updates(map[string]interface{}{"status": exportCancelled, "finished_at": time.Now()}).RowsAffected > 0 {
+			reg.exports.mu.Lock()
+			if cancel, ok := reg.exports.running[job.ID]; ok { cancel() }
+			reg.exports.mu.Unlock()
+			reg.setFlash(w, reg.T(r.Context(), "Export cancelled"))
+		}
+		http.Redirect(w, r, reg.URL("/exports"), 303)
+		return
+	case "/exports/download":
+		serveExportFile(w, r, reg.Config.ExportDir, job)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var jobs []models.ExportJob
+	if err := reg.dbFor(r).Where("user_id = ?", user.ID).Order("created_at desc, id desc").Find(&jobs).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/exports.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), ExportJobs: jobs,
+		Title: reg.T(r.Context(), "Exports"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Exports")}),
+	}
+	reg.execute(w, r, tmpl, "exports.html", pd)
+}
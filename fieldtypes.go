@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html/template"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var defaultCurrency = resource.CurrencyOptions{Symbol: "$", Decimals: 2}
+
+func currencyOptions(f resource.Field) resource.CurrencyOptions {
+	if f.Currency != nil { return *f.Currency }
+	return defaultCurrency
+}
+
+// parseTypedField handles form input for the "color", "duration", "currency" and "datetime" field types; ok is false
+// for other types, which are parsed by setFieldString. An empty value zeroes the field.
+func parseTypedField(f resource.Field, field reflect.Value, s string) (ok bool, err error) {
+	s = strings.TrimSpace(s)
+	switch f.Type {
+	case "color":
+		if s != "" && !colorPattern.MatchString(s) { return true, errors.New("Enter a color as #RRGGBB.") }
+		if field.Kind() != reflect.String { return true, fmt.Errorf("color fields need a string, not %s", field.Type()) }
+		field.SetString(strings.ToLower(s))
+	case "duration":
+		var d time.Duration
+		if s != "" { if d, err = time.ParseDuration(s); err != nil { return true, errors.New("Enter a duration like 1h30m.") } }
+		if !field.CanInt() { return true, fmt.Errorf("duration fields need a time.Duration or integer, not %s", field.Type()) }
+		field.SetInt(int64(d))
+	case "currency":
+		opts := currencyOptions(f)
+		n, err := parseAmount(s, opts)
+		if err != nil { return true, fmt.Errorf("Enter an amount like %s.", formatAmount(123456*pow10(opts.Decimals)/100, resource.CurrencyOptions{Decimals: opts.Decimals}, true)) }
+		if !field.CanInt() { return true, fmt.Errorf("currency fields need an integer, not %s", field.Type()) }
+		field.SetInt(n)
+	case "datetime":
+		var t time.Time
+		if s != "" { if t, err = parseTime(s); err != nil { return true, errors.New("Enter a date like 2006-01-02 or a date and time.") } }
+		switch {
+		case field.Type() == timeType:
+			field.Set(reflect.ValueOf(t))
+		case field.Type() == reflect.PointerTo(timeType):
+			if s == "" { field.Set(reflect.Zero(field.Type())) } else { field.Set(reflect.ValueOf(&t)) }
+		default:
+			return true, fmt.Errorf("datetime fields need a time.Time, not %s", field.Type())
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// formatTypedField renders a typed field for forms (input) and for list and show cells (display).
+func formatTypedField(f resource.Field, v interface{}) (input string, display template.HTML, ok bool) {
+	rv := reflect.ValueOf(v)
+	switch f.Type {
+	case "color":
+		s, _ := v.(string)
+		if !colorPattern.MatchString(s) { return s, template.HTML(template.HTMLEscapeString(s)), true }
+		return s, template.HTML(fmt.Sprintf(`<span class="color-swatch" style="background: %s;"></span>%s`, s, s)), true
+	case "duration":
+		if !rv.IsValid() || !rv.CanInt() { return "", "", false }
+		s := formatDuration(time.Duration(rv.Int()))
+		return s, template.HTML(s), true
+	case "currency":
+		if !rv.IsValid() || !rv.CanInt() { return "", "", false }
+		opts := currencyOptions(f)
+		return formatAmount(rv.Int(), opts, false), template.HTML(template.HTMLEscapeString(formatAmount(rv.Int(), opts, true))), true
+	case "datetime":
+		t, ok := timeValue(v)
+		if !ok { return "", "", false }
+		if t.IsZero() { return "", "", true }
+		return t.Format("2006-01-02T15:04"), template.HTML(t.Format("2006-01-02 15:04")), true
+	}
+	return "", "", false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeLayouts are the accepted "datetime" inputs: the browser's datetime-local value, a bare date and RFC 3339.
+var timeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02", "2006-01-02 15:04", time.RFC3339}
+
+// parseTime reads a date or date and time; values without a zone are in the server's local time.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil { return t, nil }
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// timeValue reads a time.Time or *time.Time; a nil pointer is the zero time.
+func timeValue(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t == nil { return time.Time{}, true }
+		return *t, true
+	}
+	return time.Time{}, false
+}
+
+// formatDuration is Duration.String without trailing zero units, e.g. "1h30m" rather than "1h30m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") { s = strings.TrimSuffix(s, "0s") }
+	if strings.HasSuffix(s, "h0m") { s = strings.TrimSuffix(s, "0m") }
+	return s
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ { p *= 10 }
+	return p
+}
+
+// formatAmount formats minor units as e.g. "1234.56", or "$1,234.56" with grouping and symbol.
+func formatAmount(n int64, opts resource.CurrencyOptions, pretty bool) string {
+	sign := ""
+	if n < 0 { sign, n = "-", -n }
+	whole, frac := strconv.FormatInt(n/pow10(opts.Decimals), 10), ""
+	if opts.Decimals > 0 { frac = fmt.Sprintf(".%0*d", opts.Decimals, n%pow10(opts.Decimals)) }
+	if !pretty { return sign + whole + frac }
+	for i := len(whole) - 3; i > 0; i -= 3 { whole = whole[:i] + "," + whole[i:] }
+	return sign + opts.Symbol + whole + frac
+}
+
+// parseAmount reads an amount typed as e.g. "1,234.56", "1.234,56" or "$ 1234" into minor units. The last "." or
+// "," is the decimal separator unless three digits follow it (and the currency has fewer decimals), in which case
+// it groups thousands like any other separator.
+func parseAmount(s string, opts resource.CurrencyOptions) (int64, error) {
+	if opts.Symbol != "" { s = strings.ReplaceAll(s, opts.Symbol, "") }
+	s = strings.NewReplacer(" ", "", "\u00a0", "").Replace(s)
+	if s == "" { return 0, nil }
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac := s, ""
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 && !(len(s)-i-1 == 3 && opts.Decimals < 3) {
+		whole, frac = s[:i], s[i+1:]
+		if len(frac) > opts.Decimals { return 0, fmt.Errorf("too many decimal places in %q", s) }
+	}
+	whole = strings.NewReplacer(",", "", ".", "").Replace(whole)
+	if whole == "" { whole = "0" }
+	for _, part := range []string{whole, frac} {
+		for _, c := range part { if c < '0' || c > '9' { return 0, fmt.Errorf("invalid amount %q", s) } }
+	}
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil { return 0, err }
+	f, _ := strconv.ParseInt(frac+strings.Repeat("0", opts.Decimals-len(frac)), 10, 64)
+	n := w*pow10(opts.Decimals) + f
+	if neg { n = -n }
+	return n, nil
+}
@@ -0,0 +1,215 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"html/template"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// listQuery is a resource query with scope and filters applied, shared by the list view and CSV export.
+type listQuery struct {
+	DB       *gorm.DB
+	Schema   *schema.Schema
+	PK       string
+	Joined   bool
+	Narrowed bool // a scope or filter was applied
+	Filters  map[string]string
+	Counts   map[string]string // correlated COUNT subqueries of the resource's "count" fields, by field name
+	hidden   map[string]bool   // fields the user may not see, which can be neither filtered nor sorted on
+}
+
+func (reg *Registry) parseSchema(model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: reg.DB}
+	if err := stmt.Parse(model); err != nil { return nil, err }
+	return stmt.Schema, nil
+}
+
+// fieldVisible reports whether user may see res's field name; names that are not fields, such as an unlisted key,
+// are visible.
+func fieldVisible(res *resource.Resource, name string, user *models.AdminUser) bool {
+	for _, f := range res.Fields { if f.Name == name { return f.VisibleFor(user) } }
+	return true
+}
+
+// column resolves a struct field name to its qualified column, rejecting anything that is not part of the model.
+func column(sch *schema.Schema, name string) (string, bool) {
+	f := sch.LookUpField(name)
+	if f == nil || f.DBName == "" { return "", false }
+	return sch.Table + "." + f.DBName, true
+}
+
+func (reg *Registry) buildListQuery(ctx context.Context, res *resource.Resource, params url.Values) (*listQuery, error) {
+	return reg.buildListQueryOn(reg.resourceReader(ctx, res), res, params)
+}
+
+// buildListQueryOn builds the list query on db, for callers that must read from the primary DB.
+func (reg *Registry) buildListQueryOn(db *gorm.DB, res *resource.Resource, params url.Values) (*listQuery, error) {
+	ctx := db.Statement.Context
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return nil, err }
+	lq := &listQuery{DB: reg.scope(ctx, res, db.Model(res.Model)), Schema: sch, PK: sch.Table + ".id", Filters: make(map[string]string), Narrowed: reg.scoped(ctx)}
+	if col, ok := column(sch, res.PrimaryKey); ok { lq.PK = col }
+	user := CurrentUser(ctx)
+	for _, f := range res.Fields {
+		if !f.VisibleFor(user) {
+			if lq.hidden == nil { lq.hidden = make(map[string]bool) }
+			lq.hidden[f.Name] = true
+		}
+		if f.CountOf == "" { continue }
+		sub, err := reg.countSubquery(res, sch, f)
+		if err != nil { return nil, err }
+		if lq.Counts == nil { lq.Counts = make(map[string]string) }
+		lq.Counts[f.Name] = sub
+	}
+	if s, ok := res.FindScope(res.ActiveScope(params.Get("scope"))); ok { lq.DB = s.Handler(lq.DB); lq.Narrowed = true }
+	joins := make(map[string]bool)
+	for k, v := range params {
+		val := v[0]; if val == "" { continue }
+		if i := strings.Index(k, "_"); i > 0 && lq.isHidden(k[i+1:]) { continue }
+		lq.Filters[k] = val
+		if strings.HasPrefix(k, "q_") {
+			if col, ok := column(sch, strings.TrimPrefix(k, "q_")); ok { lq.DB = lq.DB.Where(fmt.Sprintf("%s LIKE ?", col), "%"+val+"%"); lq.Narrowed = true }
+		} else if strings.HasPrefix(k, "eq_") {
+			if col, ok := column(sch, strings.TrimPrefix(k, "eq_")); ok { lq.DB = lq.DB.Where(fmt.Sprintf("%s = ?", col), val); lq.Narrowed = true }
+		} else if strings.HasPrefix(k, "tag_") {
+			if col, ok := column(sch, strings.TrimPrefix(k, "tag_")); ok { lq.DB = lq.DB.Where(fmt.Sprintf("%s LIKE ?", col), tagPattern(val)); lq.Narrowed = true }
+		} else if strings.HasPrefix(k, "min_") {
+			if col, ok := column(sch, strings.TrimPrefix(k, "min_")); ok { lq.DB = lq.DB.Where(fmt.Sprintf("%s >= ?", col), val); lq.Narrowed = true }
+		} else if strings.HasPrefix(k, "max_") {
+			if col, ok := column(sch, strings.TrimPrefix(k, "max_")); ok { lq.DB = lq.DB.Where(fmt.Sprintf("%s <= ?", col), val); lq.Narrowed = true }
+		}
+	}
+	for _, af := range res.AssociationFilters {
+		val := params.Get(af.Param()); if val == "" { continue }
+		assoc, ok := res.GetAssociation(af.Association)
+		if !ok { return nil, fmt.Errorf("association filter %q: unknown association %q", af.Label, af.Association) }
+		target, ok := reg.GetResource(assoc.ResourceName)
+		if !ok { return nil, fmt.Errorf("association %q: unknown resource %q", assoc.Name, assoc.ResourceName) }
+		targetSch, err := reg.parseSchema(target.Model)
+		if err != nil { return nil, err }
+		col, ok := column(targetSch, af.Field)
+		if !ok { return nil, fmt.Errorf("association filter %q: %s has no field %q", af.Label, target.Name, af.Field) }
+		if !fieldVisible(target, af.Field, user) { continue }
+		if !joins[assoc.Name] {
+			on, err := joinCondition(sch, targetSch, assoc, res.PrimaryKey, target.PrimaryKey)
+			if err != nil { return nil, err }
+			lq.DB = lq.DB.Joins(fmt.Sprintf("JOIN %s ON %s", targetSch.Table, on))
+			joins[assoc.Name], lq.Joined = true, true
+		}
+		lq.DB = lq.DB.Where(fmt.Sprintf("%s = ?", col), val); lq.Narrowed = true
+	}
+	return lq, nil
+}
+
+// joinCondition builds the ON clause linking a resource table to an associated one.
+// BelongsTo associations are named after the local key (e.g. "CustomerID", or "Customer" with an implied ID suffix)
+// and ForeignKey names the referenced key on the target, its primary key by default; HasMany ForeignKey names the
+// column on the target that refers to this resource's primary key. key and targetKey are the two primary key fields.
+func joinCondition(sch, target *schema.Schema, assoc resource.Association, key, targetKey string) (string, error) {
+	if assoc.Type == "HasMany" {
+		fk, ok := column(target, assoc.ForeignKey)
+		pk, pok := column(sch, key)
+		if !ok || !pok { return "", fmt.Errorf("association %q: cannot resolve foreign key %q", assoc.Name, assoc.ForeignKey) }
+		return fmt.Sprintf("%s = %s", fk, pk), nil
+	}
+	local, ok := column(sch, assoc.Name)
+	if !ok { local, ok = column(sch, assoc.Name+"ID") }
+	ref := assoc.ForeignKey; if ref == "" { ref = targetKey }
+	remote, rok := column(target, ref)
+	if !ok || !rok { return "", fmt.Errorf("association %q: cannot resolve join keys", assoc.Name) }
+	return fmt.Sprintf("%s = %s", remote, local), nil
+}
+
+// isHidden reports whether name, a field or column name, refers to a field the user may not see.
+func (lq *listQuery) isHidden(name string) bool {
+	if lq.hidden[name] { return true }
+	f := lq.Schema.LookUpField(name)
+	return f != nil && lq.hidden[f.Name]
+}
+
+// Sort orders by the given field or count field, falling back to newest first when the field is neither.
+func (lq *listQuery) Sort(field, order string) {
+	if lq.isHidden(field) { field = "" }
+	col, ok := lq.Counts[field]
+	if !ok { col, ok = column(lq.Schema, field) }
+	if !ok { lq.DB = lq.DB.Order(lq.PK + " desc"); return }
+	if order != "desc" { order = "asc" }
+	lq.DB = lq.DB.Order(fmt.Sprintf("%s %s", col, order))
+}
+
+// CountQuery is the query to COUNT matching rows, counting each primary key once when joins may duplicate rows.
+// It is nil when nothing narrows the table, so CountFor may use a cached or estimated total.
+func (lq *listQuery) CountQuery() *gorm.DB {
+	if !lq.Narrowed { return nil }
+	q := lq.DB.Session(&gorm.Session{})
+	if lq.Joined { q = q.Distinct(lq.PK) }
+	return q
+}
+
+func (lq *listQuery) Count() int64 {
+	var n int64
+	q := lq.DB.Session(&gorm.Session{})
+	if lq.Joined { q = q.Distinct(lq.PK) }
+	q.Count(&n)
+	return n
+}
+
+// Find loads matching rows into dest, selecting only the resource's own columns once per row.
+func (lq *listQuery) Find(dest interface{}) error {
+	q := lq.DB.Session(&gorm.Session{})
+	if lq.Joined { q = q.Distinct(lq.Schema.Table + ".*") }
+	return q.Find(dest).Error
+}
+
+// FindInBatches walks matching rows in primary key order, calling fn after each batch is loaded into dest.
+// An error from fn, including a cancelled context, stops the walk.
+func (lq *listQuery) FindInBatches(dest interface{}, size int, fn func() error) error {
+	q := lq.DB.Session(&gorm.Session{})
+	if lq.Joined { q = q.Distinct(lq.Schema.Table + ".*") }
+	return q.FindInBatches(dest, size, func(tx *gorm.DB, batch int) error { return fn() }).Error
+}
+
+// Keyset loads one page of rows ordered by primary key descending, either after or before a cursor value,
+// without an OFFSET scan. It returns the rows in display order and whether more rows exist on each side.
+func (lq *listQuery) Keyset(model interface{}, after, before string, limit int) (rows reflect.Value, hasPrev, hasNext bool) {
+	q := lq.DB.Session(&gorm.Session{})
+	if before != "" { q = q.Where(lq.PK+" > ?", before).Order(lq.PK + " asc") } else {
+		if after != "" { q = q.Where(lq.PK+" < ?", after) }
+		q = q.Order(lq.PK + " desc")
+	}
+	dest := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+	if lq.Joined { q = q.Distinct(lq.Schema.Table + ".*") }
+	q.Limit(limit + 1).Find(dest.Interface())
+	rows = dest.Elem()
+	more := rows.Len() > limit
+	if more { rows = rows.Slice(0, limit) }
+	if before != "" {
+		reversed := reflect.MakeSlice(rows.Type(), rows.Len(), rows.Len())
+		for i := 0; i < rows.Len(); i++ { reversed.Index(rows.Len() - 1 - i).Set(rows.Index(i)) }
+		return reversed, more, true
+	}
+	return rows, after != "", more
+}
+
+// cursor returns the primary key of a row as it appears in pagination URLs.
+func (lq *listQuery) cursor(row reflect.Value) string {
+	if lq.Schema.PrioritizedPrimaryField == nil { return "" }
+	fv := fieldValue(row, lq.Schema.PrioritizedPrimaryField.Name)
+	if !fv.IsValid() { return "" }
+	return fmt.Sprintf("%v", fv.Interface())
+}
+
+// cursorURL rewrites the current query string to point at the page on the other side of a cursor.
+func cursorURL(params url.Values, key, value string) template.URL {
+	q := url.Values{}
+	for k, v := range params { if k != "page" && k != "after" && k != "before" { q[k] = v } }
+	q.Set(key, value)
+	return template.URL("?" + q.Encode())
+}
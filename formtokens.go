@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"errors"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"time"
+)
+
+// formTokenField is the hidden form field carrying a form's one-time token.
+const formTokenField = "_form_token"
+
+// issueFormToken stores a new one-time token for a form rendered to r's session and returns it, or "" when
+// Config.FormTokens is off. Only the token's hash is stored.
+func (reg *Registry) issueFormToken(r *http.Request) (string, error) {
+	if !reg.Config.FormTokens { return "", nil }
+	token, err := newToken()
+	if err != nil { return "", err }
+	ttl := time.Duration(reg.Config.FormTokenTTL) * time.Minute
+	if ttl <= 0 { ttl = 2 * time.Hour }
+	err = reg.formTokens().IssueFormToken(r.Context(), &models.FormToken{ID: hashToken(token), SessionID: reg.sessionID(r), ExpiresAt: time.Now().Add(ttl)})
+	return token, err
+}
+
+// consumeFormToken uses up the token a save was submitted with. ok is false once the response is handled: a
+// replayed submission is redirected to the record it saved, and a missing or expired token re-renders the form.
+func (reg *Registry) consumeFormToken(res *resource.Resource, model interface{}, w http.ResponseWriter, r *http.Request, user *models.AdminUser) (id string, ok bool) {
+	if !reg.Config.FormTokens { return "", true }
+	token := r.FormValue(formTokenField)
+	var recordID string
+	err := ErrFormTokenNotFound
+	if token != "" { recordID, err = reg.formTokens().ConsumeFormToken(r.Context(), reg.sessionID(r), hashToken(token)) }
+	switch {
+	case err == nil:
+		return hashToken(token), true
+	case errors.Is(err, ErrFormTokenUsed):
+		reg.setFlash(w, reg.T(r.Context(), "This form was already submitted"))
+		back := reg.URL("/" + res.Slug)
+		if recordID != "" { back = reg.recordURL(res, recordID) }
+		http.Redirect(w, r, back, 303)
+	case errors.Is(err, ErrFormTokenNotFound):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		reg.renderForm(res, model, w, r, user, reg.T(r.Context(), "This form has expired. Please check it and save again."), nil)
+	default:
+		reg.renderError(w, r, 500, err)
+	}
+	return "", false
+}
@@ -1,52 +1,67 @@
 package admin
 
 import (
-	"github.com/google/uuid"
 	"github.com/ajeet-kumar1087/go-admin/models"
-	"html/template"
 	"net/http"
 	"time"
 )
 
 func (reg *Registry) IsAllowed(role, resource, action string) bool {
 	if role == "admin" { return true }
+	if resource == usersSlug { return false }
 	var count int64
 	reg.DB.Model(&models.Permission{}).Where("role = ? AND resource_name = ? AND action = ?", role, resource, action).Count(&count)
 	return count > 0
 }
 
 func (reg *Registry) GetUserFromRequest(r *http.Request) (*models.AdminUser, string) {
-	cookie, err := r.Cookie("admin_session")
+	id := reg.sessionID(r)
+	if id == "" { return nil, "guest" }
+	sess, err := reg.sessions().Get(r.Context(), id)
 	if err != nil { return nil, "guest" }
-	var sess models.Session
-	if err := reg.DB.Where("id = ? AND expires_at > ?", cookie.Value, time.Now()).First(&sess).Error; err != nil { return nil, "guest" }
 	var user models.AdminUser
-	if err := reg.DB.First(&user, sess.UserID).Error; err != nil { return nil, "guest" }
+	if err := reg.dbFor(r).First(&user, sess.UserID).Error; err != nil || !user.Active || user.Role != sess.Role { return nil, "guest" }
+	if sess.ImpersonatorID != 0 {
+		var imp models.AdminUser
+		if err := reg.dbFor(r).First(&imp, sess.ImpersonatorID).Error; err != nil || !imp.Active || imp.Role != "admin" { return nil, "guest" }
+		user.Impersonator = &imp
+	}
+	reg.touchSession(r, sess)
 	return &user, user.Role
 }
 
 func (reg *Registry) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if reg.Config.DisablePasswordLogin { reg.renderLogin(w, r, reg.T(r.Context(), "Password sign-in is disabled; sign in with SSO")); return }
 	email, password := r.FormValue("email"), r.FormValue("password")
 	var user models.AdminUser
-	if err := reg.DB.Where("email = ?", email).First(&user).Error; err != nil { reg.renderLogin(w, r, "Invalid credentials"); return }
-	if !user.CheckPassword(password) { reg.renderLogin(w, r, "Invalid credentials"); return }
-	sessionID := uuid.New().String()
-	reg.DB.Create(&models.Session{ID: sessionID, UserID: user.ID, ExpiresAt: time.Now().Add(time.Duration(reg.Config.SessionTTL) * time.Hour)})
-	http.SetCookie(w, &http.Cookie{Name: "admin_session", Value: sessionID, Path: "/admin", HttpOnly: true})
-	reg.setFlash(w, "Login successful! Welcome back.")
-	http.Redirect(w, r, "/admin", 303)
+	m := reg.metrics()
+	if err := reg.dbFor(r).Where("email = ?", email).First(&user).Error; err != nil || !user.Active || !user.CheckPassword(password) {
+		if m != nil { m.ObserveLogin(false) }
+		reg.log(r.Context()).Warn("login failed", "email", email, "ip", reg.clientIP(r))
+		reg.recordLogin(r, user.ID, email, false)
+		reg.renderLogin(w, r, reg.T(r.Context(), "Invalid credentials")); return
+	}
+	if m != nil { m.ObserveLogin(true) }
+	reg.log(r.Context()).Info("login succeeded", "email", email, "ip", reg.clientIP(r))
+	reg.recordLogin(r, user.ID, email, true)
+	if upgraded, err := user.UpgradeHash(password, reg.Config.BcryptCost); err == nil && upgraded { reg.dbFor(r).Model(&user).Update("password_hash", user.PasswordHash) }
+	reg.dbFor(r).Model(&user).Update("last_login_at", time.Now())
+	if err := reg.startSession(w, r, &user, 0); err != nil { reg.renderError(w, r, 500, err); return }
+	ctx := r.Context()
+	if user.Locale != "" { ctx = withLocale(ctx, user.Locale) }
+	reg.setFlash(w, reg.T(ctx, "Login successful! Welcome back."))
+	http.Redirect(w, r, reg.URL("/"), 303)
 }
 
 func (reg *Registry) handleLogout(w http.ResponseWriter, r *http.Request) {
-	cookie, _ := r.Cookie("admin_session")
-	if cookie != nil { reg.DB.Delete(&models.Session{}, "id = ?", cookie.Value) }
-	http.SetCookie(w, &http.Cookie{Name: "admin_session", Value: "", Path: "/admin", Expires: time.Unix(0, 0), HttpOnly: true})
-	http.Redirect(w, r, "/admin/login", 303)
+	if id := reg.sessionID(r); id != "" { reg.sessions().Delete(r.Context(), id) }
+	http.SetCookie(w, reg.sessionCookie(r, "", -1))
+	http.Redirect(w, r, reg.URL("/login"), 303)
 }
 
 func (reg *Registry) renderLogin(w http.ResponseWriter, r *http.Request, errorMsg string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl := template.Must(template.ParseFS(templateFS, "templates/login.html"))
-	styleContent, _ := templateFS.ReadFile("templates/style.css")
-	tmpl.Execute(w, PageData{SiteTitle: reg.Config.SiteTitle, Error: errorMsg, CSS: template.CSS(styleContent)})
+	tmpl, err := reg.parseTemplates("login.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.execute(w, r, tmpl, "login.html", PageData{SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), Error: errorMsg, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), PasswordReset: reg.passwordResetEnabled(), SSO: reg.oidcEnabled(), NoPasswordLogin: reg.Config.DisablePasswordLogin})
 }
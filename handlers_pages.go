@@ -9,37 +9,43 @@ import (
 
 func (reg *Registry) renderDashboard(w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	var stats []Stat
-	for name, res := range reg.Resources {
-		var count int64
-		reg.DB.Model(res.Model).Count(&count)
-		stats = append(stats, Stat{Label: name, Value: count})
-	}
+	stats := reg.dashboardStats(r, user)
 	var widgets []ChartWidget
-	for i, c := range reg.Charts {
-		l, v := c.Data(reg.DB)
-		widgets = append(widgets, ChartWidget{ID: fmt.Sprintf("chart-%d", i), Label: c.Label, Type: c.Type, Labels: l, Values: v})
+	for i, c := range reg.charts() {
+		if !visibleToRoles(c.VisibleTo, user) { continue }
+		cw := ChartWidget{ID: fmt.Sprintf("chart-%d", i), Label: c.Label, Type: c.Type, Stacked: c.Stacked, DataURL: reg.URL(fmt.Sprintf("/charts/%d/data", i))}
+		if c.ranged() { cw.Ranges = ChartRanges }
+		cw.CanRefresh = c.CacheTTL > 0 && user.Role == "admin"
+		result, asOf, err := reg.chartData(r, c, "", "", user, false)
+		if err != nil { reg.log(r.Context()).Error("chart failed", "chart", c.Label, "error", err); cw.Error = "Chart data unavailable" }
+		cw.Labels, cw.Series, cw.AsOf = result.Labels, result.Series, formatAsOf(asOf)
+		widgets = append(widgets, cw)
 	}
-	styleContent, _ := templateFS.ReadFile("templates/style.css")
-	tmpl := reg.loadTemplates("templates/dashboard.html")
+	tmpl, err := reg.loadTemplates("templates/dashboard.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
 	pd := PageData{
-		SiteTitle: reg.Config.SiteTitle, GroupedResources: reg.getGroupedResources(), GroupedPages: reg.getGroupedPages(), 
-		User: user, Stats: stats, CSS: template.CSS(styleContent), ChartData: widgets,
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user), 
+		User: user, Stats: stats, CSS: reg.styleCSS(), ChartData: widgets, Widgets: reg.renderWidgets(user),
+		Title: reg.T(r.Context(), "Dashboard"), Breadcrumbs: []Crumb{{Label: reg.T(r.Context(), "Dashboard")}},
 		Flash: reg.getFlash(w, r),
 	}
-	tmpl.ExecuteTemplate(w, "dashboard.html", pd)
+	reg.execute(w, r, tmpl, "dashboard.html", pd)
 }
 
-func (reg *Registry) RenderCustomPage(w http.ResponseWriter, r *http.Request, title string, content template.HTML) {
-	user, _ := reg.GetUserFromRequest(r)
-	styleContent, _ := templateFS.ReadFile("templates/style.css")
-	tmpl := template.Must(template.ParseFS(templateFS, "templates/layout.html"))
-	tmpl = template.Must(tmpl.New("title").Parse(title))
-	tmpl = template.Must(tmpl.New("content").Parse(`<div style="padding: 2rem;">` + string(content) + `</div>`))
+// RenderCustomPage renders content within the admin layout under title. crumbs, when given, replace the default
+// "Dashboard / title" trail after the dashboard crumb; leave the URL of the last one, the page itself, empty.
+func (reg *Registry) RenderCustomPage(w http.ResponseWriter, r *http.Request, title string, content template.HTML, crumbs ...Crumb) {
+	user := CurrentUser(r.Context())
+	if user == nil { user, _ = reg.GetUserFromRequest(r) }
+	tmpl, err := reg.parseTemplates("layout.html")
+	if err == nil { _, err = tmpl.New("title").Parse(title) }
+	if err == nil { _, err = tmpl.New("content").Parse(`<div style="padding: 2rem;">` + string(content) + `</div>`) }
+	if err != nil { reg.renderError(w, r, 500, err); return }
 	pd := PageData{
-		SiteTitle: reg.Config.SiteTitle, GroupedResources: reg.getGroupedResources(), GroupedPages: reg.getGroupedPages(),
-		User: user, CSS: template.CSS(styleContent),
-		Flash: reg.getFlash(w, r),
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(),
+		Flash: reg.getFlash(w, r), Title: title, Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: title}),
 	}
-	tmpl.ExecuteTemplate(w, "layout", pd)
+	if len(crumbs) > 0 { pd.Breadcrumbs = reg.breadcrumbs(r.Context(), crumbs...) }
+	reg.execute(w, r, tmpl, "layout", pd)
 }
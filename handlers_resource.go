@@ -1,17 +1,19 @@
 package admin
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ajeet-kumar1087/go-admin/models"
 	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
 	"html/template"
 	"io"
 	"math"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -19,161 +21,615 @@ import (
 )
 
 func (reg *Registry) renderList(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.URL.RawQuery == "" {
+		if p := reg.defaultPreset(r.Context(), res, user); p != nil && p.Query != "" { http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+p.Query), 303); return }
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fields := res.GetFieldsFor("index")
+	fields := reg.indexFields(r.Context(), res, user)
 	page, _ := strconv.Atoi(r.URL.Query().Get("page")); if page < 1 { page = 1 }
-	perPage := reg.Config.DefaultPerPage
-	currentScope := r.URL.Query().Get("scope")
-	query := reg.DB.Model(res.Model)
-	if currentScope != "" {
-		for _, s := range res.Scopes { if s.Name == currentScope { query = s.Handler(query); break } }
-	}
+	perPage := reg.perPage(res, user, r)
+	currentScope := res.ActiveScope(r.URL.Query().Get("scope"))
+	lq, err := reg.buildListQuery(r.Context(), res, r.URL.Query())
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	footer, err := reg.footerTotals(res, fields, lq)
+	if err != nil { reg.renderError(w, r, 500, err); return }
 	sortField, sortOrder := r.URL.Query().Get("sort"), r.URL.Query().Get("order")
-	if sortField != "" { if sortOrder != "desc" { sortOrder = "asc" }; query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder)) } else { query = query.Order("id desc") }
-	filters := make(map[string]string)
-	for k, v := range r.URL.Query() {
-		val := v[0]; if val == "" { continue }; filters[k] = val
-		if strings.HasPrefix(k, "q_") { query = query.Where(fmt.Sprintf("%s LIKE ?", strings.TrimPrefix(k, "q_")), "%"+val+"%") } else if strings.HasPrefix(k, "min_") { query = query.Where(fmt.Sprintf("%s >= ?", strings.TrimPrefix(k, "min_")), val) } else if strings.HasPrefix(k, "max_") { query = query.Where(fmt.Sprintf("%s <= ?", strings.TrimPrefix(k, "max_")), val) }
-	}
-	var totalCount int64; query.Count(&totalCount)
-	totalPages := int(math.Ceil(float64(totalCount) / float64(perPage)))
-	modelType := reflect.TypeOf(res.Model)
-	destSlice := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0); dest := reflect.New(destSlice.Type())
-	query.Offset((page - 1) * perPage).Limit(perPage).Find(dest.Interface())
-	data := reg.sliceToMap(res, fields, dest.Elem())
-	styleContent, _ := templateFS.ReadFile("templates/style.css")
-	tmpl := reg.loadTemplates("templates/index.html")
+	var data []map[string]interface{}
+	var rows reflect.Value
+	var totalCount int64
+	totalPages, hasPrev, hasNext := 0, page > 1, false
+	var prevURL, nextURL template.URL
+	var board []BoardColumn
+	var boardFields []resource.Field
+	view, views := listViews(res, r.URL.Query())
+	if view == "board" {
+		if sortField == "" && res.PositionField != "" { sortField, sortOrder = res.PositionField, "asc" }
+		if board, boardFields, err = reg.boardColumns(res, lq, sortField, sortOrder, user); err != nil { reg.renderError(w, r, 500, err); return }
+		for _, c := range board { totalCount += c.Count }
+	} else if view == "calendar" || view == "tree" {
+		// The calendar and tree load their records from /<resource>/calendar and /<resource>/children as needed.
+	} else if res.CursorPagination {
+		// Keyset mode: always newest first by primary key, no COUNT and no OFFSET.
+		sortField, sortOrder = "", ""
+		start := time.Now()
+		var prev, next bool
+		rows, prev, next = lq.Keyset(res.Model, r.URL.Query().Get("after"), r.URL.Query().Get("before"), perPage)
+		reg.observeQuery("list", start)
+		hasPrev, hasNext = prev && rows.Len() > 0, next && rows.Len() > 0
+		if rows.Len() > 0 {
+			prevURL = cursorURL(r.URL.Query(), "before", lq.cursor(rows.Index(0)))
+			nextURL = cursorURL(r.URL.Query(), "after", lq.cursor(rows.Index(rows.Len()-1)))
+		}
+		data = reg.sliceToMap(res, fields, rows, user)
+	} else {
+		if sortField == "" && res.PositionField != "" { sortField = res.PositionField }
+		if sortField != "" && sortOrder != "desc" { sortOrder = "asc" }
+		lq.Sort(sortField, sortOrder)
+		start := time.Now()
+		totalCount = reg.CountFor(r.Context(), res, lq.CountQuery())
+		reg.observeQuery("count", start)
+		totalPages = int(math.Ceil(float64(totalCount) / float64(perPage)))
+		hasNext = page < totalPages
+		dest := reflect.New(res.Meta().SliceType)
+		start = time.Now()
+		lq.DB = lq.DB.Offset((page - 1) * perPage).Limit(perPage); lq.Find(dest.Interface())
+		reg.observeQuery("list", start)
+		rows = dest.Elem()
+		data = reg.sliceToMap(res, fields, rows, user)
+	}
+	if rows.IsValid() {
+		counts, err := reg.relatedCounts(reg.resourceReader(r.Context(), res), res, fields, rows)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		reg.setCounts(res, fields, data, counts)
+	}
+	if res.AssignField != "" {
+		if err := reg.setAssignees(reg.readFor(r), res, fields, data); err != nil { reg.renderError(w, r, 500, err); return }
+	}
+	if len(res.MemberActions) > 0 {
+		permitted := reg.permittedActions(res, res.MemberActions, user)
+		for i := range data { data[i]["__actions"] = visibleActions(permitted, user, rawValues(res, rows.Index(i))) }
+	}
+	var inline map[string]resource.Field
+	if !res.ReadOnly && rows.IsValid() && reg.IsAllowed(user.Role, res.Slug, "edit") {
+		if inline = inlineFields(res, user); len(inline) > 0 { setInlineCells(data, rows, inline) } else { inline = nil }
+	}
+	var assignees []models.AdminUser
+	if res.AssignField != "" && offersAssignees(res, user, inline) {
+		var err error
+		if assignees, err = reg.assignableUsers(reg.readFor(r), res); err != nil { reg.renderError(w, r, 500, err); return }
+	}
+	tmpl, err := reg.loadTemplates("templates/index.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
 	pd := PageData{
-		SiteTitle: reg.Config.SiteTitle, Resources: reg.Resources, GroupedResources: reg.getGroupedResources(), GroupedPages: reg.getGroupedPages(), 
-		CurrentResource: res, Fields: fields, Data: data, Filters: filters, User: user, CSS: template.CSS(styleContent),
-		Page: page, PerPage: perPage, TotalPages: totalPages, TotalCount: totalCount, HasPrev: page > 1, HasNext: page < totalPages, PrevPage: page - 1, NextPage: page + 1, Scopes: res.Scopes, CurrentScope: currentScope,
-		Flash: reg.getFlash(w, r), SortField: sortField, SortOrder: sortOrder,
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), Resources: reg.resourceMap(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user), 
+		CurrentResource: res, Fields: fields, Data: data, Filters: lq.Filters, User: user, CSS: reg.styleCSS(),
+		Page: page, PerPage: perPage, TotalPages: totalPages, TotalCount: totalCount, HasPrev: hasPrev, HasNext: hasNext, PrevPage: page - 1, NextPage: page + 1, Scopes: reg.listScopes(r.Context(), res, r.URL.Query()), CurrentScope: currentScope,
+		Flash: reg.getFlash(w, r), SortField: sortField, SortOrder: sortOrder, Query: template.URL(r.URL.RawQuery),
+		Presets: reg.presetsFor(r.Context(), res, user), Columns: reg.columnChoices(res, fields, user), FilterFields: res.VisibleFields(user), PrevURL: prevURL, NextURL: nextURL,
+		CollectionActions: reg.collectionActions(res, user), BatchActions: reg.batchActions(res, user),
+		CanEdit: !res.ReadOnly && reg.IsAllowed(user.Role, res.Slug, "edit"), CanDelete: !res.ReadOnly && reg.IsAllowed(user.Role, res.Slug, "delete"),
+		CanExport: reg.canExport(res, user.Role), CanPurgeTrash: res.TrashRetentionDays > 0 && user.Role == "admin", Footer: footer, CanCreate: !res.ReadOnly && reg.IsAllowed(user.Role, res.Slug, "new"),
+		Filtered: listFiltered(lq.Filters, currentScope), ClearFiltersURL: clearFiltersURL(res, view),
+		Title: reg.resName(r.Context(), res), Breadcrumbs: reg.listCrumbs(r.Context(), res, r.URL.Query()),
+		View: view, Views: views, Board: board, BoardFields: boardFields, Assignees: assignees, InlineFields: inline,
+		Reorderable: res.PositionField != "" && !res.ReadOnly && sortField == res.PositionField && sortOrder == "asc" && reg.IsAllowed(user.Role, res.Slug, "edit"),
 	}
-	tmpl.ExecuteTemplate(w, "index.html", pd)
+	reg.execute(w, r, tmpl, "index.html", pd)
 }
 
 func (reg *Registry) renderShow(res *resource.Resource, item interface{}, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fields := res.GetFieldsFor("show")
+	fields := res.GetFieldsForUser("show", user)
 	var itemMap map[string]interface{}
-	assocData := make(map[string]AssociationData); renderedSidebars := make(map[string]template.HTML)
+	var memberActions []resource.Action
+	var comments []CommentEntry
+	var treePath []TreeNode
+	var assignees []models.AdminUser
+	var metadata *RecordMetadata
+	assocData := make(map[string]*AssociationData); renderedSidebars := make(map[string]template.HTML)
 	if item != nil {
-		itemMap = reg.itemToMap(res, fields, reflect.ValueOf(item))
+		fields = withoutHidden(fields, res.HiddenByCondition(recordText(reflect.ValueOf(item))))
+		itemMap = reg.itemToMap(res, fields, reflect.ValueOf(item), user)
+		one := reflect.Append(reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(item)), 0, 1), reflect.ValueOf(item))
+		counts, err := reg.relatedCounts(reg.resourceReader(r.Context(), res), res, fields, one)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		reg.setCounts(res, fields, []map[string]interface{}{itemMap}, counts)
+		if res.AssignField != "" {
+			if err := reg.setAssignees(reg.readFor(r), res, fields, []map[string]interface{}{itemMap}); err != nil { reg.renderError(w, r, 500, err); return }
+		}
+		if res.AssignField != "" && !res.ReadOnly {
+			if assignees, err = reg.assignableUsers(reg.readFor(r), res); err != nil { reg.renderError(w, r, 500, err); return }
+		}
+		if metadata, err = reg.recordMetadata(reg.readFor(r), res, reflect.ValueOf(item), user); err != nil { reg.renderError(w, r, 500, err); return }
+		memberActions = reg.memberActions(res, user, rawValues(res, reflect.ValueOf(item)))
 		for _, assoc := range res.Associations {
-			if assoc.Type == "HasMany" {
-				targetRes, _ := reg.GetResource(assoc.ResourceName)
-				targetFields := targetRes.GetFieldsFor("index")
-				modelType := reflect.TypeOf(targetRes.Model)
-				destSlice := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0); dest := reflect.New(destSlice.Type())
-				reg.DB.Where(fmt.Sprintf("%s = ?", assoc.ForeignKey), itemMap["ID"]).Find(dest.Interface())
-				assocData[assoc.Name] = AssociationData{Resource: targetRes, Fields: targetFields, Items: reg.sliceToMap(targetRes, targetFields, dest.Elem())}
-			}
+			if assoc.Type != "HasMany" { continue }
+			if assocData[assoc.Name], err = reg.hasManyPanel(r, res, reflect.ValueOf(item), assoc, user); err != nil { reg.renderError(w, r, 500, err); return }
 		}
 		for _, sb := range res.Sidebars { renderedSidebars[sb.Label] = sb.Handler(res, item) }
+		if res.TreeField != "" {
+			if treePath, err = reg.treeAncestors(reg.resourceReader(r.Context(), res), res, treeParent(res, reflect.ValueOf(item))); err != nil { reg.renderError(w, r, 500, err); return }
+		}
+		if res.Comments {
+			if comments, err = reg.recordComments(r, res, fmt.Sprint(recordKey(res, reflect.ValueOf(item))), user); err != nil { reg.renderError(w, r, 500, err); return }
+		}
 	}
-	styleContent, _ := templateFS.ReadFile("templates/style.css")
-	tmpl := reg.loadTemplates("templates/show.html")
-	pd := PageData{SiteTitle: reg.Config.SiteTitle, Resources: reg.Resources, GroupedResources: reg.getGroupedResources(), GroupedPages: reg.getGroupedPages(), CurrentResource: res, Fields: fields, Item: itemMap, User: user, CSS: template.CSS(styleContent), Associations: assocData, Flash: reg.getFlash(w, r), RenderedSidebars: renderedSidebars}
-	tmpl.ExecuteTemplate(w, "show.html", pd)
+	title, crumbs := reg.resName(r.Context(), res), reg.breadcrumbs(r.Context(), Crumb{Label: reg.resName(r.Context(), res)})
+	if item != nil { title, crumbs = reg.recordTitle(r.Context(), res, itemMap[keyEntry]), reg.recordCrumbs(r.Context(), res, item, treePath, "") }
+	tmpl, err := reg.loadTemplates("templates/show.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{Title: title, Breadcrumbs: crumbs, SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), Resources: reg.resourceMap(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user), CurrentResource: res, Fields: fields, Sections: res.GroupFields(fields), Item: itemMap, User: user, CSS: reg.styleCSS(), Associations: assocData, Flash: reg.getFlash(w, r), RenderedSidebars: renderedSidebars, MemberActions: memberActions, Comments: comments, TreePath: treePath, Assignees: assignees, Metadata: metadata}
+	if item != nil { pd.Watching = reg.watching(r, res, fmt.Sprint(itemMap[keyEntry]), user) }
+	pd.CanMerge = res.Mergeable && !res.ReadOnly && reg.actionAllowed(res, "merge", r, user.Role)
+	reg.execute(w, r, tmpl, "show.html", pd)
 }
 
-func (reg *Registry) renderForm(res *resource.Resource, item interface{}, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+// renderForm shows the new or edit form; formErr, when set, is shown above the fields (e.g. a rejected save)
+// and fieldErrs next to the fields they name.
+func (reg *Registry) renderForm(res *resource.Resource, item interface{}, w http.ResponseWriter, r *http.Request, user *models.AdminUser, formErr string, fieldErrs map[string]string) {
+	reg.renderFormWithDuplicates(res, item, w, r, user, formErr, fieldErrs, nil)
+}
+
+// renderFormWithDuplicates is renderForm for a new record held back as a likely duplicate of the matches.
+func (reg *Registry) renderFormWithDuplicates(res *resource.Resource, item interface{}, w http.ResponseWriter, r *http.Request, user *models.AdminUser, formErr string, fieldErrs map[string]string, duplicates []DuplicateMatch) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fields := res.GetFieldsFor("edit")
+	fields := res.GetFieldsForUser("edit", user)
 	var itemMap map[string]interface{}
-	if item != nil { itemMap = reg.itemToMap(res, fields, reflect.ValueOf(item)) }
-	assocData := make(map[string]AssociationData)
-	for _, assoc := range res.Associations {
-		if assoc.Type == "BelongsTo" {
-			targetRes, _ := reg.GetResource(assoc.ResourceName)
-			var count int64; reg.DB.Model(targetRes.Model).Count(&count)
-			if count < reg.Config.SearchThreshold {
-				modelType := reflect.TypeOf(targetRes.Model)
-				destSlice := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0); dest := reflect.New(destSlice.Type())
-				reg.DB.Find(dest.Interface())
-				assocData[assoc.Name] = AssociationData{Resource: targetRes, Options: reg.sliceToMap(targetRes, targetRes.Fields, dest.Elem())}
-			} else { assocData[assoc.Name] = AssociationData{Resource: targetRes} }
-		}
-	}
-	for _, f := range fields { if f.Searchable && f.SearchResource != "" { targetRes, _ := reg.GetResource(f.SearchResource); assocData[f.Name] = AssociationData{Resource: targetRes} } }
-	styleContent, _ := templateFS.ReadFile("templates/style.css")
-	tmpl := reg.loadTemplates("templates/form.html")
-	pd := PageData{SiteTitle: reg.Config.SiteTitle, Resources: reg.Resources, GroupedResources: reg.getGroupedResources(), GroupedPages: reg.getGroupedPages(), CurrentResource: res, Fields: fields, Item: itemMap, User: user, CSS: template.CSS(styleContent), Associations: assocData, Flash: reg.getFlash(w, r)}
-	tmpl.ExecuteTemplate(w, "form.html", pd)
+	if item != nil { itemMap = reg.itemToMap(res, fields, reflect.ValueOf(item), user) } else { itemMap = reg.prefillItem(res, fields, r, user) }
+	assocData := make(map[string]*AssociationData)
+	for _, assoc := range res.Associations { if assoc.Type == "BelongsTo" { assocData[assoc.Name] = reg.belongsToData(r, assoc) } }
+	var treePath []TreeNode
+	if res.TreeField != "" && item != nil {
+		var err error
+		if err = reg.excludeDescendants(reg.resourceDB(r.Context(), res), res, reflect.ValueOf(item), assocData[res.TreeField]); err == nil {
+			treePath, err = reg.treeAncestors(reg.resourceDB(r.Context(), res), res, treeParent(res, reflect.ValueOf(item)))
+		}
+		if err != nil { reg.renderError(w, r, 500, err); return }
+	}
+	for _, f := range fields { if f.Searchable && f.SearchResource != "" { targetRes, _ := reg.GetResource(f.SearchResource); assocData[f.Name] = &AssociationData{Resource: targetRes} } }
+	// Search inputs show the selected record's label rather than its raw id.
+	for name, a := range assocData {
+		if a == nil || a.Resource == nil || a.Options != nil { continue }
+		if id := itemMap[name]; id != nil && !reflect.ValueOf(id).IsZero() {
+			target := reflect.New(reflect.TypeOf(a.Resource.Model))
+			if q, err := reg.whereKey(reg.scope(r.Context(), a.Resource, reg.resourceDB(r.Context(), a.Resource)), a.Resource, id); err == nil && q.Limit(1).Find(target.Interface()).RowsAffected > 0 { a.Label = recordLabel(a.Resource, target) }
+		}
+	}
+	title, crumbs := reg.T(r.Context(), "New %s", reg.resName(r.Context(), res)), reg.breadcrumbs(r.Context(), reg.resourceCrumb(r.Context(), res), Crumb{Label: reg.T(r.Context(), "New")})
+	var lock *EditLockData
+	var recordID string
+	if item != nil && !reflect.ValueOf(itemMap[keyEntry]).IsZero() {
+		recordID = fmt.Sprint(itemMap[keyEntry])
+		title, crumbs = reg.T(r.Context(), "Edit %s", reg.recordTitle(r.Context(), res, itemMap[keyEntry])), reg.recordCrumbs(r.Context(), res, item, treePath, reg.T(r.Context(), "Edit"))
+		lock = reg.editLockData(r, res, recordID, user)
+	}
+	// A draft is offered when the form is opened, not when a rejected save shows it again.
+	draft, restored := reg.draftData(r, res, item, recordID, fields, user, r.Method == http.MethodGet)
+	if restored != nil { itemMap = restored }
+	current := func(name string) string { if v := itemMap[name]; v != nil { return fmt.Sprint(v) }; return "" }
+	if item != nil { current = recordText(reflect.ValueOf(item)) }
+	token, err := reg.issueFormToken(r)
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	var hidden map[string]string
+	if token != "" { hidden = map[string]string{formTokenField: token} }
+	tmpl, err := reg.loadTemplates("templates/form.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{Hidden: hidden, Title: title, Breadcrumbs: crumbs, SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), Resources: reg.resourceMap(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user), CurrentResource: res, Fields: fields, Sections: res.GroupFields(fields), Item: itemMap, User: user, CSS: reg.styleCSS(), Associations: assocData, Flash: reg.getFlash(w, r), Error: formErr, FieldErrors: fieldErrs, TreePath: treePath, ConditionHidden: res.HiddenByCondition(current), EditLock: lock, Draft: draft, DependentSelects: dependentSelects(reg.resourceDB(r.Context(), res), fields, current), Duplicates: duplicates}
+	reg.execute(w, r, tmpl, "form.html", pd)
+}
+
+// belongsToData loads the options of a BelongsTo picker, or none when the target has SearchThreshold records or
+// more, so the form shows a search input instead.
+func (reg *Registry) belongsToData(r *http.Request, assoc resource.Association) *AssociationData {
+	targetRes, ok := reg.GetResource(assoc.ResourceName)
+	if !ok { return nil }
+	var count int64; reg.scope(r.Context(), targetRes, reg.resourceDB(r.Context(), targetRes).Model(targetRes.Model)).Count(&count)
+	if count >= reg.Config.SearchThreshold { return &AssociationData{Resource: targetRes} }
+	dest := reflect.New(targetRes.Meta().SliceType)
+	reg.scope(r.Context(), targetRes, reg.resourceDB(r.Context(), targetRes)).Find(dest.Interface())
+	return &AssociationData{Resource: targetRes, Options: reg.sliceToMap(targetRes, targetRes.Fields, dest.Elem(), CurrentUser(r.Context()))}
+}
+
+// prefillItem builds the initial values of a new record form: field defaults, overridden by query params
+// naming editable fields, e.g. /new?CustomerID=42. Values are parsed into the model so they keep their Go types.
+func (reg *Registry) prefillItem(res *resource.Resource, fields []resource.Field, r *http.Request, user *models.AdminUser) map[string]interface{} {
+	elem := reflect.New(reflect.TypeOf(res.Model)).Elem()
+	for _, f := range fields {
+		field := settableField(elem, f.Name)
+		if f.Readonly || f.Encrypted || !field.CanSet() { continue }
+		if def := fieldDefault(f, user); def != nil { setFieldValue(field, def) }
+		if vals := r.URL.Query()[f.Name]; len(vals) > 0 { setFormValue(f, field, vals[0]) }
+	}
+	m := reg.itemToMap(res, fields, elem, user)
+	delete(m, "ID"); delete(m, keyEntry)
+	return m
 }
 
+// fieldDefault is the value f starts with on a new record, computing a DefaultFunc for user.
+func fieldDefault(f resource.Field, user *models.AdminUser) interface{} {
+	switch fn := f.Default.(type) {
+	case resource.DefaultFunc: return fn(user)
+	case func(*models.AdminUser) interface{}: return fn(user)
+	}
+	return f.Default
+}
+
+// handleSave saves a record from its form. The save, the resource's save hooks and the audit entry share one
+// transaction, and uploads are only promoted to their final names once it commits; any failure re-renders the form.
 func (reg *Registry) handleSave(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
 	r.ParseMultipartForm(32 << 20)
 	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
-	isUpdate, id := false, r.FormValue("ID")
-	if id != "" && id != "0" { reg.DB.First(model, id); isUpdate = true }
+	// Edit forms post to save?id=<key>; integer keys may also come as a form field, since creates never carry one.
+	isUpdate, id := false, r.URL.Query().Get("id")
+	if id == "" && isIntegerKey(res) { id = r.FormValue(res.PrimaryKey) }
+	if id != "" && id != "0" {
+		q, err := reg.whereKey(reg.scope(r.Context(), res, reg.resourceDB(r.Context(), res)), res, id)
+		if err == nil { err = q.First(model).Error }
+		if err != nil { reg.renderRecordError(w, r, err); return }
+		isUpdate = true
+	}
 	elem := reflect.ValueOf(model).Elem()
-	for _, f := range res.Fields {
-		if f.Readonly { continue }
-		field := elem.FieldByName(f.Name); if !field.CanSet() { continue }
+	var before map[string]interface{}
+	if isUpdate { before = rawValues(res, elem) }
+	var staged []stagedUpload
+	fieldErrs := make(map[string]string)
+	// Fields the user may not see are neither shown on the form nor taken from a submission, so they keep their value;
+	// so do fields whose VisibleWhen condition fails on the submitted values, and their input goes unchecked.
+	hidden := savedHidden(res, r, elem, user, isUpdate)
+	for _, f := range res.VisibleFields(user) {
+		if f.Readonly || res.IsUserStamp(f.Name) || (isUpdate && f.Name == res.PrimaryKey) || hidden[f.Name] { continue }
+		field := settableField(elem, f.Name); if !field.CanSet() { continue }
+		if f.Encrypted {
+			// Encrypted inputs start blank for users who may not decrypt them, so a blank one keeps the stored value.
+			v := r.FormValue(f.Name)
+			if v == "" { continue }
+			sealed, err := reg.encryptValue(v)
+			if err != nil { fieldErrs[f.Name] = "Could not encrypt: " + err.Error(); continue }
+			setFieldString(field, sealed)
+			continue
+		}
 		if f.Type == "image" || f.Type == "file" {
 			file, header, err := r.FormFile(f.Name)
-			if err == nil {
-				defer file.Close(); os.MkdirAll(reg.Config.UploadDir, 0755)
-				newName := fmt.Sprintf("%d%s", time.Now().UnixNano(), filepath.Ext(header.Filename))
-				dst, _ := os.Create(filepath.Join(reg.Config.UploadDir, newName)); defer dst.Close(); io.Copy(dst, file)
-				field.SetString("/admin/uploads/" + newName)
-			}
+			if err != nil { continue }
+			s, name, err := reg.stageUpload(file, header); file.Close()
+			if err != nil { fieldErrs[f.Name] = "Upload failed: " + err.Error(); continue }
+			staged = append(staged, s)
+			field.SetString(reg.URL("/uploads/" + name))
+			continue
+		}
+		if f.Type == "tags" {
+			if err := setTags(field, formTags(r.Form[f.Name])); err != nil { fieldErrs[f.Name] = err.Error() }
 			continue
 		}
-		val := r.FormValue(f.Name)
-		if field.Kind() == reflect.Float64 { fv, _ := strconv.ParseFloat(val, 64); field.SetFloat(fv) } else if field.Kind() == reflect.Uint { uv, _ := strconv.ParseUint(val, 10, 64); field.SetUint(uv) } else { field.SetString(val) }
+		if ok, err := parseTypedField(f, field, r.FormValue(f.Name)); ok {
+			if err != nil { fieldErrs[f.Name] = err.Error() }
+			continue
+		}
+		if err := setFieldString(field, r.FormValue(f.Name)); err != nil { fieldErrs[f.Name] = fmt.Sprintf("%q is not a valid %s.", r.FormValue(f.Name), f.Label) }
+	}
+	// A dependent field's value must be one its parent's submitted value offers, whatever the form's script allowed.
+	for name, msg := range dependentErrors(reg.resourceDB(r.Context(), res), res, user, elem, hidden) {
+		if fieldErrs[name] == "" { fieldErrs[name] = msg }
 	}
-	reg.DB.Save(model)
-	newID := fmt.Sprintf("%v", elem.FieldByName("ID").Interface())
+	if len(fieldErrs) > 0 {
+		reg.finishUploads(staged, false)
+		w.WriteHeader(http.StatusUnprocessableEntity); reg.renderForm(res, model, w, r, user, "Please correct the highlighted fields.", fieldErrs); return
+	}
+	// A new record that likely duplicates an existing one waits for the user to confirm it.
+	if !isUpdate && r.FormValue(createAnywayField) == "" {
+		matches, err := reg.findDuplicates(r.Context(), res, duplicateValues(res, r.FormValue))
+		if err != nil { reg.log(r.Context()).Error("duplicate check failed", "resource", res.Slug, "user", user.Email, "error", err) }
+		if len(matches) > 0 {
+			reg.finishUploads(staged, false)
+			w.WriteHeader(http.StatusConflict); reg.renderFormWithDuplicates(res, model, w, r, user, "", nil, matches); return
+		}
+	}
+	formToken, ok := reg.consumeFormToken(res, model, w, r, user)
+	if !ok { reg.finishUploads(staged, false); return }
 	act := "Create"; if isUpdate { act = "Update" }
-	reg.RecordAction(user, res.Name, newID, act, "Saved from form")
-	reg.setFlash(w, fmt.Sprintf("%s saved successfully", res.Name))
-	http.Redirect(w, r, "/admin/"+res.Name, 303)
+	var newID, note string
+	var changes map[string]FieldChange
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		if pos := fieldValue(elem, res.PositionField); !isUpdate && pos.IsValid() && pos.CanInt() && pos.Int() == 0 {
+			if next, err := reg.nextPosition(tx, res); err == nil { pos.SetInt(next) }
+		}
+		stampUser(res, elem, user, !isUpdate)
+		if err := runSaveHooks(res.BeforeSave, tx, user, model, !isUpdate); err != nil { return formError{err} }
+		if err := reg.checkTreeParent(tx, res, elem); err != nil { return formError{err} }
+		if err := reg.applyScope(tx, res, elem); err != nil { return err }
+		save := tx.Save; if !isUpdate { save = tx.Create }
+		if err := save(model).Error; err != nil { return err }
+		if err := runSaveHooks(res.AfterSave, tx, user, model, !isUpdate); err != nil { return formError{err} }
+		newID = fmt.Sprint(recordKey(res, elem))
+		if err := reg.checkScope(tx, res, newID); err != nil { return formError{err} }
+		changes = changedFields(res, before, rawValues(res, elem))
+		note = changesNote(res, changes, !isUpdate)
+		return reg.recordAction(tx, user, res.Slug, newID, act, note)
+	})
+	reg.finishUploads(staged, err == nil)
+	if err != nil {
+		msg := "Could not save: " + err.Error()
+		var fe formError
+		if errors.As(err, &fe) { msg = fe.Error() } else { reg.log(r.Context()).Error("save failed", "resource", res.Slug, "id", id, "user", user.Email, "error", err) }
+		w.WriteHeader(http.StatusUnprocessableEntity); reg.renderForm(res, model, w, r, user, msg, nil); return
+	}
+	reg.afterAuditChanges(user, res.Slug, newID, act, note, changes)
+	reg.notifyChange(user, res.Slug, strings.ToLower(act), newID, changes)
+	if reg.Config.Drafts {
+		draftID := newID
+		if !isUpdate { draftID = draftNew }
+		if err := reg.deleteDraft(r.Context(), res, draftID, user); err != nil { reg.log(r.Context()).Error("clearing draft failed", "resource", res.Slug, "id", newID, "error", err) }
+	}
+	if isUpdate && reg.Config.EditLocks {
+		if err := reg.releaseEditLock(r.Context(), res, newID, user); err != nil { reg.log(r.Context()).Error("releasing edit lock failed", "resource", res.Slug, "id", newID, "error", err) }
+	}
+	if formToken != "" {
+		if err := reg.formTokens().CompleteFormToken(r.Context(), formToken, newID); err != nil { reg.log(r.Context()).Error("recording form token failed", "resource", res.Slug, "id", newID, "error", err) }
+	}
+	reg.setFlash(w, reg.T(r.Context(), "%s saved successfully", reg.resName(r.Context(), res)))
+	http.Redirect(w, r, reg.afterSaveURL(res, r, newID), 303)
+}
+
+// afterSaveURL is where a save redirects, chosen by the form's submit button through its _then value: the list by
+// default, the record's edit form for "continue", or a new form for "another", prefilled with the submitted values
+// of the resource's StickyFields.
+func (reg *Registry) afterSaveURL(res *resource.Resource, r *http.Request, id string) string {
+	switch r.FormValue("_then") {
+	case "continue":
+		return reg.URL("/" + res.Slug + "/edit?id=" + url.QueryEscape(id))
+	case "another":
+		sticky := url.Values{}
+		for _, name := range res.StickyFields { if vals, ok := r.PostForm[name]; ok { sticky[name] = vals } }
+		if len(sticky) == 0 { return reg.URL("/" + res.Slug + "/new") }
+		return reg.URL("/" + res.Slug + "/new?" + sticky.Encode())
+	}
+	return reg.URL("/" + res.Slug)
+}
+
+// formError marks a save hook's error, which is shown on the form as it is rather than as a database failure.
+type formError struct{ error }
+
+func (e formError) Unwrap() error { return e.error }
+
+// changesNote describes a save's changes for the audit log, one field per line in field order; created
+// records list their set values only.
+func changesNote(res *resource.Resource, changes map[string]FieldChange, isNew bool) string {
+	var lines []string
+	for _, f := range res.Fields {
+		c, ok := changes[f.Name]
+		if !ok { continue }
+		// Neither side of an encrypted field's change is written to the log.
+		if f.Encrypted { lines = append(lines, f.Name+": changed"); continue }
+		if isNew { lines = append(lines, fmt.Sprintf("%s: %q", f.Name, fmt.Sprint(c.To))) } else { lines = append(lines, fmt.Sprintf("%s: %q → %q", f.Name, fmt.Sprint(c.From), fmt.Sprint(c.To))) }
+	}
+	if len(lines) == 0 { return "No changes" }
+	return strings.Join(lines, "\n")
 }
 
-func (reg *Registry) handleBatchAction(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+func (reg *Registry) handleBatchAction(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
 	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
-	r.ParseForm(); actionName, ids := r.FormValue("action_name"), r.Form["ids"]
-	if actionName == "" || len(ids) == 0 { http.Redirect(w, r, "/admin/"+res.Name, 303); return }
-	for _, a := range res.BatchActions { if a.Name == actionName { a.Handler(res, ids, w, r); return } }
-}
-
-func (reg *Registry) handleExport(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s_export.csv", res.Name))
-	writer := csv.NewWriter(w); defer writer.Flush()
-	var h []string; for _, f := range res.Fields { h = append(h, f.Label) }; writer.Write(h)
-	query := reg.DB.Model(res.Model)
-	modelType := reflect.TypeOf(res.Model)
-	destSlice := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0); dest := reflect.New(destSlice.Type())
-	query.Find(dest.Interface()); items := dest.Elem()
-	for i := 0; i < items.Len(); i++ {
-		item := reflect.Indirect(items.Index(i)); var row []string
-		for _, f := range res.Fields { row = append(row, fmt.Sprintf("%v", item.FieldByName(f.Name).Interface())) }
+	r.ParseMultipartForm(32 << 20); actionName, ids := r.FormValue("action_name"), r.Form["ids"]
+	allMatching := r.FormValue("all_matching") != ""
+	if actionName == "" || (len(ids) == 0 && !allMatching) { http.Redirect(w, r, reg.URL("/"+res.Slug), 303); return }
+	// Only batch job actions run on every record matching the filter; the others need the ids at hand.
+	isJob := false
+	for _, a := range res.BatchActions { if a.Name == actionName { isJob = a.JobHandler != nil } }
+	if allMatching && !isJob {
+		reg.setFlash(w, reg.T(r.Context(), "This action only runs on the selected records"))
+		http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+		return
+	}
+	switch actionName {
+	case batchEditAction: reg.handleBatchEdit(res, ids, w, r, user); return
+	case batchDeleteAction: reg.handleBatchDelete(res, ids, w, r, user); return
+	}
+	for _, a := range res.BatchActions {
+		if a.Name != actionName { continue }
+		if !a.IsVisible(user) { http.Error(w, "Forbidden", 403); return }
+		if a.JobHandler != nil {
+			if allMatching { ids = []string{} }
+			reg.handleBatchJobAction(res, a, ids, allMatching, w, r, user)
+			return
+		}
+		if r = reg.withParams(res, a.Label, a.Params, ids, w, r, user); r != nil { a.Handler(res, ids, w, r) }
+		return
+	}
+}
+
+const exportBatchSize = 1000
+
+var csvDelimiters = map[string]rune{"comma": ',', ",": ',', "semicolon": ';', ";": ';', "tab": '\t', "\t": '\t', "pipe": '|', "|": '|'}
+
+// exportDialect returns an export's delimiter and whether it starts with a byte order mark: the config defaults,
+// overridden by the delimiter and bom query params.
+func (reg *Registry) exportDialect(q url.Values) (rune, bool, error) {
+	name := reg.Config.CSVDelimiter
+	if d := q.Get("delimiter"); d != "" { name = d }
+	delim, ok := csvDelimiters[name]
+	if name == "" { delim, ok = ',', true }
+	if !ok { return 0, false, fmt.Errorf("unknown delimiter %q", name) }
+	bom := reg.Config.CSVBOM
+	if b := q.Get("bom"); b != "" { bom, _ = strconv.ParseBool(b) }
+	return delim, bom, nil
+}
+
+// escapeFormula neutralises a cell a spreadsheet would run as a formula, as Config.CSVFormulaEscaping says;
+// numbers such as -5 are left alone.
+func escapeFormula(cell, mode string) string {
+	if mode == "off" || cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) { return cell }
+	if _, err := strconv.ParseFloat(cell, 64); err == nil { return cell }
+	if mode == "tab" { return "\t" + cell }
+	return "'" + cell
+}
+
+// handleExport serves GET <resource>/export with the list's filters, or a POST of the list's selected rows as ids[].
+func (reg *Registry) handleExport(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	params, filename := r.URL.Query(), res.Slug+"_export.csv"
+	if r.Method == "POST" {
+		r.ParseForm()
+		if len(r.PostForm["ids[]"]) == 0 {
+			reg.setFlash(w, reg.T(r.Context(), "Select the records to export first"))
+			http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+r.URL.RawQuery), 303)
+			return
+		}
+		params["ids[]"] = r.PostForm["ids[]"]
+		filename = fmt.Sprintf("%s_selected_%s.csv", res.Slug, time.Now().Format("2006-01-02"))
+	}
+	spec, err := reg.prepareExport(r.Context(), res, params, user)
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	if res.AsyncExports || reg.Config.AsyncExportThreshold > 0 {
+		total := reg.CountFor(r.Context(), res, spec.lq.CountQuery())
+		if res.AsyncExports || total > reg.Config.AsyncExportThreshold { reg.queueExport(w, r, res, spec, user, total); return }
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment;filename="+filename)
+	if err := reg.writeExport(r.Context(), w, res, spec, nil); err != nil { reg.log(r.Context()).Error("export stopped", "resource", res.Slug, "error", err) }
+}
+
+// exportSpec is an export's list query, columns and CSV dialect, resolved from the export link's parameters.
+type exportSpec struct {
+	lq          *listQuery
+	fields      []resource.Field
+	includes    []*jsonInclude        // the BelongsTo associations the fields' dot-paths read
+	paths       map[string]exportPath // the dot-path fields, by name
+	delim       rune
+	bom         bool
+	sort, order string
+	query       string // the parameters the spec was resolved from, which a background job resolves it from again
+}
+
+func (reg *Registry) prepareExport(ctx context.Context, res *resource.Resource, params url.Values, user *models.AdminUser) (*exportSpec, error) {
+	lq, err := reg.buildListQuery(ctx, res, params)
+	if err != nil { return nil, err }
+	// Selected rows narrow the list query, so ids outside the user's scope or filters drop out.
+	if ids, ok := params["ids[]"]; ok {
+		keys := keyValues(res, ids)
+		if len(keys) == 0 { lq.DB = lq.DB.Where("1 = 0") } else { lq.DB = lq.DB.Where(lq.PK+" IN ?", keys) }
+		lq.Narrowed = true
+	}
+	delim, bom, err := reg.exportDialect(params)
+	if err != nil { return nil, err }
+	fields, includes, paths := reg.exportFields(res, user)
+	if params.Get("visible_only") != "" { fields, includes, paths = reg.indexFields(ctx, res, user), nil, nil }
+	return &exportSpec{lq: lq, fields: fields, includes: includes, paths: paths, delim: delim, bom: bom, sort: params.Get("sort"), order: params.Get("order"), query: params.Encode()}, nil
+}
+
+// writeExport writes the records spec matches to out as CSV, decorated fields as their decorator's text unless
+// marked ExportRaw. progress, if set, is called with the rows written so far every exportBatchSize rows and once at
+// the end; the export stops when ctx is done.
+func (reg *Registry) writeExport(ctx context.Context, out io.Writer, res *resource.Resource, spec *exportSpec, progress func(int64)) error {
+	db, lq, fields := reg.resourceReader(ctx, res), spec.lq, spec.fields
+	start, email := time.Now(), ""
+	if user := CurrentUser(ctx); user != nil { email = user.Email }
+	reg.log(ctx).Info("export started", "resource", res.Slug, "user", email)
+	if spec.bom { io.WriteString(out, "\uFEFF") }
+	writer := csv.NewWriter(out); writer.Comma = spec.delim; defer writer.Flush()
+	write := func(row []string) {
+		for i := range row { row[i] = escapeFormula(row[i], reg.Config.CSVFormulaEscaping) }
 		writer.Write(row)
 	}
+	var h []string; for _, f := range fields { h = append(h, f.Label) }; write(h)
+	var written int64
+	writeRows := func(items reflect.Value) error {
+		counts, err := reg.relatedCounts(db, res, fields, items)
+		if err != nil { return err }
+		if err := reg.loadIncludes(ctx, db, spec.includes, items); err != nil { return err }
+		for i := 0; i < items.Len(); i++ {
+			item := reflect.Indirect(items.Index(i)); var row []string
+			var raw map[string]interface{}
+			for _, f := range fields {
+				if f.CountOf != "" { row = append(row, strconv.FormatInt(counts[f.Name][fmt.Sprintf("%v", recordKey(res, item))], 10)); continue }
+				if p, ok := spec.paths[f.Name]; ok { row = append(row, pathCell(p, item)); continue }
+				if f.Virtual {
+					if raw == nil { raw = rawValues(res, item) }
+					var val interface{}
+					if f.Compute != nil { val = f.Compute(db, raw) }
+					if f.Decorator != nil && !f.ExportRaw { row = append(row, htmlText(f.Decorator(val))); continue }
+					row = append(row, fmt.Sprintf("%v", val)); continue
+				}
+				cell := ""
+				if fv := res.Meta().Value(item, f.Name); fv.IsValid() {
+					if f.Encrypted {
+						cell = reg.exportEncrypted(f, CurrentUser(ctx), fv.Interface())
+					} else if f.Decorator != nil && !f.ExportRaw {
+						cell = htmlText(f.Decorator(fv.Interface()))
+					} else if f.Type == "tags" {
+						cell = strings.Join(tagValues(fv.Interface()), ", ")
+					} else if input, _, ok := formatTypedField(f, fv.Interface()); ok {
+						cell = input
+					} else {
+						cell = fmt.Sprintf("%v", fv.Interface())
+					}
+				}
+				row = append(row, cell)
+			}
+			write(row)
+			if written++; written%exportBatchSize == 0 {
+				if progress != nil { progress(written) }
+				if err := ctx.Err(); err != nil { return err }
+			}
+		}
+		if m := reg.metrics(); m != nil { m.AddExportRows(res.Slug, items.Len()) }
+		writer.Flush()
+		if err := writer.Error(); err != nil { return err }
+		return ctx.Err()
+	}
+	dest := reflect.New(res.Meta().SliceType)
+	var err error
+	if res.CursorPagination {
+		// Large tables are streamed in primary key batches rather than loaded at once.
+		err = lq.FindInBatches(dest.Interface(), exportBatchSize, func() error { return writeRows(dest.Elem()) })
+	} else {
+		lq.Sort(spec.sort, spec.order)
+		if err = lq.Find(dest.Interface()); err == nil { err = writeRows(dest.Elem()) }
+	}
+	if err != nil { return err }
+	if progress != nil { progress(written) }
+	reg.log(ctx).Info("export finished", "resource", res.Slug, "user", email, "rows", written, "duration", time.Since(start))
+	return nil
 }
 
-func (reg *Registry) handleCustomAction(res *resource.Resource, w http.ResponseWriter, r *http.Request, isCollection bool) {
+func (reg *Registry) handleCustomAction(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser, isCollection bool) {
 	actionName := r.URL.Query().Get("name")
 	var actions []resource.Action
 	if isCollection { actions = res.CollectionActions } else { actions = res.MemberActions }
-	for _, a := range actions { if a.Name == actionName { a.Handler(res, w, r); return } }
+	for _, a := range actions {
+		if a.Name != actionName { continue }
+		if a.JSON { reg.handleJSONAction(res, a, w, r, user, isCollection); return }
+		// Visibility is checked again against the current record, so a stale page cannot run a hidden action.
+		var item map[string]interface{}
+		if !isCollection {
+			record, err := reg.getContext(r.Context(), res.Slug, r.URL.Query().Get("id"))
+			if err != nil { reg.renderRecordError(w, r, err); return }
+			item = rawValues(res, reflect.ValueOf(record))
+		}
+		if !a.IsVisible(user, item) { http.Error(w, "Forbidden", 403); return }
+		if r = reg.withParams(res, a.Label, a.Params, nil, w, r, user); r != nil { a.Handler(res, w, r) }
+		return
+	}
 }
 
-func (reg *Registry) handleSearchAPI(resourceName string, w http.ResponseWriter, r *http.Request) {
+// handleSearchAPI serves GET /<resource>/search?q=, the association pickers' lookup: up to ten records whose visible
+// text fields match, labelled from the fields user may see.
+func (reg *Registry) handleSearchAPI(resourceName string, w http.ResponseWriter, r *http.Request, user *models.AdminUser, role string) {
 	res, ok := reg.GetResource(resourceName); if !ok { http.Error(w, "Not found", 404); return }
-	query := r.URL.Query().Get("q"); db := reg.DB.Model(res.Model); searchQuery := ""
-	for _, f := range res.Fields { if f.Type == "text" { if searchQuery != "" { searchQuery += " OR " }; searchQuery += fmt.Sprintf("%s LIKE ?", f.Name) } }
+	if res.APIDisabled { writeJSONError(w, http.StatusNotFound, "not found"); return }
+	if !reg.IsAllowed(role, res.Slug, "list") { writeJSONError(w, http.StatusForbidden, "forbidden"); return }
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { writeJSONError(w, http.StatusInternalServerError, err.Error()); return }
+	query := r.URL.Query().Get("q"); db := reg.scope(r.Context(), res, reg.resourceReader(r.Context(), res).Model(res.Model)); searchQuery := ""
+	for _, f := range res.VisibleFields(user) {
+		col, ok := column(sch, f.Name)
+		if f.Type != "text" || f.Virtual || !ok { continue }
+		if searchQuery != "" { searchQuery += " OR " }; searchQuery += col + " LIKE ?"
+	}
 	if searchQuery != "" { args := make([]interface{}, strings.Count(searchQuery, "?")); for i := range args { args[i] = "%" + query + "%" }; db = db.Where(searchQuery, args...) }
-	var results []map[string]interface{}; modelType := reflect.TypeOf(res.Model)
-	destSlice := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0); dest := reflect.New(destSlice.Type())
+	if s, ok := res.FindScope(res.ActiveScope(r.URL.Query().Get("scope"))); ok { db = s.Handler(db) }
+	var results []map[string]interface{}; dest := reflect.New(res.Meta().SliceType)
 	db.Limit(10).Find(dest.Interface()); items := dest.Elem()
 	for i := 0; i < items.Len(); i++ {
 		item := reflect.Indirect(items.Index(i)); m := make(map[string]interface{})
-		m["id"] = item.FieldByName("ID").Interface()
-		if f := item.FieldByName("Name"); f.IsValid() { m["text"] = f.Interface() } else if f := item.FieldByName("Email"); f.IsValid() { m["text"] = f.Interface() } else { m["text"] = fmt.Sprintf("ID: %v", m["id"]) }
+		m["id"], m["text"] = recordKey(res, item), visibleLabel(res, item, user)
 		results = append(results, m)
 	}
 	w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(results)
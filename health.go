@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthTimeout bounds the database ping of /healthz, so a hung database fails the check instead of the probe.
+const healthTimeout = 2 * time.Second
+
+// healthStatus is the body of /healthz and /readyz.
+type healthStatus struct {
+	Status    string `json:"status"`
+	Database  string `json:"database,omitempty"`
+	Templates string `json:"templates,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, s healthStatus) {
+	status := http.StatusOK
+	if s.Status != "ok" { status = http.StatusServiceUnavailable }
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(s)
+}
+
+// handleHealthz serves /healthz without a session: the database answers a ping and every page template parses,
+// or it is a 503. Failures are logged rather than shown, as anyone can call it.
+func (reg *Registry) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s := healthStatus{Status: "ok", Database: "ok", Templates: "ok"}
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	sqlDB, err := reg.DB.DB()
+	if err == nil { err = sqlDB.PingContext(ctx) }
+	if err != nil {
+		reg.log(r.Context()).Error("health check failed", "check", "database", "error", err)
+		s.Status, s.Database = "error", "unavailable"
+	}
+	if err := reg.checkTemplates(); err != nil {
+		reg.log(r.Context()).Error("health check failed", "check", "templates", "error", err)
+		s.Status, s.Templates = "error", "invalid"
+	}
+	writeHealth(w, s)
+}
+
+// handleReadyz serves /readyz without a session; it turns 503 once BeginShutdown is called, so load balancers stop
+// sending traffic while requests in flight finish.
+func (reg *Registry) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if reg.draining.Load() { writeHealth(w, healthStatus{Status: "draining"}); return }
+	writeHealth(w, healthStatus{Status: "ok"})
+}
+
+// checkTemplates parses each page template, overrides included.
+func (reg *Registry) checkTemplates() error {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil { return err }
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".html") { continue }
+		if _, err := reg.parseTemplates(e.Name()); err != nil { return err }
+	}
+	return nil
+}
+
+// goBackground runs fn in a goroutine that Close waits for; fn should return once ctx, cancelled by BeginShutdown,
+// is done. Nothing is started after BeginShutdown.
+func (reg *Registry) goBackground(fn func(ctx context.Context)) {
+	if reg.background.Err() != nil { return }
+	reg.workers.Add(1)
+	go func() { defer reg.workers.Done(); fn(reg.background) }()
+}
+
+// BeginShutdown starts draining: /readyz reports 503 from now on, and the background workers (session cleanup,
+// export workers and webhook deliveries) stop taking new work. Requests are still served. It is safe to call twice.
+func (reg *Registry) BeginShutdown() {
+	reg.draining.Store(true)
+	reg.stopBackground()
+}
+
+// Close calls BeginShutdown and waits for the background workers to finish what they are doing, such as an export
+// being written, until ctx is done. Use it alongside http.Server.Shutdown:
+//
+//	reg.BeginShutdown()
+//	time.Sleep(drainDelay) // let the load balancer see /readyz fail
+//	srv.Shutdown(ctx)
+//	reg.Close(ctx)
+func (reg *Registry) Close(ctx context.Context) error {
+	reg.BeginShutdown()
+	done := make(chan struct{})
+	go func() { reg.workers.Wait(); close(done) }()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+)
+
+// runSaveHooks runs hooks in registration order, stopping at the first error.
+func runSaveHooks(hooks []resource.SaveHook, db *gorm.DB, user *models.AdminUser, item interface{}, isNew bool) error {
+	for _, h := range hooks { if err := h(db, user, item, isNew); err != nil { return err } }
+	return nil
+}
+
+// runDeleteHooks runs a resource's BeforeDelete hooks for one record, stopping at the first error.
+func runDeleteHooks(res *resource.Resource, db *gorm.DB, user *models.AdminUser, id string) error {
+	for _, h := range res.BeforeDelete { if err := h(db, user, id); err != nil { return err } }
+	return nil
+}
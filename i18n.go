@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Translator turns the admin's English UI strings into another locale's. The key is the English text itself, a
+// fmt format when args are given, so a locale or key the translator does not know falls back to English.
+type Translator interface {
+	T(locale, key string, args ...interface{}) string
+}
+
+// MapTranslator is the default Translator, holding each locale's messages in memory.
+type MapTranslator struct {
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+func NewMapTranslator() *MapTranslator { return &MapTranslator{messages: make(map[string]map[string]string)} }
+
+// Add merges messages, keyed by their English text, into locale.
+func (t *MapTranslator) Add(locale string, messages map[string]string) *MapTranslator {
+	t.mu.Lock(); defer t.mu.Unlock()
+	m := t.messages[locale]
+	if m == nil { m = make(map[string]string); t.messages[locale] = m }
+	for k, v := range messages { m[k] = v }
+	return t
+}
+
+// LoadJSON adds the messages of a JSON object file, e.g. {"Save": "Speichern", "%s saved successfully": "%s gespeichert"}.
+func (t *MapTranslator) LoadJSON(locale, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil { return err }
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil { return fmt.Errorf("%s: %w", path, err) }
+	t.Add(locale, messages)
+	return nil
+}
+
+// LoadTranslations reads every <locale>.json file in dir, such as de.json and es.json, into a MapTranslator.
+func LoadTranslations(dir string) (*MapTranslator, error) {
+	t := NewMapTranslator()
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil { return nil, err }
+	for _, f := range files {
+		if err := t.LoadJSON(strings.TrimSuffix(filepath.Base(f), ".json"), f); err != nil { return nil, err }
+	}
+	return t, nil
+}
+
+// T looks key up in locale, then in its language alone ("de" for "de-AT"), then in "en" for reworded English.
+func (t *MapTranslator) T(locale, key string, args ...interface{}) string {
+	msg := key
+	t.mu.RLock()
+	for _, l := range []string{locale, baseLanguage(locale), "en"} {
+		if m, ok := t.messages[l][key]; ok && m != "" { msg = m; break }
+	}
+	t.mu.RUnlock()
+	if len(args) > 0 { return fmt.Sprintf(msg, args...) }
+	return msg
+}
+
+// Locales lists the locales with messages.
+func (t *MapTranslator) Locales() []string {
+	t.mu.RLock(); defer t.mu.RUnlock()
+	var locales []string
+	for l := range t.messages { locales = append(locales, l) }
+	sort.Strings(locales)
+	return locales
+}
+
+func baseLanguage(locale string) string {
+	if i := strings.IndexAny(locale, "-_"); i > 0 { return locale[:i] }
+	return locale
+}
+
+// localeNames are the names the locale picker shows for common locales; others show their code.
+var localeNames = map[string]string{
+	"en": "English", "de": "Deutsch", "es": "Español", "fr": "Français", "it": "Italiano", "nl": "Nederlands",
+	"pt": "Português", "pl": "Polski", "sv": "Svenska", "da": "Dansk", "ja": "日本語", "zh": "中文",
+}
+
+type localeKey struct{}
+
+// SetTranslator replaces the Translator; nil restores the built-in English strings.
+func (reg *Registry) SetTranslator(t Translator) *Registry {
+	if t == nil { t = NewMapTranslator() }
+	reg.mu.Lock(); reg.translator = t; reg.mu.Unlock()
+	return reg
+}
+
+func (reg *Registry) getTranslator() Translator {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	return reg.translator
+}
+
+// T translates a UI string for the locale of the request ctx belongs to, for custom pages and actions.
+func (reg *Registry) T(ctx context.Context, key string, args ...interface{}) string {
+	return reg.getTranslator().T(reg.localeFrom(ctx), key, args...)
+}
+
+// Locales lists the locales users can pick: Config.Locales, or the default locale and the translator's.
+func (reg *Registry) Locales() []string {
+	if len(reg.Config.Locales) > 0 { return reg.Config.Locales }
+	locales := []string{reg.defaultLocale()}
+	if l, ok := reg.getTranslator().(interface{ Locales() []string }); ok {
+		for _, loc := range l.Locales() { if loc != locales[0] && loc != "en" { locales = append(locales, loc) } }
+	}
+	return locales
+}
+
+func (reg *Registry) defaultLocale() string {
+	if reg.Config.DefaultLocale != "" { return reg.Config.DefaultLocale }
+	return "en"
+}
+
+// requestLocale picks the locale of a request: the signed-in user's choice, else the first Accept-Language entry
+// matching an available locale, else Config.DefaultLocale.
+func (reg *Registry) requestLocale(ctx context.Context, acceptLanguage string) string {
+	if user := CurrentUser(ctx); user != nil && user.Locale != "" { return user.Locale }
+	available := reg.Locales()
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		tag = strings.TrimSpace(strings.SplitN(tag, ";", 2)[0])
+		for _, l := range available {
+			if strings.EqualFold(l, tag) || strings.EqualFold(l, baseLanguage(tag)) { return l }
+		}
+	}
+	return reg.defaultLocale()
+}
+
+func withLocale(ctx context.Context, locale string) context.Context { return context.WithValue(ctx, localeKey{}, locale) }
+
+func (reg *Registry) localeFrom(ctx context.Context) string {
+	if l, ok := ctx.Value(localeKey{}).(string); ok { return l }
+	return reg.requestLocale(ctx, "")
+}
+
+// resName is res's name in the locale of ctx.
+func (reg *Registry) resName(ctx context.Context, res *resource.Resource) string {
+	if l, ok := res.Localized(reg.localeFrom(ctx), ""); ok { return l }
+	return res.Name
+}
+
+// localizeFields applies res's per-locale labels to a copy of fields.
+func localizeFields(res *resource.Resource, locale string, fields []resource.Field) []resource.Field {
+	if res == nil || len(res.Labels) == 0 || len(fields) == 0 { return fields }
+	out := append([]resource.Field(nil), fields...)
+	for i := range out { if l, ok := res.Localized(locale, out[i].Name); ok { out[i].Label = l } }
+	return out
+}
+
+// localize sets a page's locale and translates the labels of the fields it shows.
+func (reg *Registry) localize(ctx context.Context, pd *PageData) {
+	pd.Locale, pd.Locales, pd.translator = reg.localeFrom(ctx), reg.Locales(), reg.getTranslator()
+	res := pd.CurrentResource
+	if res == nil { return }
+	pd.Fields, pd.BoardFields = localizeFields(res, pd.Locale, pd.Fields), localizeFields(res, pd.Locale, pd.BoardFields)
+	if len(res.Labels) > 0 {
+		sections := make([]resource.FieldGroup, len(pd.Sections))
+		for i, s := range pd.Sections { s.Fields = localizeFields(res, pd.Locale, s.Fields); sections[i] = s }
+		pd.Sections = sections
+		columns := make([]ColumnChoice, len(pd.Columns))
+		for i, c := range pd.Columns { if l, ok := res.Localized(pd.Locale, c.Field.Name); ok { c.Field.Label = l }; columns[i] = c }
+		pd.Columns = columns
+	}
+	for name, a := range pd.Associations {
+		if a == nil || a.Resource == nil { continue }
+		c := *a
+		c.Fields = localizeFields(a.Resource, pd.Locale, a.Fields)
+		pd.Associations[name] = &c
+	}
+}
+
+// T translates key for the page's locale; templates call it as {{$.T "Save"}} or {{$.T "%d records" .TotalCount}}.
+func (pd PageData) T(key string, args ...interface{}) string {
+	if pd.translator == nil {
+		if len(args) > 0 { return fmt.Sprintf(key, args...) }
+		return key
+	}
+	return pd.translator.T(pd.Locale, key, args...)
+}
+
+// ResName is res's name in the page's locale.
+func (pd PageData) ResName(res *resource.Resource) string {
+	if res == nil { return "" }
+	if l, ok := res.Localized(pd.Locale, ""); ok { return l }
+	return res.Name
+}
+
+// FieldLabel is the label of a field of the current resource in the page's locale.
+func (pd PageData) FieldLabel(f resource.Field) string {
+	if pd.CurrentResource != nil { if l, ok := pd.CurrentResource.Localized(pd.Locale, f.Name); ok { return l } }
+	return f.Label
+}
+
+// LocaleName is how the locale picker shows a locale.
+func (pd PageData) LocaleName(locale string) string {
+	if n, ok := localeNames[locale]; ok { return n }
+	if n, ok := localeNames[baseLanguage(locale)]; ok { return n + " (" + locale + ")" }
+	return locale
+}
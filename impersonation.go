@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"net/http"
+)
+
+// canImpersonate reports why actor may not act as target, or nil if it may. Only admins who are not already
+// impersonating can start, and other admins are off limits unless Config.AllowAdminImpersonation is set.
+func (reg *Registry) canImpersonate(actor, target *models.AdminUser) error {
+	switch {
+	case actor.Role != "admin" || actor.Impersonator != nil:
+		return errors.New("Only admins can impersonate users.")
+	case actor.ID == target.ID:
+		return errors.New("You cannot impersonate yourself.")
+	case !target.Active:
+		return errors.New("Deactivated users cannot be impersonated.")
+	case target.Role == "admin" && !reg.Config.AllowAdminImpersonation:
+		return errors.New("Impersonating other admins is disabled.")
+	}
+	return nil
+}
+
+// handleImpersonate replaces the current session with one acting as the user in ?id=, remembering the admin behind it.
+// A GET asks for confirmation; the switch itself takes a POST carrying the session token.
+func (reg *Registry) handleImpersonate(res *Resource, w http.ResponseWriter, r *http.Request) {
+	user, _ := reg.GetUserFromRequest(r)
+	if user == nil { http.Redirect(w, r, reg.URL("/login"), 303); return }
+	var target models.AdminUser
+	if err := reg.dbFor(r).Where("id = ?", r.URL.Query().Get("id")).First(&target).Error; err != nil { reg.renderRecordError(w, r, err); return }
+	if err := reg.canImpersonate(user, &target); err != nil { reg.setFlash(w, err.Error()); http.Redirect(w, r, reg.URL("/"+res.Slug), 303); return }
+	if r.Method != "POST" { reg.renderImpersonateConfirm(res, &target, w, r, user); return }
+	if !reg.validSessionToken(r) { http.Error(w, "Forbidden", http.StatusForbidden); return }
+	if err := reg.startSession(w, r, &target, user.ID); err != nil { reg.renderError(w, r, 500, err); return }
+	reg.RecordAction(user, usersSlug, fmt.Sprint(target.ID), "Impersonate", "Started acting as "+target.Email)
+	reg.setFlash(w, reg.T(r.Context(), "You are now viewing the admin as %s", target.Email))
+	http.Redirect(w, r, reg.URL("/"), 303)
+}
+
+// renderImpersonateConfirm shows the form that posts the switch to target back to the action.
+func (reg *Registry) renderImpersonateConfirm(res *Resource, target *models.AdminUser, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	tmpl, err := reg.loadTemplates("templates/form.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	label := reg.T(r.Context(), "Impersonate %s", target.Email)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	reg.execute(w, r, tmpl, "form.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		CurrentResource: res, Item: map[string]interface{}{}, User: user, CSS: reg.styleCSS(),
+		FormAction: r.URL.RequestURI(), FormTitle: label, SubmitLabel: reg.T(r.Context(), "Impersonate"), Hidden: map[string]string{sessionTokenField: reg.sessionToken(r)},
+		Title: label, Breadcrumbs: reg.breadcrumbs(r.Context(), reg.resourceCrumb(r.Context(), res), Crumb{Label: target.Email, URL: reg.recordURL(res, fmt.Sprint(target.ID))}, Crumb{Label: label}),
+	})
+}
+
+// handleStopImpersonating swaps the session for a fresh one as the admin who started impersonating.
+func (reg *Registry) handleStopImpersonating(w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	if user.Impersonator == nil { http.Redirect(w, r, reg.URL("/"), 303); return }
+	if err := reg.startSession(w, r, user.Impersonator, 0); err != nil { reg.renderError(w, r, 500, err); return }
+	reg.RecordAction(user, usersSlug, fmt.Sprint(user.ID), "Stop impersonating", "Returned to "+user.Impersonator.Email)
+	reg.setFlash(w, reg.T(r.Context(), "Welcome back, %s", user.Impersonator.Email))
+	http.Redirect(w, r, reg.URL("/"+usersSlug), 303)
+}
@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errInlineConflict refuses an inline edit of a record saved since the list showing it was rendered.
+var errInlineConflict = errors.New("this record was changed by someone else; reload to see the latest version")
+
+// inlineResult answers an inline edit: the cell's display HTML and input value, and the record's version to send
+// with its next edit. Error explains a refused edit; on a conflict the rest describes the record as it now is.
+type inlineResult struct {
+	HTML    template.HTML `json:"html"`
+	Value   string        `json:"value"`
+	Version string        `json:"version,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// inlineFields are the fields of res that user may edit in their list cells, by name.
+func inlineFields(res *resource.Resource, user *models.AdminUser) map[string]resource.Field {
+	fields := make(map[string]resource.Field)
+	for _, f := range batchEditFields(res, user) { if f.InlineEditable && f.Type != "tags" { fields[f.Name] = f } }
+	return fields
+}
+
+// recordVersion is a record's UpdatedAt, which inline edits send back to detect conflicting saves; empty when the
+// model has none.
+func recordVersion(item reflect.Value) string {
+	fv := fieldValue(item, "UpdatedAt")
+	if !fv.IsValid() { return "" }
+	if t, ok := fv.Interface().(time.Time); ok && !t.IsZero() { return t.Format(time.RFC3339Nano) }
+	return ""
+}
+
+// inlineValue is a field's value as its inline editor starts with it, in the text a form field would submit.
+func inlineValue(f resource.Field, item reflect.Value) string {
+	fv := fieldValue(item, f.Name)
+	if !fv.IsValid() { return "" }
+	if input, _, ok := formatTypedField(f, fv.Interface()); ok { return input }
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() { return "" }
+		fv = fv.Elem()
+	}
+	return fmt.Sprint(fv.Interface())
+}
+
+// setInlineCells gives the list rows of rows the input values of their inline editable cells, under "__inline", and
+// their version, under "__version".
+func setInlineCells(data []map[string]interface{}, rows reflect.Value, fields map[string]resource.Field) {
+	for i := range data {
+		item := rows.Index(i)
+		values := make(map[string]string, len(fields))
+		for name, f := range fields { values[name] = inlineValue(f, item) }
+		data[i]["__inline"], data[i]["__version"] = values, recordVersion(item)
+	}
+}
+
+// inlineCell renders f's list cell for item as the list does, for the response to an inline edit.
+func (reg *Registry) inlineCell(res *resource.Resource, f resource.Field, item reflect.Value, user *models.AdminUser) inlineResult {
+	m := reg.itemToMap(res, res.VisibleFields(user), item, user)
+	cell := inlineResult{Value: inlineValue(f, item), Version: recordVersion(item)}
+	if html, ok := m[f.Name+"__html"].(template.HTML); ok && html != "" {
+		cell.HTML = html
+	} else if v := m[f.Name]; v != nil {
+		cell.HTML = template.HTML(template.HTMLEscapeString(fmt.Sprint(v)))
+	}
+	return cell
+}
+
+// handleInlineUpdate serves PATCH /<resource>/inline_update with a JSON {id, field, value, version}, a list cell
+// edited in place. The value is parsed and checked as the form does and saved through the resource's save hooks and
+// scope, but only the columns that changed are written. version is the UpdatedAt the list was rendered with; if the
+// record has been saved since, nothing is written and the answer is a 409 with the record's current value.
+func (reg *Registry) handleInlineUpdate(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "PATCH" && r.Method != "POST" { writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed"); return }
+	var body struct {
+		ID      interface{} `json:"id"`
+		Field   string      `json:"field"`
+		Value   interface{} `json:"value"`
+		Version string      `json:"version"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil { writeJSONError(w, http.StatusBadRequest, "the body must be a JSON object: "+err.Error()); return }
+	id, idOK := jsonText(body.ID)
+	value, valueOK := jsonText(body.Value)
+	if !idOK || id == "" || !valueOK { writeJSONError(w, http.StatusBadRequest, "id and value must be strings, numbers or booleans"); return }
+	f, ok := inlineFields(res, user)[body.Field]
+	if !ok { writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%q cannot be edited inline", body.Field)); return }
+	if f.Required && strings.TrimSpace(value) == "" { writeJSONError(w, http.StatusUnprocessableEntity, f.Label+" is required"); return }
+	if len(f.Options) > 0 && value != "" && !slices.Contains(f.Options, value) { writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%q is not a valid %s", value, f.Label)); return }
+
+	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
+	elem := reflect.ValueOf(model).Elem()
+	var changes map[string]FieldChange
+	var note string
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		q, err := reg.whereKey(reg.scope(r.Context(), res, tx), res, id)
+		if err != nil { return err }
+		if err := q.First(model).Error; err != nil { return err }
+		if body.Version != "" && recordVersion(elem) != body.Version { return errInlineConflict }
+		before := rawValues(res, elem)
+		if err := setFormValue(f, settableField(elem, f.Name), value); err != nil { return formError{fmt.Errorf("%q is not a valid %s", value, f.Label)} }
+		// A changed parent must still allow its dependent fields' values, as on the form.
+		if err := dependentError(tx, res, user, elem); err != nil { return formError{err} }
+		if _, changed := changedFields(res, before, rawValues(res, elem))[f.Name]; !changed { return nil }
+		stampUser(res, elem, user, false)
+		if err := runSaveHooks(res.BeforeSave, tx, user, model, false); err != nil { return formError{err} }
+		if err := reg.checkTreeParent(tx, res, elem); err != nil { return formError{err} }
+		// Writing only what changed leaves the other columns as they are, even if they were saved meanwhile.
+		changes = changedFields(res, before, rawValues(res, elem))
+		columns := make([]string, 0, len(changes)+1)
+		for name := range changes { columns = append(columns, name) }
+		if fieldValue(elem, "UpdatedAt").IsValid() { columns = append(columns, "UpdatedAt") }
+		if err := tx.Model(model).Select(columns).Updates(model).Error; err != nil { return err }
+		if err := runSaveHooks(res.AfterSave, tx, user, model, false); err != nil { return formError{err} }
+		if err := reg.checkScope(tx, res, id); err != nil { return formError{err} }
+		note = changesNote(res, changes, false) + " (inline)"
+		return reg.recordAction(tx, user, res.Slug, id, "Update", note)
+	})
+	var fe formError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeJSONError(w, http.StatusNotFound, "not found"); return
+	case errors.Is(err, errInlineConflict):
+		cell := reg.inlineCell(res, f, elem, user)
+		cell.Error = err.Error()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(cell)
+		return
+	case errors.As(err, &fe):
+		writeJSONError(w, http.StatusUnprocessableEntity, fe.Error()); return
+	case err != nil:
+		reg.log(r.Context()).Error("inline update failed", "resource", res.Slug, "id", id, "field", f.Name, "user", user.Email, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not save the change"); return
+	}
+	if note != "" {
+		reg.afterAuditChanges(user, res.Slug, id, "Update", note, changes)
+		reg.notifyChange(user, res.Slug, "update", id, changes)
+		// Read the record back for the display value and version as stored, with any changes the hooks made.
+		if q, err := reg.whereKey(reg.scope(r.Context(), res, reg.resourceDB(r.Context(), res)), res, id); err == nil { q.First(model) }
+	}
+	writeJSON(w, reg.inlineCell(res, f, elem, user))
+}
@@ -0,0 +1,241 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonEnvelope is the body of the list and show pages' JSON form (format=json): the records under data, and under
+// meta the fields serialized, the paging of a list, and warnings about parameters that were ignored.
+type jsonEnvelope struct {
+	Data interface{} `json:"data"`
+	Meta jsonMeta    `json:"meta"`
+}
+
+type jsonMeta struct {
+	Fields     []string `json:"fields"`
+	Include    []string `json:"include,omitempty"`
+	Page       int      `json:"page,omitempty"`
+	PerPage    int      `json:"per_page,omitempty"`
+	Total      *int64   `json:"total,omitempty"`
+	TotalPages int      `json:"total_pages,omitempty"`
+	// Next and Prev are the after and before cursors of a CursorPagination resource's neighbouring pages.
+	Next     string   `json:"next,omitempty"`
+	Prev     string   `json:"prev,omitempty"`
+	Warnings []string `json:"warnings"`
+}
+
+// wantsJSON reports whether a list or show request asks for the JSON form.
+func wantsJSON(r *http.Request) bool { return r.URL.Query().Get("format") == "json" }
+
+// jsonFields resolves the fields= selection against the fields user may see. Names that are unknown, or that user
+// may not see, are dropped with the same warning, so a selection can't probe for hidden fields; without a
+// selection the view's fields are used.
+func jsonFields(r *http.Request, res *resource.Resource, user *models.AdminUser, view []resource.Field, meta *jsonMeta) []resource.Field {
+	fields := view
+	if sel := r.URL.Query().Get("fields"); sel != "" {
+		visible := res.VisibleFields(user)
+		fields = nil
+		for _, name := range strings.Split(sel, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" { continue }
+			found := false
+			for _, f := range visible { if f.Name == name { fields, found = append(fields, f), true; break } }
+			if !found { meta.Warnings = append(meta.Warnings, fmt.Sprintf("unknown field %q", name)) }
+		}
+	}
+	meta.Fields = make([]string, len(fields))
+	for i, f := range fields { meta.Fields[i] = f.Name }
+	return fields
+}
+
+// jsonInclude is a BelongsTo association embedded in each record by include=.
+type jsonInclude struct {
+	name       string // as requested: the association's name, or its name without the "ID" suffix
+	label      string // the association's label
+	local, ref string // the record's field holding the key, and the target's field it refers to
+	target     *resource.Resource
+	fields     []resource.Field
+	objects    map[string]map[string]interface{} // the loaded target records by key
+}
+
+// jsonIncludes resolves include= to BelongsTo associations user may follow: the local key must be a field user
+// may see and the target a resource user may view. Anything else is dropped with a warning.
+func (reg *Registry) jsonIncludes(r *http.Request, res *resource.Resource, user *models.AdminUser, meta *jsonMeta) []*jsonInclude {
+	var includes []*jsonInclude
+	visible := make(map[string]bool)
+	for _, f := range res.VisibleFields(user) { visible[f.Name] = true }
+	for _, name := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if name = strings.TrimSpace(name); name == "" { continue }
+		inc := reg.belongsToInclude(res, name, user, visible)
+		if inc == nil { meta.Warnings = append(meta.Warnings, fmt.Sprintf("unknown association %q", name)); continue }
+		inc.fields = inc.target.GetFieldsForUser("show", user)
+		includes = append(includes, inc)
+		meta.Include = append(meta.Include, name)
+	}
+	return includes
+}
+
+// belongsToInclude resolves name to a BelongsTo association of res user may follow, with no fields yet, or nil.
+// visible holds the names of the fields of res user may see, one of which must be the local key.
+func (reg *Registry) belongsToInclude(res *resource.Resource, name string, user *models.AdminUser, visible map[string]bool) *jsonInclude {
+	for _, a := range res.Associations {
+		if a.Type != "BelongsTo" || (a.Name != name && strings.TrimSuffix(a.Name, "ID") != name) { continue }
+		local := a.Name
+		if !fieldValue(reflect.New(reflect.TypeOf(res.Model)), local).IsValid() { local = a.Name + "ID" }
+		target, ok := reg.GetResource(a.ResourceName)
+		if !ok || !visible[local] || !reg.IsAllowed(user.Role, target.Slug, "show") { return nil }
+		ref := a.ForeignKey
+		if ref == "" { ref = target.PrimaryKey }
+		return &jsonInclude{name: name, label: a.Label, local: local, ref: ref, target: target}
+	}
+	return nil
+}
+
+// loadIncludes fetches every included association's records for rows in one query per association, within the
+// target's scope.
+func (reg *Registry) loadIncludes(ctx context.Context, db *gorm.DB, includes []*jsonInclude, rows reflect.Value) error {
+	for _, inc := range includes {
+		var keys []interface{}
+		seen := make(map[string]bool)
+		for i := 0; i < rows.Len(); i++ {
+			v := reflect.Indirect(fieldValue(rows.Index(i), inc.local))
+			if !v.IsValid() || v.IsZero() { continue }
+			if k := fmt.Sprint(v.Interface()); !seen[k] { seen[k] = true; keys = append(keys, v.Interface()) }
+		}
+		inc.objects = make(map[string]map[string]interface{})
+		if len(keys) == 0 { continue }
+		sch, err := reg.parseSchema(inc.target.Model)
+		if err != nil { return err }
+		col, ok := column(sch, inc.ref)
+		if !ok { return fmt.Errorf("association %q: cannot resolve key %q", inc.name, inc.ref) }
+		dest := reflect.New(inc.target.Meta().SliceType)
+		if err := reg.scope(ctx, inc.target, db).Where(col+" IN ?", keys).Find(dest.Interface()).Error; err != nil { return err }
+		objects, err := reg.jsonRecords(db, inc.target, inc.fields, dest.Elem(), nil, CurrentUser(ctx))
+		if err != nil { return err }
+		for i, obj := range objects {
+			if v := reflect.Indirect(fieldValue(dest.Elem().Index(i), inc.ref)); v.IsValid() { inc.objects[fmt.Sprint(v.Interface())] = obj }
+		}
+	}
+	return nil
+}
+
+// jsonRecords serializes rows to their fields' raw values, keyed by field name and always carrying the record's
+// key as "id"; included associations are embedded under their requested name, null when there is none.
+func (reg *Registry) jsonRecords(db *gorm.DB, res *resource.Resource, fields []resource.Field, rows reflect.Value, includes []*jsonInclude, user *models.AdminUser) ([]map[string]interface{}, error) {
+	counts, err := reg.relatedCounts(db, res, fields, rows)
+	if err != nil { return nil, err }
+	records := make([]map[string]interface{}, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		item := reflect.Indirect(rows.Index(i))
+		key := recordKey(res, item)
+		rec := map[string]interface{}{"id": key}
+		var raw map[string]interface{}
+		for _, f := range fields {
+			switch {
+			case f.CountOf != "":
+				rec[f.Name] = counts[f.Name][fmt.Sprint(key)]
+			case f.Virtual:
+				if raw == nil { raw = rawValues(res, item) }
+				if f.Compute != nil { rec[f.Name] = f.Compute(db, raw) } else { rec[f.Name] = nil }
+			default:
+				fv := res.Meta().Value(item, f.Name)
+				if !fv.IsValid() { continue }
+				val := fv.Interface()
+				if fv.Kind() == reflect.Ptr { val = nil; if !fv.IsNil() { val = fv.Elem().Interface() } }
+				if f.Type == "tags" { val = tagValues(fv.Interface()) }
+				if f.Encrypted { val = reg.jsonEncrypted(f, user, fv.Interface()) }
+				if s, ok := val.(string); ok && s != "" && (f.Type == "image" || f.Type == "file") { val = reg.uploadLink(s) }
+				rec[f.Name] = val
+			}
+		}
+		for _, inc := range includes {
+			var obj map[string]interface{}
+			if v := reflect.Indirect(fieldValue(item, inc.local)); v.IsValid() { obj = inc.objects[fmt.Sprint(v.Interface())] }
+			rec[inc.name] = obj
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// renderListJSON serves GET <resource>?format=json: a page of the list, with its filters, scope and sort.
+func (reg *Registry) renderListJSON(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	meta := jsonMeta{Warnings: []string{}}
+	fields := jsonFields(r, res, user, reg.indexFields(r.Context(), res, user), &meta)
+	includes := reg.jsonIncludes(r, res, user, &meta)
+	lq, err := reg.buildListQuery(r.Context(), res, r.URL.Query())
+	if err != nil { writeJSONError(w, 400, err.Error()); return }
+	// Unlike the page's per_page, the API's doesn't become the user's saved preference.
+	perPage := reg.Config.DefaultPerPage
+	if res.PerPage > 0 { perPage = res.PerPage }
+	if n, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && n > 0 { perPage = n }
+	if reg.Config.MaxPerPage > 0 && perPage > reg.Config.MaxPerPage { perPage = reg.Config.MaxPerPage }
+	if perPage < 1 { perPage = 10 }
+	meta.PerPage = perPage
+	var rows reflect.Value
+	start := time.Now()
+	if res.CursorPagination {
+		var prev, next bool
+		rows, prev, next = lq.Keyset(res.Model, r.URL.Query().Get("after"), r.URL.Query().Get("before"), perPage)
+		if rows.Len() > 0 {
+			if prev { meta.Prev = lq.cursor(rows.Index(0)) }
+			if next { meta.Next = lq.cursor(rows.Index(rows.Len() - 1)) }
+		}
+	} else {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page")); if page < 1 { page = 1 }
+		sortField, sortOrder := r.URL.Query().Get("sort"), r.URL.Query().Get("order")
+		if sortField == "" && res.PositionField != "" { sortField = res.PositionField }
+		if sortField != "" && sortOrder != "desc" { sortOrder = "asc" }
+		lq.Sort(sortField, sortOrder)
+		total := reg.CountFor(r.Context(), res, lq.CountQuery())
+		meta.Page, meta.Total, meta.TotalPages = page, &total, int(math.Ceil(float64(total)/float64(perPage)))
+		dest := reflect.New(res.Meta().SliceType)
+		lq.DB = lq.DB.Offset((page - 1) * perPage).Limit(perPage)
+		if err := lq.Find(dest.Interface()); err != nil { writeJSONError(w, 500, err.Error()); return }
+		rows = dest.Elem()
+	}
+	reg.observeQuery("list", start)
+	db := reg.resourceReader(r.Context(), res)
+	if err := reg.loadIncludes(r.Context(), db, includes, rows); err != nil { reg.log(r.Context()).Error("loading includes failed", "resource", res.Slug, "error", err); writeJSONError(w, 500, "could not load included records"); return }
+	records, err := reg.jsonRecords(db, res, fields, rows, includes, user)
+	if err != nil { reg.log(r.Context()).Error("serializing list failed", "resource", res.Slug, "error", err); writeJSONError(w, 500, "could not load records"); return }
+	writeJSON(w, jsonEnvelope{Data: records, Meta: meta})
+}
+
+// renderShowJSON serves GET <resource>/show?id=&format=json, leaving out fields whose VisibleWhen condition fails.
+func (reg *Registry) renderShowJSON(res *resource.Resource, item interface{}, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	meta := jsonMeta{Warnings: []string{}}
+	fields := jsonFields(r, res, user, res.GetFieldsForUser("show", user), &meta)
+	fields = withoutHidden(fields, res.HiddenByCondition(recordText(reflect.ValueOf(item))))
+	meta.Fields = meta.Fields[:0]
+	for _, f := range fields { meta.Fields = append(meta.Fields, f.Name) }
+	includes := reg.jsonIncludes(r, res, user, &meta)
+	rows := reflect.Append(reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(item)), 0, 1), reflect.ValueOf(item))
+	db := reg.resourceReader(r.Context(), res)
+	if err := reg.loadIncludes(r.Context(), db, includes, rows); err != nil { reg.log(r.Context()).Error("loading includes failed", "resource", res.Slug, "error", err); writeJSONError(w, 500, "could not load included records"); return }
+	records, err := reg.jsonRecords(db, res, fields, rows, includes, user)
+	if err != nil { reg.log(r.Context()).Error("serializing record failed", "resource", res.Slug, "error", err); writeJSONError(w, 500, "could not load the record"); return }
+	writeJSON(w, jsonEnvelope{Data: records[0], Meta: meta})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"reflect"
+)
+
+// keyEntry is the item map entry holding the record key, which templates use for links and form actions.
+const keyEntry = "__id"
+
+// recordKey returns the value of a record's key field, or nil when the model has no such field.
+func recordKey(res *resource.Resource, item reflect.Value) interface{} {
+	fv := res.Meta().Value(item, res.PrimaryKey)
+	if !fv.IsValid() { return nil }
+	return fv.Interface()
+}
+
+// whereKey narrows db to the record of res whose key is id. Keys taken from URLs and forms arrive as strings and are
+// parsed into the key field's type (text-unmarshaled for types such as uuid.UUID); an unparsable key matches nothing.
+func (reg *Registry) whereKey(db *gorm.DB, res *resource.Resource, id interface{}) (*gorm.DB, error) {
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return nil, err }
+	col, ok := column(sch, res.PrimaryKey)
+	if !ok { return nil, fmt.Errorf("admin: %s has no key field %q", res.Name, res.PrimaryKey) }
+	val, err := keyValue(res, id)
+	if err != nil { return nil, gorm.ErrRecordNotFound }
+	return db.Where(col+" = ?", val), nil
+}
+
+func keyValue(res *resource.Resource, id interface{}) (interface{}, error) {
+	s, ok := id.(string)
+	if !ok { return id, nil }
+	t := reflect.TypeOf(res.Model)
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	f, ok := t.FieldByName(res.PrimaryKey)
+	if !ok { return s, nil }
+	v := reflect.New(f.Type)
+	var err error
+	if u, ok := v.Interface().(encoding.TextUnmarshaler); ok { err = u.UnmarshalText([]byte(s)) } else { err = setFieldString(v.Elem(), s) }
+	if err != nil { return nil, err }
+	return v.Elem().Interface(), nil
+}
+
+// keyValues parses record keys from a request, dropping any that can't be keys of res.
+func keyValues(res *resource.Resource, ids []string) []interface{} {
+	var keys []interface{}
+	for _, id := range ids { if v, err := keyValue(res, id); err == nil { keys = append(keys, v) } }
+	return keys
+}
+
+// isIntegerKey reports whether res is keyed by an integer, which the database assigns on create.
+func isIntegerKey(res *resource.Resource) bool {
+	t := reflect.TypeOf(res.Model)
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	f, ok := t.FieldByName(res.PrimaryKey)
+	if !ok { return false }
+	switch f.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
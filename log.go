@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Logger receives the admin's log events: a message followed by alternating keys and values, as with log/slog.
+// *slog.Logger satisfies it; PrintfLogger adapts a *log.Logger or any other Printf-style logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// SetLogger replaces the logger, slog.Default() unless set; nil discards all events.
+func (reg *Registry) SetLogger(l Logger) *Registry {
+	if l == nil { l = slog.New(slog.DiscardHandler) }
+	reg.Logger = l
+	return reg
+}
+
+// log is the registry's logger for the request ctx belongs to, adding the request id RequestLogger assigned.
+func (reg *Registry) log(ctx context.Context) Logger {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok && info.RequestID != "" { return withArgs{reg.Logger, []interface{}{"request_id", info.RequestID}} }
+	return reg.Logger
+}
+
+// withArgs is a Logger adding the same key-value pairs to every event.
+type withArgs struct {
+	Logger
+	args []interface{}
+}
+
+func (l withArgs) Debug(msg string, args ...interface{}) { l.Logger.Debug(msg, append(args, l.args...)...) }
+func (l withArgs) Info(msg string, args ...interface{})  { l.Logger.Info(msg, append(args, l.args...)...) }
+func (l withArgs) Warn(msg string, args ...interface{})  { l.Logger.Warn(msg, append(args, l.args...)...) }
+func (l withArgs) Error(msg string, args ...interface{}) { l.Logger.Error(msg, append(args, l.args...)...) }
+
+// PrintfLogger adapts a Printf-style logger, such as *log.Logger, writing each event on one line as
+// "admin: LEVEL message key=value ...". Debug events are dropped.
+func PrintfLogger(l interface{ Printf(format string, args ...interface{}) }) Logger { return printfLogger{l} }
+
+type printfLogger struct {
+	l interface{ Printf(format string, args ...interface{}) }
+}
+
+func (p printfLogger) Debug(msg string, args ...interface{}) {}
+func (p printfLogger) Info(msg string, args ...interface{})  { p.print("INFO", msg, args) }
+func (p printfLogger) Warn(msg string, args ...interface{})  { p.print("WARN", msg, args) }
+func (p printfLogger) Error(msg string, args ...interface{}) { p.print("ERROR", msg, args) }
+
+func (p printfLogger) print(level, msg string, args []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "admin: %s %s", level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) { fmt.Fprintf(&b, " %v", args[i]); break }
+		v := fmt.Sprint(args[i+1])
+		if strings.ContainsAny(v, " \"=\n") { v = fmt.Sprintf("%q", v) }
+		fmt.Fprintf(&b, " %v=%s", args[i], v)
+	}
+	p.l.Printf("%s", b.String())
+}
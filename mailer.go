@@ -0,0 +1,206 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/config"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Mailer sends email for the admin, e.g. action notifications. Set one with Registry.SetMailer; without one,
+// Config.SMTP is used when its Host is set.
+type Mailer interface {
+	Send(to, subject, htmlBody, textBody string) error
+}
+
+// AttachmentMailer is a Mailer that can also attach a file, which scheduled reports use to send their export;
+// through other mailers reports send a download link instead.
+type AttachmentMailer interface {
+	Mailer
+	SendAttachment(to, subject, htmlBody, textBody string, att Attachment) error
+}
+
+// Attachment is a file attached to an email.
+type Attachment struct {
+	Name, ContentType string
+	Data              []byte
+}
+
+// SMTPMailer sends multipart (HTML and plain text) email through an SMTP server, authenticating when a
+// username is configured.
+type SMTPMailer struct {
+	Config config.SMTPConfig
+}
+
+func NewSMTPMailer(c config.SMTPConfig) *SMTPMailer { return &SMTPMailer{Config: c} }
+
+func (m *SMTPMailer) Send(to, subject, htmlBody, textBody string) error {
+	return m.send(to, subject, htmlBody, textBody, nil)
+}
+
+// SendAttachment sends the email with att attached, as multipart/mixed around the HTML and plain text parts.
+func (m *SMTPMailer) SendAttachment(to, subject, htmlBody, textBody string, att Attachment) error {
+	return m.send(to, subject, htmlBody, textBody, &att)
+}
+
+func (m *SMTPMailer) send(to, subject, htmlBody, textBody string, att *Attachment) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ typ, content string }{{"text/plain", textBody}, {"text/html", htmlBody}} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.typ + "; charset=utf-8"}})
+		if err != nil { return err }
+		pw.Write([]byte(part.content))
+	}
+	mw.Close()
+	payload, contentType := body.Bytes(), "multipart/alternative; boundary="+mw.Boundary()
+	if att != nil {
+		var mixed bytes.Buffer
+		xw := multipart.NewWriter(&mixed)
+		pw, err := xw.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+		if err != nil { return err }
+		pw.Write(payload)
+		name := strings.NewReplacer(`"`, "", "\r", "", "\n", "").Replace(att.Name)
+		pw, err = xw.CreatePart(textproto.MIMEHeader{"Content-Type": {att.ContentType}, "Content-Transfer-Encoding": {"base64"}, "Content-Disposition": {`attachment; filename="` + name + `"`}})
+		if err != nil { return err }
+		enc := base64.StdEncoding.EncodeToString(att.Data)
+		for len(enc) > 76 { pw.Write([]byte(enc[:76] + "\r\n")); enc = enc[76:] }
+		pw.Write([]byte(enc + "\r\n"))
+		xw.Close()
+		payload, contentType = mixed.Bytes(), "multipart/mixed; boundary="+xw.Boundary()
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: %s\r\n\r\n",
+		m.Config.From, to, encodeHeader(subject), time.Now().Format(time.RFC1123Z), contentType)
+	msg.Write(payload)
+	var auth smtp.Auth
+	if m.Config.Username != "" { auth = smtp.PlainAuth("", m.Config.Username, m.Config.Password, m.Config.Host) }
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.Config.Host, m.Config.Port), auth, m.Config.From, []string{to}, msg.Bytes())
+}
+
+// encodeHeader MIME-encodes non-ASCII header values and strips line breaks so they cannot inject headers.
+func encodeHeader(s string) string {
+	s = strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+	for _, c := range s { if c > 127 { return "=?utf-8?q?" + strings.ReplaceAll(qEncode(s), " ", "_") + "?=" } }
+	return s
+}
+
+func qEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c > 127 || c == '=' || c == '?' || c == '_' { fmt.Fprintf(&b, "=%02X", c) } else { b.WriteByte(c) }
+	}
+	return b.String()
+}
+
+// SetMailer sets the mailer used for all admin email.
+func (reg *Registry) SetMailer(m Mailer) {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	reg.mailer = m
+}
+
+func (reg *Registry) getMailer() Mailer {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	if reg.mailer == nil && reg.Config.SMTP.Host != "" { return NewSMTPMailer(reg.Config.SMTP) }
+	return reg.mailer
+}
+
+// renderEmail renders templates/emails/<name>.html, which defines "subject", "html" and "text". The HTML part is
+// escaped as HTML; subject and text are plain text.
+func (reg *Registry) renderEmail(name string, data interface{}) (subject, html, text string, err error) {
+	f, err := reg.readTemplateFile("emails/" + name + ".html")
+	if err != nil { return "", "", "", err }
+	ht, err := htmltemplate.New(name).Parse(string(f.content))
+	if err != nil { return "", "", "", fmt.Errorf("parse %s: %w", f.source, err) }
+	tt, err := texttemplate.New(name).Parse(string(f.content))
+	if err != nil { return "", "", "", fmt.Errorf("parse %s: %w", f.source, err) }
+	var sb, hb, tb bytes.Buffer
+	if err := tt.ExecuteTemplate(&sb, "subject", data); err != nil { return "", "", "", err }
+	if err := ht.ExecuteTemplate(&hb, "html", data); err != nil { return "", "", "", err }
+	if err := tt.ExecuteTemplate(&tb, "text", data); err != nil { return "", "", "", err }
+	return strings.TrimSpace(sb.String()), hb.String(), strings.TrimSpace(tb.String()), nil
+}
+
+// sendEmail renders an email template and sends it to each recipient in the background; failures are logged.
+func (reg *Registry) sendEmail(to []string, name string, data interface{}) {
+	m := reg.getMailer()
+	if m == nil || len(to) == 0 { return }
+	subject, html, text, err := reg.renderEmail(name, data)
+	if err != nil { reg.Logger.Error("email failed", "template", name, "error", err); return }
+	go func() {
+		for _, addr := range to {
+			if err := m.Send(addr, subject, html, text); err != nil { reg.Logger.Error("email failed", "template", name, "to", addr, "error", err) }
+		}
+	}()
+}
+
+// actionNotification emails a role when an audit entry matches; empty Resource or Action match anything.
+type actionNotification struct {
+	Resource, Action, Role string
+}
+
+// NotifyOnAction emails every user with role when an action (e.g. "Create", "Delete" or a custom action's audit
+// name) is recorded on resource. Either may be "" to match all.
+func (reg *Registry) NotifyOnAction(resource, action, role string) {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	reg.notifications = append(reg.notifications, actionNotification{Resource: resource, Action: action, Role: role})
+}
+
+// actionEmail is the data for templates/emails/action_notification.html.
+type actionEmail struct {
+	SiteTitle, Actor, Action, Resource, RecordID, Changes, Link string
+}
+
+// afterAudit runs the side effects of a recorded audit entry, once it is committed: in the background, which
+// shutdown waits for, it emails the roles NotifyOnAction names and the record's watchers, each user once per entry.
+func (reg *Registry) afterAudit(user *models.AdminUser, resName, recordID, action, changes string) {
+	reg.afterAuditChanges(user, resName, recordID, action, changes, nil)
+}
+
+// afterAuditChanges is afterAudit for an entry describing fields, the field changes its note was written from, so
+// watchers who may not see some of those fields are told only about the others.
+func (reg *Registry) afterAuditChanges(user *models.AdminUser, resName, recordID, action, changes string, fields map[string]FieldChange) {
+	reg.goBackground(func(context.Context) { reg.notifyAudit(user, resName, recordID, action, changes, fields) })
+}
+
+func (reg *Registry) notifyAudit(user *models.AdminUser, resName, recordID, action, changes string, fields map[string]FieldChange) {
+	reg.mu.RLock()
+	rules := append([]actionNotification(nil), reg.notifications...)
+	reg.mu.RUnlock()
+	roles := map[string]bool{}
+	for _, n := range rules {
+		if (n.Resource == "" || n.Resource == resName) && (n.Action == "" || strings.EqualFold(n.Action, action)) { roles[n.Role] = true }
+	}
+	watchers := reg.recordWatchers(resName, recordID, action, user)
+	if len(roles) == 0 && len(watchers) == 0 { return }
+	// Watchers get the watch email instead of the role's.
+	watching := make(map[uint]bool, len(watchers))
+	for _, u := range watchers { watching[u.ID] = true }
+	var recipients []string
+	for role := range roles {
+		var users []models.AdminUser
+		reg.DB.Where("role = ?", role).Find(&users)
+		for _, u := range users { if (user == nil || u.ID != user.ID) && !watching[u.ID] { recipients = append(recipients, u.Email) } }
+	}
+	data := actionEmail{SiteTitle: reg.Config.SiteTitle, Action: action, Resource: resName, RecordID: recordID, Changes: changes}
+	if user != nil { data.Actor = user.Email }
+	if res, ok := reg.GetResource(resName); ok {
+		data.Resource = res.Name
+		if recordID != "" && !strings.EqualFold(action, "Delete") { data.Link = reg.absoluteURL(fmt.Sprintf("/%s/show?id=%s", res.Slug, recordID)) }
+	}
+	reg.sendEmail(recipients, "action_notification", data)
+	reg.notifyWatchers(watchers, user, resName, data, fields)
+}
+
+// absoluteURL is reg.URL prefixed with Config.PublicURL, for links that leave the browser (e.g. in email).
+func (reg *Registry) absoluteURL(path string) string {
+	return strings.TrimRight(reg.Config.PublicURL, "/") + reg.URL(path)
+}
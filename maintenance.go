@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceSetting names the Setting row that holds the maintenance message while maintenance mode is on.
+const maintenanceSetting = "maintenance"
+
+// maintenanceSlug is the resource name maintenance mode changes are audited under.
+const maintenanceSlug = "maintenance"
+
+// maintenanceRefresh is how long a process trusts its cached maintenance state before reading the setting again,
+// so a change made by another process applies within it.
+const maintenanceRefresh = 5 * time.Second
+
+// maintenanceCache is a process's copy of the maintenance setting.
+type maintenanceCache struct {
+	mu      sync.Mutex
+	on      bool
+	message string
+	since   time.Time
+	loaded  time.Time
+}
+
+// MaintenanceData is the maintenance page: the admins' switch, or for a write refused during maintenance, the
+// explanation (Blocked).
+type MaintenanceData struct {
+	On           bool
+	Message      string
+	Since        time.Time
+	OverrideRole string
+	Blocked      bool
+}
+
+// SetMaintenance freezes the admin for maintenance: pages show message in a banner, and saves, deletes, batch and
+// unsafe custom actions, inline edits and bulk imports are refused with a 503 for everyone but
+// Config.MaintenanceOverrideRole. The state is stored in the settings table, so it survives restarts and reaches
+// every process within a few seconds. The change is audited as "system".
+func (reg *Registry) SetMaintenance(message string) error { return reg.setMaintenance(systemUser, true, message) }
+
+// ClearMaintenance ends maintenance mode.
+func (reg *Registry) ClearMaintenance() error { return reg.setMaintenance(systemUser, false, "") }
+
+func (reg *Registry) setMaintenance(user *models.AdminUser, on bool, message string) error {
+	message = strings.TrimSpace(message)
+	action, note := "Maintenance off", "Writes allowed again"
+	if on { action, note = "Maintenance on", "Writes frozen: "+message }
+	err := reg.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if on {
+			err = tx.Save(&models.Setting{Name: maintenanceSetting, Value: message}).Error
+		} else {
+			err = tx.Where("name = ?", maintenanceSetting).Delete(&models.Setting{}).Error
+		}
+		if err != nil { return err }
+		return reg.recordAction(tx, user, maintenanceSlug, "", action, note)
+	})
+	if err != nil { return err }
+	c := &reg.maintenance
+	c.mu.Lock()
+	c.on, c.message, c.since, c.loaded = on, message, time.Now(), time.Now()
+	c.mu.Unlock()
+	reg.afterAudit(user, maintenanceSlug, "", action, note)
+	return nil
+}
+
+// maintenanceState reports whether maintenance mode is on, with its message and when it began, reading the setting
+// at most every maintenanceRefresh. A settings table that can't be read counts as off.
+func (reg *Registry) maintenanceState() (bool, string, time.Time) {
+	c := &reg.maintenance
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.loaded) < maintenanceRefresh { return c.on, c.message, c.since }
+	var s models.Setting
+	err := reg.DB.Where("name = ?", maintenanceSetting).Limit(1).Find(&s).Error
+	c.on, c.message, c.since, c.loaded = err == nil && s.Name != "", s.Value, s.UpdatedAt, time.Now()
+	return c.on, c.message, c.since
+}
+
+// maintenanceBlocks reports whether maintenance mode refuses user's writes.
+func (reg *Registry) maintenanceBlocks(user *models.AdminUser) bool {
+	on, _, _ := reg.maintenanceState()
+	return on && !reg.maintenanceOverrides(user)
+}
+
+func (reg *Registry) maintenanceOverrides(user *models.AdminUser) bool {
+	return user != nil && reg.Config.MaintenanceOverrideRole != "" && user.Role == reg.Config.MaintenanceOverrideRole
+}
+
+// maintenanceBanner is the layout's banner text while maintenance mode is on, else "".
+func (reg *Registry) maintenanceBanner() string {
+	on, message, _ := reg.maintenanceState()
+	if !on { return "" }
+	if message == "" { return "The admin is in maintenance mode; changes are paused." }
+	return message
+}
+
+// refuseMaintenance answers a write refused during maintenance: a JSON error for API and script requests, else
+// the maintenance page, both with status 503.
+func (reg *Registry) refuseMaintenance(w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	_, message, since := reg.maintenanceState()
+	reg.log(r.Context()).Warn("write refused during maintenance", "user", user.Email, "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Retry-After", "300")
+	if strings.HasPrefix(strings.TrimPrefix(r.URL.Path, reg.basePath()), "/api/") || wantsJSON(r) || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		msg := "the admin is in maintenance mode; changes are paused"
+		if message != "" { msg += ": " + message }
+		writeJSONError(w, http.StatusServiceUnavailable, msg)
+		return
+	}
+	reg.renderMaintenance(w, r, user, http.StatusServiceUnavailable, &MaintenanceData{On: true, Message: message, Since: since, Blocked: true})
+}
+
+// handleMaintenance serves the admins' maintenance switch at /maintenance; POST /maintenance/on with a message
+// and POST /maintenance/off change it.
+func (reg *Registry) handleMaintenance(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser, role string) {
+	if role != "admin" { http.Error(w, "Forbidden", 403); return }
+	switch upath {
+	case "/maintenance":
+		on, message, since := reg.maintenanceState()
+		reg.renderMaintenance(w, r, user, http.StatusOK, &MaintenanceData{On: on, Message: message, Since: since, OverrideRole: reg.Config.MaintenanceOverrideRole})
+		return
+	case "/maintenance/on", "/maintenance/off":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		on := upath == "/maintenance/on"
+		if err := reg.setMaintenance(user, on, r.FormValue("message")); err != nil { reg.renderError(w, r, 500, err); return }
+		if on { reg.setFlash(w, reg.T(r.Context(), "Maintenance mode is on; writes are frozen")) } else { reg.setFlash(w, reg.T(r.Context(), "Maintenance mode is off")) }
+		http.Redirect(w, r, reg.URL("/maintenance"), 303)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (reg *Registry) renderMaintenance(w http.ResponseWriter, r *http.Request, user *models.AdminUser, status int, data *MaintenanceData) {
+	tmpl, err := reg.loadTemplates("templates/maintenance.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), Maintenance: data,
+		Title: reg.T(r.Context(), "Maintenance"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Maintenance")}),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	reg.execute(w, r, tmpl, "maintenance.html", pd)
+}
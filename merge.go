@@ -0,0 +1,227 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// MergeData is the merge page of a mergeable resource: the record merged into, and once picked the duplicate merged
+// away, their fields side by side and the duplicate's children that will move. Blocked explains why the resource's
+// records can't be merged.
+type MergeData struct {
+	ID, DuplicateID string
+	Label, DuplicateLabel string
+	Fields   []MergeField
+	Children []MergeChildren
+	Blocked  []string
+	Error    string
+}
+
+// MergeField is a row of the merge comparison: a field's display value in each record, and whether they differ.
+type MergeField struct {
+	Field             resource.Field
+	Value, Duplicate  template.HTML
+	Differs, KeepDuplicate bool
+}
+
+// MergeChildren is how many of the duplicate's records a HasMany association moves to the record merged into.
+type MergeChildren struct {
+	Label string
+	Count int64
+}
+
+// mergeChild is a HasMany association a merge moves children through: its resource and foreign key column.
+type mergeChild struct {
+	assoc  resource.Association
+	target *resource.Resource
+	pk, fk string // qualified key and foreign key columns
+	set    string // the foreign key column, unqualified for an UPDATE's SET
+}
+
+// mergeFields are the fields a merge lets user choose between the two records' values for: those batch edits may
+// set, which leaves out uploads, passwords and fields a save hook or parent computes, less the key.
+func mergeFields(res *resource.Resource, user *models.AdminUser) []resource.Field {
+	var fields []resource.Field
+	for _, f := range batchEditFields(res, user) { if f.Name != res.PrimaryKey { fields = append(fields, f) } }
+	return fields
+}
+
+// mergeChildren resolves res's HasMany associations to the columns a merge re-points, and explains each that it
+// can't: one without a foreign key, or to an unknown resource or one on a different database, which the merge's
+// transaction couldn't include.
+func (reg *Registry) mergeChildren(res *resource.Resource) ([]mergeChild, []string) {
+	var children []mergeChild
+	var blocked []string
+	for _, a := range res.Associations {
+		if a.Type != "HasMany" { continue }
+		target, ok := reg.GetResource(a.ResourceName)
+		if !ok { blocked = append(blocked, fmt.Sprintf("%s links to unknown resource %q.", a.Label, a.ResourceName)); continue }
+		if !reg.sameDatabase(res, target) { blocked = append(blocked, fmt.Sprintf("%s are on a different database, so they can't be moved in the same transaction.", a.Label)); continue }
+		sch, err := reg.parseSchema(target.Model)
+		if err != nil { blocked = append(blocked, fmt.Sprintf("%s: %v", a.Label, err)); continue }
+		fk := sch.LookUpField(a.ForeignKey)
+		pk, pkOK := column(sch, target.PrimaryKey)
+		if a.ForeignKey == "" || fk == nil || fk.DBName == "" || !pkOK {
+			blocked = append(blocked, fmt.Sprintf("%s have no known foreign key, so they can't be moved to the record kept; set the association's ForeignKey.", a.Label))
+			continue
+		}
+		children = append(children, mergeChild{assoc: a, target: target, pk: pk, fk: sch.Table + "." + fk.DBName, set: fk.DBName})
+	}
+	return children, blocked
+}
+
+// keys are the keys of the records of c referring to key, trashed ones included so they stay attached if
+// restored.
+func (c mergeChild) keys(db *gorm.DB, key interface{}) ([]interface{}, error) {
+	var keys []interface{}
+	err := db.Unscoped().Model(reflect.New(reflect.TypeOf(c.target.Model)).Interface()).Where(c.fk+" = ?", key).Order(c.pk).Pluck(c.pk, &keys).Error
+	return keys, err
+}
+
+// mergeCell is a field's display HTML in an itemToMap row, as the show page renders it.
+func mergeCell(m map[string]interface{}, name string) template.HTML {
+	if h, ok := m[name+"__html"].(template.HTML); ok && h != "" { return h }
+	if v := m[name]; v != nil { return template.HTML(template.HTMLEscapeString(fmt.Sprint(v))) }
+	return ""
+}
+
+// handleMerge serves /<resource>/merge?id=A for mergeable resources. Without with it offers a search for the
+// duplicate; GET with with=B compares the two records, and POST merges B into A, keeping B's value of each field
+// posted as keep_<Field>=duplicate. The merge runs in one transaction through the save and delete hooks and is
+// audited on A, listing the fields taken from B and every child moved, and on B as its deletion.
+func (reg *Registry) handleMerge(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if !res.Mergeable { reg.renderError(w, r, http.StatusNotFound, nil); return }
+	item, err := reg.getContext(r.Context(), res.Slug, r.URL.Query().Get("id"))
+	if err != nil { reg.renderRecordError(w, r, err); return }
+	elem := reflect.Indirect(reflect.ValueOf(item))
+	id := fmt.Sprint(recordKey(res, elem))
+	children, blocked := reg.mergeChildren(res)
+	data := &MergeData{ID: id, Label: recordLabel(res, elem), Blocked: blocked}
+	fields := mergeFields(res, user)
+	var dup interface{}
+	if with := r.URL.Query().Get("with"); with != "" {
+		if dup, err = reg.getContext(r.Context(), res.Slug, with); err != nil { reg.renderRecordError(w, r, err); return }
+		dupElem := reflect.Indirect(reflect.ValueOf(dup))
+		data.DuplicateID, data.DuplicateLabel = fmt.Sprint(recordKey(res, dupElem)), recordLabel(res, dupElem)
+		if data.DuplicateID == id { data.Error, data.DuplicateID, dup = reg.T(r.Context(), "A record can't be merged with itself; pick its duplicate."), "", nil }
+	}
+	if dup != nil {
+		m, dm := reg.itemToMap(res, fields, elem, user), reg.itemToMap(res, fields, reflect.ValueOf(dup), user)
+		before, other := rawValues(res, elem), rawValues(res, reflect.Indirect(reflect.ValueOf(dup)))
+		for _, f := range fields {
+			differs := fmt.Sprint(before[f.Name]) != fmt.Sprint(other[f.Name])
+			data.Fields = append(data.Fields, MergeField{Field: f, Value: mergeCell(m, f.Name), Duplicate: mergeCell(dm, f.Name), Differs: differs, KeepDuplicate: differs && r.FormValue("keep_"+f.Name) == "duplicate"})
+		}
+		for _, c := range children {
+			keys, err := c.keys(reg.resourceDB(r.Context(), res), recordKey(res, reflect.Indirect(reflect.ValueOf(dup))))
+			if err != nil { reg.renderError(w, r, 500, err); return }
+			data.Children = append(data.Children, MergeChildren{Label: c.assoc.Label, Count: int64(len(keys))})
+		}
+	}
+	if r.Method == "POST" && dup != nil && len(blocked) == 0 {
+		err := reg.mergeRecords(r, res, data, children, user)
+		var fe formError
+		switch {
+		case err == nil:
+			reg.setFlash(w, reg.T(r.Context(), "%s merged into %s", data.DuplicateLabel, data.Label))
+			http.Redirect(w, r, reg.recordURL(res, id), 303)
+			return
+		case errors.As(err, &fe):
+			data.Error = fe.Error()
+		default:
+			reg.renderRecordError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/merge.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	title := reg.T(r.Context(), "Merge")
+	reg.execute(w, r, tmpl, "merge.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		CurrentResource: res, User: user, CSS: reg.styleCSS(), Merge: data,
+		Title: title, Breadcrumbs: reg.recordCrumbs(r.Context(), res, item, nil, title),
+	})
+}
+
+// mergeRecords merges data's duplicate into its record in one transaction: the chosen fields are copied, the
+// duplicate's children moved and the duplicate deleted, then the record saved. The record and the duplicate are
+// loaded again inside it through the user's scope.
+func (reg *Registry) mergeRecords(r *http.Request, res *resource.Resource, data *MergeData, children []mergeChild, user *models.AdminUser) error {
+	model := reflect.New(reflect.TypeOf(res.Model)).Interface()
+	elem := reflect.ValueOf(model).Elem()
+	var changes map[string]FieldChange
+	var note string
+	err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		load := func(id string, dest interface{}) error {
+			q, err := reg.whereKey(reg.scope(r.Context(), res, tx), res, id)
+			if err != nil { return err }
+			return q.First(dest).Error
+		}
+		dup := reflect.New(reflect.TypeOf(res.Model))
+		if err := load(data.ID, model); err != nil { return err }
+		if err := load(data.DuplicateID, dup.Interface()); err != nil { return err }
+		before := rawValues(res, elem)
+		var kept []string
+		for _, f := range data.Fields {
+			if !f.KeepDuplicate { continue }
+			dst := settableField(elem, f.Field.Name)
+			if !dst.IsValid() { continue }
+			dst.Set(fieldValue(dup.Elem(), f.Field.Name))
+			kept = append(kept, f.Field.Name)
+		}
+		if err := dependentError(tx, res, user, elem); err != nil { return formError{err} }
+
+		key, dupKey := recordKey(res, elem), recordKey(res, dup.Elem())
+		var moved []string
+		for _, c := range children {
+			keys, err := c.keys(tx, dupKey)
+			if err != nil { return err }
+			if len(keys) == 0 { continue }
+			if err := tx.Unscoped().Model(reflect.New(reflect.TypeOf(c.target.Model)).Interface()).Where(c.pk+" IN ?", keys).Update(c.set, key).Error; err != nil { return err }
+			ids := make([]string, len(keys))
+			for i, k := range keys { ids[i] = "#" + fmt.Sprint(k) }
+			moved = append(moved, fmt.Sprintf("%s %s", c.assoc.Label, strings.Join(ids, ", ")))
+		}
+
+		// The duplicate goes first, so values unique to it, such as an email, are free for the record kept.
+		if err := runDeleteHooks(res, tx, user, data.DuplicateID); err != nil { return formError{err} }
+		if err := reg.releaseTreeChildren(tx, res, data.DuplicateID); err != nil { return formError{err} }
+		q, err := reg.whereKey(tx, res, data.DuplicateID)
+		if err != nil { return err }
+		if err := q.Delete(reflect.New(reflect.TypeOf(res.Model)).Interface()).Error; err != nil { return err }
+
+		stampUser(res, elem, user, false)
+		if err := runSaveHooks(res.BeforeSave, tx, user, model, false); err != nil { return formError{err} }
+		changes = changedFields(res, before, rawValues(res, elem))
+		if len(changes) > 0 {
+			columns := make([]string, 0, len(changes)+1)
+			for name := range changes { columns = append(columns, name) }
+			if fieldValue(elem, "UpdatedAt").IsValid() { columns = append(columns, "UpdatedAt") }
+			if err := tx.Model(model).Select(columns).Updates(model).Error; err != nil { return err }
+		}
+		if err := runSaveHooks(res.AfterSave, tx, user, model, false); err != nil { return formError{err} }
+		if err := reg.checkScope(tx, res, data.ID); err != nil { return formError{err} }
+
+		note = fmt.Sprintf("Merged #%s (%s) into this record", data.DuplicateID, data.DuplicateLabel)
+		if len(kept) > 0 { note += "; kept its " + strings.Join(kept, ", ") }
+		if len(moved) > 0 { note += "; moved " + strings.Join(moved, "; ") }
+		if len(changes) > 0 { note += "\n" + changesNote(res, changes, false) }
+		if err := reg.recordAction(tx, user, res.Slug, data.ID, "Merge", note); err != nil { return err }
+		return reg.recordAction(tx, user, res.Slug, data.DuplicateID, "Delete", "Merged into #"+data.ID)
+	})
+	if err != nil { return err }
+	reg.afterAuditChanges(user, res.Slug, data.ID, "Merge", note, changes)
+	reg.afterAudit(user, res.Slug, data.DuplicateID, "Delete", "Merged into #"+data.ID)
+	reg.notifyChange(user, res.Slug, "update", data.ID, changes)
+	reg.notifyChange(user, res.Slug, "delete", data.DuplicateID, nil)
+	return nil
+}
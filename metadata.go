@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"reflect"
+	"time"
+)
+
+// RecordMetadata is the show page's panel of when, and by whom, a record was created and last updated.
+type RecordMetadata struct {
+	Created, Updated MetaStamp
+}
+
+// MetaStamp is one line of the metadata panel; At is zero, or By empty, when the model doesn't track it.
+type MetaStamp struct {
+	At  time.Time
+	Ago string
+	// By is the user's email, or "User #N" once the user is deleted; ByURL links to them on the Users page for admins.
+	By, ByURL string
+}
+
+// stampUser fills a record's TrackUserStamps columns with the acting user's id: both on create, the updater's on update.
+func stampUser(res *resource.Resource, item reflect.Value, user *models.AdminUser, isNew bool) {
+	if user == nil { return }
+	set := func(name string) {
+		field := settableField(item, name)
+		if !field.CanSet() { return }
+		if field.Kind() == reflect.Ptr {
+			v := reflect.New(field.Type().Elem())
+			field.Set(v); field = v.Elem()
+		}
+		if field.CanUint() { field.SetUint(uint64(user.ID)) } else if field.CanInt() { field.SetInt(int64(user.ID)) }
+	}
+	if isNew && res.CreatedByField != "" { set(res.CreatedByField) }
+	if res.UpdatedByField != "" { set(res.UpdatedByField) }
+}
+
+// recordMetadata reads a record's CreatedAt and UpdatedAt and its TrackUserStamps users for the show page, or nil
+// when the resource hides the panel or tracks none of them.
+func (reg *Registry) recordMetadata(db *gorm.DB, res *resource.Resource, item reflect.Value, viewer *models.AdminUser) (*RecordMetadata, error) {
+	if res.MetadataHidden { return nil, nil }
+	at := func(name string) time.Time {
+		switch v := fieldValue(item, name); {
+		case !v.IsValid():
+		case v.Type() == reflect.TypeOf(time.Time{}):
+			return v.Interface().(time.Time)
+		case v.Type() == reflect.TypeOf(&time.Time{}) && !v.IsNil():
+			return *v.Interface().(*time.Time)
+		}
+		return time.Time{}
+	}
+	by := func(name string) interface{} {
+		if name == "" { return nil }
+		v := reflect.Indirect(fieldValue(item, name))
+		if !v.IsValid() || v.IsZero() { return nil }
+		return v.Interface()
+	}
+	m := &RecordMetadata{Created: MetaStamp{At: at("CreatedAt")}, Updated: MetaStamp{At: at("UpdatedAt")}}
+	createdBy, updatedBy := by(res.CreatedByField), by(res.UpdatedByField)
+	if m.Created.At.IsZero() && m.Updated.At.IsZero() && createdBy == nil && updatedBy == nil { return nil, nil }
+	var ids []interface{}
+	for _, id := range []interface{}{createdBy, updatedBy} { if id != nil { ids = append(ids, id) } }
+	emails := make(map[string]string)
+	if len(ids) > 0 {
+		var users []models.AdminUser
+		if err := db.Where("id IN ?", ids).Find(&users).Error; err != nil { return nil, err }
+		for _, u := range users { emails[fmt.Sprint(u.ID)] = u.Email }
+	}
+	now := time.Now()
+	for _, s := range []struct {
+		stamp *MetaStamp
+		id    interface{}
+	}{{&m.Created, createdBy}, {&m.Updated, updatedBy}} {
+		if !s.stamp.At.IsZero() { s.stamp.Ago = timeAgo(now.Sub(s.stamp.At)) }
+		if s.id == nil { continue }
+		id := fmt.Sprint(s.id)
+		if s.stamp.By = emails[id]; s.stamp.By == "" { s.stamp.By = "User #" + id }
+		if viewer != nil && viewer.Role == "admin" { s.stamp.ByURL = reg.URL("/" + usersSlug + "/show?id=" + id) }
+	}
+	return m, nil
+}
@@ -0,0 +1,170 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives instrumentation events from the admin. Plug in your own implementation
+// through Registry.Metrics; if it also implements http.Handler it is served at <base path>/metrics.
+type MetricsCollector interface {
+	ObserveRequest(resource, action string, status int, d time.Duration)
+	ObserveQuery(kind string, d time.Duration)
+	ObserveLogin(success bool)
+	AddExportRows(resource string, n int)
+	SetActiveSessions(n int64)
+}
+
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range defaultBuckets { if v <= b { h.counts[i]++ } }
+	h.sum += v; h.count++
+}
+
+// PrometheusMetrics is the built-in collector, exposing everything in the Prometheus text format.
+type PrometheusMetrics struct {
+	mu             sync.Mutex
+	requests       map[string]float64
+	requestTimes   map[string]*histogram
+	queryTimes     map[string]*histogram
+	logins         map[string]float64
+	exportRows     map[string]float64
+	activeSessions int64
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		requests: make(map[string]float64), requestTimes: make(map[string]*histogram), queryTimes: make(map[string]*histogram),
+		logins: make(map[string]float64), exportRows: make(map[string]float64),
+	}
+}
+
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func observeInto(m map[string]*histogram, key string, d time.Duration) {
+	h, ok := m[key]
+	if !ok { h = &histogram{counts: make([]uint64, len(defaultBuckets))}; m[key] = h }
+	h.observe(d.Seconds())
+}
+
+func (p *PrometheusMetrics) ObserveRequest(resource, action string, status int, d time.Duration) {
+	p.mu.Lock(); defer p.mu.Unlock()
+	p.requests[labels("resource", resource, "action", action, "status", fmt.Sprint(status))]++
+	observeInto(p.requestTimes, labels("resource", resource, "action", action), d)
+}
+
+func (p *PrometheusMetrics) ObserveQuery(kind string, d time.Duration) {
+	p.mu.Lock(); defer p.mu.Unlock()
+	observeInto(p.queryTimes, labels("query", kind), d)
+}
+
+func (p *PrometheusMetrics) ObserveLogin(success bool) {
+	p.mu.Lock(); defer p.mu.Unlock()
+	result := "failure"; if success { result = "success" }
+	p.logins[labels("result", result)]++
+}
+
+func (p *PrometheusMetrics) AddExportRows(resource string, n int) {
+	p.mu.Lock(); defer p.mu.Unlock()
+	p.exportRows[labels("resource", resource)] += float64(n)
+}
+
+func (p *PrometheusMetrics) SetActiveSessions(n int64) {
+	p.mu.Lock(); defer p.mu.Unlock()
+	p.activeSessions = n
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m { keys = append(keys, k) }
+	sort.Strings(keys)
+	return keys
+}
+
+func writeCounter(w io.Writer, name, help string, m map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, k := range sortedKeys(m) { fmt.Fprintf(w, "%s{%s} %g\n", name, k, m[k]) }
+}
+
+func writeHistogram(w io.Writer, name, help string, m map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, k := range sortedKeys(m) {
+		h := m[k]
+		for i, b := range defaultBuckets { fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, k, b, h.counts[i]) }
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, k, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n%s_count{%s} %d\n", name, k, h.sum, name, k, h.count)
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock(); defer p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeCounter(w, "goadmin_requests_total", "Admin requests by resource, action and status.", p.requests)
+	writeHistogram(w, "goadmin_request_duration_seconds", "Admin request duration.", p.requestTimes)
+	writeHistogram(w, "goadmin_query_duration_seconds", "Duration of list and count queries.", p.queryTimes)
+	writeCounter(w, "goadmin_logins_total", "Login attempts by result.", p.logins)
+	writeCounter(w, "goadmin_export_rows_total", "Rows written to CSV exports.", p.exportRows)
+	fmt.Fprintf(w, "# HELP goadmin_active_sessions Unexpired admin sessions.\n# TYPE goadmin_active_sessions gauge\ngoadmin_active_sessions %d\n", p.activeSessions)
+}
+
+// metrics returns the collector when metrics are enabled, or nil.
+func (reg *Registry) metrics() MetricsCollector {
+	if !reg.Config.EnableMetrics { return nil }
+	return reg.Metrics
+}
+
+func (reg *Registry) observeQuery(kind string, start time.Time) {
+	if m := reg.metrics(); m != nil { m.ObserveQuery(kind, time.Since(start)) }
+}
+
+// instrument records request counts and durations, using the resource and action resolved while routing.
+func (reg *Registry) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := reg.metrics()
+		if m == nil { next.ServeHTTP(w, r); return }
+		info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo)
+		if !ok { info = &requestInfo{}; r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)) }
+		start, rec := time.Now(), &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 { rec.status = http.StatusOK }
+		m.ObserveRequest(info.Resource, info.Action, rec.status, time.Since(start))
+	})
+}
+
+// handleMetrics serves the collector, guarded by Config.MetricsToken when set or by the "metrics" permission otherwise.
+func (reg *Registry) handleMetrics(w http.ResponseWriter, r *http.Request, user *models.AdminUser, role string) {
+	m := reg.metrics()
+	handler, ok := m.(http.Handler)
+	if m == nil || !ok { http.NotFound(w, r); return }
+	if token := reg.Config.MetricsToken; token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 { http.Error(w, "Unauthorized", 401); return }
+	} else if user == nil || !reg.IsAllowed(role, "metrics", "view") {
+		http.Error(w, "Forbidden", 403); return
+	}
+	if sessions, err := reg.sessions().CountActive(r.Context()); err == nil { m.SetActiveSessions(sessions) }
+	handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps the admin handler; see Registry.Use.
+type Middleware func(http.Handler) http.Handler
+
+type requestInfoKey struct{}
+
+// requestInfo is filled in while routing so outer middlewares can see who made the request and what it hit.
+type requestInfo struct {
+	RequestID string
+	UserEmail string
+	Resource  string
+	Action    string
+}
+
+// statusRecorder captures the response status for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) { sr.status = code; sr.ResponseWriter.WriteHeader(code) }
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 { sr.status = http.StatusOK }
+	return sr.ResponseWriter.Write(b)
+}
+
+// Use appends middlewares around the admin. They run in registration order, the first being outermost,
+// and before authentication so they can reject traffic that never reaches the login page.
+func (reg *Registry) Use(mw ...Middleware) { reg.middlewares = append(reg.middlewares, mw...) }
+
+// Recovery returns a middleware that turns panics into a styled 500 page and logs the stack trace.
+func (reg *Registry) Recovery() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if v := recover(); v != nil {
+					if v == http.ErrAbortHandler { panic(v) }
+					reg.log(r.Context()).Error("panic", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+					reg.renderErrorPage(w, http.StatusInternalServerError, reg.errorDetail(fmt.Errorf("panic: %v", v)))
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestLogger returns a middleware logging method, path, user email, status and duration of every request.
+// Each request gets an id, taken from an X-Request-ID header or generated and echoed in the response, which the
+// admin's other log events for the request carry as request_id. A nil logger uses the registry's Logger.
+func (reg *Registry) RequestLogger(logger Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start, info := time.Now(), &requestInfo{RequestID: r.Header.Get("X-Request-ID")}
+			if info.RequestID == "" || len(info.RequestID) > 64 { info.RequestID = newRequestID() }
+			w.Header().Set("X-Request-ID", info.RequestID)
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+			l := logger; if l == nil { l = reg.Logger }
+			email := info.UserEmail; if email == "" { email = "-" }
+			if rec.status == 0 { rec.status = http.StatusOK }
+			l.Info("request", "method", r.Method, "path", r.URL.Path, "user", email, "status", rec.status, "duration", time.Since(start), "request_id", info.RequestID)
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// renderError logs err and renders a styled error page; the raw error text is only shown with Config.DebugErrors.
+func (reg *Registry) renderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if err != nil { reg.log(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "status", status, "error", err) }
+	if user := CurrentUser(r.Context()); status == http.StatusNotFound && user != nil { reg.renderNotFound(w, r, user, reg.errorDetail(err)); return }
+	reg.renderErrorPage(w, status, reg.errorDetail(err))
+}
+
+// renderNotFound shows a signed-in user the 404 page within the admin layout, so the navigation stays at hand.
+func (reg *Registry) renderNotFound(w http.ResponseWriter, r *http.Request, user *models.AdminUser, detail string) {
+	tmpl, err := reg.loadTemplates("templates/not_found.html")
+	var buf bytes.Buffer
+	if err == nil {
+		pd := PageData{
+			SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+			User: user, CSS: reg.styleCSS(), Status: http.StatusNotFound, Message: http.StatusText(http.StatusNotFound), Error: detail,
+			Title: reg.T(r.Context(), "Page not found"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Page not found")}), Brand: reg.brand(),
+		}
+		reg.localize(r.Context(), &pd)
+		err = tmpl.ExecuteTemplate(&buf, "not_found.html", pd)
+	}
+	if err != nil { reg.log(r.Context()).Error("render failed", "template", "not_found.html", "error", err); reg.renderErrorPage(w, http.StatusNotFound, detail); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	buf.WriteTo(w)
+}
+
+// renderRecordError reports a failed record lookup, as a 404 when the record simply does not exist.
+func (reg *Registry) renderRecordError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, gorm.ErrRecordNotFound) { status = http.StatusNotFound }
+	reg.renderError(w, r, status, err)
+}
+
+func (reg *Registry) errorDetail(err error) string {
+	if err == nil || !reg.Config.DebugErrors { return "" }
+	return err.Error()
+}
+
+// renderErrorPage writes a standalone styled error page; detail is only shown when non-empty.
+func (reg *Registry) renderErrorPage(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	tmpl, err := reg.parseTemplates("error.html")
+	if err != nil { fmt.Fprintf(w, "%d %s", status, http.StatusText(status)); return }
+	tmpl.Execute(w, PageData{SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), CSS: reg.styleCSS(), Status: status, Message: http.StatusText(status), Error: detail, Brand: reg.brand(), Locale: reg.defaultLocale(), translator: reg.getTranslator()})
+}
@@ -1,20 +1,81 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/config"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // AdminUser represents a person who can log in to the admin panel.
 type AdminUser struct {
 	ID           uint   `gorm:"primaryKey"`
 	Email        string `gorm:"uniqueIndex"`
+	// Name is the user's display name, as single sign-on last gave it.
+	Name         string
 	PasswordHash string
 	Role         string
+	// Active is false for deactivated users, who cannot sign in.
+	Active       bool       `gorm:"default:true"`
+	LastLoginAt  *time.Time
+	// Locale is the user's choice of UI language, e.g. "de"; empty follows the browser.
+	Locale       string
+	// Timezone is the user's IANA time zone, e.g. "Europe/Berlin", which their scheduled reports run in; empty is UTC.
+	Timezone     string
+	// Impersonator is the admin acting as this user for the current request, if any; it is not stored.
+	Impersonator *AdminUser `gorm:"-"`
 }
 
-func (u *AdminUser) SetPassword(password string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+var commonPasswords = map[string]bool{
+	"123456": true, "12345678": true, "123456789": true, "1234567890": true, "password": true, "password1": true,
+	"password123": true, "qwerty": true, "qwerty123": true, "qwertyuiop": true, "abc123": true, "111111": true,
+	"letmein": true, "welcome": true, "welcome1": true, "admin": true, "admin123": true, "iloveyou": true,
+	"monkey": true, "dragon": true, "sunshine": true, "football": true, "baseball": true, "trustno1": true,
+	"changeme": true, "passw0rd": true, "p@ssw0rd": true, "master": true, "superman": true, "11111111": true,
+}
+
+// ValidatePassword checks password against policy, returning an error that names the first rule it breaks.
+func ValidatePassword(password string, policy config.PasswordPolicy) error {
+	if utf8.RuneCountInString(password) < policy.MinLength { return fmt.Errorf("Password must be at least %d characters long.", policy.MinLength) }
+	var upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c): upper = true
+		case unicode.IsDigit(c): digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c): symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper { return errors.New("Password must contain an uppercase letter.") }
+	if policy.RequireDigit && !digit { return errors.New("Password must contain a digit.") }
+	if policy.RequireSymbol && !symbol { return errors.New("Password must contain a symbol.") }
+	if policy.DisallowCommon && commonPasswords[strings.ToLower(password)] { return errors.New("Password is too common; choose another.") }
+	return nil
+}
+
+// DisplayName is the name the admin shows for the user: their Name, or their email when they have none.
+func (u *AdminUser) DisplayName() string {
+	if u.Name != "" { return u.Name }
+	return u.Email
+}
+
+// SetPassword hashes password with bcrypt's default cost and skips the password policy, for code that sets
+// passwords itself, such as tests and imports. The admin's own forms, and Registry.EnsureAdminUser, check
+// Config.PasswordPolicy through SetPasswordWith instead.
+func (u *AdminUser) SetPassword(password string) error { return u.hashPassword(password, bcrypt.DefaultCost) }
+
+// SetPasswordWith hashes password with the given bcrypt cost after checking it against policy.
+func (u *AdminUser) SetPasswordWith(password string, policy config.PasswordPolicy, cost int) error {
+	if err := ValidatePassword(password, policy); err != nil { return err }
+	return u.hashPassword(password, cost)
+}
+
+func (u *AdminUser) hashPassword(password string, cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost { cost = bcrypt.DefaultCost }
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil { return err }
 	u.PasswordHash = string(hash)
 	return nil
@@ -24,11 +85,28 @@ func (u *AdminUser) CheckPassword(password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
 }
 
+// UpgradeHash re-hashes a just-verified password when the stored hash is cheaper than cost, reporting whether
+// PasswordHash changed. No policy is applied, so users with older, weaker passwords are upgraded too.
+func (u *AdminUser) UpgradeHash(password string, cost int) (bool, error) {
+	current, err := bcrypt.Cost([]byte(u.PasswordHash))
+	if err != nil || current >= cost { return false, err }
+	return true, u.hashPassword(password, cost)
+}
+
 // Session stores active login sessions.
 type Session struct {
-	ID        string    `gorm:"primaryKey"`
-	UserID    uint      `gorm:"index"`
-	ExpiresAt time.Time `gorm:"index"`
+	// ID is the SHA-256 of the token in the session cookie, so the table alone cannot be replayed.
+	ID             string    `gorm:"primaryKey"`
+	UserID         uint      `gorm:"index"`
+	// Role is the user's role when the session started; a role change ends the session.
+	Role           string
+	// ImpersonatorID is the admin who switched this session to UserID, or 0.
+	ImpersonatorID uint
+	ExpiresAt      time.Time `gorm:"index"`
+	CreatedAt      time.Time
+	LastSeenAt     time.Time
+	IP             string
+	UserAgent      string
 }
 
 // Permission defines what a role can do with a resource.
@@ -41,12 +119,222 @@ type Permission struct {
 
 // AuditLog records every change made in the admin panel.
 type AuditLog struct {
+	ID             uint      `gorm:"primaryKey"`
+	UserID         uint      `gorm:"index"`
+	UserEmail      string
+	// ImpersonatorID is set when an admin acted as UserID; UserEmail then reads "admin@… as user@…".
+	ImpersonatorID uint      `gorm:"index"`
+	ResourceName   string    `gorm:"index"`
+	RecordID       string    `gorm:"index"`
+	Action         string    
+	Changes        string    
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+// SavedFilter is a named list view (filters, scope and sort) saved by a user, optionally shared with their role.
+type SavedFilter struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"index"`
+	ResourceName string `gorm:"index"`
+	Name         string
+	Query        string
+	Role         string `gorm:"index"`
+	IsDefault    bool
+	CreatedAt    time.Time
+}
+
+// UserPreference stores per-user list view settings for a resource.
+type UserPreference struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"uniqueIndex:idx_user_resource"`
+	ResourceName string `gorm:"uniqueIndex:idx_user_resource"`
+	Columns      string // comma-separated field names in display order; empty means the resource default
+	PerPage      int
+	UpdatedAt    time.Time
+}
+
+// WebhookDelivery is a change notification sent, or still to be sent, to a webhook endpoint.
+type WebhookDelivery struct {
+	ID           uint      `gorm:"primaryKey"`
+	URL          string
+	Event        string
+	ResourceName string    `gorm:"index"`
+	RecordID     string
+	Payload      string
+	Status       string    `gorm:"index"` // pending, delivered or failed
+	Attempts     int
+	ResponseCode int
+	LastError    string
+	CreatedAt    time.Time `gorm:"index"`
+	DeliveredAt  *time.Time
+}
+
+// PasswordResetToken is a single-use password reset link; only the SHA-256 of the token is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	TokenHash string    `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// FormToken is the one-time token of a rendered admin form (Config.FormTokens); only its SHA-256 is stored. Once
+// used, RecordID holds the record the submission saved, which replays of it are sent to.
+type FormToken struct {
+	ID        string    `gorm:"primaryKey"`
+	SessionID string    `gorm:"index"`
+	Used      bool
+	RecordID  string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// EditLock is an advisory lock a user holds while a record's edit form is open (Config.EditLocks). Others opening
+// the form are warned; saving is still allowed. CreatedAt is when the user started editing.
+type EditLock struct {
 	ID           uint      `gorm:"primaryKey"`
+	ResourceName string    `gorm:"uniqueIndex:idx_edit_lock_holder"`
+	RecordID     string    `gorm:"uniqueIndex:idx_edit_lock_holder"`
+	UserID       uint      `gorm:"uniqueIndex:idx_edit_lock_holder"`
+	UserEmail    string
+	// UserName is the holder's name when they took the lock; empty for users without one.
+	UserName     string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+// Expired reports whether the lock has lapsed, its form closed or left without a heartbeat.
+func (l EditLock) Expired() bool { return !l.ExpiresAt.After(time.Now()) }
+
+// Draft is a user's unsaved edit form, autosaved while it is open (Config.Drafts) so a lapsed session or a
+// sleeping laptop doesn't lose the work. RecordID is "new" for a record not yet created; Values holds the form's
+// fields as JSON, password, file and encrypted fields left out.
+type Draft struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"uniqueIndex:idx_draft_owner"`
+	ResourceName string    `gorm:"uniqueIndex:idx_draft_owner"`
+	RecordID     string    `gorm:"uniqueIndex:idx_draft_owner"`
+	Values       string
+	UpdatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+// LoginEvent records a sign-in attempt; UserID is 0 when the email matched no account.
+type LoginEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	Email     string
+	IP        string
+	UserAgent string
+	Success   bool
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// Comment is an internal note left on a record of a resource with comments enabled.
+type Comment struct {
+	ID           uint      `gorm:"primaryKey"`
+	ResourceName string    `gorm:"index:idx_comment_record"`
+	RecordID     string    `gorm:"index:idx_comment_record"`
 	UserID       uint      `gorm:"index"`
 	UserEmail    string
-	ResourceName string    `gorm:"index"`
-	RecordID     string    `gorm:"index"`
-	Action       string    
-	Changes      string    
+	Body         string
+	CreatedAt    time.Time
+}
+
+// ExportJob is a CSV export run in the background; File names the finished file in Config.ExportDir.
+type ExportJob struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"index"`
+	ResourceName string
+	Query        string
+	Status       string    `gorm:"index"` // queued, running, done, failed or cancelled
+	Rows         int64
+	Total        int64
+	File         string
+	Error        string
+	CreatedAt    time.Time `gorm:"index"`
+	FinishedAt   *time.Time
+}
+
+// Active reports whether the job is still queued or running.
+func (j ExportJob) Active() bool { return j.Status == "queued" || j.Status == "running" }
+
+// Progress is the share of rows written so far, in percent, from the row count estimated when the job was queued.
+func (j ExportJob) Progress() int {
+	if j.Status == "done" { return 100 }
+	if j.Total <= 0 { return 0 }
+	if p := int(j.Rows * 100 / j.Total); p < 100 { return p }
+	return 99
+}
+
+// Watch subscribes a user to a record: they are emailed when anyone else changes, deletes or comments on it.
+type Watch struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"uniqueIndex:idx_watch_record"`
+	ResourceName string    `gorm:"uniqueIndex:idx_watch_record"`
+	RecordID     string    `gorm:"uniqueIndex:idx_watch_record"`
+	CreatedAt    time.Time
+}
+
+// BatchJob is a batch action running in the background, over the records a list filter matched (Query) or a large
+// selection (IDs, one per line). Params holds the action's params as JSON; Failures lists the first records that
+// failed, one "#id: error" per line.
+type BatchJob struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"index"`
+	ResourceName string
+	ActionName   string
+	ActionLabel  string
+	Query        string
+	IDs          string
+	Params       string
+	Status       string    `gorm:"index"` // queued, running, done, failed or cancelled
+	Total        int64
+	Processed    int64
+	Failed       int64
+	Failures     string
+	Error        string
 	CreatedAt    time.Time `gorm:"index"`
+	FinishedAt   *time.Time
+}
+
+// Active reports whether the job is still queued or running.
+func (j BatchJob) Active() bool { return j.Status == "queued" || j.Status == "running" }
+
+// Progress is the share of records processed so far, in percent, of the count taken when the job was queued.
+func (j BatchJob) Progress() int {
+	if j.Status == "done" { return 100 }
+	if j.Total <= 0 { return 0 }
+	if p := int(j.Processed * 100 / j.Total); p < 100 { return p }
+	return 99
+}
+
+// ScheduledReport emails an export of a resource's list, narrowed by Query, to Recipients (comma separated) on a
+// cron Schedule evaluated in Timezone, the creator's when the report was saved. It runs as its creator, so their
+// scope applies. A failed run is retried with backoff; LastError keeps the most recent failure.
+type ScheduledReport struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"index"`
+	Name         string
+	ResourceName string
+	Query        string
+	Format       string
+	Recipients   string
+	Schedule     string
+	Timezone     string
+	Enabled      bool
+	NextRunAt    *time.Time `gorm:"index"`
+	LastRunAt    *time.Time
+	LastJobID    uint
+	LastError    string
+	Failures     int
+	CreatedAt    time.Time
+}
+
+// Setting is a named value the admin keeps in its database so it survives restarts and is shared by every process,
+// such as the maintenance mode message.
+type Setting struct {
+	Name      string `gorm:"primaryKey"`
+	Value     string
+	UpdatedAt time.Time
 }
@@ -0,0 +1,268 @@
+package admin
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// oidcCookie holds the state and nonce of a sign-in in progress at the identity provider.
+const oidcCookie = "admin_oidc"
+
+// oidcLeeway is the clock skew allowed when checking an ID token's expiry.
+const oidcLeeway = time.Minute
+
+// oidcClient talks to the identity provider.
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcProvider is the identity provider's discovery document, less what sign-in doesn't use, and its signing keys.
+type oidcProvider struct {
+	Issuer        string `json:"issuer"`
+	AuthEndpoint  string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI       string `json:"jwks_uri"`
+	keys          map[string]*rsa.PublicKey // by key id
+}
+
+// oidcClaims are the ID token claims sign-in reads; the role claim is looked up in the rest.
+type oidcClaims struct {
+	Issuer        string          `json:"iss"`
+	Audience      json.RawMessage `json:"aud"`
+	Expiry        int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified *bool           `json:"email_verified"`
+	Name          string          `json:"name"`
+	raw           map[string]interface{}
+}
+
+// oidcEnabled reports whether Config.OIDC is set up, which adds "Sign in with SSO" to the login page.
+func (reg *Registry) oidcEnabled() bool {
+	c := reg.Config.OIDC
+	return c.IssuerURL != "" && c.ClientID != ""
+}
+
+// oidcRedirectPath is where the identity provider sends users back to, under the admin's base path.
+func (reg *Registry) oidcRedirectPath() string {
+	if p := reg.Config.OIDC.RedirectPath; p != "" { return "/" + strings.TrimPrefix(p, "/") }
+	return "/login/sso/callback"
+}
+
+// oidcRedirectURL is oidcRedirectPath as an absolute URL: under Config.PublicURL, or else the request's own host.
+func (reg *Registry) oidcRedirectURL(r *http.Request) string {
+	if reg.Config.PublicURL != "" { return reg.absoluteURL(reg.oidcRedirectPath()) }
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") { scheme = "https" }
+	return scheme + "://" + r.Host + reg.URL(reg.oidcRedirectPath())
+}
+
+// oidcDiscover fetches the provider's discovery document and keys once, and again with refresh, e.g. when a token
+// is signed by a key not seen before. The document must be for Config.OIDC.IssuerURL.
+func (reg *Registry) oidcDiscover(ctx context.Context, refresh bool) (*oidcProvider, error) {
+	reg.mu.RLock(); p := reg.oidc; reg.mu.RUnlock()
+	if p != nil && !refresh { return p, nil }
+	issuer := strings.TrimRight(reg.Config.OIDC.IssuerURL, "/")
+	p = &oidcProvider{}
+	if err := oidcGet(ctx, issuer+"/.well-known/openid-configuration", p); err != nil { return nil, fmt.Errorf("oidc discovery: %w", err) }
+	if strings.TrimRight(p.Issuer, "/") != issuer { return nil, fmt.Errorf("oidc discovery: the document is for issuer %q, not %q", p.Issuer, issuer) }
+	if p.AuthEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" { return nil, errors.New("oidc discovery: the document lacks an endpoint") }
+	var jwks struct {
+		Keys []struct{ Kid, Kty, Use, N, E string } `json:"keys"`
+	}
+	if err := oidcGet(ctx, p.JWKSURI, &jwks); err != nil { return nil, fmt.Errorf("oidc keys: %w", err) }
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") { continue }
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 { continue }
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	reg.mu.Lock(); reg.oidc = p; reg.mu.Unlock()
+	return p, nil
+}
+
+func oidcGet(ctx context.Context, u string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil { return err }
+	resp, err := oidcClient.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 { return fmt.Errorf("GET %s: %s", u, resp.Status) }
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// handleSSOLogin serves /login/sso, which sends the user to the identity provider with a fresh state and nonce,
+// kept in a short-lived cookie until they come back.
+func (reg *Registry) handleSSOLogin(w http.ResponseWriter, r *http.Request) {
+	p, err := reg.oidcDiscover(r.Context(), false)
+	if err != nil { reg.log(r.Context()).Error("sso unavailable", "error", err); reg.renderLogin(w, r, reg.T(r.Context(), "Single sign-on is unavailable; try again later")); return }
+	state, err := newToken()
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	nonce, err := newToken()
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	c := reg.sessionCookie(r, state+"."+nonce, 600)
+	// The provider's redirect back is a cross-site navigation, which a strict cookie would not survive.
+	c.Name, c.SameSite = oidcCookie, http.SameSiteLaxMode
+	http.SetCookie(w, c)
+	q := url.Values{"response_type": {"code"}, "client_id": {reg.Config.OIDC.ClientID}, "redirect_uri": {reg.oidcRedirectURL(r)}, "scope": {"openid email profile"}, "state": {state}, "nonce": {nonce}}
+	sep := "?"
+	if strings.Contains(p.AuthEndpoint, "?") { sep = "&" }
+	http.Redirect(w, r, p.AuthEndpoint+sep+q.Encode(), 303)
+}
+
+// handleSSOCallback serves the redirect path the identity provider returns to: it checks the state, exchanges the
+// code for an ID token, verifies it, and signs the user in as the AdminUser with the token's email, creating it or
+// updating its name and role, which RoleMapping gives from the role claim. Failures are logged as failed logins.
+func (reg *Registry) handleSSOCallback(w http.ResponseWriter, r *http.Request) {
+	c := reg.sessionCookie(r, "", -1)
+	c.Name = oidcCookie
+	http.SetCookie(w, c)
+	fail := func(email, why string, err error) {
+		if m := reg.metrics(); m != nil { m.ObserveLogin(false) }
+		reg.log(r.Context()).Warn("sso login failed", "email", email, "ip", reg.clientIP(r), "reason", why, "error", err)
+		reg.recordLogin(r, 0, email, false)
+		reg.renderLogin(w, r, reg.T(r.Context(), "Single sign-on failed: %s", reg.T(r.Context(), why)))
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	var state, nonce string
+	if err == nil { state, nonce, _ = strings.Cut(cookie.Value, ".") }
+	switch {
+	case r.URL.Query().Get("error") != "":
+		fail("", "the identity provider refused the sign-in", errors.New(r.URL.Query().Get("error"))); return
+	case state == "" || nonce == "" || r.URL.Query().Get("state") != state:
+		fail("", "the sign-in expired; please try again", errors.New("state mismatch")); return
+	}
+	claims, err := reg.oidcExchange(r, r.URL.Query().Get("code"), nonce)
+	if err != nil { fail("", "the identity provider's answer could not be verified", err); return }
+	role := reg.oidcRole(claims)
+	if role == "" { fail(claims.Email, "your account has no role here", errors.New("no mapped role")); return }
+
+	var user models.AdminUser
+	err = reg.dbFor(r).Where("email = ?", claims.Email).Limit(1).Find(&user).Error
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	if user.ID != 0 && !user.Active { fail(claims.Email, "your account is deactivated", errors.New("inactive user")); return }
+	now := time.Now()
+	user.Email, user.Role, user.LastLoginAt = claims.Email, role, &now
+	if claims.Name != "" { user.Name = claims.Name }
+	if user.ID == 0 {
+		user.Active = true
+		err = reg.dbFor(r).Create(&user).Error
+	} else {
+		err = reg.dbFor(r).Model(&user).Updates(map[string]interface{}{"role": user.Role, "name": user.Name, "last_login_at": now}).Error
+	}
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	if m := reg.metrics(); m != nil { m.ObserveLogin(true) }
+	reg.log(r.Context()).Info("sso login succeeded", "email", user.Email, "role", user.Role, "ip", reg.clientIP(r))
+	reg.recordLogin(r, user.ID, user.Email, true)
+	if err := reg.startSession(w, r, &user, 0); err != nil { reg.renderError(w, r, 500, err); return }
+	ctx := r.Context()
+	if user.Locale != "" { ctx = withLocale(ctx, user.Locale) }
+	reg.setFlash(w, reg.T(ctx, "Login successful! Welcome back."))
+	http.Redirect(w, r, reg.URL("/"), 303)
+}
+
+// oidcExchange trades an authorization code for the provider's ID token and returns its verified claims.
+func (reg *Registry) oidcExchange(r *http.Request, code, nonce string) (*oidcClaims, error) {
+	if code == "" { return nil, errors.New("no authorization code") }
+	p, err := reg.oidcDiscover(r.Context(), false)
+	if err != nil { return nil, err }
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {reg.oidcRedirectURL(r)}}
+	req, err := http.NewRequestWithContext(r.Context(), "POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil { return nil, err }
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(reg.Config.OIDC.ClientID), url.QueryEscape(reg.Config.OIDC.ClientSecret))
+	resp, err := oidcClient.Do(req)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil { return nil, fmt.Errorf("token response: %w", err) }
+	if resp.StatusCode != 200 || body.IDToken == "" { return nil, fmt.Errorf("token endpoint: %s %s", resp.Status, body.Error) }
+	return reg.verifyIDToken(r.Context(), body.IDToken, nonce, time.Now())
+}
+
+// verifyIDToken checks an RS256 ID token's signature against the provider's keys and its issuer, audience, expiry
+// and nonce, and that it carries an email the provider hasn't marked unverified.
+func (reg *Registry) verifyIDToken(ctx context.Context, token, nonce string, now time.Time) (*oidcClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 { return nil, errors.New("id token: malformed") }
+	var header struct{ Alg, Kid string }
+	if err := decodeSegment(parts[0], &header); err != nil { return nil, fmt.Errorf("id token header: %w", err) }
+	if header.Alg != "RS256" { return nil, fmt.Errorf("id token: unsupported algorithm %q", header.Alg) }
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil { return nil, fmt.Errorf("id token signature: %w", err) }
+	p, err := reg.oidcDiscover(ctx, false)
+	if err != nil { return nil, err }
+	key := p.keys[header.Kid]
+	if key == nil {
+		// The provider may have rotated its keys since they were fetched.
+		if p, err = reg.oidcDiscover(ctx, true); err != nil { return nil, err }
+		if key = p.keys[header.Kid]; key == nil { return nil, fmt.Errorf("id token: unknown key %q", header.Kid) }
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil { return nil, errors.New("id token: bad signature") }
+
+	claims := &oidcClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil { return nil, fmt.Errorf("id token claims: %w", err) }
+	if err := decodeSegment(parts[1], &claims.raw); err != nil { return nil, fmt.Errorf("id token claims: %w", err) }
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var aud string
+		if json.Unmarshal(claims.Audience, &aud) != nil { return nil, errors.New("id token: malformed audience") }
+		audiences = []string{aud}
+	}
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != strings.TrimRight(p.Issuer, "/"):
+		return nil, fmt.Errorf("id token: issued by %q", claims.Issuer)
+	case !slices.Contains(audiences, reg.Config.OIDC.ClientID):
+		return nil, fmt.Errorf("id token: not for this client but %v", audiences)
+	case claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(oidcLeeway)):
+		return nil, errors.New("id token: expired")
+	case claims.Nonce != nonce:
+		return nil, errors.New("id token: nonce mismatch")
+	case claims.Email == "":
+		return nil, errors.New("id token: no email")
+	case claims.EmailVerified != nil && !*claims.EmailVerified:
+		return nil, errors.New("id token: email not verified")
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT into dest.
+func decodeSegment(seg string, dest interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil { return err }
+	return json.Unmarshal(b, dest)
+}
+
+// oidcRole maps the token's role claim, a string or a list such as groups, to an admin role through
+// Config.OIDC.RoleMapping. The claim's values are tried in the order the token lists them, and the first one with a
+// mapping wins. It is "" when none has one.
+func (reg *Registry) oidcRole(claims *oidcClaims) string {
+	name := reg.Config.OIDC.RoleClaim
+	if name == "" { name = "groups" }
+	var values []string
+	switch v := claims.raw[name].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, s := range v { if s, ok := s.(string); ok { values = append(values, s) } }
+	}
+	for _, v := range values { if role := reg.Config.OIDC.RoleMapping[v]; role != "" { return role } }
+	return ""
+}
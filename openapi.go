@@ -0,0 +1,285 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPIPath is where the spec is served, under the base path.
+const openAPIPath = "/api/openapi.json"
+
+// object is a JSON object of the spec under construction; encoding/json writes its keys sorted, so the same
+// registry always produces the same document.
+type object = map[string]interface{}
+
+// OpenAPISpec describes the JSON API as an OpenAPI 3.0 document: for every resource not marked APIDisabled, its
+// record schema, built from the field types and marking read-only and required fields, and the list, show, search,
+// save, delete and bulk create endpoints with their query parameters. Read-only resources only get the reading
+// endpoints. Requests authenticate with the session cookie.
+func (reg *Registry) OpenAPISpec() map[string]interface{} {
+	paths, schemas := object{}, object{
+		"Error":        object{"type": "object", "required": []string{"error"}, "properties": object{"error": object{"type": "string"}}},
+		"Meta":         openAPIMeta(),
+		"SearchResult": object{"type": "object", "properties": object{"id": object{}, "text": object{"type": "string"}}},
+		"BulkResponse": openAPIBulkResponse(),
+	}
+	var tags []object
+	for _, slug := range reg.ResourceNames() {
+		res, ok := reg.GetResource(slug)
+		if !ok || res.APIDisabled { continue }
+		schemas[res.Slug] = openAPIRecord(res)
+		tags = append(tags, object{"name": res.Slug, "description": res.Name})
+		for path, item := range openAPIPaths(res) { paths[path] = item }
+	}
+	server := reg.basePath()
+	if server == "" { server = "/" }
+	title := reg.Config.SiteTitle
+	if title == "" { title = "Admin" }
+	return object{
+		"openapi": "3.0.3",
+		"info":    object{"title": title + " API", "version": "1.0"},
+		"servers": []object{{"url": server}},
+		"tags":    tags,
+		"paths":   paths,
+		"security": []object{{"sessionCookie": []string{}}},
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"sessionCookie": object{"type": "apiKey", "in": "cookie", "name": reg.cookieName()},
+			},
+		},
+	}
+}
+
+// openAPIRecord is a resource's record schema: "id" and every field, virtual and count fields being read-only.
+func openAPIRecord(res *resource.Resource) object {
+	t := reflect.TypeOf(res.Model)
+	for t.Kind() == reflect.Ptr { t = t.Elem() }
+	id := object{"readOnly": true}
+	if sf, ok := t.FieldByName(res.PrimaryKey); ok { id = openAPIType(sf.Type); id["readOnly"] = true }
+	props, required := object{"id": id}, []string{"id"}
+	for _, f := range res.Fields {
+		var ft reflect.Type
+		if sf, ok := t.FieldByName(f.Name); ok && !f.Virtual { ft = sf.Type }
+		s := openAPIField(f, ft)
+		if f.Readonly || f.Virtual || f.CountOf != "" || f.Name == res.PrimaryKey { s["readOnly"] = true }
+		if f.Label != "" && f.Label != f.Name { s["title"] = f.Label }
+		props[f.Name] = s
+		if f.Required { required = append(required, f.Name) }
+	}
+	return object{"type": "object", "properties": props, "required": required}
+}
+
+// openAPIField is a field's schema from Field.Type where that decides the JSON value, else from its Go type. A
+// virtual field's value is whatever its Compute returns, so its schema is left open.
+func openAPIField(f resource.Field, t reflect.Type) object {
+	switch {
+	case f.CountOf != "":
+		return object{"type": "integer", "minimum": 0}
+	case f.Type == "tags":
+		return object{"type": "array", "items": object{"type": "string"}}
+	case t == nil:
+		return object{}
+	}
+	s := openAPIType(t)
+	if f.Type == "image" || f.Type == "file" { s["format"] = "uri" }
+	if len(f.Options) > 0 && s["type"] == "string" { s["enum"] = f.Options }
+	return s
+}
+
+// openAPIType maps a Go type to a schema; pointers are nullable.
+func openAPIType(t reflect.Type) object {
+	s := object{}
+	if t.Kind() == reflect.Ptr { t, s["nullable"] = t.Elem(), true }
+	if t == reflect.TypeOf(time.Time{}) { s["type"], s["format"] = "string", "date-time"; return s }
+	switch t.Kind() {
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		s["type"], s["format"] = "integer", "int32"
+	case reflect.Int, reflect.Int64:
+		s["type"], s["format"] = "integer", "int64"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s["type"], s["minimum"] = "integer", 0
+	case reflect.Float32:
+		s["type"], s["format"] = "number", "float"
+	case reflect.Float64:
+		s["type"], s["format"] = "number", "double"
+	case reflect.Slice, reflect.Array:
+		s["type"], s["items"] = "array", openAPIType(t.Elem())
+	case reflect.Map, reflect.Struct:
+		s["type"] = "object"
+	}
+	return s
+}
+
+// openAPIPaths are a resource's endpoints, by path.
+func openAPIPaths(res *resource.Resource) object {
+	slug, ref := res.Slug, object{"$ref": "#/components/schemas/" + res.Slug}
+	errorResponse := func(desc string) object { return openAPIJSON(desc, object{"$ref": "#/components/schemas/Error"}) }
+	envelope := func(data object) object {
+		return object{"type": "object", "required": []string{"data", "meta"}, "properties": object{"data": data, "meta": object{"$ref": "#/components/schemas/Meta"}}}
+	}
+	format := openAPIParam("format", "query", "Asks for JSON rather than the HTML page.", object{"type": "string", "enum": []string{"json"}}, true)
+	fields := openAPIParam("fields", "query", "Comma-separated field names to return; unknown or hidden ones are dropped with a warning.", object{"type": "string"}, false)
+	include := openAPIParam("include", "query", "Comma-separated BelongsTo associations to embed.", object{"type": "string"}, false)
+	id := func(required bool, desc string) object { return openAPIParam("id", "query", desc, object{"type": "string"}, required) }
+
+	list := []object{format, fields, include}
+	if res.CursorPagination {
+		list = append(list,
+			openAPIParam("after", "query", "Cursor of the page after, from meta.next.", object{"type": "string"}, false),
+			openAPIParam("before", "query", "Cursor of the page before, from meta.prev.", object{"type": "string"}, false))
+	} else {
+		var sortable []string
+		for _, f := range res.Fields { if f.Sortable && !f.Virtual { sortable = append(sortable, f.Name) } }
+		sort := object{"type": "string"}
+		if len(sortable) > 0 { sort["enum"] = sortable }
+		list = append(list,
+			openAPIParam("page", "query", "", object{"type": "integer", "minimum": 1, "default": 1}, false),
+			openAPIParam("sort", "query", "", sort, false),
+			openAPIParam("order", "query", "", object{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}, false))
+	}
+	list = append(list, openAPIParam("per_page", "query", "", object{"type": "integer", "minimum": 1}, false))
+	if len(res.Scopes) > 0 {
+		names := make([]string, len(res.Scopes))
+		for i, s := range res.Scopes { names[i] = s.Name }
+		list = append(list, openAPIParam("scope", "query", "", object{"type": "string", "enum": names}, false))
+	}
+	list = append(list, openAPIFilters(res)...)
+
+	paths := object{
+		"/" + slug: object{"get": object{
+			"operationId": "list" + slug, "tags": []string{slug}, "summary": "List " + res.Name + " records",
+			"parameters": list,
+			"responses": object{"200": openAPIJSON("A page of records", envelope(object{"type": "array", "items": ref})), "400": errorResponse("Invalid filters"), "401": errorResponse("Not signed in"), "403": object{"description": "Forbidden"}},
+		}},
+		"/" + slug + "/show": object{"get": object{
+			"operationId": "get" + slug, "tags": []string{slug}, "summary": "Get a " + res.Name + " record",
+			"parameters": []object{id(true, "The record's key."), format, fields, include},
+			"responses": object{"200": openAPIJSON("The record", envelope(ref)), "401": errorResponse("Not signed in"), "403": object{"description": "Forbidden"}, "404": object{"description": "No such record"}},
+		}},
+		"/" + slug + "/search": object{"get": object{
+			"operationId": "search" + slug, "tags": []string{slug}, "summary": "Search " + res.Name + " records by their text fields",
+			"parameters": []object{openAPIParam("q", "query", "Text the record's text fields contain.", object{"type": "string"}, false), openAPIParam("scope", "query", "", object{"type": "string"}, false)},
+			"responses": object{"200": openAPIJSON("Up to ten matches", object{"type": "array", "items": object{"$ref": "#/components/schemas/SearchResult"}}), "404": object{"description": "No such resource"}},
+		}},
+	}
+	if res.ReadOnly { return paths }
+	form := object{"application/x-www-form-urlencoded": object{"schema": ref}, "multipart/form-data": object{"schema": ref}}
+	redirect := object{"description": "Done; Location is the page to show next", "headers": object{"Location": object{"schema": object{"type": "string"}}}}
+	paths["/"+slug+"/save"] = object{"post": object{
+		"operationId": "save" + slug, "tags": []string{slug}, "summary": "Create a " + res.Name + " record, or update one with id",
+		"parameters":  []object{id(false, "The key of the record to update; omit it to create one.")},
+		"requestBody": object{"required": true, "content": form},
+		"responses":   object{"303": redirect, "403": object{"description": "Forbidden"}, "404": object{"description": "No such record"}, "422": object{"description": "Invalid values; the form is returned with the errors"}, "503": errorResponse("Maintenance mode")},
+	}}
+	paths["/"+slug+"/delete"] = object{"post": object{
+		"operationId": "delete" + slug, "tags": []string{slug}, "summary": "Delete a " + res.Name + " record",
+		"parameters":  []object{id(true, "The record's key.")},
+		"responses":   object{"303": redirect, "403": object{"description": "Forbidden"}, "404": object{"description": "No such record"}, "503": errorResponse("Maintenance mode")},
+	}}
+	bulk := openAPIJSON("The records created, and why the others failed", object{"$ref": "#/components/schemas/BulkResponse"})
+	paths["/api/"+slug+"/bulk"] = object{"post": object{
+		"operationId": "bulkCreate" + slug, "tags": []string{slug}, "summary": "Create " + res.Name + " records in bulk",
+		"parameters":  []object{openAPIParam("continue_on_error", "query", "Skip and report invalid records instead of rolling back every record.", object{"type": "boolean", "default": false}, false)},
+		"requestBody": object{"required": true, "content": object{"application/json": object{"schema": object{"type": "array", "items": ref}}}},
+		"responses":   object{"200": bulk, "400": errorResponse("The body is not a JSON array"), "401": errorResponse("Not signed in"), "403": errorResponse("Forbidden"), "413": errorResponse("Too many records"), "422": bulk, "503": errorResponse("Maintenance mode")},
+	}}
+	return paths
+}
+
+// openAPIFilters are the list's filter parameters: contains for text fields, equals for the others, and ranges for
+// numbers and times.
+func openAPIFilters(res *resource.Resource) []object {
+	t := reflect.TypeOf(res.Model)
+	for t.Kind() == reflect.Ptr { t = t.Elem() }
+	var params []object
+	for _, f := range res.Fields {
+		sf, ok := t.FieldByName(f.Name)
+		if f.Virtual || !ok { continue }
+		if f.Type == "tags" {
+			params = append(params, openAPIParam("tag_"+f.Name, "query", f.Label+" has this tag.", object{"type": "string"}, false))
+			continue
+		}
+		s := openAPIType(sf.Type)
+		delete(s, "nullable")
+		switch s["type"] {
+		case "string":
+			if s["format"] == "date-time" { break }
+			if len(f.Options) > 0 {
+				params = append(params, openAPIParam("eq_"+f.Name, "query", f.Label+" equals this value.", object{"type": "string", "enum": f.Options}, false))
+				continue
+			}
+			params = append(params, openAPIParam("q_"+f.Name, "query", f.Label+" contains this text.", object{"type": "string"}, false))
+			continue
+		case "integer", "number":
+		default:
+			params = append(params, openAPIParam("eq_"+f.Name, "query", f.Label+" equals this value.", s, false))
+			continue
+		}
+		params = append(params,
+			openAPIParam("eq_"+f.Name, "query", f.Label+" equals this value.", s, false),
+			openAPIParam("min_"+f.Name, "query", f.Label+" is at least this value.", s, false),
+			openAPIParam("max_"+f.Name, "query", f.Label+" is at most this value.", s, false))
+	}
+	return params
+}
+
+func openAPIParam(name, in, desc string, schema object, required bool) object {
+	p := object{"name": name, "in": in, "schema": schema}
+	if desc != "" { p["description"] = desc }
+	if required { p["required"] = true }
+	return p
+}
+
+func openAPIJSON(desc string, schema object) object {
+	return object{"description": desc, "content": object{"application/json": object{"schema": schema}}}
+}
+
+// openAPIMeta describes jsonMeta.
+func openAPIMeta() object {
+	strs := object{"type": "array", "items": object{"type": "string"}}
+	return object{"type": "object", "required": []string{"fields", "warnings"}, "properties": object{
+		"fields": strs, "include": strs, "warnings": strs,
+		"page": object{"type": "integer"}, "per_page": object{"type": "integer"}, "total": object{"type": "integer"}, "total_pages": object{"type": "integer"},
+		"next": object{"type": "string", "description": "The after cursor of the next page, for cursor-paginated resources."},
+		"prev": object{"type": "string", "description": "The before cursor of the previous page, for cursor-paginated resources."},
+	}}
+}
+
+// openAPIBulkResponse describes the bulk create's answer.
+func openAPIBulkResponse() object {
+	result := object{"type": "object", "required": []string{"index"}, "properties": object{
+		"index": object{"type": "integer"}, "id": object{},
+		"errors": object{"type": "object", "additionalProperties": object{"type": "string"}},
+	}}
+	return object{"type": "object", "properties": object{"created": object{"type": "integer"}, "failed": object{"type": "integer"}, "results": object{"type": "array", "items": result}}}
+}
+
+// handleOpenAPI serves the spec to admins, or without a session to a client sending Config.OpenAPIToken as a
+// bearer token.
+func (reg *Registry) handleOpenAPI(w http.ResponseWriter, r *http.Request, user *models.AdminUser, role string) {
+	if token := reg.Config.OpenAPIToken; token != "" && strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 { reg.writeOpenAPI(w); return }
+	}
+	if user == nil { writeJSONError(w, http.StatusUnauthorized, "not signed in"); return }
+	if role != "admin" { writeJSONError(w, http.StatusForbidden, "forbidden"); return }
+	reg.writeOpenAPI(w)
+}
+
+func (reg *Registry) writeOpenAPI(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(reg.OpenAPISpec())
+}
@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// ErrForbidden is returned by QueryResource when the signed-in user may not list the resource.
+var ErrForbidden = errors.New("forbidden")
+
+// UserHandlerFunc is a custom page handler that also receives the signed-in user.
+type UserHandlerFunc func(w http.ResponseWriter, r *http.Request, user *models.AdminUser)
+
+// AddUserPage registers a custom page whose handler receives the signed-in user.
+func (reg *Registry) AddUserPage(n, g string, h UserHandlerFunc) *Page {
+	p := reg.AddPage(n, g, nil)
+	p.HandlerWithUser = h
+	return p
+}
+
+// QueryOptions narrows and pages a QueryResource call. Filters take the list URL params (q_Name, eq_Status,
+// min_Total, scope, af_…); Sort falls back to the resource's position field, then newest first.
+type QueryOptions struct {
+	Filters       url.Values
+	Sort, Order   string
+	Page, PerPage int
+	// Fields names the fields to load, the resource's index fields by default.
+	Fields []string
+}
+
+// QueryOptionsFrom reads the options of a custom page from its own URL: filters, sort, order, page and per_page.
+func QueryOptionsFrom(r *http.Request) QueryOptions {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	return QueryOptions{Filters: q, Sort: q.Get("sort"), Order: q.Get("order"), Page: page, PerPage: perPage}
+}
+
+// bounds resolves the page and page size, clamped to Config.MaxPerPage.
+func (reg *Registry) bounds(opts QueryOptions) (page, perPage int) {
+	page, perPage = opts.Page, opts.PerPage
+	if page < 1 { page = 1 }
+	if perPage < 1 { perPage = reg.Config.DefaultPerPage }
+	if reg.Config.MaxPerPage > 0 && perPage > reg.Config.MaxPerPage { perPage = reg.Config.MaxPerPage }
+	if perPage < 1 { perPage = 10 }
+	return page, perPage
+}
+
+// QueryResource loads one page of a resource for a custom page, as its list would show it to the signed-in user:
+// permissions, row-level scoping, scopes and filters apply, and values are formatted by the fields' decorators.
+// Each row holds the field values by name, the record key under "__id" and its show page under "__url".
+func (reg *Registry) QueryResource(r *http.Request, resourceName string, opts QueryOptions) ([]map[string]interface{}, int64, error) {
+	res, ok := reg.GetResource(resourceName)
+	if !ok { return nil, 0, fmt.Errorf("unknown resource %q", resourceName) }
+	user := CurrentUser(r.Context())
+	if user == nil || !reg.IsAllowed(user.Role, res.Slug, "list") { return nil, 0, ErrForbidden }
+	fields := res.GetFieldsForUser("index", user)
+	if len(opts.Fields) > 0 {
+		fields = nil
+		for _, name := range opts.Fields {
+			found := false
+			for _, f := range res.VisibleFields(user) { if f.Name == name { fields, found = append(fields, f), true; break } }
+			if !found { return nil, 0, fmt.Errorf("%s has no field %q", res.Name, name) }
+		}
+	}
+	lq, err := reg.buildListQuery(r.Context(), res, opts.Filters)
+	if err != nil { return nil, 0, err }
+	total := reg.CountFor(r.Context(), res, lq.CountQuery())
+	sortField := opts.Sort
+	if sortField == "" && res.PositionField != "" { sortField = res.PositionField }
+	lq.Sort(sortField, opts.Order)
+	page, perPage := reg.bounds(opts)
+	dest := reflect.New(res.Meta().SliceType)
+	lq.DB = lq.DB.Offset((page - 1) * perPage).Limit(perPage)
+	if err := lq.Find(dest.Interface()); err != nil { return nil, 0, err }
+	rows := reg.sliceToMap(res, fields, dest.Elem(), CurrentUser(r.Context()))
+	counts, err := reg.relatedCounts(reg.resourceReader(r.Context(), res), res, fields, dest.Elem())
+	if err != nil { return nil, 0, err }
+	reg.setCounts(res, fields, rows, counts)
+	for _, row := range rows { row["__url"] = reg.recordURL(res, row[keyEntry]) }
+	return rows, total, nil
+}
+
+// PageMeta describes a page of QueryResource results for RenderPagination.
+type PageMeta struct {
+	Page, PerPage, TotalPages int
+	Total                     int64
+	// Query is the page's own query; the links keep it and change only "page".
+	Query  url.Values
+	locale string
+}
+
+// Pagination describes the page opts selects out of total results, for a custom page at r.
+func (reg *Registry) Pagination(r *http.Request, opts QueryOptions, total int64) PageMeta {
+	page, perPage := reg.bounds(opts)
+	return PageMeta{Page: page, PerPage: perPage, TotalPages: int(math.Ceil(float64(total) / float64(perPage))), Total: total, Query: r.URL.Query(), locale: reg.localeFrom(r.Context())}
+}
+
+type tableData struct {
+	Fields []resource.Field
+	Rows   []map[string]interface{}
+	Empty  string
+}
+
+type paginationData struct {
+	Info, Prev, Next string
+	PrevURL, NextURL template.URL
+}
+
+// RenderTable renders rows, as QueryResource returns them, as a table in the admin's styling; a row's first
+// column links to its "__url" when set.
+func (reg *Registry) RenderTable(fields []resource.Field, rows []map[string]interface{}) template.HTML {
+	return reg.renderFragment("table", tableData{Fields: fields, Rows: rows, Empty: reg.getTranslator().T(reg.defaultLocale(), "No records found")})
+}
+
+// RenderPagination renders the result count and previous/next links of a page of results.
+func (reg *Registry) RenderPagination(meta PageMeta) template.HTML {
+	t := reg.getTranslator()
+	if meta.locale == "" { meta.locale = reg.defaultLocale() }
+	d := paginationData{Info: t.T(meta.locale, "Showing %d of %d (%d records)", meta.Page, meta.TotalPages, meta.Total), Prev: t.T(meta.locale, "Previous"), Next: t.T(meta.locale, "Next")}
+	link := func(page int) template.URL {
+		q := url.Values{}
+		for k, v := range meta.Query { q[k] = v }
+		q.Set("page", strconv.Itoa(page))
+		return template.URL("?" + q.Encode())
+	}
+	if meta.Page > 1 { d.PrevURL = link(meta.Page - 1) }
+	if meta.Page < meta.TotalPages { d.NextURL = link(meta.Page + 1) }
+	return reg.renderFragment("pagination", d)
+}
+
+// renderFragment executes one template of table.html, returning the error text in place of a broken fragment.
+func (reg *Registry) renderFragment(name string, data interface{}) template.HTML {
+	tmpl, err := reg.parseTemplates("table.html")
+	if err != nil { return template.HTML(template.HTMLEscapeString(err.Error())) }
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil { return template.HTML(template.HTMLEscapeString(err.Error())) }
+	return template.HTML(buf.String())
+}
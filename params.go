@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"strconv"
+)
+
+// paramsSubmitted marks a post from an action's param form, as opposed to the click that opens it.
+const paramsSubmitted = "_params"
+
+// parseParams reads and validates action params from the request, returning the typed values or per-field errors.
+func parseParams(params []resource.Field, r *http.Request) (map[string]interface{}, map[string]string) {
+	values, errs := make(map[string]interface{}), make(map[string]string)
+	for _, p := range params {
+		raw := r.FormValue(p.Name)
+		values[p.Name] = raw
+		if raw == "" {
+			if p.Required { errs[p.Name] = p.Label + " is required" }
+			continue
+		}
+		switch p.Type {
+		case "number":
+			n, err := strconv.ParseFloat(raw, 64)
+			if err != nil { errs[p.Name] = p.Label + " must be a number"; continue }
+			values[p.Name] = n
+		case "select":
+			valid := false
+			for _, o := range p.Options { if o == raw { valid = true } }
+			if !valid { errs[p.Name] = p.Label + " is not a valid choice" }
+		}
+	}
+	if len(errs) > 0 { return nil, errs }
+	return values, nil
+}
+
+// withParams resolves an action's params. It returns the request to run the handler with, or nil after rendering
+// the param form, either because it has not been submitted yet or to show validation errors.
+func (reg *Registry) withParams(res *resource.Resource, label string, params []resource.Field, ids []string, w http.ResponseWriter, r *http.Request, user *models.AdminUser) *http.Request {
+	if len(params) == 0 { return r }
+	var errs map[string]string
+	item := make(map[string]interface{})
+	if r.FormValue(paramsSubmitted) != "" {
+		values, fieldErrs := parseParams(params, r)
+		if fieldErrs == nil { return resource.WithParamValues(r, values) }
+		errs = fieldErrs
+		for _, p := range params { item[p.Name] = r.FormValue(p.Name) }
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errs != nil { w.WriteHeader(http.StatusUnprocessableEntity) }
+	hidden := map[string]string{paramsSubmitted: "1"}
+	if ids != nil { hidden["action_name"] = r.FormValue("action_name") }
+	if r.FormValue("all_matching") != "" { hidden["all_matching"], hidden["query"] = "1", r.FormValue("query") }
+	crumbs := []Crumb{reg.resourceCrumb(r.Context(), res)}
+	if id := r.URL.Query().Get("id"); ids == nil && id != "" { crumbs = append(crumbs, Crumb{Label: reg.recordTitle(r.Context(), res, id), URL: reg.recordURL(res, id)}) }
+	tmpl, err := reg.loadTemplates("templates/form.html")
+	if err != nil { reg.renderError(w, r, 500, err); return nil }
+	reg.execute(w, r, tmpl, "form.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		CurrentResource: res, Fields: params, Sections: res.GroupFields(params), Item: item, User: user, CSS: reg.styleCSS(),
+		FormAction: r.URL.RequestURI(), FormTitle: label, SubmitLabel: label, Hidden: hidden, IDs: ids, FieldErrors: errs,
+		Title: label, Breadcrumbs: reg.breadcrumbs(r.Context(), append(crumbs, Crumb{Label: label})...),
+	})
+	return nil
+}
@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+const resetSentMessage = "If that account exists, we have sent a link to reset its password."
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns 32 random bytes, hex encoded, for use in links and cookies.
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil { return "", err }
+	return hex.EncodeToString(buf), nil
+}
+
+// issueResetToken stores a single-use token for setting userID's password and returns it; only its hash is kept.
+func issueResetToken(db *gorm.DB, userID uint, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil { return "", err }
+	err = db.Create(&models.PasswordResetToken{UserID: userID, TokenHash: hashToken(token), ExpiresAt: time.Now().Add(ttl), CreatedAt: time.Now()}).Error
+	return token, err
+}
+
+// passwordResetEnabled reports whether reset links can be sent, i.e. whether a mailer is available.
+func (reg *Registry) passwordResetEnabled() bool { return reg.getMailer() != nil && !reg.Config.DisablePasswordLogin }
+
+// handleForgotPassword emails a reset link for the given address. The response is the same whether or not the
+// account exists, so the form cannot be used to discover accounts.
+func (reg *Registry) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" { reg.renderPasswordPage(w, r, "forgot.html", "", "", ""); return }
+	var user models.AdminUser
+	if err := reg.dbFor(r).Where("email = ?", r.FormValue("email")).First(&user).Error; err == nil {
+		token, err := issueResetToken(reg.dbFor(r), user.ID, time.Duration(reg.Config.PasswordResetTTL)*time.Minute)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		reg.sendEmail([]string{user.Email}, "password_reset", struct {
+			SiteTitle, Link string
+			Minutes         int
+		}{reg.Config.SiteTitle, reg.absoluteURL("/reset?token=" + token), reg.Config.PasswordResetTTL})
+	}
+	reg.renderPasswordPage(w, r, "forgot.html", "", resetSentMessage, "")
+}
+
+// validResetToken returns the unused, unexpired token record for a token from a reset link.
+func (reg *Registry) validResetToken(db *gorm.DB, token string) (*models.PasswordResetToken, bool) {
+	var t models.PasswordResetToken
+	if token == "" || db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).First(&t).Error != nil { return nil, false }
+	return &t, true
+}
+
+// handleResetPassword sets a new password from a reset link, then burns the user's reset tokens and sessions.
+func (reg *Registry) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	t, ok := reg.validResetToken(reg.dbFor(r), token)
+	if !ok { reg.renderPasswordPage(w, r, "reset.html", "This reset link is invalid or has expired.", "", ""); return }
+	if r.Method != "POST" { reg.renderPasswordPage(w, r, "reset.html", "", "", token); return }
+	password := r.FormValue("password")
+	if password == "" || password != r.FormValue("password_confirm") { reg.renderPasswordPage(w, r, "reset.html", "The passwords do not match.", "", token); return }
+	if err := models.ValidatePassword(password, reg.Config.PasswordPolicy); err != nil { reg.renderPasswordPage(w, r, "reset.html", err.Error(), "", token); return }
+	var user models.AdminUser
+	err := reg.dbFor(r).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, t.UserID).Error; err != nil { return err }
+		if err := reg.setPassword(&user, password); err != nil { return err }
+		if err := tx.Model(&user).Update("password_hash", user.PasswordHash).Error; err != nil { return err }
+		return tx.Model(&models.PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", time.Now()).Error
+	})
+	if err == nil { err = reg.sessions().DeleteAllForUser(r.Context(), user.ID) }
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.RecordAction(&user, usersSlug, fmt.Sprint(user.ID), "Password reset", "Password reset with an emailed link; all sessions signed out")
+	reg.setFlash(w, reg.T(r.Context(), "Your password has been reset. Please sign in."))
+	http.Redirect(w, r, reg.URL("/login"), 303)
+}
+
+func (reg *Registry) renderPasswordPage(w http.ResponseWriter, r *http.Request, name, errorMsg, notice, token string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.parseTemplates(name)
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.execute(w, r, tmpl, name, PageData{SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), Error: errorMsg, Flash: notice, CSS: reg.styleCSS(), Hidden: map[string]string{"token": token}})
+}
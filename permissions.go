@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"io"
+	"slices"
+	"sort"
+)
+
+// Grant lists the actions a role holds, by resource slug, e.g. Grant{"Order": {"list", "show"}}.
+type Grant map[string][]string
+
+// permissionsVersion is the version of the format ExportPermissions writes and ImportPermissions reads.
+const permissionsVersion = 1
+
+// permissionsFile is the JSON form of a permission set: each role's grants, with resources and actions sorted so
+// dumps of the same permissions are identical.
+type permissionsFile struct {
+	Version int              `json:"version"`
+	Roles   map[string]Grant `json:"roles"`
+}
+
+// permissionChange is a grant reconciling created or, with pruning, deleted.
+type permissionChange struct {
+	revoked                bool
+	role, resource, action string
+}
+
+// DefineRole declares in code the permissions role holds, replacing any earlier definition. Migrate, or
+// ReconcilePermissions, makes the Permission table match: missing grants are created and, with
+// Config.PrunePermissions, the role's other grants deleted. Admins hold every permission whether defined or not.
+func (reg *Registry) DefineRole(role string, grant Grant) {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	if reg.roles == nil { reg.roles = make(map[string]Grant) }
+	copied := make(Grant, len(grant))
+	for res, actions := range grant { copied[res] = append([]string(nil), actions...) }
+	reg.roles[role] = copied
+}
+
+// ReconcilePermissions brings the grants of the roles defined with DefineRole in line with their definitions, in one
+// transaction, logging each grant it creates or deletes. Running it again changes nothing.
+func (reg *Registry) ReconcilePermissions() error {
+	reg.mu.RLock()
+	roles := make(map[string]Grant, len(reg.roles))
+	for role, grant := range reg.roles { roles[role] = grant }
+	reg.mu.RUnlock()
+	if len(roles) == 0 { return nil }
+	return reg.applyGrants(roles, reg.Config.PrunePermissions)
+}
+
+// ExportPermissions writes every role's grants as indented JSON, in a stable order, for ImportPermissions to apply
+// elsewhere.
+func (reg *Registry) ExportPermissions(w io.Writer) error {
+	var perms []models.Permission
+	if err := reg.DB.Order("role, resource_name, action").Find(&perms).Error; err != nil { return err }
+	file := permissionsFile{Version: permissionsVersion, Roles: make(map[string]Grant)}
+	for _, p := range perms {
+		grant := file.Roles[p.Role]
+		if grant == nil { grant = make(Grant); file.Roles[p.Role] = grant }
+		if !slices.Contains(grant[p.ResourceName], p.Action) { grant[p.ResourceName] = append(grant[p.ResourceName], p.Action) }
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
+
+// ImportPermissions applies grants written by ExportPermissions, as reconciling does for roles defined in code:
+// missing grants are created and, with Config.PrunePermissions, the listed roles' other grants deleted. Roles the
+// file doesn't list are left alone. The file is checked in full before anything changes.
+func (reg *Registry) ImportPermissions(r io.Reader) error {
+	var file permissionsFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil { return fmt.Errorf("admin: reading permissions: %w", err) }
+	if file.Version != permissionsVersion { return fmt.Errorf("admin: unsupported permissions version %d", file.Version) }
+	return reg.applyGrants(file.Roles, reg.Config.PrunePermissions)
+}
+
+// applyGrants creates each role's missing grants and, with prune, deletes its grants not listed, in one transaction.
+// The changes are logged once it commits.
+func (reg *Registry) applyGrants(roles map[string]Grant, prune bool) error {
+	for role, grant := range roles {
+		if role == "" { return errors.New("admin: permissions for an empty role") }
+		for res, actions := range grant {
+			if res == "" { return fmt.Errorf("admin: role %s grants permissions on an empty resource", role) }
+			for _, a := range actions { if a == "" { return fmt.Errorf("admin: role %s grants an empty action on %s", role, res) } }
+		}
+	}
+	names := make([]string, 0, len(roles))
+	for role := range roles { names = append(names, role) }
+	sort.Strings(names)
+
+	var changes []permissionChange
+	err := reg.DB.Transaction(func(tx *gorm.DB) error {
+		for _, role := range names {
+			var existing []models.Permission
+			if err := tx.Where("role = ?", role).Order("id").Find(&existing).Error; err != nil { return err }
+			held := make(map[[2]string]bool, len(existing))
+			for _, p := range existing { held[[2]string{p.ResourceName, p.Action}] = true }
+			wanted := make(map[[2]string]bool)
+			resources := make([]string, 0, len(roles[role]))
+			for res := range roles[role] { resources = append(resources, res) }
+			sort.Strings(resources)
+			for _, res := range resources {
+				for _, a := range roles[role][res] {
+					key := [2]string{res, a}
+					if wanted[key] { continue }
+					wanted[key] = true
+					if held[key] { continue }
+					if err := tx.Create(&models.Permission{Role: role, ResourceName: res, Action: a}).Error; err != nil { return err }
+					changes = append(changes, permissionChange{role: role, resource: res, action: a})
+				}
+			}
+			if !prune { continue }
+			for _, p := range existing {
+				if wanted[[2]string{p.ResourceName, p.Action}] { continue }
+				if err := tx.Delete(&models.Permission{}, p.ID).Error; err != nil { return err }
+				changes = append(changes, permissionChange{revoked: true, role: role, resource: p.ResourceName, action: p.Action})
+			}
+		}
+		return nil
+	})
+	if err != nil { return err }
+	for _, c := range changes {
+		msg := "permission granted"
+		if c.revoked { msg = "permission revoked" }
+		reg.Logger.Info(msg, "role", c.role, "resource", c.resource, "action", c.action)
+	}
+	return nil
+}
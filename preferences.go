@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"context"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ColumnChoice describes one entry in the list view column chooser.
+type ColumnChoice struct {
+	Field    resource.Field
+	Visible  bool
+	Position int
+}
+
+func (reg *Registry) getPreference(ctx context.Context, res *resource.Resource, user *models.AdminUser) *models.UserPreference {
+	var pref models.UserPreference
+	if reg.DB.WithContext(ctx).Where("user_id = ? AND resource_name = ?", user.ID, res.Slug).Limit(1).Find(&pref).RowsAffected == 0 { return nil }
+	return &pref
+}
+
+func (reg *Registry) savePreference(ctx context.Context, res *resource.Resource, user *models.AdminUser, update func(p *models.UserPreference)) {
+	pref := reg.getPreference(ctx, res, user)
+	if pref == nil { pref = &models.UserPreference{UserID: user.ID, ResourceName: res.Slug} }
+	update(pref)
+	reg.DB.WithContext(ctx).Save(pref)
+}
+
+// indexFields returns the list columns for a user: the resource's index fields, narrowed and reordered by their saved preference.
+func (reg *Registry) indexFields(ctx context.Context, res *resource.Resource, user *models.AdminUser) []resource.Field {
+	fields := res.GetFieldsForUser("index", user)
+	pref := reg.getPreference(ctx, res, user)
+	if pref == nil || pref.Columns == "" { return fields }
+	var result []resource.Field
+	for _, name := range strings.Split(pref.Columns, ",") {
+		for _, f := range fields { if f.Name == name { result = append(result, f); break } }
+	}
+	if len(result) == 0 { return fields }
+	return result
+}
+
+// perPage resolves the page size from the per_page param, the user's saved choice, the resource and the config,
+// persisting an explicit per_page for later visits and clamping everything to Config.MaxPerPage.
+func (reg *Registry) perPage(res *resource.Resource, user *models.AdminUser, r *http.Request) int {
+	n := reg.Config.DefaultPerPage
+	if res.PerPage > 0 { n = res.PerPage }
+	if pref := reg.getPreference(r.Context(), res, user); pref != nil && pref.PerPage > 0 { n = pref.PerPage }
+	if requested, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && requested > 0 {
+		if reg.Config.MaxPerPage > 0 && requested > reg.Config.MaxPerPage { requested = reg.Config.MaxPerPage }
+		if requested != n { reg.savePreference(r.Context(), res, user, func(p *models.UserPreference) { p.PerPage = requested }) }
+		n = requested
+	}
+	if reg.Config.MaxPerPage > 0 && n > reg.Config.MaxPerPage { n = reg.Config.MaxPerPage }
+	if n < 1 { n = 10 }
+	return n
+}
+
+func (reg *Registry) columnChoices(res *resource.Resource, visible []resource.Field, user *models.AdminUser) []ColumnChoice {
+	var choices []ColumnChoice
+	for i, f := range visible { choices = append(choices, ColumnChoice{Field: f, Visible: true, Position: i + 1}) }
+	for _, f := range res.GetFieldsForUser("index", user) {
+		shown := false
+		for _, v := range visible { if v.Name == f.Name { shown = true; break } }
+		if !shown { choices = append(choices, ColumnChoice{Field: f, Position: len(choices) + 1}) }
+	}
+	return choices
+}
+
+func (reg *Registry) handleSaveColumns(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	r.ParseForm()
+	var selected []ColumnChoice
+	for _, f := range res.GetFieldsForUser("index", user) {
+		for _, name := range r.Form["columns"] {
+			if name == f.Name {
+				pos, _ := strconv.Atoi(r.FormValue("pos_" + f.Name))
+				selected = append(selected, ColumnChoice{Field: f, Visible: true, Position: pos}); break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		reg.setFlash(w, reg.T(r.Context(), "Select at least one column"))
+		http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+r.FormValue("query")), 303); return
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return selected[i].Position < selected[j].Position })
+	var names []string
+	for _, c := range selected { names = append(names, c.Field.Name) }
+	reg.savePreference(r.Context(), res, user, func(p *models.UserPreference) { p.Columns = strings.Join(names, ",") })
+	reg.setFlash(w, reg.T(r.Context(), "Columns updated"))
+	http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+r.FormValue("query")), 303)
+}
+
+func (reg *Registry) handleResetColumns(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	reg.dbFor(r).Model(&models.UserPreference{}).Where("user_id = ? AND resource_name = ?", user.ID, res.Slug).Update("columns", "")
+	reg.setFlash(w, reg.T(r.Context(), "Columns reset to default"))
+	http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+r.FormValue("query")), 303)
+}
@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"context"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// presetsFor returns the presets a user can apply on a resource: their own plus those shared with their role.
+func (reg *Registry) presetsFor(ctx context.Context, res *resource.Resource, user *models.AdminUser) []models.SavedFilter {
+	var presets []models.SavedFilter
+	reg.DB.WithContext(ctx).Where("resource_name = ? AND (user_id = ? OR (role <> '' AND role = ?))", res.Slug, user.ID, user.Role).Order("name").Find(&presets)
+	return presets
+}
+
+// defaultPreset prefers the user's own default over one shared with their role.
+func (reg *Registry) defaultPreset(ctx context.Context, res *resource.Resource, user *models.AdminUser) *models.SavedFilter {
+	var shared *models.SavedFilter
+	presets := reg.presetsFor(ctx, res, user)
+	for i, p := range presets {
+		if !p.IsDefault { continue }
+		if p.UserID == user.ID { return &presets[i] }
+		if shared == nil { shared = &presets[i] }
+	}
+	return shared
+}
+
+func (reg *Registry) handleSaveFilter(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	values, _ := url.ParseQuery(r.FormValue("query")); values.Del("page")
+	query := values.Encode()
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		reg.setFlash(w, reg.T(r.Context(), "Please give the view a name"))
+		http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+query), 303); return
+	}
+	// Saving under an existing name overwrites that preset, which is how presets are edited.
+	var preset models.SavedFilter
+	reg.dbFor(r).Where("user_id = ? AND resource_name = ? AND name = ?", user.ID, res.Slug, name).Limit(1).Find(&preset)
+	preset.UserID, preset.ResourceName, preset.Name, preset.Query = user.ID, res.Slug, name, query
+	preset.Role = ""; if r.FormValue("share") != "" { preset.Role = user.Role }
+	preset.IsDefault = r.FormValue("default") != ""
+	if preset.IsDefault {
+		reg.dbFor(r).Model(&models.SavedFilter{}).Where("user_id = ? AND resource_name = ?", user.ID, res.Slug).Update("is_default", false)
+	}
+	reg.dbFor(r).Save(&preset)
+	reg.setFlash(w, reg.T(r.Context(), "View '%s' saved", name))
+	http.Redirect(w, r, reg.URL("/"+res.Slug+"?"+query), 303)
+}
+
+func (reg *Registry) handleDeleteFilter(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	result := reg.dbFor(r).Where("id = ? AND user_id = ? AND resource_name = ?", r.FormValue("preset_id"), user.ID, res.Slug).Delete(&models.SavedFilter{})
+	if result.RowsAffected > 0 { reg.setFlash(w, reg.T(r.Context(), "Saved view deleted")) }
+	http.Redirect(w, r, reg.URL("/"+res.Slug+"?scope="), 303)
+}
@@ -0,0 +1,240 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisSessionStore keeps sessions in Redis (6.0 or later), so authenticated requests do not touch the primary
+// database. Each session is a JSON value that Redis expires on its own; a set per user indexes that user's sessions.
+type RedisSessionStore struct {
+	Addr, Password string
+	DB             int
+	// Prefix namespaces the keys, "goadmin:" by default.
+	Prefix  string
+	Timeout time.Duration
+	idle    chan *redisConn
+}
+
+// NewRedisSessionStore connects lazily to the Redis server at addr ("host:port"); password may be empty.
+func NewRedisSessionStore(addr, password string, db int) *RedisSessionStore {
+	return &RedisSessionStore{Addr: addr, Password: password, DB: db, Prefix: "goadmin:", Timeout: 5 * time.Second, idle: make(chan *redisConn, 8)}
+}
+
+func (s *RedisSessionStore) sessionKey(id string) string { return s.Prefix + "session:" + id }
+func (s *RedisSessionStore) userKey(id uint) string     { return fmt.Sprintf("%suser_sessions:%d", s.Prefix, id) }
+func (s *RedisSessionStore) formTokenKey(id string) string { return s.Prefix + "form_token:" + id }
+
+func (s *RedisSessionStore) Create(ctx context.Context, sess *models.Session) error {
+	data, err := json.Marshal(sess)
+	if err != nil { return err }
+	ttl := strconv.FormatInt(time.Until(sess.ExpiresAt).Milliseconds(), 10)
+	if _, err := s.do(ctx, "SET", s.sessionKey(sess.ID), string(data), "PX", ttl); err != nil { return err }
+	if _, err := s.do(ctx, "SADD", s.userKey(sess.UserID), sess.ID); err != nil { return err }
+	_, err = s.do(ctx, "PEXPIRE", s.userKey(sess.UserID), ttl)
+	return err
+}
+
+func (s *RedisSessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	reply, err := s.do(ctx, "GET", s.sessionKey(id))
+	if err != nil { return nil, err }
+	data, ok := reply.(string)
+	if !ok { return nil, ErrSessionNotFound }
+	var sess models.Session
+	if err := json.Unmarshal([]byte(data), &sess); err != nil { return nil, err }
+	return &sess, nil
+}
+
+func (s *RedisSessionStore) Touch(ctx context.Context, id string, at time.Time) error {
+	sess, err := s.Get(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) { return nil }
+	if err != nil { return err }
+	sess.LastSeenAt = at
+	data, err := json.Marshal(sess)
+	if err != nil { return err }
+	_, err = s.do(ctx, "SET", s.sessionKey(id), string(data), "XX", "KEEPTTL")
+	return err
+}
+
+func (s *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) { return nil }
+	if err != nil { return err }
+	if _, err := s.do(ctx, "DEL", s.sessionKey(id)); err != nil { return err }
+	_, err = s.do(ctx, "SREM", s.userKey(sess.UserID), id)
+	return err
+}
+
+// DeleteExpired is a no-op: Redis expires sessions itself, and ListForUser prunes the per-user index.
+func (s *RedisSessionStore) DeleteExpired(ctx context.Context) error { return nil }
+
+func (s *RedisSessionStore) DeleteAllForUser(ctx context.Context, userID uint) error {
+	ids, err := s.members(ctx, userID)
+	if err != nil { return err }
+	keys := []string{"DEL", s.userKey(userID)}
+	for _, id := range ids { keys = append(keys, s.sessionKey(id)) }
+	_, err = s.do(ctx, keys...)
+	return err
+}
+
+func (s *RedisSessionStore) ListForUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	ids, err := s.members(ctx, userID)
+	if err != nil { return nil, err }
+	var list []models.Session
+	for _, id := range ids {
+		sess, err := s.Get(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) { s.do(ctx, "SREM", s.userKey(userID), id); continue }
+		if err != nil { return nil, err }
+		list = append(list, *sess)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeenAt.After(list[j].LastSeenAt) })
+	return list, nil
+}
+
+func (s *RedisSessionStore) CountActive(ctx context.Context) (int64, error) {
+	var n int64
+	cursor := "0"
+	for {
+		reply, err := s.do(ctx, "SCAN", cursor, "MATCH", s.sessionKey("*"), "COUNT", "1000")
+		if err != nil { return 0, err }
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 { return 0, fmt.Errorf("redis: unexpected SCAN reply %v", reply) }
+		keys, _ := parts[1].([]interface{})
+		n += int64(len(keys))
+		if cursor, _ = parts[0].(string); cursor == "0" || cursor == "" { return n, nil }
+	}
+}
+
+func (s *RedisSessionStore) members(ctx context.Context, userID uint) ([]string, error) {
+	reply, err := s.do(ctx, "SMEMBERS", s.userKey(userID))
+	if err != nil { return nil, err }
+	items, _ := reply.([]interface{})
+	ids := make([]string, 0, len(items))
+	for _, it := range items { if id, ok := it.(string); ok { ids = append(ids, id) } }
+	return ids, nil
+}
+
+// IssueFormToken stores the token's session under its id; ConsumeFormToken claims it by creating a second key,
+// holding the saved record's id, with SET NX.
+func (s *RedisSessionStore) IssueFormToken(ctx context.Context, t *models.FormToken) error {
+	_, err := s.do(ctx, "SET", s.formTokenKey(t.ID), t.SessionID, "PX", strconv.FormatInt(time.Until(t.ExpiresAt).Milliseconds(), 10))
+	return err
+}
+
+func (s *RedisSessionStore) ConsumeFormToken(ctx context.Context, sessionID, id string) (string, error) {
+	reply, err := s.do(ctx, "GET", s.formTokenKey(id))
+	if err != nil { return "", err }
+	if owner, _ := reply.(string); owner == "" || owner != sessionID { return "", ErrFormTokenNotFound }
+	ttl, err := s.do(ctx, "PTTL", s.formTokenKey(id))
+	if err != nil { return "", err }
+	ms, _ := ttl.(int64)
+	if ms <= 0 { ms = 1 }
+	claim, err := s.do(ctx, "SET", s.formTokenKey(id)+":used", "", "NX", "PX", strconv.FormatInt(ms, 10))
+	if err != nil { return "", err }
+	if claim != nil { return "", nil }
+	reply, err = s.do(ctx, "GET", s.formTokenKey(id)+":used")
+	if err != nil { return "", err }
+	recordID, _ := reply.(string)
+	return recordID, ErrFormTokenUsed
+}
+
+func (s *RedisSessionStore) CompleteFormToken(ctx context.Context, id, recordID string) error {
+	_, err := s.do(ctx, "SET", s.formTokenKey(id)+":used", recordID, "XX", "KEEPTTL")
+	return err
+}
+
+// DeleteExpiredFormTokens is a no-op: Redis expires form tokens itself.
+func (s *RedisSessionStore) DeleteExpiredFormTokens(ctx context.Context) error { return nil }
+
+// redisConn is one connection speaking RESP, the Redis protocol.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do runs one command on a pooled connection. Replies are strings, int64s, nil or []interface{} of those.
+func (s *RedisSessionStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := s.conn(ctx)
+	if err != nil { return nil, err }
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) { deadline = d }
+	c.SetDeadline(deadline)
+	reply, err := c.roundTrip(args)
+	if _, isReply := err.(redisError); err != nil && !isReply { c.Close(); return nil, err }
+	select {
+	case s.idle <- c:
+	default: c.Close()
+	}
+	return reply, err
+}
+
+func (s *RedisSessionStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-s.idle: return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: s.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil { return nil, err }
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	c.SetDeadline(time.Now().Add(s.Timeout))
+	if s.Password != "" {
+		if _, err := c.roundTrip([]string{"AUTH", s.Password}); err != nil { c.Close(); return nil, err }
+	}
+	if s.DB != 0 {
+		if _, err := c.roundTrip([]string{"SELECT", strconv.Itoa(s.DB)}); err != nil { c.Close(); return nil, err }
+	}
+	return c, nil
+}
+
+func (c *redisConn) roundTrip(args []string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args { fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a) }
+	if _, err := io.WriteString(c, b.String()); err != nil { return nil, err }
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil { return nil, err }
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") { return nil, fmt.Errorf("redis: malformed reply %q", line) }
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 { return nil, err }
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil { return nil, err }
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 { return nil, err }
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil { if _, isReply := err.(redisError); !isReply { return nil, err } }
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -1,12 +1,20 @@
 package admin
 
 import (
-	"fmt"
+	"context"
+	"crypto/rand"
 	"github.com/ajeet-kumar1087/go-admin/config"
 	"github.com/ajeet-kumar1087/go-admin/models"
 	"github.com/ajeet-kumar1087/go-admin/resource"
 	"gorm.io/gorm"
+	"log/slog"
 	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,89 +22,390 @@ import (
 type Resource = resource.Resource
 type Field = resource.Field
 type Config = config.Config
+type PasswordPolicy = config.PasswordPolicy
+type Branding = config.Branding
+type OIDCConfig = config.OIDCConfig
 type AdminUser = models.AdminUser
 type Session = models.Session
 type Permission = models.Permission
 type AuditLog = models.AuditLog
+type SavedFilter = models.SavedFilter
+type UserPreference = models.UserPreference
+type WebhookDelivery = models.WebhookDelivery
+type PasswordResetToken = models.PasswordResetToken
+type LoginEvent = models.LoginEvent
+type Comment = models.Comment
+type ExportJob = models.ExportJob
+type BatchJob = models.BatchJob
+type FormToken = models.FormToken
+type EditLock = models.EditLock
+type Draft = models.Draft
+type Watch = models.Watch
+type ScheduledReport = models.ScheduledReport
+type Setting = models.Setting
 type Scope = resource.Scope
+type DefaultFunc = resource.DefaultFunc
+type VirtualFunc = resource.VirtualFunc
+type RenderFunc = resource.RenderFunc
+type VisibleFunc = resource.VisibleFunc
+type UserVisibleFunc = resource.UserVisibleFunc
+type ActionContext = resource.ActionContext
+type ActionResult = resource.ActionResult
+type BatchContext = resource.BatchContext
+type SaveHook = resource.SaveHook
+type DeleteHook = resource.DeleteHook
+type CurrencyOptions = resource.CurrencyOptions
+type FooterAggregate = resource.FooterAggregate
+type Option = resource.Option
+type OptionsFunc = resource.OptionsFunc
 
+const (
+	CountExact     = resource.CountExact
+	CountCached    = resource.CountCached
+	CountEstimated = resource.CountEstimated
+)
+
+const (
+	DependentBlock   = resource.DependentBlock
+	DependentCascade = resource.DependentCascade
+	DependentNullify = resource.DependentNullify
+)
+
+// Registry holds everything the admin serves. Resources, Pages and Charts may be registered while serving;
+// read them through GetResource, ResourceNames and friends rather than the fields directly once the server runs.
 type Registry struct {
-	DB        *gorm.DB
-	Resources map[string]*resource.Resource
-	Pages     map[string]*Page
-	Charts    []Chart
-	Config    *config.Config
+	DB            *gorm.DB
+	Resources     map[string]*resource.Resource
+	Pages         map[string]*Page
+	Charts        []*Chart
+	Widgets       []*DashboardWidget
+	Stats         []*DashboardStat
+	Webhooks      []WebhookConfig
+	Config        *config.Config
+	Logger        Logger
+	translator    Translator
+	Metrics       MetricsCollector
+	counts        *countCache
+	chartCache    *chartCache
+	webhooks      *webhookDispatcher
+	exports       *exportDispatcher
+	batchJobs     *exportDispatcher
+	mailer        Mailer
+	notifications []actionNotification
+	sessionStore  SessionStore
+	cleanup       sync.Once
+	trashPurger   sync.Once
+	scheduler     sync.Once
+	maintenance   maintenanceCache
+	settingsGroups []*SettingsGroup // added with RegisterSettings
+	settings      settingsCache
+	templates     *templateStore
+	middlewares   []Middleware
+	scopeAll      ScopeFunc
+	roles         map[string]Grant // defined with DefineRole
+	signingKey    []byte // signs upload links when Config.SecretKey is unset
+	builtinUsers  *resource.Resource // the Users resource until the app registers AdminUser itself
+	readDB        *gorm.DB
+	oidc          *oidcProvider // discovered on the first SSO sign-in
+	keys          *keyRing // the parsed encryption keys, guarded by mu
+	// background is cancelled by BeginShutdown to stop the workers started with goBackground, which Close waits for.
+	background    context.Context
+	stopBackground context.CancelFunc
+	workers       sync.WaitGroup
+	draining      atomic.Bool
+	// validated runs Validate once, on the first request; see checkValidation.
+	validated      sync.Once
+	validationErrs []error
+	mu            sync.RWMutex
 }
 
 type Page struct {
 	Name, Group string
 	Handler     http.HandlerFunc
+	// HandlerWithUser, set by AddUserPage, is called instead of Handler with the signed-in user.
+	HandlerWithUser UserHandlerFunc
+	Priority        int
+	// VisibleTo and Visible restrict the page to some roles or users, as for fields; others neither see it in the
+	// navigation nor may open it.
+	VisibleTo []string
+	Visible   UserVisibleFunc
 }
 
+// VisibleFor reports whether user may see and open the page; admins always may.
+func (p *Page) VisibleFor(user *models.AdminUser) bool {
+	if !visibleToRoles(p.VisibleTo, user) { return false }
+	return p.Visible == nil || (user != nil && (user.Role == "admin" || p.Visible(user)))
+}
+
+// visibleToRoles reports whether a dashboard or navigation entry restricted to roles shows for user: always when
+// roles is empty, and to admins.
+func visibleToRoles(roles []string, user *models.AdminUser) bool {
+	if len(roles) == 0 { return true }
+	return user != nil && (user.Role == "admin" || slices.Contains(roles, user.Role))
+}
+
+// Chart is a dashboard chart. Data is the original, range-less provider; charts added with AddRangedChart or
+// AddSeriesChart set Provider or Series instead and get range buttons.
 type Chart struct {
-	Label string
-	Type  string
-	Data  func(db *gorm.DB) (labels []string, values []float64)
+	Label    string
+	Type     string
+	Data     func(db *gorm.DB) (labels []string, values []float64)
+	Provider ChartProvider
+	Series   SeriesProvider
+	Stacked  bool
+	// CacheTTL keeps each range's data for this long, shared by all users; admins can force a refresh.
+	CacheTTL time.Duration
+	// VisibleTo shows the chart only to these roles (and admins); empty shows it to everyone.
+	VisibleTo []string
 }
 
 func NewRegistry(db *gorm.DB) *Registry {
-	return &Registry{
+	reg := &Registry{
 		DB: db, Resources: make(map[string]*resource.Resource), Pages: make(map[string]*Page), 
-		Charts: []Chart{}, Config: config.DefaultConfig(),
+		Charts: []*Chart{}, Config: config.DefaultConfig(), Logger: slog.Default(), translator: NewMapTranslator(), Metrics: NewPrometheusMetrics(),
+		counts: newCountCache(), chartCache: newChartCache(), webhooks: newWebhookDispatcher(), exports: newExportDispatcher(&models.ExportJob{}), batchJobs: newExportDispatcher(&models.BatchJob{}),
+		templates: &templateStore{files: make(map[string]templateFile)}, signingKey: make([]byte, 32),
 	}
+	rand.Read(reg.signingKey)
+	reg.background, reg.stopBackground = context.WithCancel(context.Background())
+	reg.AddDashboardWidget("Recent activity", reg.renderActivity)
+	reg.registerUsers()
+	return reg
 }
 
 // Public Factory Functions
 func DefaultConfig() *config.Config { return config.DefaultConfig() }
 func LoadConfig(path string) (*config.Config, error) { return config.LoadConfig(path) }
 func NewResource(model interface{}) *resource.Resource { return resource.NewResource(model) }
+func Param(name, label, fieldType string, required bool, options ...string) Field {
+	return resource.Param(name, label, fieldType, required, options...)
+}
+func ParamValues(r *http.Request) map[string]interface{} { return resource.ParamValues(r) }
+
+// dbFor scopes the DB handle to the request context, so cancelled requests and timeouts stop their queries.
+func (reg *Registry) dbFor(r *http.Request) *gorm.DB { return reg.DB.WithContext(r.Context()) }
 
-func (reg *Registry) SetConfig(c *config.Config) { reg.Config = c }
+// SetReadDB sends the admin's read-only queries to db, typically a replica: lists, show pages, exports, searches,
+// counts and the dashboard's stats, charts and activity feed. Saves, deletes, sessions and the audit log stay on
+// the primary DB, so a list shown right after a save may lag behind it by the replica's delay. Row-level scopes
+// and request contexts apply on both handles. A nil db reads from the primary again.
+func (reg *Registry) SetReadDB(db *gorm.DB) *Registry {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	reg.readDB = db
+	return reg
+}
 
-func (reg *Registry) AddChart(l, t string, p func(db *gorm.DB) ([]string, []float64)) {
-	reg.Charts = append(reg.Charts, Chart{Label: l, Type: t, Data: p})
+// reader is the handle for read-only queries under ctx: the read DB when one is set, else the primary.
+func (reg *Registry) reader(ctx context.Context) *gorm.DB {
+	reg.mu.RLock(); db := reg.readDB; reg.mu.RUnlock()
+	if db == nil { db = reg.DB }
+	return db.WithContext(ctx)
 }
 
-func (reg *Registry) AddPage(n, g string, h http.HandlerFunc) {
-	reg.Pages[n] = &Page{Name: n, Group: g, Handler: h}
+// readFor is dbFor for read-only queries; see SetReadDB.
+func (reg *Registry) readFor(r *http.Request) *gorm.DB { return reg.reader(r.Context()) }
+
+func (reg *Registry) SetConfig(c *config.Config) {
+	reg.Config = c
+	reg.templates = &templateStore{files: make(map[string]templateFile)}
 }
 
+// setPassword hashes password for u with Config.BcryptCost once it meets Config.PasswordPolicy.
+func (reg *Registry) setPassword(u *models.AdminUser, password string) error {
+	return u.SetPasswordWith(password, reg.Config.PasswordPolicy, reg.Config.BcryptCost)
+}
+
+// Handler returns the admin with its base path stripped, for use as mux.Handle(cfg.BasePath+"/", reg.Handler()).
+func (reg *Registry) Handler() http.Handler { return http.StripPrefix(reg.basePath(), reg) }
+
+// URL builds an absolute admin link, e.g. reg.URL("/Product") is "/admin/Product" with the default base path.
+func (reg *Registry) URL(path string) string { return reg.basePath() + path }
+
+func (reg *Registry) basePath() string { return strings.TrimRight(reg.Config.BasePath, "/") }
+
+func (reg *Registry) cookiePath() string {
+	if p := reg.basePath(); p != "" { return p }
+	return "/"
+}
+
+// AddChart adds a single-series chart; set CacheTTL on the returned chart to cache its data.
+func (reg *Registry) AddChart(l, t string, p func(db *gorm.DB) ([]string, []float64)) *Chart {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	c := &Chart{Label: l, Type: t, Data: p}
+	reg.Charts = append(reg.Charts, c)
+	return c
+}
+
+// AddPage registers a custom page; set Priority on the returned page to move it within its group.
+func (reg *Registry) AddPage(n, g string, h http.HandlerFunc) *Page {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	p := &Page{Name: n, Group: g, Handler: h}
+	reg.Pages[n] = p
+	return p
+}
+
+// Register adds a model as a resource. Registering a model that is already registered updates the existing
+// resource's model and returns it, so configuration made through either call applies.
 func (reg *Registry) Register(m interface{}) *resource.Resource {
 	res := resource.NewResource(m)
-	reg.Resources[res.Name] = res
-	fmt.Printf("Registered resource: %s\n", res.Name)
+	if sch, err := reg.parseSchema(m); err == nil && sch.PrioritizedPrimaryField != nil { res.PrimaryKey = sch.PrioritizedPrimaryField.Name }
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	for _, existing := range reg.Resources {
+		if existing.TypeName() == res.TypeName() {
+			if reflect.TypeOf(existing.Model) != reflect.TypeOf(m) { existing.SetModel(m) }
+			if existing == reg.builtinUsers { existing.Fields, existing.EditFields, reg.builtinUsers = nil, nil, nil }
+			return existing
+		}
+	}
+	reg.Resources[res.Slug] = res
+	reg.Logger.Debug("resource registered", "resource", res.Name, "slug", res.Slug)
 	return res
 }
 
+// GetResource finds a resource by slug, falling back to the model's struct name so associations
+// declared against the type keep working after SetSlug.
 func (reg *Registry) GetResource(n string) (*resource.Resource, bool) {
-	res, ok := reg.Resources[n]; return res, ok
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	if res, ok := reg.Resources[n]; ok && res.Slug == n { return res, true }
+	for _, res := range reg.Resources { if res.Slug == n { return res, true } }
+	for _, res := range reg.Resources { if res.TypeName() == n { return res, true } }
+	return nil, false
+}
+
+func (reg *Registry) getPage(n string) (*Page, bool) {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	p, ok := reg.Pages[n]; return p, ok
 }
 
 func (reg *Registry) ResourceNames() []string {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
 	names := make([]string, 0, len(reg.Resources))
-	for n := range reg.Resources { names = append(names, n) }
+	for _, r := range reg.Resources { names = append(names, r.Slug) }
+	sort.Strings(names)
 	return names
 }
 
-func (reg *Registry) getGroupedResources() map[string][]*resource.Resource {
+// PermissionActions lists the grantable permission actions: the built-in ones, then the permissions of every
+// registered custom action, e.g. for the options of a permissions form.
+func (reg *Registry) PermissionActions() []string {
+	actions := []string{"list", "show", "new", "edit", "save", "delete", "export", "action"}
+	seen := make(map[string]bool)
+	for _, a := range actions { seen[a] = true }
+	var custom []string
+	add := func(p string) { if !seen[p] { seen[p] = true; custom = append(custom, p) } }
+	for _, res := range reg.sortedResources() {
+		for _, a := range res.MemberActions { add(a.Permission()) }
+		for _, a := range res.CollectionActions { add(a.Permission()) }
+		for _, a := range res.BatchActions { add(a.Permission()) }
+	}
+	sort.Strings(custom)
+	return append(actions, custom...)
+}
+
+// sortedResources returns the resources ordered by priority, then name.
+func (reg *Registry) sortedResources() []*resource.Resource {
+	reg.mu.RLock()
+	list := make([]*resource.Resource, 0, len(reg.Resources))
+	for _, r := range reg.Resources { list = append(list, r) }
+	reg.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority { return list[i].Priority < list[j].Priority }
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func groupName(g string) string {
+	if g == "" { return "Default" }
+	return g
+}
+
+// resourceMap returns a copy of the registered resources, keyed by slug, that is safe to range over while others register.
+func (reg *Registry) resourceMap() map[string]*resource.Resource {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	m := make(map[string]*resource.Resource, len(reg.Resources))
+	for _, r := range reg.Resources { m[r.Slug] = r }
+	return m
+}
+
+func (reg *Registry) charts() []*Chart {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	return append([]*Chart(nil), reg.Charts...)
+}
+
+// getGroupedResources groups the navigation's resources: those not hidden that user may list, or all of them for
+// a nil user.
+func (reg *Registry) getGroupedResources(user *models.AdminUser) map[string][]*resource.Resource {
+	var listable map[string]bool
+	if user != nil { listable = reg.allowedResources(user.Role, "list") }
 	groups := make(map[string][]*resource.Resource)
-	for _, r := range reg.Resources {
-		g := r.Group; if g == "" { g = "Default" }; groups[g] = append(groups[g], r)
+	for _, r := range reg.sortedResources() {
+		if r.Hidden || (listable != nil && !listable[r.Slug]) { continue }
+		groups[groupName(r.Group)] = append(groups[groupName(r.Group)], r)
 	}
 	return groups
 }
 
-func (reg *Registry) getGroupedPages() map[string][]*Page {
+// allowedResources returns the slugs role holds action on, as IsAllowed decides it but in one query; nil means
+// every resource, for admins.
+func (reg *Registry) allowedResources(role, action string) map[string]bool {
+	if role == "admin" { return nil }
+	var names []string
+	reg.DB.Model(&models.Permission{}).Where("role = ? AND action = ?", role, action).Pluck("resource_name", &names)
+	allowed := make(map[string]bool, len(names))
+	for _, n := range names { if n != usersSlug { allowed[n] = true } }
+	return allowed
+}
+
+// getGroupedPages groups the navigation's custom pages that user may see, or all of them for a nil user.
+func (reg *Registry) getGroupedPages(user *models.AdminUser) map[string][]*Page {
+	reg.mu.RLock()
+	list := make([]*Page, 0, len(reg.Pages))
+	for _, p := range reg.Pages { if user == nil || p.VisibleFor(user) { list = append(list, p) } }
+	reg.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority { return list[i].Priority < list[j].Priority }
+		return list[i].Name < list[j].Name
+	})
 	groups := make(map[string][]*Page)
-	for _, p := range reg.Pages {
-		g := p.Group; if g == "" { g = "Default" }; groups[g] = append(groups[g], p)
-	}
+	for _, p := range list { groups[groupName(p.Group)] = append(groups[groupName(p.Group)], p) }
 	return groups
 }
 
+// navGroups returns the names of all resource and page groups in display order: the unnamed "Default" group,
+// then Config.GroupOrder, then the rest alphabetically. A "Default" entry in GroupOrder moves the unnamed group.
+// Groups with nothing user may see are left out.
+func (reg *Registry) navGroups(user *models.AdminUser) []string {
+	seen := make(map[string]bool)
+	for g := range reg.getGroupedResources(user) { seen[g] = true }
+	for g := range reg.getGroupedPages(user) { seen[g] = true }
+	var order []string
+	listed := make(map[string]bool)
+	for _, g := range reg.Config.GroupOrder { listed[g] = true }
+	if !listed["Default"] && seen["Default"] { order = append(order, "Default") }
+	for _, g := range reg.Config.GroupOrder {
+		if seen[g] { order = append(order, g); delete(seen, g) }
+	}
+	delete(seen, "Default")
+	var rest []string
+	for g := range seen { rest = append(rest, g) }
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
 func (reg *Registry) RecordAction(user *models.AdminUser, resName, recordID, action, changes string) {
-	reg.DB.Create(&models.AuditLog{
+	if reg.recordAction(reg.DB, user, resName, recordID, action, changes) == nil { reg.afterAudit(user, resName, recordID, action, changes) }
+}
+
+// recordAction writes an audit entry through db, so entries made inside a transaction roll back with it.
+// Callers inside a transaction call afterAudit themselves once it commits. A transaction on a resource's own DB (see
+// RegisterWithDB) can't hold the entry, which is then written to the registry's DB straight away.
+func (reg *Registry) recordAction(db *gorm.DB, user *models.AdminUser, resName, recordID, action, changes string) error {
+	if !onDB(db, reg.DB) { db = reg.DB.WithContext(db.Statement.Context) }
+	entry := &models.AuditLog{
 		UserID: user.ID, UserEmail: user.Email, ResourceName: resName, 
 		RecordID: recordID, Action: action, Changes: changes, CreatedAt: time.Now(),
-	})
+	}
+	if imp := user.Impersonator; imp != nil { entry.ImpersonatorID, entry.UserEmail = imp.ID, imp.Email+" as "+user.Email }
+	return db.Create(entry).Error
 }
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// positionRow is one record of a reorderable resource, in list order.
+type positionRow struct {
+	ID  string
+	Pos int64
+}
+
+// nextPosition returns max(position)+1 for a reorderable resource, for appending new records.
+func (reg *Registry) nextPosition(db *gorm.DB, res *resource.Resource) (int64, error) {
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return 0, err }
+	col, ok := column(sch, res.PositionField)
+	if !ok { return 0, fmt.Errorf("reorder: %s has no field %q", res.Name, res.PositionField) }
+	var last int64
+	err = db.Model(res.Model).Select(fmt.Sprintf("COALESCE(MAX(%s), 0)", col)).Scan(&last).Error
+	return last + 1, err
+}
+
+// handleReorder rewrites positions within the current scope. It takes either ?id=&move=up|down from the row
+// controls or an ordered list of ids (e.g. one page after drag and drop). The records keep the position slots they
+// already occupied, made strictly increasing, so records outside the scope or page are not disturbed.
+func (reg *Registry) handleReorder(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	r.ParseForm()
+	back := reg.URL("/" + res.Slug + "?scope=" + url.QueryEscape(r.FormValue("scope")))
+	lq, err := reg.buildListQueryOn(reg.resourceDB(r.Context(), res), res, url.Values{"scope": {r.FormValue("scope")}})
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	col, ok := column(lq.Schema, res.PositionField)
+	if !ok { http.Error(w, fmt.Sprintf("%s has no field %q", res.Name, res.PositionField), 400); return }
+	var rows []positionRow
+	if err := lq.DB.Select(fmt.Sprintf("%s AS id, %s AS pos", lq.PK, col)).Order(col + " asc").Order(lq.PK + " asc").Scan(&rows).Error; err != nil {
+		reg.renderError(w, r, 500, err); return
+	}
+	index := make(map[string]int)
+	for i, row := range rows { index[row.ID] = i }
+
+	order := make([]string, len(rows))
+	for i, row := range rows { order[i] = row.ID }
+	if id, move := r.URL.Query().Get("id"), r.URL.Query().Get("move"); move != "" {
+		i, ok := index[id]
+		j := i - 1; if move == "down" { j = i + 1 }
+		if !ok || j < 0 || j >= len(order) { http.Redirect(w, r, back, 303); return }
+		order[i], order[j] = order[j], order[i]
+	} else {
+		// The posted ids take over the slots they occupy, in their new order.
+		var slots []int
+		var ids []string
+		for _, id := range r.Form["ids"] {
+			if i, ok := index[id]; ok { slots = append(slots, i); ids = append(ids, id) }
+		}
+		sort.Ints(slots)
+		for k, slot := range slots { order[slot] = ids[k] }
+	}
+
+	positions := make([]int64, len(rows))
+	for i, row := range rows {
+		positions[i] = row.Pos
+		if i > 0 && positions[i] <= positions[i-1] { positions[i] = positions[i-1] + 1 }
+	}
+	field := lq.Schema.LookUpField(res.PositionField).DBName
+	note := "New order: " + strings.Join(order, ", ")
+	err = reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+		for i, id := range order {
+			if rows[index[id]].Pos == positions[i] { continue }
+			model := reflect.New(reflect.TypeOf(res.Model)).Interface()
+			if err := tx.Model(model).Where(lq.PK+" = ?", id).Update(field, positions[i]).Error; err != nil { return err }
+		}
+		return reg.recordAction(tx, user, res.Slug, "", "Reorder", note)
+	})
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.afterAudit(user, res.Slug, "", "Reorder", note)
+	reg.setFlash(w, reg.T(r.Context(), "%s order saved", reg.resName(r.Context(), res)))
+	http.Redirect(w, r, back, 303)
+}
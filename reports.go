@@ -0,0 +1,291 @@
+package admin
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportRetries is how many times a failed report run is retried before it waits for its next scheduled time.
+const reportRetries = 5
+
+// reportBackoff is the delay before a failed report's first retry; it doubles with each further failure.
+const reportBackoff = time.Minute
+
+// reportFormats are the export formats a scheduled report can send.
+var reportFormats = []string{"csv"}
+
+// ReportsData is the scheduled reports page: the user's reports, and the form creating or editing one (Edit) with
+// the resources they may export and their saved filters to start from.
+type ReportsData struct {
+	Reports   []ReportRow
+	Edit      models.ScheduledReport
+	Resources []*resource.Resource
+	Filters   []models.SavedFilter
+	Formats   []string
+	Timezone  string
+	Error     string
+}
+
+// ReportRow is a report on the scheduled reports page, with its next run on its own time zone's clock.
+type ReportRow struct {
+	Report   models.ScheduledReport
+	Resource *resource.Resource
+	NextRun  string
+}
+
+// reportEmail is the data for templates/emails/scheduled_report.html.
+type reportEmail struct {
+	SiteTitle, Name, Resource, RunAt string
+	Rows                             int64
+	Attached                         bool
+	Link, ReportsLink                string // Link downloads the file when it isn't attached
+}
+
+// StartScheduler runs due scheduled reports every interval, starting now, until BeginShutdown. Only the first call
+// starts it; several processes may run it against the same database.
+func (reg *Registry) StartScheduler(interval time.Duration) {
+	reg.scheduler.Do(func() {
+		reg.goBackground(func(ctx context.Context) {
+			for {
+				reg.runDueReports(ctx, time.Now())
+				select {
+				case <-ctx.Done(): return
+				case <-time.After(interval):
+				}
+			}
+		})
+	})
+}
+
+// reportLocation is the time zone a report's schedule is read in; UTC when it has none or it is unknown.
+func reportLocation(tz string) *time.Location {
+	if loc, err := time.LoadLocation(tz); err == nil { return loc }
+	return time.UTC
+}
+
+// nextReportRun is when rep is next due after after, or nil when its schedule never matches again.
+func nextReportRun(rep models.ScheduledReport, after time.Time) *time.Time {
+	sched, err := parseCron(rep.Schedule)
+	if err != nil { return nil }
+	next := sched.Next(after, reportLocation(rep.Timezone))
+	if next.IsZero() { return nil }
+	return &next
+}
+
+// runDueReports runs the enabled reports due by now, one at a time. Each is claimed by moving its NextRunAt on
+// before it runs, so another process running the scheduler skips it. A failed run is retried after reportBackoff,
+// doubling, up to reportRetries times; then it waits for its next scheduled time.
+func (reg *Registry) runDueReports(ctx context.Context, now time.Time) {
+	var due []models.ScheduledReport
+	if err := reg.DB.Where("enabled = ? AND next_run_at <= ?", true, now).Order("next_run_at, id").Find(&due).Error; err != nil {
+		reg.Logger.Error("loading due reports failed", "error", err)
+		return
+	}
+	for _, rep := range due {
+		if ctx.Err() != nil { return }
+		next := nextReportRun(rep, now)
+		claim := reg.DB.Model(&models.ScheduledReport{}).Where("id = ? AND enabled = ? AND next_run_at <= ?", rep.ID, true, now).Update("next_run_at", next)
+		if claim.Error != nil || claim.RowsAffected == 0 { continue }
+		jobID, err := reg.runReport(ctx, rep)
+		updates := map[string]interface{}{"last_run_at": now, "last_job_id": jobID, "last_error": "", "failures": 0, "next_run_at": next}
+		if err != nil {
+			reg.Logger.Error("scheduled report failed", "report", rep.ID, "resource", rep.ResourceName, "attempt", rep.Failures+1, "error", err)
+			updates["last_error"], updates["failures"] = err.Error(), rep.Failures+1
+			if rep.Failures < reportRetries {
+				if retry := now.Add(reportBackoff << rep.Failures); next == nil || retry.Before(*next) { updates["next_run_at"] = retry }
+			} else {
+				updates["failures"] = 0
+			}
+		}
+		if err := reg.DB.Model(&models.ScheduledReport{}).Where("id = ?", rep.ID).Updates(updates).Error; err != nil { reg.Logger.Error("saving report run failed", "report", rep.ID, "error", err) }
+	}
+}
+
+// runReport exports rep's list as its creator, through an export job listed on their Exports page, and emails the
+// file to its recipients: attached when it is at most Config.ReportAttachmentLimit bytes and the mailer can
+// attach, else as a signed download link. It returns the job's id, 0 when none was created.
+func (reg *Registry) runReport(ctx context.Context, rep models.ScheduledReport) (uint, error) {
+	m := reg.getMailer()
+	if m == nil { return 0, errors.New("no mailer is configured") }
+	var user models.AdminUser
+	if err := reg.DB.WithContext(ctx).First(&user, rep.UserID).Error; err != nil { return 0, fmt.Errorf("loading the report's creator: %w", err) }
+	res, ok := reg.GetResource(rep.ResourceName)
+	switch {
+	case !user.Active: return 0, errors.New("the report's creator is deactivated")
+	case !ok: return 0, fmt.Errorf("unknown resource %q", rep.ResourceName)
+	case !reg.canExport(res, user.Role): return 0, fmt.Errorf("%s may no longer export %s", user.Email, res.Name)
+	}
+	job := models.ExportJob{UserID: user.ID, ResourceName: res.Slug, Query: rep.Query, Status: exportQueued}
+	if err := reg.DB.WithContext(ctx).Create(&job).Error; err != nil { return 0, err }
+	reg.runExportJob(job.ID)
+	if err := reg.DB.WithContext(ctx).First(&job, job.ID).Error; err != nil { return job.ID, err }
+	if job.Status != exportDone { return job.ID, fmt.Errorf("export %s: %s", job.Status, job.Error) }
+
+	path := filepath.Join(reg.Config.ExportDir, job.File)
+	info, err := os.Stat(path)
+	if err != nil { return job.ID, err }
+	data := reportEmail{SiteTitle: reg.Config.SiteTitle, Name: rep.Name, Resource: res.Name, Rows: job.Rows, ReportsLink: reg.absoluteURL("/reports"), RunAt: time.Now().In(reportLocation(rep.Timezone)).Format("2006-01-02 15:04 MST")}
+	var att *Attachment
+	if am, ok := m.(AttachmentMailer); ok && info.Size() <= reg.Config.ReportAttachmentLimit {
+		content, err := os.ReadFile(path)
+		if err != nil { return job.ID, err }
+		att, data.Attached = &Attachment{Name: fmt.Sprintf("%s-%s.csv", res.Slug, time.Now().Format("2006-01-02")), ContentType: "text/csv; charset=utf-8", Data: content}, true
+		m = am
+	} else {
+		data.Link = reg.reportLink(job.ID)
+	}
+	subject, html, text, err := reg.renderEmail("scheduled_report", data)
+	if err != nil { return job.ID, err }
+	var errs []error
+	for _, to := range reportRecipients(rep.Recipients) {
+		if att != nil { err = m.(AttachmentMailer).SendAttachment(to, subject, html, text, *att) } else { err = m.Send(to, subject, html, text) }
+		if err != nil { errs = append(errs, fmt.Errorf("%s: %w", to, err)) }
+	}
+	return job.ID, errors.Join(errs...)
+}
+
+// reportRecipients splits a report's comma-separated recipients.
+func reportRecipients(s string) []string {
+	var to []string
+	for _, addr := range strings.Split(s, ",") { if addr = strings.TrimSpace(addr); addr != "" { to = append(to, addr) } }
+	return to
+}
+
+// reportLinkTTL is how long a report's download link works: as long as Config.ExportRetention keeps the file, or a
+// week when files are kept.
+func (reg *Registry) reportLinkTTL() time.Duration {
+	if reg.Config.ExportRetention > 0 { return time.Duration(reg.Config.ExportRetention) * time.Hour }
+	return 7 * 24 * time.Hour
+}
+
+// reportLink is a signed link to an export job's file that works without signing in, for report recipients.
+func (reg *Registry) reportLink(jobID uint) string {
+	id, expires := strconv.FormatUint(uint64(jobID), 10), strconv.FormatInt(time.Now().Add(reg.reportLinkTTL()).Unix(), 10)
+	return reg.absoluteURL("/reports/download?" + url.Values{"job": {id}, "expires": {expires}, "sig": {reg.sign("report", id, expires)}}.Encode())
+}
+
+// handleReportDownload serves a report's signed download link, /reports/download?job=N&expires=…&sig=….
+func (reg *Registry) handleReportDownload(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires || !hmac.Equal([]byte(q.Get("sig")), []byte(reg.sign("report", q.Get("job"), q.Get("expires")))) {
+		http.Error(w, "This link is invalid or has expired", http.StatusForbidden)
+		return
+	}
+	var job models.ExportJob
+	if err := reg.dbFor(r).First(&job, q.Get("job")).Error; err != nil { http.Error(w, "Not found", 404); return }
+	serveExportFile(w, r, reg.Config.ExportDir, job)
+}
+
+// reportResources are the resources user may export, which reports can be made of.
+func (reg *Registry) reportResources(user *models.AdminUser) []*resource.Resource {
+	var list []*resource.Resource
+	for _, res := range reg.sortedResources() { if reg.canExport(res, user.Role) { list = append(list, res) } }
+	return list
+}
+
+// parseReport reads the report form into rep, for user: a saved filter, when chosen, gives the resource and query.
+// The schedule is read in user's time zone, which the report keeps.
+func (reg *Registry) parseReport(r *http.Request, rep *models.ScheduledReport, user *models.AdminUser) error {
+	rep.Name, rep.Format, rep.Schedule = strings.TrimSpace(r.FormValue("name")), r.FormValue("format"), strings.TrimSpace(r.FormValue("schedule"))
+	rep.ResourceName, rep.Query, rep.Enabled, rep.Timezone = r.FormValue("resource"), strings.TrimPrefix(strings.TrimSpace(r.FormValue("query")), "?"), r.FormValue("enabled") != "", user.Timezone
+	rep.Recipients = strings.Join(reportRecipients(r.FormValue("recipients")), ", ")
+	if id := r.FormValue("filter_id"); id != "" {
+		var f models.SavedFilter
+		if err := reg.dbFor(r).Where("id = ? AND (user_id = ? OR (role <> '' AND role = ?))", id, user.ID, user.Role).First(&f).Error; err != nil { return errors.New("That saved filter is not available.") }
+		rep.ResourceName, rep.Query = f.ResourceName, f.Query
+		if rep.Name == "" { rep.Name = f.Name }
+	}
+	res, ok := reg.GetResource(rep.ResourceName)
+	if rep.Format == "" { rep.Format = reportFormats[0] }
+	switch {
+	case rep.Name == "": return errors.New("Name is required.")
+	case !ok || !reg.canExport(res, user.Role): return errors.New("Pick a resource you may export.")
+	case !slices.Contains(reportFormats, rep.Format): return fmt.Errorf("%q is not a report format.", rep.Format)
+	case rep.Recipients == "": return errors.New("Add at least one recipient.")
+	}
+	rep.ResourceName = res.Slug
+	if _, err := url.ParseQuery(rep.Query); err != nil { return fmt.Errorf("The filter query is not valid: %v", err) }
+	for _, to := range reportRecipients(rep.Recipients) {
+		if _, err := mail.ParseAddress(to); err != nil { return fmt.Errorf("%q is not an email address.", to) }
+	}
+	if _, err := parseCron(rep.Schedule); err != nil { return err }
+	rep.NextRunAt, rep.Failures, rep.LastError = nextReportRun(*rep, time.Now()), 0, ""
+	return nil
+}
+
+// handleReports serves the signed-in user's scheduled reports at /reports (?id=N opens one in the form), and POST
+// /reports/save, /reports/delete and /reports/run, which sends a report now without moving its schedule.
+func (reg *Registry) handleReports(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser) {
+	data := &ReportsData{Resources: reg.reportResources(user), Formats: reportFormats, Timezone: user.Timezone, Edit: models.ScheduledReport{Schedule: "0 8 * * 1", Format: reportFormats[0], Enabled: true}}
+	var rep models.ScheduledReport
+	if id := r.FormValue("id"); id != "" {
+		if err := reg.dbFor(r).Where("id = ? AND user_id = ?", id, user.ID).First(&rep).Error; err != nil { reg.renderRecordError(w, r, err); return }
+		data.Edit = rep
+	}
+	if upath != "/reports" && r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+	switch upath {
+	case "/reports":
+	case "/reports/save":
+		rep.UserID = user.ID
+		if err := reg.parseReport(r, &rep, user); err != nil {
+			data.Error, data.Edit = err.Error(), rep
+			break
+		}
+		if err := reg.dbFor(r).Save(&rep).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		reg.setFlash(w, reg.T(r.Context(), "Report %q saved", rep.Name))
+		http.Redirect(w, r, reg.URL("/reports"), 303)
+		return
+	case "/reports/delete":
+		if rep.ID == 0 { http.NotFound(w, r); return }
+		if err := reg.dbFor(r).Delete(&rep).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		reg.setFlash(w, reg.T(r.Context(), "Report %q deleted", rep.Name))
+		http.Redirect(w, r, reg.URL("/reports"), 303)
+		return
+	case "/reports/run":
+		if rep.ID == 0 { http.NotFound(w, r); return }
+		reg.goBackground(func(ctx context.Context) {
+			jobID, err := reg.runReport(ctx, rep)
+			updates := map[string]interface{}{"last_run_at": time.Now(), "last_job_id": jobID, "last_error": ""}
+			if err != nil { reg.Logger.Error("report run failed", "report", rep.ID, "error", err); updates["last_error"] = err.Error() }
+			reg.DB.Model(&models.ScheduledReport{}).Where("id = ?", rep.ID).Updates(updates)
+		})
+		reg.setFlash(w, reg.T(r.Context(), "Report %q is being sent", rep.Name))
+		http.Redirect(w, r, reg.URL("/reports"), 303)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var reports []models.ScheduledReport
+	if err := reg.dbFor(r).Where("user_id = ?", user.ID).Order("name, id").Find(&reports).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	for _, rp := range reports {
+		row := ReportRow{Report: rp}
+		if res, ok := reg.GetResource(rp.ResourceName); ok { row.Resource = res }
+		if rp.Enabled && rp.NextRunAt != nil { row.NextRun = rp.NextRunAt.In(reportLocation(rp.Timezone)).Format("2006-01-02 15:04 MST") }
+		data.Reports = append(data.Reports, row)
+	}
+	for _, res := range data.Resources { data.Filters = append(data.Filters, reg.presetsFor(r.Context(), res, user)...) }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/reports.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.execute(w, r, tmpl, "reports.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), Reports: data,
+		Title: reg.T(r.Context(), "Scheduled reports"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Scheduled reports")}),
+	})
+}
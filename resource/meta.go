@@ -0,0 +1,55 @@
+package resource
+
+import "reflect"
+
+// Meta caches the reflection lookups list rendering repeats for every row: the model and slice types and the index
+// path of every field by name, including fields promoted from embedded structs. It is computed once per model type
+// and shared by concurrent requests; see Resource.Meta.
+type Meta struct {
+	Type      reflect.Type // the model's struct type
+	SliceType reflect.Type // a slice of the registered model, for loading lists
+	index     map[string][]int
+}
+
+func newMeta(model interface{}) *Meta {
+	mt := reflect.TypeOf(model)
+	m := &Meta{Type: mt, SliceType: reflect.SliceOf(mt), index: make(map[string][]int)}
+	if m.Type.Kind() == reflect.Ptr { m.Type = m.Type.Elem() }
+	if m.Type.Kind() != reflect.Struct { return m }
+	for _, sf := range reflect.VisibleFields(m.Type) {
+		// FieldByName settles names promoted from several embedded structs at the same depth, as field access does.
+		if f, ok := m.Type.FieldByName(sf.Name); ok { m.index[sf.Name] = f.Index }
+	}
+	return m
+}
+
+// Meta returns the resource's cached reflection metadata, computing it on first use. Replace the model with
+// SetModel, which clears the cache, rather than by assigning Model.
+func (r *Resource) Meta() *Meta {
+	if m := r.meta.Load(); m != nil { return m }
+	m := newMeta(r.Model)
+	r.meta.Store(m)
+	return m
+}
+
+// SetModel replaces the resource's model and clears its cached metadata.
+func (r *Resource) SetModel(model interface{}) *Resource { r.Model = model; r.meta.Store(nil); return r }
+
+// Value returns the named field of item, a model value or pointer, or the zero Value when the model has no such
+// field or it sits behind a nil embedded pointer.
+func (m *Meta) Value(item reflect.Value, name string) reflect.Value {
+	item = reflect.Indirect(item)
+	if !item.IsValid() || item.Kind() != reflect.Struct { return reflect.Value{} }
+	index, ok := m.index[name]
+	if item.Type() != m.Type {
+		sf, found := item.Type().FieldByName(name)
+		if !found { return reflect.Value{} }
+		index = sf.Index
+	} else if !ok {
+		return reflect.Value{}
+	}
+	if len(index) == 1 { return item.Field(index[0]) }
+	v, err := item.FieldByIndexErr(index)
+	if err != nil { return reflect.Value{} }
+	return v
+}
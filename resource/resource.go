@@ -1,61 +1,538 @@
 package resource
 
 import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
 	"gorm.io/gorm"
 	"html/template"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
 type ActionHandler func(res *Resource, w http.ResponseWriter, r *http.Request)
 type BatchActionHandler func(res *Resource, ids []string, w http.ResponseWriter, r *http.Request)
+
+// JSONActionHandler runs an Action with JSON set. Its result is sent as the "data" of an {ok, message, data}
+// response, an ActionResult setting the message too; an error fails the action with its text as the message.
+type JSONActionHandler func(ctx *ActionContext) (interface{}, error)
+
+// ActionContext is what a JSON action runs on: the record's id for member actions (IDs holds it too), the parsed
+// params, the signed-in user, and the request for anything else.
+type ActionContext struct {
+	Resource *Resource
+	ID       string
+	IDs      []string
+	Params   map[string]interface{}
+	User     *models.AdminUser
+	Request  *http.Request
+}
+
+// BatchJobHandler runs a batch job action on one batch of records; see AddBatchJobAction. Returning an error fails
+// the batch's records that weren't already marked with Fail.
+type BatchJobHandler func(ctx *BatchContext) error
+
+// BatchContext is one batch of a batch job action: its ids, the action's params and the user who started it.
+// Context is cancelled when the job is, so long-running handlers should check it.
+type BatchContext struct {
+	Context  context.Context
+	Resource *Resource
+	IDs      []string
+	Params   map[string]interface{}
+	User     *models.AdminUser
+	// Failed holds the errors of records that failed on their own, by id; see Fail.
+	Failed map[string]string
+}
+
+// Fail marks the record id as failed with err; the batch's other records count as processed.
+func (c *BatchContext) Fail(id string, err error) {
+	if c.Failed == nil { c.Failed = make(map[string]string) }
+	c.Failed[id] = err.Error()
+}
+
+// ActionResult lets a JSON action return a message to show along with its data.
+type ActionResult struct {
+	Message string
+	Data    interface{}
+}
 type ScopeFunc func(db *gorm.DB) *gorm.DB
 type DecoratorFunc func(val interface{}) template.HTML
 type SidebarHandler func(res *Resource, item interface{}) template.HTML
 
-type Action struct{ Name, Label string; Handler ActionHandler }
-type BatchAction struct{ Name, Label string; Handler BatchActionHandler }
+// RenderFunc renders a list or show cell as raw HTML. Implementations are responsible for escaping any
+// user-controlled text they include, e.g. with admin.HTMLEscape.
+type RenderFunc func(value interface{}, item map[string]interface{}) template.HTML
+
+// VirtualFunc computes a virtual field from the row's real field values. It runs once per row; db is provided
+// so implementors can query related data, or batch and memoise lookups if per-row queries get too slow.
+type VirtualFunc func(db *gorm.DB, item map[string]interface{}) interface{}
+
+// DuplicateMatcher finds existing records a new one may duplicate from its submitted values of the checked fields.
+// db is limited to the records the user may see; each match should carry the record's key as "id" and may carry a
+// "label" to show.
+type DuplicateMatcher func(db *gorm.DB, values map[string]string) []map[string]interface{}
+
+// DefaultFunc computes a field's default on new record forms from the signed-in user.
+type DefaultFunc func(user *models.AdminUser) interface{}
+
+// Count strategies control how list and dashboard row counts are computed.
+const (
+	CountExact     = "exact"
+	CountCached    = "cached"
+	CountEstimated = "estimated"
+)
+
+// SaveHook runs on form and batch saves with the populated model (a pointer); isNew is true when creating.
+// An error from a BeforeSave hook aborts the save and is shown to the user.
+type SaveHook func(db *gorm.DB, user *models.AdminUser, item interface{}, isNew bool) error
+
+// DeleteHook runs before a record is deleted through the admin; an error aborts the delete.
+type DeleteHook func(db *gorm.DB, user *models.AdminUser, id string) error
+
+// VisibleFunc decides whether a member action applies to a record for a user; UserVisibleFunc only looks at the user.
+type VisibleFunc func(user *models.AdminUser, item map[string]interface{}) bool
+type UserVisibleFunc func(user *models.AdminUser) bool
+
+// Safe actions may run on read-only resources; see Resource.MarkActionSafe. Actions with Params ask for them
+// in a form first; handlers read the parsed values with ParamValues. Visible only applies to member actions.
+// RequiredPermission is the permission action granting it, the action's name by default; see SetActionPermission.
+// JSON actions run JSONHandler on POST and answer with JSON instead of a page; see AddMemberJSONAction.
+type Action struct{ Name, Label string; Handler ActionHandler; Safe bool; Params []Field; Visible VisibleFunc; VisibleTo UserVisibleFunc; RequiredPermission string; JSON bool; JSONHandler JSONActionHandler }
+// Batch actions added with AddBatchJobAction set JobHandler instead of Handler.
+type BatchAction struct{ Name, Label string; Handler BatchActionHandler; JobHandler BatchJobHandler; Safe bool; Params []Field; VisibleTo UserVisibleFunc; RequiredPermission string }
+
+// Permission is the permission action that grants running a, besides the generic "action" permission.
+func (a Action) Permission() string {
+	if a.RequiredPermission != "" { return a.RequiredPermission }
+	return a.Name
+}
+
+func (a BatchAction) Permission() string {
+	if a.RequiredPermission != "" { return a.RequiredPermission }
+	return a.Name
+}
+
+// IsVisible reports whether the action is shown to user; item is nil for collection actions.
+func (a Action) IsVisible(user *models.AdminUser, item map[string]interface{}) bool {
+	if a.VisibleTo != nil && !a.VisibleTo(user) { return false }
+	return item == nil || a.Visible == nil || a.Visible(user, item)
+}
+
+func (a BatchAction) IsVisible(user *models.AdminUser) bool { return a.VisibleTo == nil || a.VisibleTo(user) }
 type Scope struct{ Name, Label string; Handler ScopeFunc }
 type Sidebar struct{ Label string; Handler SidebarHandler }
-type Association struct{ Type, Name, ResourceName, ForeignKey, Label string }
+
+// Section groups fields on the form and show pages; sections with a Tab are rendered inside that tab.
+type Section struct {
+	Title, Tab string
+	Fields     []string
+}
+
+// FieldGroup is a section resolved against the fields of a view. Tabs is only set on the first tabbed group,
+// which is where the tab bar is rendered.
+type FieldGroup struct {
+	Title, Tab string
+	Fields     []Field
+	Tabs       []string
+}
+
+// Association links a resource to another. OnDelete is what deleting a record does to the HasMany and HasOne
+// records still referring to it, one of the Dependent strategies; blank blocks the delete.
+type Association struct{ Type, Name, ResourceName, ForeignKey, Label, OnDelete string }
+type AssociationFilter struct{ Association, Field, Label string }
+
+// Param is the query parameter carrying the filter value on list and export URLs.
+func (f AssociationFilter) Param() string { return "af_" + f.Association + "." + f.Field }
 
 type Field struct {
 	Name, Label, Type string
 	Options           []string
 	Readonly          bool
+	Required          bool
 	Searchable        bool
 	SearchResource    string
 	Decorator         DecoratorFunc
 	Sortable          bool
+	// Default pre-fills new record forms; either a static value or a DefaultFunc.
+	Default interface{}
+	// RenderHTML, when set, replaces the escaped value in list and show cells.
+	RenderHTML RenderFunc
+	// Virtual fields have no column; Compute fills them in on list, show and export.
+	Virtual bool
+	Compute VirtualFunc
+	// DisplayOnly fields appear on lists and show pages but not on forms, e.g. CreatedAt.
+	DisplayOnly bool
+	// Currency formats "currency" fields; nil means "$" with 2 decimals. See SetCurrency.
+	Currency *CurrencyOptions
+	// CountOf names the HasMany association a "count" field counts; see AddCountField.
+	CountOf string
+	// VisibleTo and Visible restrict the field to some roles or users; see SetFieldVisibleTo and SetFieldVisible.
+	VisibleTo []string
+	Visible   UserVisibleFunc
+	// HelpText explains the field under its form input and as a tooltip on the show page; see SetHelpText.
+	HelpText template.HTML
+	// Placeholder, Prefix and Suffix decorate the form input, e.g. "$" before a price or "kg" after a weight.
+	Placeholder, Prefix, Suffix string
+	// VisibleWhen shows the field on forms and show pages only while another field's value matches; see SetVisibleWhen.
+	VisibleWhen *Condition
+	// InlineEditable fields can be edited in place on the list by users who may edit the record; see SetInlineEditable.
+	InlineEditable bool
+	// DependsOn names the field whose value OptionsFiltered narrows the field's choices by; see SetDependentOptions.
+	DependsOn       string
+	OptionsFiltered OptionsFunc
+	// ExportRaw exports the field's value as stored rather than through its Decorator; see SetExportRaw.
+	ExportRaw bool
+	// Encrypted fields are stored encrypted with Config.EncryptionKey and shown in clear only to the DecryptFor roles;
+	// exports mask them unless ExportDecrypted. See SetEncrypted.
+	Encrypted       bool
+	DecryptFor      []string
+	ExportDecrypted bool
+}
+
+// Option is a choice of a dependent select: the value saved and the label shown.
+type Option struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// OptionsFunc returns the choices a dependent field offers while its parent field holds parent, as text; parent is
+// empty when nothing is chosen.
+type OptionsFunc func(db *gorm.DB, parent string) []Option
+
+// Condition compares a field's value, as text, with Values: Op "eq" and "in" hold when it equals one of them,
+// "ne" and "not_in" when it equals none.
+type Condition struct {
+	Field, Op string
+	Values    []string
+}
+
+// Holds reports whether value satisfies the condition.
+func (c Condition) Holds(value string) bool {
+	found := false
+	for _, v := range c.Values { if v == value { found = true; break } }
+	if c.Op == "ne" || c.Op == "not_in" { return !found }
+	return found
+}
+
+// JSON encodes the condition for the form's script, which toggles the field as the controlling input changes.
+func (c Condition) JSON() string {
+	b, _ := json.Marshal(map[string]interface{}{"field": c.Field, "negate": c.Op == "ne" || c.Op == "not_in", "values": c.Values})
+	return string(b)
+}
+
+// CanDecrypt reports whether user may see the encrypted field in clear: their role must be one of DecryptFor.
+func (f Field) CanDecrypt(user *models.AdminUser) bool {
+	if user == nil { return false }
+	for _, role := range f.DecryptFor { if role == user.Role { return true } }
+	return false
+}
+
+// VisibleFor reports whether user may see the field. Unrestricted fields are visible to everyone and the admin
+// role sees every field; restricted fields are hidden when there is no user.
+func (f Field) VisibleFor(user *models.AdminUser) bool {
+	if len(f.VisibleTo) == 0 && f.Visible == nil { return true }
+	if user == nil { return false }
+	if user.Role == "admin" { return true }
+	if len(f.VisibleTo) > 0 {
+		allowed := false
+		for _, role := range f.VisibleTo { if role == user.Role { allowed = true; break } }
+		if !allowed { return false }
+	}
+	return f.Visible == nil || f.Visible(user)
+}
+
+// FooterAggregate totals a list column in the index table's footer; Func is "sum" or "avg".
+type FooterAggregate struct{ Field, Func string }
+
+// CurrencyOptions formats a "currency" field, which stores an integer amount of minor units (e.g. cents).
+type CurrencyOptions struct {
+	Symbol   string
+	Decimals int
 }
 
 type Resource struct {
-	Model             interface{}
-	Name, Path, Group string
-	Fields            []Field
-	IndexFields       []string
-	ShowFields        []string
-	EditFields        []string
-	MemberActions     []Action
-	CollectionActions []Action
-	BatchActions      []BatchAction
-	Scopes            []Scope
-	Associations      []Association
-	Sidebars          []Sidebar
-	Attributes        map[string]interface{}
+	Model              interface{}
+	Name, Path, Group  string
+	Slug, Icon         string
+	Fields             []Field
+	IndexFields        []string
+	ShowFields         []string
+	EditFields         []string
+	// ExportPaths are the export's columns: field names, or dot-paths into BelongsTo associations; see ExportFields.
+	ExportPaths        []string
+	MemberActions      []Action
+	CollectionActions  []Action
+	BatchActions       []BatchAction
+	Scopes             []Scope
+	Associations       []Association
+	AssociationFilters []AssociationFilter
+	Sidebars           []Sidebar
+	Sections           []Section
+	Attributes         map[string]interface{}
+	PerPage            int
+	CursorPagination   bool
+	CountStrategy      string
+	// DefaultScope names the scope lists, exports, searches and dashboard counts use when no scope is asked for; see SetDefaultScope.
+	DefaultScope string
+	// EmptyState replaces the list's "No … records yet" message when there are no records; EmptyStateHTML, when set,
+	// replaces the whole message block. Neither is used when filters or a scope hide every record.
+	EmptyState     string
+	EmptyStateHTML template.HTML
+	// Labels holds per-locale labels by field name, "" naming the resource itself; see SetLabel.
+	Labels map[string]map[string]string
+	// ShowScopeCounts shows each scope tab's record count under the current filters; see EnableScopeCounts.
+	ShowScopeCounts bool
+	// Hidden resources are routable but left out of the navigation, e.g. lookup tables only used as associations.
+	Hidden bool
+	// APIDisabled resources are left out of the JSON API and its OpenAPI spec; their pages still work. See DisableAPI.
+	APIDisabled bool
+	// ReadOnly resources can be listed, shown and exported but never created, edited or deleted through the admin.
+	ReadOnly bool
+	// Priority orders the resource within its navigation group and on the dashboard; lower comes first, ties sort by name.
+	Priority int
+	// PositionField names an integer field holding a manual sort order; see EnableReordering.
+	PositionField string
+	// StickyFields keep their submitted values on the new form that "Save and add another" opens; see SetStickyFields.
+	StickyFields []string
+	// PrimaryKey names the field holding the record key; Register detects it from the model's GORM schema.
+	PrimaryKey string
+	// HiddenFromDashboard leaves the resource out of the dashboard's automatic count cards.
+	HiddenFromDashboard bool
+	// BoardField groups the optional board view into one column per value; BoardCardFields are shown on its cards.
+	BoardField      string
+	BoardCardFields []string
+	// CalendarStart and CalendarEnd name the time fields placing records on the optional calendar view.
+	CalendarStart, CalendarEnd string
+	// DuplicateFields are checked for likely duplicates before a record is created, by DuplicateMatcher or, when
+	// it is nil, by a case-insensitive exact match on any of them; see DuplicateCheck.
+	DuplicateFields  []string
+	DuplicateMatcher DuplicateMatcher
+	// TreeField names a field holding the key of the record's parent record, for the optional tree view; see EnableTree.
+	TreeField string
+	// TreeReparent moves a deleted tree record's children up to its parent instead of refusing the delete.
+	TreeReparent bool
+	// AssignField holds the AdminUser id a record is assigned to; see EnableAssignment.
+	AssignField string
+	// AssignRoles limits who records can be assigned to; empty allows every active user.
+	AssignRoles []string
+	// AssignNotify emails users when a record is assigned to them; see NotifyAssignee.
+	AssignNotify bool
+	// CreatedByField and UpdatedByField hold the AdminUser ids of a record's creator and last editor; see TrackUserStamps.
+	CreatedByField, UpdatedByField string
+	// MetadataHidden leaves the created/updated panel off the resource's show pages; see HideMetadata.
+	MetadataHidden bool
+	// Comments adds an internal comments panel to show pages; see EnableComments.
+	Comments bool
+	// Mergeable offers "Merge with…" on show pages, for folding duplicate records into one; see EnableMerge.
+	Mergeable bool
+	// TrashRetentionDays is how long soft-deleted records are kept before the trash purger deletes them; see TrashRetention.
+	TrashRetentionDays int
+	// AsyncExports runs every export of the resource as a background job; see AsyncExport.
+	AsyncExports bool
+	// FooterAggregates are computed over the whole filtered list and shown below the index table.
+	FooterAggregates []FooterAggregate
+	// DB holds the resource's records when they live outside the registry's DB; see Registry.RegisterWithDB.
+	DB *gorm.DB
+	BeforeSave          []SaveHook
+	AfterSave           []SaveHook
+	BeforeDelete        []DeleteHook
+	meta                atomic.Pointer[Meta]
 }
 
 func NewResource(model interface{}) *Resource {
 	t := reflect.TypeOf(model)
 	if t.Kind() == reflect.Ptr { t = t.Elem() }
-	return &Resource{Model: model, Name: t.Name(), Path: "/" + t.Name()}
+	return &Resource{Model: model, Name: t.Name(), Slug: t.Name(), Path: "/" + t.Name(), PrimaryKey: "ID"}
+}
+
+// TypeName is the model's struct name, which associations and GetResource fall back to when the slug differs.
+func (r *Resource) TypeName() string {
+	t := reflect.TypeOf(r.Model)
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	return t.Name()
 }
 
 func (r *Resource) SetGroup(group string) *Resource { r.Group = group; return r }
+
+// SetName changes the display name used in navigation and headings; URLs keep using the slug.
+func (r *Resource) SetName(name string) *Resource { r.Name = name; return r }
+
+// SetSlug changes the URL segment, which is also the key for permissions, audit entries and saved views.
+func (r *Resource) SetSlug(slug string) *Resource { r.Slug = slug; r.Path = "/" + slug; return r }
+
+// SetPrimaryKey overrides the detected key field, e.g. to look records up by one field of a composite GORM key.
+func (r *Resource) SetPrimaryKey(field string) *Resource { r.PrimaryKey = field; return r }
+func (r *Resource) SetIcon(icon string) *Resource { r.Icon = icon; return r }
+func (r *Resource) Hide() *Resource { r.Hidden = true; return r }
+func (r *Resource) SetReadOnly(readOnly bool) *Resource { r.ReadOnly = readOnly; return r }
+// DuplicateCheck warns before a record is created when it likely duplicates an existing one: the save is held and
+// the form lists the matches, with a button to create the record anyway. Pass a nil matcher to match records with
+// the same value, ignoring case, in any of fields.
+func (r *Resource) DuplicateCheck(fields []string, matcher DuplicateMatcher) *Resource {
+	r.DuplicateFields, r.DuplicateMatcher = fields, matcher
+	return r
+}
+
+// DisableAPI refuses the resource's JSON list, show and search forms and bulk creates, and leaves it out of the OpenAPI spec.
+func (r *Resource) DisableAPI() *Resource { r.APIDisabled = true; return r }
+func (r *Resource) HideFromDashboard() *Resource { r.HiddenFromDashboard = true; return r }
+func (r *Resource) OnBeforeSave(h SaveHook) *Resource { r.BeforeSave = append(r.BeforeSave, h); return r }
+func (r *Resource) OnAfterSave(h SaveHook) *Resource { r.AfterSave = append(r.AfterSave, h); return r }
+func (r *Resource) OnBeforeDelete(h DeleteHook) *Resource { r.BeforeDelete = append(r.BeforeDelete, h); return r }
+
+// MarkActionSafe allows the named member, collection or batch action to run while the resource is read-only.
+func (r *Resource) MarkActionSafe(name string) *Resource {
+	for i := range r.MemberActions { if r.MemberActions[i].Name == name { r.MemberActions[i].Safe = true } }
+	for i := range r.CollectionActions { if r.CollectionActions[i].Name == name { r.CollectionActions[i].Safe = true } }
+	for i := range r.BatchActions { if r.BatchActions[i].Name == name { r.BatchActions[i].Safe = true } }
+	return r
+}
+
+// SetActionParams makes the named member, collection or batch action ask for params before running.
+// Params are plain fields: "number" values are parsed to float64, "select" values must be one of the options.
+func (r *Resource) SetActionParams(name string, params ...Field) *Resource {
+	for i := range r.MemberActions { if r.MemberActions[i].Name == name { r.MemberActions[i].Params = params } }
+	for i := range r.CollectionActions { if r.CollectionActions[i].Name == name { r.CollectionActions[i].Params = params } }
+	for i := range r.BatchActions { if r.BatchActions[i].Name == name { r.BatchActions[i].Params = params } }
+	return r
+}
+
+// SetActionPermission makes the named member, collection or batch action require perm (or the generic "action"
+// permission) instead of its own name, e.g. to let several actions share one grant.
+func (r *Resource) SetActionPermission(name, perm string) *Resource {
+	for i := range r.MemberActions { if r.MemberActions[i].Name == name { r.MemberActions[i].RequiredPermission = perm } }
+	for i := range r.CollectionActions { if r.CollectionActions[i].Name == name { r.CollectionActions[i].RequiredPermission = perm } }
+	for i := range r.BatchActions { if r.BatchActions[i].Name == name { r.BatchActions[i].RequiredPermission = perm } }
+	return r
+}
+
+// SetActionVisible shows the named member action only on records (and to users) for which fn returns true.
+func (r *Resource) SetActionVisible(name string, fn VisibleFunc) *Resource {
+	for i := range r.MemberActions { if r.MemberActions[i].Name == name { r.MemberActions[i].Visible = fn } }
+	return r
+}
+
+// SetActionVisibleTo shows the named member, collection or batch action only to users for which fn returns true.
+func (r *Resource) SetActionVisibleTo(name string, fn UserVisibleFunc) *Resource {
+	for i := range r.MemberActions { if r.MemberActions[i].Name == name { r.MemberActions[i].VisibleTo = fn } }
+	for i := range r.CollectionActions { if r.CollectionActions[i].Name == name { r.CollectionActions[i].VisibleTo = fn } }
+	for i := range r.BatchActions { if r.BatchActions[i].Name == name { r.BatchActions[i].VisibleTo = fn } }
+	return r
+}
+
+// Param declares an action param; see SetActionParams.
+func Param(name, label, fieldType string, required bool, options ...string) Field {
+	return Field{Name: name, Label: label, Type: fieldType, Required: required, Options: options}
+}
+
+type paramsKey struct{}
+
+// WithParamValues returns r carrying the parsed action params.
+func WithParamValues(r *http.Request, values map[string]interface{}) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, values))
+}
+
+// ParamValues returns the parsed params of the running action, or nil for actions without params.
+func ParamValues(r *http.Request) map[string]interface{} {
+	values, _ := r.Context().Value(paramsKey{}).(map[string]interface{})
+	return values
+}
+
+// ActionSafe reports whether the named action of the given kind ("action", "collection_action" or "batch_action") is marked safe.
+func (r *Resource) ActionSafe(kind, name string) bool {
+	switch kind {
+	case "batch_action":
+		for _, a := range r.BatchActions { if a.Name == name { return a.Safe } }
+		return false
+	case "collection_action":
+		for _, a := range r.CollectionActions { if a.Name == name { return a.Safe } }
+		return false
+	}
+	for _, a := range r.MemberActions { if a.Name == name { return a.Safe } }
+	return false
+}
+func (r *Resource) SetPriority(p int) *Resource { r.Priority = p; return r }
+
+// EnableReordering lets records be put in a manual order kept in the given integer field. The list view sorts by it
+// and offers up/down controls, POST <resource>/reorder accepts an ordered id list, and new records are appended last.
+func (r *Resource) EnableReordering(field string) *Resource { r.PositionField = field; return r }
+
+// SetStickyFields names fields whose values carry over to the next new form after "Save and add another", for
+// entering runs of records that share them (e.g. the same customer or date).
+func (r *Resource) SetStickyFields(names ...string) *Resource { r.StickyFields = names; return r }
 func (r *Resource) RegisterField(name, label string, readonly bool) *Resource {
 	r.Fields = append(r.Fields, Field{Name: name, Label: label, Type: "text", Readonly: readonly, Sortable: true})
 	return r
 }
+
+// RegisterModelFields registers the model's columns that are not registered yet, in declaration order and including
+// fields promoted from embedded structs such as gorm.Model. The primary key is readonly, CreatedAt, UpdatedAt and
+// the TrackUserStamps columns are DisplayOnly, time fields are "datetime", []string fields with a GORM serializer
+// become "tags", and DeletedAt, associations and `gorm:"-"` fields are skipped.
+func (r *Resource) RegisterModelFields() *Resource {
+	t := reflect.TypeOf(r.Model)
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	r.registerStructFields(t)
+	return r
+}
+
+func (r *Resource) registerStructFields(t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type; if ft.Kind() == reflect.Ptr { ft = ft.Elem() }
+		if sf.Anonymous && ft.Kind() == reflect.Struct && !isColumnType(ft) { r.registerStructFields(ft); continue }
+		tag := sf.Tag.Get("gorm")
+		serialized := strings.Contains(tag, "serializer:")
+		if !sf.IsExported() || strings.HasPrefix(tag, "-") || ft == deletedAtType || !(serialized || isColumnType(ft)) { continue }
+		if r.hasField(sf.Name) { continue }
+		f := Field{Name: sf.Name, Label: fieldLabel(sf.Name), Type: "text", Readonly: sf.Name == r.PrimaryKey, Sortable: true}
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.String { f.Type, f.Sortable = "tags", false }
+		if ft == timeType { f.Type = "datetime" }
+		if sf.Name == "CreatedAt" || sf.Name == "UpdatedAt" || r.IsUserStamp(sf.Name) { f.Readonly, f.DisplayOnly = true, true }
+		r.Fields = append(r.Fields, f)
+	}
+}
+
+func (r *Resource) hasField(name string) bool {
+	for _, f := range r.Fields { if f.Name == name { return true } }
+	return false
+}
+
+var (
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	timeType      = reflect.TypeOf(time.Time{})
+	valuerType    = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// isColumnType reports whether a field of type t maps to a single column rather than an association.
+func isColumnType(t reflect.Type) bool {
+	if t == timeType || t.Implements(valuerType) || reflect.PointerTo(t).Implements(valuerType) { return true }
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// fieldLabel turns a field name into a label, e.g. "CreatedAt" into "Created At" and "CustomerID" into "Customer ID".
+func fieldLabel(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, c := range runes {
+		if i > 0 && unicode.IsUpper(c) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) { b.WriteByte(' ') }
+		b.WriteRune(c)
+	}
+	return b.String()
+}
 func (r *Resource) SetSortable(name string, sortable bool) *Resource {
 	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Sortable = sortable; break } }
 	return r
@@ -64,6 +541,237 @@ func (r *Resource) SetDecorator(name string, fn DecoratorFunc) *Resource {
 	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Decorator = fn; break } }
 	return r
 }
+
+// SetInlineEditable lets the named fields be edited by clicking their list cells. Only fields the "Edit field"
+// batch action offers qualify, less tags: plain values, not files, images or passwords.
+func (r *Resource) SetInlineEditable(names ...string) *Resource {
+	for _, name := range names {
+		for i, f := range r.Fields { if f.Name == name { r.Fields[i].InlineEditable = true; break } }
+	}
+	return r
+}
+
+// SetDependentOptions makes the field a select whose options fn returns for the current value of the parent field,
+// e.g. states for a country. The form reloads them when the parent changes, saves refuse a value fn doesn't offer
+// for the submitted parent, and the field can't be batch or inline edited, since its records' parents differ.
+func (r *Resource) SetDependentOptions(name, parent string, fn OptionsFunc) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].DependsOn, r.Fields[i].OptionsFiltered = parent, fn; break } }
+	return r
+}
+
+// SetRenderer renders the field's list and show cells as HTML; see RenderFunc.
+func (r *Resource) SetRenderer(name string, fn RenderFunc) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].RenderHTML = fn; break } }
+	return r
+}
+
+// AddVirtualField adds a read-only computed column to the list and show views and exports. Virtual fields are
+// never part of forms, saves or filters.
+func (r *Resource) AddVirtualField(name, label string, compute VirtualFunc) *Resource {
+	r.Fields = append(r.Fields, Field{Name: name, Label: label, Type: "virtual", Readonly: true, Virtual: true, Compute: compute})
+	return r
+}
+
+// EnableBoardView adds a board view to the index page with a column per value of field (its select options, or
+// else the values present) and a card per record showing its label and cardFields. Dragging a card to another
+// column saves the new value like an edit.
+func (r *Resource) EnableBoardView(field string, cardFields ...string) *Resource {
+	r.BoardField, r.BoardCardFields = field, cardFields
+	return r
+}
+
+// EnableCalendarView adds a month and week calendar to the index page placing each record from its start time to its
+// end time; end may be "" or a nil *time.Time for point-in-time records. Registered text fields of those names become
+// "datetime" fields.
+func (r *Resource) EnableCalendarView(start, end string) *Resource {
+	r.CalendarStart, r.CalendarEnd = start, end
+	for i, f := range r.Fields { if (f.Name == start || f.Name == end) && f.Type == "text" { r.Fields[i].Type = "datetime" } }
+	return r
+}
+
+// EnableTree shows the index page as an expandable tree of records linked by parentField, the key of each record's
+// parent (zero or nil for roots), and adds a breadcrumb to show and edit pages and a "Move under…" action. The parent
+// picker leaves out the record and its descendants, and saves that would create a cycle are refused. A BelongsTo
+// association on parentField is added unless one exists. Records with children can't be deleted unless
+// ReparentOnDelete is set.
+func (r *Resource) EnableTree(parentField string) *Resource {
+	r.TreeField = parentField
+	if _, ok := r.GetAssociation(parentField); !ok { r.BelongsTo(parentField, "Parent", r.TypeName(), parentField) }
+	return r
+}
+
+// ReparentOnDelete makes deleting a tree record move its children up to its parent.
+func (r *Resource) ReparentOnDelete() *Resource { r.TreeReparent = true; return r }
+
+// AssignedToMe names the list scope EnableAssignment adds.
+const AssignedToMe = "assigned_to_me"
+
+// EnableAssignment assigns records to admin users through field, an integer (or nullable integer) column holding
+// the assignee's AdminUser id. Show pages get an "Assign to…" control listing the active users with one of roles
+// (any role when none are given), lists and show pages display the assignee's email, the list filter picks a user,
+// and an "Assigned to me" scope lists the viewer's records. Assignments are audited as "Assign".
+func (r *Resource) EnableAssignment(field string, roles ...string) *Resource {
+	r.AssignField, r.AssignRoles = field, roles
+	found := false
+	for i := range r.Fields {
+		if r.Fields[i].Name == field { r.Fields[i].Type, r.Fields[i].DisplayOnly, found = "assignee", true, true }
+	}
+	if !found { r.Fields = append(r.Fields, Field{Name: field, Label: "Assigned to", Type: "assignee", DisplayOnly: true, Sortable: true}) }
+	for _, s := range r.Scopes { if s.Name == AssignedToMe { return r } }
+	return r.AddScope(AssignedToMe, "Assigned to me", r.assignedToMe)
+}
+
+// NotifyAssignee emails users when a record is assigned to them by someone else; it needs a mailer.
+func (r *Resource) NotifyAssignee() *Resource { r.AssignNotify = true; return r }
+
+// assignedToMe narrows a list to the records assigned to the user in the query's context, or to none without one.
+func (r *Resource) assignedToMe(db *gorm.DB) *gorm.DB {
+	user := UserFrom(db.Statement.Context)
+	if user == nil { return db.Where("1 = 0") }
+	col := r.AssignField
+	if err := db.Statement.Parse(db.Statement.Model); err == nil {
+		if f := db.Statement.Schema.LookUpField(col); f != nil { col = db.Statement.Schema.Table + "." + f.DBName }
+	}
+	return db.Where(col+" = ?", user.ID)
+}
+
+// userKey is the context key carrying the signed-in admin user.
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying user, the admin user a request is served for.
+func WithUser(ctx context.Context, user *models.AdminUser) context.Context { return context.WithValue(ctx, userKey{}, user) }
+
+// UserFrom returns the admin user ctx carries, or nil.
+func UserFrom(ctx context.Context) *models.AdminUser {
+	if ctx == nil { return nil }
+	user, _ := ctx.Value(userKey{}).(*models.AdminUser)
+	return user
+}
+
+// EnableScopeCounts shows how many records each scope tab holds, e.g. "Published (142)", under the list's current
+// filters. It costs one COUNT per scope on every list view; pair it with CountCached on large tables.
+func (r *Resource) EnableScopeCounts() *Resource { r.ShowScopeCounts = true; return r }
+
+// SetLabel overrides a field's label in a locale, e.g. SetLabel("de", "Total", "Summe"). An empty field names the
+// resource itself, as the navigation, titles and breadcrumbs show it.
+func (r *Resource) SetLabel(locale, field, label string) *Resource {
+	if r.Labels == nil { r.Labels = make(map[string]map[string]string) }
+	if r.Labels[locale] == nil { r.Labels[locale] = make(map[string]string) }
+	r.Labels[locale][field] = label
+	return r
+}
+
+// Localized returns the label SetLabel gave field ("" for the resource) in locale, or in its language alone
+// ("de" for "de-AT").
+func (r *Resource) Localized(locale, field string) (string, bool) {
+	if l, ok := r.Labels[locale][field]; ok { return l, true }
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if l, ok := r.Labels[locale[:i]][field]; ok { return l, true }
+	}
+	return "", false
+}
+
+// SetEmptyState sets the message a list shows before its first record is created.
+func (r *Resource) SetEmptyState(message string) *Resource { r.EmptyState = message; return r }
+
+// SetEmptyStateHTML sets custom markup for a list with no records, e.g. with a link to the setup docs.
+func (r *Resource) SetEmptyStateHTML(html template.HTML) *Resource { r.EmptyStateHTML = html; return r }
+
+// TrashRetention permanently deletes the resource's soft-deleted records (those with a gorm.DeletedAt set) once
+// they have been in the trash for days, when Registry.StartTrashPurger runs or an admin uses "Purge trash now".
+func (r *Resource) TrashRetention(days int) *Resource { r.TrashRetentionDays = days; return r }
+
+// AsyncExport runs the resource's CSV exports as background jobs whatever their size: the export link queues a job
+// and leads to the Exports page, which links to the file once it is written.
+func (r *Resource) AsyncExport(on bool) *Resource { r.AsyncExports = on; return r }
+
+// TrackUserStamps records who created and who last saved each record, as AdminUser ids in two integer (or
+// nullable integer) columns; either name may be empty. The columns are filled on save from the acting user,
+// never from the form, and shown as names in the show page's metadata panel.
+func (r *Resource) TrackUserStamps(createdBy, updatedBy string) *Resource {
+	r.CreatedByField, r.UpdatedByField = createdBy, updatedBy
+	for i := range r.Fields { if r.IsUserStamp(r.Fields[i].Name) { r.Fields[i].Readonly, r.Fields[i].DisplayOnly = true, true } }
+	return r
+}
+
+// IsUserStamp reports whether name is one of the columns TrackUserStamps fills.
+func (r *Resource) IsUserStamp(name string) bool {
+	return name != "" && (name == r.CreatedByField || name == r.UpdatedByField)
+}
+
+// HideMetadata leaves the created/updated panel off the resource's show pages.
+func (r *Resource) HideMetadata() *Resource { r.MetadataHidden = true; return r }
+
+// EnableComments lets users with show permission leave internal notes on records, listed on the show page.
+// Comments are stored in the Comment table, so the model needs no extra columns.
+func (r *Resource) EnableComments() *Resource { r.Comments = true; return r }
+
+// EnableMerge offers "Merge with…" on show pages to users who may edit and delete records: they pick a duplicate,
+// compare the two side by side and choose which record's value each field keeps. The record merged into is updated,
+// the duplicate's HasMany children are moved to it through their foreign keys, and the duplicate is deleted (or
+// trashed). Merging is refused while a HasMany association lacks a foreign key it can be moved by.
+func (r *Resource) EnableMerge() *Resource { r.Mergeable = true; return r }
+
+// AddCountField adds a sortable list column counting each record's associated records through a HasMany
+// association, linking to the associated list filtered to that record.
+func (r *Resource) AddCountField(name, association string) *Resource {
+	r.Fields = append(r.Fields, Field{Name: name, Label: name, Type: "count", Readonly: true, Virtual: true, Sortable: true, CountOf: association})
+	return r
+}
+
+// AddFooterAggregate shows the "sum" or "avg" of a field in the index table's footer, computed over every record
+// matching the current scope and filters rather than just the visible page.
+func (r *Resource) AddFooterAggregate(field, fn string) *Resource {
+	r.FooterAggregates = append(r.FooterAggregates, FooterAggregate{Field: field, Func: fn})
+	return r
+}
+
+// SetDefault sets the value a field starts with on new record forms; pass a DefaultFunc to compute it per user.
+func (r *Resource) SetDefault(name string, value interface{}) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Default = value; break } }
+	return r
+}
+
+// FieldSection groups fields under a titled section on the form and show pages.
+func (r *Resource) FieldSection(title string, fields ...string) *Resource {
+	r.Sections = append(r.Sections, Section{Title: title, Fields: fields}); return r
+}
+
+// FieldTab puts fields on a tab of their own; calling it again with the same tab adds another section to it.
+func (r *Resource) FieldTab(tab string, fields ...string) *Resource {
+	r.Sections = append(r.Sections, Section{Tab: tab, Fields: fields}); return r
+}
+
+// GroupFields arranges fields into the declared sections. Fields in no section come first in an untitled group,
+// so a resource without sections gets a single group holding every field; tabbed groups always come last.
+func (r *Resource) GroupFields(fields []Field) []FieldGroup {
+	placed := make(map[string]bool)
+	var plain, tabbed []FieldGroup
+	var tabs []string
+	for _, s := range r.Sections {
+		g := FieldGroup{Title: s.Title, Tab: s.Tab}
+		for _, name := range s.Fields {
+			for _, f := range fields { if f.Name == name && !placed[name] { g.Fields = append(g.Fields, f); placed[name] = true } }
+		}
+		if len(g.Fields) == 0 { continue }
+		if g.Tab == "" { plain = append(plain, g); continue }
+		known := false
+		for _, t := range tabs { if t == g.Tab { known = true } }
+		if !known { tabs = append(tabs, g.Tab) }
+		tabbed = append(tabbed, g)
+	}
+	// Keep each tab's sections together in tab order.
+	var ordered []FieldGroup
+	for _, t := range tabs { for _, g := range tabbed { if g.Tab == t { ordered = append(ordered, g) } } }
+	if len(ordered) > 0 { ordered[0].Tabs = tabs }
+	rest := FieldGroup{}
+	for _, f := range fields { if !placed[f.Name] { rest.Fields = append(rest.Fields, f) } }
+	var groups []FieldGroup
+	if len(rest.Fields) > 0 { groups = append(groups, rest) }
+	groups = append(groups, plain...)
+	return append(groups, ordered...)
+}
+
 func (r *Resource) AddSidebar(label string, handler SidebarHandler) *Resource {
 	r.Sidebars = append(r.Sidebars, Sidebar{Label: label, Handler: handler}); return r
 }
@@ -73,41 +781,233 @@ func (r *Resource) AddMemberAction(n, l string, h ActionHandler) *Resource {
 func (r *Resource) AddCollectionAction(n, l string, h ActionHandler) *Resource {
 	r.CollectionActions = append(r.CollectionActions, Action{Name: n, Label: l, Handler: h}); return r
 }
+
+// AddMemberJSONAction adds a member action the show page runs in place with fetch(), showing the response's message
+// as a toast. Permissions, Visible and params work as for other member actions; params are posted with the call.
+func (r *Resource) AddMemberJSONAction(n, l string, h JSONActionHandler) *Resource {
+	r.MemberActions = append(r.MemberActions, Action{Name: n, Label: l, JSON: true, JSONHandler: h}); return r
+}
+
+// AddCollectionJSONAction adds a collection action the list page runs in place, like AddMemberJSONAction.
+func (r *Resource) AddCollectionJSONAction(n, l string, h JSONActionHandler) *Resource {
+	r.CollectionActions = append(r.CollectionActions, Action{Name: n, Label: l, JSON: true, JSONHandler: h}); return r
+}
+
 func (r *Resource) AddBatchAction(n, l string, h BatchActionHandler) *Resource {
 	r.BatchActions = append(r.BatchActions, BatchAction{Name: n, Label: l, Handler: h}); return r
 }
+// AddBatchJobAction adds a batch action that also runs on every record matching the list's filter. h is called
+// once per batch of ids; small selections run in the request, while "all matching" and large selections run as a
+// background job with a progress page.
+func (r *Resource) AddBatchJobAction(n, l string, h BatchJobHandler) *Resource {
+	r.BatchActions = append(r.BatchActions, BatchAction{Name: n, Label: l, JobHandler: h}); return r
+}
 func (r *Resource) AddScope(n, l string, h ScopeFunc) *Resource {
 	r.Scopes = append(r.Scopes, Scope{Name: n, Label: l, Handler: h}); return r
 }
+
+// AllScope is the scope param of the "All" tab of a resource with a default scope, bypassing that default.
+const AllScope = "all"
+
+// SetDefaultScope applies the named scope whenever no scope param is given: the list opens on its tab, and exports,
+// the search API and the dashboard count follow it. The "All" tab links to scope=all to see everything.
+func (r *Resource) SetDefaultScope(name string) *Resource { r.DefaultScope = name; return r }
+
+// ActiveScope resolves a scope param to the scope in effect: the default scope when param is empty, and "" (no
+// scope) for "all" unless a default scope makes AllScope its own tab.
+func (r *Resource) ActiveScope(param string) string {
+	switch {
+	case param == "": return r.DefaultScope
+	case param == AllScope && r.DefaultScope == "": return ""
+	}
+	return param
+}
+
+// FindScope returns the scope with the given name.
+func (r *Resource) FindScope(name string) (Scope, bool) {
+	for _, s := range r.Scopes { if s.Name == name { return s, true } }
+	return Scope{}, false
+}
 func (r *Resource) HasMany(n, l, tr, fk string) *Resource {
 	r.Associations = append(r.Associations, Association{Type: "HasMany", Name: n, Label: l, ResourceName: tr, ForeignKey: fk}); return r
 }
+func (r *Resource) HasOne(n, l, tr, fk string) *Resource {
+	r.Associations = append(r.Associations, Association{Type: "HasOne", Name: n, Label: l, ResourceName: tr, ForeignKey: fk}); return r
+}
 func (r *Resource) BelongsTo(n, l, tr, fk string) *Resource {
 	r.Associations = append(r.Associations, Association{Type: "BelongsTo", Name: n, Label: l, ResourceName: tr, ForeignKey: fk}); return r
 }
+func (r *Resource) AddAssociationFilter(assoc, field string) *Resource {
+	r.AssociationFilters = append(r.AssociationFilters, AssociationFilter{Association: assoc, Field: field, Label: assoc + " " + field}); return r
+}
+// Dependent strategies decide what deleting a record does to the live records of a HasMany or HasOne association
+// still referring to it: refuse the delete, delete them too (through the same hooks and audit), or clear their
+// foreign key.
+const (
+	DependentBlock   = "block"
+	DependentCascade = "cascade"
+	DependentNullify = "nullify"
+)
+
+// SetOnDelete sets the Dependent strategy of the named HasMany or HasOne association.
+func (r *Resource) SetOnDelete(assoc, strategy string) *Resource {
+	for i := range r.Associations { if r.Associations[i].Name == assoc { r.Associations[i].OnDelete = strategy } }
+	return r
+}
+func (r *Resource) GetAssociation(name string) (Association, bool) {
+	for _, a := range r.Associations { if a.Name == name { return a, true } }
+	return Association{}, false
+}
 func (r *Resource) SetSearchable(f, tr string) *Resource {
 	for i, field := range r.Fields { if field.Name == f { r.Fields[i].Searchable, r.Fields[i].SearchResource = true, tr; break } }
 	return r
 }
+// SetHelpText sets the text explaining a field. A string is shown escaped; pass template.HTML to show markup,
+// such as a link, as it is.
+func (r *Resource) SetHelpText(name string, text interface{}) *Resource {
+	help, ok := text.(template.HTML)
+	if !ok { help = template.HTML(template.HTMLEscapeString(fmt.Sprint(text))) }
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].HelpText = help; break } }
+	return r
+}
+func (r *Resource) SetPlaceholder(name, text string) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Placeholder = text; break } }
+	return r
+}
+
+// SetPrefix and SetSuffix show a unit or symbol inside the form input, before or after the value.
+func (r *Resource) SetPrefix(name, prefix string) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Prefix = prefix; break } }
+	return r
+}
+func (r *Resource) SetSuffix(name, suffix string) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Suffix = suffix; break } }
+	return r
+}
 func (r *Resource) SetFieldType(n, t string, opt ...string) *Resource {
 	for i, f := range r.Fields { if f.Name == n { r.Fields[i].Type, r.Fields[i].Options = t, opt; break } }
 	return r
 }
+
+// SetCurrency makes the field a "currency" field: stored as integer minor units, shown as e.g. "€1,234.56".
+func (r *Resource) SetCurrency(name, symbol string, decimals int) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].Type, r.Fields[i].Currency = "currency", &CurrencyOptions{Symbol: symbol, Decimals: decimals}; break } }
+	return r
+}
+func (r *Resource) SetPerPage(n int) *Resource { r.PerPage = n; return r }
+
+// UseCursorPagination switches the list view to keyset pagination over the primary key, for tables too large to COUNT or OFFSET.
+func (r *Resource) UseCursorPagination() *Resource { r.CursorPagination = true; return r }
+func (r *Resource) SetCountStrategy(s string) *Resource { r.CountStrategy = s; return r }
 func (r *Resource) SetIndexFields(n ...string) *Resource { r.IndexFields = n; return r }
+
+// ExportFields sets the columns of CSV exports, in order. A name is a field of the resource or a dot-path such as
+// "Customer.Email", naming a BelongsTo association (with or without its "ID" suffix) and a field of its target.
+// Without it, exports have the index fields.
+func (r *Resource) ExportFields(names ...string) *Resource { r.ExportPaths = names; return r }
+
+// SetExportRaw exports the fields' stored values instead of passing them through their decorators.
+func (r *Resource) SetExportRaw(names ...string) *Resource {
+	for _, name := range names {
+		for i, f := range r.Fields { if f.Name == name { r.Fields[i].ExportRaw = true; break } }
+	}
+	return r
+}
+
+// SetEncrypted stores the named string field encrypted at rest (AES-GCM with Config.EncryptionKey). Lists, show pages
+// and the API show it in clear only to the decryptFor roles, admins included only when listed, and masked to
+// everyone else; forms leave it blank for them, and a blank submission keeps the stored value.
+func (r *Resource) SetEncrypted(name string, decryptFor ...string) *Resource {
+	for i := range r.Fields { if r.Fields[i].Name == name { r.Fields[i].Encrypted, r.Fields[i].DecryptFor = true, decryptFor } }
+	return r
+}
+
+// SetExportDecrypted exports the named encrypted fields in clear to the roles that may decrypt them; by default
+// exports mask encrypted fields for everyone.
+func (r *Resource) SetExportDecrypted(names ...string) *Resource {
+	for _, name := range names {
+		for i, f := range r.Fields { if f.Name == name { r.Fields[i].ExportDecrypted = true; break } }
+	}
+	return r
+}
 func (r *Resource) SetShowFields(n ...string) *Resource { r.ShowFields = n; return r }
 func (r *Resource) SetEditFields(n ...string) *Resource { r.EditFields = n; return r }
 
+// SetFieldVisibleTo shows the named field only to the given roles (and admins): lists, show pages, forms, exports,
+// filters and searches leave it out for everyone else, and saves ignore it.
+func (r *Resource) SetFieldVisibleTo(name string, roles ...string) *Resource {
+	for i := range r.Fields { if r.Fields[i].Name == name { r.Fields[i].VisibleTo = roles } }
+	return r
+}
+
+// SetFieldVisible shows the named field only to users for which fn returns true (and admins), as SetFieldVisibleTo.
+func (r *Resource) SetFieldVisible(name string, fn UserVisibleFunc) *Resource {
+	for i := range r.Fields { if r.Fields[i].Name == name { r.Fields[i].Visible = fn } }
+	return r
+}
+
+// SetVisibleWhen shows a field only while field's value satisfies op ("eq", "ne", "in" or "not_in") against values,
+// e.g. SetVisibleWhen("TrackingNumber", "Carrier", "ne", "pickup"). Saves ignore the submitted value of a hidden field.
+func (r *Resource) SetVisibleWhen(name, field, op string, values ...string) *Resource {
+	for i, f := range r.Fields { if f.Name == name { r.Fields[i].VisibleWhen = &Condition{Field: field, Op: op, Values: values}; break } }
+	return r
+}
+
+// HiddenByCondition names the fields whose VisibleWhen condition fails, given value, which returns a field's value as
+// text. A field controlled by a hidden field is hidden too, so chains of conditions resolve; a cycle counts as shown.
+func (r *Resource) HiddenByCondition(value func(name string) string) map[string]bool {
+	hidden := make(map[string]bool)
+	conds := make(map[string]*Condition)
+	for _, f := range r.Fields { if f.VisibleWhen != nil { conds[f.Name] = f.VisibleWhen } }
+	resolving, resolved := make(map[string]bool), make(map[string]bool)
+	var shown func(name string) bool
+	shown = func(name string) bool {
+		c := conds[name]
+		if c == nil || resolving[name] { return true }
+		if resolved[name] { return !hidden[name] }
+		resolving[name] = true
+		ok := shown(c.Field) && c.Holds(value(c.Field))
+		resolving[name], resolved[name] = false, true
+		if !ok { hidden[name] = true }
+		return ok
+	}
+	for name := range conds { shown(name) }
+	return hidden
+}
+
+// VisibleFields are the resource's fields user may see.
+func (r *Resource) VisibleFields(user *models.AdminUser) []Field { return visibleFor(r.Fields, user) }
+
+// GetFieldsForUser is GetFieldsFor without the fields user may not see.
+func (r *Resource) GetFieldsForUser(view string, user *models.AdminUser) []Field {
+	return visibleFor(r.GetFieldsFor(view), user)
+}
+
+func visibleFor(fields []Field, user *models.AdminUser) []Field {
+	result := make([]Field, 0, len(fields))
+	for _, f := range fields { if f.VisibleFor(user) { result = append(result, f) } }
+	return result
+}
+
 func (r *Resource) GetFieldsFor(view string) []Field {
 	var names []string
 	switch view {
 	case "index": names = r.IndexFields
 	case "show": names = r.ShowFields
 	case "edit": names = r.EditFields
+	case "export":
+		names = r.ExportPaths
+		if len(names) == 0 { names = r.IndexFields }
 	}
-	if len(names) == 0 { return r.Fields }
 	var result []Field
+	if len(names) == 0 {
+		for _, f := range r.Fields { if !(view == "edit" && (f.Virtual || f.DisplayOnly)) { result = append(result, f) } }
+		return result
+	}
 	for _, name := range names {
-		for _, f := range r.Fields { if f.Name == name { result = append(result, f); break } }
+		// The admin resolves an export's dot-paths, which are not fields of the resource.
+		if view == "export" && strings.Contains(name, ".") { result = append(result, Field{Name: name, Label: name, DisplayOnly: true}); continue }
+		for _, f := range r.Fields { if f.Name == name && !(view == "edit" && (f.Virtual || f.DisplayOnly)) { result = append(result, f); break } }
 	}
 	return result
 }
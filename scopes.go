@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"context"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html/template"
+	"net/url"
+)
+
+// ScopeWithCount is a tab of the list's scope bar; the first is "All", named "" or, with a default scope, AllScope.
+type ScopeWithCount struct {
+	resource.Scope
+	URL     template.URL // keeps the current filters, view and sort
+	Count   int64
+	Counted bool // the resource shows scope counts
+}
+
+// listScopes builds the scope tabs for a list. With ShowScopeCounts, each tab counts the records it would list under
+// the current filters, one COUNT per tab through CountFor, so a CountCached strategy memoises them.
+func (reg *Registry) listScopes(ctx context.Context, res *resource.Resource, params url.Values) []ScopeWithCount {
+	all := resource.Scope{Label: "All"}
+	if res.DefaultScope != "" { all.Name = resource.AllScope }
+	scopes := append([]resource.Scope{all}, res.Scopes...)
+	tabs := make([]ScopeWithCount, len(scopes))
+	for i, s := range scopes {
+		q := url.Values{}
+		for k, v := range params { if k != "page" && k != "after" && k != "before" && k != "scope" { q[k] = v } }
+		q.Set("scope", s.Name)
+		tabs[i] = ScopeWithCount{Scope: s, URL: template.URL("?" + q.Encode())}
+		if !res.ShowScopeCounts { continue }
+		lq, err := reg.buildListQuery(ctx, res, q)
+		if err != nil { continue }
+		tabs[i].Count, tabs[i].Counted = reg.CountFor(ctx, res, lq.CountQuery()), true
+	}
+	return tabs
+}
+
+// listFiltered reports whether a scope or a filter param narrows the list, as opposed to paging, sorting or the view.
+func listFiltered(params map[string]string, currentScope string) bool {
+	if currentScope != "" && currentScope != resource.AllScope { return true }
+	for k := range params {
+		switch k {
+		case "page", "per_page", "sort", "order", "view", "scope", "after", "before":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// clearFiltersURL links to the unfiltered list in the same view, past any default scope.
+func clearFiltersURL(res *resource.Resource, view string) template.URL {
+	q := url.Values{}
+	if res.DefaultScope != "" { q.Set("scope", resource.AllScope) }
+	if view != "" { q.Set("view", view) }
+	return template.URL("?" + q.Encode())
+}
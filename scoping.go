@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"regexp"
+)
+
+// ScopeFunc narrows a query on res's table to the rows user may see, e.g. q.Where("org_id = ?", user.OrgID).
+type ScopeFunc func(user *models.AdminUser, res *resource.Resource, q *gorm.DB) *gorm.DB
+
+// errOutOfScope rejects a save that would leave the record outside the saving user's scope.
+var errOutOfScope = errors.New("This record would fall outside your scope.")
+
+func withUser(ctx context.Context, user *models.AdminUser) context.Context { return resource.WithUser(ctx, user) }
+
+// CurrentUser returns the admin user a request is served for, from the request context or from the context of the
+// db handle given to stats and chart providers (db.Statement.Context). It is nil outside a signed-in request.
+func CurrentUser(ctx context.Context) *models.AdminUser { return resource.UserFrom(ctx) }
+
+// ScopeAll installs a row-level scope applied to every query the admin runs on a resource's table: lists, counts,
+// exports, searches, association loads and record lookups. Rows outside the scope are invisible, so looking one up
+// by key is a 404. Saves assign the scope's equality conditions (written as "col = ?", a map or a struct) to the
+// record and are rolled back unless the saved record is still in scope.
+//
+// The scope applies to requests from signed-in users only; calls without a user in the context, such as GetContext
+// from a background job, are not scoped. Stat providers of a resource stat receive a scoped handle; other stats and
+// charts can scope themselves with Scope, or read ChartRequest.User or CurrentUser.
+func (reg *Registry) ScopeAll(fn ScopeFunc) *Registry {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	reg.scopeAll = fn
+	return reg
+}
+
+// Scope applies the ScopeAll hook for the user in db's context to db, a query on res's table.
+func (reg *Registry) Scope(db *gorm.DB, res *resource.Resource) *gorm.DB { return reg.scope(db.Statement.Context, res, db) }
+
+func (reg *Registry) scope(ctx context.Context, res *resource.Resource, q *gorm.DB) *gorm.DB {
+	reg.mu.RLock(); fn := reg.scopeAll; reg.mu.RUnlock()
+	user := CurrentUser(ctx)
+	if fn == nil || user == nil { return q }
+	return fn(user, res, q)
+}
+
+// scoped reports whether queries made under ctx are narrowed by a ScopeAll hook.
+func (reg *Registry) scoped(ctx context.Context) bool {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	return reg.scopeAll != nil && CurrentUser(ctx) != nil
+}
+
+// simpleEquality matches a scope condition written as "col = ?", optionally table-qualified and quoted.
+var simpleEquality = regexp.MustCompile("^\\s*(?:[`\"]?\\w+[`\"]?\\.)?[`\"]?(\\w+)[`\"]?\\s*=\\s*\\?\\s*$")
+
+// applyScope assigns the scope's equality conditions to item, so a form can't place a record in another tenant.
+func (reg *Registry) applyScope(tx *gorm.DB, res *resource.Resource, item reflect.Value) error {
+	if !reg.scoped(tx.Statement.Context) { return nil }
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return err }
+	dry := reg.scope(tx.Statement.Context, res, tx.Session(&gorm.Session{DryRun: true, NewDB: true}).Model(res.Model))
+	where, ok := dry.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok { return nil }
+	assign := func(col string, val interface{}) error {
+		f := sch.LookUpField(col)
+		if f == nil { return nil }
+		return f.Set(tx.Statement.Context, item, val)
+	}
+	var walk func(exprs []clause.Expression) error
+	walk = func(exprs []clause.Expression) error {
+		for _, e := range exprs {
+			switch e := e.(type) {
+			case clause.Eq:
+				col, _ := e.Column.(string)
+				if c, ok := e.Column.(clause.Column); ok { col = c.Name }
+				if err := assign(col, e.Value); err != nil { return err }
+			case clause.Expr:
+				if m := simpleEquality.FindStringSubmatch(e.SQL); m != nil && len(e.Vars) == 1 { if err := assign(m[1], e.Vars[0]); err != nil { return err } }
+			case clause.AndConditions:
+				if err := walk(e.Exprs); err != nil { return err }
+			}
+		}
+		return nil
+	}
+	return walk(where.Exprs)
+}
+
+// checkScope fails unless the record keyed id is visible through the scope, e.g. after a save.
+func (reg *Registry) checkScope(tx *gorm.DB, res *resource.Resource, id interface{}) error {
+	if !reg.scoped(tx.Statement.Context) { return nil }
+	q, err := reg.whereKey(reg.scope(tx.Statement.Context, res, tx.Model(res.Model)), res, id)
+	if err != nil { return err }
+	var n int64
+	if err := q.Count(&n).Error; err != nil { return err }
+	if n == 0 { return errOutOfScope }
+	return nil
+}
@@ -1,14 +1,16 @@
 package admin
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"github.com/ajeet-kumar1087/go-admin/models"
 	"github.com/ajeet-kumar1087/go-admin/resource"
 	"html/template"
 	"net/http"
-	"path/filepath"
+	"net/url"
 	"strings"
+	"time"
 )
 
 //go:embed templates/*
@@ -16,17 +18,26 @@ var templateFS embed.FS
 
 type PageData struct {
 	SiteTitle        string
+	BasePath         string
 	Resources        map[string]*resource.Resource
 	GroupedResources map[string][]*resource.Resource
 	GroupedPages     map[string][]*Page
+	NavGroups        []string
 	CurrentResource  *resource.Resource
 	Fields           []resource.Field
+	Sections         []resource.FieldGroup
 	Data             []map[string]interface{}
 	Item             map[string]interface{}
 	Filters          map[string]string
 	User             *models.AdminUser
 	Stats            []Stat
 	Error            string
+	// SSO shows "Sign in with SSO" on the login page, and NoPasswordLogin hides its email and password form.
+	SSO, NoPasswordLogin bool
+	// PasswordReset shows the "Forgot password" link on the login page.
+	PasswordReset    bool
+	Status           int
+	Message          string
 	Flash            string
 	CSS              template.CSS
 	Page, PerPage    int
@@ -34,65 +45,215 @@ type PageData struct {
 	TotalCount       int64
 	HasPrev, HasNext bool
 	PrevPage, NextPage int
-	Scopes           []resource.Scope
+	PrevURL, NextURL template.URL
+	Scopes           []ScopeWithCount
 	CurrentScope     string
-	Associations     map[string]AssociationData
+	Associations     map[string]*AssociationData
 	ChartData        []ChartWidget
+	Widgets          []RenderedWidget
+	Account          *AccountData
+	ExportJobs       []models.ExportJob
+	BatchJobs        []models.BatchJob
+	Watches          []WatchEntry
+	Watching         bool // the user watches the shown record
+	EditLocks        []models.EditLock
+	EditLock         *EditLockData // the edit form's lock banner and heartbeat, with Config.EditLocks
+	Draft            *DraftData    // the form's autosave and unsaved draft banner, with Config.Drafts
+	ShowEditLocks    bool          // set by execute: the edit locks page is on, for the admins' navigation
+	// MaintenanceBanner is set by execute while maintenance mode is on; MaintenanceOverride when the user may still write.
+	MaintenanceBanner   string
+	MaintenanceOverride bool
+	Maintenance         *MaintenanceData
+	Assignees        []models.AdminUser
+	Metadata         *RecordMetadata
+	Filtered         bool         // the list is narrowed by filters or a scope, for its empty state
+	ClearFiltersURL  template.URL
+	CanCreate        bool
+	FilterFields     []resource.Field // the fields the list's filter sidebar offers: those the user may see
+	Title            string  // the page's part of the browser title, before the site title
+	Breadcrumbs      []Crumb
+	Brand            *Brand // set by execute from Config.Branding
+	Locale           string   // set by execute from the request; templates translate through T
+	Locales          []string
+	translator       Translator
+	CurrentPath      string // the page's own URL, for forms that return to it
 	SortField        string
 	SortOrder        string
+	Query            template.URL
+	Presets          []models.SavedFilter
+	Columns          []ColumnChoice
+	IDs              []string
+	Reorderable      bool // the list is in manual position order and may be rearranged
+	CanEdit          bool
+	// InlineFields are the list fields the user may edit in place, by name.
+	InlineFields     map[string]resource.Field
+	CanDelete        bool
+	CanExport        bool
+	CanPurgeTrash    bool // the resource has a TrashRetention and the user is an admin
+	CanMerge         bool // the resource is mergeable and the user may edit and delete its records
+	Merge            *MergeData
+	Delete           *DeleteData // the dependents of the records being deleted, on the delete confirmations
+	Reports          *ReportsData
+	Duplicates       []DuplicateMatch // the existing records a new one likely duplicates, holding back its save
+	Settings         *SettingsData
+	ShowSettings     bool // set by execute: the user may see a settings group, for the navigation
+	// Actions visible to the current user (and, for MemberActions, applicable to Item).
+	MemberActions     []resource.Action
+	CollectionActions []resource.Action
+	BatchActions      []resource.BatchAction
+	// Form overrides, for reusing form.html for things other than saving a record (e.g. action params).
+	FormAction       string
+	FormTitle        string
+	SubmitLabel      string
+	Hidden           map[string]string
+	FieldErrors      map[string]string
+	ConditionHidden  map[string]bool // form fields whose VisibleWhen condition fails, hidden until the script re-checks them
+	DependentSelects map[string]DependentSelect // the form's dependent fields, by name; see Resource.SetDependentOptions
+	Footer           map[string]template.HTML // formatted footer aggregates by field name
+	Comments         []CommentEntry
+	TreePath         []TreeNode // the ancestors of a tree record, root first
+	View             string // the index page's view: "" for the table, "board" or "calendar"
+	Views            []ViewLink
+	Board            []BoardColumn
+	BoardFields      []resource.Field
 	RenderedSidebars map[string]template.HTML
 }
 
 type ChartWidget struct {
 	ID, Label, Type string
 	Labels          []string
-	Values          []float64
+	Series          []ChartSeries
+	Stacked         bool
+	// DataURL reloads the chart; Ranges lists the range buttons, empty for charts without range support.
+	DataURL string
+	Ranges  []string
+	Error   string
+	// AsOf is when cached data was computed, e.g. "14:02"; empty for uncached charts.
+	AsOf       string
+	CanRefresh bool
 }
 
 type AssociationData struct {
+	// Label is the display text of the currently selected record, for search inputs.
+	Label    string
 	Resource *resource.Resource
 	Fields   []resource.Field
 	Items    []map[string]interface{}
 	Options  []map[string]interface{}
+	// Show page HasMany panels hold one page of Items out of Total.
+	Total            int64
+	Page, TotalPages int
+	PrevURL, NextURL template.URL
+	ListURL, NewURL  template.URL
 }
 
 type Stat struct {
 	Label string
 	Value int64
+	Link  string
+	// Error replaces the value when the provider failed.
+	Error string
+	// Trend is the change against the previous period, e.g. "+12%".
+	Trend   string
+	TrendUp bool
 }
 
+// setFlash shows message on the next page. Bytes a cookie cannot carry, such as non-ASCII text in translated
+// messages, are percent-encoded.
 func (reg *Registry) setFlash(w http.ResponseWriter, message string) {
-	http.SetCookie(w, &http.Cookie{Name: "admin_flash", Value: message, Path: "/admin", HttpOnly: true})
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < 0x20 || c >= 0x7f || c == '"' || c == ';' || c == '\\' || c == '%' { fmt.Fprintf(&b, "%%%02X", c) } else { b.WriteByte(c) }
+	}
+	http.SetCookie(w, &http.Cookie{Name: "admin_flash", Value: b.String(), Path: reg.cookiePath(), HttpOnly: true})
 }
 
 func (reg *Registry) getFlash(w http.ResponseWriter, r *http.Request) string {
 	cookie, err := r.Cookie("admin_flash")
 	if err != nil { return "" }
-	http.SetCookie(w, &http.Cookie{Name: "admin_flash", Value: "", Path: "/admin", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: "admin_flash", Value: "", Path: reg.cookiePath(), MaxAge: -1})
+	if message, err := url.PathUnescape(cookie.Value); err == nil { return message }
 	return cookie.Value
 }
 
-// ServeHTTP implements the http.Handler interface and routes requests to sub-handlers.
+// ServeHTTP implements the http.Handler interface, running registered middlewares before routing to sub-handlers.
 func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	upath := strings.TrimPrefix(r.URL.Path, "/admin")
+	reg.startSessionCleanup()
+	if !reg.checkValidation(w) { return }
+	h := reg.instrument(reg.compress(http.HandlerFunc(reg.route)))
+	for i := len(reg.middlewares) - 1; i >= 0; i-- { h = reg.middlewares[i](h) }
+	h.ServeHTTP(w, r)
+}
+
+func (reg *Registry) route(w http.ResponseWriter, r *http.Request) {
+	// Paths arrive either with the base path (mounted directly) or without it (via Handler or a stripping proxy).
+	upath := r.URL.Path
+	if base := reg.basePath(); base != "" && (upath == base || strings.HasPrefix(upath, base+"/")) { upath = strings.TrimPrefix(upath, base) }
+
+	// Every query runs under the request context; exports and bulk creates get their own, longer deadline.
+	timeout := reg.Config.QueryTimeout
+	if strings.HasSuffix(upath, "/export") || strings.HasSuffix(upath, "/bulk") { timeout = reg.Config.ExportTimeout }
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
 
 	// 1. Static Asset Routing
 	if strings.HasPrefix(upath, "/uploads/") {
 		reg.handleStatic(w, r, upath)
 		return
 	}
+	if strings.HasPrefix(upath, "/assets/") {
+		reg.handleAsset(w, r, upath)
+		return
+	}
+
+	// Probes need no session, and answer before one is looked up.
+	if upath == "/healthz" {
+		reg.handleHealthz(w, r)
+		return
+	}
+	if upath == "/readyz" {
+		reg.handleReadyz(w, r)
+		return
+	}
+	// Scheduled reports' download links are signed, for recipients without an account.
+	if upath == "/reports/download" {
+		reg.handleReportDownload(w, r)
+		return
+	}
 
 	user, role := reg.GetUserFromRequest(r)
+	if user != nil { r = r.WithContext(withUser(r.Context(), user)) }
+	r = r.WithContext(withLocale(r.Context(), reg.requestLocale(r.Context(), r.Header.Get("Accept-Language"))))
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok && user != nil { info.UserEmail = user.Email }
+
+	// Metrics authenticate themselves so scrapers can use a bearer token instead of a session.
+	if upath == "/metrics" {
+		reg.handleMetrics(w, r, user, role)
+		return
+	}
+
+	// The spec, like metrics, may be fetched with its own bearer token.
+	if upath == openAPIPath {
+		reg.handleOpenAPI(w, r, user, role)
+		return
+	}
 
 	// 2. Authentication Routing
-	if upath == "/login" || upath == "/logout" {
+	if upath == "/login" || upath == "/logout" || upath == "/forgot" || upath == "/reset" || (reg.oidcEnabled() && (upath == "/login/sso" || upath == reg.oidcRedirectPath())) {
 		reg.routeAuth(w, r, upath)
 		return
 	}
 
-	// 3. Auth Guard
+	// 3. Auth Guard; API clients get a JSON error rather than the login page
+	if user == nil && strings.HasPrefix(upath, "/api/") {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
 	if user == nil {
-		http.Redirect(w, r, "/admin/login", 303)
+		http.Redirect(w, r, reg.URL("/login"), 303)
 		return
 	}
 
@@ -102,36 +263,88 @@ func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 5. Search API Routing
+	// 5. The signed-in user's sessions and login history, and ending impersonation
+	if upath == "/account" || strings.HasPrefix(upath, "/account/") {
+		reg.handleAccount(w, r, upath, user, role)
+		return
+	}
+	if upath == "/exports" || strings.HasPrefix(upath, "/exports/") {
+		reg.handleExports(w, r, upath, user)
+		return
+	}
+	if upath == "/reports" || strings.HasPrefix(upath, "/reports/") {
+		reg.handleReports(w, r, upath, user)
+		return
+	}
+	if upath == "/jobs" || strings.HasPrefix(upath, "/jobs/") {
+		reg.handleBatchJobs(w, r, upath, user)
+		return
+	}
+	if upath == "/watches" || strings.HasPrefix(upath, "/watches/") {
+		reg.handleWatches(w, r, upath, user)
+		return
+	}
+	if upath == "/settings" || strings.HasPrefix(upath, "/settings/") {
+		reg.handleSettings(w, r, upath, user)
+		return
+	}
+	if upath == "/maintenance" || strings.HasPrefix(upath, "/maintenance/") {
+		reg.handleMaintenance(w, r, upath, user, role)
+		return
+	}
+	if upath == "/locks" || strings.HasPrefix(upath, "/locks/") {
+		reg.handleEditLocks(w, r, upath, user, role)
+		return
+	}
+	if upath == "/impersonate/stop" {
+		reg.handleStopImpersonating(w, r, user)
+		return
+	}
+
+	if strings.HasPrefix(upath, "/api/") {
+		reg.routeAPI(w, r, upath, user, role)
+		return
+	}
+
+	// 6. Chart data for the dashboard's range buttons
+	if strings.HasPrefix(upath, "/charts/") {
+		reg.handleChartData(w, r, upath, user)
+		return
+	}
+
+	// 7. Search API Routing
 	if strings.HasSuffix(upath, "/search") {
-		reg.routeSearch(w, r, upath)
+		reg.routeSearch(w, r, upath, user, role)
 		return
 	}
 
-	// 6. Main Resource/Page Routing
+	// 8. Main Resource/Page Routing
 	reg.routeMain(w, r, upath, user, role)
 }
 
-func (reg *Registry) handleStatic(w http.ResponseWriter, r *http.Request, upath string) {
-	fileName := strings.TrimPrefix(upath, "/uploads/")
-	http.ServeFile(w, r, filepath.Join(reg.Config.UploadDir, fileName))
-}
-
 func (reg *Registry) routeAuth(w http.ResponseWriter, r *http.Request, upath string) {
-	if upath == "/login" {
+	switch upath {
+	case "/login":
 		if r.Method == "POST" {
 			reg.handleLogin(w, r)
 		} else {
 			reg.renderLogin(w, r, "")
 		}
-		return
+	case "/login/sso":
+		reg.handleSSOLogin(w, r)
+	case "/forgot", "/reset":
+		if !reg.passwordResetEnabled() { http.NotFound(w, r); return }
+		if upath == "/forgot" { reg.handleForgotPassword(w, r) } else { reg.handleResetPassword(w, r) }
+	case "/logout":
+		reg.handleLogout(w, r)
+	default:
+		reg.handleSSOCallback(w, r)
 	}
-	reg.handleLogout(w, r)
 }
 
-func (reg *Registry) routeSearch(w http.ResponseWriter, r *http.Request, upath string) {
+func (reg *Registry) routeSearch(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser, role string) {
 	parts := strings.Split(strings.TrimPrefix(upath, "/"), "/")
-	reg.handleSearchAPI(parts[0], w, r)
+	reg.handleSearchAPI(parts[0], w, r, user, role)
 }
 
 func (reg *Registry) routeMain(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser, role string) {
@@ -139,15 +352,20 @@ func (reg *Registry) routeMain(w http.ResponseWriter, r *http.Request, upath str
 	resourceName := parts[0]
 
 	// Check Custom Pages
-	if page, ok := reg.Pages[resourceName]; ok {
-		page.Handler(w, r)
+	if page, ok := reg.getPage(resourceName); ok {
+		if !page.VisibleFor(user) {
+			reg.log(r.Context()).Warn("permission denied", "user", user.Email, "role", role, "page", page.Name)
+			http.Error(w, "Forbidden", 403)
+			return
+		}
+		if page.HandlerWithUser != nil { page.HandlerWithUser(w, r, user) } else { page.Handler(w, r) }
 		return
 	}
 
 	// Check Resources
 	res, ok := reg.GetResource(resourceName)
 	if !ok {
-		http.NotFound(w, r)
+		reg.renderError(w, r, http.StatusNotFound, nil)
 		return
 	}
 
@@ -155,46 +373,164 @@ func (reg *Registry) routeMain(w http.ResponseWriter, r *http.Request, upath str
 	if len(parts) > 1 && parts[1] != "" {
 		action = parts[1]
 	}
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok { info.Resource, info.Action = res.Slug, action }
 
-	// Permission Check
-	if !reg.IsAllowed(role, resourceName, action) && 
-	   action != "export" && !strings.Contains(action, "action") {
+	// Permission Check (saved views only need read access to the list)
+	if !reg.actionAllowed(res, action, r, role) {
+		reg.log(r.Context()).Warn("permission denied", "user", user.Email, "role", role, "resource", res.Slug, "action", action)
 		http.Error(w, "Forbidden", 403)
 		return
 	}
 
+	if res.ReadOnly && !reg.readOnlyAllows(res, action, r) {
+		reg.log(r.Context()).Warn("permission denied", "user", user.Email, "role", role, "resource", res.Slug, "action", action, "reason", "read-only")
+		http.Error(w, "Forbidden: "+res.Name+" is read-only", 403)
+		return
+	}
+	// Maintenance mode refuses what a read-only resource would.
+	if !reg.readOnlyAllows(res, action, r) && reg.maintenanceBlocks(user) {
+		reg.refuseMaintenance(w, r, user)
+		return
+	}
+
 	reg.handleResourceAction(res, action, w, r, user)
 }
 
+// actionAllowed checks role's permission for a route on res. Saved views need the list permission; reordering,
+// moving and inline edits need edit; merging needs edit and delete; a dependent field's options need new or edit;
+// drafts need new or edit as their form does; duplicate checks need new; and export needs "export" (or "list" with
+// Config.ExportFallbackToList). Custom actions take their own permission (see Resource.SetActionPermission) or the
+// generic "action" grant; the built-in batch edit and delete need edit and delete.
+func (reg *Registry) actionAllowed(res *resource.Resource, action string, r *http.Request, role string) bool {
+	switch action {
+	case "save_filter", "delete_filter", "columns", "reset_columns", "tags", "calendar", "children":
+		return reg.IsAllowed(role, res.Slug, "list")
+	case "reorder", "move", "move_under", "assign", "lock", "unlock", "inline_update":
+		return reg.IsAllowed(role, res.Slug, "edit")
+	case "field_options":
+		return reg.IsAllowed(role, res.Slug, "new") || reg.IsAllowed(role, res.Slug, "edit")
+	case "draft":
+		if draftRecordID(r.URL.Query().Get("id")) == draftNew { return reg.IsAllowed(role, res.Slug, "new") }
+		return reg.IsAllowed(role, res.Slug, "edit")
+	case "duplicates":
+		return reg.IsAllowed(role, res.Slug, "new")
+	case "purge_trash":
+		return role == "admin"
+	case "merge":
+		return reg.IsAllowed(role, res.Slug, "edit") && reg.IsAllowed(role, res.Slug, "delete")
+	case "comment", "delete_comment", "watch":
+		return reg.IsAllowed(role, res.Slug, "show")
+	case "export":
+		return reg.canExport(res, role)
+	case "action", "collection_action":
+		actions := res.MemberActions
+		if action == "collection_action" { actions = res.CollectionActions }
+		for _, a := range actions { if a.Name == r.URL.Query().Get("name") { return reg.customActionAllowed(role, res.Slug, a.Permission()) } }
+		return false
+	case "batch_action":
+		switch name := r.FormValue("action_name"); name {
+		case batchEditAction: return reg.IsAllowed(role, res.Slug, "edit")
+		case batchDeleteAction: return reg.IsAllowed(role, res.Slug, "delete")
+		default:
+			for _, a := range res.BatchActions { if a.Name == name { return reg.customActionAllowed(role, res.Slug, a.Permission()) } }
+			return name == ""
+		}
+	}
+	return reg.IsAllowed(role, res.Slug, action)
+}
+
+func (reg *Registry) canExport(res *resource.Resource, role string) bool {
+	return reg.IsAllowed(role, res.Slug, "export") || (reg.Config.ExportFallbackToList && reg.IsAllowed(role, res.Slug, "list"))
+}
+
+func (reg *Registry) customActionAllowed(role, resName, perm string) bool {
+	return reg.IsAllowed(role, resName, perm) || reg.IsAllowed(role, resName, "action")
+}
+
+// readOnlyAllows reports whether action may run on a read-only resource: anything but writes, plus actions marked safe.
+func (reg *Registry) readOnlyAllows(res *resource.Resource, action string, r *http.Request) bool {
+	switch action {
+	case "new", "edit", "save", "delete", "reorder", "move", "move_under", "assign", "lock", "unlock", "purge_trash", "inline_update", "field_options", "merge":
+		return false
+	case "action", "collection_action":
+		return res.ActionSafe(action, r.URL.Query().Get("name"))
+	case "batch_action":
+		return res.ActionSafe(action, r.FormValue("action_name"))
+	}
+	return true
+}
+
 func (reg *Registry) handleResourceAction(res *resource.Resource, action string, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
 	switch action {
 	case "export":
-		reg.handleExport(res, w, r)
+		reg.handleExport(res, w, r, user)
+	case "lock", "unlock":
+		reg.handleEditLock(res, w, r, user, action == "unlock")
+	case "draft":
+		reg.handleDraft(res, w, r, user)
 	case "action":
-		reg.handleCustomAction(res, w, r, false)
+		reg.handleCustomAction(res, w, r, user, false)
 	case "collection_action":
-		reg.handleCustomAction(res, w, r, true)
+		reg.handleCustomAction(res, w, r, user, true)
 	case "batch_action":
-		reg.handleBatchAction(res, w, r)
+		reg.handleBatchAction(res, w, r, user)
 	case "save":
 		reg.handleSave(res, w, r, user)
+	case "reorder":
+		reg.handleReorder(res, w, r, user)
+	case "purge_trash":
+		reg.handlePurgeTrash(res, w, r, user)
+	case "merge":
+		reg.handleMerge(res, w, r, user)
+	case "inline_update":
+		reg.handleInlineUpdate(res, w, r, user)
+	case "watch":
+		reg.handleWatch(res, w, r, user)
+	case "tags":
+		reg.handleTagSuggestions(res, w, r)
+	case "field_options":
+		reg.handleFieldOptions(res, w, r)
+	case "duplicates":
+		reg.handleDuplicates(res, w, r)
+	case "comment", "delete_comment":
+		reg.handleComment(res, action, w, r, user)
+	case "move":
+		reg.handleBoardMove(res, w, r, user)
+	case "calendar":
+		reg.handleCalendar(res, w, r)
+	case "children":
+		reg.handleTreeChildren(res, w, r)
+	case "move_under":
+		reg.handleTreeMove(res, w, r, user)
+	case "assign":
+		reg.handleAssign(res, w, r, user)
+	case "save_filter":
+		reg.handleSaveFilter(res, w, r, user)
+	case "delete_filter":
+		reg.handleDeleteFilter(res, w, r, user)
+	case "columns":
+		reg.handleSaveColumns(res, w, r, user)
+	case "reset_columns":
+		reg.handleResetColumns(res, w, r, user)
 	case "new":
-		reg.renderForm(res, nil, w, r, user)
+		reg.renderForm(res, nil, w, r, user, "", nil)
 	case "show":
 		id := r.URL.Query().Get("id")
-		item, _ := reg.Get(res.Name, id)
+		item, err := reg.getOn(reg.resourceReader(r.Context(), res), res.Slug, id)
+		if err != nil { reg.renderRecordError(w, r, err); return }
+		if wantsJSON(r) && res.APIDisabled { writeJSONError(w, http.StatusNotFound, "not found"); return }
+		if wantsJSON(r) { reg.renderShowJSON(res, item, w, r, user); return }
 		reg.renderShow(res, item, w, r, user)
 	case "edit":
 		id := r.URL.Query().Get("id")
-		item, _ := reg.Get(res.Name, id)
-		reg.renderForm(res, item, w, r, user)
+		item, err := reg.getContext(r.Context(), res.Slug, id)
+		if err != nil { reg.renderRecordError(w, r, err); return }
+		reg.renderForm(res, item, w, r, user, "", nil)
 	case "delete":
-		id := r.URL.Query().Get("id")
-		reg.Delete(res.Name, id)
-		reg.RecordAction(user, res.Name, id, "Delete", "Record deleted")
-		reg.setFlash(w, fmt.Sprintf("%s deleted successfully", res.Name))
-		http.Redirect(w, r, "/admin/"+res.Name, 303)
+		reg.handleDelete(res, w, r, user)
 	default:
+		if wantsJSON(r) && res.APIDisabled { writeJSONError(w, http.StatusNotFound, "not found"); return }
+		if wantsJSON(r) { reg.renderListJSON(res, w, r, user); return }
 		reg.renderList(res, w, r, user)
 	}
 }
@@ -0,0 +1,263 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound is returned by SessionStore.Get for unknown and expired sessions.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore persists login sessions. Session ids are already hashed tokens, so stores may keep them as they are.
+// The default store uses the registry's database; see SetSessionStore for alternatives.
+type SessionStore interface {
+	Create(ctx context.Context, s *models.Session) error
+	// Get returns an unexpired session, or ErrSessionNotFound.
+	Get(ctx context.Context, id string) (*models.Session, error)
+	// Touch sets a session's LastSeenAt.
+	Touch(ctx context.Context, id string, at time.Time) error
+	Delete(ctx context.Context, id string) error
+	DeleteExpired(ctx context.Context) error
+	DeleteAllForUser(ctx context.Context, userID uint) error
+	// ListForUser returns a user's unexpired sessions, most recently seen first.
+	ListForUser(ctx context.Context, userID uint) ([]models.Session, error)
+	// CountActive counts unexpired sessions, for the active sessions metric.
+	CountActive(ctx context.Context) (int64, error)
+}
+
+// ErrFormTokenNotFound and ErrFormTokenUsed are returned by FormTokenStore.ConsumeFormToken.
+var (
+	ErrFormTokenNotFound = errors.New("form token not found")
+	ErrFormTokenUsed     = errors.New("form token already used")
+)
+
+// FormTokenStore keeps the one-time tokens of rendered forms (Config.FormTokens) next to the sessions they belong
+// to. The built-in session stores implement it; with a SessionStore that doesn't, tokens are kept in the database.
+type FormTokenStore interface {
+	IssueFormToken(ctx context.Context, t *models.FormToken) error
+	// ConsumeFormToken marks the session's token id used, in one step so that only one of concurrent submissions
+	// wins. A token used before returns ErrFormTokenUsed with the id of the record saved with it, if any yet; an
+	// unknown or expired one returns ErrFormTokenNotFound.
+	ConsumeFormToken(ctx context.Context, sessionID, id string) (string, error)
+	// CompleteFormToken records the record saved with a used token.
+	CompleteFormToken(ctx context.Context, id, recordID string) error
+	DeleteExpiredFormTokens(ctx context.Context) error
+}
+
+// SetSessionStore moves session persistence off the primary database, e.g. to NewRedisSessionStore.
+func (reg *Registry) SetSessionStore(s SessionStore) {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	reg.sessionStore = s
+}
+
+func (reg *Registry) sessions() SessionStore { return reg.sessionsFor(reg.DB) }
+
+// sessionsFor is sessions for code running inside a transaction: the default store then uses db, so its changes
+// commit or roll back with the rest.
+func (reg *Registry) sessionsFor(db *gorm.DB) SessionStore {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	if reg.sessionStore != nil { return reg.sessionStore }
+	return &GormSessionStore{DB: db}
+}
+
+func (reg *Registry) formTokens() FormTokenStore {
+	if s, ok := reg.sessions().(FormTokenStore); ok { return s }
+	return &GormSessionStore{DB: reg.DB}
+}
+
+// startSessionCleanup deletes expired sessions, form tokens, edit locks and drafts every Config.SessionCleanup minutes, from the
+// first request on.
+func (reg *Registry) startSessionCleanup() {
+	reg.cleanup.Do(func() {
+		if reg.Config.SessionCleanup <= 0 { return }
+		reg.goBackground(func(ctx context.Context) {
+			tick := time.NewTicker(time.Duration(reg.Config.SessionCleanup) * time.Minute)
+			defer tick.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tick.C:
+				}
+				if err := reg.sessions().DeleteExpired(ctx); err != nil { reg.Logger.Error("deleting expired sessions failed", "error", err) }
+				if reg.Config.FormTokens {
+					if err := reg.formTokens().DeleteExpiredFormTokens(ctx); err != nil { reg.Logger.Error("deleting expired form tokens failed", "error", err) }
+				}
+				if reg.Config.EditLocks {
+					if err := reg.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.EditLock{}).Error; err != nil { reg.Logger.Error("deleting expired edit locks failed", "error", err) }
+				}
+				if reg.Config.Drafts {
+					if err := reg.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.Draft{}).Error; err != nil { reg.Logger.Error("deleting expired drafts failed", "error", err) }
+				}
+			}
+		})
+	})
+}
+
+// GormSessionStore keeps sessions in the Session table. It is the default.
+type GormSessionStore struct{ DB *gorm.DB }
+
+func (s *GormSessionStore) Create(ctx context.Context, sess *models.Session) error {
+	return s.DB.WithContext(ctx).Create(sess).Error
+}
+
+func (s *GormSessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	var sess models.Session
+	err := s.DB.WithContext(ctx).Where("id = ? AND expires_at > ?", id, time.Now()).First(&sess).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) { return nil, ErrSessionNotFound }
+	if err != nil { return nil, err }
+	return &sess, nil
+}
+
+func (s *GormSessionStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return s.DB.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
+
+func (s *GormSessionStore) Delete(ctx context.Context, id string) error {
+	return s.DB.WithContext(ctx).Delete(&models.Session{}, "id = ?", id).Error
+}
+
+func (s *GormSessionStore) DeleteExpired(ctx context.Context) error {
+	return s.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.Session{}).Error
+}
+
+func (s *GormSessionStore) DeleteAllForUser(ctx context.Context, userID uint) error {
+	return s.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.Session{}).Error
+}
+
+func (s *GormSessionStore) ListForUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	var list []models.Session
+	err := s.DB.WithContext(ctx).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("last_seen_at desc").Find(&list).Error
+	return list, err
+}
+
+func (s *GormSessionStore) CountActive(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.DB.WithContext(ctx).Model(&models.Session{}).Where("expires_at > ?", time.Now()).Count(&n).Error
+	return n, err
+}
+
+func (s *GormSessionStore) IssueFormToken(ctx context.Context, t *models.FormToken) error {
+	return s.DB.WithContext(ctx).Create(t).Error
+}
+
+func (s *GormSessionStore) ConsumeFormToken(ctx context.Context, sessionID, id string) (string, error) {
+	db := s.DB.WithContext(ctx)
+	claim := db.Model(&models.FormToken{}).Where("id = ? AND session_id = ? AND used = ? AND expires_at > ?", id, sessionID, false, time.Now()).Update("used", true)
+	if claim.Error != nil { return "", claim.Error }
+	if claim.RowsAffected == 1 { return "", nil }
+	var t models.FormToken
+	err := db.Where("id = ? AND session_id = ? AND expires_at > ?", id, sessionID, time.Now()).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) { return "", ErrFormTokenNotFound }
+	if err != nil { return "", err }
+	return t.RecordID, ErrFormTokenUsed
+}
+
+func (s *GormSessionStore) CompleteFormToken(ctx context.Context, id, recordID string) error {
+	return s.DB.WithContext(ctx).Model(&models.FormToken{}).Where("id = ?", id).Update("record_id", recordID).Error
+}
+
+func (s *GormSessionStore) DeleteExpiredFormTokens(ctx context.Context) error {
+	return s.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.FormToken{}).Error
+}
+
+// MemorySessionStore keeps sessions in process memory, for tests and single-instance setups that accept
+// losing sessions on restart.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]models.Session
+	tokens   map[string]models.FormToken
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]models.Session), tokens: make(map[string]models.FormToken)}
+}
+
+func (s *MemorySessionStore) Create(ctx context.Context, sess *models.Session) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.sessions[sess.ID] = *sess
+	return nil
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || !sess.ExpiresAt.After(time.Now()) { return nil, ErrSessionNotFound }
+	return &sess, nil
+}
+
+func (s *MemorySessionStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok { sess.LastSeenAt = at; s.sessions[id] = sess }
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteExpired(ctx context.Context) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	now := time.Now()
+	for id, sess := range s.sessions { if !sess.ExpiresAt.After(now) { delete(s.sessions, id) } }
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteAllForUser(ctx context.Context, userID uint) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	for id, sess := range s.sessions { if sess.UserID == userID { delete(s.sessions, id) } }
+	return nil
+}
+
+func (s *MemorySessionStore) ListForUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	var list []models.Session
+	now := time.Now()
+	for _, sess := range s.sessions { if sess.UserID == userID && sess.ExpiresAt.After(now) { list = append(list, sess) } }
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeenAt.After(list[j].LastSeenAt) })
+	return list, nil
+}
+
+func (s *MemorySessionStore) CountActive(ctx context.Context) (int64, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	var n int64
+	now := time.Now()
+	for _, sess := range s.sessions { if sess.ExpiresAt.After(now) { n++ } }
+	return n, nil
+}
+
+func (s *MemorySessionStore) IssueFormToken(ctx context.Context, t *models.FormToken) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.tokens[t.ID] = *t
+	return nil
+}
+
+func (s *MemorySessionStore) ConsumeFormToken(ctx context.Context, sessionID, id string) (string, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok || t.SessionID != sessionID || !t.ExpiresAt.After(time.Now()) { return "", ErrFormTokenNotFound }
+	if t.Used { return t.RecordID, ErrFormTokenUsed }
+	t.Used = true
+	s.tokens[id] = t
+	return "", nil
+}
+
+func (s *MemorySessionStore) CompleteFormToken(ctx context.Context, id, recordID string) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok { t.RecordID = recordID; s.tokens[id] = t }
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteExpiredFormTokens(ctx context.Context) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	now := time.Now()
+	for id, t := range s.tokens { if !t.ExpiresAt.After(now) { delete(s.tokens, id) } }
+	return nil
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sessionTouchInterval throttles LastSeenAt updates to one write per session per interval.
+const sessionTouchInterval = time.Minute
+
+const loginHistorySize = 50
+
+// AccountData backs the account security page: a user's sessions and recent sign-in attempts.
+type AccountData struct {
+	Subject  models.AdminUser
+	Self     bool
+	Sessions []SessionInfo
+	Logins   []models.LoginEvent
+}
+
+// SessionInfo describes an active session. Ref identifies it in revoke forms without exposing the session id.
+type SessionInfo struct {
+	Ref                   string
+	CreatedAt, LastSeenAt time.Time
+	IP, UserAgent         string
+	Current               bool
+}
+
+func sessionRef(id string) string { return hashToken(id)[:16] }
+
+func (reg *Registry) cookieName() string {
+	if reg.Config.CookieName != "" { return reg.Config.CookieName }
+	return "admin_session"
+}
+
+// sessionCookie builds the session cookie with the configured Secure and SameSite attributes; maxAge < 0 deletes it.
+func (reg *Registry) sessionCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	c := &http.Cookie{Name: reg.cookieName(), Value: value, Path: reg.cookiePath(), HttpOnly: true, MaxAge: maxAge}
+	switch strings.ToLower(reg.Config.CookieSecure) {
+	case "true": c.Secure = true
+	case "false":
+	default: c.Secure = r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+	}
+	switch strings.ToLower(reg.Config.CookieSameSite) {
+	case "strict": c.SameSite = http.SameSiteStrictMode
+	case "none": c.SameSite = http.SameSiteNoneMode
+	default: c.SameSite = http.SameSiteLaxMode
+	}
+	return c
+}
+
+// sessionID is the stored id of the request's session, i.e. the hash of its cookie token, or "" without one.
+func (reg *Registry) sessionID(r *http.Request) string {
+	cookie, err := r.Cookie(reg.cookieName())
+	if err != nil || cookie.Value == "" { return "" }
+	return hashToken(cookie.Value)
+}
+
+// sessionTokenField is the hidden form field carrying the session token of a form that changes who is signed in.
+const sessionTokenField = "_session_token"
+
+// sessionToken is a token tied to r's session, so a form carrying it cannot be submitted from another site.
+func (reg *Registry) sessionToken(r *http.Request) string { return reg.sign("session", reg.sessionID(r)) }
+
+// validSessionToken reports whether r was submitted with its session's token.
+func (reg *Registry) validSessionToken(r *http.Request) bool {
+	return reg.sessionID(r) != "" && hmac.Equal([]byte(r.FormValue(sessionTokenField)), []byte(reg.sessionToken(r)))
+}
+
+// startSession signs the client in as user with a fresh token, ending the session it presented, if any.
+func (reg *Registry) startSession(w http.ResponseWriter, r *http.Request, user *models.AdminUser, impersonatorID uint) error {
+	token, err := newToken()
+	if err != nil { return err }
+	now := time.Now()
+	sess := &models.Session{
+		ID: hashToken(token), UserID: user.ID, Role: user.Role, ImpersonatorID: impersonatorID, CreatedAt: now, LastSeenAt: now,
+		ExpiresAt: now.Add(time.Duration(reg.Config.SessionTTL) * time.Hour), IP: reg.clientIP(r), UserAgent: r.UserAgent(),
+	}
+	if old := reg.sessionID(r); old != "" { if err := reg.sessions().Delete(r.Context(), old); err != nil { return err } }
+	if err := reg.sessions().Create(r.Context(), sess); err != nil { return err }
+	http.SetCookie(w, reg.sessionCookie(r, token, 0))
+	return nil
+}
+
+// clientIP is the remote address, or, when that is a trusted proxy, the nearest untrusted X-Forwarded-For entry.
+func (reg *Registry) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil { ip = r.RemoteAddr }
+	if !reg.trustedProxy(ip) { return ip }
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" { continue }
+		if ip = hop; !reg.trustedProxy(hop) { break }
+	}
+	return ip
+}
+
+func (reg *Registry) trustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil { return false }
+	for _, p := range reg.Config.TrustedProxies {
+		if _, cidr, err := net.ParseCIDR(p); err == nil && cidr.Contains(addr) { return true }
+		if other := net.ParseIP(p); other != nil && other.Equal(addr) { return true }
+	}
+	return false
+}
+
+func (reg *Registry) recordLogin(r *http.Request, userID uint, email string, success bool) {
+	err := reg.dbFor(r).Create(&models.LoginEvent{UserID: userID, Email: email, IP: reg.clientIP(r), UserAgent: r.UserAgent(), Success: success, CreatedAt: time.Now()}).Error
+	if err != nil { reg.log(r.Context()).Error("recording login failed", "email", email, "error", err) }
+}
+
+// touchSession records that a session was used, at most once per sessionTouchInterval.
+func (reg *Registry) touchSession(r *http.Request, sess *models.Session) {
+	if time.Since(sess.LastSeenAt) < sessionTouchInterval { return }
+	if err := reg.sessions().Touch(r.Context(), sess.ID, time.Now()); err != nil { reg.log(r.Context()).Error("touching session failed", "error", err) }
+}
+
+// handleAccount serves /account: the signed-in user's sessions and login history, or, for admins, another
+// user's via ?user_id=. POST /account/revoke ends one session; POST /account/logout_others ends all but the current one;
+// POST /account/locale sets the signed-in user's language, and POST /account/timezone their time zone.
+func (reg *Registry) handleAccount(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser, role string) {
+	subject := *user
+	if id := r.FormValue("user_id"); id != "" && id != fmt.Sprint(user.ID) {
+		if role != "admin" { http.Error(w, "Forbidden", 403); return }
+		var other models.AdminUser
+		if err := reg.dbFor(r).Where("id = ?", id).First(&other).Error; err != nil { reg.renderRecordError(w, r, err); return }
+		subject = other
+	}
+	current := reg.sessionID(r)
+	back := reg.URL("/account")
+	if subject.ID != user.ID { back += fmt.Sprintf("?user_id=%d", subject.ID) }
+
+	switch upath {
+	case "/account":
+	case "/account/revoke", "/account/logout_others":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		sessions, err := reg.sessions().ListForUser(r.Context(), subject.ID)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		var ids []string
+		for _, s := range sessions {
+			if s.ID == current { continue }
+			if upath == "/account/logout_others" || sessionRef(s.ID) == r.FormValue("ref") { ids = append(ids, s.ID) }
+		}
+		for _, id := range ids {
+			if err := reg.sessions().Delete(r.Context(), id); err != nil { reg.renderError(w, r, 500, err); return }
+		}
+		if len(ids) > 0 {
+			reg.RecordAction(user, usersSlug, fmt.Sprint(subject.ID), "Revoke sessions", fmt.Sprintf("%d session(s) signed out", len(ids)))
+		}
+		reg.setFlash(w, reg.T(r.Context(), "%d session(s) signed out", len(ids)))
+		http.Redirect(w, r, back, 303)
+		return
+	case "/account/locale":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		locale := r.FormValue("locale")
+		if !slices.Contains(reg.Locales(), locale) { http.Error(w, "Unknown locale", 400); return }
+		if err := reg.dbFor(r).Model(&models.AdminUser{}).Where("id = ?", user.ID).Update("locale", locale).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		if next := r.FormValue("back"); strings.HasPrefix(next, reg.basePath()+"/") && !strings.HasPrefix(next, "//") { back = next }
+		reg.setFlash(w, reg.T(withLocale(r.Context(), locale), "Language changed"))
+		http.Redirect(w, r, back, 303)
+		return
+	case "/account/timezone":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", 405); return }
+		tz := strings.TrimSpace(r.FormValue("timezone"))
+		if _, err := time.LoadLocation(tz); err != nil || strings.EqualFold(tz, "Local") { http.Error(w, "Unknown time zone", 400); return }
+		if err := reg.dbFor(r).Model(&models.AdminUser{}).Where("id = ?", user.ID).Update("timezone", tz).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		reg.setFlash(w, reg.T(r.Context(), "Time zone changed"))
+		http.Redirect(w, r, reg.URL("/account"), 303)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	data := &AccountData{Subject: subject, Self: subject.ID == user.ID}
+	sessions, err := reg.sessions().ListForUser(r.Context(), subject.ID)
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	for _, s := range sessions {
+		data.Sessions = append(data.Sessions, SessionInfo{Ref: sessionRef(s.ID), CreatedAt: s.CreatedAt, LastSeenAt: s.LastSeenAt, IP: s.IP, UserAgent: s.UserAgent, Current: s.ID == current})
+	}
+	if err := reg.dbFor(r).Where("user_id = ?", subject.ID).Order("created_at desc, id desc").Limit(loginHistorySize).Find(&data.Logins).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	title := reg.T(r.Context(), "Your account")
+	if !data.Self { title = subject.Email }
+	tmpl, err := reg.loadTemplates("templates/account.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), Account: data,
+		Title: title, Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: title}),
+	}
+	reg.execute(w, r, tmpl, "account.html", pd)
+}
@@ -0,0 +1,301 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// settingsSlug is the resource name settings changes are audited under, with the group's slug as the record id.
+const settingsSlug = "settings"
+
+// settingsRefresh is how long a process trusts its cached settings before reading them again, so a change saved
+// by another process applies within it.
+const settingsRefresh = 5 * time.Second
+
+// SettingsGroup is a section of the settings page: a form of typed fields stored in the settings table under the
+// fields' names. Each group has its own permissions, "settings.<slug>" with the actions "show" and "save".
+type SettingsGroup struct {
+	Name   string
+	Slug   string
+	Fields []Field
+}
+
+// settingsCache is a process's copy of the settings table, as stored.
+type settingsCache struct {
+	mu     sync.Mutex
+	values map[string]string
+	loaded time.Time
+}
+
+// SettingsData is the settings page: the groups the user may see, and the form of the one shown.
+type SettingsData struct {
+	Groups  []*SettingsGroup
+	Group   *SettingsGroup
+	Values  map[string]string // the form's input values, by field name
+	Errors  map[string]string // why a submitted value was refused, by field name
+	CanSave bool
+}
+
+// RegisterSettings adds a section to the settings page, a single form editing application configuration rather
+// than a list of records. Field.Type picks how a value is stored and read back: "" or "string" (text), "bool",
+// "int", "select" (one of Options) or "json"; Field.Default is the value until one is saved. Application code reads
+// the values through Setting and its typed helpers. The name "maintenance" is reserved for maintenance mode; a field
+// using it is never saved, and Validate reports it.
+func (reg *Registry) RegisterSettings(group string, fields []Field) *SettingsGroup {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	g := &SettingsGroup{Name: group, Slug: settingsGroupSlug(group), Fields: fields}
+	for i, f := range g.Fields {
+		if f.Label == "" { g.Fields[i].Label = f.Name }
+		if f.Type == "" || f.Type == "text" { g.Fields[i].Type = "string" }
+	}
+	for i, existing := range reg.settingsGroups {
+		if existing.Slug == g.Slug { reg.settingsGroups[i] = g; return g }
+	}
+	reg.settingsGroups = append(reg.settingsGroups, g)
+	return g
+}
+
+func settingsGroupSlug(name string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' { return r }
+		return '-'
+	}, strings.ToLower(name)), "-")
+}
+
+// settingField finds the registered field stored under name.
+func (reg *Registry) settingField(name string) (Field, bool) {
+	reg.mu.RLock(); defer reg.mu.RUnlock()
+	for _, g := range reg.settingsGroups {
+		for _, f := range g.Fields { if f.Name == name { return f, true } }
+	}
+	return Field{}, false
+}
+
+// settingValues are the stored settings, read from the table at most every settingsRefresh. A table that can't be
+// read leaves every setting at its default.
+func (reg *Registry) settingValues() map[string]string {
+	c := &reg.settings
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values != nil && time.Since(c.loaded) < settingsRefresh { return c.values }
+	var rows []models.Setting
+	values := make(map[string]string)
+	if err := reg.DB.Where("name <> ?", maintenanceSetting).Find(&rows).Error; err == nil {
+		for _, s := range rows { values[s.Name] = s.Value }
+	}
+	c.values, c.loaded = values, time.Now()
+	return values
+}
+
+// invalidateSettings makes the next read load the settings again.
+func (reg *Registry) invalidateSettings() {
+	reg.settings.mu.Lock()
+	reg.settings.values = nil
+	reg.settings.mu.Unlock()
+}
+
+// settingText is a setting's stored text: the saved value, else the field's default.
+func (reg *Registry) settingText(f Field) (string, bool) {
+	if v, ok := reg.settingValues()[f.Name]; ok { return v, true }
+	switch d := f.Default.(type) {
+	case nil:
+		return "", false
+	case string:
+		return d, true
+	default:
+		if f.Type == "json" {
+			b, err := json.Marshal(d)
+			return string(b), err == nil
+		}
+		return fmt.Sprint(d), true
+	}
+}
+
+// Setting reads a setting as its field's type: a string, a bool, an int or, for "json", a json.RawMessage. ok is
+// false when the setting has neither a saved value nor a default. A saved value under a name no group registers is
+// returned as its string.
+func (reg *Registry) Setting(name string) (interface{}, bool) {
+	f, registered := reg.settingField(name)
+	if !registered {
+		v, ok := reg.settingValues()[name]
+		return v, ok
+	}
+	s, ok := reg.settingText(f)
+	if !ok { return nil, false }
+	switch f.Type {
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	case "int":
+		n, err := strconv.Atoi(s)
+		return n, err == nil
+	case "json":
+		if !json.Valid([]byte(s)) { return nil, false }
+		return json.RawMessage(s), true
+	}
+	return s, true
+}
+
+// SettingString is Setting for text and select settings; "" when unset.
+func (reg *Registry) SettingString(name string) string {
+	v, _ := reg.Setting(name)
+	s, _ := v.(string)
+	return s
+}
+
+// SettingBool is Setting for "bool" settings; false when unset.
+func (reg *Registry) SettingBool(name string) bool {
+	v, _ := reg.Setting(name)
+	b, _ := v.(bool)
+	return b
+}
+
+// SettingInt is Setting for "int" settings; 0 when unset.
+func (reg *Registry) SettingInt(name string) int {
+	v, _ := reg.Setting(name)
+	n, _ := v.(int)
+	return n
+}
+
+// SettingJSON decodes a "json" setting into dest, leaving dest alone when the setting is unset.
+func (reg *Registry) SettingJSON(name string, dest interface{}) error {
+	v, ok := reg.Setting(name)
+	if !ok { return nil }
+	raw, isJSON := v.(json.RawMessage)
+	if !isJSON { return fmt.Errorf("setting %q is not a json setting", name) }
+	return json.Unmarshal(raw, dest)
+}
+
+// parseSetting checks a submitted value against f and returns the text to store; unset means the setting goes back
+// to its default. A checkbox that isn't submitted is false.
+func parseSetting(f Field, input string) (value string, unset bool, err error) {
+	if f.Type == "bool" {
+		b, _ := strconv.ParseBool(input)
+		return strconv.FormatBool(b || input == "on"), false, nil
+	}
+	if f.Type != "string" { input = strings.TrimSpace(input) }
+	if input == "" {
+		if f.Required { return "", false, fmt.Errorf("%s is required", f.Label) }
+		return "", f.Type != "string", nil
+	}
+	switch f.Type {
+	case "int":
+		n, err := strconv.Atoi(input)
+		if err != nil { return "", false, fmt.Errorf("%s must be a whole number", f.Label) }
+		return strconv.Itoa(n), false, nil
+	case "select":
+		if !slices.Contains(f.Options, input) { return "", false, fmt.Errorf("%q is not a valid %s", input, f.Label) }
+	case "json":
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(input)); err != nil { return "", false, fmt.Errorf("%s must be valid JSON: %v", f.Label, err) }
+		return buf.String(), false, nil
+	}
+	return input, false, nil
+}
+
+// settingsGroupsFor are the settings groups user may see, in registration order.
+func (reg *Registry) settingsGroupsFor(user *models.AdminUser) []*SettingsGroup {
+	if user == nil { return nil }
+	reg.mu.RLock()
+	groups := slices.Clone(reg.settingsGroups)
+	reg.mu.RUnlock()
+	var visible []*SettingsGroup
+	for _, g := range groups {
+		if reg.IsAllowed(user.Role, settingsSlug+"."+g.Slug, "show") || reg.IsAllowed(user.Role, settingsSlug+"."+g.Slug, "save") { visible = append(visible, g) }
+	}
+	return visible
+}
+
+// saveSettings stores a group's submitted values in one transaction and audits what changed, one line per setting.
+// It returns the per-field errors of refused values, in which case nothing is saved.
+func (reg *Registry) saveSettings(user *models.AdminUser, g *SettingsGroup, form map[string]string) (map[string]string, error) {
+	stored := reg.settingValues()
+	errs := make(map[string]string)
+	var lines []string
+	saves, deletes := []models.Setting{}, []string{}
+	for _, f := range g.Fields {
+		if f.Readonly || f.Name == maintenanceSetting { continue }
+		value, unset, err := parseSetting(f, form[f.Name])
+		if err != nil { errs[f.Name] = err.Error(); continue }
+		old, had := stored[f.Name]
+		if unset {
+			if !had { continue }
+			deletes = append(deletes, f.Name)
+			lines = append(lines, fmt.Sprintf("%s: %q → default", f.Name, old))
+			continue
+		}
+		if had && old == value { continue }
+		saves = append(saves, models.Setting{Name: f.Name, Value: value})
+		if had { lines = append(lines, fmt.Sprintf("%s: %q → %q", f.Name, old, value)) } else { lines = append(lines, fmt.Sprintf("%s: %q", f.Name, value)) }
+	}
+	if len(errs) > 0 { return errs, nil }
+	if len(lines) == 0 { return nil, nil }
+	note := strings.Join(lines, "\n")
+	err := reg.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range saves {
+			if err := tx.Save(&saves[i]).Error; err != nil { return err }
+		}
+		if len(deletes) > 0 {
+			if err := tx.Where("name IN ?", deletes).Delete(&models.Setting{}).Error; err != nil { return err }
+		}
+		return reg.recordAction(tx, user, settingsSlug, g.Slug, "Update", note)
+	})
+	reg.invalidateSettings()
+	if err != nil { return nil, err }
+	reg.afterAudit(user, settingsSlug, g.Slug, "Update", note)
+	return nil, nil
+}
+
+// handleSettings serves the settings page at /settings, showing the first group the user may see, and
+// /settings/<group>; POST /settings/<group> saves that group.
+func (reg *Registry) handleSettings(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser) {
+	groups := reg.settingsGroupsFor(user)
+	slug := strings.Trim(strings.TrimPrefix(upath, "/settings"), "/")
+	if slug == "" && len(groups) > 0 { slug = groups[0].Slug }
+	var g *SettingsGroup
+	for _, candidate := range groups { if candidate.Slug == slug { g = candidate } }
+	if g == nil {
+		if slug == "" { http.NotFound(w, r) } else { http.Error(w, "Forbidden", 403) }
+		return
+	}
+	data := &SettingsData{Groups: groups, Group: g, Values: make(map[string]string), CanSave: reg.IsAllowed(user.Role, settingsSlug+"."+g.Slug, "save")}
+	status := http.StatusOK
+	if r.Method == "POST" {
+		if !data.CanSave { http.Error(w, "Forbidden", 403); return }
+		if reg.maintenanceBlocks(user) { reg.refuseMaintenance(w, r, user); return }
+		r.ParseForm()
+		form := make(map[string]string, len(g.Fields))
+		for _, f := range g.Fields { form[f.Name] = r.PostFormValue(f.Name) }
+		errs, err := reg.saveSettings(user, g, form)
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		if len(errs) == 0 {
+			reg.setFlash(w, reg.T(r.Context(), "%s settings saved", g.Name))
+			http.Redirect(w, r, reg.URL("/settings/"+g.Slug), 303)
+			return
+		}
+		data.Values, data.Errors, status = form, errs, http.StatusUnprocessableEntity
+	} else if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", 405); return
+	} else {
+		for _, f := range g.Fields { data.Values[f.Name], _ = reg.settingText(f) }
+	}
+	tmpl, err := reg.loadTemplates("templates/settings.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	pd := PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), Settings: data,
+		Title: reg.T(r.Context(), "Settings"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Settings"), URL: reg.URL("/settings")}, Crumb{Label: g.Name}),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	reg.execute(w, r, tmpl, "settings.html", pd)
+}
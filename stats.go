@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// StatFunc computes a dashboard number.
+type StatFunc func(db *gorm.DB) (int64, error)
+
+// DashboardStat is a custom stat card. Set Link to make the card clickable, Previous to show the change against
+// an earlier period as a percentage, Resource to show the card only to roles that may list that resource, and
+// VisibleTo to show it only to those roles (and admins).
+type DashboardStat struct {
+	Label     string
+	Provider  StatFunc
+	Previous  StatFunc
+	Link      string
+	Resource  string
+	VisibleTo []string
+}
+
+// AddStat adds a stat card to the dashboard, after the per-resource counts (see Config.AutoResourceStats).
+func (reg *Registry) AddStat(label string, provider StatFunc) *DashboardStat {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	s := &DashboardStat{Label: label, Provider: provider}
+	reg.Stats = append(reg.Stats, s)
+	return s
+}
+
+// dashboardStats computes the cards the user may see. A failing provider marks its own card rather than the page.
+func (reg *Registry) dashboardStats(r *http.Request, user *models.AdminUser) []Stat {
+	var stats []Stat
+	if reg.Config.AutoResourceStats {
+		for _, res := range reg.sortedResources() {
+			if res.HiddenFromDashboard || !reg.IsAllowed(user.Role, res.Slug, "list") { continue }
+			var query *gorm.DB
+			if res.DefaultScope != "" {
+				lq, err := reg.buildListQuery(r.Context(), res, nil)
+				if err != nil { stats = append(stats, Stat{Label: res.Name, Error: "Unavailable", Link: reg.URL("/" + res.Slug)}); continue }
+				query = lq.CountQuery()
+			}
+			stats = append(stats, Stat{Label: res.Name, Value: reg.CountFor(r.Context(), res, query), Link: reg.URL("/" + res.Slug)})
+		}
+	}
+	reg.mu.RLock()
+	custom := append([]*DashboardStat(nil), reg.Stats...)
+	reg.mu.RUnlock()
+	for _, def := range custom {
+		if (def.Resource != "" && !reg.IsAllowed(user.Role, def.Resource, "list")) || !visibleToRoles(def.VisibleTo, user) { continue }
+		st := Stat{Label: def.Label, Link: def.Link}
+		db := reg.readFor(r)
+		if res, ok := reg.GetResource(def.Resource); ok { db = reg.scope(r.Context(), res, reg.resourceReader(r.Context(), res)) }
+		value, err := def.Provider(db.Session(&gorm.Session{}))
+		if err != nil {
+			reg.log(r.Context()).Error("stat failed", "stat", def.Label, "error", err)
+			st.Error = "Unavailable"
+			if detail := reg.errorDetail(err); detail != "" { st.Error = detail }
+			stats = append(stats, st); continue
+		}
+		st.Value = value
+		if def.Previous != nil {
+			if prev, err := def.Previous(db.Session(&gorm.Session{})); err == nil && prev != 0 {
+				change := float64(value-prev) * 100 / float64(prev)
+				st.Trend, st.TrendUp = fmt.Sprintf("%+.0f%%", change), change >= 0
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// tagsLimit caps the suggestions returned for a tags field.
+const tagsLimit = 20
+
+// tagValues reads a "tags" field: a []string, or a string column holding a JSON array.
+func tagValues(v interface{}) []string {
+	switch t := v.(type) {
+	case []string:
+		return t
+	case string:
+		var tags []string
+		if t != "" && json.Unmarshal([]byte(t), &tags) != nil { return nil }
+		return tags
+	}
+	return nil
+}
+
+// formTags collects a tags field's submitted values. The chip input posts one value per tag; without JavaScript the
+// text input's value is split on commas. Blanks and duplicates are dropped, so an empty submission clears the field.
+func formTags(values []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !seen[tag] { seen[tag] = true; tags = append(tags, tag) }
+		}
+	}
+	return tags
+}
+
+// setTags stores tags in a []string field, or JSON-encodes them into a string field.
+func setTags(field reflect.Value, tags []string) error {
+	switch {
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		s := reflect.MakeSlice(field.Type(), len(tags), len(tags))
+		for i, tag := range tags { s.Index(i).SetString(tag) }
+		field.Set(s)
+	case field.Kind() == reflect.String:
+		if tags == nil { tags = []string{} }
+		data, _ := json.Marshal(tags)
+		field.SetString(string(data))
+	default:
+		return fmt.Errorf("tags need a []string or string field, not %s", field.Type())
+	}
+	return nil
+}
+
+// tagPattern matches a JSON array column containing tag, for the "has tag" filter.
+func tagPattern(tag string) string {
+	data, _ := json.Marshal(tag)
+	return "%" + string(data) + "%"
+}
+
+// handleTagSuggestions serves /<resource>/tags?field=Tags&q=ab, the existing values of a tags field starting with q,
+// for the chip input's typeahead.
+func (reg *Registry) handleTagSuggestions(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+	var field *resource.Field
+	for i := range res.Fields { if res.Fields[i].Name == r.URL.Query().Get("field") && res.Fields[i].Type == "tags" { field = &res.Fields[i] } }
+	if field == nil || !field.VisibleFor(CurrentUser(r.Context())) { http.Error(w, "Not found", 404); return }
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	col, ok := column(sch, field.Name)
+	if !ok { http.Error(w, "Not found", 404); return }
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	var raw []string
+	if err := reg.scope(r.Context(), res, reg.resourceDB(r.Context(), res).Model(res.Model)).Distinct(col).Where(col+" LIKE ?", "%"+q+"%").Limit(500).Pluck(col, &raw).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	seen := make(map[string]bool)
+	suggestions := []string{}
+	for _, v := range raw {
+		for _, tag := range tagValues(v) {
+			if !seen[tag] && strings.HasPrefix(strings.ToLower(tag), q) { seen[tag] = true; suggestions = append(suggestions, tag) }
+		}
+	}
+	sort.Strings(suggestions)
+	if len(suggestions) > tagsLimit { suggestions = suggestions[:tagsLimit] }
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
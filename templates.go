@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// templateFile is a UI file together with where it was read from, for error messages.
+type templateFile struct {
+	content  []byte
+	source   string
+	embedded bool
+}
+
+// templateStore caches override files so production servers only hit the disk once per file.
+type templateStore struct {
+	mu    sync.Mutex
+	files map[string]templateFile
+}
+
+// readTemplateFile returns a UI file (e.g. "index.html" or "style.css"), preferring Config.TemplateOverrideDir
+// over the embedded copy. Overrides are re-read on every call in DevMode so edits show up without a restart.
+func (reg *Registry) readTemplateFile(name string) (templateFile, error) {
+	if dir := reg.Config.TemplateOverrideDir; dir != "" {
+		if !reg.Config.DevMode {
+			reg.templates.mu.Lock(); f, ok := reg.templates.files[name]; reg.templates.mu.Unlock()
+			if ok { return f, nil }
+		}
+		path := filepath.Join(dir, name)
+		content, err := os.ReadFile(path)
+		if err == nil {
+			f := templateFile{content: content, source: path}
+			if !reg.Config.DevMode {
+				reg.templates.mu.Lock(); reg.templates.files[name] = f; reg.templates.mu.Unlock()
+			}
+			return f, nil
+		}
+		if !os.IsNotExist(err) { return templateFile{}, fmt.Errorf("read template override %s: %w", path, err) }
+	}
+	content, err := templateFS.ReadFile("templates/" + name)
+	if err != nil { return templateFile{}, fmt.Errorf("read embedded template %s: %w", name, err) }
+	return templateFile{content: content, source: "embedded templates/" + name, embedded: true}, nil
+}
+
+// parseTemplates parses the named files into one template set, each named after its file like template.ParseFS does.
+func (reg *Registry) parseTemplates(names ...string) (*template.Template, error) {
+	var tmpl *template.Template
+	for _, name := range names {
+		f, err := reg.readTemplateFile(name)
+		if err != nil { return nil, err }
+		var t *template.Template
+		if tmpl == nil { tmpl = template.New(name); t = tmpl } else { t = tmpl.New(name) }
+		if _, err := t.Parse(string(f.content)); err != nil { return nil, fmt.Errorf("parse %s: %w", f.source, err) }
+	}
+	return tmpl, nil
+}
+
+// styleCSS is the stylesheet pages inline, set only when Config.TemplateOverrideDir replaces style.css; the embedded
+// stylesheet is linked from the asset route instead, see PageData.StyleAsset.
+func (reg *Registry) styleCSS() template.CSS {
+	f, err := reg.readTemplateFile("style.css")
+	if err != nil || f.embedded { return "" }
+	return template.CSS(f.content)
+}
+
+// embeddedStyle is the embedded style.css, served as /assets/style.<hash>.css so browsers can cache it for good.
+var embeddedStyle, _ = templateFS.ReadFile("templates/style.css")
+
+var styleAsset = func() string { sum := sha256.Sum256(embeddedStyle); return "style." + hex.EncodeToString(sum[:6]) + ".css" }()
+
+// StyleAsset is the name of the embedded stylesheet under the asset route.
+func (PageData) StyleAsset() string { return styleAsset }
+
+// handleAsset serves the embedded stylesheet under its content-hashed name, cacheable for a year. Any other name,
+// including an outdated hash, is not found.
+func (reg *Registry) handleAsset(w http.ResponseWriter, r *http.Request, upath string) {
+	if strings.TrimPrefix(upath, "/assets/") != styleAsset { http.NotFound(w, r); return }
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(embeddedStyle)
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// trashPurgeBatch is how many trashed records a purge loads and deletes at a time.
+const trashPurgeBatch = 500
+
+// systemUser is who scheduled work, such as the trash purger, is audited as.
+var systemUser = &models.AdminUser{Email: "system"}
+
+// StartTrashPurger permanently deletes soft-deleted records past their resource's TrashRetention every interval,
+// starting now, until BeginShutdown. Only the first call starts it.
+func (reg *Registry) StartTrashPurger(interval time.Duration) {
+	reg.trashPurger.Do(func() {
+		reg.goBackground(func(ctx context.Context) {
+			for {
+				for _, res := range reg.sortedResources() {
+					if res.TrashRetentionDays <= 0 { continue }
+					if _, err := reg.purgeTrash(ctx, res, systemUser); err != nil && ctx.Err() == nil { reg.Logger.Error("purging trash failed", "resource", res.Slug, "error", err) }
+				}
+				select {
+				case <-ctx.Done(): return
+				case <-time.After(interval):
+				}
+			}
+		})
+	})
+}
+
+// trashQuery selects res's records soft deleted before its retention window, or reports false when res has no
+// DeletedAt column or retention.
+func (reg *Registry) trashQuery(ctx context.Context, res *resource.Resource) (func() *gorm.DB, string, bool) {
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil || res.TrashRetentionDays <= 0 { return nil, "", false }
+	del := sch.LookUpField("DeletedAt")
+	if del == nil || del.DBName == "" { return nil, "", false }
+	cutoff := time.Now().AddDate(0, 0, -res.TrashRetentionDays)
+	col := sch.Table + "." + del.DBName
+	pk, ok := column(sch, res.PrimaryKey)
+	if !ok { return nil, "", false }
+	return func() *gorm.DB {
+		return reg.resourceDB(ctx, res).Unscoped().Model(res.Model).Where(col+" IS NOT NULL AND "+col+" < ?", cutoff)
+	}, pk, true
+}
+
+// purgeTrash permanently deletes res's records trashed more than TrashRetentionDays ago, trashPurgeBatch at a
+// time, along with their uploaded files, and records one audit entry for the run. It stops between batches once ctx
+// is done, returning what it purged so far.
+func (reg *Registry) purgeTrash(ctx context.Context, res *resource.Resource, user *models.AdminUser) (int64, error) {
+	query, pk, ok := reg.trashQuery(ctx, res)
+	if !ok { return 0, fmt.Errorf("%s has no trash to purge: it needs a gorm.DeletedAt field and a TrashRetention", res.Name) }
+	var purged int64
+	var err error
+	for ctx.Err() == nil {
+		rows := reflect.New(res.Meta().SliceType)
+		if err = query().Order(pk).Limit(trashPurgeBatch).Find(rows.Interface()).Error; err != nil { break }
+		items := rows.Elem()
+		if items.Len() == 0 { break }
+		keys := make([]interface{}, items.Len())
+		var files []string
+		for i := 0; i < items.Len(); i++ {
+			item := reflect.Indirect(items.Index(i))
+			keys[i] = recordKey(res, item)
+			for _, f := range res.Fields {
+				if f.Type != "image" && f.Type != "file" { continue }
+				if v := reflect.Indirect(fieldValue(item, f.Name)); v.IsValid() && v.Kind() == reflect.String { files = append(files, v.String()) }
+			}
+		}
+		result := query().Where(pk+" IN ?", keys).Delete(reflect.New(reflect.TypeOf(res.Model)).Interface())
+		if err = result.Error; err != nil { break }
+		purged += result.RowsAffected
+		for _, f := range files { reg.removeUpload(f) }
+		if items.Len() < trashPurgeBatch { break }
+	}
+	if err == nil { err = ctx.Err() }
+	if purged > 0 || user != systemUser {
+		reg.Logger.Info("trash purged", "resource", res.Slug, "records", purged, "retention_days", res.TrashRetentionDays)
+		reg.RecordAction(user, res.Slug, "", "Purge trash", fmt.Sprintf("Permanently deleted %d records trashed more than %d days ago", purged, res.TrashRetentionDays))
+	}
+	return purged, err
+}
+
+// handlePurgeTrash serves "Purge trash now" for admins: GET asks for confirmation with the number of records
+// past retention, and POST with confirm purges them.
+func (reg *Registry) handlePurgeTrash(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	query, _, ok := reg.trashQuery(r.Context(), res)
+	if !ok { reg.renderError(w, r, http.StatusNotFound, nil); return }
+	if r.Method != "POST" || r.FormValue("confirm") == "" {
+		var count int64
+		if err := query().Count(&count).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		tmpl, err := reg.loadTemplates("templates/purge_trash.html")
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		reg.execute(w, r, tmpl, "purge_trash.html", PageData{
+			SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+			CurrentResource: res, User: user, CSS: reg.styleCSS(), TotalCount: count,
+			Title: reg.T(r.Context(), "Purge trash"), Breadcrumbs: reg.breadcrumbs(r.Context(), reg.resourceCrumb(r.Context(), res), Crumb{Label: reg.T(r.Context(), "Purge trash")}),
+		})
+		return
+	}
+	purged, err := reg.purgeTrash(r.Context(), res, user)
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.setFlash(w, reg.T(r.Context(), "Permanently deleted %d records from the trash", purged))
+	http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+}
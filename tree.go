@@ -0,0 +1,252 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+// treeDepthLimit bounds walks through a tree, so a cycle already in the data cannot loop forever.
+const treeDepthLimit = 100
+
+// treeChildLimit caps the children loaded when a tree record is expanded.
+const treeChildLimit = 500
+
+var errTreeCycle = errors.New("A record cannot be placed under itself or one of its descendants.")
+
+// TreeNode is a record of a tree: a step of a breadcrumb, or a child listed by the tree view.
+type TreeNode struct {
+	ID       interface{} `json:"id"`
+	Label    string      `json:"label"`
+	URL      string      `json:"url"`
+	Children int64       `json:"children"`
+}
+
+// treeParent returns the parent key of a tree record, or nil for a root.
+func treeParent(res *resource.Resource, item reflect.Value) interface{} {
+	fv := reflect.Indirect(fieldValue(item, res.TreeField))
+	if !fv.IsValid() || fv.IsZero() { return nil }
+	return fv.Interface()
+}
+
+// treeColumn returns the qualified parent column of a tree resource.
+func (reg *Registry) treeColumn(res *resource.Resource) (string, error) {
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return "", err }
+	col, ok := column(sch, res.TreeField)
+	if !ok { return "", fmt.Errorf("tree: %s has no field %q", res.Name, res.TreeField) }
+	return col, nil
+}
+
+// whereParent narrows q to the children of the record keyed parent, or to the roots when parent is nil: rows whose
+// parent column is NULL or the zero value.
+func (reg *Registry) whereParent(q *gorm.DB, res *resource.Resource, parent interface{}) (*gorm.DB, error) {
+	col, err := reg.treeColumn(res)
+	if err != nil { return nil, err }
+	if parent != nil {
+		val, err := keyValue(res, parent)
+		if err != nil { return nil, gorm.ErrRecordNotFound }
+		return q.Where(col+" = ?", val), nil
+	}
+	t := reflect.TypeOf(res.Model)
+	sf, _ := t.FieldByName(res.TreeField)
+	zt := sf.Type; if zt.Kind() == reflect.Ptr { zt = zt.Elem() }
+	return q.Where(col+" IS NULL OR "+col+" = ?", reflect.Zero(zt).Interface()), nil
+}
+
+func (reg *Registry) treeNode(res *resource.Resource, item reflect.Value) TreeNode {
+	id := recordKey(res, item)
+	return TreeNode{ID: id, Label: recordLabel(res, item), URL: reg.URL(fmt.Sprintf("/%s/show?id=%s", res.Slug, url.QueryEscape(fmt.Sprint(id))))}
+}
+
+// treeAncestors walks up from the record keyed parent to its root and returns the path root first. The walk goes
+// through db with the scope applied and stops at a record it cannot see, or at one it has seen before.
+func (reg *Registry) treeAncestors(db *gorm.DB, res *resource.Resource, parent interface{}) ([]TreeNode, error) {
+	var path []TreeNode
+	seen := make(map[string]bool)
+	for parent != nil && len(path) < treeDepthLimit && !seen[fmt.Sprint(parent)] {
+		seen[fmt.Sprint(parent)] = true
+		q, err := reg.whereKey(reg.scope(db.Statement.Context, res, db), res, parent)
+		if err != nil { return nil, err }
+		item := reflect.New(reflect.TypeOf(res.Model))
+		result := q.Limit(1).Find(item.Interface())
+		if result.Error != nil { return nil, result.Error }
+		if result.RowsAffected == 0 { break }
+		path = append([]TreeNode{reg.treeNode(res, item)}, path...)
+		parent = treeParent(res, item)
+	}
+	return path, nil
+}
+
+// treeDescendants collects the keys, formatted with %v, of the record keyed id and of every record below it.
+func (reg *Registry) treeDescendants(db *gorm.DB, res *resource.Resource, id interface{}) (map[string]bool, error) {
+	col, err := reg.treeColumn(res)
+	if err != nil { return nil, err }
+	sch, err := reg.parseSchema(res.Model)
+	if err != nil { return nil, err }
+	pk, ok := column(sch, res.PrimaryKey)
+	if !ok { return nil, fmt.Errorf("admin: %s has no key field %q", res.Name, res.PrimaryKey) }
+	found := map[string]bool{fmt.Sprint(id): true}
+	level := []interface{}{id}
+	for depth := 0; len(level) > 0 && depth < treeDepthLimit; depth++ {
+		rows, err := db.Model(res.Model).Select(pk).Where(col+" IN ?", level).Rows()
+		if err != nil { return nil, err }
+		level = nil
+		for rows.Next() {
+			var key interface{}
+			if err := rows.Scan(&key); err != nil { rows.Close(); return nil, err }
+			if b, ok := key.([]byte); ok { key = string(b) }
+			if !found[fmt.Sprint(key)] { found[fmt.Sprint(key)] = true; level = append(level, key) }
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil { return nil, err }
+	}
+	return found, nil
+}
+
+// checkTreeParent refuses a save that would place a tree record under itself or one of its descendants.
+func (reg *Registry) checkTreeParent(tx *gorm.DB, res *resource.Resource, item reflect.Value) error {
+	if res.TreeField == "" { return nil }
+	parent, key := treeParent(res, item), recordKey(res, item)
+	if parent == nil || key == nil || reflect.ValueOf(key).IsZero() { return nil }
+	if fmt.Sprint(parent) == fmt.Sprint(key) { return errTreeCycle }
+	path, err := reg.treeAncestors(tx, res, parent)
+	if err != nil { return err }
+	for _, n := range path { if fmt.Sprint(n.ID) == fmt.Sprint(key) { return errTreeCycle } }
+	return nil
+}
+
+// excludeDescendants drops item and its descendants from a parent picker's options.
+func (reg *Registry) excludeDescendants(db *gorm.DB, res *resource.Resource, item reflect.Value, a *AssociationData) error {
+	if a == nil || a.Options == nil { return nil }
+	excluded, err := reg.treeDescendants(db, res, recordKey(res, item))
+	if err != nil { return err }
+	var options []map[string]interface{}
+	for _, o := range a.Options { if !excluded[fmt.Sprint(o[keyEntry])] { options = append(options, o) } }
+	a.Options = options
+	return nil
+}
+
+// releaseTreeChildren runs before a tree record is deleted: its children move up to its parent when the resource
+// reparents on delete, and otherwise the delete is refused while it has any.
+func (reg *Registry) releaseTreeChildren(db *gorm.DB, res *resource.Resource, id string) error {
+	if res.TreeField == "" { return nil }
+	col, err := reg.treeColumn(res)
+	if err != nil { return err }
+	key, err := keyValue(res, id)
+	if err != nil { return gorm.ErrRecordNotFound }
+	children := func() *gorm.DB { return db.Model(reflect.New(reflect.TypeOf(res.Model)).Interface()).Where(col+" = ?", key) }
+	if !res.TreeReparent {
+		var n int64
+		if err := children().Count(&n).Error; err != nil { return err }
+		if n > 0 { return fmt.Errorf("%s #%s has %d child records; move or delete them first", res.Name, id, n) }
+		return nil
+	}
+	q, err := reg.whereKey(db, res, id)
+	if err != nil { return err }
+	item := reflect.New(reflect.TypeOf(res.Model))
+	if err := q.First(item.Interface()).Error; err != nil { return err }
+	sch, _ := reg.parseSchema(res.Model)
+	return children().Update(sch.LookUpField(res.TreeField).DBName, fieldValue(item, res.TreeField).Interface()).Error
+}
+
+// handleTreeChildren serves /<resource>/children?parent=N, the records directly under N (the roots when parent is
+// empty) with their own child counts, as JSON for the tree view. The list's scope and filters apply to each level.
+func (reg *Registry) handleTreeChildren(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+	if res.TreeField == "" { http.Error(w, "Not found", 404); return }
+	filters := url.Values{}
+	for k, v := range r.URL.Query() { if k != "parent" { filters[k] = v } }
+	lq, err := reg.buildListQuery(r.Context(), res, filters)
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	col, err := reg.treeColumn(res)
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	all := lq.DB.Session(&gorm.Session{})
+	var parent interface{}
+	if p := r.URL.Query().Get("parent"); p != "" { parent = p }
+	if lq.DB, err = reg.whereParent(lq.DB.Session(&gorm.Session{}), res, parent); err != nil { reg.renderRecordError(w, r, err); return }
+	if res.PositionField != "" { lq.Sort(res.PositionField, "asc") } else { lq.DB = lq.DB.Order(lq.PK + " asc") }
+	lq.DB = lq.DB.Limit(treeChildLimit)
+	dest := reflect.New(res.Meta().SliceType)
+	if err := lq.Find(dest.Interface()); err != nil { reg.renderError(w, r, 500, err); return }
+	items := dest.Elem()
+	nodes := []TreeNode{}
+	var keys []interface{}
+	for i := 0; i < items.Len(); i++ {
+		nodes = append(nodes, reg.treeNode(res, items.Index(i)))
+		keys = append(keys, nodes[i].ID)
+	}
+	if len(keys) > 0 {
+		count := "COUNT(*)"; if lq.Joined { count = "COUNT(DISTINCT " + lq.PK + ")" }
+		rows, err := all.Select(col+", "+count).Where(col+" IN ?", keys).Group(col).Rows()
+		if err != nil { reg.renderError(w, r, 500, err); return }
+		counts := make(map[string]int64)
+		for rows.Next() {
+			var key interface{}; var n int64
+			if err := rows.Scan(&key, &n); err != nil { rows.Close(); reg.renderError(w, r, 500, err); return }
+			if b, ok := key.([]byte); ok { key = string(b) }
+			counts[fmt.Sprint(key)] = n
+		}
+		rows.Close()
+		for i := range nodes { nodes[i].Children = counts[fmt.Sprint(nodes[i].ID)] }
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// handleTreeMove serves /<resource>/move_under?id=N: a form picking the record's new parent, saved like a batch edit
+// of the parent field, so the cycle check, save hooks and audit entry apply.
+func (reg *Registry) handleTreeMove(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if res.TreeField == "" { http.Error(w, "Not found", 404); return }
+	id := r.URL.Query().Get("id")
+	item, err := reg.getContext(r.Context(), res.Slug, id)
+	if err != nil { reg.renderRecordError(w, r, err); return }
+	f := resource.Field{Name: res.TreeField, Label: "Parent", Type: "text"}
+	for _, rf := range res.Fields { if rf.Name == res.TreeField { f = rf } }
+	f.Readonly = false
+	var formErr string
+	if r.Method == "POST" {
+		var change FieldChange
+		err := reg.resourceDB(r.Context(), res).Transaction(func(tx *gorm.DB) error {
+			var err error
+			if change, err = reg.editRecordField(tx, res, f, id, r.FormValue(f.Name), user); err != nil { return err }
+			return reg.recordAction(tx, user, res.Slug, id, "Update", treeMoveNote(f.Name, change))
+		})
+		if err == nil {
+			reg.afterAuditChanges(user, res.Slug, id, "Update", treeMoveNote(f.Name, change), map[string]FieldChange{f.Name: change})
+			reg.notifyChange(user, res.Slug, "update", id, map[string]FieldChange{f.Name: change})
+			reg.setFlash(w, reg.T(r.Context(), "%s moved", reg.resName(r.Context(), res)))
+			http.Redirect(w, r, reg.URL("/"+res.Slug+"/show?id="+url.QueryEscape(id)), 303)
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) { reg.renderRecordError(w, r, err); return }
+		formErr = "Could not move: " + err.Error()
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	elem := reflect.ValueOf(item)
+	var a *AssociationData
+	if assoc, ok := res.GetAssociation(res.TreeField); ok { a = reg.belongsToData(r, assoc) }
+	if err := reg.excludeDescendants(reg.resourceDB(r.Context(), res), res, elem, a); err != nil { reg.renderError(w, r, 500, err); return }
+	path, err := reg.treeAncestors(reg.resourceDB(r.Context(), res), res, treeParent(res, elem))
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/form.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	label := fmt.Sprintf("Move %s under…", recordLabel(res, elem))
+	reg.execute(w, r, tmpl, "form.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		CurrentResource: res, Fields: []resource.Field{f}, Sections: res.GroupFields([]resource.Field{f}), Item: reg.itemToMap(res, []resource.Field{f}, elem, user),
+		Associations: map[string]*AssociationData{f.Name: a}, User: user, CSS: reg.styleCSS(), Error: formErr, TreePath: path,
+		FormAction: r.URL.RequestURI(), FormTitle: label, SubmitLabel: "Move",
+		Title: reg.T(r.Context(), "Move %s", reg.recordTitle(r.Context(), res, recordKey(res, elem))), Breadcrumbs: reg.recordCrumbs(r.Context(), res, item, path, reg.T(r.Context(), "Move")),
+	})
+}
+
+func treeMoveNote(fieldName string, change FieldChange) string {
+	return fmt.Sprintf("%s: %q → %q (moved)", fieldName, fmt.Sprint(change.From), fmt.Sprint(change.To))
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stagedUpload is a file written under a temporary name until the save that references it commits.
+type stagedUpload struct{ tmp, final string }
+
+// stageUpload copies an uploaded file into UploadDir under a temporary name and returns its final name.
+func (reg *Registry) stageUpload(file multipart.File, header *multipart.FileHeader) (stagedUpload, string, error) {
+	if err := os.MkdirAll(reg.Config.UploadDir, 0755); err != nil { return stagedUpload{}, "", err }
+	name := fmt.Sprintf("%d%s", time.Now().UnixNano(), filepath.Ext(header.Filename))
+	s := stagedUpload{tmp: filepath.Join(reg.Config.UploadDir, ".tmp-"+name), final: filepath.Join(reg.Config.UploadDir, name)}
+	dst, err := os.Create(s.tmp)
+	if err != nil { return stagedUpload{}, "", err }
+	_, err = io.Copy(dst, file)
+	if cerr := dst.Close(); err == nil { err = cerr }
+	if err != nil { os.Remove(s.tmp); return stagedUpload{}, "", err }
+	return s, name, nil
+}
+
+// finishUploads promotes staged files to their final names when the save committed, and removes them otherwise.
+func (reg *Registry) finishUploads(staged []stagedUpload, committed bool) {
+	for _, s := range staged {
+		if !committed { os.Remove(s.tmp); continue }
+		if err := os.Rename(s.tmp, s.final); err != nil { reg.Logger.Error("promoting upload failed", "file", s.final, "error", err) }
+	}
+}
+
+// removeUpload deletes the file of a stored upload value, such as "/admin/uploads/1700000000.png"; other values,
+// such as external URLs, are left alone.
+func (reg *Registry) removeUpload(p string) {
+	name, ok := strings.CutPrefix(strings.TrimPrefix(p, reg.basePath()), "/uploads/")
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") { return }
+	if err := os.Remove(filepath.Join(reg.Config.UploadDir, name)); err != nil && !os.IsNotExist(err) { reg.Logger.Error("removing upload failed", "file", name, "error", err) }
+}
+
+// SignedUploadURL returns a link to an upload (a stored value such as "/admin/uploads/1700000000.png") that stays
+// valid for ttl, signed with Config.SecretKey. Values that aren't admin uploads, such as external URLs, are returned
+// as they are.
+func (reg *Registry) SignedUploadURL(p string, ttl time.Duration) string {
+	name, ok := strings.CutPrefix(strings.TrimPrefix(p, reg.basePath()), "/uploads/")
+	if !ok || name == "" { return p }
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return reg.URL("/uploads/" + name + "?expires=" + expires + "&sig=" + reg.uploadSignature(name, expires))
+}
+
+func (reg *Registry) uploadSignature(name, expires string) string { return reg.sign(name, expires) }
+
+// sign is the HMAC of parts, one per line, with Config.SecretKey, for links that work without a session.
+func (reg *Registry) sign(parts ...string) string {
+	key := []byte(reg.Config.SecretKey)
+	if len(key) == 0 { key = reg.signingKey }
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// uploadLink is how pages link to a stored upload: signed for Config.UploadURLTTL minutes with PrivateUploads.
+func (reg *Registry) uploadLink(p string) string {
+	if !reg.Config.PrivateUploads { return p }
+	return reg.SignedUploadURL(p, time.Duration(reg.Config.UploadURLTTL)*time.Minute)
+}
+
+// validUploadSignature checks a private upload request's signature and expiry.
+func (reg *Registry) validUploadSignature(name string, q url.Values) bool {
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires { return false }
+	return hmac.Equal([]byte(q.Get("sig")), []byte(reg.uploadSignature(name, q.Get("expires"))))
+}
+
+// handleStatic serves an upload. With PrivateUploads it needs both a signed, unexpired link and a signed-in user.
+func (reg *Registry) handleStatic(w http.ResponseWriter, r *http.Request, upath string) {
+	fileName := strings.TrimPrefix(upath, "/uploads/")
+	if strings.HasPrefix(path.Base(fileName), ".tmp-") { http.NotFound(w, r); return }
+	if reg.Config.PrivateUploads {
+		if user, _ := reg.GetUserFromRequest(r); user == nil || !reg.validUploadSignature(fileName, r.URL.Query()) { http.Error(w, "Forbidden", http.StatusForbidden); return }
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	// http.ServeFile sets Last-Modified; the ETag lets clients revalidate an unchanged upload with If-None-Match.
+	full := filepath.Join(reg.Config.UploadDir, fileName)
+	if fi, err := os.Stat(full); err == nil && fi.Mode().IsRegular() { w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())) }
+	http.ServeFile(w, r, full)
+}
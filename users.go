@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// usersSlug is the built-in user management resource. Only the admin role can reach it, whatever the permissions table says.
+const usersSlug = "users"
+
+var errLastAdmin = errors.New("there must be at least one active admin; promote another user first")
+
+// registerUsers adds the built-in Users resource. New users are invited by email to set their password;
+// deactivated users are signed out everywhere and cannot sign in until reactivated. An app that registers
+// AdminUser itself gets this resource back without its fields, so its own fields replace the built-in ones while
+// the invitation, deactivation and impersonation behaviour stays.
+func (reg *Registry) registerUsers() {
+	reg.builtinUsers = reg.Register(models.AdminUser{})
+	reg.builtinUsers.SetName("Users").SetSlug(usersSlug).SetGroup("System").HideFromDashboard().
+		RegisterField("ID", "ID", true).RegisterField("Email", "Email", false).RegisterField("Name", "Name", true).RegisterField("Role", "Role", false).
+		RegisterField("Active", "Active", false).RegisterField("LastLoginAt", "Last login", true).
+		SetFieldType("Active", "select", "true", "false").SetDefault("Active", true).
+		SetDecorator("Active", func(v interface{}) template.HTML { return template.HTML(fmt.Sprint(v)) }).
+		SetDecorator("LastLoginAt", func(v interface{}) template.HTML {
+			if t, ok := v.(*time.Time); ok && t != nil { return template.HTML(t.Format("2006-01-02 15:04")) }
+			return "Never"
+		}).
+		SetEditFields("Email", "Role", "Active").
+		OnBeforeSave(reg.checkUserSave).OnAfterSave(reg.afterUserSave).OnBeforeDelete(reg.checkUserDelete).
+		AddMemberAction("security", "Sessions & logins", func(res *Resource, w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, reg.URL("/account?user_id="+url.QueryEscape(r.URL.Query().Get("id"))), 303)
+		}).
+		AddMemberAction("impersonate", "Impersonate", reg.handleImpersonate).
+		SetActionVisible("impersonate", func(user *models.AdminUser, item map[string]interface{}) bool {
+			id, _ := item["ID"].(uint)
+			role, _ := item["Role"].(string)
+			return reg.canImpersonate(user, &models.AdminUser{ID: id, Role: role, Active: fmt.Sprint(item["Active"]) == "true"}) == nil
+		})
+}
+
+func (reg *Registry) checkUserSave(db *gorm.DB, user *models.AdminUser, item interface{}, isNew bool) error {
+	u := item.(*models.AdminUser)
+	if u.Email == "" { return errors.New("email is required") }
+	if isNew {
+		if reg.getMailer() == nil { return errors.New("users are invited by email; configure a mailer first") }
+		u.Active = true
+		return nil
+	}
+	var stored models.AdminUser
+	if err := db.First(&stored, u.ID).Error; err != nil { return err }
+	if stored.Role == "admin" && stored.Active && (u.Role != "admin" || !u.Active) { return lastAdminGuard(db, u.ID) }
+	return nil
+}
+
+// afterUserSave sends a new user's invitation, or signs a deactivated user out everywhere.
+func (reg *Registry) afterUserSave(db *gorm.DB, user *models.AdminUser, item interface{}, isNew bool) error {
+	u := item.(*models.AdminUser)
+	id := fmt.Sprint(u.ID)
+	if isNew {
+		token, err := issueResetToken(db, u.ID, time.Duration(reg.Config.InvitationTTL)*time.Hour)
+		if err != nil { return err }
+		reg.sendEmail([]string{u.Email}, "invitation", struct {
+			SiteTitle, Link, InvitedBy string
+			Hours                      int
+		}{reg.Config.SiteTitle, reg.absoluteURL("/reset?token=" + token), user.Email, reg.Config.InvitationTTL})
+		return reg.recordAction(db, user, usersSlug, id, "Invite", "Invitation sent to "+u.Email)
+	}
+	if u.Active { return nil }
+	if err := reg.sessionsFor(db).DeleteAllForUser(db.Statement.Context, u.ID); err != nil { return err }
+	return reg.recordAction(db, user, usersSlug, id, "Deactivate", "User deactivated and signed out of all sessions")
+}
+
+func (reg *Registry) checkUserDelete(db *gorm.DB, user *models.AdminUser, id string) error {
+	var stored models.AdminUser
+	if err := db.Where("id = ?", id).First(&stored).Error; err != nil { return err }
+	if stored.Role == "admin" && stored.Active { return lastAdminGuard(db, stored.ID) }
+	return nil
+}
+
+// lastAdminGuard fails when no active admin other than id exists.
+func lastAdminGuard(db *gorm.DB, id uint) error {
+	var n int64
+	if err := db.Model(&models.AdminUser{}).Where("role = ? AND active = ? AND id <> ?", "admin", true, id).Count(&n).Error; err != nil { return err }
+	if n == 0 { return errLastAdmin }
+	return nil
+}
@@ -1,35 +1,195 @@
 package admin
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
 	"github.com/ajeet-kumar1087/go-admin/resource"
 	"html/template"
+	"net/http"
+	"path"
 	"reflect"
+	"strconv"
 )
 
-func (reg *Registry) loadTemplates(contentTmpl string) *template.Template {
-	return template.Must(template.ParseFS(templateFS, "templates/layout.html", contentTmpl))
+func (reg *Registry) loadTemplates(contentTmpl string) (*template.Template, error) {
+	return reg.parseTemplates("layout.html", path.Base(contentTmpl))
 }
 
-func (reg *Registry) sliceToMap(res *resource.Resource, fields []resource.Field, slice reflect.Value) []map[string]interface{} {
+// execute renders into a buffer first so a failing template produces an error page rather than half a page.
+func (reg *Registry) execute(w http.ResponseWriter, r *http.Request, tmpl *template.Template, name string, data interface{}) {
+	if pd, ok := data.(PageData); ok {
+		pd.Brand, pd.CurrentPath, pd.ShowEditLocks = reg.brand(), r.URL.RequestURI(), reg.Config.EditLocks
+		if pd.User != nil {
+			pd.MaintenanceBanner, pd.MaintenanceOverride = reg.maintenanceBanner(), reg.maintenanceOverrides(pd.User)
+			pd.ShowSettings = len(reg.settingsGroupsFor(pd.User)) > 0
+		}
+		reg.localize(r.Context(), &pd); data = pd
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil { reg.renderError(w, r, 500, err); return }
+	buf.WriteTo(w)
+}
+
+func (reg *Registry) sliceToMap(res *resource.Resource, fields []resource.Field, slice reflect.Value, user *models.AdminUser) []map[string]interface{} {
 	var data []map[string]interface{}
-	for i := 0; i < slice.Len(); i++ { data = append(data, reg.itemToMap(res, fields, slice.Index(i))) }
+	for i := 0; i < slice.Len(); i++ { data = append(data, reg.itemToMap(res, fields, slice.Index(i), user)) }
 	return data
 }
 
-func (reg *Registry) itemToMap(res *resource.Resource, fields []resource.Field, item reflect.Value) map[string]interface{} {
-	m := make(map[string]interface{})
+func (reg *Registry) itemToMap(res *resource.Resource, fields []resource.Field, item reflect.Value, user *models.AdminUser) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields)+2)
 	item = reflect.Indirect(item)
+	meta := res.Meta()
 	for _, f := range fields {
-		fv := item.FieldByName(f.Name)
+		if f.Virtual { continue }
+		fv := meta.Value(item, f.Name)
 		if fv.IsValid() {
 			val := fv.Interface()
-			if f.Decorator != nil {
+			if f.Encrypted {
+				m[f.Name], m[f.Name+"__html"] = reg.revealField(f, user, val)
+			} else if f.Decorator != nil {
 				m[f.Name] = f.Decorator(val)
+			} else if f.Type == "tags" {
+				m[f.Name] = tagValues(val)
+			} else if s, ok := val.(string); ok && s != "" && (f.Type == "image" || f.Type == "file") {
+				m[f.Name] = reg.uploadLink(s)
+			} else if input, display, ok := formatTypedField(f, val); ok {
+				m[f.Name], m[f.Name+"__html"] = input, display
+			} else if fv.Kind() == reflect.Ptr {
+				// Nullable columns show their value, or nothing when NULL.
+				m[f.Name] = nil
+				if !fv.IsNil() { m[f.Name] = fv.Elem().Interface() }
 			} else {
 				m[f.Name] = val
 			}
 		}
 	}
-	idv := item.FieldByName("ID"); if idv.IsValid() { m["ID"] = idv.Interface() }
+	idv := meta.Value(item, "ID"); if idv.IsValid() { m["ID"] = idv.Interface() }
+	m[keyEntry] = recordKey(res, item)
+	for _, f := range fields {
+		if !f.Virtual || f.Compute == nil { continue }
+		val := f.Compute(reg.resourceHandle(res), m)
+		if f.Decorator != nil { m[f.Name] = f.Decorator(val) } else { m[f.Name] = val }
+	}
+	// Rendered HTML sits next to the value so the raw value stays available to exports and the search API.
+	for _, f := range fields {
+		if f.RenderHTML != nil { m[f.Name+"__html"] = f.RenderHTML(m[f.Name], m) }
+	}
+	return m
+}
+
+// HTMLEscape escapes text for inclusion in HTML returned from a RenderFunc.
+func HTMLEscape(s string) string { return template.HTMLEscapeString(s) }
+
+// Badge renders text as a rounded pill with the given CSS background color, for status-like cells.
+func Badge(text, color string) template.HTML {
+	return template.HTML(fmt.Sprintf(`<span class="badge" style="background: %s;">%s</span>`, template.HTMLEscapeString(color), template.HTMLEscapeString(text)))
+}
+
+// rawValues maps every real field of the resource to its undecorated value, as passed to virtual fields on export.
+func rawValues(res *resource.Resource, item reflect.Value) map[string]interface{} {
+	m := make(map[string]interface{}, len(res.Fields)+1)
+	item = reflect.Indirect(item)
+	meta := res.Meta()
+	for _, f := range res.Fields {
+		if fv := meta.Value(item, f.Name); !f.Virtual && fv.IsValid() { m[f.Name] = fv.Interface() }
+	}
+	if idv := meta.Value(item, "ID"); idv.IsValid() { m["ID"] = idv.Interface() }
 	return m
 }
+
+// fieldValue finds a struct field by name, including fields promoted from embedded structs. Unlike FieldByName it
+// does not panic on a nil embedded pointer; the field is reported missing instead.
+func fieldValue(item reflect.Value, name string) reflect.Value {
+	item = reflect.Indirect(item)
+	if item.Kind() != reflect.Struct { return reflect.Value{} }
+	sf, ok := item.Type().FieldByName(name)
+	if !ok { return reflect.Value{} }
+	v, err := item.FieldByIndexErr(sf.Index)
+	if err != nil { return reflect.Value{} }
+	return v
+}
+
+// settableField is fieldValue for writes: nil embedded pointers on the way to the field are allocated.
+func settableField(item reflect.Value, name string) reflect.Value {
+	item = reflect.Indirect(item)
+	if item.Kind() != reflect.Struct { return reflect.Value{} }
+	sf, ok := item.Type().FieldByName(name)
+	if !ok { return reflect.Value{} }
+	v := item
+	for i, x := range sf.Index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() { if !v.CanSet() { return reflect.Value{} }; v.Set(reflect.New(v.Type().Elem())) }
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// recordLabel is the text shown for a record in association pickers: its Name, else its Email, else its key.
+func recordLabel(res *resource.Resource, item reflect.Value) string {
+	item = reflect.Indirect(item)
+	if f := res.Meta().Value(item, "Name"); f.IsValid() { return fmt.Sprint(f.Interface()) }
+	if f := res.Meta().Value(item, "Email"); f.IsValid() { return fmt.Sprint(f.Interface()) }
+	return fmt.Sprintf("%s: %v", res.PrimaryKey, recordKey(res, item))
+}
+
+// visibleLabel is recordLabel for user: a Name or Email field they may see, else the key.
+func visibleLabel(res *resource.Resource, item reflect.Value, user *models.AdminUser) string {
+	item = reflect.Indirect(item)
+	visible := res.VisibleFields(user)
+	for _, name := range []string{"Name", "Email"} {
+		for _, f := range visible {
+			if f.Name != name || f.Virtual { continue }
+			if v := res.Meta().Value(item, name); v.IsValid() { return fmt.Sprint(v.Interface()) }
+		}
+	}
+	return fmt.Sprintf("%s: %v", res.PrimaryKey, recordKey(res, item))
+}
+
+// setFormValue parses form input into the field f describes, honouring typed fields such as "currency".
+func setFormValue(f resource.Field, field reflect.Value, s string) error {
+	if ok, err := parseTypedField(f, field, s); ok { return err }
+	return setFieldString(field, s)
+}
+
+// setFieldString parses a form value into a struct field of any basic kind. An empty value zeroes non-string
+// fields; unparsable values leave the field untouched and return the parse error.
+func setFieldString(field reflect.Value, s string) error {
+	if s == "" && field.Kind() != reflect.String { field.Set(reflect.Zero(field.Type())); return nil }
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil { return err }
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil { return err }
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil { return err }
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil { return err }
+		field.SetBool(b)
+	case reflect.Ptr:
+		v := reflect.New(field.Type().Elem())
+		if err := setFieldString(v.Elem(), s); err != nil { return err }
+		field.Set(v)
+	default:
+		return fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+	return nil
+}
+
+// setFieldValue assigns v to a struct field, converting through its string form when the types differ.
+func setFieldValue(field reflect.Value, v interface{}) {
+	if rv := reflect.ValueOf(v); rv.IsValid() && rv.Type().AssignableTo(field.Type()) { field.Set(rv); return }
+	setFieldString(field, fmt.Sprint(v))
+}
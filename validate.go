@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Validate checks every registered resource for configuration that would only fail once a page is requested: a
+// model without a primary key, fields that are not exported model fields, fields registered twice, associations and
+// searchable fields pointing at unregistered resources or at resources on another database, and field lists,
+// export dot-paths included, naming unknown fields. Settings fields may not use the name reserved for maintenance
+// mode. It returns one descriptive error per problem, sorted by resource, or nil when the registrations are sound.
+func (reg *Registry) Validate() []error {
+	reg.mu.RLock()
+	resources := make([]*resource.Resource, 0, len(reg.Resources))
+	names := make([]string, 0, len(reg.Resources)*2)
+	for _, res := range reg.Resources {
+		resources = append(resources, res)
+		names = append(names, res.Slug)
+		if res.TypeName() != res.Slug { names = append(names, res.TypeName()) }
+	}
+	groups := append([]*SettingsGroup(nil), reg.settingsGroups...)
+	reg.mu.RUnlock()
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Slug < resources[j].Slug })
+	var errs []error
+	for _, res := range resources {
+		for _, msg := range reg.validateResource(res, names) { errs = append(errs, fmt.Errorf("resource %s: %s", res.Name, msg)) }
+	}
+	for _, g := range groups {
+		for _, f := range g.Fields {
+			if f.Name == maintenanceSetting { errs = append(errs, fmt.Errorf("settings %s: field %q is reserved for maintenance mode", g.Name, f.Name)) }
+		}
+	}
+	return errs
+}
+
+func (reg *Registry) validateResource(res *resource.Resource, resourceNames []string) []string {
+	var problems []string
+	t := reflect.TypeOf(res.Model)
+	for t != nil && t.Kind() == reflect.Ptr { t = t.Elem() }
+	if t == nil || t.Kind() != reflect.Struct { return []string{fmt.Sprintf("model %T is not a struct", res.Model)} }
+	exported := modelFieldNames(t)
+
+	if sf, ok := t.FieldByName(res.PrimaryKey); res.PrimaryKey == "" || !ok || !sf.IsExported() {
+		problems = append(problems, fmt.Sprintf("model %s has no primary key; add an ID field or tag one `gorm:\"primaryKey\"`", t.Name()))
+	}
+
+	seen := make(map[string]bool)
+	fields := make([]string, 0, len(res.Fields))
+	for _, f := range res.Fields {
+		if seen[f.Name] { problems = append(problems, fmt.Sprintf("field %q is registered more than once", f.Name)) }
+		seen[f.Name] = true
+		fields = append(fields, f.Name)
+		switch {
+		case f.CountOf != "":
+			if a, ok := res.GetAssociation(f.CountOf); !ok || a.Type != "HasMany" {
+				problems = append(problems, fmt.Sprintf("count field %q counts %q, which is not a HasMany association", f.Name, f.CountOf))
+			}
+		case f.Virtual:
+			if f.Searchable { problems = append(problems, fmt.Sprintf("searchable field %q is virtual and has no column to search", f.Name)) }
+		default:
+			if sf, ok := t.FieldByName(f.Name); ok && !sf.IsExported() {
+				problems = append(problems, fmt.Sprintf("field %q is unexported in %s and cannot be read or saved", f.Name, t.Name()))
+			} else if !ok {
+				problems = append(problems, fmt.Sprintf("field %q is not a field of %s%s", f.Name, t.Name(), didYouMean(f.Name, exported)))
+			}
+		}
+		if f.Searchable && f.SearchResource != "" {
+			if target, ok := reg.GetResource(f.SearchResource); !ok {
+				problems = append(problems, fmt.Sprintf("searchable field %q references unregistered resource '%s'%s", f.Name, f.SearchResource, didYouMean(f.SearchResource, resourceNames)))
+			} else if !reg.sameDatabase(res, target) {
+				problems = append(problems, fmt.Sprintf("searchable field %q searches resource '%s', which is on a different database; searches can't join across databases", f.Name, target.Slug))
+			}
+		}
+	}
+
+	for _, a := range res.Associations {
+		target, ok := reg.GetResource(a.ResourceName)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("association %s references unregistered resource '%s'%s", a.Name, a.ResourceName, didYouMean(a.ResourceName, resourceNames)))
+			continue
+		}
+		if !reg.sameDatabase(res, target) {
+			problems = append(problems, fmt.Sprintf("association %s links to resource '%s', which is on a different database; associations can't join across databases", a.Name, target.Slug))
+		}
+		tt := reflect.TypeOf(target.Model)
+		for tt.Kind() == reflect.Ptr { tt = tt.Elem() }
+		// HasMany and BelongsTo foreign keys both name a field of the target (for BelongsTo, the referenced key, its
+		// primary key by default); a BelongsTo's own name is the local key, with or without an "ID" suffix.
+		if _, ok := tt.FieldByName(a.ForeignKey); a.ForeignKey != "" && !ok {
+			problems = append(problems, fmt.Sprintf("association %s uses foreign key %q, which is not a field of %s%s", a.Name, a.ForeignKey, tt.Name(), didYouMean(a.ForeignKey, modelFieldNames(tt))))
+		}
+		switch {
+		case a.OnDelete == "":
+		case a.Type != "HasMany" && a.Type != "HasOne":
+			problems = append(problems, fmt.Sprintf("association %s sets an on-delete strategy, which only HasMany and HasOne associations use", a.Name))
+		case a.OnDelete != resource.DependentBlock && a.OnDelete != resource.DependentCascade && a.OnDelete != resource.DependentNullify:
+			problems = append(problems, fmt.Sprintf("association %s has unknown on-delete strategy %q", a.Name, a.OnDelete))
+		case a.OnDelete == resource.DependentNullify:
+			// Clearing the foreign key reads back as NULL, which only a pointer field holds.
+			if f, ok := tt.FieldByName(a.ForeignKey); ok && f.Type.Kind() != reflect.Ptr {
+				problems = append(problems, fmt.Sprintf("association %s nullifies foreign key %q, which is not a pointer field and can't hold NULL", a.Name, a.ForeignKey))
+			}
+		}
+		if a.Type == "BelongsTo" {
+			_, ok := t.FieldByName(a.Name)
+			if _, idOK := t.FieldByName(a.Name + "ID"); !ok && !idOK {
+				problems = append(problems, fmt.Sprintf("association %s has no local key: %s has neither %s nor %sID%s", a.Name, t.Name(), a.Name, a.Name, didYouMean(a.Name, exported)))
+			}
+		}
+	}
+
+	for _, list := range []struct {
+		name  string
+		names []string
+	}{{"index", res.IndexFields}, {"show", res.ShowFields}, {"edit", res.EditFields}} {
+		for _, n := range list.names {
+			if !seen[n] { problems = append(problems, fmt.Sprintf("%s fields name unknown field %q%s", list.name, n, didYouMean(n, fields))) }
+		}
+	}
+	for _, n := range res.ExportPaths {
+		assoc, name, isPath := strings.Cut(n, ".")
+		if !isPath {
+			if !seen[n] { problems = append(problems, fmt.Sprintf("export fields name unknown field %q%s", n, didYouMean(n, fields))) }
+			continue
+		}
+		var target *resource.Resource
+		for _, a := range res.Associations {
+			if a.Type == "BelongsTo" && (a.Name == assoc || strings.TrimSuffix(a.Name, "ID") == assoc) { target, _ = reg.GetResource(a.ResourceName); break }
+		}
+		if target == nil { problems = append(problems, fmt.Sprintf("export field %q does not start with a BelongsTo association", n)); continue }
+		if !fieldListed(target.Fields, name) { problems = append(problems, fmt.Sprintf("export field %q names no field of %s", n, target.Name)) }
+	}
+	return problems
+}
+
+// modelFieldNames lists a struct's exported fields, including those promoted from embedded structs.
+func modelFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type; if ft.Kind() == reflect.Ptr { ft = ft.Elem() }
+		if sf.Anonymous && ft.Kind() == reflect.Struct { names = append(names, modelFieldNames(ft)...); continue }
+		if sf.IsExported() { names = append(names, sf.Name) }
+	}
+	return names
+}
+
+// didYouMean suggests the candidate closest to name, matching case-insensitively or within a couple of edits, as a
+// "; did you mean 'X'?" suffix, or "" when nothing is close.
+func didYouMean(name string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if c == name { continue }
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if d < bestDist { best, bestDist = c, d }
+	}
+	if best == "" { return "" }
+	return fmt.Sprintf("; did you mean '%s'?", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev { prev[j] = j }
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] { cost = 0 }
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkValidation validates the registrations on the first request. Problems are logged as warnings, and in
+// Config.StrictValidation mode every request is refused with a 500 listing them, so a broken setup fails at once
+// rather than on whichever page trips over it.
+func (reg *Registry) checkValidation(w http.ResponseWriter) bool {
+	reg.validated.Do(func() {
+		reg.validationErrs = reg.Validate()
+		for _, err := range reg.validationErrs { reg.Logger.Warn("invalid resource configuration", "error", err) }
+	})
+	if len(reg.validationErrs) == 0 || !reg.Config.StrictValidation { return true }
+	msgs := make([]string, len(reg.validationErrs))
+	for i, err := range reg.validationErrs { msgs[i] = err.Error() }
+	reg.renderErrorPage(w, http.StatusInternalServerError, "The admin configuration is invalid:\n"+strings.Join(msgs, "\n"))
+	return false
+}
@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"html/template"
+	"net/url"
+)
+
+// ViewLink switches the index page between its table, tree, board and calendar views.
+type ViewLink struct {
+	Label  string
+	URL    template.URL
+	Active bool
+}
+
+// listViews returns the requested view of res's index page and links to each of its views; there are none unless the
+// resource has a tree, board or calendar. The table is view "", except on tree resources, which open on their tree.
+func listViews(res *resource.Resource, params url.Values) (string, []ViewLink) {
+	available := []string{""}
+	if res.TreeField != "" { available = []string{"tree", "table"} }
+	if res.BoardField != "" { available = append(available, "board") }
+	if res.CalendarStart != "" { available = append(available, "calendar") }
+	view := available[0]
+	for _, v := range available { if v == params.Get("view") { view = v } }
+	if len(available) == 1 { return view, nil }
+	labels := map[string]string{"": "Table", "table": "Table", "tree": "Tree", "board": "Board", "calendar": "Calendar"}
+	var links []ViewLink
+	for _, v := range available {
+		q := url.Values{}
+		for k, vals := range params { if k != "view" && k != "page" { q[k] = vals } }
+		if v != "" { q.Set("view", v) }
+		links = append(links, ViewLink{Label: labels[v], URL: template.URL("?" + q.Encode()), Active: v == view})
+	}
+	return view, links
+}
@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watchedEvent is the webhook event sent when a watched record's watchers are notified.
+const watchedEvent = "watched"
+
+// watchActivity is how many recent audit entries the watched records page shows per record.
+const watchActivity = 3
+
+// watchedActions are the audited actions, lower-cased, that notify a record's watchers.
+var watchedActions = map[string]bool{"update": true, "assign": true, "delete": true, "comment": true, "delete comment": true}
+
+// WatchEntry is a row of the watched records page: the watch, its record's label and link (empty once the record
+// is gone), and its most recent audit entries.
+type WatchEntry struct {
+	Watch    models.Watch
+	Resource *resource.Resource
+	Label    string
+	Link     string
+	Activity []models.AuditLog
+}
+
+// watchEmail is the data for templates/emails/record_watch.html.
+type watchEmail struct {
+	actionEmail
+	Label, WatchesLink string
+}
+
+// recordWatchers returns the active users watching the record an audit entry is about, when its action notifies
+// watchers, less the actor and anyone who may no longer see the record.
+func (reg *Registry) recordWatchers(resName, recordID, action string, actor *models.AdminUser) []models.AdminUser {
+	if recordID == "" || !watchedActions[strings.ToLower(action)] { return nil }
+	res, ok := reg.GetResource(resName)
+	if !ok { return nil }
+	var users []models.AdminUser
+	watches := reg.DB.Model(&models.Watch{}).Select("user_id").Where("resource_name = ? AND record_id = ?", res.Slug, recordID)
+	if err := reg.DB.Where("active = ? AND id IN (?)", true, watches).Order("id").Find(&users).Error; err != nil {
+		reg.Logger.Error("loading watchers failed", "resource", res.Slug, "id", recordID, "error", err)
+		return nil
+	}
+	var watchers []models.AdminUser
+	for i := range users {
+		u := &users[i]
+		if (actor != nil && u.ID == actor.ID) || !reg.IsAllowed(u.Role, res.Slug, "show") { continue }
+		// A deleted record can't be looked up; the show permission is all that can be checked.
+		if !strings.EqualFold(action, "Delete") {
+			if _, err := reg.getContext(withUser(context.Background(), u), res.Slug, recordID); err != nil { continue }
+		}
+		watchers = append(watchers, *u)
+	}
+	return watchers
+}
+
+// notifyWatchers emails each watcher about an audited change to the record they watch and, when any were notified,
+// sends the "watched" webhook event. A watcher who may not see some of the changed fields gets a note listing only
+// the others, so watchers are grouped by the note they may read: one email and one event per group.
+func (reg *Registry) notifyWatchers(watchers []models.AdminUser, actor *models.AdminUser, resName string, data actionEmail, fields map[string]FieldChange) {
+	if len(watchers) == 0 { return }
+	res, ok := reg.GetResource(resName)
+	email := watchEmail{actionEmail: data, Label: data.Resource + " #" + data.RecordID, WatchesLink: reg.absoluteURL("/watches")}
+	if ok && data.Link != "" {
+		if item, err := reg.getContext(context.Background(), res.Slug, data.RecordID); err == nil { email.Label = recordLabel(res, reflect.ValueOf(item)) }
+	}
+	var notes []string
+	groups := map[string][]string{}
+	for i := range watchers {
+		note := data.Changes
+		if ok { note = watcherNote(res, data.Changes, fields, &watchers[i]) }
+		if _, seen := groups[note]; !seen { notes = append(notes, note) }
+		groups[note] = append(groups[note], watchers[i].Email)
+	}
+	for _, note := range notes {
+		to := groups[note]
+		e := email
+		e.Changes = note
+		reg.sendEmail(to, "record_watch", e)
+		ev := WebhookEvent{Resource: resName, Action: watchedEvent, RecordID: data.RecordID, Summary: data.Action + ": " + note, Watchers: to, Timestamp: time.Now().UTC()}
+		if actor != nil { ev.User, ev.UserID = actor.Email, actor.ID }
+		reg.queueWebhooks(ev)
+	}
+}
+
+// watcherNote is an audit note as watcher may read it: the note itself, or when some of the changed fields are
+// hidden from them, a note describing only the changes to the fields they can see.
+func watcherNote(res *resource.Resource, note string, fields map[string]FieldChange, watcher *models.AdminUser) string {
+	visible, hidden := make(map[string]FieldChange, len(fields)), false
+	for _, f := range res.Fields {
+		c, ok := fields[f.Name]
+		if !ok { continue }
+		if f.VisibleFor(watcher) { visible[f.Name] = c } else { hidden = true }
+	}
+	if !hidden { return note }
+	if len(visible) == 0 { return "Fields you can't see were changed" }
+	return changesNote(res, visible, false)
+}
+
+// watching reports whether user watches the record of res keyed id.
+func (reg *Registry) watching(r *http.Request, res *resource.Resource, id string, user *models.AdminUser) bool {
+	var n int64
+	reg.dbFor(r).Model(&models.Watch{}).Where("user_id = ? AND resource_name = ? AND record_id = ?", user.ID, res.Slug, id).Count(&n)
+	return n > 0
+}
+
+// handleWatch serves POST /<resource>/watch?id=N, which starts or stops watching the record, then returns to it.
+func (reg *Registry) handleWatch(res *resource.Resource, w http.ResponseWriter, r *http.Request, user *models.AdminUser) {
+	if r.Method != "POST" { http.Error(w, "Method not allowed", http.StatusMethodNotAllowed); return }
+	item, err := reg.getContext(r.Context(), res.Slug, r.URL.Query().Get("id"))
+	if err != nil { reg.renderRecordError(w, r, err); return }
+	id := fmt.Sprint(recordKey(res, reflect.ValueOf(item)))
+	watch := models.Watch{UserID: user.ID, ResourceName: res.Slug, RecordID: id}
+	if result := reg.dbFor(r).Where(&watch).Delete(&models.Watch{}); result.Error != nil {
+		reg.renderError(w, r, 500, result.Error); return
+	} else if result.RowsAffected > 0 {
+		reg.setFlash(w, reg.T(r.Context(), "You are no longer watching this record"))
+	} else {
+		watch.CreatedAt = time.Now()
+		if err := reg.dbFor(r).Create(&watch).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		reg.setFlash(w, reg.T(r.Context(), "You will be emailed when someone else changes this record"))
+	}
+	http.Redirect(w, r, reg.recordURL(res, id), 303)
+}
+
+// handleWatches serves the signed-in user's watched records page at /watches, and /watches/unwatch to stop
+// watching one of them.
+func (reg *Registry) handleWatches(w http.ResponseWriter, r *http.Request, upath string, user *models.AdminUser) {
+	switch upath {
+	case "/watches":
+	case "/watches/unwatch":
+		if r.Method != "POST" { http.Error(w, "Method not allowed", http.StatusMethodNotAllowed); return }
+		id, _ := strconv.ParseUint(r.FormValue("id"), 10, 64)
+		if err := reg.dbFor(r).Where("id = ? AND user_id = ?", id, user.ID).Delete(&models.Watch{}).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		http.Redirect(w, r, reg.URL("/watches"), 303)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var watches []models.Watch
+	if err := reg.dbFor(r).Where("user_id = ?", user.ID).Order("created_at desc, id desc").Find(&watches).Error; err != nil { reg.renderError(w, r, 500, err); return }
+	entries := make([]WatchEntry, 0, len(watches))
+	for _, wt := range watches {
+		e := WatchEntry{Watch: wt, Label: wt.ResourceName + " #" + wt.RecordID}
+		// Records the user may no longer see are listed by key only, so they can still be unwatched.
+		res, ok := reg.GetResource(wt.ResourceName)
+		if ok && reg.IsAllowed(user.Role, res.Slug, "show") {
+			e.Resource, e.Label = res, reg.recordTitle(r.Context(), res, wt.RecordID)
+			if item, err := reg.getContext(r.Context(), res.Slug, wt.RecordID); err == nil { e.Label, e.Link = recordLabel(res, reflect.ValueOf(item)), reg.recordURL(res, wt.RecordID) }
+			if err := reg.dbFor(r).Where("resource_name = ? AND record_id = ?", wt.ResourceName, wt.RecordID).Order("created_at desc, id desc").Limit(watchActivity).Find(&e.Activity).Error; err != nil { reg.renderError(w, r, 500, err); return }
+		}
+		entries = append(entries, e)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := reg.loadTemplates("templates/watches.html")
+	if err != nil { reg.renderError(w, r, 500, err); return }
+	reg.execute(w, r, tmpl, "watches.html", PageData{
+		SiteTitle: reg.Config.SiteTitle, BasePath: reg.basePath(), GroupedResources: reg.getGroupedResources(user), GroupedPages: reg.getGroupedPages(user), NavGroups: reg.navGroups(user),
+		User: user, CSS: reg.styleCSS(), Flash: reg.getFlash(w, r), Watches: entries,
+		Title: reg.T(r.Context(), "Watched records"), Breadcrumbs: reg.breadcrumbs(r.Context(), Crumb{Label: reg.T(r.Context(), "Watched records")}),
+	})
+}
@@ -0,0 +1,230 @@
+package admin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"github.com/ajeet-kumar1087/go-admin/resource"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookConfig subscribes an endpoint to record changes. Empty Resources or Events match everything; events are
+// "create", "update" and "delete". The "watched" event, sent when a watched record's watchers are notified, only goes
+// to webhooks that list it in Events. When Secret is set, each request carries an X-GoAdmin-Signature header of
+// "sha256=" followed by the hex HMAC-SHA256 of the body.
+type WebhookConfig struct {
+	URL, Secret string
+	Resources   []string
+	Events      []string
+}
+
+// FieldChange is a field's value before and after a change; From is nil on create.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// WebhookEvent is the JSON body posted to webhooks.
+type WebhookEvent struct {
+	Resource  string                 `json:"resource"`
+	Action    string                 `json:"action"`
+	RecordID  string                 `json:"record_id"`
+	Changes   map[string]FieldChange `json:"changes,omitempty"`
+	// Summary and Watchers describe a "watched" event: the audited change, and who was notified of it.
+	Summary   string                 `json:"summary,omitempty"`
+	Watchers  []string               `json:"watchers,omitempty"`
+	User      string                 `json:"user"`
+	UserID    uint                   `json:"user_id"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// webhookDispatcher delivers queued deliveries with a fixed pool of workers, started by the first AddWebhook.
+type webhookDispatcher struct {
+	start   sync.Once
+	queue   chan uint
+	client  *http.Client
+	backoff time.Duration // delay before the first retry, doubled for each further one
+}
+
+func newWebhookDispatcher() *webhookDispatcher {
+	return &webhookDispatcher{queue: make(chan uint, 1000), client: &http.Client{Timeout: 10 * time.Second}, backoff: 2 * time.Second}
+}
+
+// AddWebhook subscribes an endpoint to changes made through the admin. Deliveries are queued and sent in the
+// background, so a slow or failing endpoint never affects the request that made the change. Every delivery is
+// kept as a WebhookDelivery (migrate that model), listed under System where failed ones can be retried.
+func (reg *Registry) AddWebhook(cfg WebhookConfig) {
+	reg.mu.Lock()
+	reg.Webhooks = append(reg.Webhooks, cfg)
+	reg.mu.Unlock()
+	reg.webhooks.start.Do(func() {
+		reg.registerDeliveries()
+		workers := reg.Config.WebhookWorkers; if workers < 1 { workers = 1 }
+		for i := 0; i < workers; i++ {
+			reg.goBackground(func(ctx context.Context) {
+				for {
+					select {
+					case <-ctx.Done(): return
+					case id := <-reg.webhooks.queue: reg.deliverWebhook(id)
+					}
+				}
+			})
+		}
+	})
+}
+
+// registerDeliveries adds the delivery log as a read-only resource with a retry action.
+func (reg *Registry) registerDeliveries() {
+	res := reg.Register(models.WebhookDelivery{}).SetGroup("System").SetReadOnly(true).HideFromDashboard().
+		RegisterField("ID", "ID", true).RegisterField("ResourceName", "Resource", true).RegisterField("Event", "Event", true).
+		RegisterField("RecordID", "Record", true).RegisterField("URL", "URL", true).RegisterField("Status", "Status", true).
+		RegisterField("Attempts", "Attempts", true).RegisterField("ResponseCode", "Response", true).
+		RegisterField("LastError", "Last error", true).RegisterField("Payload", "Payload", true).RegisterField("CreatedAt", "Created", true).
+		AddScope("failed", "Failed", func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", deliveryFailed) }).
+		AddScope("pending", "Pending", func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", deliveryPending) }).
+		AddMemberAction("retry", "Retry", func(res *resource.Resource, w http.ResponseWriter, r *http.Request) {
+			n := reg.retryDeliveries(r.URL.Query().Get("id"))
+			reg.setFlash(w, reg.T(r.Context(), "Retrying %d deliveries", n))
+			http.Redirect(w, r, reg.URL("/"+res.Slug+"/show?id="+r.URL.Query().Get("id")), 303)
+		}).
+		AddBatchAction("retry", "Retry", func(res *resource.Resource, ids []string, w http.ResponseWriter, r *http.Request) {
+			n := reg.retryDeliveries(ids...)
+			reg.setFlash(w, reg.T(r.Context(), "Retrying %d deliveries", n))
+			http.Redirect(w, r, reg.URL("/"+res.Slug), 303)
+		}).
+		MarkActionSafe("retry").
+		SetActionVisible("retry", func(u *models.AdminUser, item map[string]interface{}) bool { return item["Status"] == deliveryFailed })
+	res.IndexFields = []string{"ID", "ResourceName", "Event", "RecordID", "URL", "Status", "Attempts", "ResponseCode", "CreatedAt"}
+}
+
+// retryDeliveries requeues failed deliveries for a fresh series of attempts and returns how many were requeued.
+func (reg *Registry) retryDeliveries(ids ...string) int {
+	var deliveries []models.WebhookDelivery
+	reg.DB.Where("id IN ? AND status = ?", ids, deliveryFailed).Find(&deliveries)
+	for _, d := range deliveries {
+		reg.DB.Model(&d).Updates(map[string]interface{}{"status": deliveryPending, "attempts": 0})
+		reg.webhooks.enqueue(reg, d.ID)
+	}
+	return len(deliveries)
+}
+
+// enqueue hands a pending delivery to the workers. When the queue is full the delivery is marked failed, so it shows
+// up under Failed and can be retried instead of staying pending with nothing to send it.
+func (wd *webhookDispatcher) enqueue(reg *Registry, id uint) {
+	select {
+	case wd.queue <- id:
+	default:
+		reg.Logger.Warn("webhook queue full, delivery marked failed", "delivery", id)
+		err := reg.DB.Model(&models.WebhookDelivery{}).Where("id = ? AND status = ?", id, deliveryPending).
+			Updates(map[string]interface{}{"status": deliveryFailed, "last_error": "delivery queue full"}).Error
+		if err != nil { reg.Logger.Error("webhook delivery update failed", "delivery", id, "error", err) }
+	}
+}
+
+func matches(list []string, v string) bool {
+	if len(list) == 0 { return true }
+	for _, x := range list { if x == v { return true } }
+	return false
+}
+
+// notifyChange queues a webhook delivery for every webhook subscribed to the change. It only touches the database
+// to log the deliveries; sending happens on the worker pool.
+func (reg *Registry) notifyChange(user *models.AdminUser, resName, event, recordID string, changes map[string]FieldChange) {
+	ev := WebhookEvent{Resource: resName, Action: event, RecordID: recordID, Changes: changes, Timestamp: time.Now().UTC()}
+	if user != nil { ev.User, ev.UserID = user.Email, user.ID }
+	reg.queueWebhooks(ev)
+}
+
+// queueWebhooks logs and queues a delivery of ev to every webhook subscribed to it.
+func (reg *Registry) queueWebhooks(ev WebhookEvent) {
+	reg.mu.RLock()
+	hooks := append([]WebhookConfig(nil), reg.Webhooks...)
+	reg.mu.RUnlock()
+	var body []byte
+	for _, h := range hooks {
+		if !matches(h.Resources, ev.Resource) || !matches(h.Events, ev.Action) || (ev.Action == watchedEvent && !slices.Contains(h.Events, watchedEvent)) { continue }
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(ev); err != nil { reg.Logger.Error("webhook payload failed", "resource", ev.Resource, "error", err); return }
+		}
+		d := &models.WebhookDelivery{URL: h.URL, Event: ev.Action, ResourceName: ev.Resource, RecordID: ev.RecordID, Payload: string(body), Status: deliveryPending, CreatedAt: time.Now()}
+		if err := reg.DB.Create(d).Error; err != nil { reg.Logger.Error("webhook delivery log failed", "url", h.URL, "error", err); continue }
+		reg.webhooks.enqueue(reg, d.ID)
+	}
+}
+
+// deliverWebhook makes one attempt at a delivery, scheduling a retry with backoff until WebhookMaxAttempts.
+func (reg *Registry) deliverWebhook(id uint) {
+	var d models.WebhookDelivery
+	if err := reg.DB.First(&d, id).Error; err != nil || d.Status != deliveryPending { return }
+	var secret string
+	reg.mu.RLock()
+	for _, h := range reg.Webhooks { if h.URL == d.URL { secret = h.Secret; break } }
+	reg.mu.RUnlock()
+
+	err := func() error {
+		req, err := http.NewRequest("POST", d.URL, strings.NewReader(d.Payload))
+		if err != nil { return err }
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GoAdmin-Event", d.ResourceName+"."+d.Event)
+		req.Header.Set("X-GoAdmin-Delivery", fmt.Sprint(d.ID))
+		if secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret)); mac.Write([]byte(d.Payload))
+			req.Header.Set("X-GoAdmin-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := reg.webhooks.client.Do(req)
+		if err != nil { return err }
+		resp.Body.Close()
+		d.ResponseCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode > 299 { return fmt.Errorf("endpoint returned %s", resp.Status) }
+		return nil
+	}()
+	d.Attempts++
+	if err == nil {
+		now := time.Now()
+		d.Status, d.LastError, d.DeliveredAt = deliveryDelivered, "", &now
+	} else {
+		d.LastError = err.Error()
+		if d.Attempts >= reg.Config.WebhookMaxAttempts {
+			d.Status = deliveryFailed
+			reg.Logger.Error("webhook delivery failed", "delivery", d.ID, "url", d.URL, "attempts", d.Attempts, "error", err)
+		} else {
+			reg.Logger.Warn("webhook delivery attempt failed, retrying", "delivery", d.ID, "url", d.URL, "attempt", d.Attempts, "error", err)
+			delay := reg.webhooks.backoff << (d.Attempts - 1)
+			time.AfterFunc(delay, func() { reg.webhooks.enqueue(reg, d.ID) })
+		}
+	}
+	reg.DB.Save(&d)
+}
+
+// changedFields lists the resource fields that differ between two rawValues snapshots; before is nil on create.
+func changedFields(res *resource.Resource, before, after map[string]interface{}) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for _, f := range res.Fields {
+		to, ok := after[f.Name]
+		if !ok { continue }
+		from, had := before[f.Name]
+		if before == nil {
+			if !reflect.ValueOf(to).IsValid() || reflect.ValueOf(to).IsZero() { continue }
+			changes[f.Name] = FieldChange{To: to}; continue
+		}
+		if !had || fmt.Sprint(from) != fmt.Sprint(to) { changes[f.Name] = FieldChange{From: from, To: to} }
+	}
+	return changes
+}
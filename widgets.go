@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ajeet-kumar1087/go-admin/models"
+	"html/template"
+	"sort"
+	"time"
+)
+
+// DashboardWidget is a panel on the dashboard, shown below the stats and charts. Widgets are ordered by Priority
+// (lower first), then registration order; a widget whose Render returns nothing is left out for that user, as is
+// one whose VisibleTo roles (admins aside) don't include theirs.
+type DashboardWidget struct {
+	Label     string
+	Priority  int
+	Render    func(user *models.AdminUser) template.HTML
+	VisibleTo []string
+}
+
+// RenderedWidget is a widget's output for one dashboard request.
+type RenderedWidget struct {
+	Label string
+	HTML  template.HTML
+}
+
+// AddDashboardWidget adds a dashboard panel; set Priority on the returned widget to move it.
+// The built-in "Recent activity" panel has priority 0.
+func (reg *Registry) AddDashboardWidget(label string, render func(user *models.AdminUser) template.HTML) *DashboardWidget {
+	reg.mu.Lock(); defer reg.mu.Unlock()
+	wd := &DashboardWidget{Label: label, Render: render}
+	reg.Widgets = append(reg.Widgets, wd)
+	return wd
+}
+
+func (reg *Registry) renderWidgets(user *models.AdminUser) []RenderedWidget {
+	reg.mu.RLock()
+	widgets := append([]*DashboardWidget(nil), reg.Widgets...)
+	reg.mu.RUnlock()
+	sort.SliceStable(widgets, func(i, j int) bool { return widgets[i].Priority < widgets[j].Priority })
+	var out []RenderedWidget
+	for _, wd := range widgets {
+		if !visibleToRoles(wd.VisibleTo, user) { continue }
+		if html := wd.Render(user); html != "" { out = append(out, RenderedWidget{Label: wd.Label, HTML: html}) }
+	}
+	return out
+}
+
+// activityEntry is one audit log line in the recent activity panel.
+type activityEntry struct {
+	User, Action, Resource, RecordID, Changes string
+	RecordURL                                 string
+	When                                      string
+	At                                        time.Time
+}
+
+// renderActivity is the built-in "Recent activity" panel: the last Config.ActivityFeedSize audit entries on
+// resources the user may list. A size of 0 hides the panel.
+func (reg *Registry) renderActivity(user *models.AdminUser) template.HTML {
+	limit := reg.Config.ActivityFeedSize
+	if limit <= 0 || user == nil { return "" }
+	var slugs []string
+	for _, res := range reg.sortedResources() {
+		if reg.IsAllowed(user.Role, res.Slug, "list") { slugs = append(slugs, res.Slug) }
+	}
+	var logs []models.AuditLog
+	if len(slugs) > 0 { reg.reader(context.Background()).Where("resource_name IN ?", slugs).Order("created_at desc").Order("id desc").Limit(limit).Find(&logs) }
+	now := time.Now()
+	entries := make([]activityEntry, 0, len(logs))
+	for _, l := range logs {
+		e := activityEntry{User: l.UserEmail, Action: l.Action, Resource: l.ResourceName, RecordID: l.RecordID, Changes: l.Changes, When: timeAgo(now.Sub(l.CreatedAt)), At: l.CreatedAt}
+		if res, ok := reg.GetResource(l.ResourceName); ok {
+			e.Resource = res.Name
+			if l.RecordID != "" && l.Action != "Delete" { e.RecordURL = reg.URL(fmt.Sprintf("/%s/show?id=%s", res.Slug, l.RecordID)) }
+		}
+		entries = append(entries, e)
+	}
+	tmpl, err := reg.parseTemplates("activity.html")
+	if err != nil { return template.HTML(template.HTMLEscapeString(err.Error())) }
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, entries); err != nil { return template.HTML(template.HTMLEscapeString(err.Error())) }
+	return template.HTML(buf.String())
+}
+
+// timeAgo formats a duration as a short relative time, e.g. "5 minutes ago".
+func timeAgo(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 { return fmt.Sprintf("1 %s ago", unit) }
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	}
+	return plural(int(d/(30*24*time.Hour)), "month")
+}